@@ -1,21 +1,42 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/gorpher/winspool-cgo/model"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/cheynewallace/tabby"
 	"github.com/gorpher/gone"
 	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/manager"
+	"github.com/gorpher/winspool-cgo/rpc"
+	"github.com/gorpher/winspool-cgo/rpc/spoolerpb"
+	"github.com/gorpher/winspool-cgo/server"
 	"github.com/gorpher/winspool-cgo/winspool"
 	cli "github.com/urfave/cli/v2"
+	"google.golang.org/grpc"
+)
+
+// Command categories: user commands work for any user on their own jobs,
+// admin commands need to run as administrator.
+const (
+	userCategory  = "用户命令"
+	adminCategory = "管理命令"
 )
 
 var (
@@ -25,265 +46,3387 @@ var (
 )
 
 type App struct {
-	spool *winspool.WinSpool
-	jobs  chan *lib.Job
+	spool  *winspool.WinSpool
+	jobs   chan *lib.Job
+	config *lib.Config
+	// Last lines of the daemon log, for support bundles.
+	logTail *lib.LogTail
+	// Print system events are written to when set.
+	eventRecords *lib.EventRecordWriter
+	// Records finished jobs when accounting is configured.
+	accountant *manager.Accountant
 }
 
-func (a *App) ListPrinter(c *cli.Context) error {
-	printers, err := a.spool.GetPrinters()
+func (a *App) LoadConfig(c *cli.Context) error {
+	if err := checkOutputFormat(c); err != nil {
+		return err
+	}
+	config, err := lib.GetConfig(c.String("config"))
 	if err != nil {
 		return err
 	}
-	OutputPrintList(printers)
-	return nil
-}
-
-func (a *App) InspectPrinter(c *cli.Context) error {
-	args := c.Args()
-	if args.Len() < 1 {
-		return errors.New("请输入打印机名称")
+	if err = a.spool.SetPrinterConfigs(config.Printers); err != nil {
+		return err
 	}
-	printerName := args.Get(0)
-	printers, err := a.spool.GetPrinters()
+	a.spool.GhostscriptPath = config.GhostscriptPath
+	a.spool.HTMLConverter = config.HTMLConverter
+	a.spool.RenderLimits = config.RenderLimits
+	a.spool.LayoutFont = config.LayoutFont
+	a.spool.TextFormat = lib.TextFormat{}
+	if config.TextFormat != nil {
+		if err = config.TextFormat.Validate(); err != nil {
+			return fmt.Errorf("invalid text_format: %s", err)
+		}
+		a.spool.TextFormat = *config.TextFormat
+	}
+	a.spool.RenderWorkers, a.spool.RenderDPI = config.RenderWorkers, config.RenderDPI
+	if err = winspool.CheckPDFRenderer(config.PDFRenderer); err != nil {
+		return fmt.Errorf("invalid pdf_renderer: %s", err)
+	}
+	a.spool.PDFRenderer = config.PDFRenderer
+	a.spool.DetectPDFDirect = config.PDFDirectDetect
+	ttl, err := config.GetCapabilityCacheTTL()
 	if err != nil {
-		return errors.New("没有可用打印机")
+		return fmt.Errorf("invalid capability_cache_ttl: %s", err)
 	}
-	var printer *lib.Printer
-	for _, p := range printers {
-		if p.Name == printerName {
-			printer = &p
-		}
+	a.spool.SetCapabilityCacheTTL(ttl)
+	if a.spool.Retry, err = config.SpoolerRetry.Policy(); err != nil {
+		return fmt.Errorf("invalid spooler_retry: %s", err)
 	}
-	if printer == nil {
-		return errors.New("打印机不存在")
+	server := config.PrintServer
+	if c.String("server") != "" {
+		server = c.String("server")
 	}
-	body, err := json.MarshalIndent(*printer, "", "   ")
+	if a.spool.Server, err = lib.PrintServerName(server); err != nil {
+		return err
+	}
+	a.spool.PrinterConnections = config.PrinterConnections
+	idleTimeout, err := config.GetPrinterHandleIdleTimeout()
 	if err != nil {
+		return fmt.Errorf("invalid printer_handle_idle_timeout: %s", err)
+	}
+	a.spool.SetPrinterHandleIdleTimeout(idleTimeout)
+	if err = a.spool.SetVirtualPrinters(config.VirtualPrinters); err != nil {
 		return err
 	}
-	fmt.Println(string(body))
+	a.spool.Quotas = nil
+	if config.Accounting != nil && config.Accounting.Quotas != nil {
+		if a.spool.Quotas, err = openQuotas(config.Accounting); err != nil {
+			return err
+		}
+	}
+	a.spool.HeldJobs = nil
+	if config.HeldJobsFile != "" {
+		if a.spool.HeldJobs, err = lib.OpenHeldJobs(config.HeldJobsFile); err != nil {
+			return err
+		}
+	}
+	a.spool.DevModePresets = nil
+	if config.DevModePresetsDir != "" {
+		a.spool.DevModePresets = &lib.DevModePresets{Dir: config.DevModePresetsDir}
+	}
+	a.spool.Faults = nil
+	if len(config.Faults) > 0 {
+		if a.spool.Faults, err = lib.NewFaults(config.Faults); err != nil {
+			return err
+		}
+	}
+	a.config = config
 	return nil
 }
 
-func (a *App) AddJob(c *cli.Context) error {
-	filename := c.String("filename")
-	if filename == "" {
-		return errors.New("文件名不能为空")
+// openQuotas checks the quotas of the accounting config against its
+// database.
+func openQuotas(config *lib.AccountingConfig) (*lib.Quotas, error) {
+	if err := config.Quotas.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid accounting.quotas: %s", err)
 	}
-	printerName := c.String("printer")
-	if printerName == "" {
-		return errors.New("打印机不能为空")
+	if config.DBFile == "" {
+		return nil, errors.New(tr("accounting.quotas 需要配置 accounting.db_file"))
 	}
-	if !gone.FileExist(filename) {
-		return fmt.Errorf("文件 %s 不存在", filename)
+	db, err := lib.OpenAccountingDB(config.DBFile)
+	if err != nil {
+		return nil, err
 	}
+	return lib.NewQuotas(*config.Quotas, db), nil
+}
+
+func (a *App) ListPrinter(c *cli.Context) error {
 	printers, err := a.spool.GetPrinters()
 	if err != nil {
-		return errors.New("没有可用打印机")
-	}
-	var printer *lib.Printer
-	for _, p := range printers {
-		if p.Name == printerName {
-			printer = &p
-		}
+		return err
 	}
-	if printer == nil {
-		return errors.New("打印机不存在")
+	if jsonOutput(c) {
+		return printJSON(newPrinterOutputs(printers))
 	}
-	var nativeJobQueueSize uint = 2
-	printer.NativeJobSemaphore = lib.NewSemaphore(nativeJobQueueSize)
+	OutputPrintList(printers)
+	return nil
+}
 
-	jobID, err := a.spool.Print(printer, filename, gone.RandLower(8), &model.JobTicket{
-		Copies: &model.CopiesTicketItem{
-			Copies: 1,
-		},
-	})
+func (a *App) DefaultPrinter(c *cli.Context) error {
+	name, err := a.spool.GetDefaultPrinter()
 	if err != nil {
+		return errors.New(tr("没有默认打印机"))
+	}
+	fmt.Println(name)
+	return nil
+}
+
+func (a *App) SetDefaultPrinter(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	if err := a.spool.SetDefaultPrinter(a.printerArg(c, 0)); err != nil {
 		return err
 	}
-	fmt.Printf("{\"job_id\":%d}\n", jobID)
+	fmt.Printf(tr("默认打印机已设置为 %s\n"), args.Get(0))
 	return nil
 }
 
-func (a *App) StatusJob(c *cli.Context) error {
-	fmt.Println("查看打印机job状态")
+// AddPrinter adds a printer queue printing to a port with a driver, both
+// already installed.
+func (a *App) AddPrinter(c *cli.Context) error {
 	args := c.Args()
-	if args.Len() < 2 {
-		return errors.New("usage state <printerName> <jobID>")
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
 	}
-	printerName := args.Get(0)
-	printers, err := a.spool.GetPrinters()
-	if err != nil {
-		return errors.New("没有可用打印机")
+	printer := winspool.NewPrinter{
+		Name:           args.Get(0),
+		Port:           c.String("port"),
+		Driver:         c.String("driver"),
+		PrintProcessor: c.String("print-processor"),
+		Datatype:       c.String("datatype"),
+		Comment:        c.String("comment"),
+		Location:       c.String("location"),
+		ShareName:      c.String("share"),
 	}
-	var printer *lib.Printer
-	for _, p := range printers {
-		if p.Name == printerName {
-			printer = &p
-		}
+	if err := a.spool.AddPrinter(printer); err != nil {
+		return adminError(err)
 	}
-	if printer == nil {
-		return errors.New("打印机不存在")
+	fmt.Printf(tr("已添加打印机 %s\n"), printer.Name)
+	return nil
+}
+
+// DeletePrinter deletes a printer queue.
+func (a *App) DeletePrinter(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
 	}
-	jobIDStr := args.Get(1)
-	jobID, err := strconv.ParseUint(jobIDStr, 10, 32)
-	if err != nil {
-		return errors.New("jobID 错误")
+	printerName := a.printerArg(c, 0)
+	if err := a.spool.DeletePrinter(printerName); err != nil {
+		return adminError(err)
 	}
+	fmt.Printf(tr("已删除打印机 %s\n"), printerName)
+	return nil
+}
 
-	state, err := a.spool.GetJobState(printerName, uint32(jobID))
+// ConnectPrinter connects the current user to a shared printer.
+func (a *App) ConnectPrinter(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	printerName := a.printerArg(c, 0)
+	if err := a.spool.AddPrinterConnection(printerName); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("已连接打印机 %s\n"), printerName)
+	return nil
+}
+
+// DisconnectPrinter removes a connection of the current user to a shared
+// printer.
+func (a *App) DisconnectPrinter(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	printerName := a.printerArg(c, 0)
+	if err := a.spool.DeletePrinterConnection(printerName); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("已断开打印机 %s\n"), printerName)
+	return nil
+}
+
+// ListPorts lists the ports printers print to.
+func (a *App) ListPorts(c *cli.Context) error {
+	ports, err := a.spool.Ports()
 	if err != nil {
 		return err
 	}
+	if jsonOutput(c) {
+		return printJSON(newPortOutputs(ports))
+	}
+	t := tabby.New()
+	t.AddHeader(tr("名称"), tr("监视器"), tr("描述"))
+	for _, port := range ports {
+		t.AddLine(port.Name, port.Monitor, port.Description)
+	}
+	t.Print()
+	return nil
+}
+
+// AddPort adds a Standard TCP/IP port, printing RAW to port 9100 unless
+// --lpr-queue is given.
+func (a *App) AddPort(c *cli.Context) error {
+	if c.Bool("raw") && c.String("lpr-queue") != "" {
+		return errors.New(tr("--raw 和 --lpr-queue 只能选择一个"))
+	}
+	name, err := a.spool.AddTCPIPPort(winspool.TCPIPPort{
+		Name:          c.String("name"),
+		HostAddress:   c.String("ip"),
+		LPR:           c.String("lpr-queue") != "",
+		Queue:         c.String("lpr-queue"),
+		PortNumber:    uint32(c.Uint("port-number")),
+		SNMPCommunity: c.String("snmp-community"),
+	})
+	if err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("已添加端口 %s\n"), name)
+	return nil
+}
 
-	body, err := json.MarshalIndent(state, "", "   ")
+// ListForms lists the forms of the print server, the paper sizes its
+// printers print on.
+func (a *App) ListForms(c *cli.Context) error {
+	forms, err := a.spool.Forms()
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(body))
+	if c.Bool("user") {
+		var userForms []lib.Form
+		for _, form := range forms {
+			if form.Kind == lib.FormKindUser {
+				userForms = append(userForms, form)
+			}
+		}
+		forms = userForms
+	}
+	if jsonOutput(c) {
+		if forms == nil {
+			forms = []lib.Form{}
+		}
+		return printJSON(forms)
+	}
+	t := tabby.New()
+	t.AddHeader(tr("名称"), tr("类型"), tr("尺寸 (毫米)"))
+	for _, form := range forms {
+		t.AddLine(form.Name, form.Kind, fmt.Sprintf("%gx%g", float64(form.WidthMicrons)/1000, float64(form.HeightMicrons)/1000))
+	}
+	t.Print()
 	return nil
 }
 
-func (a *App) ListJob(c *cli.Context) error {
-	fmt.Println("查看打印机作业列表")
+// AddForm adds a user form, such as a label stock size.
+func (a *App) AddForm(c *cli.Context) error {
 	args := c.Args()
-	if args.Len() < 1 {
-		return errors.New("usage state <printerName>")
+	if args.Len() < 2 {
+		return errors.New(tr("请输入表单名称和尺寸, 例如 \"Label 62x29\" 62x29"))
 	}
-	printerName := args.Get(0)
-	list, err := a.spool.JobList(printerName)
+	width, height, err := lib.ParseFormSize(args.Get(1))
 	if err != nil {
 		return err
 	}
-	OutputJobList(list)
+	if err := a.spool.AddForm(args.Get(0), width, height); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("已添加表单 %s\n"), args.Get(0))
 	return nil
 }
 
-func (a *App) Version(c *cli.Context) error {
-	fmt.Printf("echo-service has version %s built from %s on %s\n", version, hash, datetime)
+// DeleteForm deletes a user form.
+func (a *App) DeleteForm(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入表单名称"))
+	}
+	if err := a.spool.DeleteForm(args.Get(0)); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("已删除表单 %s\n"), args.Get(0))
 	return nil
 }
 
-func NewApp() *cli.App {
-	spool, err := winspool.NewWinSpool()
+// DiscoverPrinters lists the printers visible on the network: the shared
+// printers the spooler browses, and with --mdns and --wsd, those answering
+// multicast scans. --connect adds a connection to each shared printer found.
+func (a *App) DiscoverPrinters(c *cli.Context) error {
+	printers, err := a.spool.DiscoverPrinters()
 	if err != nil {
-		panic(err)
+		log.Printf(tr("无法浏览网络打印机: %s"), err)
 	}
-	jobs := make(chan *lib.Job, 10)
-	app := &App{
-		spool: spool,
-		jobs:  jobs,
+	scans := []struct {
+		enabled bool
+		name    string
+		scan    func(time.Duration) ([]lib.DiscoveredPrinter, error)
+	}{
+		{c.Bool("mdns"), "mDNS", lib.BrowseMDNS},
+		{c.Bool("wsd"), "WS-Discovery", lib.ProbeWSD},
 	}
+	for _, s := range scans {
+		if !s.enabled {
+			continue
+		}
+		found, err := s.scan(c.Duration("timeout"))
+		if err != nil {
+			log.Printf(tr("%s 扫描失败: %s"), s.name, err)
+		}
+		printers = append(printers, found...)
+	}
+	lib.SortDiscoveredPrinters(printers)
 
-	return &cli.App{
-		Name:  "printpdf",
-		Usage: "打印机操作命令行程序",
-		Commands: []*cli.Command{
-			{
-				Name:   "version",
-				Action: app.Version,
-				Usage:  "查看版本号",
-			},
-			{
-				Name:  "printer",
-				Usage: "打印机操作",
-				Subcommands: []*cli.Command{
-					{
-						Name:   "ls",
-						Usage:  "获取打印机列表",
-						Action: app.ListPrinter,
-					},
-					{
-						Name:   "inspect",
-						Usage:  "获取打印机详情",
-						Action: app.InspectPrinter,
-					},
-				},
-			},
-			{
-				Name:  "job",
-				Usage: "作业",
-				Subcommands: []*cli.Command{
-					{
-						Flags: []cli.Flag{
-							&cli.StringFlag{
-								Name:    "filename",
-								Aliases: []string{"f"},
-								Usage:   "文件路径",
-							},
-							&cli.StringFlag{
-								Name:    "printer",
-								Aliases: []string{"p"},
-								Usage:   "打印机名称",
-							},
-						},
-						Name:   "add",
-						Usage:  "添加打印作业",
-						Action: app.AddJob,
-					},
-					{
+	if c.Bool("connect") {
+		for _, p := range printers {
+			if p.Source != lib.DiscoverySourceNetwork {
+				continue
+			}
+			if err := a.spool.AddPrinterConnection(p.Name); err != nil {
+				log.Printf(tr("连接打印机 %s 失败: %s"), p.Name, err)
+				continue
+			}
+			fmt.Fprintf(os.Stderr, tr("已连接打印机 %s\n"), p.Name)
+		}
+	}
 
-						Name:   "status",
-						Usage:  "打印作业状态",
-						Action: app.StatusJob,
-					},
-					{
+	if jsonOutput(c) {
+		if printers == nil {
+			printers = []lib.DiscoveredPrinter{}
+		}
+		return printJSON(printers)
+	}
+	OutputDiscoveredPrinters(printers)
+	return nil
+}
 
-						Name:   "ls",
-						Usage:  "打印机作业列表",
-						Action: app.ListJob,
-					},
-				},
-			},
-			// ===========================
-			{
-				Name:   "printers",
-				Usage:  "获取打印机列表",
-				Action: app.ListPrinter,
-			},
+// ControlPrinter pauses, resumes or purges the queue of a printer.
+func (a *App) ControlPrinter(control func(printerName string) error, done string) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		if c.Bool("all") || c.String("group") != "" {
+			return a.controlPrinters(c, control, done)
+		}
+		args := c.Args()
+		if args.Len() < 1 {
+			return errors.New(tr("请输入打印机名称, 或使用 --all 或 --group"))
+		}
+		if err := control(a.printerArg(c, 0)); err != nil {
+			return adminError(err)
+		}
+		fmt.Printf(tr("打印机 %s %s\n"), args.Get(0), done)
+		return nil
+	}
+}
+
+// bulkFlags select the printers of bulk operations.
+func bulkFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: tr("所有打印机"),
 		},
-		After: func(context *cli.Context) error {
-			//printerManager.Quit()
-			return nil
+		&cli.StringFlag{
+			Name:  "group",
+			Usage: tr("配置文件 printer_groups 中的打印机组"),
+		},
+		&cli.IntFlag{
+			Name:  "parallel",
+			Usage: tr("同时操作的打印机数"),
+			Value: lib.DefaultBulkWorkers,
 		},
 	}
 }
 
-// Blocks until Ctrl-C or SIGTERM.
-func waitIndefinitely() {
-	ch := make(chan os.Signal)
-	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
-	<-ch
+// controlPrinters runs control on all printers, or those of the group
+// given with --group, several at once, and reports how it went for each.
+func (a *App) controlPrinters(c *cli.Context, control func(printerName string) error, done string) error {
+	if c.Bool("all") && c.String("group") != "" {
+		return errors.New(tr("--all 和 --group 不能同时使用"))
+	}
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(printers))
+	for i, printer := range printers {
+		names[i] = printer.Name
+	}
+	if group := c.String("group"); group != "" {
+		if names, err = a.config.PrinterGroup(group, names); err != nil {
+			return err
+		}
+	}
 
-	go func() {
-		// In case the process doesn't die quickly, wait for a second termination request.
-		<-ch
-		fmt.Println("Second termination request received")
-		os.Exit(1)
-	}()
+	results := lib.RunBulk(names, c.Int("parallel"), func(printerName string) error {
+		return adminError(control(printerName))
+	})
+	var failed int
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if jsonOutput(c) {
+		if err = printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		t := tabby.New()
+		t.AddHeader(tr("打印机"), tr("结果"), tr("耗时"))
+		for _, result := range results {
+			outcome := done
+			if result.Error != "" {
+				outcome = tr("失败: ") + result.Error
+			}
+			t.AddLine(result.Printer, outcome, result.Duration.Round(time.Millisecond))
+		}
+		t.Print()
+	}
+	if failed > 0 {
+		return fmt.Errorf(tr("%d 台打印机中 %d 台失败"), len(results), failed)
+	}
+	return nil
 }
 
-func main() {
-	err := NewApp().Run(os.Args)
+// DumpDevMode exports the default DEVMODE of a printer as JSON, to apply to
+// the queues of other machines with ApplyDevMode.
+func (a *App) DumpDevMode(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	export, err := a.spool.ExportDevMode(a.printerArg(c, 0))
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	body, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
 	}
+	if file := c.String("file"); file != "" {
+		return ioutil.WriteFile(file, body, 0644)
+	}
+	fmt.Println(string(body))
+	return nil
 }
 
-func OutputPrintList(printers []lib.Printer) {
-	t := tabby.New()
-	t.AddHeader("名称", "名称2", "驱动", "状态")
-	for _, printer := range printers {
-		t.AddLine(printer.Name, printer.DefaultDisplayName, printer.Model, printer.State.State)
+// CaptureDevMode keeps the printing preferences of the current user as a
+// named DEVMODE preset of the printer, such as one with stapling on, which
+// job add --devmode-preset prints with.
+func (a *App) CaptureDevMode(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New(tr("请输入打印机名称和预设名称"))
+	}
+	if a.spool.DevModePresets == nil {
+		return errors.New(tr("请在配置文件中设置 devmode_presets_dir"))
+	}
+	export, err := a.spool.CaptureDevMode(a.printerArg(c, 0))
+	if err != nil {
+		return err
+	}
+	if err = a.spool.DevModePresets.Save(args.Get(1), export); err != nil {
+		return err
+	}
+	fmt.Printf(tr("已保存打印机 %s 的DEVMODE预设 %s\n"), args.Get(0), args.Get(1))
+	return nil
+}
+
+// ListDevModePresets lists the DEVMODE presets captured for a printer.
+func (a *App) ListDevModePresets(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	if a.spool.DevModePresets == nil {
+		return errors.New(tr("请在配置文件中设置 devmode_presets_dir"))
+	}
+	names, err := a.spool.DevModePresets.Names(a.printerArg(c, 0))
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		if names == nil {
+			names = []string{}
+		}
+		return printJSON(names)
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// DeleteDevModePreset removes a DEVMODE preset of a printer.
+func (a *App) DeleteDevModePreset(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New(tr("请输入打印机名称和预设名称"))
+	}
+	if a.spool.DevModePresets == nil {
+		return errors.New(tr("请在配置文件中设置 devmode_presets_dir"))
+	}
+	return a.spool.DevModePresets.Delete(a.printerArg(c, 0), args.Get(1))
+}
+
+// ApplyDevMode makes a DEVMODE exported by DumpDevMode the default of a
+// printer, without opening the driver dialogs.
+func (a *App) ApplyDevMode(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New(tr("请输入打印机名称和DEVMODE文件"))
+	}
+	export, err := readDevModeExport(args.Get(1))
+	if err != nil {
+		return err
+	}
+	if err = a.spool.ImportDevMode(a.printerArg(c, 0), export); err != nil {
+		return devModeError(err)
+	}
+	fmt.Printf(tr("打印机 %s 的默认设置已更新\n"), args.Get(0))
+	return nil
+}
+
+// readDevModeExport reads a DEVMODE written by printer devmode dump.
+func readDevModeExport(fileName string) (*lib.DevModeExport, error) {
+	body, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	var export lib.DevModeExport
+	if err = json.Unmarshal(body, &export); err != nil {
+		return nil, fmt.Errorf(tr("DEVMODE文件 %s 无效: %s"), fileName, err)
+	}
+	return &export, nil
+}
+
+// devModeError explains errors of DEVMODEs applied to another driver.
+func devModeError(err error) error {
+	if errors.Is(err, lib.ErrDriverMismatch) {
+		return fmt.Errorf(tr("%s: 请使用同一驱动程序及版本的打印机导出的DEVMODE"), err)
+	}
+	return adminError(err)
+}
+
+// GetPrinterConfig shows the properties printer set sets.
+func (a *App) GetPrinterConfig(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	config, err := a.spool.GetPrinterConfig(a.printerArg(c, 0))
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		return printJSON(printerConfigOutput(config))
+	}
+	t := tabby.New()
+	t.AddLine(tr("地点"), config.Location)
+	t.AddLine(tr("备注"), config.Comment)
+	t.AddLine(tr("共享名"), config.ShareName)
+	t.AddLine(tr("分隔页"), config.SeparatorFile)
+	t.Print()
+	return nil
+}
+
+// SetPrinterConfig changes the properties of a printer given with flags,
+// such as asset data pushed from automation.
+func (a *App) SetPrinterConfig(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	var update winspool.PrinterConfigUpdate
+	flags := []struct {
+		name  string
+		value **string
+	}{
+		{"location", &update.Location},
+		{"comment", &update.Comment},
+		{"share", &update.ShareName},
+		{"separator-file", &update.SeparatorFile},
+	}
+	for _, f := range flags {
+		if c.IsSet(f.name) {
+			value := c.String(f.name)
+			*f.value = &value
+		}
+	}
+	if c.IsSet("devmode") {
+		export, err := readDevModeExport(c.String("devmode"))
+		if err != nil {
+			return err
+		}
+		update.DevMode = export
+	}
+	if update == (winspool.PrinterConfigUpdate{}) {
+		return errors.New(tr("请指定要修改的属性, 例如 --location"))
+	}
+	if err := a.spool.SetPrinterInfo(a.printerArg(c, 0), update); err != nil {
+		return devModeError(err)
+	}
+	fmt.Printf(tr("打印机 %s 已更新\n"), c.Args().Get(0))
+	return nil
+}
+
+// DiffPrinters compares the capabilities of two printers, to pick a
+// replacement or find why a ticket only works on one of them.
+func (a *App) DiffPrinters(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New(tr("请输入两台打印机名称"))
+	}
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return errors.New(tr("没有可用打印机"))
+	}
+	var descriptions [2]*model.PrinterDescriptionSection
+	for i, name := range []string{a.printerArg(c, 0), a.printerArg(c, 1)} {
+		found := false
+		for _, p := range printers {
+			if p.Name == name {
+				descriptions[i], found = p.Description, true
+			}
+		}
+		if !found {
+			return fmt.Errorf(tr("打印机 %s 不存在"), name)
+		}
+	}
+
+	diffs := lib.DiffDescriptions(descriptions[0], descriptions[1])
+	if jsonOutput(c) {
+		if diffs == nil {
+			diffs = []lib.CapabilityDiff{}
+		}
+		return printJSON(diffs)
+	}
+	if len(diffs) == 0 {
+		fmt.Println(tr("两台打印机的能力相同"))
+		return nil
+	}
+	t := tabby.New()
+	t.AddHeader(tr("能力"), tr("仅 ")+args.Get(0), tr("仅 ")+args.Get(1), tr("默认 ")+args.Get(0), tr("默认 ")+args.Get(1))
+	for _, diff := range diffs {
+		t.AddLine(diff.Capability, strings.Join(diff.OnlyA, ", "), strings.Join(diff.OnlyB, ", "), diff.DefaultA, diff.DefaultB)
+	}
+	t.Print()
+	return nil
+}
+
+func (a *App) InspectPrinter(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	printerName := a.printerArg(c, 0)
+	a.spool.SNMPCommunity = c.String("snmp-community")
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return errors.New(tr("没有可用打印机"))
+	}
+	printer := findPrinter(printers, printerName)
+	if printer == nil {
+		return errors.New(tr("打印机不存在"))
+	}
+	body, err := json.MarshalIndent(*printer, "", "   ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+// PrinterCapabilities prints the full description of a printer, as CDD
+// JSON: what printer inspect shows, with what the driver and winspool
+// support besides.
+func (a *App) PrinterCapabilities(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	description, err := a.spool.GetPrinterCapabilities(a.printerArg(c, 0))
+	if err != nil {
+		return err
+	}
+	return printJSON(description)
+}
+
+// PrintTestPage prints a test page on a printer, to check its alignment
+// and colors once deployed.
+func (a *App) PrintTestPage(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return errors.New(tr("请输入打印机名称"))
+	}
+	printerName := a.printerArg(c, 0)
+	printer, err := a.spool.GetPrinter(printerName)
+	if err != nil {
+		return fmt.Errorf(tr("打印机 %s 不存在: %s"), printerName, err)
+	}
+	result, err := a.spool.PrintTestPage(printer)
+	if err != nil {
+		return printError(err)
+	}
+	return printJobResults([]string{printerName}, []*lib.PrintResult{result})
+}
+
+func (a *App) AddJob(c *cli.Context) error {
+	filenames, err := expandJobFiles(c.StringSlice("filename"))
+	if err != nil {
+		return err
+	}
+	if name := c.String("template"); name != "" {
+		if len(filenames) > 0 {
+			return errors.New(tr("--filename 和 --template 只能指定一个"))
+		}
+		layout, err := a.writeTemplate(name, c.String("data"))
+		if err != nil {
+			return err
+		}
+		defer os.Remove(layout)
+		filenames = []string{layout}
+	}
+	if len(filenames) == 0 {
+		return errors.New(tr("文件名不能为空"))
+	}
+	printerName, err := a.jobPrinter(c)
+	if err != nil {
+		return err
+	}
+	stdin := 0
+	for _, filename := range filenames {
+		if filename == stdinFileName {
+			stdin++
+		} else if !lib.IsURL(filename) && !gone.FileExist(filename) {
+			return fmt.Errorf(tr("文件 %s 不存在"), filename)
+		}
+	}
+	if stdin > 1 {
+		return errors.New(tr("标准输入只能读取一次"))
+	}
+	var proofFormat lib.ProofFormat
+	if c.String("proof") != "" {
+		if c.Bool("raw") {
+			return errors.New(tr("--raw 作业不经渲染, 不能与 --proof 一起使用"))
+		}
+		if proofFormat, err = lib.ProofFormatFromPath(c.String("proof")); err != nil {
+			return err
+		}
+	}
+	if c.String("output-file") != "" && (c.Bool("raw") || proofFormat != "") {
+		return errors.New(tr("--output-file 不能与 --raw 或 --proof 一起使用"))
+	}
+	merge := c.Bool("merge") && len(filenames) > 1
+	if len(filenames) > 1 && !merge && (proofFormat != "" || c.String("output-file") != "") {
+		return errors.New(tr("多个文件只能与 --merge 一起使用 --proof 或 --output-file"))
+	}
+	if c.Bool("raw") {
+		if c.String("at") != "" || c.String("after") != "" || c.Bool("hold") || c.String("pin") != "" || c.String("devmode") != "" || c.String("devmode-preset") != "" {
+			return errors.New(tr("--raw 作业没有作业票据, 不能与 --at, --after, --hold, --pin, --devmode 或 --devmode-preset 一起使用"))
+		}
+		return a.addRawJob(c, printerName, filenames, merge)
+	}
+	for i, filename := range filenames {
+		if filename != stdinFileName {
+			continue
+		}
+		if filenames[i], err = saveStdin(); err != nil {
+			return err
+		}
+		defer os.Remove(filenames[i])
+	}
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return errors.New(tr("没有可用打印机"))
+	}
+	printer := findPrinter(printers, printerName)
+	if printer == nil {
+		return errors.New(tr("打印机不存在"))
+	}
+	var nativeJobQueueSize uint = 2
+	printer.NativeJobSemaphore = lib.NewSemaphore(nativeJobQueueSize)
+
+	ticket, err := jobTicket(c)
+	if err != nil {
+		return err
+	}
+	if merge {
+		merged, cleanup, err := a.spool.MergeDocuments(filenames, ticket)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		filenames = []string{merged}
+	}
+
+	results := make([]*lib.PrintResult, 0, len(filenames))
+	for _, filename := range filenames {
+		result, err := a.printFile(c, printer, filename, ticket, proofFormat)
+		if err != nil {
+			if len(filenames) == 1 {
+				return err
+			}
+			// The jobs already submitted are reported, so they can be
+			// followed or deleted.
+			printJobResults(filenames, results)
+			return fmt.Errorf("%s: %w", filename, err)
+		}
+		results = append(results, result)
+	}
+	return printJobResults(filenames, results)
+}
+
+// expandJobFiles expands the patterns among the --filename values of job
+// add, such as *.pdf, in name order, since the Windows shell doesn't.
+func expandJobFiles(values []string) ([]string, error) {
+	var filenames []string
+	for _, value := range values {
+		if value == stdinFileName || lib.IsURL(value) || !strings.ContainsAny(value, "*?[") {
+			filenames = append(filenames, value)
+			continue
+		}
+		matches, err := filepath.Glob(value)
+		if err != nil {
+			return nil, fmt.Errorf(tr("无效的文件名模式 %s: %s"), value, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf(tr("没有匹配 %s 的文件"), value)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames, nil
+}
+
+// printFile prints a file of job add, or writes its proof or output file.
+func (a *App) printFile(c *cli.Context, printer *lib.Printer, filename string, ticket *model.JobTicket, proofFormat lib.ProofFormat) (*lib.PrintResult, error) {
+	if proofFormat != "" {
+		return a.spool.Proof(printer, filename, ticket, proofFormat, c.String("proof"))
+	}
+	if outputFile := c.String("output-file"); outputFile != "" {
+		result, err := a.spool.PrintToFile(printer, filename, gone.RandLower(8), ticket, outputFile)
+		return result, printError(err)
+	}
+	var progress lib.ProgressFunc
+	if c.Bool("progress") {
+		progress = printProgress
+	}
+	result, err := a.spool.PrintWithProgress(printer, filename, gone.RandLower(8), ticket, progress)
+	if progress != nil {
+		fmt.Fprintln(os.Stderr)
+	}
+	return result, printError(err)
+}
+
+// fileJobResult is the result of a file of a job add with several files.
+type fileJobResult struct {
+	File string `json:"file"`
+	*lib.PrintResult
+}
+
+// printJobResults prints the result of a single job as is, and those of
+// several files with all their job IDs.
+func printJobResults(filenames []string, results []*lib.PrintResult) error {
+	var v interface{}
+	if len(filenames) == 1 && len(results) == 1 {
+		v = results[0]
+	} else {
+		output := struct {
+			JobIDs []uint32        `json:"job_ids"`
+			Jobs   []fileJobResult `json:"jobs"`
+		}{JobIDs: []uint32{}, Jobs: []fileJobResult{}}
+		for i, result := range results {
+			output.JobIDs = append(output.JobIDs, result.JobID)
+			output.Jobs = append(output.Jobs, fileJobResult{File: filenames[i], PrintResult: result})
+		}
+		v = output
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+// jobTicket loads the ticket of --ticket, with the options of the other
+// flags of job add and job simulate applied.
+func jobTicket(c *cli.Context) (*model.JobTicket, error) {
+	ticket, err := loadTicket(c)
+	if err != nil {
+		return nil, err
+	}
+	if pages := c.String("pages"); pages != "" {
+		if ticket.PageRange, err = model.ParsePageRange(pages); err != nil {
+			return nil, err
+		}
+	}
+	if tray := c.String("tray"); tray != "" {
+		ticket.MediaSource = parseTray(tray)
+	}
+	if margins := c.String("margins"); margins != "" {
+		if ticket.Margins, err = model.ParseMargins(margins); err != nil {
+			return nil, err
+		}
+	}
+	if c.IsSet("scale") {
+		ticket.Scale = &model.ScaleTicketItem{Percent: int32(c.Int("scale"))}
+		if err = (&model.JobTicket{Scale: ticket.Scale}).Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if nup := c.String("nup"); nup != "" {
+		if ticket.NUp, err = model.ParseNUp(nup); err != nil {
+			return nil, err
+		}
+	}
+	if c.Bool("booklet") {
+		ticket.Booklet = &model.BookletTicketItem{Booklet: true}
+	}
+	if at, after := c.String("at"), c.String("after"); at != "" || after != "" {
+		if at != "" && after != "" {
+			return nil, errors.New(tr("--at 和 --after 只能指定一个"))
+		}
+		until, err := parseHoldUntil(at, after, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		ticket.HoldUntil = &model.HoldUntilTicketItem{Time: until}
+	}
+	if c.Bool("hold") || c.String("pin") != "" {
+		ticket.Hold = &model.HoldTicketItem{PIN: c.String("pin")}
+		if err = (&model.JobTicket{Hold: ticket.Hold}).Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if file, preset := c.String("devmode"), c.String("devmode-preset"); file != "" || preset != "" {
+		if file != "" && preset != "" {
+			return nil, errors.New(tr("--devmode 和 --devmode-preset 只能指定一个"))
+		}
+		item := model.VendorTicketItem{ID: lib.DevModePresetID, Value: preset}
+		if file != "" {
+			body, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			var export lib.DevModeExport
+			if err = json.Unmarshal(body, &export); err != nil {
+				return nil, fmt.Errorf(tr("DEVMODE文件 %s 无效: %s"), file, err)
+			}
+			item = model.VendorTicketItem{ID: lib.DevModeID, Value: base64.StdEncoding.EncodeToString(export.DevMode)}
+		}
+		// Replaces the DEVMODE of the ticket file, if any.
+		var items []model.VendorTicketItem
+		for _, other := range ticket.VendorTicketItem {
+			if other.ID != lib.DevModeID && other.ID != lib.DevModePresetID {
+				items = append(items, other)
+			}
+		}
+		ticket.VendorTicketItem = append(items, item)
+	}
+	return ticket, nil
+}
+
+// parseHoldUntil returns the time of --at, such as "22:00", the next time
+// of day, "2006-01-02 22:00" or RFC 3339, or of --after, a duration such
+// as "90m".
+func parseHoldUntil(at, after string, now time.Time) (time.Time, error) {
+	if after != "" {
+		d, err := time.ParseDuration(after)
+		if err != nil || d < 0 {
+			return time.Time{}, fmt.Errorf(tr("--after %q 不是有效的时长, 例如 30m 或 8h"), after)
+		}
+		return now.Add(d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, at); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04", at, now.Location()); err == nil {
+		return t, nil
+	}
+	clock, err := time.Parse("15:04", at)
+	if err != nil {
+		return time.Time{}, fmt.Errorf(tr("--at %q 不是有效的时间, 例如 22:00, 2006-01-02 22:00 或 RFC 3339 时间"), at)
+	}
+	t := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !t.After(now) {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// SimulateJob shows what job add would print, and what it would cost,
+// without printing.
+func (a *App) SimulateJob(c *cli.Context) error {
+	filename := c.String("filename")
+	if filename == "" {
+		return errors.New(tr("文件名不能为空"))
+	}
+	printerName, err := a.jobPrinter(c)
+	if err != nil {
+		return err
+	}
+	if !lib.IsURL(filename) && !gone.FileExist(filename) {
+		return fmt.Errorf(tr("文件 %s 不存在"), filename)
+	}
+	printer, err := a.spool.GetPrinter(printerName)
+	if err != nil {
+		return fmt.Errorf(tr("打印机 %s 不存在: %s"), printerName, err)
+	}
+	ticket, err := jobTicket(c)
+	if err != nil {
+		return err
+	}
+	plan, err := a.spool.Simulate(printer, filename, ticket)
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		return printJSON(plan)
+	}
+
+	pages := strconv.Itoa(plan.Pages)
+	if plan.DocumentPages == 0 {
+		pages = tr("打印时才能确定")
+	}
+	t := tabby.New()
+	t.AddHeader(tr("项目"), tr("值"))
+	t.AddLine(tr("打印机"), plan.Printer)
+	t.AddLine(tr("文档类型"), plan.ContentType)
+	t.AddLine(tr("文档页数"), plan.DocumentPages)
+	t.AddLine(tr("打印页数"), pages)
+	t.AddLine(tr("份数"), plan.Copies)
+	t.AddLine(tr("打印面数"), plan.Sides)
+	t.AddLine(tr("纸张数"), plan.Sheets)
+	t.AddLine(tr("纸张"), plan.Paper)
+	t.AddLine(tr("彩色"), plan.Color)
+	t.AddLine(tr("双面"), plan.Duplex)
+	t.AddLine(tr("每面页数"), plan.NUp)
+	if plan.Cost != nil {
+		t.AddLine(tr("费用"), strings.TrimSpace(fmt.Sprintf("%.2f %s", plan.Cost.Amount, plan.Cost.Currency)))
+	}
+	for _, warning := range plan.Warnings {
+		t.AddLine(tr("警告"), fmt.Sprintf("%s: %s", warning.Option, warning.Message))
+	}
+	t.Print()
+	return nil
+}
+
+// PreflightJob checks a document before it is printed, and reports its
+// pages as they would print.
+func (a *App) PreflightJob(c *cli.Context) error {
+	filename := c.String("filename")
+	if filename == "" {
+		return errors.New(tr("文件名不能为空"))
+	}
+	printerName, err := a.jobPrinter(c)
+	if err != nil {
+		return err
+	}
+	if !lib.IsURL(filename) && !gone.FileExist(filename) {
+		return fmt.Errorf(tr("文件 %s 不存在"), filename)
+	}
+	printer, err := a.spool.GetPrinter(printerName)
+	if err != nil {
+		return fmt.Errorf(tr("打印机 %s 不存在: %s"), printerName, err)
+	}
+	ticket, err := jobTicket(c)
+	if err != nil {
+		return err
+	}
+	report, err := a.spool.Preflight(printer, filename, ticket)
+	if err != nil {
+		var preflightErr *lib.PreflightError
+		if jsonOutput(c) && errors.As(err, &preflightErr) {
+			printJSON(struct {
+				Error *lib.PreflightError `json:"error"`
+			}{preflightErr})
+		}
+		return err
+	}
+	if jsonOutput(c) {
+		return printJSON(report)
+	}
+
+	t := tabby.New()
+	t.AddHeader(tr("项目"), tr("值"))
+	t.AddLine(tr("打印机"), report.Printer)
+	t.AddLine(tr("文档类型"), report.ContentType)
+	t.AddLine(tr("加密"), report.Encrypted)
+	t.AddLine(tr("文档页数"), report.Pages)
+	for _, size := range report.PageSizes {
+		t.AddLine(tr("页面尺寸"), fmt.Sprintf(tr("%.1f x %.1f 毫米, %d 页, 自第 %d 页, 按 %g%% 打印"),
+			float64(size.WidthMicrons)/1000, float64(size.HeightMicrons)/1000, size.Pages, size.FirstPage, size.ScalePercent))
+	}
+	t.AddLine(tr("缩放"), report.Scaling)
+	t.AddLine(tr("纸张"), report.Plan.Paper)
+	t.AddLine(tr("纸张数"), report.Plan.Sheets)
+	for _, warning := range report.Plan.Warnings {
+		t.AddLine(tr("警告"), fmt.Sprintf("%s: %s", warning.Option, warning.Message))
+	}
+	t.Print()
+	return nil
+}
+
+// writeTemplate fills in a template of the config with a JSON data file,
+// and writes the layout to a temporary file.
+func (a *App) writeTemplate(name, dataFile string) (string, error) {
+	fileName, ok := a.config.Templates[name]
+	if !ok {
+		return "", fmt.Errorf(tr("配置文件中没有模板 %s"), name)
+	}
+	templates, err := lib.LoadDocumentTemplates(map[string]string{name: fileName})
+	if err != nil {
+		return "", err
+	}
+	var data interface{}
+	if dataFile != "" {
+		b, err := ioutil.ReadFile(dataFile)
+		if err != nil {
+			return "", err
+		}
+		if err = json.Unmarshal(b, &data); err != nil {
+			return "", fmt.Errorf(tr("数据文件 %s 无效: %s"), dataFile, err)
+		}
+	}
+	document, err := templates[name].Execute(data)
+	if err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile("", "winspool-*.layout")
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Write(document); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// printProgress shows the progress of a job on one line of stderr, keeping
+// stdout for the result.
+func printProgress(p lib.PrintProgress) {
+	total := "?"
+	if p.TotalPages > 0 {
+		total = strconv.Itoa(p.TotalPages)
+	}
+	fmt.Fprintf(os.Stderr, tr("\r作业 %d: 已渲染 %d/%s 页, 已缓冲 %d KB"), p.JobID, p.PagesRendered, total, p.BytesSpooled/1024)
+}
+
+// stdinFileName is the --filename of documents read from stdin.
+const stdinFileName = "-"
+
+// saveStdin copies stdin to a temporary file, since documents are detected
+// and rendered from files, and returns its name.
+func saveStdin() (string, error) {
+	f, err := ioutil.TempFile("", "winspool-stdin-*")
+	if err != nil {
+		return "", err
+	}
+	n, err := io.Copy(f, os.Stdin)
+	if err == nil && n == 0 {
+		err = errors.New(tr("标准输入为空"))
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// addRawJob sends the files to the printer as-is, without rendering: a job
+// each, or one job with merge. Stdin is streamed to the job as it is read.
+func (a *App) addRawJob(c *cli.Context, printerName string, filenames []string, merge bool) error {
+	readers := make([]io.Reader, 0, len(filenames))
+	docNames := make([]string, 0, len(filenames))
+	for _, filename := range filenames {
+		if lib.IsURL(filename) {
+			return errors.New(tr("--raw 不支持网页地址"))
+		}
+		if filename == stdinFileName {
+			readers, docNames = append(readers, os.Stdin), append(docNames, "stdin")
+			continue
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers, docNames = append(readers, f), append(docNames, filepath.Base(filename))
+	}
+	if merge {
+		readers, docNames = []io.Reader{io.MultiReader(readers...)}, docNames[:1]
+		filenames = filenames[:1]
+	}
+
+	results := make([]*lib.PrintResult, 0, len(readers))
+	for i, r := range readers {
+		result, err := a.spool.PrintRaw(printerName, r, docNames[i], c.String("datatype"))
+		if err != nil {
+			if len(readers) == 1 {
+				return err
+			}
+			printJobResults(filenames, results)
+			return fmt.Errorf("%s: %w", filenames[i], err)
+		}
+		results = append(results, result)
+	}
+	return printJobResults(filenames, results)
+}
+
+// AddFormJob prints a form on an ESC/P printer, with the values of its
+// fields read from a JSON object.
+func (a *App) AddFormJob(c *cli.Context) error {
+	printerName, err := a.jobPrinter(c)
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(c.String("data"))
+	if err != nil {
+		return err
+	}
+	var values map[string]string
+	if err = json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf(tr("字段值文件 %s 无效: %s"), c.String("data"), err)
+	}
+	result, err := a.spool.PrintForm(printerName, filepath.Base(c.String("data")), values)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func (a *App) AddBatchJob(c *cli.Context) error {
+	printerName, err := a.jobPrinter(c)
+	if err != nil {
+		return err
+	}
+	filenames := c.Args().Slice()
+	if len(filenames) == 0 {
+		return errors.New(tr("文件名不能为空"))
+	}
+	for _, filename := range filenames {
+		if !lib.IsURL(filename) && !gone.FileExist(filename) {
+			return fmt.Errorf(tr("文件 %s 不存在"), filename)
+		}
+	}
+	if c.Bool("exclusive") {
+		if err := a.requirePrinterAdmin(tr("--exclusive 暂停打印队列"), printerName); err != nil {
+			return err
+		}
+	}
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return errors.New(tr("没有可用打印机"))
+	}
+	printer := findPrinter(printers, printerName)
+	if printer == nil {
+		return errors.New(tr("打印机不存在"))
+	}
+	var nativeJobQueueSize uint = 2
+	printer.NativeJobSemaphore = lib.NewSemaphore(nativeJobQueueSize)
+	ticket, err := loadTicket(c)
+	if err != nil {
+		return err
+	}
+	docs := make([]winspool.BatchDocument, 0, len(filenames))
+	for _, filename := range filenames {
+		docs = append(docs, winspool.BatchDocument{
+			FileName: filename,
+			Title:    gone.RandLower(8),
+			Ticket:   ticket,
+		})
+	}
+	jobIDs, err := a.spool.PrintBatch(printer, docs, winspool.BatchOptions{
+		Exclusive: c.Bool("exclusive"),
+		Timeout:   c.Duration("timeout"),
+	})
+	if len(jobIDs) > 0 {
+		body, _ := json.Marshal(map[string][]uint32{"job_ids": jobIDs})
+		fmt.Println(string(body))
+	}
+	return adminError(err)
+}
+
+// adminOnly makes a service command fail before running without
+// administrator rights: only elevated administrators control the local
+// service manager.
+func adminOnly(command string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if !winspool.IsElevated() {
+			return fmt.Errorf(tr("%s需要管理员权限, 请以管理员身份运行"), command+" ")
+		}
+		return nil
+	}
+}
+
+// printerAdminOnly makes a command on the printer of its first argument
+// fail before running when the user may not administer that queue. Bulk
+// operations report it for each printer instead.
+func (a *App) printerAdminOnly(command string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if c.Bool("all") || c.String("group") != "" || c.Args().Len() < 1 {
+			return nil
+		}
+		return a.requirePrinterAdmin(command+" ", a.printerArg(c, 0))
+	}
+}
+
+// serverAdminOnly makes a command fail before running when the user may not
+// administer the print server, --server or the local one.
+func (a *App) serverAdminOnly(command string) cli.BeforeFunc {
+	return func(c *cli.Context) error {
+		if err := a.spool.CheckServerAdmin(); errors.Is(err, lib.ErrAdminRequired) {
+			return fmt.Errorf(tr("%s需要打印服务器的管理权限"), command+" ")
+		} else if err != nil {
+			return adminError(err)
+		}
+		return nil
+	}
+}
+
+// requirePrinterAdmin fails early, before anything is submitted, when the
+// user may not administer the printer as operation needs. The ACL of the
+// queue decides, on --server too, so delegated printer administrators
+// don't need an elevated prompt.
+func (a *App) requirePrinterAdmin(operation, printerName string) error {
+	if err := a.spool.CheckPrinterAdmin(printerName); errors.Is(err, lib.ErrAdminRequired) {
+		return fmt.Errorf(tr("%s需要打印机 %s 的管理权限"), operation, printerName)
+	} else if err != nil {
+		return adminError(err)
+	}
+	return nil
+}
+
+// adminError explains errors of operations the spooler denied for lack of
+// administrator rights, or failed while the spooler service is down.
+func adminError(err error) error {
+	if errors.Is(err, lib.ErrAdminRequired) {
+		return fmt.Errorf(tr("%s: 需要管理员权限, 请以管理员身份运行"), err)
+	}
+	if errors.Is(err, lib.ErrSpoolerUnavailable) {
+		return fmt.Errorf(tr("%s: 后台打印服务未运行或没有响应, 请检查 Print Spooler 服务"), err)
+	}
+	return err
+}
+
+// printError explains errors of jobs refused for exceeding a quota, or as
+// duplicates.
+func printError(err error) error {
+	if errors.Is(err, lib.ErrQuotaExceeded) {
+		return fmt.Errorf(tr("%s: 超出打印配额, 请联系管理员"), err)
+	}
+	if errors.Is(err, lib.ErrDuplicateJob) {
+		return fmt.Errorf(tr("%s: 刚刚已提交相同的作业, 未重复打印"), err)
+	}
+	return err
+}
+
+// findPrinter returns the printer of a name, nil when there is none.
+func findPrinter(printers []lib.Printer, name string) *lib.Printer {
+	for i := range printers {
+		if printers[i].Name == name {
+			return &printers[i]
+		}
+	}
+	return nil
+}
+
+// printerArg returns the printer name of argument i, as on --server.
+func (a *App) printerArg(c *cli.Context, i int) string {
+	return a.spool.PrinterPath(c.Args().Get(i))
+}
+
+// jobPrinter returns the printer given with --printer, or the default
+// printer of the user.
+func (a *App) jobPrinter(c *cli.Context) (string, error) {
+	if printerName := c.String("printer"); printerName != "" {
+		return a.spool.PrinterPath(printerName), nil
+	}
+	printerName, err := a.spool.GetDefaultPrinter()
+	if err != nil {
+		return "", errors.New(tr("打印机不能为空, 且没有默认打印机"))
+	}
+	return printerName, nil
+}
+
+// parseTray selects a tray by vendor ID (DMBIN value) when tray is a number,
+// and by media source type otherwise, e.g. "upper" or "MANUAL".
+func parseTray(tray string) *model.MediaSourceTicketItem {
+	if _, err := strconv.Atoi(tray); err == nil {
+		return &model.MediaSourceTicketItem{VendorID: tray}
+	}
+	return &model.MediaSourceTicketItem{Type: model.MediaSourceType(strings.ToUpper(tray))}
+}
+
+// loadTicket reads the job ticket given with --ticket, or returns a default
+// single copy ticket.
+func loadTicket(c *cli.Context) (*model.JobTicket, error) {
+	filename := c.String("ticket")
+	if filename == "" {
+		return &model.JobTicket{
+			Copies: &model.CopiesTicketItem{
+				Copies: 1,
+			},
+		}, nil
+	}
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return model.ParseJobTicket(body, model.ParseJobTicketOptions{Strict: c.Bool("strict")})
+}
+
+func (a *App) ValidateTicket(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New(tr("请输入作业票据文件"))
+	}
+	body, err := ioutil.ReadFile(args.Get(0))
+	if err != nil {
+		return err
+	}
+	if _, err = model.ParseJobTicket(body, model.ParseJobTicketOptions{Strict: true}); err != nil {
+		return err
+	}
+	fmt.Println(tr("作业票据有效"))
+	return nil
+}
+
+func (a *App) TicketSchema(c *cli.Context) error {
+	fmt.Println(string(model.JobTicketSchema))
+	return nil
+}
+
+func (a *App) StatusJob(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New("usage state <printerName> <jobID>")
+	}
+	printerName := a.printerArg(c, 0)
+	printers, err := a.spool.GetPrinters()
+	if err != nil {
+		return errors.New(tr("没有可用打印机"))
+	}
+	printer := findPrinter(printers, printerName)
+	if printer == nil {
+		return errors.New(tr("打印机不存在"))
+	}
+	jobIDStr := args.Get(1)
+	jobID, err := strconv.ParseUint(jobIDStr, 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+
+	state, err := a.spool.GetJobState(printerName, uint32(jobID))
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		return printJSON(state)
+	}
+
+	t := tabby.New()
+	t.AddHeader(tr("作业ID"), tr("状态"), tr("已打印页数"), tr("总页数"), tr("已缓冲字节"))
+	var stateType model.JobStateType
+	if state.State != nil {
+		stateType = state.State.Type
+	}
+	t.AddLine(jobID, stateType, optionalInt(state.PagesPrinted), optionalInt(state.TotalPages), optionalInt(state.SpooledBytes))
+	t.Print()
+	return nil
+}
+
+// optionalInt formats a value of a job state, "-" when unknown.
+func optionalInt(v interface{}) string {
+	switch v := v.(type) {
+	case *int32:
+		if v != nil {
+			return strconv.Itoa(int(*v))
+		}
+	case *int64:
+		if v != nil {
+			return strconv.FormatInt(*v, 10)
+		}
+	}
+	return "-"
+}
+
+// WatchJob prints the state transitions of a job as JSON lines until it is
+// done, as event records with --output ndjson. Fails when the job is
+// aborted, and exits with 2 on --timeout.
+func (a *App) WatchJob(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New("usage watch <printerName> <jobID>")
+	}
+	printerName := a.printerArg(c, 0)
+	jobID, err := strconv.ParseUint(args.Get(1), 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+
+	if c.Duration("interval") <= 0 {
+		return errors.New(tr("--interval 必须大于 0"))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if timeout := c.Duration("timeout"); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// Polling alone still works without notifications.
+	events, err := a.spool.Subscribe(ctx)
+	if err != nil {
+		log.Printf(tr("无法订阅作业通知, 改为轮询: %s"), err)
+		events = nil
+	}
+
+	getState := func() (*model.PrintJobStateDiff, error) {
+		return a.spool.GetJobState(printerName, uint32(jobID))
+	}
+	records := lib.NewEventRecordWriter(os.Stdout)
+	var lastType model.JobStateType
+	report := func(state *model.PrintJobStateDiff) {
+		if ndjsonOutput(c) {
+			event := lib.Event{Type: lib.EventJobStateChanged, Time: time.Now(), Printer: printerName, JobID: uint32(jobID), JobState: state}
+			if state.State != nil && state.State.Type == lastType {
+				event.Type = lib.EventJobProgress
+			} else if state.State != nil {
+				lastType = state.State.Type
+			}
+			records.Write(lib.NewEventRecord(event))
+			return
+		}
+		body, err := json.Marshal(struct {
+			Time time.Time `json:"time"`
+			*model.PrintJobStateDiff
+		}{time.Now(), state})
+		if err == nil {
+			fmt.Println(string(body))
+		}
+	}
+	state, err := lib.WatchJob(ctx, uint32(jobID), getState, events, c.Duration("interval"), report)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return cli.Exit(fmt.Sprintf(tr("等待作业 %d 超时"), jobID), 2)
+	}
+	if err != nil {
+		return err
+	}
+	if state.State.Type == model.JobStateAborted {
+		return fmt.Errorf(tr("作业 %d 已中止"), jobID)
+	}
+	return nil
+}
+
+func (a *App) CancelJob(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New("usage cancel <printerName> <jobID>")
+	}
+	printerName := a.printerArg(c, 0)
+	jobID, err := strconv.ParseUint(args.Get(1), 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+	if err = a.spool.CancelJob(printerName, uint32(jobID)); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("作业 %d 已取消\n"), jobID)
+	return nil
+}
+
+// SetJobPriority changes the priority of a job, which reorders the queue.
+func (a *App) SetJobPriority(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 3 {
+		return errors.New("usage prio <printerName> <jobID> <priority>")
+	}
+	printerName := a.printerArg(c, 0)
+	jobID, err := strconv.ParseUint(args.Get(1), 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+	priority, err := strconv.ParseUint(args.Get(2), 10, 32)
+	if err != nil || uint32(priority) < lib.JobPriorityMin || uint32(priority) > lib.JobPriorityMax {
+		return fmt.Errorf(tr("优先级应为 %d 到 %d"), lib.JobPriorityMin, lib.JobPriorityMax)
+	}
+	if err = a.spool.SetJobPriority(printerName, uint32(jobID), uint32(priority)); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("作业 %d 的优先级已改为 %d\n"), jobID, priority)
+	return nil
+}
+
+// PrintJobNow prints a job held outside of the print window of its printer.
+func (a *App) PrintJobNow(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New("usage print-now <printerName> <jobID>")
+	}
+	printerName := a.printerArg(c, 0)
+	jobID, err := strconv.ParseUint(args.Get(1), 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+	if err = a.spool.PrintJobNow(printerName, uint32(jobID)); err != nil {
+		return adminError(err)
+	}
+	fmt.Printf(tr("作业 %d 将立即打印\n"), jobID)
+	return nil
+}
+
+// ReleaseHeldJob prints a job held with job add --hold.
+func (a *App) ReleaseHeldJob(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 2 {
+		return errors.New("usage release <printerName> <jobID>")
+	}
+	printerName := a.printerArg(c, 0)
+	jobID, err := strconv.ParseUint(args.Get(1), 10, 32)
+	if err != nil {
+		return errors.New(tr("jobID 错误"))
+	}
+	if err = a.spool.ReleaseHeldJob(printerName, uint32(jobID), c.String("pin")); err != nil {
+		if errors.Is(err, lib.ErrWrongPIN) {
+			return fmt.Errorf(tr("%s: PIN 错误"), err)
+		}
+		if errors.Is(err, lib.ErrJobNotHeld) {
+			return fmt.Errorf(tr("%s: 作业未保留, 或已释放"), err)
+		}
+		return adminError(err)
+	}
+	fmt.Printf(tr("作业 %d 已释放, 开始打印\n"), jobID)
+	return nil
+}
+
+// ListHeldJobs lists the jobs held with job add --hold, as noted in the
+// held_jobs_file.
+func (a *App) ListHeldJobs(c *cli.Context) error {
+	if a.spool.HeldJobs == nil {
+		return errors.New(tr("配置文件中没有 held_jobs_file"))
+	}
+	jobs, err := a.spool.HeldJobs.Jobs()
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		type heldJobOutput struct {
+			Printer string    `json:"printer"`
+			JobID   uint32    `json:"job_id"`
+			Title   string    `json:"title"`
+			User    string    `json:"user"`
+			Held    time.Time `json:"held"`
+			PIN     bool      `json:"pin"`
+		}
+		output := make([]heldJobOutput, len(jobs))
+		for i, job := range jobs {
+			output[i] = heldJobOutput{Printer: job.Printer, JobID: job.JobID, Title: job.Title, User: job.User, Held: job.Held, PIN: job.HasPIN()}
+		}
+		return printJSON(output)
+	}
+	t := tabby.New()
+	t.AddHeader(tr("打印机"), tr("作业ID"), tr("文档"), tr("用户"), tr("提交时间"), "PIN")
+	for _, job := range jobs {
+		t.AddLine(job.Printer, job.JobID, job.Title, job.User, job.Held.Local().Format("2006-01-02 15:04"), job.HasPIN())
+	}
+	t.Print()
+	return nil
+}
+
+func (a *App) ListJob(c *cli.Context) error {
+	args := c.Args()
+	if args.Len() < 1 {
+		return errors.New("usage state <printerName>")
+	}
+	printerName := a.printerArg(c, 0)
+	if c.Bool("detailed") {
+		return a.listJobDetails(c, printerName)
+	}
+	list, err := a.spool.JobList(printerName)
+	if err != nil {
+		return err
+	}
+	if c.Bool("mine") {
+		mine := list[:0]
+		for _, job := range list {
+			if strings.EqualFold(job.UserName, os.Getenv("USERNAME")) {
+				mine = append(mine, job)
+			}
+		}
+		list = mine
+	}
+	if jsonOutput(c) {
+		return printJSON(newJobOutputs(list))
+	}
+	OutputJobList(list)
+	return nil
+}
+
+// listJobDetails lists jobs with what JOB_INFO_2 adds.
+func (a *App) listJobDetails(c *cli.Context, printerName string) error {
+	list, err := a.spool.JobListDetailed(printerName)
+	if err != nil {
+		return err
+	}
+	if c.Bool("mine") {
+		mine := list[:0]
+		for _, job := range list {
+			if strings.EqualFold(job.UserName, os.Getenv("USERNAME")) {
+				mine = append(mine, job)
+			}
+		}
+		list = mine
+	}
+	if jsonOutput(c) {
+		return printJSON(newJobDetailsOutputs(list))
+	}
+	t := tabby.New()
+	t.AddHeader(tr("作业ID"), tr("文档"), tr("用户"), tr("提交时间"), tr("页数"), tr("大小"), tr("状态"))
+	for _, job := range list {
+		status := lib.JobStatusString(job.Status)
+		if job.StatusText != "" {
+			status += " " + job.StatusText
+		}
+		t.AddLine(job.JobID, job.Document, job.UserName, job.Submitted.Local().Format("2006-01-02 15:04"),
+			fmt.Sprintf("%d/%d", job.PagesPrinted, job.TotalPages), job.Size, status)
+	}
+	t.Print()
+	return nil
+}
+
+func (a *App) Daemon(c *cli.Context) error {
+	if ndjsonOutput(c) {
+		a.eventRecords = lib.NewEventRecordWriter(os.Stdout)
+	}
+	return a.runDaemon(waitIndefinitely)
+}
+
+// runDaemon tracks printers and jobs until wait returns, then shuts down,
+// waiting for the job being submitted.
+func (a *App) runDaemon(wait func()) error {
+	if a.config.ResumeHeldJobsOnArrival {
+		printers, err := a.spool.GetPrinters()
+		if err != nil {
+			return adminError(err)
+		}
+		for _, printer := range printers {
+			if err := a.requirePrinterAdmin(tr("resume_held_jobs_on_arrival 恢复挂起作业"), printer.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if a.config.SupportBundleDir != "" {
+		lines := a.config.SupportBundleLogLines
+		if lines <= 0 {
+			lines = lib.DefaultSupportBundleLogLines
+		}
+		a.logTail = lib.NewLogTail(lines)
+		log.SetOutput(io.MultiWriter(log.Writer(), a.logTail))
+	}
+	pm, err := manager.NewPrinterManager(a.spool, a.config)
+	if err != nil {
+		return err
+	}
+	log.Printf(tr("守护进程已启动, 共 %d 台打印机"), len(pm.GetPrinters()))
+	go func() {
+		for event := range pm.PrinterEvents() {
+			log.Printf(tr("打印机 %s: %s"), event.Printer, event.Type)
+		}
+	}()
+
+	metrics, err := manager.NewMetrics(a.config.MetricsFile)
+	if err != nil {
+		return err
+	}
+	slaMonitor, err := manager.NewSLAMonitor(a.config.Printers)
+	if err != nil {
+		return err
+	}
+	router, err := manager.NewEventRouter(a.config.EventRoutes, a.config.Printers)
+	if err != nil {
+		return err
+	}
+	closeAccounting, err := a.openAccounting()
+	if err != nil {
+		return err
+	}
+	defer closeAccounting()
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := a.spool.Subscribe(ctx)
+	if err != nil {
+		log.Printf(tr("无法订阅打印事件, 不记录打印机指标和 SLA, 也不推送事件: %s"), err)
+	} else {
+		go a.observeEvents(events, metrics, slaMonitor, router)
+	}
+	queueDone, err := a.runJobQueue(ctx, pm)
+	if err != nil {
+		cancel()
+		pm.Quit()
+		return err
+	}
+	if err = a.servePipes(ctx); err != nil {
+		cancel()
+		<-queueDone
+		pm.Quit()
+		return err
+	}
+
+	wait()
+
+	cancel()
+	<-queueDone
+	if err = metrics.Save(); err != nil {
+		log.Printf(tr("保存打印机指标失败: %s"), err)
+	}
+	pm.Quit()
+	body, err := json.Marshal(pm.GetStats())
+	if err != nil {
+		return err
+	}
+	log.Printf(tr("守护进程已退出, 后台打印服务调用统计: %s"), body)
+	return nil
+}
+
+// openAccounting sets a.accountant up when accounting is configured, and
+// returns the function that closes its sinks.
+func (a *App) openAccounting() (func(), error) {
+	if a.config.Accounting == nil {
+		return func() {}, nil
+	}
+	sink, err := lib.OpenAccountingSinks(a.config.Accounting)
+	if err != nil {
+		return nil, fmt.Errorf(tr("打开计费记录失败: %s"), err)
+	}
+	a.accountant = manager.NewAccountant(a.spool, sink)
+	return func() {
+		if err := sink.Close(); err != nil {
+			log.Printf(tr("关闭计费记录失败: %s"), err)
+		}
+	}, nil
+}
+
+// observeEvents feeds events to metrics, saving them every minute, to
+// the SLA monitor, reporting breaches every 10 seconds, to the event
+// routes, to the accountant, and to a.eventRecords.
+func (a *App) observeEvents(events <-chan lib.Event, metrics *manager.Metrics, slaMonitor *manager.SLAMonitor, router *manager.EventRouter) {
+	save := time.NewTicker(time.Minute)
+	defer save.Stop()
+	check := time.NewTicker(10 * time.Second)
+	defer check.Stop()
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			metrics.Observe(event)
+			slaMonitor.Observe(event)
+			router.Observe(event)
+			if a.accountant != nil {
+				a.accountant.Observe(event)
+			}
+			if a.eventRecords != nil {
+				if err := a.eventRecords.Write(lib.NewEventRecord(event)); err != nil {
+					log.Printf(tr("写入事件失败: %s"), err)
+				}
+			}
+		case <-save.C:
+			if err := metrics.Save(); err != nil {
+				log.Printf(tr("保存打印机指标失败: %s"), err)
+			}
+		case <-check.C:
+			for _, breach := range slaMonitor.Check() {
+				a.reportSLABreach(breach)
+			}
+		}
+	}
+}
+
+func (a *App) reportSLABreach(breach manager.SLABreach) {
+	log.Printf(tr("SLA 告警: %s"), breach)
+	if a.config.SLAWebhook == "" {
+		return
+	}
+	go func() {
+		if err := lib.PostWebhook(a.config.SLAWebhook, breach); err != nil {
+			log.Printf(tr("发送 SLA 告警失败: %s"), err)
+		}
+	}()
+}
+
+// runJobQueue prints the jobs sent to a.jobs through the queue in
+// job_queue_dir, so that they are retried and survive restarts, or right
+// away when there is no queue. The returned channel is closed once the
+// queue is closed after ctx is done.
+func (a *App) runJobQueue(ctx context.Context, pm *manager.PrinterManager) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	if a.config.JobQueueDir == "" {
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-a.jobs:
+					queued := &lib.QueuedJob{Printer: job.NativePrinterName, Filename: job.Filename, Title: job.Title, Ticket: job.Ticket}
+					if _, err := a.printQueuedJob(pm, queued); err != nil {
+						log.Printf(tr("打印作业 %s 失败: %s"), job.Title, err)
+						if bundle := a.supportBundle(queued, err); bundle != "" {
+							log.Printf(tr("作业 %s 的诊断包: %s"), job.Title, bundle)
+						}
+					}
+					if job.Cleanup != nil {
+						job.Cleanup()
+					}
+				}
+			}
+		}()
+		return done, nil
+	}
+
+	queue, err := lib.OpenJobQueue(a.config.JobQueueDir)
+	if err != nil {
+		return nil, err
+	}
+	if a.config.JobQueueMaxAttempts > 0 {
+		queue.MaxAttempts = a.config.JobQueueMaxAttempts
+	}
+	if a.config.SupportBundleDir != "" {
+		queue.SupportBundle = a.supportBundle
+	}
+	queue.ForgetPrinted = a.config.JobRetention == lib.JobRetentionSpooler
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case job := <-a.jobs:
+				if _, err := queue.Submit(job); err != nil {
+					log.Printf(tr("作业 %s 无法加入队列: %s"), job.Title, err)
+				}
+				if job.Cleanup != nil {
+					job.Cleanup()
+				}
+			}
+		}
+	}()
+	go func() {
+		defer close(done)
+		if err := queue.Run(ctx, func(job *lib.QueuedJob) (uint32, error) { return a.printQueuedJob(pm, job) }); err != nil {
+			log.Printf(tr("作业队列已停止: %s"), err)
+		}
+		if err := queue.Close(); err != nil {
+			log.Printf(tr("关闭作业队列失败: %s"), err)
+		}
+	}()
+	return done, nil
+}
+
+// supportBundle writes a support bundle about a job that failed to
+// support_bundle_dir, and returns its path; "" when none is configured or
+// it couldn't be written.
+func (a *App) supportBundle(job *lib.QueuedJob, err error) string {
+	if a.config.SupportBundleDir == "" {
+		return ""
+	}
+	b := &lib.SupportBundle{
+		Time:        time.Now(),
+		Version:     fmt.Sprintf("%s (%s, %s)", version, hash, datetime),
+		Printer:     job.Printer,
+		Title:       job.Title,
+		QueuedJobID: job.ID,
+		Error:       err.Error(),
+		Ticket:      job.Ticket,
+	}
+	b.Host, _ = os.Hostname()
+	a.spool.CollectSupportInfo(b)
+	if a.logTail != nil {
+		b.LogLines = a.logTail.Lines()
+	}
+	path, err := lib.WriteSupportBundle(a.config.SupportBundleDir, b)
+	if err != nil {
+		log.Printf(tr("写入作业 %s 的诊断包失败: %s"), job.Title, err)
+		return ""
+	}
+	return path
+}
+
+// printQueuedJob prints a job, and has the printer manager follow it.
+func (a *App) printQueuedJob(pm *manager.PrinterManager, job *lib.QueuedJob) (uint32, error) {
+	printer, ok := pm.GetPrinter(job.Printer)
+	if !ok {
+		// Maybe unplugged, worth retrying.
+		return 0, fmt.Errorf(tr("打印机 %s 不存在"), job.Printer)
+	}
+	ticket := job.Ticket
+	if ticket == nil {
+		ticket = &model.JobTicket{}
+	}
+	result, err := a.spool.Print(&printer, job.Filename, job.Title, ticket)
+	if err != nil {
+		return 0, err
+	}
+	log.Printf(tr("作业 %s 已提交到打印机 %s, 作业ID %d"), job.Title, job.Printer, result.JobID)
+	if a.accountant != nil {
+		a.accountant.Rendered(result.JobID, result.Pages)
+	}
+	pm.TrackJob(&lib.Job{NativePrinterName: job.Printer, Title: job.Title, JobID: strconv.FormatUint(job.ID, 10)}, result.JobID)
+	return result.JobID, nil
+}
+
+// WatchPrinter prints the events of a printer, or of all printers, until
+// interrupted: a line per event, or an event record per line with --output
+// json or ndjson.
+func (a *App) WatchPrinter(c *cli.Context) error {
+	printerName := a.printerArg(c, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := a.spool.Subscribe(ctx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		waitIndefinitely()
+		cancel()
+	}()
+
+	records := lib.NewEventRecordWriter(os.Stdout)
+	for event := range events {
+		if printerName != "" && event.Printer != printerName {
+			continue
+		}
+		record := lib.NewEventRecord(event)
+		if jsonOutput(c) {
+			if err := records.Write(record); err != nil {
+				return err
+			}
+			continue
+		}
+		state := string(record.PrinterState)
+		if record.JobID != 0 {
+			state = fmt.Sprintf(tr("作业 %d %s"), record.JobID, record.JobState)
+			if record.PagesPrinted != nil {
+				state += fmt.Sprintf(tr(" 已打印 %d 页"), *record.PagesPrinted)
+			}
+		}
+		if record.JobStateCause != "" {
+			state += " " + record.JobStateCause
+		}
+		for _, message := range record.PrinterMessages {
+			state += " " + message
+		}
+		fmt.Printf("%s  %-7s %-21s %s  %s\n", record.Time.Local().Format("15:04:05"), record.Severity, record.Type, record.Printer, state)
+	}
+	return nil
+}
+
+func (a *App) PrinterStats(c *cli.Context) error {
+	if a.config.MetricsFile == "" {
+		return errors.New(tr("未配置 metrics_file"))
+	}
+	metrics, err := manager.NewMetrics(a.config.MetricsFile)
+	if err != nil {
+		return err
+	}
+	printerName := a.printerArg(c, 0)
+	stats := []manager.PrinterStats{}
+	for _, s := range metrics.Stats() {
+		if printerName != "" && s.Printer != printerName {
+			continue
+		}
+		// The metrics file only has aggregates; read the queue now.
+		if jobs, err := a.spool.JobList(s.Printer); err == nil {
+			s.QueueDepth = len(jobs)
+		}
+		stats = append(stats, s)
+	}
+	if jsonOutput(c) {
+		return printJSON(stats)
+	}
+
+	t := tabby.New()
+	t.AddHeader(tr("打印机"), tr("队列"), tr("作业/小时"), tr("首页平均耗时"), tr("失败率"), tr("最大队列"), tr("完成"), tr("失败"))
+	for _, s := range stats {
+		t.AddLine(s.Printer, s.QueueDepth, fmt.Sprintf("%.1f", s.JobsPerHour),
+			time.Duration(s.AvgTimeToFirstPageMs)*time.Millisecond,
+			fmt.Sprintf("%.1f%%", s.FailureRate*100), s.MaxQueueDepth, s.Totals.Completed, s.Totals.Failed)
+	}
+	t.Print()
+	return nil
+}
+
+// accountingRecords reads the records of accounting.db_file finished within
+// --from and --to, dates in local time; --to is included.
+func (a *App) accountingRecords(c *cli.Context) ([]lib.AccountingRecord, error) {
+	if a.config.Accounting == nil || a.config.Accounting.DBFile == "" {
+		return nil, errors.New(tr("未配置 accounting.db_file"))
+	}
+	var from, to time.Time
+	var err error
+	if s := c.String("from"); s != "" {
+		if from, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			return nil, fmt.Errorf(tr("无效的 --from: %s"), err)
+		}
+	}
+	if s := c.String("to"); s != "" {
+		if to, err = time.ParseInLocation("2006-01-02", s, time.Local); err != nil {
+			return nil, fmt.Errorf(tr("无效的 --to: %s"), err)
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	db, err := lib.OpenAccountingDB(a.config.Accounting.DBFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.Records(from, to)
+}
+
+// AccountingReport sums the recorded jobs by user or printer.
+func (a *App) AccountingReport(c *cli.Context) error {
+	records, err := a.accountingRecords(c)
+	if err != nil {
+		return err
+	}
+	var key func(r *lib.AccountingRecord) string
+	switch by := c.String("by"); by {
+	case "user":
+		key = func(r *lib.AccountingRecord) string { return r.User }
+	case "printer":
+		key = func(r *lib.AccountingRecord) string { return r.Printer }
+	default:
+		return fmt.Errorf(tr("无效的 --by %q, 可选 user 或 printer"), by)
+	}
+	totals := lib.SumAccountingRecords(records, key)
+	if jsonOutput(c) {
+		return printJSON(totals)
+	}
+
+	t := tabby.New()
+	t.AddHeader(c.String("by"), tr("作业"), tr("页数"), tr("彩色页数"))
+	for _, total := range totals {
+		t.AddLine(total.Key, total.Jobs, total.Pages, total.ColorPages)
+	}
+	t.Print()
+	return nil
+}
+
+// AccountingExport writes the recorded jobs as CSV, or JSON with --output
+// json.
+func (a *App) AccountingExport(c *cli.Context) error {
+	records, err := a.accountingRecords(c)
+	if err != nil {
+		return err
+	}
+	if jsonOutput(c) {
+		if records == nil {
+			records = []lib.AccountingRecord{}
+		}
+		return printJSON(records)
+	}
+	return lib.WriteAccountingCSV(os.Stdout, records)
+}
+
+func (a *App) Serve(c *cli.Context) error {
+	pm, err := manager.NewPrinterManager(a.spool, a.config)
+	if err != nil {
+		return err
+	}
+	defer pm.Quit()
+
+	metrics, err := manager.NewMetrics(a.config.MetricsFile)
+	if err != nil {
+		return err
+	}
+	slaMonitor, err := manager.NewSLAMonitor(a.config.Printers)
+	if err != nil {
+		return err
+	}
+	router, err := manager.NewEventRouter(a.config.EventRoutes, a.config.Printers)
+	if err != nil {
+		return err
+	}
+	closeAccounting, err := a.openAccounting()
+	if err != nil {
+		return err
+	}
+	defer closeAccounting()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if events, err := a.spool.Subscribe(ctx); err != nil {
+		log.Printf(tr("无法订阅打印事件, 不记录打印机指标和 SLA, 也不推送事件: %s"), err)
+	} else {
+		go a.observeEvents(events, metrics, slaMonitor, router)
+	}
+
+	templates, err := lib.LoadDocumentTemplates(a.config.Templates)
+	if err != nil {
+		return err
+	}
+	handler := &server.Server{
+		Printers: pm,
+		Spooler:  a.spool,
+		Metrics:  func() interface{} { return metrics.Stats() },
+		Jobs: func(printerName string) (interface{}, error) {
+			return a.spool.JobListDetailed(printerName)
+		},
+		StrictTickets: c.Bool("strict"),
+		Templates:     templates,
+		EventRoutes:   router,
+	}
+	if c.Bool("ipp") {
+		handler.IPP = &server.IPPServer{Printers: pm, Spooler: a.spool}
+	} else if c.Bool("mdns") {
+		return errors.New(tr("--mdns 需要 --ipp"))
+	}
+	srv := &http.Server{Addr: c.String("listen"), Handler: handler}
+	done := make(chan struct{})
+	go func() {
+		waitIndefinitely()
+		close(done)
+		srv.Close()
+	}()
+
+	if c.Bool("mdns") {
+		_, port, err := net.SplitHostPort(srv.Addr)
+		if err != nil {
+			return err
+		}
+		advertiser := &server.Advertiser{Printers: pm}
+		if advertiser.Port, err = strconv.Atoi(port); err != nil {
+			return fmt.Errorf(tr("--listen 端口 %q 无效"), port)
+		}
+		go func() {
+			if err := advertiser.Run(done); err != nil {
+				log.Printf(tr("mDNS 广播失败: %s"), err)
+			}
+		}()
+	}
+
+	if coordinator := c.String("coordinator"); coordinator != "" {
+		name := c.String("agent-name")
+		if name == "" {
+			if name, err = os.Hostname(); err != nil {
+				return err
+			}
+		}
+		advertise := c.String("advertise")
+		if advertise == "" {
+			advertise = "http://" + srv.Addr
+		}
+		agent := &server.Agent{Coordinators: strings.Split(coordinator, ","), Name: name, URL: advertise, Printers: pm, Token: a.config.ClusterToken}
+		go agent.Run(done)
+	}
+
+	log.Printf(tr("HTTP 服务监听 %s"), srv.Addr)
+	if err = srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return metrics.Save()
+}
+
+// GRPC serves the spooler over gRPC, for typed remote access; see
+// rpc/spoolerpb for the service and its generated client.
+func (a *App) GRPC(c *cli.Context) error {
+	pm, err := manager.NewPrinterManager(a.spool, a.config)
+	if err != nil {
+		return err
+	}
+	defer pm.Quit()
+
+	listener, err := net.Listen("tcp", c.String("listen"))
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	spoolerpb.RegisterSpoolerServer(srv, &rpc.Server{
+		Printers:      pm,
+		Spooler:       a.spool,
+		Subscribe:     a.spool.Subscribe,
+		StrictTickets: c.Bool("strict"),
+	})
+	go func() {
+		waitIndefinitely()
+		srv.GracefulStop()
+	}()
+
+	log.Printf(tr("gRPC 服务监听 %s"), listener.Addr())
+	return srv.Serve(listener)
+}
+
+func (a *App) Coordinator(c *cli.Context) error {
+	coordinator := server.NewCoordinator()
+	coordinator.Token = a.config.ClusterToken
+	if store := c.String("store"); store != "" {
+		coordinator.Store = &server.FileStore{Path: store}
+	}
+	srv := &http.Server{
+		Addr:    c.String("listen"),
+		Handler: coordinator,
+	}
+
+	done := make(chan struct{})
+	elected := make(chan struct{})
+	if lease := c.String("lease"); lease != "" {
+		name := c.String("name")
+		if name == "" {
+			var err error
+			if name, err = os.Hostname(); err != nil {
+				return err
+			}
+		}
+		go func() {
+			coordinator.RunElection(server.NewFileLease(lease, name, c.Duration("lease-ttl")), done)
+			close(elected)
+		}()
+	} else {
+		close(elected)
+	}
+	go func() {
+		waitIndefinitely()
+		close(done)
+		srv.Close()
+	}()
+	// Release the lease on exit, so that another instance takes over now.
+	defer func() { <-elected }()
+
+	log.Printf(tr("协调服务监听 %s"), srv.Addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+func (a *App) Version(c *cli.Context) error {
+	fmt.Printf("echo-service has version %s built from %s on %s\n", version, hash, datetime)
+	if !winspool.RenderingAvailable() {
+		fmt.Println("built without cgo: documents are not rendered, only RAW, plain text and pdf_direct documents print")
+	} else {
+		fmt.Printf("PDF renderers: %s\n", strings.Join(winspool.PDFRenderers(), ", "))
+	}
+	return nil
+}
+
+func NewApp() *cli.App {
+	spool, err := winspool.NewWinSpool()
+	if err != nil {
+		panic(err)
+	}
+	jobs := make(chan *lib.Job, 10)
+	app := &App{
+		spool: spool,
+		jobs:  jobs,
+	}
+
+	cliApp := &cli.App{
+		Name:  "printpdf",
+		Usage: tr("打印机操作命令行程序"),
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "config",
+				Value: lib.ConfigFilename,
+				Usage: tr("配置文件路径"),
+			},
+			&cli.StringFlag{
+				Name:  "server",
+				Usage: tr("管理的打印服务器, 例如 \\\\PRINTSRV01, 默认为本机; 打印机名称可省略服务器前缀"),
+			},
+			&cli.StringFlag{
+				Name:  "lang",
+				Value: string(language),
+				Usage: tr("消息语言, zh-CN 或 en-US, 默认按 LC_ALL, LC_MESSAGES 或 LANG 环境变量"),
+			},
+			&cli.StringFlag{
+				Name:    "output",
+				Aliases: []string{"o"},
+				Value:   outputTable,
+				Usage:   tr("printer ls, printer stats, job ls, job status 的输出格式, table 或 json; printer watch, job watch 和 daemon 的事件流为 ndjson"),
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:     "version",
+				Category: tr(userCategory),
+				Action:   app.Version,
+				Usage:    tr("查看版本号"),
+			},
+			{
+				Name:     "daemon",
+				Category: tr(adminCategory),
+				Action:   app.Daemon,
+				Usage:    tr("以守护进程方式运行, 跟踪打印机和作业状态; --output ndjson 时将打印事件逐行写到标准输出"),
+			},
+			{
+				Name:     "service",
+				Category: tr(adminCategory),
+				Usage:    tr("将守护进程安装为 Windows 服务并管理, 日志写入事件日志"),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Value: defaultServiceName,
+						Usage: tr("服务名称, 也是事件日志源"),
+					},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Name:   "install",
+						Usage:  tr("安装服务, 开机自动启动, 使用 --config 指定的配置文件"),
+						Before: adminOnly("service install"),
+						Action: app.InstallService,
+					},
+					{
+						Name:   "uninstall",
+						Usage:  tr("停止并卸载服务"),
+						Before: adminOnly("service uninstall"),
+						Action: app.UninstallService,
+					},
+					{
+						Name:   "start",
+						Usage:  tr("启动服务"),
+						Before: adminOnly("service start"),
+						Action: app.StartService,
+					},
+					{
+						Name:   "stop",
+						Usage:  tr("停止服务, 等待正在提交的作业"),
+						Before: adminOnly("service stop"),
+						Action: app.StopService,
+					},
+					{
+						Name:   "run",
+						Usage:  tr("由服务控制管理器启动"),
+						Hidden: true,
+						Action: app.RunService,
+					},
+				},
+			},
+			{
+				Name:     "serve",
+				Category: tr(adminCategory),
+				Usage:    tr("启动 HTTP REST 服务, 提供打印机, 作业提交, 状态和取消接口"),
+				Action:   app.Serve,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: "127.0.0.1:8631",
+						Usage: tr("监听地址"),
+					},
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+					},
+					&cli.BoolFlag{
+						Name:  "ipp",
+						Usage: tr("在 /ipp/print/<打印机名> 以 IPP Everywhere 打印机提供各打印机, 供 Linux, macOS 和移动设备免驱动打印"),
+					},
+					&cli.BoolFlag{
+						Name:  "mdns",
+						Usage: tr("通过 mDNS/DNS-SD (Bonjour) 在局域网广播 IPP 打印机, 供 AirPrint 客户端自动发现; 需要 --ipp, 且监听地址不能仅为 127.0.0.1"),
+					},
+					&cli.StringFlag{
+						Name:  "coordinator",
+						Usage: tr("以代理方式向协调服务注册打印机, 例如 http://coordinator:8640, 高可用部署时用逗号分隔各实例"),
+					},
+					&cli.StringFlag{
+						Name:  "agent-name",
+						Usage: tr("代理在集群中的名称, 默认为主机名"),
+					},
+					&cli.StringFlag{
+						Name:  "advertise",
+						Usage: tr("协调服务访问本代理的地址, 默认为 http://<监听地址>"),
+					},
+				},
+			},
+			{
+				Name:     "grpc",
+				Category: tr(adminCategory),
+				Usage:    tr("启动 gRPC 服务, 提供打印机, 能力, 作业提交, 状态, 事件流和取消接口"),
+				Action:   app.GRPC,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: "127.0.0.1:8632",
+						Usage: tr("监听地址"),
+					},
+					&cli.BoolFlag{
+						Name:  "strict",
+						Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+					},
+				},
+			},
+			{
+				Name:     "coordinator",
+				Category: tr(adminCategory),
+				Usage:    tr("启动集群协调服务, 汇总各代理的打印机并转发请求"),
+				Action:   app.Coordinator,
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Value: "127.0.0.1:8640",
+						Usage: tr("监听地址"),
+					},
+					&cli.StringFlag{
+						Name:  "lease",
+						Usage: tr("高可用部署时的共享租约文件, 各实例通过它选举主实例, 例如 \\\\server\\share\\winspool.lease"),
+					},
+					&cli.DurationFlag{
+						Name:  "lease-ttl",
+						Value: server.DefaultLeaseTTL,
+						Usage: tr("租约有效期, 主实例失效后备用实例接管前的最长时间"),
+					},
+					&cli.StringFlag{
+						Name:  "store",
+						Usage: tr("共享状态文件, 保存代理注册和作业, 供接管的实例使用"),
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: tr("实例名称, 默认为主机名"),
+					},
+				},
+			},
+			{
+				Name:     "printer",
+				Category: tr(userCategory),
+				Usage:    tr("打印机操作"),
+				Subcommands: []*cli.Command{
+					{
+						Name:     "ls",
+						Category: tr(userCategory),
+						Usage:    tr("获取打印机列表"),
+						Action:   app.ListPrinter,
+					},
+					{
+						Name:      "stats",
+						Category:  tr(userCategory),
+						Usage:     tr("打印机队列和吞吐量指标, 由守护进程记录"),
+						ArgsUsage: tr("[打印机]"),
+						Action:    app.PrinterStats,
+					},
+					{
+						Name:      "watch",
+						Category:  tr(userCategory),
+						Usage:     tr("跟踪打印机和作业事件, 直到中断; --output ndjson 每行输出一条事件记录"),
+						ArgsUsage: tr("[打印机]"),
+						Action:    app.WatchPrinter,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "snmp-community",
+								Usage: tr("通过SNMP读取网络打印机序列号的团体名"),
+							},
+						},
+						Name:     "inspect",
+						Category: tr(userCategory),
+						Usage:    tr("获取打印机详情"),
+						Action:   app.InspectPrinter,
+					},
+					{
+						Name:      "capture-devmode",
+						Category:  tr(userCategory),
+						Usage:     tr("将当前用户的打印首选项 (如装订, 打孔) 保存为打印机的DEVMODE预设, 供 job add --devmode-preset 使用; 需要配置 devmode_presets_dir"),
+						ArgsUsage: tr("<打印机> <预设>"),
+						Action:    app.CaptureDevMode,
+					},
+					{
+						Name:      "capabilities",
+						Category:  tr(userCategory),
+						Usage:     tr("以CDD JSON输出打印机的全部能力: 颜色, 双面, 纸张, 分辨率, 纸盒, 驱动的厂商能力等"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.PrinterCapabilities,
+					},
+					{
+						Name:      "diff",
+						Category:  tr(userCategory),
+						Usage:     tr("比较两台打印机的能力: 纸张, 双面, 颜色, 分辨率, 纸盒等"),
+						ArgsUsage: tr("<打印机A> <打印机B>"),
+						Action:    app.DiffPrinters,
+					},
+					{
+						Name:      "testpage",
+						Category:  tr(userCategory),
+						Usage:     tr("按打印机的默认设置打印测试页: 毫米网格, 可打印区域和页边距, 分辨率, 驱动, 灰度和彩色色阶, 用于部署后核对对齐"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.PrintTestPage,
+					},
+					{
+						Name:     "default",
+						Category: tr(userCategory),
+						Usage:    tr("获取当前用户的默认打印机"),
+						Action:   app.DefaultPrinter,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "mdns",
+								Usage: tr("同时通过mDNS (Bonjour) 扫描IPP打印机"),
+							},
+							&cli.BoolFlag{
+								Name:  "wsd",
+								Usage: tr("同时通过WS-Discovery扫描WSD打印机"),
+							},
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: lib.DefaultDiscoveryTimeout,
+								Usage: tr("等待扫描应答的时间"),
+							},
+							&cli.BoolFlag{
+								Name:  "connect",
+								Usage: tr("为发现的每台共享打印机 (\\\\服务器\\打印机) 添加打印机连接"),
+							},
+						},
+						Name:     "discover",
+						Category: tr(userCategory),
+						Usage:    tr("发现网络上的打印机: 域中浏览到的共享打印机, 以及可选的mDNS和WS-Discovery扫描"),
+						Action:   app.DiscoverPrinters,
+					},
+					{
+						Name:      "set-default",
+						Category:  tr(userCategory),
+						Usage:     tr("设置当前用户的默认打印机"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.SetDefaultPrinter,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "port",
+								Required: true,
+								Usage:    tr("打印机使用的端口, 例如 LPT1: 或标准 TCP/IP 端口 IP_192.168.1.20, 需已存在"),
+							},
+							&cli.StringFlag{
+								Name:     "driver",
+								Required: true,
+								Usage:    tr("已安装的打印机驱动名称"),
+							},
+							&cli.StringFlag{
+								Name:  "print-processor",
+								Usage: tr("打印处理器, 默认为 winprint"),
+							},
+							&cli.StringFlag{
+								Name:  "datatype",
+								Usage: tr("默认数据类型, 默认为 RAW"),
+							},
+							&cli.StringFlag{
+								Name:  "comment",
+								Usage: tr("打印机备注"),
+							},
+							&cli.StringFlag{
+								Name:  "location",
+								Usage: tr("打印机位置"),
+							},
+							&cli.StringFlag{
+								Name:  "share",
+								Usage: tr("以此共享名共享打印机"),
+							},
+						},
+						Name:      "add",
+						Category:  tr(adminCategory),
+						Usage:     tr("添加打印队列, 使用已存在的端口和已安装的驱动"),
+						ArgsUsage: tr("<打印机>"),
+						Before:    app.serverAdminOnly("printer add"),
+						Action:    app.AddPrinter,
+					},
+					{
+						Name:      "rm",
+						Category:  tr(adminCategory),
+						Usage:     tr("删除打印队列, 队列中的作业完成后删除"),
+						ArgsUsage: tr("<打印机>"),
+						Before:    app.serverAdminOnly("printer rm"),
+						Action:    app.DeletePrinter,
+					},
+					{
+						Name:      "connect",
+						Category:  tr(userCategory),
+						Usage:     tr("为当前用户添加共享打印机的连接, 例如 \\\\PRINTSRV01\\Office"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.ConnectPrinter,
+					},
+					{
+						Name:      "disconnect",
+						Category:  tr(userCategory),
+						Usage:     tr("删除当前用户与共享打印机的连接"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.DisconnectPrinter,
+					},
+					{
+						Name:      "get",
+						Category:  tr(userCategory),
+						Usage:     tr("获取打印机的位置, 备注, 共享名和分隔页"),
+						ArgsUsage: tr("<打印机>"),
+						Action:    app.GetPrinterConfig,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "location",
+								Usage: tr("打印机位置, 例如 \"Floor 3\""),
+							},
+							&cli.StringFlag{
+								Name:  "comment",
+								Usage: tr("打印机备注"),
+							},
+							&cli.StringFlag{
+								Name:  "share",
+								Usage: tr("以此共享名共享打印机, 为空则取消共享"),
+							},
+							&cli.StringFlag{
+								Name:  "separator-file",
+								Usage: tr("每个作业前打印的分隔页文件, 为空则不打印"),
+							},
+							&cli.StringFlag{
+								Name:  "devmode",
+								Usage: tr("printer devmode dump 导出的DEVMODE文件, 设为默认设置"),
+							},
+						},
+						Name:      "set",
+						Category:  tr(adminCategory),
+						Usage:     tr("修改打印机的位置, 备注, 共享名, 分隔页或默认DEVMODE, 未指定的属性保持不变"),
+						ArgsUsage: tr("<打印机>"),
+						Before:    app.printerAdminOnly("printer set"),
+						Action:    app.SetPrinterConfig,
+					},
+					{
+						Name:      "pause",
+						Category:  tr(adminCategory),
+						Usage:     tr("暂停打印队列, 作业仍可提交, 恢复后打印"),
+						ArgsUsage: tr("<打印机> | --all | --group <组>"),
+						Before:    app.printerAdminOnly("printer pause"),
+						Flags:     bulkFlags(),
+						Action:    app.ControlPrinter(app.spool.PausePrinter, tr("已暂停")),
+					},
+					{
+						Name:      "resume",
+						Category:  tr(adminCategory),
+						Usage:     tr("恢复已暂停的打印队列"),
+						ArgsUsage: tr("<打印机> | --all | --group <组>"),
+						Before:    app.printerAdminOnly("printer resume"),
+						Flags:     bulkFlags(),
+						Action:    app.ControlPrinter(app.spool.ResumePrinter, tr("已恢复")),
+					},
+					{
+						Name:      "purge",
+						Category:  tr(adminCategory),
+						Usage:     tr("删除打印队列中的所有作业, 包括正在打印的作业"),
+						ArgsUsage: tr("<打印机> | --all | --group <组>"),
+						Before:    app.printerAdminOnly("printer purge"),
+						Flags:     bulkFlags(),
+						Action:    app.ControlPrinter(app.spool.PurgePrinter, tr("已清空")),
+					},
+					{
+						Name:     "devmode",
+						Category: tr(adminCategory),
+						Usage:    tr("导出或导入打印机的默认设置 (DEVMODE), 无需打开驱动程序对话框"),
+						Subcommands: []*cli.Command{
+							{
+								Flags: []cli.Flag{
+									&cli.StringFlag{
+										Name:    "file",
+										Aliases: []string{"f"},
+										Usage:   tr("写入文件, 默认输出到标准输出"),
+									},
+								},
+								Name:      "dump",
+								Usage:     tr("导出打印机的默认DEVMODE"),
+								ArgsUsage: tr("<打印机>"),
+								Action:    app.DumpDevMode,
+							},
+							{
+								Name:      "apply",
+								Usage:     tr("将导出的DEVMODE设为打印机的默认设置, 驱动程序及版本须相同"),
+								ArgsUsage: tr("<打印机> <文件>"),
+								Before:    app.printerAdminOnly("printer devmode apply"),
+								Action:    app.ApplyDevMode,
+							},
+							{
+								Name:      "presets",
+								Usage:     tr("列出 printer capture-devmode 保存的DEVMODE预设"),
+								ArgsUsage: tr("<打印机>"),
+								Action:    app.ListDevModePresets,
+							},
+							{
+								Name:      "delete-preset",
+								Usage:     tr("删除DEVMODE预设"),
+								ArgsUsage: tr("<打印机> <预设>"),
+								Action:    app.DeleteDevModePreset,
+							},
+						},
+					},
+				},
+			},
+			{
+				Name:     "port",
+				Category: tr(adminCategory),
+				Usage:    tr("打印机端口"),
+				Subcommands: []*cli.Command{
+					{
+						Name:     "ls",
+						Category: tr(userCategory),
+						Usage:    tr("获取端口列表"),
+						Action:   app.ListPorts,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "ip",
+								Required: true,
+								Usage:    tr("打印机的IP地址或主机名"),
+							},
+							&cli.StringFlag{
+								Name:  "name",
+								Usage: tr("端口名称, 默认为 IP_<地址>"),
+							},
+							&cli.BoolFlag{
+								Name:  "raw",
+								Usage: tr("以RAW协议打印, 默认端口号 9100 (默认)"),
+							},
+							&cli.StringFlag{
+								Name:  "lpr-queue",
+								Usage: tr("以LPR协议打印到此队列, 默认端口号 515"),
+							},
+							&cli.UintFlag{
+								Name:  "port-number",
+								Usage: tr("端口号, 默认按协议"),
+							},
+							&cli.StringFlag{
+								Name:  "snmp-community",
+								Usage: tr("启用SNMP状态查询的团体名"),
+							},
+						},
+						Name:     "add",
+						Category: tr(adminCategory),
+						Usage:    tr("添加标准 TCP/IP 端口, 供 printer add --port 使用"),
+						Before:   app.serverAdminOnly("port add"),
+						Action:   app.AddPort,
+					},
+				},
+			},
+			{
+				Name:     "form",
+				Category: tr(adminCategory),
+				Usage:    tr("表单, 打印服务器的纸张尺寸"),
+				Subcommands: []*cli.Command{
+					{
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "user",
+								Usage: tr("只列出用户添加的表单"),
+							},
+						},
+						Name:     "ls",
+						Category: tr(userCategory),
+						Usage:    tr("获取表单列表"),
+						Action:   app.ListForms,
+					},
+					{
+						Name:      "add",
+						Category:  tr(adminCategory),
+						Usage:     tr("添加自定义纸张尺寸, 如标签纸, 打印机的纸张尺寸随之包含该表单"),
+						ArgsUsage: tr("<表单> <宽x高, 毫米>"),
+						Before:    app.serverAdminOnly("form add"),
+						Action:    app.AddForm,
+					},
+					{
+						Name:      "rm",
+						Category:  tr(adminCategory),
+						Usage:     tr("删除用户添加的表单"),
+						ArgsUsage: tr("<表单>"),
+						Before:    app.serverAdminOnly("form rm"),
+						Action:    app.DeleteForm,
+					},
+				},
+			},
+			{
+				Name:     "job",
+				Category: tr(userCategory),
+				Usage:    tr("作业"),
+				Subcommands: []*cli.Command{
+					{
+						Flags: []cli.Flag{
+							&cli.StringSliceFlag{
+								Name:    "filename",
+								Aliases: []string{"f"},
+								Usage:   tr("文件路径或 http(s) 网页地址; - 从标准输入读取. 可指定多次, 或使用 *.pdf 等模式, 按顺序逐个提交"),
+							},
+							&cli.BoolFlag{
+								Name:  "merge",
+								Usage: tr("多个文件合并为一个作业: PDF, PostScript 和网页经 Ghostscript 合并, --raw 文件依次拼接"),
+							},
+							&cli.StringFlag{
+								Name:  "template",
+								Usage: tr("代替 --filename, 用配置文件 templates 中的模板生成文档, 例如送货单"),
+							},
+							&cli.StringFlag{
+								Name:  "data",
+								Usage: tr("--template 模板的 JSON 数据文件"),
+							},
+							&cli.StringFlag{
+								Name:    "printer",
+								Aliases: []string{"p"},
+								Usage:   tr("打印机名称, 默认为当前用户的默认打印机"),
+							},
+							&cli.StringFlag{
+								Name:  "ticket",
+								Usage: tr("作业票据 JSON 文件"),
+							},
+							&cli.BoolFlag{
+								Name:  "strict",
+								Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+							},
+							&cli.StringFlag{
+								Name:  "pages",
+								Usage: tr("打印页码范围, 例如 1-3,7,9-, 覆盖作业票据中的 page_range"),
+							},
+							&cli.StringFlag{
+								Name:  "tray",
+								Usage: tr("纸盒, 类型 (如 upper, lower, manual) 或 printer inspect 列出的 vendor_id, 覆盖作业票据中的 media_source"),
+							},
+							&cli.StringFlag{
+								Name:  "margins",
+								Usage: tr("页边距, 单位毫米, 如 10, 10,5 或 10,5,8,5 (上, 右, 下, 左), 页面缩放到页边距以内, 覆盖作业票据中的 margins"),
+							},
+							&cli.IntFlag{
+								Name:  "scale",
+								Usage: tr("按百分比缩放页面, 从页边距左上角开始打印, 不自动适应纸张, 覆盖作业票据中的 scale"),
+							},
+							&cli.StringFlag{
+								Name:  "nup",
+								Usage: tr("每面打印的页数 2, 4 或 6, 可加排列顺序, 例如 4:down-then-right, 覆盖作业票据中的 n_up"),
+							},
+							&cli.BoolFlag{
+								Name:  "booklet",
+								Usage: tr("按骑马钉顺序每面打印两页, 短边双面打印, 对折后即成小册子, 覆盖作业票据中的 booklet"),
+							},
+							&cli.StringFlag{
+								Name:  "at",
+								Usage: tr("提交作业但暂不打印, 到指定时间再打印, 如 22:00 (下一个 22:00), 2006-01-02 22:00 或 RFC 3339 时间, 覆盖作业票据中的 hold_until; 后台打印程序最多保留一天, 更久需提交到带作业队列的守护进程"),
+							},
+							&cli.StringFlag{
+								Name:  "after",
+								Usage: tr("提交作业但暂不打印, 经过指定时长再打印, 如 30m 或 8h, 覆盖作业票据中的 hold_until"),
+							},
+							&cli.BoolFlag{
+								Name:  "hold",
+								Usage: tr("提交作业但暂停, 直到用 job release 释放, 覆盖作业票据中的 hold"),
+							},
+							&cli.StringFlag{
+								Name:  "pin",
+								Usage: tr("保留作业, 可用 4 到 12 位数字的 PIN 在 job release 或服务器 API 释放, 需要配置 held_jobs_file"),
+							},
+							&cli.StringFlag{
+								Name:  "devmode",
+								Usage: tr("以 printer devmode dump 导出的DEVMODE文件为作业的初始设置, 带有装订, 打孔等仅驱动程序支持的设置, 作业票据的选项仍然适用"),
+							},
+							&cli.StringFlag{
+								Name:  "devmode-preset",
+								Usage: tr("以 printer capture-devmode 保存的DEVMODE预设为作业的初始设置, 需要配置 devmode_presets_dir"),
+							},
+							&cli.BoolFlag{
+								Name:  "progress",
+								Usage: tr("在标准错误输出显示渲染页数和缓冲字节数"),
+							},
+							&cli.StringFlag{
+								Name:  "proof",
+								Usage: tr("不打印, 按打印机的纸张, 分辨率和作业票据渲染到 .pdf 文件, 或每面一个 .png 文件 (如 proof-1.png), 用于核对版式"),
+							},
+							&cli.StringFlag{
+								Name:  "output-file",
+								Usage: tr("打印到文件而不是打印机端口, 例如 Microsoft Print to PDF 的 PDF 文件, 不弹出文件名对话框"),
+							},
+							&cli.BoolFlag{
+								Name:  "raw",
+								Usage: tr("不经渲染, 将文件原样发送到打印机, 用于 ZPL, EPL, ESC/POS 等打印机指令"),
+							},
+							&cli.StringFlag{
+								Name:  "datatype",
+								Value: "RAW",
+								Usage: tr("--raw 作业的后台打印数据类型"),
+							},
+						},
+						Name:   "add",
+						Usage:  tr("添加打印作业"),
+						Action: app.AddJob,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "filename",
+								Aliases: []string{"f"},
+								Usage:   tr("文件路径或 http(s) 网页地址"),
+							},
+							&cli.StringFlag{
+								Name:    "printer",
+								Aliases: []string{"p"},
+								Usage:   tr("打印机名称, 默认为当前用户的默认打印机"),
+							},
+							&cli.StringFlag{
+								Name:  "ticket",
+								Usage: tr("作业票据 JSON 文件"),
+							},
+							&cli.BoolFlag{
+								Name:  "strict",
+								Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+							},
+							&cli.StringFlag{
+								Name:  "pages",
+								Usage: tr("打印页码范围, 例如 1-3,7,9-, 覆盖作业票据中的 page_range"),
+							},
+							&cli.StringFlag{
+								Name:  "tray",
+								Usage: tr("纸盒, 类型 (如 upper, lower, manual) 或 printer inspect 列出的 vendor_id, 覆盖作业票据中的 media_source"),
+							},
+							&cli.StringFlag{
+								Name:  "margins",
+								Usage: tr("页边距, 单位毫米, 如 10, 10,5 或 10,5,8,5 (上, 右, 下, 左), 覆盖作业票据中的 margins"),
+							},
+							&cli.IntFlag{
+								Name:  "scale",
+								Usage: tr("按百分比缩放页面, 覆盖作业票据中的 scale"),
+							},
+							&cli.StringFlag{
+								Name:  "nup",
+								Usage: tr("每面打印的页数 2, 4 或 6, 可加排列顺序, 覆盖作业票据中的 n_up"),
+							},
+							&cli.BoolFlag{
+								Name:  "booklet",
+								Usage: tr("按小册子打印, 覆盖作业票据中的 booklet"),
+							},
+						},
+						Name:   "simulate",
+						Usage:  tr("不打印, 按打印机和作业票据计算打印页数, 纸张数和费用"),
+						Action: app.SimulateJob,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "filename",
+								Aliases: []string{"f"},
+								Usage:   tr("文件路径或 http(s) 网页地址"),
+							},
+							&cli.StringFlag{
+								Name:    "printer",
+								Aliases: []string{"p"},
+								Usage:   tr("打印机名称, 默认为当前用户的默认打印机"),
+							},
+							&cli.StringFlag{
+								Name:  "ticket",
+								Usage: tr("作业票据 JSON 文件"),
+							},
+							&cli.BoolFlag{
+								Name:  "strict",
+								Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+							},
+							&cli.StringFlag{
+								Name:  "pages",
+								Usage: tr("打印页码范围, 例如 1-3,7,9-, 覆盖作业票据中的 page_range"),
+							},
+							&cli.StringFlag{
+								Name:  "tray",
+								Usage: tr("纸盒, 类型 (如 upper, lower, manual) 或 printer inspect 列出的 vendor_id, 覆盖作业票据中的 media_source"),
+							},
+							&cli.StringFlag{
+								Name:  "margins",
+								Usage: tr("页边距, 单位毫米, 如 10, 10,5 或 10,5,8,5 (上, 右, 下, 左), 覆盖作业票据中的 margins"),
+							},
+							&cli.IntFlag{
+								Name:  "scale",
+								Usage: tr("按百分比缩放页面, 覆盖作业票据中的 scale"),
+							},
+							&cli.StringFlag{
+								Name:  "nup",
+								Usage: tr("每面打印的页数 2, 4 或 6, 可加排列顺序, 覆盖作业票据中的 n_up"),
+							},
+							&cli.BoolFlag{
+								Name:  "booklet",
+								Usage: tr("按小册子打印, 覆盖作业票据中的 booklet"),
+							},
+						},
+						Name:   "preflight",
+						Usage:  tr("打印前检查 PDF: 是否加密, 损坏, 没有页面或页面尺寸无效, 并报告页数, 页面尺寸, 是否缩放和预计纸张数"),
+						Action: app.PreflightJob,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "printer",
+								Aliases: []string{"p"},
+								Usage:   tr("打印机名称, 默认为当前用户的默认打印机"),
+							},
+							&cli.StringFlag{
+								Name:  "ticket",
+								Usage: tr("作业票据 JSON 文件"),
+							},
+							&cli.BoolFlag{
+								Name:  "strict",
+								Usage: tr("严格解析作业票据, 拒绝未知字段和超出范围的值"),
+							},
+							&cli.BoolFlag{
+								Name:  "exclusive",
+								Usage: tr("提交期间暂停队列, 保证批次作业连续打印, 不与其他用户作业交错, 需要管理员权限"),
+							},
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Value: 5 * time.Minute,
+								Usage: tr("队列最长暂停时间"),
+							},
+						},
+						Name:      "batch",
+						Usage:     tr("按顺序批量添加打印作业"),
+						ArgsUsage: tr("<文件> [文件...]"),
+						Action:    app.AddBatchJob,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:    "printer",
+								Aliases: []string{"p"},
+								Usage:   tr("打印机名称, 默认为当前用户的默认打印机"),
+							},
+							&cli.StringFlag{
+								Name:     "data",
+								Required: true,
+								Usage:    tr("字段值 JSON 文件, 例如 {\"customer\": \"...\", \"items\": \"...\"}"),
+							},
+						},
+						Name:   "form",
+						Usage:  tr("按配置文件中打印机的 escp 版式在针式打印机上套打表单"),
+						Action: app.AddFormJob,
+					},
+					{
+
+						Name:   "status",
+						Usage:  tr("打印作业状态"),
+						Action: app.StatusJob,
+					},
+					{
+
+						Name:   "ls",
+						Usage:  tr("打印机作业列表"),
+						Action: app.ListJob,
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "mine",
+								Usage: tr("只列出当前用户的作业"),
+							},
+							&cli.BoolFlag{
+								Name:  "detailed",
+								Usage: tr("列出提交时间, 页数, DEVMODE 和所有者 SID 等详细信息"),
+							},
+						},
+					},
+					{
+						Name:      "watch",
+						Usage:     tr("跟踪打印作业状态, 直到作业完成; 作业中止时以 1 退出, 超时以 2 退出"),
+						ArgsUsage: tr("<打印机> <作业ID>"),
+						Action:    app.WatchJob,
+						Flags: []cli.Flag{
+							&cli.DurationFlag{
+								Name:  "timeout",
+								Usage: tr("最长等待时间, 默认一直等待"),
+							},
+							&cli.DurationFlag{
+								Name:  "interval",
+								Value: 2 * time.Second,
+								Usage: tr("轮询间隔, 用于补充作业通知"),
+							},
+						},
+					},
+					{
+						Name:      "cancel",
+						Usage:     tr("取消打印作业"),
+						ArgsUsage: tr("<打印机> <作业ID>"),
+						Action:    app.CancelJob,
+					},
+					{
+						Name:      "prio",
+						Usage:     fmt.Sprintf(tr("修改作业优先级 (%d 到 %d, 默认 %d), 优先级高的作业先打印"), lib.JobPriorityMin, lib.JobPriorityMax, lib.JobPriorityDefault),
+						ArgsUsage: tr("<打印机> <作业ID> <优先级>"),
+						Action:    app.SetJobPriority,
+					},
+					{
+						Name:      "print-now",
+						Category:  tr(adminCategory),
+						Usage:     tr("立即打印在打印时间段之外提交而被保留的作业"),
+						ArgsUsage: tr("<打印机> <作业ID>"),
+						Before:    app.printerAdminOnly("job print-now"),
+						Action:    app.PrintJobNow,
+					},
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "pin",
+								Usage: tr("用作业的 PIN 释放, 不需要管理员权限"),
+							},
+						},
+						Name:      "release",
+						Usage:     tr("释放 job add --hold 保留的作业, 开始打印; 不带 --pin 时需要是作业的提交者或管理员"),
+						ArgsUsage: tr("<打印机> <作业ID>"),
+						Action:    app.ReleaseHeldJob,
+					},
+					{
+						Name:   "held",
+						Usage:  tr("列出 job add --hold 保留, 等待释放的作业"),
+						Action: app.ListHeldJobs,
+					},
+				},
+			},
+			{
+				Name:     "ticket",
+				Category: tr(userCategory),
+				Usage:    tr("作业票据"),
+				Subcommands: []*cli.Command{
+					{
+						Name:      "validate",
+						Usage:     tr("严格校验作业票据"),
+						ArgsUsage: tr("<文件>"),
+						Action:    app.ValidateTicket,
+					},
+					{
+						Name:   "schema",
+						Usage:  tr("输出作业票据 JSON schema"),
+						Action: app.TicketSchema,
+					},
+				},
+			},
+			{
+				Name:     "accounting",
+				Category: tr(adminCategory),
+				Usage:    tr("计费记录, 由守护进程和 serve 写入 accounting.db_file"),
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "from",
+						Usage: tr("起始日期, 如 2024-01-01"),
+					},
+					&cli.StringFlag{
+						Name:  "to",
+						Usage: tr("截止日期, 包含当天"),
+					},
+				},
+				Subcommands: []*cli.Command{
+					{
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "by",
+								Value: "user",
+								Usage: tr("按 user 或 printer 汇总"),
+							},
+						},
+						Name:   "report",
+						Usage:  tr("按用户或打印机汇总作业和页数"),
+						Action: app.AccountingReport,
+					},
+					{
+						Name:   "export",
+						Usage:  tr("导出作业记录为 CSV"),
+						Action: app.AccountingExport,
+					},
+				},
+			},
+			// ===========================
+			{
+				Name:     "printers",
+				Category: tr(userCategory),
+				Usage:    tr("获取打印机列表"),
+				Action:   app.ListPrinter,
+			},
+		},
+		After: func(context *cli.Context) error {
+			//printerManager.Quit()
+			return nil
+		},
+	}
+	app.withConfig("", cliApp.Commands)
+	return cliApp
+}
+
+// Commands that run without the config file, so that a bad one doesn't
+// keep them from working.
+var configFreeCommands = map[string]bool{
+	"version":           true,
+	"service install":   true,
+	"service uninstall": true,
+	"service start":     true,
+	"service stop":      true,
+}
+
+// withConfig has the commands load the config file before they run, and
+// before their own Before, apart from configFreeCommands. Help is shown
+// without it.
+func (a *App) withConfig(parent string, commands []*cli.Command) {
+	for _, command := range commands {
+		name := strings.TrimSpace(parent + " " + command.Name)
+		if len(command.Subcommands) > 0 {
+			a.withConfig(name, command.Subcommands)
+			continue
+		}
+		if command.Action == nil || configFreeCommands[name] {
+			continue
+		}
+		before := command.Before
+		command.Before = func(c *cli.Context) error {
+			if err := a.LoadConfig(c); err != nil {
+				return err
+			}
+			if before != nil {
+				return before(c)
+			}
+			return nil
+		}
+	}
+}
+
+// Blocks until Ctrl-C or SIGTERM.
+func waitIndefinitely() {
+	ch := make(chan os.Signal)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	<-ch
+
+	go func() {
+		// In case the process doesn't die quickly, wait for a second termination request.
+		<-ch
+		fmt.Println("Second termination request received")
+		os.Exit(1)
+	}()
+}
+
+func main() {
+	// The language is needed before the flags are parsed, for usage.
+	language = lib.DetectLanguage(os.Args[1:], os.Getenv, lib.LanguageChinese)
+	err := NewApp().Run(os.Args)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func OutputPrintList(printers []lib.Printer) {
+	t := tabby.New()
+	t.AddHeader(tr("名称"), tr("名称2"), tr("驱动"), tr("状态"))
+	for _, printer := range printers {
+		t.AddLine(printer.Name, printer.DefaultDisplayName, printer.Model, printer.State.State)
+	}
+	t.Print()
+}
+
+func OutputDiscoveredPrinters(printers []lib.DiscoveredPrinter) {
+	t := tabby.New()
+	t.AddHeader(tr("名称"), tr("来源"), tr("地址"), tr("型号"), tr("地点"))
+	for _, p := range printers {
+		t.AddLine(p.Name, p.Source, p.URI, p.Model, p.Location)
 	}
 	t.Print()
 }
 
 func OutputJobList(jobs []winspool.Job) {
 	t := tabby.New()
-	t.AddHeader("作业ID", "打印机名称", "打印类型", "状态")
+	t.AddHeader(tr("作业ID"), tr("打印机名称"), tr("用户"), tr("打印类型"), tr("状态"), tr("位置"), tr("优先级"))
 	for _, printer := range jobs {
-		t.AddLine(printer.JobID, printer.PrinterName, printer.Datatype, printer.Status)
+		t.AddLine(printer.JobID, printer.PrinterName, printer.UserName, printer.Datatype, lib.JobStatusString(printer.Status), printer.Position, printer.Priority)
 	}
 	t.Print()
 }
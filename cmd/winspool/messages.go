@@ -0,0 +1,382 @@
+package main
+
+import (
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// language is the language of messages, set by main from --lang or the
+// environment before the commands are built.
+var language = lib.LanguageChinese
+
+// tr translates a message of the command line, written in Chinese, to the
+// language of messages.
+func tr(message string) string {
+	return messages.Translate(language, message)
+}
+
+// messages are the translations of the messages of the command line, keyed
+// by the Chinese the source is written in. Messages missing from a catalog
+// are shown in Chinese.
+var messages = lib.Messages{
+	lib.LanguageEnglish: {
+		"用户命令": "User commands",
+		"管理命令": "Admin commands",
+		"accounting.quotas 需要配置 accounting.db_file": "accounting.quotas needs accounting.db_file to be configured",
+		"没有默认打印机":                                   "No default printer",
+		"请输入打印机名称":                                  "Please enter a printer name",
+		"默认打印机已设置为 %s\n":                            "Default printer set to %s\n",
+		"请输入打印机名称, 或使用 --all 或 --group":             "Please enter a printer name, or use --all or --group",
+		"打印机 %s %s\n":                               "Printer %s %s\n",
+		"所有打印机":                                     "All printers",
+		"配置文件 printer_groups 中的打印机组":                "Printer group of printer_groups in the config file",
+		"同时操作的打印机数":                                 "Number of printers operated on at once",
+		"--all 和 --group 不能同时使用":                    "--all and --group can't be used together",
+		"打印机":                                       "Printer",
+		"结果":                                        "Result",
+		"耗时":                                        "Time",
+		"失败: ":                                      "failed: ",
+		"%d 台打印机中 %d 台失败":                           "%[2]d of %[1]d printers failed",
+		"请输入打印机名称和预设名称":                             "Please enter a printer name and a preset name",
+		"请在配置文件中设置 devmode_presets_dir":             "Please set devmode_presets_dir in the config file",
+		"已保存打印机 %s 的DEVMODE预设 %s\n":                 "Saved DEVMODE preset %[2]s of printer %[1]s\n",
+		"请输入打印机名称和DEVMODE文件":                        "Please enter a printer name and a DEVMODE file",
+		"DEVMODE文件 %s 无效: %s":                       "Invalid DEVMODE file %s: %s",
+		"%s: 请使用同一驱动程序及版本的打印机导出的DEVMODE":         "%s: use a DEVMODE exported from a printer with the same driver and version",
+		"打印机 %s 的默认设置已更新\n":                      "Default settings of printer %s updated\n",
+		"请输入两台打印机名称":                             "Please enter two printer names",
+		"没有可用打印机":                                "No printers available",
+		"打印机 %s 不存在":                             "Printer %s doesn't exist",
+		"两台打印机的能力相同":                             "The two printers have the same capabilities",
+		"能力":                                     "Capability",
+		"仅 ":                                     "Only ",
+		"默认 ":                                    "Default ",
+		"打印机不存在":                                 "Printer doesn't exist",
+		"--filename 和 --template 只能指定一个":         "Only one of --filename and --template can be given",
+		"文件名不能为空":                                "File name can't be empty",
+		"文件 %s 不存在":                              "File %s doesn't exist",
+		"标准输入只能读取一次":                             "Standard input can only be read once",
+		"--raw 作业不经渲染, 不能与 --proof 一起使用":         "--raw jobs aren't rendered and can't be used with --proof",
+		"--output-file 不能与 --raw 或 --proof 一起使用": "--output-file can't be used with --raw or --proof",
+		"多个文件只能与 --merge 一起使用 --proof 或 --output-file":                                        "Several files can only be used with --proof or --output-file together with --merge",
+		"--raw 作业没有作业票据, 不能与 --at, --after, --hold, --pin, --devmode 或 --devmode-preset 一起使用": "--raw jobs have no job ticket and can't be used with --at, --after, --hold, --pin, --devmode or --devmode-preset",
+		"无效的文件名模式 %s: %s":                                           "Invalid file name pattern %s: %s",
+		"没有匹配 %s 的文件":                                               "No files match %s",
+		"--at 和 --after 只能指定一个":                                     "Only one of --at and --after can be given",
+		"--devmode 和 --devmode-preset 只能指定一个":                       "Only one of --devmode and --devmode-preset can be given",
+		"--after %q 不是有效的时长, 例如 30m 或 8h":                           "--after %q isn't a valid duration, such as 30m or 8h",
+		"--at %q 不是有效的时间, 例如 22:00, 2006-01-02 22:00 或 RFC 3339 时间": "--at %q isn't a valid time, such as 22:00, 2006-01-02 22:00 or an RFC 3339 time",
+		"打印机 %s 不存在: %s":                                            "Printer %s doesn't exist: %s",
+		"打印时才能确定":                                                   "known when printed",
+		"项目":                                                        "Item",
+		"值":                                                         "Value",
+		"文档类型":                                                      "Document type",
+		"文档页数":                                                      "Document pages",
+		"打印页数":                                                      "Printed pages",
+		"份数":                                                        "Copies",
+		"打印面数":                                                      "Sides printed",
+		"纸张数":                                                       "Sheets",
+		"纸张":                                                        "Paper",
+		"彩色":                                                        "Color",
+		"双面":                                                        "Duplex",
+		"每面页数":                                                      "Pages per side",
+		"费用":                                                        "Cost",
+		"警告":                                                        "Warning",
+		"配置文件中没有模板 %s":                                              "No template %s in the config file",
+		"数据文件 %s 无效: %s":                                            "Invalid data file %s: %s",
+		"\r作业 %d: 已渲染 %d/%s 页, 已缓冲 %d KB": "\rJob %d: rendered %d/%s pages, buffered %d KB",
+		"标准输入为空":                                   "Standard input is empty",
+		"--raw 不支持网页地址":                            "--raw doesn't support web addresses",
+		"字段值文件 %s 无效: %s":                          "Invalid field values file %s: %s",
+		"--exclusive 暂停打印队列":                       "Pausing the queue with --exclusive",
+		"%s需要管理员权限, 请以管理员身份运行":                     "%s needs administrator rights, please run as administrator",
+		"%s: 需要管理员权限, 请以管理员身份运行":                   "%s: administrator rights needed, please run as administrator",
+		"%s需要打印机 %s 的管理权限":                         "%s needs the right to administer printer %s",
+		"%s需要打印服务器的管理权限":                           "%s needs the right to administer the print server",
+		"%s: 后台打印服务未运行或没有响应, 请检查 Print Spooler 服务": "%s: the print spooler isn't running or doesn't answer, check the Print Spooler service",
+		"%s: 超出打印配额, 请联系管理员":                       "%s: print quota exceeded, please contact the administrator",
+		"%s: 刚刚已提交相同的作业, 未重复打印":                    "%s: the same job was just submitted, it wasn't printed again",
+		"打印机不能为空, 且没有默认打印机":                        "Printer is empty, and there is no default printer",
+		"请输入作业票据文件":                                "Please enter a job ticket file",
+		"作业票据有效":                                   "Job ticket is valid",
+		"jobID 错误":                                 "Invalid jobID",
+		"作业ID":                                     "Job ID",
+		"状态":                                       "Status",
+		"已打印页数":                                    "Pages printed",
+		"总页数":                                      "Total pages",
+		"已缓冲字节":                                    "Bytes buffered",
+		"--interval 必须大于 0":                        "--interval must be greater than 0",
+		"无法订阅作业通知, 改为轮询: %s":                       "Can't subscribe to job notifications, polling instead: %s",
+		"等待作业 %d 超时":                               "Timed out waiting for job %d",
+		"作业 %d 已中止":                                "Job %d aborted",
+		"作业 %d 已取消\n":                              "Job %d canceled\n",
+		"优先级应为 %d 到 %d":                            "Priority must be %d to %d",
+		"作业 %d 的优先级已改为 %d\n":                       "Priority of job %d changed to %d\n",
+		"作业 %d 将立即打印\n":                            "Job %d will print now\n",
+		"%s: PIN 错误":                               "%s: wrong PIN",
+		"%s: 作业未保留, 或已释放":                          "%s: the job isn't held, or was already released",
+		"作业 %d 已释放, 开始打印\n":                        "Job %d released, printing\n",
+		"配置文件中没有 held_jobs_file":                   "No held_jobs_file in the config file",
+		"文档":                                       "Document",
+		"用户":                                       "User",
+		"提交时间":                                     "Submitted",
+		"resume_held_jobs_on_arrival 恢复挂起作业":       "resume_held_jobs_on_arrival resuming held jobs",
+		"守护进程已启动, 共 %d 台打印机":                       "Daemon started, %d printers",
+		"打印机 %s: %s":                               "Printer %s: %s",
+		"无法订阅打印事件, 不记录打印机指标和 SLA, 也不推送事件: %s": "Can't subscribe to print events; printer metrics, SLAs and event pushes are off: %s",
+		"保存打印机指标失败: %s":                  "Failed to save printer metrics: %s",
+		"守护进程已退出, 后台打印服务调用统计: %s":        "Daemon exited, print spooler call statistics: %s",
+		"打开计费记录失败: %s":                   "Failed to open accounting records: %s",
+		"关闭计费记录失败: %s":                   "Failed to close accounting records: %s",
+		"写入事件失败: %s":                     "Failed to write event: %s",
+		"SLA 告警: %s":                     "SLA alert: %s",
+		"发送 SLA 告警失败: %s":                "Failed to send SLA alert: %s",
+		"打印作业 %s 失败: %s":                 "Printing job %s failed: %s",
+		"作业 %s 的诊断包: %s":                 "Diagnostics bundle of job %s: %s",
+		"作业 %s 无法加入队列: %s":               "Job %s can't be queued: %s",
+		"作业队列已停止: %s":                    "Job queue stopped: %s",
+		"关闭作业队列失败: %s":                   "Failed to close the job queue: %s",
+		"写入作业 %s 的诊断包失败: %s":             "Failed to write the diagnostics bundle of job %s: %s",
+		"作业 %s 已提交到打印机 %s, 作业ID %d":      "Job %s submitted to printer %s, job ID %d",
+		"作业 %d %s":                       "Job %d %s",
+		" 已打印 %d 页":                      " printed %d pages",
+		"未配置 metrics_file":               "metrics_file isn't configured",
+		"队列":                             "Queue",
+		"作业/小时":                          "Jobs/hour",
+		"首页平均耗时":                         "Avg. first page",
+		"失败率":                            "Failure rate",
+		"最大队列":                           "Max. queue",
+		"完成":                             "Done",
+		"失败":                             "Failed",
+		"未配置 accounting.db_file":         "accounting.db_file isn't configured",
+		"无效的 --from: %s":                 "Invalid --from: %s",
+		"无效的 --to: %s":                   "Invalid --to: %s",
+		"无效的 --by %q, 可选 user 或 printer": "Invalid --by %q, user or printer",
+		"作业":                "Jobs",
+		"页数":                "Pages",
+		"大小":                "Size",
+		"彩色页数":              "Color pages",
+		"--mdns 需要 --ipp":   "--mdns needs --ipp",
+		"--listen 端口 %q 无效": "Invalid --listen port %q",
+		"mDNS 广播失败: %s":     "mDNS advertising failed: %s",
+		"HTTP 服务监听 %s":      "HTTP service listening on %s",
+		"gRPC 服务监听 %s":      "gRPC service listening on %s",
+		"协调服务监听 %s":         "Coordinator listening on %s",
+		"打印机操作命令行程序":        "Command line printer operations",
+		"配置文件路径":            "Config file path",
+		"printer ls, printer stats, job ls, job status 的输出格式, table 或 json; printer watch, job watch 和 daemon 的事件流为 ndjson": "Output format of printer ls, printer stats, job ls, job status: table or json; event streams of printer watch, job watch and daemon are ndjson",
+		"查看版本号": "Show the version",
+		"以守护进程方式运行, 跟踪打印机和作业状态; --output ndjson 时将打印事件逐行写到标准输出": "Run as a daemon tracking printer and job states; with --output ndjson print events are written to standard output, one per line",
+		"将守护进程安装为 Windows 服务并管理, 日志写入事件日志":                      "Install the daemon as a Windows service and manage it, logging to the event log",
+		"服务名称, 也是事件日志源":                     "Service name, also the event log source",
+		"安装服务, 开机自动启动, 使用 --config 指定的配置文件": "Install the service, started at boot, with the config file of --config",
+		"停止并卸载服务":                           "Stop and uninstall the service",
+		"启动服务":                              "Start the service",
+		"停止服务, 等待正在提交的作业":                   "Stop the service, waiting for jobs being submitted",
+		"由服务控制管理器启动":                        "Started by the service control manager",
+		"启动 HTTP REST 服务, 提供打印机, 作业提交, 状态和取消接口": "Start the HTTP REST service, with printer, job submission, status and cancel endpoints",
+		"监听地址": "Listen address",
+		"严格解析作业票据, 拒绝未知字段和超出范围的值":                                                                    "Parse job tickets strictly, refusing unknown fields and out-of-range values",
+		"在 /ipp/print/<打印机名> 以 IPP Everywhere 打印机提供各打印机, 供 Linux, macOS 和移动设备免驱动打印":                  "Serve each printer as an IPP Everywhere printer at /ipp/print/<printer name>, for driverless printing from Linux, macOS and mobile devices",
+		"通过 mDNS/DNS-SD (Bonjour) 在局域网广播 IPP 打印机, 供 AirPrint 客户端自动发现; 需要 --ipp, 且监听地址不能仅为 127.0.0.1": "Advertise the IPP printers on the local network with mDNS/DNS-SD (Bonjour), for AirPrint clients to discover; needs --ipp, and a listen address other than only 127.0.0.1",
+		"以代理方式向协调服务注册打印机, 例如 http://coordinator:8640, 高可用部署时用逗号分隔各实例":                                "Register the printers with a coordinator as an agent, such as http://coordinator:8640, with the instances separated by commas for high availability",
+		"代理在集群中的名称, 默认为主机名":                                                                          "Name of the agent in the cluster, the host name by default",
+		"协调服务访问本代理的地址, 默认为 http://<监听地址>":                                                            "Address the coordinator reaches this agent at, http://<listen address> by default",
+		"启动 gRPC 服务, 提供打印机, 能力, 作业提交, 状态, 事件流和取消接口":                                                  "Start the gRPC service, with printer, capabilities, job submission, status, event stream and cancel calls",
+		"启动集群协调服务, 汇总各代理的打印机并转发请求":                                                                   "Start the cluster coordinator, gathering the printers of the agents and forwarding requests",
+		"高可用部署时的共享租约文件, 各实例通过它选举主实例, 例如 \\\\server\\share\\winspool.lease":                           "Shared lease file for high availability, through which the instances elect the primary, such as \\\\server\\share\\winspool.lease",
+		"租约有效期, 主实例失效后备用实例接管前的最长时间":                                                                  "Lease duration, the longest a standby waits to take over once the primary fails",
+		"共享状态文件, 保存代理注册和作业, 供接管的实例使用":                                                                "Shared state file keeping agent registrations and jobs for the instance that takes over",
+		"实例名称, 默认为主机名":         "Instance name, the host name by default",
+		"打印机操作":                "Printer operations",
+		"获取打印机列表":              "List printers",
+		"打印机队列和吞吐量指标, 由守护进程记录": "Printer queue and throughput metrics, as recorded by the daemon",
+		"[打印机]":                "[printer]",
+		"跟踪打印机和作业事件, 直到中断; --output ndjson 每行输出一条事件记录": "Follow printer and job events until interrupted; --output ndjson writes an event record per line",
+		"通过SNMP读取网络打印机序列号的团体名":                         "SNMP community for reading the serial numbers of network printers",
+		"获取打印机详情": "Show printer details",
+		"将当前用户的打印首选项 (如装订, 打孔) 保存为打印机的DEVMODE预设, 供 job add --devmode-preset 使用; 需要配置 devmode_presets_dir": "Save the current user's printing preferences (such as stapling, hole punching) as a DEVMODE preset of the printer, for job add --devmode-preset; needs devmode_presets_dir to be configured",
+		"<打印机> <预设>": "<printer> <preset>",
+		"以CDD JSON输出打印机的全部能力: 颜色, 双面, 纸张, 分辨率, 纸盒, 驱动的厂商能力等": "Print all the capabilities of a printer as CDD JSON: color, duplex, paper, resolutions, trays, vendor capabilities of the driver and more",
+		"<打印机>": "<printer>",
+		"比较两台打印机的能力: 纸张, 双面, 颜色, 分辨率, 纸盒等": "Compare the capabilities of two printers: paper, duplex, color, resolutions, trays and more",
+		"<打印机A> <打印机B>":               "<printer A> <printer B>",
+		"获取当前用户的默认打印机":                "Show the current user's default printer",
+		"设置当前用户的默认打印机":                "Set the current user's default printer",
+		"暂停打印队列, 作业仍可提交, 恢复后打印":       "Pause a print queue; jobs can still be submitted and print once resumed",
+		"<打印机> | --all | --group <组>": "<printer> | --all | --group <group>",
+		"已暂停":                         "paused",
+		"恢复已暂停的打印队列":                  "Resume a paused print queue",
+		"已恢复":                         "resumed",
+		"删除打印队列中的所有作业, 包括正在打印的作业":     "Delete all the jobs in a print queue, including the one printing",
+		"已清空": "purged",
+		"导出或导入打印机的默认设置 (DEVMODE), 无需打开驱动程序对话框": "Export or import the default settings (DEVMODE) of a printer, without opening the driver dialog",
+		"写入文件, 默认输出到标准输出":                      "File to write, standard output by default",
+		"导出打印机的默认DEVMODE":                      "Export the default DEVMODE of a printer",
+		"将导出的DEVMODE设为打印机的默认设置, 驱动程序及版本须相同":    "Make an exported DEVMODE the default settings of a printer; the driver and its version must be the same",
+		"<打印机> <文件>": "<printer> <file>",
+		"列出 printer capture-devmode 保存的DEVMODE预设": "List the DEVMODE presets saved by printer capture-devmode",
+		"删除DEVMODE预设": "Delete a DEVMODE preset",
+		"文件路径或 http(s) 网页地址; - 从标准输入读取. 可指定多次, 或使用 *.pdf 等模式, 按顺序逐个提交":   "File path or http(s) web address; - reads standard input. Can be given several times, or as a pattern such as *.pdf, submitted one after the other",
+		"多个文件合并为一个作业: PDF, PostScript 和网页经 Ghostscript 合并, --raw 文件依次拼接": "Merge several files into one job: PDF, PostScript and web pages are merged with Ghostscript, --raw files are concatenated",
+		"代替 --filename, 用配置文件 templates 中的模板生成文档, 例如送货单":                 "Instead of --filename, make the document from a template of templates in the config file, such as a delivery note",
+		"--template 模板的 JSON 数据文件":                 "JSON data file of the --template template",
+		"打印机名称, 默认为当前用户的默认打印机":                     "Printer name, the current user's default printer by default",
+		"作业票据 JSON 文件":                             "Job ticket JSON file",
+		"打印页码范围, 例如 1-3,7,9-, 覆盖作业票据中的 page_range": "Pages to print, such as 1-3,7,9-, overriding page_range of the job ticket",
+		"纸盒, 类型 (如 upper, lower, manual) 或 printer inspect 列出的 vendor_id, 覆盖作业票据中的 media_source":                                        "Tray, as a type (such as upper, lower, manual) or a vendor_id listed by printer inspect, overriding media_source of the job ticket",
+		"页边距, 单位毫米, 如 10, 10,5 或 10,5,8,5 (上, 右, 下, 左), 页面缩放到页边距以内, 覆盖作业票据中的 margins":                                                   "Margins in millimeters, such as 10, 10,5 or 10,5,8,5 (top, right, bottom, left); pages are scaled to fit within them, overriding margins of the job ticket",
+		"按百分比缩放页面, 从页边距左上角开始打印, 不自动适应纸张, 覆盖作业票据中的 scale":                                                                                "Scale pages by a percentage, printed from the top left corner of the margins without fitting the paper, overriding scale of the job ticket",
+		"每面打印的页数 2, 4 或 6, 可加排列顺序, 例如 4:down-then-right, 覆盖作业票据中的 n_up":                                                                 "Pages per side, 2, 4 or 6, optionally with the order, such as 4:down-then-right, overriding n_up of the job ticket",
+		"按骑马钉顺序每面打印两页, 短边双面打印, 对折后即成小册子, 覆盖作业票据中的 booklet":                                                                              "Print two pages per side in saddle-stitch order, duplex on the short edge, to fold into a booklet, overriding booklet of the job ticket",
+		"提交作业但暂不打印, 到指定时间再打印, 如 22:00 (下一个 22:00), 2006-01-02 22:00 或 RFC 3339 时间, 覆盖作业票据中的 hold_until; 后台打印程序最多保留一天, 更久需提交到带作业队列的守护进程": "Submit the job without printing it until a time, such as 22:00 (the next 22:00), 2006-01-02 22:00 or an RFC 3339 time, overriding hold_until of the job ticket; the spooler keeps jobs a day at most, longer needs a daemon with a job queue",
+		"提交作业但暂不打印, 经过指定时长再打印, 如 30m 或 8h, 覆盖作业票据中的 hold_until":                                                                         "Submit the job without printing it until a duration passed, such as 30m or 8h, overriding hold_until of the job ticket",
+		"提交作业但暂停, 直到用 job release 释放, 覆盖作业票据中的 hold":                                                                                    "Submit the job paused until it is released with job release, overriding hold of the job ticket",
+		"保留作业, 可用 4 到 12 位数字的 PIN 在 job release 或服务器 API 释放, 需要配置 held_jobs_file":                                                       "Hold the job, to be released with a PIN of 4 to 12 digits with job release or the server API; needs held_jobs_file to be configured",
+		"以 printer devmode dump 导出的DEVMODE文件为作业的初始设置, 带有装订, 打孔等仅驱动程序支持的设置, 作业票据的选项仍然适用":                                                 "Start the job from a DEVMODE file exported by printer devmode dump, with settings only the driver supports such as stapling or hole punching; the options of the job ticket still apply",
+		"以 printer capture-devmode 保存的DEVMODE预设为作业的初始设置, 需要配置 devmode_presets_dir":                                                      "Start the job from a DEVMODE preset saved by printer capture-devmode; needs devmode_presets_dir to be configured",
+		"在标准错误输出显示渲染页数和缓冲字节数":                                                                                                           "Show the pages rendered and bytes buffered on standard error",
+		"不打印, 按打印机的纸张, 分辨率和作业票据渲染到 .pdf 文件, 或每面一个 .png 文件 (如 proof-1.png), 用于核对版式":                                                      "Don't print: render to a .pdf file, or a .png file per side (such as proof-1.png), with the paper and resolution of the printer and the job ticket, to check the layout",
+		"打印到文件而不是打印机端口, 例如 Microsoft Print to PDF 的 PDF 文件, 不弹出文件名对话框":                                                                  "Print to a file instead of the printer port, such as the PDF file of Microsoft Print to PDF, without the file name dialog",
+		"不经渲染, 将文件原样发送到打印机, 用于 ZPL, EPL, ESC/POS 等打印机指令":                                                                                "Send the file to the printer as-is, without rendering, for printer languages such as ZPL, EPL and ESC/POS",
+		"--raw 作业的后台打印数据类型":  "Spool data type of --raw jobs",
+		"添加打印作业":             "Add a print job",
+		"文件路径或 http(s) 网页地址": "File path or http(s) web address",
+		"页边距, 单位毫米, 如 10, 10,5 或 10,5,8,5 (上, 右, 下, 左), 覆盖作业票据中的 margins": "Margins in millimeters, such as 10, 10,5 or 10,5,8,5 (top, right, bottom, left), overriding margins of the job ticket",
+		"按百分比缩放页面, 覆盖作业票据中的 scale":                                        "Scale pages by a percentage, overriding scale of the job ticket",
+		"每面打印的页数 2, 4 或 6, 可加排列顺序, 覆盖作业票据中的 n_up":                         "Pages per side, 2, 4 or 6, optionally with the order, overriding n_up of the job ticket",
+		"按小册子打印, 覆盖作业票据中的 booklet":                                        "Print as a booklet, overriding booklet of the job ticket",
+		"不打印, 按打印机和作业票据计算打印页数, 纸张数和费用":                                    "Don't print: count the pages, sheets and cost with the printer and job ticket",
+		"提交期间暂停队列, 保证批次作业连续打印, 不与其他用户作业交错, 需要管理员权限":                       "Pause the queue while submitting, so that the jobs of the batch print together without jobs of other users in between; needs administrator rights",
+		"队列最长暂停时间":     "Longest the queue is paused",
+		"按顺序批量添加打印作业":  "Add print jobs in order, as a batch",
+		"<文件> [文件...]": "<file> [file...]",
+		"字段值 JSON 文件, 例如 {\"customer\": \"...\", \"items\": \"...\"}": "JSON file of field values, such as {\"customer\": \"...\", \"items\": \"...\"}",
+		"按配置文件中打印机的 escp 版式在针式打印机上套打表单":                               "Print a form on preprinted paper on a dot matrix printer, with the escp layout of the printer in the config file",
+		"打印作业状态":     "Print job state",
+		"打印机作业列表":    "Jobs of a printer",
+		"只列出当前用户的作业": "Only list the current user's jobs",
+		"列出提交时间, 页数, DEVMODE 和所有者 SID 等详细信息":      "List details, such as the submission time, pages, DEVMODE and owner SID",
+		"跟踪打印作业状态, 直到作业完成; 作业中止时以 1 退出, 超时以 2 退出": "Follow the state of a print job until it is done; exits with 1 when the job is aborted, 2 on timeout",
+		"<打印机> <作业ID>":   "<printer> <job ID>",
+		"最长等待时间, 默认一直等待": "Longest to wait, forever by default",
+		"轮询间隔, 用于补充作业通知": "Poll interval, besides job notifications",
+		"取消打印作业":         "Cancel a print job",
+		"修改作业优先级 (%d 到 %d, 默认 %d), 优先级高的作业先打印":                   "Change the priority of a job (%d to %d, %d by default); jobs with a higher priority print first",
+		"<打印机> <作业ID> <优先级>":                                     "<printer> <job ID> <priority>",
+		"立即打印在打印时间段之外提交而被保留的作业":                                  "Print now a job held for being submitted outside the printing hours",
+		"用作业的 PIN 释放, 不需要管理员权限":                                  "Release with the PIN of the job, without administrator rights",
+		"释放 job add --hold 保留的作业, 开始打印; 不带 --pin 时需要是作业的提交者或管理员": "Release a job held by job add --hold and start printing it; without --pin, needs to be the submitter of the job or an administrator",
+		"列出 job add --hold 保留, 等待释放的作业":                          "List the jobs held by job add --hold, waiting to be released",
+		"作业票据":               "Job tickets",
+		"严格校验作业票据":           "Validate a job ticket strictly",
+		"<文件>":               "<file>",
+		"输出作业票据 JSON schema": "Print the JSON schema of job tickets",
+		"计费记录, 由守护进程和 serve 写入 accounting.db_file": "Accounting records, written to accounting.db_file by the daemon and serve",
+		"起始日期, 如 2024-01-01":                       "Start date, such as 2024-01-01",
+		"截止日期, 包含当天":                               "End date, included",
+		"按 user 或 printer 汇总":                      "Total by user or printer",
+		"按用户或打印机汇总作业和页数":                           "Total jobs and pages by user or printer",
+		"导出作业记录为 CSV":                              "Export job records as CSV",
+		"名称":                                       "Name",
+		"名称2":                                      "Name 2",
+		"驱动":                                       "Driver",
+		"打印机名称":                                    "Printer name",
+		"打印类型":                                     "Data type",
+		"位置":                                       "Position",
+		"优先级":                                      "Priority",
+		"--output %q 无效, 应为 %s, %s 或 %s":           "Invalid --output %q, should be %s, %s or %s",
+		"pipes 中的管道缺少 name":                        "A pipe of pipes has no name",
+		"管道 %s: %s":                                "Pipe %s: %s",
+		"创建管道 %s 失败: %s":                           "Failed to create pipe %s: %s",
+		`管道 \\.\pipe\%s 接收打印机 %s 的作业`:              `Pipe \\.\pipe\%s receiving jobs for printer %s`,
+		"管道 %s 已停止: %s":                            "Pipe %s stopped: %s",
+		"未指定 printer, 且没有默认打印机":                    "No printer given, and no default printer",
+		"读取管道 %s 失败: %s":                           "Failed to read pipe %s: %s",
+		"管道 %s: 文档超过 %d 字节, 已丢弃":                   "Pipe %s: document larger than %d bytes, dropped",
+		"服务 %s 已存在":                                "Service %s already exists",
+		"跟踪打印机和作业状态, 提交作业队列中的作业": "Track printer and job states, and submit the jobs of the job queue",
+		"安装事件日志源 %s 失败: %s":      "Failed to install event log source %s: %s",
+		"服务 %s 已安装, 配置文件 %s\n":   "Service %s installed, config file %s\n",
+		"服务 %s 未安装":              "Service %s isn't installed",
+		"删除事件日志源 %s 失败: %s":      "Failed to remove event log source %s: %s",
+		"服务 %s 已卸载\n":            "Service %s uninstalled\n",
+		"服务 %s 已启动\n":            "Service %s started\n",
+		"服务 %s 已停止\n":            "Service %s stopped\n",
+		"服务 %s 在 %s 内未停止":        "Service %s didn't stop within %s",
+		"service run 只能由服务控制管理器启动, 请使用 service start 或 daemon": "service run is only started by the service control manager; use service start or daemon",
+		"服务 %s 运行失败: %s": "Service %s failed: %s",
+		"守护进程失败: %s":     "Daemon failed: %s",
+		"管理的打印服务器, 例如 \\\\PRINTSRV01, 默认为本机; 打印机名称可省略服务器前缀":        "Print server to manage, such as \\\\PRINTSRV01, this computer by default; printer names may leave out the server",
+		"消息语言, zh-CN 或 en-US, 默认按 LC_ALL, LC_MESSAGES 或 LANG 环境变量": "Language of messages, zh-CN or en-US, from the LC_ALL, LC_MESSAGES or LANG environment variable by default",
+		"无法浏览网络打印机: %s":               "Failed to browse network printers: %s",
+		"%s 扫描失败: %s":                 "%s scan failed: %s",
+		"连接打印机 %s 失败: %s":             "Failed to connect printer %s: %s",
+		"已连接打印机 %s\n":                 "Connected printer %s\n",
+		"同时通过mDNS (Bonjour) 扫描IPP打印机": "Also scan for IPP printers over mDNS (Bonjour)",
+		"同时通过WS-Discovery扫描WSD打印机":    "Also scan for WSD printers over WS-Discovery",
+		"等待扫描应答的时间":                   "How long to wait for scan answers",
+		"为发现的每台共享打印机 (\\\\服务器\\打印机) 添加打印机连接":               "Add a printer connection to each shared printer found (\\\\server\\printer)",
+		"发现网络上的打印机: 域中浏览到的共享打印机, 以及可选的mDNS和WS-Discovery扫描": "Discover printers on the network: the shared printers browsed in the domain, and optionally mDNS and WS-Discovery scans",
+		"来源":          "Source",
+		"地址":          "Address",
+		"型号":          "Model",
+		"已添加打印机 %s\n": "Added printer %s\n",
+		"已删除打印机 %s\n": "Deleted printer %s\n",
+		"已断开打印机 %s\n": "Disconnected printer %s\n",
+		"打印机使用的端口, 例如 LPT1: 或标准 TCP/IP 端口 IP_192.168.1.20, 需已存在": "Port the printer prints to, such as LPT1: or the Standard TCP/IP port IP_192.168.1.20, which must exist",
+		"已安装的打印机驱动名称":                                "Name of an installed printer driver",
+		"打印处理器, 默认为 winprint":                        "Print processor, winprint by default",
+		"默认数据类型, 默认为 RAW":                            "Default datatype, RAW by default",
+		"打印机备注":                                      "Comment of the printer",
+		"打印机位置":                                      "Location of the printer",
+		"以此共享名共享打印机":                                 "Share the printer under this name",
+		"添加打印队列, 使用已存在的端口和已安装的驱动":                    "Add a printer queue, with an existing port and an installed driver",
+		"删除打印队列, 队列中的作业完成后删除":                        "Delete a printer queue, once its jobs are done",
+		"为当前用户添加共享打印机的连接, 例如 \\\\PRINTSRV01\\Office": "Connect the current user to a shared printer, such as \\\\PRINTSRV01\\Office",
+		"删除当前用户与共享打印机的连接":                            "Remove a connection of the current user to a shared printer",
+		"监视器": "Monitor",
+		"描述":  "Description",
+		"--raw 和 --lpr-queue 只能选择一个":              "Use one of --raw and --lpr-queue",
+		"已添加端口 %s\n":                              "Added port %s\n",
+		"打印机端口":                                   "Printer ports",
+		"获取端口列表":                                  "List ports",
+		"打印机的IP地址或主机名":                            "IP address or host name of the printer",
+		"端口名称, 默认为 IP_<地址>":                       "Port name, IP_<address> by default",
+		"以RAW协议打印, 默认端口号 9100 (默认)":               "Print RAW, to port 9100 by default (the default)",
+		"以LPR协议打印到此队列, 默认端口号 515":                 "Print over LPR to this queue, to port 515 by default",
+		"端口号, 默认按协议":                              "Port number, by protocol by default",
+		"启用SNMP状态查询的团体名":                          "SNMP community to read the printer status with",
+		"添加标准 TCP/IP 端口, 供 printer add --port 使用": "Add a Standard TCP/IP port, for printer add --port",
+		"类型":      "Kind",
+		"尺寸 (毫米)": "Size (mm)",
+		"请输入表单名称和尺寸, 例如 \"Label 62x29\" 62x29": "Give a form name and size, such as \"Label 62x29\" 62x29",
+		"已添加表单 %s\n":     "Added form %s\n",
+		"请输入表单名称":        "Give a form name",
+		"已删除表单 %s\n":     "Deleted form %s\n",
+		"表单, 打印服务器的纸张尺寸": "Forms, the paper sizes of the print server",
+		"只列出用户添加的表单":     "List only the forms users added",
+		"获取表单列表":         "List forms",
+		"添加自定义纸张尺寸, 如标签纸, 打印机的纸张尺寸随之包含该表单": "Add a custom paper size, such as label stock, which the paper sizes of printers then include",
+		"<表单> <宽x高, 毫米>": "<form> <WIDTHxHEIGHT, mm>",
+		"删除用户添加的表单":      "Delete a form users added",
+		"<表单>":           "<form>",
+		"地点":             "Location",
+		"备注":             "Comment",
+		"共享名":            "Share name",
+		"分隔页":            "Separator page",
+		"请指定要修改的属性, 例如 --location":                     "Give the properties to change, such as --location",
+		"打印机 %s 已更新\n":                                 "Printer %s updated\n",
+		"获取打印机的位置, 备注, 共享名和分隔页":                        "Get the location, comment, share name and separator page of a printer",
+		"打印机位置, 例如 \"Floor 3\"":                        "Location of the printer, such as \"Floor 3\"",
+		"以此共享名共享打印机, 为空则取消共享":                          "Share the printer under this name; empty stops sharing",
+		"每个作业前打印的分隔页文件, 为空则不打印":                        "Separator page file printed before each job; empty for none",
+		"printer devmode dump 导出的DEVMODE文件, 设为默认设置":    "DEVMODE file written by printer devmode dump, to make the default",
+		"修改打印机的位置, 备注, 共享名, 分隔页或默认DEVMODE, 未指定的属性保持不变": "Change the location, comment, share name, separator page or default DEVMODE of a printer; other properties are kept",
+		"按打印机的默认设置打印测试页: 毫米网格, 可打印区域和页边距, 分辨率, 驱动, 灰度和彩色色阶, 用于部署后核对对齐": "print a test page with the printer defaults: a millimeter grid, the printable area and margins, resolution, driver, gray and color ramps, to check alignment after deployment",
+		"打印前检查 PDF: 是否加密, 损坏, 没有页面或页面尺寸无效, 并报告页数, 页面尺寸, 是否缩放和预计纸张数":    "check a PDF before printing: whether it is encrypted, corrupt, has no pages or invalid page sizes, and report its page count, page sizes, whether it is scaled and the estimated sheets",
+		"加密":   "Encrypted",
+		"页面尺寸": "Page size",
+		"%.1f x %.1f 毫米, %d 页, 自第 %d 页, 按 %g%% 打印": "%.1f x %.1f mm, %d pages, from page %d, printed at %g%%",
+		"缩放": "Scaled",
+	},
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/winspool"
+	cli "github.com/urfave/cli/v2"
+)
+
+// Formats of --output. Tables are for people; JSON field names are stable,
+// for scripts. Event streams are written as NDJSON, a lib.EventRecord per
+// line; other commands write JSON with ndjson.
+const (
+	outputTable  = "table"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+)
+
+func checkOutputFormat(c *cli.Context) error {
+	switch c.String("output") {
+	case outputTable, outputJSON, outputNDJSON:
+		return nil
+	}
+	return fmt.Errorf(tr("--output %q 无效, 应为 %s, %s 或 %s"), c.String("output"), outputJSON, outputNDJSON, outputTable)
+}
+
+func jsonOutput(c *cli.Context) bool {
+	return c.String("output") == outputJSON || c.String("output") == outputNDJSON
+}
+
+func ndjsonOutput(c *cli.Context) bool {
+	return c.String("output") == outputNDJSON
+}
+
+func printJSON(v interface{}) error {
+	body, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+type printerOutput struct {
+	Name        string                     `json:"name"`
+	DisplayName string                     `json:"display_name"`
+	Model       string                     `json:"model"`
+	State       model.CloudDeviceStateType `json:"state"`
+	Offline     bool                       `json:"offline"`
+}
+
+func newPrinterOutputs(printers []lib.Printer) []printerOutput {
+	outputs := make([]printerOutput, len(printers))
+	for i, printer := range printers {
+		outputs[i] = printerOutput{
+			Name:        printer.Name,
+			DisplayName: printer.DefaultDisplayName,
+			Model:       printer.Model,
+			Offline:     printer.Offline,
+		}
+		if printer.State != nil {
+			outputs[i].State = printer.State.State
+		}
+	}
+	return outputs
+}
+
+type printerConfigOutput struct {
+	Location      string `json:"location"`
+	Comment       string `json:"comment"`
+	ShareName     string `json:"share_name"`
+	SeparatorFile string `json:"separator_file"`
+}
+
+type portOutput struct {
+	Name        string `json:"name"`
+	Monitor     string `json:"monitor"`
+	Description string `json:"description"`
+	// PORT_TYPE_* flags.
+	Type uint32 `json:"type"`
+}
+
+func newPortOutputs(ports []winspool.Port) []portOutput {
+	outputs := make([]portOutput, len(ports))
+	for i, port := range ports {
+		outputs[i] = portOutput{
+			Name:        port.Name,
+			Monitor:     port.Monitor,
+			Description: port.Description,
+			Type:        port.Type,
+		}
+	}
+	return outputs
+}
+
+type jobOutput struct {
+	JobID    uint32             `json:"job_id"`
+	Printer  string             `json:"printer"`
+	User     string             `json:"user"`
+	Document string             `json:"document"`
+	Datatype string             `json:"datatype"`
+	Size     uint32             `json:"size"`
+	Position uint32             `json:"position"`
+	Priority uint32             `json:"priority"`
+	State    model.JobStateType `json:"state"`
+	// JOB_STATUS flags, see lib.JobStatusPaused etc., and their names.
+	Status      uint32   `json:"status"`
+	StatusNames []string `json:"status_names"`
+}
+
+func newJobOutputs(jobs []winspool.Job) []jobOutput {
+	outputs := make([]jobOutput, len(jobs))
+	for i, job := range jobs {
+		outputs[i] = newJobOutput(job)
+	}
+	return outputs
+}
+
+func newJobOutput(job winspool.Job) jobOutput {
+	return jobOutput{
+		JobID:       job.JobID,
+		Printer:     job.PrinterName,
+		User:        job.UserName,
+		Document:    job.Document,
+		Datatype:    job.Datatype,
+		Size:        job.Size,
+		Position:    job.Position,
+		Priority:    job.Priority,
+		State:       lib.ConvertJobStatus(job.Status).Type,
+		Status:      job.Status,
+		StatusNames: lib.JobStatusNames(job.Status),
+	}
+}
+
+type jobDetailsOutput struct {
+	jobOutput
+	Machine      string              `json:"machine,omitempty"`
+	Driver       string              `json:"driver,omitempty"`
+	Submitted    time.Time           `json:"submitted"`
+	TotalPages   uint32              `json:"total_pages"`
+	PagesPrinted uint32              `json:"pages_printed"`
+	StatusText   string              `json:"status_text,omitempty"`
+	DevMode      *lib.DevModeSummary `json:"devmode,omitempty"`
+	OwnerSID     string              `json:"owner_sid,omitempty"`
+}
+
+func newJobDetailsOutputs(jobs []winspool.JobDetails) []jobDetailsOutput {
+	outputs := make([]jobDetailsOutput, len(jobs))
+	for i, job := range jobs {
+		outputs[i] = jobDetailsOutput{
+			jobOutput:    newJobOutput(job.Job),
+			Machine:      job.MachineName,
+			Driver:       job.DriverName,
+			Submitted:    job.Submitted,
+			TotalPages:   job.TotalPages,
+			PagesPrinted: job.PagesPrinted,
+			StatusText:   job.StatusText,
+			DevMode:      job.DevMode,
+			OwnerSID:     job.OwnerSID,
+		}
+	}
+	return outputs
+}
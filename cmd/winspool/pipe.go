@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/winspool"
+)
+
+// servePipes listens on the pipes of the config until ctx is done, and
+// turns what each client writes into a job. Fails when a pipe can't be
+// created or its ticket read.
+func (a *App) servePipes(ctx context.Context) error {
+	var listeners []*winspool.PipeListener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	for _, pipe := range a.config.Pipes {
+		pipe := pipe
+		if pipe.Name == "" {
+			closeAll()
+			return errors.New(tr("pipes 中的管道缺少 name"))
+		}
+		printerName, ticket, err := a.pipeJobSettings(pipe)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf(tr("管道 %s: %s"), pipe.Name, err)
+		}
+		l, err := winspool.ListenPipe(pipe.Name)
+		if err != nil {
+			closeAll()
+			return fmt.Errorf(tr("创建管道 %s 失败: %s"), pipe.Name, err)
+		}
+		listeners = append(listeners, l)
+		log.Printf(tr(`管道 \\.\pipe\%s 接收打印机 %s 的作业`), pipe.Name, printerName)
+		go func() {
+			for {
+				conn, err := l.Accept()
+				if err == winspool.ErrPipeClosed {
+					return
+				} else if err != nil {
+					log.Printf(tr("管道 %s 已停止: %s"), pipe.Name, err)
+					return
+				}
+				go a.acceptPipeJob(ctx, pipe, printerName, ticket, conn)
+			}
+		}()
+	}
+	go func() {
+		<-ctx.Done()
+		closeAll()
+	}()
+	return nil
+}
+
+// pipeJobSettings returns the printer and ticket of the jobs of a pipe.
+func (a *App) pipeJobSettings(pipe lib.PipeConfig) (string, *model.JobTicket, error) {
+	printerName := pipe.Printer
+	if printerName == "" {
+		var err error
+		if printerName, err = a.spool.GetDefaultPrinter(); err != nil {
+			return "", nil, errors.New(tr("未指定 printer, 且没有默认打印机"))
+		}
+	}
+	ticket := &model.JobTicket{}
+	if pipe.Ticket != "" {
+		body, err := ioutil.ReadFile(pipe.Ticket)
+		if err != nil {
+			return "", nil, err
+		}
+		if ticket, err = model.ParseJobTicket(body, model.ParseJobTicketOptions{Strict: true}); err != nil {
+			return "", nil, err
+		}
+	}
+	return printerName, ticket, nil
+}
+
+// acceptPipeJob reads a document from a pipe client into a temporary file,
+// and prints it.
+func (a *App) acceptPipeJob(ctx context.Context, pipe lib.PipeConfig, printerName string, ticket *model.JobTicket, conn io.ReadCloser) {
+	defer conn.Close()
+	maxSize := pipe.MaxSize
+	if maxSize <= 0 {
+		maxSize = lib.DefaultPipeMaxSize
+	}
+	f, err := ioutil.TempFile("", "winspool-pipe-*")
+	if err != nil {
+		log.Printf(tr("管道 %s: %s"), pipe.Name, err)
+		return
+	}
+	n, err := io.Copy(f, io.LimitReader(conn, maxSize+1))
+	f.Close()
+	cleanup := func() { os.Remove(f.Name()) }
+	switch {
+	case err != nil:
+		log.Printf(tr("读取管道 %s 失败: %s"), pipe.Name, err)
+		cleanup()
+		return
+	case n == 0:
+		// Such as the connection that stops the listener.
+		cleanup()
+		return
+	case n > maxSize:
+		log.Printf(tr("管道 %s: 文档超过 %d 字节, 已丢弃"), pipe.Name, maxSize)
+		cleanup()
+		return
+	}
+
+	title := fmt.Sprintf("%s %s", pipe.Name, time.Now().Format("20060102-150405.000"))
+	if pipe.Raw {
+		defer cleanup()
+		data, err := os.Open(f.Name())
+		if err != nil {
+			log.Printf(tr("管道 %s: %s"), pipe.Name, err)
+			return
+		}
+		defer data.Close()
+		result, err := a.spool.PrintRaw(printerName, data, title, "")
+		if err != nil {
+			log.Printf(tr("打印作业 %s 失败: %s"), title, err)
+			return
+		}
+		log.Printf(tr("作业 %s 已提交到打印机 %s, 作业ID %d"), title, printerName, result.JobID)
+		return
+	}
+	job := &lib.Job{NativePrinterName: printerName, Filename: f.Name(), Title: title, Ticket: ticket, Cleanup: cleanup}
+	select {
+	case a.jobs <- job:
+	case <-ctx.Done():
+		cleanup()
+	}
+}
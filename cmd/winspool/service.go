@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const defaultServiceName = "winspool"
+
+// How long service stop waits for the service to stop.
+const serviceStopTimeout = 30 * time.Second
+
+// InstallService installs the daemon as an automatic Windows service, with
+// the config file given with --config, and an event log source of the same
+// name.
+func (a *App) InstallService(c *cli.Context) error {
+	name := c.String("name")
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	config, err := filepath.Abs(c.String("config"))
+	if err != nil {
+		return err
+	}
+
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(name); err == nil {
+		s.Close()
+		return fmt.Errorf(tr("服务 %s 已存在"), name)
+	}
+	s, err := m.CreateService(name, exe, mgr.Config{
+		DisplayName:  "Winspool " + name,
+		Description:  tr("跟踪打印机和作业状态, 提交作业队列中的作业"),
+		StartType:    mgr.StartAutomatic,
+		Dependencies: []string{"Spooler"},
+	}, "--config", config, "service", "--name", name, "run")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	// Restarted when it crashes, after 5 seconds and then after a minute.
+	err = s.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: 5 * time.Second},
+		{Type: mgr.ServiceRestart, Delay: time.Minute},
+	}, uint32((24 * time.Hour).Seconds()))
+	if err != nil {
+		s.Delete()
+		return err
+	}
+	if err = eventlog.InstallAsEventCreate(name, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		s.Delete()
+		return fmt.Errorf(tr("安装事件日志源 %s 失败: %s"), name, err)
+	}
+	fmt.Printf(tr("服务 %s 已安装, 配置文件 %s\n"), name, config)
+	return nil
+}
+
+// UninstallService stops and removes the service and its event log source.
+func (a *App) UninstallService(c *cli.Context) error {
+	name := c.String("name")
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf(tr("服务 %s 未安装"), name)
+	}
+	defer s.Close()
+	if err = stopService(s); err != nil {
+		return err
+	}
+	if err = s.Delete(); err != nil {
+		return err
+	}
+	if err = eventlog.Remove(name); err != nil {
+		log.Printf(tr("删除事件日志源 %s 失败: %s"), name, err)
+	}
+	fmt.Printf(tr("服务 %s 已卸载\n"), name)
+	return nil
+}
+
+func (a *App) StartService(c *cli.Context) error {
+	name := c.String("name")
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf(tr("服务 %s 未安装"), name)
+	}
+	defer s.Close()
+	if err = s.Start(); err != nil {
+		return err
+	}
+	fmt.Printf(tr("服务 %s 已启动\n"), name)
+	return nil
+}
+
+func (a *App) StopService(c *cli.Context) error {
+	name := c.String("name")
+	m, err := mgr.Connect()
+	if err != nil {
+		return err
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(name)
+	if err != nil {
+		return fmt.Errorf(tr("服务 %s 未安装"), name)
+	}
+	defer s.Close()
+	if err = stopService(s); err != nil {
+		return err
+	}
+	fmt.Printf(tr("服务 %s 已停止\n"), name)
+	return nil
+}
+
+// stopService stops a service, unless it is stopped already, and waits for
+// it to stop.
+func stopService(s *mgr.Service) error {
+	status, err := s.Query()
+	if err != nil {
+		return err
+	}
+	if status.State == svc.Stopped {
+		return nil
+	}
+	if status, err = s.Control(svc.Stop); err != nil {
+		return err
+	}
+	for deadline := time.Now().Add(serviceStopTimeout); status.State != svc.Stopped; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf(tr("服务 %s 在 %s 内未停止"), s.Name, serviceStopTimeout)
+		}
+		time.Sleep(300 * time.Millisecond)
+		if status, err = s.Query(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunService runs the daemon when started by the service control manager,
+// logging to the event log.
+func (a *App) RunService(c *cli.Context) error {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return err
+	}
+	if !isService {
+		return errors.New(tr("service run 只能由服务控制管理器启动, 请使用 service start 或 daemon"))
+	}
+	name := c.String("name")
+	elog, err := eventlog.Open(name)
+	if err != nil {
+		return err
+	}
+	defer elog.Close()
+	log.SetFlags(0)
+	log.SetOutput(eventLogWriter{elog})
+
+	// Services start in the system folder; relative paths of the config,
+	// such as metrics_file, are relative to the config file instead.
+	if err = os.Chdir(filepath.Dir(c.String("config"))); err != nil {
+		elog.Error(1, err.Error())
+		return err
+	}
+	if err = svc.Run(name, &daemonService{app: a, elog: elog}); err != nil {
+		elog.Error(1, fmt.Sprintf(tr("服务 %s 运行失败: %s"), name, err))
+		return err
+	}
+	return nil
+}
+
+// eventLogWriter writes log lines as Information events.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	if err := w.elog.Info(1, strings.TrimRight(string(p), "\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// daemonService runs the daemon until the service is stopped, or the
+// system shuts down.
+type daemonService struct {
+	app  *App
+	elog *eventlog.Log
+}
+
+func (s *daemonService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- s.app.runDaemon(func() { <-stop })
+	}()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case err := <-done:
+			// The daemon failed to start.
+			return s.exit(err)
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending, WaitHint: uint32(serviceStopTimeout / time.Millisecond)}
+				close(stop)
+				return s.exit(<-done)
+			}
+		}
+	}
+}
+
+// exit returns the exit code of the service, 1 when the daemon failed.
+func (s *daemonService) exit(err error) (bool, uint32) {
+	if err != nil {
+		s.elog.Error(1, fmt.Sprintf(tr("守护进程失败: %s"), err))
+		return true, 1
+	}
+	return false, 0
+}
@@ -0,0 +1,14 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+// ErrAdminRequired is wrapped by the errors of operations that the spooler
+// denied for lack of administrator rights, e.g. pausing a queue or cancelling
+// the job of another user. It is ErrAccessDenied too.
+var ErrAdminRequired error = &kindError{message: "requires administrator", kind: ErrAccessDenied}
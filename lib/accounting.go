@@ -0,0 +1,342 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// JobInfo is what the spooler knows of a job: who printed it and what,
+// from JOB_INFO_2 on Windows.
+type JobInfo struct {
+	Printer   string    `json:"printer"`
+	JobID     uint32    `json:"job_id"`
+	User      string    `json:"user"`
+	Machine   string    `json:"machine,omitempty"`
+	Document  string    `json:"document"`
+	Submitted time.Time `json:"submitted"`
+	// The DEVMODE of the job prints in color.
+	Color bool `json:"color"`
+	// Pages spooled, and printed so far.
+	TotalPages   int `json:"total_pages"`
+	PagesPrinted int `json:"pages_printed"`
+}
+
+// AccountingRecord is a finished job, as recorded for chargeback.
+type AccountingRecord struct {
+	// When the job was done or aborted.
+	Time time.Time `json:"time"`
+	JobInfo
+	State model.JobStateType `json:"state"`
+	// Pages Poppler rendered, for jobs winspool printed; zero for others.
+	RenderedPages int `json:"rendered_pages,omitempty"`
+}
+
+// Pages is what the job is charged for: the pages the printer printed,
+// or, when the spooler doesn't count them, the pages spooled or rendered.
+func (r *AccountingRecord) Pages() int {
+	switch {
+	case r.PagesPrinted > 0:
+		return r.PagesPrinted
+	case r.State == model.JobStateAborted:
+		return 0
+	case r.TotalPages > 0:
+		return r.TotalPages
+	}
+	return r.RenderedPages
+}
+
+// AccountingSink receives the records of finished jobs.
+type AccountingSink interface {
+	Record(r AccountingRecord) error
+	Close() error
+}
+
+// AccountingConfig lists where finished jobs are recorded; any number of
+// the sinks can be set.
+type AccountingConfig struct {
+	// CSV file records are appended to, with a header when it's new.
+	CSVFile string `json:"csv_file,omitempty"`
+	// Database file records are kept in, which "accounting report" and
+	// "accounting export" read, also while the daemon runs.
+	DBFile string `json:"db_file,omitempty"`
+	// URL each record is posted to, as JSON.
+	Webhook string `json:"webhook,omitempty"`
+
+	// Pages a day users and printers may print, counted from DBFile.
+	Quotas *QuotaConfig `json:"quotas,omitempty"`
+}
+
+// OpenAccountingSinks opens the sinks of the config, as one sink.
+func OpenAccountingSinks(config *AccountingConfig) (AccountingSink, error) {
+	var sinks multiAccountingSink
+	if config.CSVFile != "" {
+		sink, err := OpenCSVAccountingSink(config.CSVFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if config.DBFile != "" {
+		db, err := OpenAccountingDB(config.DBFile)
+		if err != nil {
+			sinks.Close()
+			return nil, err
+		}
+		sinks = append(sinks, db)
+	}
+	if config.Webhook != "" {
+		sinks = append(sinks, WebhookAccountingSink(config.Webhook))
+	}
+	if len(sinks) == 0 {
+		return nil, errors.New("accounting needs a csv_file, db_file or webhook")
+	}
+	return sinks, nil
+}
+
+type multiAccountingSink []AccountingSink
+
+func (s multiAccountingSink) Record(r AccountingRecord) error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Record(r); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (s multiAccountingSink) Close() error {
+	var first error
+	for _, sink := range s {
+		if err := sink.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// AccountingCSVHeader names the columns of WriteAccountingCSV.
+var AccountingCSVHeader = []string{"time", "submitted", "printer", "job_id", "user", "machine", "document", "state", "color", "pages", "pages_printed", "total_pages", "rendered_pages"}
+
+func accountingCSVRow(r AccountingRecord) []string {
+	return []string{
+		r.Time.UTC().Format(time.RFC3339),
+		r.Submitted.UTC().Format(time.RFC3339),
+		r.Printer,
+		strconv.FormatUint(uint64(r.JobID), 10),
+		r.User,
+		r.Machine,
+		r.Document,
+		string(r.State),
+		strconv.FormatBool(r.Color),
+		strconv.Itoa(r.Pages()),
+		strconv.Itoa(r.PagesPrinted),
+		strconv.Itoa(r.TotalPages),
+		strconv.Itoa(r.RenderedPages),
+	}
+}
+
+// WriteAccountingCSV writes records as CSV, after AccountingCSVHeader.
+func WriteAccountingCSV(w io.Writer, records []AccountingRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(AccountingCSVHeader); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := writer.Write(accountingCSVRow(r)); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// CSVAccountingSink appends records to a CSV file, a line each.
+type CSVAccountingSink struct {
+	mutex  sync.Mutex
+	file   *os.File
+	writer *csv.Writer
+}
+
+// OpenCSVAccountingSink opens a CSV file for appending, and writes the
+// header when the file is empty.
+func OpenCSVAccountingSink(fileName string) (*CSVAccountingSink, error) {
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := CSVAccountingSink{file: f, writer: csv.NewWriter(f)}
+	if info.Size() == 0 {
+		s.writer.Write(AccountingCSVHeader)
+		if s.writer.Flush(); s.writer.Error() != nil {
+			f.Close()
+			return nil, s.writer.Error()
+		}
+	}
+	return &s, nil
+}
+
+func (s *CSVAccountingSink) Record(r AccountingRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.writer.Write(accountingCSVRow(r))
+	s.writer.Flush()
+	return s.writer.Error()
+}
+
+func (s *CSVAccountingSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.file.Close()
+}
+
+// WebhookAccountingSink posts each record to a URL, as JSON, in the
+// background; failures are logged.
+type WebhookAccountingSink string
+
+func (url WebhookAccountingSink) Record(r AccountingRecord) error {
+	go func() {
+		if err := PostWebhook(string(url), r); err != nil {
+			log.Printf("Failed to post accounting record of job %d on %s: %s", r.JobID, r.Printer, err)
+		}
+	}()
+	return nil
+}
+
+func (url WebhookAccountingSink) Close() error {
+	return nil
+}
+
+var accountingBucket = []byte("records")
+
+// AccountingDB keeps records in a database file, for reports. The file is
+// only open while a record is written or read, so that reports can be run
+// while the daemon records jobs.
+type AccountingDB struct {
+	fileName string
+}
+
+// OpenAccountingDB creates the database file if needed.
+func OpenAccountingDB(fileName string) (*AccountingDB, error) {
+	d := AccountingDB{fileName: fileName}
+	err := d.update(func(bucket *bolt.Bucket) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (d *AccountingDB) open() (*bolt.DB, error) {
+	return openSharedDB("accounting database", d.fileName)
+}
+
+func (d *AccountingDB) update(fn func(bucket *bolt.Bucket) error) error {
+	return updateSharedDB("accounting database", d.fileName, accountingBucket, fn)
+}
+
+func (d *AccountingDB) Record(r AccountingRecord) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return d.update(func(bucket *bolt.Bucket) error {
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, id)
+		return bucket.Put(key, value)
+	})
+}
+
+// Records returns the records of jobs finished from from, included, to to,
+// excluded, in the order they were recorded. Zero times don't limit.
+func (d *AccountingDB) Records(from, to time.Time) ([]AccountingRecord, error) {
+	db, err := d.open()
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	var records []AccountingRecord
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(accountingBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(k, v []byte) error {
+			var r AccountingRecord
+			if err := json.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			if (from.IsZero() || !r.Time.Before(from)) && (to.IsZero() || r.Time.Before(to)) {
+				records = append(records, r)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (d *AccountingDB) Close() error {
+	return nil
+}
+
+// AccountingTotal sums the records of a user or printer.
+type AccountingTotal struct {
+	Key        string `json:"key"`
+	Jobs       int    `json:"jobs"`
+	Pages      int    `json:"pages"`
+	ColorPages int    `json:"color_pages"`
+}
+
+// SumAccountingRecords sums records by the key of each, such as the user,
+// in key order.
+func SumAccountingRecords(records []AccountingRecord, key func(r *AccountingRecord) string) []AccountingTotal {
+	totals := make(map[string]*AccountingTotal)
+	for i := range records {
+		r := &records[i]
+		k := key(r)
+		total, ok := totals[k]
+		if !ok {
+			total = &AccountingTotal{Key: k}
+			totals[k] = total
+		}
+		total.Jobs++
+		total.Pages += r.Pages()
+		if r.Color {
+			total.ColorPages += r.Pages()
+		}
+	}
+	sums := make([]AccountingTotal, 0, len(totals))
+	for _, total := range totals {
+		sums = append(sums, *total)
+	}
+	sort.Slice(sums, func(i, j int) bool { return sums[i].Key < sums[j].Key })
+	return sums
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestAccountingSinks(t *testing.T) {
+	dir := t.TempDir()
+	config := &AccountingConfig{CSVFile: filepath.Join(dir, "jobs.csv"), DBFile: filepath.Join(dir, "jobs.db")}
+	day := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	records := []AccountingRecord{
+		{Time: day, JobInfo: JobInfo{Printer: "a", JobID: 1, User: "alice", Document: "x.pdf", Color: true, PagesPrinted: 2}, State: model.JobStateDone},
+		{Time: day.Add(time.Hour), JobInfo: JobInfo{Printer: "b", JobID: 2, User: "bob", TotalPages: 3}, State: model.JobStateDone},
+		{Time: day.AddDate(0, 0, 1), JobInfo: JobInfo{Printer: "a", JobID: 3, User: "alice", TotalPages: 5}, State: model.JobStateAborted, RenderedPages: 5},
+	}
+	for i := 0; i < 2; i++ {
+		// Reopened, the CSV file is appended to without a second header.
+		sink, err := OpenAccountingSinks(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			for _, r := range records {
+				if err := sink.Record(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	b, err := ioutil.ReadFile(config.CSVFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 4 || lines[0] != strings.Join(AccountingCSVHeader, ",") {
+		t.Fatalf("unexpected CSV %q", b)
+	}
+	if want := "2020-01-01T10:00:00Z,0001-01-01T00:00:00Z,a,1,alice,,x.pdf,DONE,true,2,2,0,0"; lines[1] != want {
+		t.Errorf("expected %q, got %q", want, lines[1])
+	}
+
+	db, err := OpenAccountingDB(config.DBFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.Records(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, records[:2]) {
+		t.Errorf("expected %+v, got %+v", records[:2], got)
+	}
+
+	all, err := db.Records(time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	totals := SumAccountingRecords(all, func(r *AccountingRecord) string { return r.User })
+	expected := []AccountingTotal{{Key: "alice", Jobs: 2, Pages: 2, ColorPages: 2}, {Key: "bob", Jobs: 1, Pages: 3}}
+	if !reflect.DeepEqual(totals, expected) {
+		t.Errorf("expected %+v, got %+v", expected, totals)
+	}
+
+	if _, err := OpenAccountingSinks(&AccountingConfig{}); err == nil {
+		t.Error("expected a config without sinks to be invalid")
+	}
+}
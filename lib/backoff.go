@@ -53,3 +53,17 @@ func (b *Backoff) Pause() (time.Duration, bool) {
 
 	return randomizedInterval, true
 }
+
+// RetryDelay returns the time to wait before the given retry of an
+// operation, 1 for the first, growing and randomized like Backoff. For
+// retries that outlive a Backoff, such as those of persisted jobs.
+func RetryDelay(retry int) time.Duration {
+	interval := float64(initialRetryInterval)
+	for i := 1; i < retry && interval < float64(maxInterval); i++ {
+		interval *= multiplier
+	}
+	if interval > float64(maxInterval) {
+		interval = float64(maxInterval)
+	}
+	return time.Duration((rand.Float64()*(2*randomizationFactor) + (1 - randomizationFactor)) * interval)
+}
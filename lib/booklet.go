@@ -0,0 +1,44 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+// BookletBlank marks a blank page of a booklet side, added to make the
+// page count a multiple of 4.
+const BookletBlank = -1
+
+// BookletSides imposes pages for a saddle-stitched booklet: sheets folded
+// in half and stapled in the middle. Each side has a left and a right page,
+// and sides alternate front and back, to be printed duplex along the short
+// edge. Pages past the last are BookletBlank.
+func BookletSides(pages []int) [][]int {
+	n := (len(pages) + 3) / 4 * 4
+	page := func(i int) int {
+		if i < len(pages) {
+			return pages[i]
+		}
+		return BookletBlank
+	}
+	sides := make([][]int, 0, n/2)
+	for sheet := 0; sheet < n/4; sheet++ {
+		sides = append(sides,
+			[]int{page(n - 1 - 2*sheet), page(2 * sheet)},
+			[]int{page(2*sheet + 1), page(n - 2 - 2*sheet)})
+	}
+	return sides
+}
+
+// BookletCells divides the printable area of a landscape sheet into the
+// left and right halves booklet pages are printed in.
+func BookletCells(printable NUpCell) []NUpCell {
+	half := printable.Width / 2
+	return []NUpCell{
+		{X: printable.X, Y: printable.Y, Width: half, Height: printable.Height},
+		{X: printable.X + half, Y: printable.Y, Width: half, Height: printable.Height},
+	}
+}
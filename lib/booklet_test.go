@@ -0,0 +1,39 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBookletSides(t *testing.T) {
+	const b = BookletBlank
+	for _, test := range []struct {
+		pages []int
+		sides [][]int
+	}{
+		{[]int{0}, [][]int{{b, 0}, {b, b}}},
+		{[]int{0, 1, 2, 3}, [][]int{{3, 0}, {1, 2}}},
+		// 6 pages take 2 sheets; the blanks are the last pages, inside the
+		// back cover.
+		{[]int{0, 1, 2, 3, 4, 5}, [][]int{{b, 0}, {1, b}, {5, 2}, {3, 4}}},
+		// Pages are those selected, such as by a page range.
+		{[]int{4, 5, 8, 9}, [][]int{{9, 4}, {5, 8}}},
+	} {
+		if sides := BookletSides(test.pages); !reflect.DeepEqual(sides, test.sides) {
+			t.Errorf("%v: expected %v got %v", test.pages, test.sides, sides)
+		}
+	}
+
+	settings := TicketSettings{Copies: 1, Booklet: true, Duplex: true}
+	if sheets := settings.Sheets(6); sheets != 2 {
+		t.Errorf("expected 6 pages on 2 sheets got %d", sheets)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// DefaultBulkWorkers is the number of printers a bulk operation works on
+// at once.
+const DefaultBulkWorkers = 8
+
+// BulkResult is the outcome of a bulk operation on one printer.
+type BulkResult struct {
+	Printer string `json:"printer"`
+	// Empty when the operation succeeded.
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// RunBulk runs op on every printer, workers at a time, and returns the
+// results in the order of printers.
+func RunBulk(printers []string, workers int, op func(printerName string) error) []BulkResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]BulkResult, len(printers))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				start := time.Now()
+				results[i].Printer = printers[i]
+				if err := op(printers[i]); err != nil {
+					results[i].Error = err.Error()
+				}
+				results[i].Duration = time.Since(start)
+			}
+		}()
+	}
+	for i := range printers {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+// PrinterGroup returns the printers of a group of printer_groups, in the
+// order of printers, which lists the printers there are. Entries with
+// wildcards are path.Match patterns, the others printer names; names of
+// printers that don't exist are kept at the end, for the operation to
+// report them.
+func (c *Config) PrinterGroup(name string, printers []string) ([]string, error) {
+	entries, ok := c.PrinterGroups[name]
+	if !ok {
+		return nil, fmt.Errorf("printer group %s is not configured", name)
+	}
+	selected := make(map[string]bool)
+	var missing []string
+	for _, entry := range entries {
+		pattern, matched := hasWildcard(entry), false
+		for _, printer := range printers {
+			ok := printer == entry
+			if pattern {
+				var err error
+				if ok, err = path.Match(entry, printer); err != nil {
+					return nil, fmt.Errorf("printer group %s: bad pattern %q: %s", name, entry, err)
+				}
+			}
+			if ok {
+				selected[printer], matched = true, true
+			}
+		}
+		if !matched && !pattern {
+			missing = append(missing, entry)
+		}
+	}
+
+	var group []string
+	for _, printer := range printers {
+		if selected[printer] {
+			group = append(group, printer)
+		}
+	}
+	return append(group, missing...), nil
+}
+
+func hasWildcard(pattern string) bool {
+	for _, r := range pattern {
+		switch r {
+		case '*', '?', '[':
+			return true
+		}
+	}
+	return false
+}
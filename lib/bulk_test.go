@@ -0,0 +1,72 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunBulk(t *testing.T) {
+	printers := []string{"a", "b", "c", "d", "e"}
+	var running, most int32
+	results := RunBulk(printers, 2, func(printerName string) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if printerName == "c" {
+			return errors.New("access denied")
+		}
+		return nil
+	})
+
+	if most != 2 {
+		t.Errorf("expected 2 printers at once got %d", most)
+	}
+	for i, result := range results {
+		if result.Printer != printers[i] {
+			t.Errorf("expected results in order got %+v", results)
+		}
+		if (result.Error != "") != (result.Printer == "c") {
+			t.Errorf("unexpected result %+v", result)
+		}
+	}
+}
+
+func TestPrinterGroup(t *testing.T) {
+	config := Config{PrinterGroups: map[string][]string{
+		"labels": {"Label*", `\\server\Office`, "Gone", "Label 1"},
+		"bad":    {"[a"},
+	}}
+	printers := []string{"Office", "Label 2", `\\server\Office`, "Label 1"}
+	group, err := config.PrinterGroup("labels", printers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Label 2", `\\server\Office`, "Label 1", "Gone"}
+	if !reflect.DeepEqual(group, want) {
+		t.Errorf("expected %q got %q", want, group)
+	}
+
+	if _, err = config.PrinterGroup("bad", printers); err == nil {
+		t.Error("expected error for a bad pattern")
+	}
+	if _, err = config.PrinterGroup("kitchen", printers); err == nil {
+		t.Error("expected error for an unknown group")
+	}
+}
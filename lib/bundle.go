@@ -0,0 +1,168 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Support bundles kept in a folder; the oldest are deleted past it.
+const maxSupportBundles = 50
+
+// DefaultSupportBundleLogLines is the number of log lines kept for support
+// bundles by default.
+const DefaultSupportBundleLogLines = 200
+
+// DriverInfo describes the driver of a printer queue.
+type DriverInfo struct {
+	Name string `json:"name"`
+	// File version of the driver, such as "61.180.1.20062".
+	Version      string    `json:"version,omitempty"`
+	Date         time.Time `json:"date,omitempty"`
+	Manufacturer string    `json:"manufacturer,omitempty"`
+	Provider     string    `json:"provider,omitempty"`
+	HardwareID   string    `json:"hardware_id,omitempty"`
+}
+
+// SupportBundle is what was known of the machine, printer and process when
+// a job failed, so that failures reported days later can be diagnosed.
+// Parts that couldn't be collected are nil or empty.
+type SupportBundle struct {
+	Time           time.Time `json:"time"`
+	Host           string    `json:"host,omitempty"`
+	WindowsVersion string    `json:"windows_version,omitempty"`
+	// Version of this program.
+	Version string `json:"version,omitempty"`
+
+	Printer string `json:"printer"`
+	Title   string `json:"title,omitempty"`
+	// ID of the job in the job queue, if it was queued.
+	QueuedJobID uint64 `json:"queued_job_id,omitempty"`
+	Error       string `json:"error"`
+
+	Ticket      *model.JobTicket `json:"-"`
+	PrinterInfo *Printer         `json:"-"`
+	DevMode     *DevModeExport   `json:"-"`
+	Driver      *DriverInfo      `json:"-"`
+	// Print service event log entries, newest first.
+	Events string `json:"-"`
+	// Last lines of the log of this process.
+	LogLines []string `json:"-"`
+
+	// Parts that couldn't be collected, and why.
+	CollectionErrors []string `json:"collection_errors,omitempty"`
+}
+
+// WriteSupportBundle writes a bundle to a new zip file in dir, and returns
+// its path. The oldest bundles in dir are deleted past 50.
+func WriteSupportBundle(dir string, b *SupportBundle) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, "support-"+b.Time.Format("20060102-150405")+"-*.zip")
+	if err != nil {
+		return "", err
+	}
+	if err = writeSupportBundle(f, b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	pruneSupportBundles(dir)
+	return f.Name(), nil
+}
+
+func writeSupportBundle(f *os.File, b *SupportBundle) error {
+	z := zip.NewWriter(f)
+	writeJSON := func(name string, v interface{}) error {
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	writeText := func(name, text string) error {
+		w, err := z.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write([]byte(text))
+		return err
+	}
+
+	if err := writeJSON("bundle.json", b); err != nil {
+		return err
+	}
+	if b.Ticket != nil {
+		if err := writeJSON("ticket.json", b.Ticket); err != nil {
+			return err
+		}
+	}
+	if b.PrinterInfo != nil {
+		if err := writeJSON("printer.json", b.PrinterInfo); err != nil {
+			return err
+		}
+	}
+	if b.DevMode != nil {
+		if err := writeJSON("devmode.json", b.DevMode); err != nil {
+			return err
+		}
+	}
+	if b.Driver != nil {
+		if err := writeJSON("driver.json", b.Driver); err != nil {
+			return err
+		}
+	}
+	if b.Events != "" {
+		if err := writeText("events.txt", b.Events); err != nil {
+			return err
+		}
+	}
+	if len(b.LogLines) > 0 {
+		if err := writeText("log.txt", strings.Join(b.LogLines, "\n")+"\n"); err != nil {
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// pruneSupportBundles deletes the oldest bundles in dir past
+// maxSupportBundles. Their names sort by time.
+func pruneSupportBundles(dir string) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, info := range infos {
+		if strings.HasPrefix(info.Name(), "support-") && strings.HasSuffix(info.Name(), ".zip") {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+	for len(names) > maxSupportBundles {
+		os.Remove(filepath.Join(dir, names[0]))
+		names = names[1:]
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestWriteSupportBundle(t *testing.T) {
+	dir := t.TempDir()
+	b := &SupportBundle{
+		Time:             time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Printer:          "Label",
+		Error:            "StartDocPrinter failed",
+		Ticket:           &model.JobTicket{Copies: &model.CopiesTicketItem{Copies: 2}},
+		Driver:           &DriverInfo{Name: "ZDesigner ZD420", Version: "8.6.2.1"},
+		LogLines:         []string{"first", "second"},
+		CollectionErrors: []string{"event log: access denied"},
+	}
+	path, err := WriteSupportBundle(dir, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(path) != dir {
+		t.Errorf("expected the bundle in %s got %s", dir, path)
+	}
+
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	files := make(map[string]string)
+	var names []string
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	// Parts not collected are left out.
+	expected := []string{"bundle.json", "driver.json", "log.txt", "ticket.json"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected files %v got %v", expected, names)
+	}
+	for i := range names {
+		if names[i] != expected[i] {
+			t.Fatalf("expected files %v got %v", expected, names)
+		}
+	}
+
+	var summary SupportBundle
+	if err = json.Unmarshal([]byte(files["bundle.json"]), &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Printer != "Label" || summary.Error != b.Error || len(summary.CollectionErrors) != 1 {
+		t.Errorf("unexpected bundle.json %s", files["bundle.json"])
+	}
+	var driver DriverInfo
+	if err = json.Unmarshal([]byte(files["driver.json"]), &driver); err != nil || driver != *b.Driver {
+		t.Errorf("unexpected driver.json %s", files["driver.json"])
+	}
+	if files["log.txt"] != "first\nsecond\n" {
+		t.Errorf("unexpected log.txt %q", files["log.txt"])
+	}
+}
+
+func TestWriteSupportBundlePrunes(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var first string
+	for i := 0; i < maxSupportBundles+2; i++ {
+		path, err := WriteSupportBundle(dir, &SupportBundle{Time: start.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			first = path
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(dir, "support-*.zip"))
+	if len(matches) != maxSupportBundles {
+		t.Errorf("expected %d bundles kept got %d", maxSupportBundles, len(matches))
+	}
+	for _, m := range matches {
+		if m == first {
+			t.Errorf("expected the oldest bundle to be deleted")
+		}
+	}
+}
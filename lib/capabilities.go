@@ -0,0 +1,214 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/base64"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// PrintableContentTypes are the document formats winspool prints, after
+// converting PostScript and HTML; ZPL and ESC/POS go to the printer as-is.
+var PrintableContentTypes = []string{
+	ContentTypePDF,
+	ContentTypePostScript,
+	ContentTypePWGRaster,
+	ContentTypeURF,
+	ContentTypePNG,
+	ContentTypeJPEG,
+	ContentTypeTIFF,
+	ContentTypeText,
+	ContentTypeHTML,
+	ContentTypeLayout,
+	ContentTypeZPL,
+	ContentTypeESCPOS,
+}
+
+// IDs of the vendor capabilities of full printer descriptions.
+const (
+	MediaTypeID       = "media_type"
+	StapleID          = "staple"
+	PrinterLanguageID = "printer_language"
+)
+
+// Resolution is a resolution a driver prints at, in dots per inch.
+type Resolution struct {
+	X, Y int32
+}
+
+// DriverCapabilities is what a driver reports besides the description
+// GetPrinters builds, which is mostly informational: the driver picks the
+// resolution, and vendor capabilities aren't applied to jobs.
+type DriverCapabilities struct {
+	// DC_ENUMRESOLUTIONS, and the resolution of the default DEVMODE.
+	Resolutions       []Resolution
+	DefaultResolution Resolution
+	// DC_MEDIATYPES and DC_MEDIATYPENAMES, and the dmMediaType of the
+	// default DEVMODE, zero when unset.
+	MediaTypes       []uint32
+	MediaTypeNames   []string
+	DefaultMediaType uint32
+	// DC_STAPLE.
+	Staple bool
+	// DC_PERSONALITY: the printer languages the driver speaks, such as PCL.
+	Personalities []string
+	// The whole default DEVMODE, including the private part of the driver,
+	// as printer devmode dump exports it.
+	DevMode []byte
+}
+
+var pdfPersonality = regexp.MustCompile(`(?i)\bPDF`)
+
+// Ports of printers that print to files, whose drivers write PDFs rather
+// than read them.
+var fileOutputPorts = map[string]bool{"FILE:": true, "PORTPROMPT:": true, "NUL:": true}
+
+// SpeaksPDF tells whether the driver of a printer on a port interprets PDF
+// itself, as one of its printer languages, such as "PDF" or "Adobe PDF 1.7",
+// tells. PDFs are then sent to it as-is.
+func SpeaksPDF(portName string, personalities []string) bool {
+	if fileOutputPorts[strings.ToUpper(portName)] {
+		return false
+	}
+	for _, personality := range personalities {
+		if pdfPersonality.MatchString(personality) {
+			return true
+		}
+	}
+	return false
+}
+
+// FullDescription adds what winspool and a driver support to the
+// description of a printer, as GetPrinters reports it. Returns a copy.
+func FullDescription(description *model.PrinterDescriptionSection, driver *DriverCapabilities) *model.PrinterDescriptionSection {
+	var full model.PrinterDescriptionSection
+	if description != nil {
+		full = *description
+	}
+
+	contentTypes := make([]model.SupportedContentType, 0, len(PrintableContentTypes))
+	for _, contentType := range PrintableContentTypes {
+		contentTypes = append(contentTypes, model.SupportedContentType{ContentType: contentType})
+	}
+	full.SupportedContentType = &contentTypes
+	// Page ranges are applied when pages are rendered, whatever the driver.
+	full.PageRange = &model.PageRange{Interval: []model.PageRangeInterval{{Start: 1}}}
+
+	if driver == nil {
+		return &full
+	}
+	if dpi := resolutionsToDPI(driver.Resolutions, driver.DefaultResolution); dpi != nil {
+		full.DPI = dpi
+	}
+
+	var vendorCapabilities []model.VendorCapability
+	if full.VendorCapability != nil {
+		vendorCapabilities = append(vendorCapabilities, *full.VendorCapability...)
+	}
+	if len(driver.MediaTypes) > 0 && len(driver.MediaTypes) == len(driver.MediaTypeNames) {
+		selectCap := model.SelectCapability{}
+		for i, mediaType := range driver.MediaTypes {
+			selectCap.Option = append(selectCap.Option, model.SelectCapabilityOption{
+				Value:                strconv.FormatUint(uint64(mediaType), 10),
+				IsDefault:            mediaType == driver.DefaultMediaType,
+				DisplayNameLocalized: model.NewLocalizedString(driver.MediaTypeNames[i]),
+			})
+		}
+		vendorCapabilities = append(vendorCapabilities, model.VendorCapability{
+			ID:                   MediaTypeID,
+			Type:                 model.VendorCapabilitySelect,
+			SelectCap:            &selectCap,
+			DisplayNameLocalized: model.NewLocalizedString("Media type"),
+		})
+	}
+	if driver.Staple {
+		vendorCapabilities = append(vendorCapabilities, model.VendorCapability{
+			ID:                   StapleID,
+			Type:                 model.VendorCapabilityTypedValue,
+			TypedValueCap:        &model.TypedValueCapability{ValueType: model.TypedValueCapabilityTypeBoolean, Default: "false"},
+			DisplayNameLocalized: model.NewLocalizedString("Staple"),
+		})
+	}
+	if len(driver.Personalities) > 0 {
+		selectCap := model.SelectCapability{}
+		for i, personality := range driver.Personalities {
+			selectCap.Option = append(selectCap.Option, model.SelectCapabilityOption{
+				Value:     personality,
+				IsDefault: i == 0,
+			})
+		}
+		vendorCapabilities = append(vendorCapabilities, model.VendorCapability{
+			ID:                   PrinterLanguageID,
+			Type:                 model.VendorCapabilitySelect,
+			SelectCap:            &selectCap,
+			DisplayNameLocalized: model.NewLocalizedString("Printer language"),
+		})
+	}
+	if len(driver.DevMode) > 0 {
+		vendorCapabilities = append(vendorCapabilities, model.VendorCapability{
+			ID:   DevModeID,
+			Type: model.VendorCapabilityTypedValue,
+			TypedValueCap: &model.TypedValueCapability{
+				ValueType: model.TypedValueCapabilityTypeString,
+				Default:   base64.StdEncoding.EncodeToString(driver.DevMode),
+			},
+			DisplayNameLocalized: model.NewLocalizedString("Default DEVMODE"),
+		})
+	}
+	if len(vendorCapabilities) > 0 {
+		full.VendorCapability = &vendorCapabilities
+	}
+	return &full
+}
+
+// resolutionsToDPI converts driver resolutions; the default is the first
+// one when none matches def.
+func resolutionsToDPI(resolutions []Resolution, def Resolution) *model.DPI {
+	if len(resolutions) == 0 {
+		return nil
+	}
+	dpi := model.DPI{Option: make([]model.DPIOption, 0, len(resolutions))}
+	var foundDef bool
+	for _, r := range resolutions {
+		if r.X <= 0 || r.Y <= 0 {
+			continue
+		}
+		isDefault := !foundDef && r == def
+		foundDef = foundDef || isDefault
+		dpi.Option = append(dpi.Option, model.DPIOption{
+			HorizontalDPI: r.X,
+			VerticalDPI:   r.Y,
+			IsDefault:     isDefault,
+			VendorID:      strconv.Itoa(int(r.X)) + "x" + strconv.Itoa(int(r.Y)),
+		})
+		if dpi.MinHorizontalDPI == 0 || r.X < dpi.MinHorizontalDPI {
+			dpi.MinHorizontalDPI = r.X
+		}
+		if r.X > dpi.MaxHorizontalDPI {
+			dpi.MaxHorizontalDPI = r.X
+		}
+		if dpi.MinVerticalDPI == 0 || r.Y < dpi.MinVerticalDPI {
+			dpi.MinVerticalDPI = r.Y
+		}
+		if r.Y > dpi.MaxVerticalDPI {
+			dpi.MaxVerticalDPI = r.Y
+		}
+	}
+	if len(dpi.Option) == 0 {
+		return nil
+	}
+	if !foundDef {
+		dpi.Option[0].IsDefault = true
+	}
+	return &dpi
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestFullDescription(t *testing.T) {
+	labelCapability := model.VendorCapability{ID: LabelDarknessID, Type: model.VendorCapabilityRange}
+	description := &model.PrinterDescriptionSection{
+		Copies:           &model.Copies{Default: 1, Max: 99},
+		VendorCapability: &[]model.VendorCapability{labelCapability},
+	}
+	driver := &DriverCapabilities{
+		Resolutions:       []Resolution{{300, 300}, {600, 600}, {0, 0}, {1200, 600}},
+		DefaultResolution: Resolution{600, 600},
+		MediaTypes:        []uint32{1, 2, 257},
+		MediaTypeNames:    []string{"Plain", "Transparency", "Labels"},
+		DefaultMediaType:  257,
+		Staple:            true,
+		Personalities:     []string{"PCL", "POSTSCRIPT"},
+		DevMode:           []byte{1, 2, 3},
+	}
+
+	full := FullDescription(description, driver)
+	if full.Copies != description.Copies {
+		t.Error("expected the description to be kept")
+	}
+	if len(*description.VendorCapability) != 1 {
+		t.Error("expected the description not to change")
+	}
+	if full.SupportedContentType == nil || len(*full.SupportedContentType) != len(PrintableContentTypes) || (*full.SupportedContentType)[0].ContentType != ContentTypePDF {
+		t.Errorf("unexpected content types %+v", full.SupportedContentType)
+	}
+	if full.PageRange == nil {
+		t.Error("expected page ranges")
+	}
+
+	if full.DPI == nil || len(full.DPI.Option) != 3 {
+		t.Fatalf("unexpected DPI %+v", full.DPI)
+	}
+	if !full.DPI.Option[1].IsDefault || full.DPI.Option[0].IsDefault || full.DPI.Option[1].VendorID != "600x600" {
+		t.Errorf("expected 600 DPI default, got %+v", full.DPI.Option)
+	}
+	if full.DPI.MinHorizontalDPI != 300 || full.DPI.MaxHorizontalDPI != 1200 || full.DPI.MinVerticalDPI != 300 || full.DPI.MaxVerticalDPI != 600 {
+		t.Errorf("unexpected DPI range %+v", full.DPI)
+	}
+
+	capabilities := map[string]model.VendorCapability{}
+	for _, c := range *full.VendorCapability {
+		capabilities[c.ID] = c
+	}
+	if len(capabilities) != 5 {
+		t.Fatalf("unexpected vendor capabilities %+v", *full.VendorCapability)
+	}
+	if _, ok := capabilities[LabelDarknessID]; !ok {
+		t.Error("expected the label capability to be kept")
+	}
+	mediaType := capabilities[MediaTypeID]
+	if mediaType.SelectCap == nil || len(mediaType.SelectCap.Option) != 3 || !mediaType.SelectCap.Option[2].IsDefault || mediaType.SelectCap.Option[2].Value != "257" {
+		t.Errorf("unexpected media types %+v", mediaType.SelectCap)
+	}
+	if staple := capabilities[StapleID]; staple.TypedValueCap == nil || staple.TypedValueCap.ValueType != model.TypedValueCapabilityTypeBoolean {
+		t.Errorf("unexpected staple capability %+v", staple)
+	}
+	if language := capabilities[PrinterLanguageID]; language.SelectCap == nil || len(language.SelectCap.Option) != 2 || !language.SelectCap.Option[0].IsDefault {
+		t.Errorf("unexpected printer languages %+v", language.SelectCap)
+	}
+	if devMode := capabilities[DevModeID]; devMode.TypedValueCap == nil || devMode.TypedValueCap.Default != base64.StdEncoding.EncodeToString(driver.DevMode) {
+		t.Errorf("unexpected DEVMODE capability %+v", devMode)
+	}
+
+	// Media types without names are left out; without resolutions, the DPI
+	// of the description is kept.
+	dpi := &model.DPI{Option: []model.DPIOption{{HorizontalDPI: 203, VerticalDPI: 203, IsDefault: true}}}
+	full = FullDescription(&model.PrinterDescriptionSection{DPI: dpi}, &DriverCapabilities{MediaTypes: []uint32{1}})
+	if full.DPI != dpi || full.VendorCapability != nil {
+		t.Errorf("unexpected description %+v", full)
+	}
+}
+
+func TestSpeaksPDF(t *testing.T) {
+	tests := []struct {
+		port          string
+		personalities []string
+		speaks        bool
+	}{
+		{"IP_10.0.0.5", []string{"PCL", "POSTSCRIPT", "PDF"}, true},
+		{"IP_10.0.0.5", []string{"Adobe PDF 1.7"}, true},
+		{"WSD-1234", []string{"pdf"}, true},
+		{"IP_10.0.0.5", []string{"PCL", "PCLXL"}, false},
+		{"USB001", nil, false},
+		{"PORTPROMPT:", []string{"PDF"}, false},
+		{"file:", []string{"PDF"}, false},
+	}
+	for _, test := range tests {
+		if speaks := SpeaksPDF(test.port, test.personalities); speaks != test.speaks {
+			t.Errorf("expected %v for %v on %s, got %v", test.speaks, test.personalities, test.port, speaks)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// CapabilityOverrides mask capabilities a printer driver reports, such as
+// color on a printer that must print monochrome or a broken tray. Masked
+// options are left out of the printer description, and tickets asking for
+// them are refused.
+type CapabilityOverrides struct {
+	// Color types hidden, e.g. ["STANDARD_COLOR"] to enforce monochrome.
+	// Jobs without a color are printed in the default of the remaining
+	// types.
+	HideColors []model.ColorType `json:"hide_colors,omitempty"`
+
+	// Only one-sided printing is advertised, and jobs print one-sided.
+	NoDuplex bool `json:"no_duplex,omitempty"`
+
+	// Most copies of a job, when positive.
+	MaxCopies int32 `json:"max_copies,omitempty"`
+
+	// Trays hidden, by type, such as "LOWER", vendor ID or display name.
+	// Jobs without a tray are fed from the default of the remaining ones.
+	HideMediaSources []string `json:"hide_media_sources,omitempty"`
+
+	// Paper sizes hidden, by name, such as "ISO_A3". Custom sizes are then
+	// refused too, unless they match a remaining size.
+	HideMediaSizes []model.MediaSizeName `json:"hide_media_sizes,omitempty"`
+}
+
+// Validate checks the color types and copies.
+func (o *CapabilityOverrides) Validate() error {
+	for _, colorType := range o.HideColors {
+		switch colorType {
+		case model.ColorTypeStandardColor, model.ColorTypeStandardMonochrome, model.ColorTypeCustomColor, model.ColorTypeCustomMonochrome, model.ColorTypeAuto:
+		default:
+			return fmt.Errorf("unknown color type %q", colorType)
+		}
+	}
+	if o.MaxCopies < 0 {
+		return fmt.Errorf("max_copies must not be negative, got %d", o.MaxCopies)
+	}
+	return nil
+}
+
+// Apply returns the description with the overrides applied. The description
+// is not changed, so that cached descriptions can be passed; applying the
+// overrides again changes nothing.
+func (o *CapabilityOverrides) Apply(description *model.PrinterDescriptionSection) *model.PrinterDescriptionSection {
+	if o == nil || description == nil {
+		return description
+	}
+	overridden := *description
+
+	if len(o.HideColors) > 0 && description.Color != nil {
+		var options []model.ColorOption
+		defaultHidden := false
+		for _, option := range description.Color.Option {
+			if o.hidesColor(option.Type) {
+				defaultHidden = defaultHidden || option.IsDefault
+			} else {
+				options = append(options, option)
+			}
+		}
+		if len(options) == 0 {
+			overridden.Color = nil
+		} else {
+			if defaultHidden {
+				options[0].IsDefault = true
+			}
+			overridden.Color = &model.Color{Option: options}
+		}
+	}
+
+	if o.NoDuplex && description.Duplex != nil {
+		overridden.Duplex = &model.Duplex{Option: []model.DuplexOption{{Type: model.DuplexNoDuplex, IsDefault: true}}}
+	}
+
+	if o.MaxCopies > 0 && description.Copies != nil {
+		copies := *description.Copies
+		if copies.Max <= 0 || copies.Max > o.MaxCopies {
+			copies.Max = o.MaxCopies
+		}
+		if copies.Default > copies.Max {
+			copies.Default = copies.Max
+		}
+		overridden.Copies = &copies
+	}
+
+	if len(o.HideMediaSources) > 0 && description.MediaSource != nil {
+		var options []model.MediaSourceOption
+		defaultHidden := false
+		for _, option := range description.MediaSource.Option {
+			if o.hidesMediaSource(option) {
+				defaultHidden = defaultHidden || option.IsDefault
+			} else {
+				options = append(options, option)
+			}
+		}
+		if len(options) == 0 {
+			overridden.MediaSource = nil
+		} else {
+			if defaultHidden {
+				options[0].IsDefault = true
+			}
+			overridden.MediaSource = &model.MediaSource{Option: options}
+		}
+	}
+
+	if len(o.HideMediaSizes) > 0 && description.MediaSize != nil {
+		mediaSize := *description.MediaSize
+		mediaSize.Option = nil
+		defaultHidden := false
+		for _, option := range description.MediaSize.Option {
+			if o.hidesMediaSize(option.Name) {
+				defaultHidden = defaultHidden || option.IsDefault
+			} else {
+				mediaSize.Option = append(mediaSize.Option, option)
+			}
+		}
+		if len(mediaSize.Option) == 0 {
+			overridden.MediaSize = nil
+		} else {
+			if defaultHidden {
+				mediaSize.Option[0].IsDefault = true
+			}
+			overridden.MediaSize = &mediaSize
+		}
+	}
+
+	return &overridden
+}
+
+// EnforceTicket checks a ticket against the description the overrides were
+// applied to, and returns it with the defaults of masked options set, so
+// that the driver defaults don't print what was masked. A *model.TicketError
+// lists the options asked for that are masked.
+func (o *CapabilityOverrides) EnforceTicket(description *model.PrinterDescriptionSection, ticket *model.JobTicket) (*model.JobTicket, error) {
+	if o == nil {
+		return ticket, nil
+	}
+	if description == nil {
+		description = &model.PrinterDescriptionSection{}
+	}
+	enforced := *ticket
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if len(o.HideColors) > 0 {
+		if ticket.Color != nil {
+			if o.hidesColor(ticket.Color.Type) {
+				add("color %s is not allowed on this printer", ticket.Color.Type)
+			} else if ticket.Color.VendorID != "" && description.Color != nil && !hasColorVendorID(description.Color, ticket.Color.VendorID) {
+				add("color vendor_id %s is not allowed on this printer", ticket.Color.VendorID)
+			}
+		} else if description.Color != nil {
+			for _, option := range description.Color.Option {
+				if option.IsDefault {
+					enforced.Color = &model.ColorTicketItem{VendorID: option.VendorID, Type: option.Type}
+				}
+			}
+		}
+	}
+
+	if o.NoDuplex {
+		if ticket.Duplex != nil && ticket.Duplex.Type != model.DuplexNoDuplex {
+			add("duplex %s is not allowed on this printer", ticket.Duplex.Type)
+		} else if ticket.Booklet != nil && ticket.Booklet.Booklet {
+			add("booklets are not allowed on this printer, as they print duplex")
+		} else if ticket.Duplex == nil && description.Duplex != nil {
+			enforced.Duplex = &model.DuplexTicketItem{Type: model.DuplexNoDuplex}
+		}
+	}
+
+	if o.MaxCopies > 0 && ticket.Copies != nil && ticket.Copies.Copies > o.MaxCopies {
+		add("copies.copies must be at most %d on this printer, got %d", o.MaxCopies, ticket.Copies.Copies)
+	}
+
+	if len(o.HideMediaSources) > 0 {
+		// AUTO is fed from the default tray too, as the driver may pick a
+		// hidden one.
+		if source := ticket.MediaSource; source != nil && (source.Type != model.MediaSourceAuto || source.VendorID != "") {
+			if o.hidesMediaSource(model.MediaSourceOption{Type: source.Type, VendorID: source.VendorID}) {
+				add("media_source %s is not allowed on this printer", mediaSourceName(source))
+			} else if description.MediaSource != nil && !hasMediaSource(description.MediaSource, source) {
+				add("media_source %s is not allowed on this printer", mediaSourceName(source))
+			}
+		} else if description.MediaSource != nil {
+			for _, option := range description.MediaSource.Option {
+				if option.IsDefault {
+					enforced.MediaSource = &model.MediaSourceTicketItem{Type: option.Type, VendorID: option.VendorID}
+				}
+			}
+		}
+	}
+
+	if len(o.HideMediaSizes) > 0 && ticket.MediaSize != nil && description.MediaSize != nil {
+		size := ticket.MediaSize
+		if size.VendorID != "" {
+			if _, ok := MediaSizeByVendorID(description.MediaSize, size.VendorID); !ok {
+				add("media_size vendor_id %s is not allowed on this printer", size.VendorID)
+			}
+		} else if _, ok := MatchMediaSize(description.MediaSize, size.WidthMicrons, size.HeightMicrons, MediaSizeTolerance); !ok {
+			add("media_size %dx%d microns is not allowed on this printer", size.WidthMicrons, size.HeightMicrons)
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &model.TicketError{Problems: problems}
+	}
+	return &enforced, nil
+}
+
+func (o *CapabilityOverrides) hidesColor(colorType model.ColorType) bool {
+	for _, hidden := range o.HideColors {
+		if hidden == colorType {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *CapabilityOverrides) hidesMediaSource(option model.MediaSourceOption) bool {
+	for _, hidden := range o.HideMediaSources {
+		switch hidden {
+		case string(option.Type), option.VendorID, option.CustomDisplayName:
+			if hidden != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (o *CapabilityOverrides) hidesMediaSize(name model.MediaSizeName) bool {
+	for _, hidden := range o.HideMediaSizes {
+		if hidden == name {
+			return true
+		}
+	}
+	return false
+}
+
+func hasColorVendorID(color *model.Color, vendorID string) bool {
+	for _, option := range color.Option {
+		if option.VendorID == vendorID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMediaSource tells whether the ticket selects one of the trays: by
+// vendor ID when it has one, else by type.
+func hasMediaSource(mediaSource *model.MediaSource, source *model.MediaSourceTicketItem) bool {
+	for _, option := range mediaSource.Option {
+		if source.VendorID != "" && option.VendorID == source.VendorID {
+			return true
+		}
+		if source.VendorID == "" && option.Type == source.Type {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaSourceName(source *model.MediaSourceTicketItem) string {
+	if source.VendorID != "" {
+		return source.VendorID
+	}
+	return string(source.Type)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestCapabilityOverrides(t *testing.T) {
+	description := &model.PrinterDescriptionSection{
+		Color: &model.Color{Option: []model.ColorOption{
+			{VendorID: "2", Type: model.ColorTypeStandardColor, IsDefault: true},
+			{VendorID: "1", Type: model.ColorTypeStandardMonochrome},
+		}},
+		Duplex: &model.Duplex{Option: []model.DuplexOption{
+			{Type: model.DuplexNoDuplex},
+			{Type: model.DuplexLongEdge, IsDefault: true},
+		}},
+		Copies: &model.Copies{Default: 1, Max: 999},
+		MediaSource: &model.MediaSource{Option: []model.MediaSourceOption{
+			{Type: model.MediaSourceUpper, VendorID: "1", IsDefault: true},
+			{Type: model.MediaSourceLower, VendorID: "2"},
+		}},
+		MediaSize: &model.MediaSize{Option: []model.MediaSizeOption{
+			{Name: model.MediaSizeISOA4, WidthMicrons: 210000, HeightMicrons: 297000, VendorID: "9", IsDefault: true},
+			{Name: model.MediaSizeISOA3, WidthMicrons: 297000, HeightMicrons: 420000, VendorID: "8"},
+		}},
+	}
+	overrides := &CapabilityOverrides{
+		HideColors:       []model.ColorType{model.ColorTypeStandardColor},
+		NoDuplex:         true,
+		MaxCopies:        5,
+		HideMediaSources: []string{"UPPER"},
+		HideMediaSizes:   []model.MediaSizeName{model.MediaSizeISOA3},
+	}
+	if err := overrides.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	overridden := overrides.Apply(description)
+	if description.Color.Option[0].Type != model.ColorTypeStandardColor || description.Copies.Max != 999 {
+		t.Error("expected the description to be left as is")
+	}
+	expected := &model.PrinterDescriptionSection{
+		Color:       &model.Color{Option: []model.ColorOption{{VendorID: "1", Type: model.ColorTypeStandardMonochrome, IsDefault: true}}},
+		Duplex:      &model.Duplex{Option: []model.DuplexOption{{Type: model.DuplexNoDuplex, IsDefault: true}}},
+		Copies:      &model.Copies{Default: 1, Max: 5},
+		MediaSource: &model.MediaSource{Option: []model.MediaSourceOption{{Type: model.MediaSourceLower, VendorID: "2", IsDefault: true}}},
+		MediaSize:   &model.MediaSize{Option: description.MediaSize.Option[:1]},
+	}
+	if !reflect.DeepEqual(overridden, expected) {
+		t.Errorf("expected %+v, got %+v", expected, overridden)
+	}
+	if again := overrides.Apply(overridden); !reflect.DeepEqual(again, expected) {
+		t.Errorf("expected applying again to change nothing, got %+v", again)
+	}
+
+	// Masked options take the remaining defaults.
+	ticket, err := overrides.EnforceTicket(overridden, &model.JobTicket{Copies: &model.CopiesTicketItem{Copies: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTicket := &model.JobTicket{
+		Color:       &model.ColorTicketItem{VendorID: "1", Type: model.ColorTypeStandardMonochrome},
+		Duplex:      &model.DuplexTicketItem{Type: model.DuplexNoDuplex},
+		Copies:      &model.CopiesTicketItem{Copies: 5},
+		MediaSource: &model.MediaSourceTicketItem{Type: model.MediaSourceLower, VendorID: "2"},
+	}
+	if !reflect.DeepEqual(ticket, expectedTicket) {
+		t.Errorf("expected %+v, got %+v", expectedTicket, ticket)
+	}
+
+	_, err = overrides.EnforceTicket(overridden, &model.JobTicket{
+		Color:       &model.ColorTicketItem{Type: model.ColorTypeStandardColor},
+		Duplex:      &model.DuplexTicketItem{Type: model.DuplexLongEdge},
+		Copies:      &model.CopiesTicketItem{Copies: 6},
+		MediaSource: &model.MediaSourceTicketItem{VendorID: "1"},
+		MediaSize:   &model.MediaSizeTicketItem{WidthMicrons: 297000, HeightMicrons: 420000},
+	})
+	var ticketErr *model.TicketError
+	if !errors.As(err, &ticketErr) || len(ticketErr.Problems) != 5 {
+		t.Errorf("expected a ticket error with 5 problems, got %v", err)
+	}
+
+	if err := (&CapabilityOverrides{HideColors: []model.ColorType{"RED"}}).Validate(); err == nil {
+		t.Error("expected an unknown color type to be invalid")
+	}
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// DefaultCapabilityCacheTTL is how long printer capabilities are reused
+// when the config doesn't say.
+const DefaultCapabilityCacheTTL = time.Hour
+
+// CachedCapabilities is what is kept of a printer between listings: what
+// the driver capability calls and device queries return.
+type CachedCapabilities struct {
+	Description  *model.PrinterDescriptionSection
+	SerialNumber string
+	DeviceUUID   string
+	// The driver interprets PDF itself, as lib.SpeaksPDF tells.
+	SpeaksPDF bool
+}
+
+// CapabilityCache keeps the capabilities of printers for TTL, with a key of
+// what they are computed from, such as the port, driver and default DEVMODE
+// of the printer, so that listing printers repeatedly doesn't query drivers
+// each time. A printer whose key changed is a miss; changes the key misses,
+// such as a driver updated in place, call for Invalidate. The zero value is
+// a cache with DefaultCapabilityCacheTTL.
+type CapabilityCache struct {
+	mutex  sync.Mutex
+	ttl    time.Duration
+	ttlSet bool
+	// By printer name.
+	entries map[string]cachedCapabilitiesEntry
+	// Replaced by tests.
+	now func() time.Time
+}
+
+type cachedCapabilitiesEntry struct {
+	key          string
+	capabilities CachedCapabilities
+	expires      time.Time
+}
+
+// SetTTL sets how long capabilities are reused; zero disables the cache.
+func (c *CapabilityCache) SetTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ttl, c.ttlSet = ttl, true
+	if ttl <= 0 {
+		c.entries = nil
+	}
+}
+
+func (c *CapabilityCache) getTTL() time.Duration {
+	if !c.ttlSet {
+		return DefaultCapabilityCacheTTL
+	}
+	return c.ttl
+}
+
+func (c *CapabilityCache) getNow() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
+
+// Get returns the capabilities kept for a printer with key, with a copy of
+// the description, so that callers may change it.
+func (c *CapabilityCache) Get(printerName, key string) (CachedCapabilities, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[printerName]
+	if !ok || entry.key != key {
+		return CachedCapabilities{}, false
+	}
+	if !c.getNow().Before(entry.expires) {
+		delete(c.entries, printerName)
+		return CachedCapabilities{}, false
+	}
+	capabilities := entry.capabilities
+	if capabilities.Description != nil {
+		description := *capabilities.Description
+		capabilities.Description = &description
+	}
+	return capabilities, true
+}
+
+// Put keeps the capabilities of a printer with key, replacing those kept
+// with another key.
+func (c *CapabilityCache) Put(printerName, key string, capabilities CachedCapabilities) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ttl := c.getTTL()
+	if ttl <= 0 {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]cachedCapabilitiesEntry)
+	}
+	if capabilities.Description != nil {
+		description := *capabilities.Description
+		capabilities.Description = &description
+	}
+	c.entries[printerName] = cachedCapabilitiesEntry{key: key, capabilities: capabilities, expires: c.getNow().Add(ttl)}
+}
+
+// Invalidate drops the capabilities of all printers.
+func (c *CapabilityCache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = nil
+}
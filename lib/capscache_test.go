@@ -0,0 +1,58 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestCapabilityCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	c := CapabilityCache{now: func() time.Time { return now }}
+	capabilities := CachedCapabilities{
+		Description:  &model.PrinterDescriptionSection{Copies: &model.Copies{Default: 1, Max: 99}},
+		SerialNumber: "CN123",
+	}
+	c.Put("office", "driver v1", capabilities)
+
+	cached, ok := c.Get("office", "driver v1")
+	if !ok || cached.SerialNumber != "CN123" || cached.Description.Copies.Max != 99 {
+		t.Fatalf("expected the capabilities kept got %+v, %t", cached, ok)
+	}
+	cached.Description.Copies = nil
+	if cached, _ = c.Get("office", "driver v1"); cached.Description.Copies == nil {
+		t.Error("expected changes to a returned description not to change the cache")
+	}
+	if _, ok = c.Get("office", "driver v2"); ok {
+		t.Error("expected a miss once the driver changed")
+	}
+	if _, ok = c.Get("lobby", "driver v1"); ok {
+		t.Error("expected a miss for another printer")
+	}
+
+	now = now.Add(DefaultCapabilityCacheTTL)
+	if _, ok = c.Get("office", "driver v1"); ok {
+		t.Error("expected a miss after the TTL")
+	}
+
+	c.Put("office", "driver v1", capabilities)
+	c.Invalidate()
+	if _, ok = c.Get("office", "driver v1"); ok {
+		t.Error("expected a miss after Invalidate")
+	}
+
+	c.SetTTL(0)
+	c.Put("office", "driver v1", capabilities)
+	if _, ok = c.Get("office", "driver v1"); ok {
+		t.Error("expected nothing cached with a zero TTL")
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// CapabilityDiff is how a capability of two printers differs: the options
+// only one of them has, and their defaults. Options are "NO_DUPLEX", "600x600
+// dpi" or "A4 210x297 mm" and the like.
+type CapabilityDiff struct {
+	// CDD name of the capability, e.g. "media_size".
+	Capability string   `json:"capability"`
+	OnlyA      []string `json:"only_a,omitempty"`
+	OnlyB      []string `json:"only_b,omitempty"`
+	DefaultA   string   `json:"default_a,omitempty"`
+	DefaultB   string   `json:"default_b,omitempty"`
+}
+
+type capabilityOption struct {
+	// Options with the same key are the same on both printers.
+	key, label string
+	isDefault  bool
+}
+
+// DiffDescriptions compares the capabilities of two printers that tickets
+// select: media sizes, duplex, color, resolutions, trays, orientation,
+// copies and collate. Capabilities that are the same are left out. Media
+// sizes compare by dimensions, to the millimeter, since drivers name them
+// differently.
+func DiffDescriptions(a, b *model.PrinterDescriptionSection) []CapabilityDiff {
+	if a == nil {
+		a = &model.PrinterDescriptionSection{}
+	}
+	if b == nil {
+		b = &model.PrinterDescriptionSection{}
+	}
+	var diffs []CapabilityDiff
+	for _, capability := range []struct {
+		name    string
+		options func(*model.PrinterDescriptionSection) []capabilityOption
+	}{
+		{"media_size", mediaSizeOptions},
+		{"duplex", duplexOptions},
+		{"color", colorOptions},
+		{"dpi", dpiOptions},
+		{"media_source", mediaSourceOptions},
+		{"page_orientation", pageOrientationOptions},
+		{"copies", copiesOptions},
+		{"collate", collateOptions},
+	} {
+		if diff, differs := diffOptions(capability.options(a), capability.options(b)); differs {
+			diff.Capability = capability.name
+			diffs = append(diffs, diff)
+		}
+	}
+	return diffs
+}
+
+func diffOptions(a, b []capabilityOption) (CapabilityDiff, bool) {
+	var diff CapabilityDiff
+	onlyIn := func(options, others []capabilityOption) []string {
+		keys := map[string]bool{}
+		for _, option := range others {
+			keys[option.key] = true
+		}
+		var only []string
+		for _, option := range options {
+			if !keys[option.key] {
+				only = append(only, option.label)
+			}
+		}
+		return only
+	}
+	diff.OnlyA, diff.OnlyB = onlyIn(a, b), onlyIn(b, a)
+
+	var defaultA, defaultB capabilityOption
+	for _, option := range a {
+		if option.isDefault {
+			defaultA = option
+		}
+	}
+	for _, option := range b {
+		if option.isDefault {
+			defaultB = option
+		}
+	}
+	if defaultA.key != defaultB.key {
+		diff.DefaultA, diff.DefaultB = defaultA.label, defaultB.label
+	}
+	return diff, diff.OnlyA != nil || diff.OnlyB != nil || diff.DefaultA != "" || diff.DefaultB != ""
+}
+
+func displayName(name string, localized *[]model.LocalizedString) string {
+	if name == "" && localized != nil && len(*localized) > 0 {
+		return (*localized)[0].Value
+	}
+	return name
+}
+
+func mediaSizeOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.MediaSize == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.MediaSize.Option {
+		key := fmt.Sprintf("%dx%d mm", (o.WidthMicrons+500)/1000, (o.HeightMicrons+500)/1000)
+		if o.IsContinuousFeed {
+			key += " continuous"
+		}
+		name := MediaSizeDisplayName(&o)
+		label := key
+		if name != "" {
+			label = name + " " + key
+		}
+		options = append(options, capabilityOption{key: key, label: label, isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func duplexOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.Duplex == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.Duplex.Option {
+		options = append(options, capabilityOption{key: string(o.Type), label: string(o.Type), isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func colorOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.Color == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.Color.Option {
+		key := string(o.Type)
+		if o.Type == model.ColorTypeCustomColor || o.Type == model.ColorTypeCustomMonochrome {
+			key += " " + displayName(o.CustomDisplayName, o.CustomDisplayNameLocalized)
+		}
+		options = append(options, capabilityOption{key: key, label: key, isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func dpiOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.DPI == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.DPI.Option {
+		key := fmt.Sprintf("%dx%d dpi", o.HorizontalDPI, o.VerticalDPI)
+		options = append(options, capabilityOption{key: key, label: key, isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func mediaSourceOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.MediaSource == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.MediaSource.Option {
+		key := string(o.Type)
+		if name := displayName(o.CustomDisplayName, o.CustomDisplayNameLocalized); o.Type == model.MediaSourceCustom && name != "" {
+			key += " " + name
+		}
+		options = append(options, capabilityOption{key: key, label: key, isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func pageOrientationOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.PageOrientation == nil {
+		return nil
+	}
+	var options []capabilityOption
+	for _, o := range d.PageOrientation.Option {
+		options = append(options, capabilityOption{key: string(o.Type), label: string(o.Type), isDefault: o.IsDefault})
+	}
+	return options
+}
+
+func copiesOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.Copies == nil {
+		return nil
+	}
+	max := "max " + strconv.Itoa(int(d.Copies.Max))
+	return []capabilityOption{{key: max, label: max}}
+}
+
+func collateOptions(d *model.PrinterDescriptionSection) []capabilityOption {
+	if d.Collate == nil {
+		return nil
+	}
+	label := "supported, off by default"
+	if d.Collate.Default {
+		label = "supported, on by default"
+	}
+	return []capabilityOption{{key: label, label: label}}
+}
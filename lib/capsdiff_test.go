@@ -0,0 +1,52 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestDiffDescriptions(t *testing.T) {
+	a := &model.PrinterDescriptionSection{
+		MediaSize: &model.MediaSize{Option: []model.MediaSizeOption{
+			{Name: model.MediaSizeCustom, CustomDisplayNameLocalized: model.NewLocalizedString("A4"), WidthMicrons: 210000, HeightMicrons: 297000, IsDefault: true},
+			{Name: model.MediaSizeCustom, CustomDisplayNameLocalized: model.NewLocalizedString("Letter"), WidthMicrons: 215900, HeightMicrons: 279400},
+		}},
+		Duplex: &model.Duplex{Option: []model.DuplexOption{
+			{Type: model.DuplexNoDuplex, IsDefault: true},
+			{Type: model.DuplexLongEdge},
+		}},
+		Color:  &model.Color{Option: []model.ColorOption{{Type: model.ColorTypeStandardMonochrome, IsDefault: true}}},
+		Copies: &model.Copies{Default: 1, Max: 99},
+	}
+	b := &model.PrinterDescriptionSection{
+		MediaSize: &model.MediaSize{Option: []model.MediaSizeOption{
+			// Same size as A4 on a, named by another driver.
+			{Name: model.MediaSizeCustom, CustomDisplayNameLocalized: model.NewLocalizedString("A4 (210 x 297 mm)"), WidthMicrons: 209900, HeightMicrons: 297000},
+			{Name: model.MediaSizeCustom, CustomDisplayNameLocalized: model.NewLocalizedString("Legal"), WidthMicrons: 215900, HeightMicrons: 355600, IsDefault: true},
+		}},
+		Color:  &model.Color{Option: []model.ColorOption{{Type: model.ColorTypeStandardMonochrome, IsDefault: true}}},
+		Copies: &model.Copies{Default: 1, Max: 999},
+	}
+
+	expected := []CapabilityDiff{
+		{Capability: "media_size", OnlyA: []string{"Letter 216x279 mm"}, OnlyB: []string{"Legal 216x356 mm"}, DefaultA: "A4 210x297 mm", DefaultB: "Legal 216x356 mm"},
+		{Capability: "duplex", OnlyA: []string{"NO_DUPLEX", "LONG_EDGE"}, DefaultA: "NO_DUPLEX"},
+		{Capability: "copies", OnlyA: []string{"max 99"}, OnlyB: []string{"max 999"}},
+	}
+	if diffs := DiffDescriptions(a, b); !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %+v got %+v", expected, diffs)
+	}
+	if diffs := DiffDescriptions(a, a); diffs != nil {
+		t.Errorf("expected no differences with itself got %+v", diffs)
+	}
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Replies to Page.printToPDF carry the whole PDF.
+const maxWebSocketMessage = 256 << 20
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// webSocketConn is a minimal RFC 6455 client, enough to talk to the Chrome
+// DevTools Protocol on localhost.
+type webSocketConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWebSocket(wsURL string, timeout time.Duration) (*webSocketConn, error) {
+	u, err := url.Parse(wsURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" {
+		return nil, fmt.Errorf("unsupported WebSocket URL %s", wsURL)
+	}
+	conn, err := net.DialTimeout("tcp", u.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := fmt.Sprintf("GET %s HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\n\r\n", u.RequestURI(), u.Host, key)
+	if _, err = io.WriteString(conn, request); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	response, err := http.ReadResponse(r, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	if response.StatusCode != http.StatusSwitchingProtocols ||
+		response.Header.Get("Sec-WebSocket-Accept") != base64.StdEncoding.EncodeToString(accept[:]) {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake with %s failed: %s", wsURL, response.Status)
+	}
+
+	return &webSocketConn{conn: conn, r: r}, nil
+}
+
+func (c *webSocketConn) Close() error {
+	return c.conn.Close()
+}
+
+// writeFrame sends a single masked frame, as clients must.
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, 0x80|byte(n))
+	case n <= 0xffff:
+		header = append(header, 0x80|126, byte(n>>8), byte(n))
+	default:
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(n))
+		header = append(append(header, 0x80|127), b[:]...)
+	}
+	mask := make([]byte, 4)
+	rand.Read(mask)
+	header = append(header, mask...)
+
+	masked := make([]byte, len(payload))
+	for i, b := range payload {
+		masked[i] = b ^ mask[i%4]
+	}
+	_, err := c.conn.Write(append(header, masked...))
+	return err
+}
+
+// readMessage returns the next text or binary message, answering pings.
+func (c *webSocketConn) readMessage() ([]byte, error) {
+	var message []byte
+	for {
+		var header [2]byte
+		if _, err := io.ReadFull(c.r, header[:]); err != nil {
+			return nil, err
+		}
+		fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+		length := uint64(header[1] & 0x7f)
+		switch length {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(c.r, b[:]); err != nil {
+				return nil, err
+			}
+			length = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(c.r, b[:]); err != nil {
+				return nil, err
+			}
+			length = binary.BigEndian.Uint64(b[:])
+		}
+		if length > maxWebSocketMessage || uint64(len(message))+length > maxWebSocketMessage {
+			return nil, errors.New("WebSocket message too large")
+		}
+		var mask []byte
+		if header[1]&0x80 != 0 {
+			mask = make([]byte, 4)
+			if _, err := io.ReadFull(c.r, mask); err != nil {
+				return nil, err
+			}
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.r, payload); err != nil {
+			return nil, err
+		}
+		if mask != nil {
+			for i := range payload {
+				payload[i] ^= mask[i%4]
+			}
+		}
+
+		switch opcode {
+		case 0x0, 0x1, 0x2: // Continuation, text, binary.
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		case 0x8:
+			return nil, errors.New("WebSocket closed by peer")
+		case 0x9:
+			if err := c.writeFrame(0xa, payload); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// cdpClient sends Chrome DevTools Protocol commands over a browser connection,
+// using flattened sessions for page targets.
+type cdpClient struct {
+	ws     *webSocketConn
+	nextID int
+}
+
+type cdpMessage struct {
+	ID        int             `json:"id,omitempty"`
+	Method    string          `json:"method,omitempty"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Params    interface{}     `json:"params,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Error     *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// call sends a command and waits for its reply. Events received meanwhile
+// are passed to onEvent, when not nil.
+func (c *cdpClient) call(sessionID, method string, params interface{}, result interface{}, onEvent func(cdpMessage)) error {
+	c.nextID++
+	id := c.nextID
+	request, err := json.Marshal(cdpMessage{ID: id, Method: method, SessionID: sessionID, Params: params})
+	if err != nil {
+		return err
+	}
+	if err = c.ws.writeFrame(0x1, request); err != nil {
+		return err
+	}
+
+	for {
+		m, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		if m.ID != id {
+			if m.ID == 0 && onEvent != nil {
+				onEvent(m)
+			}
+			continue
+		}
+		if m.Error != nil {
+			return fmt.Errorf("%s failed: %s", method, m.Error.Message)
+		}
+		if result != nil {
+			return json.Unmarshal(m.Result, result)
+		}
+		return nil
+	}
+}
+
+func (c *cdpClient) readMessage() (cdpMessage, error) {
+	var m cdpMessage
+	b, err := c.ws.readMessage()
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// waitEvent waits for an event of a session, unless it was already seen.
+func (c *cdpClient) waitEvent(sessionID, method string, seen bool) error {
+	for !seen {
+		m, err := c.readMessage()
+		if err != nil {
+			return err
+		}
+		seen = m.ID == 0 && m.Method == method && m.SessionID == sessionID
+	}
+	return nil
+}
+
+// Requests to these are failed when the network is blocked; the page itself
+// is a file:// URL.
+var cdpNetworkURLs = []string{"http://*", "https://*", "ws://*", "wss://*", "ftp://*"}
+
+// printToPDF opens a page on the browser, loads pageURL and returns the page
+// printed to PDF with the given Page.printToPDF parameters.
+func (c *cdpClient) printToPDF(pageURL string, params map[string]interface{}, blockNetwork bool) ([]byte, error) {
+	var target struct {
+		TargetID string `json:"targetId"`
+	}
+	if err := c.call("", "Target.createTarget", map[string]interface{}{"url": "about:blank"}, &target, nil); err != nil {
+		return nil, err
+	}
+	var session struct {
+		SessionID string `json:"sessionId"`
+	}
+	if err := c.call("", "Target.attachToTarget", map[string]interface{}{"targetId": target.TargetID, "flatten": true}, &session, nil); err != nil {
+		return nil, err
+	}
+	if err := c.call(session.SessionID, "Page.enable", nil, nil, nil); err != nil {
+		return nil, err
+	}
+	if blockNetwork {
+		if err := c.call(session.SessionID, "Network.enable", nil, nil, nil); err != nil {
+			return nil, err
+		}
+		if err := c.call(session.SessionID, "Network.setBlockedURLs", map[string]interface{}{"urls": cdpNetworkURLs}, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var loaded bool
+	onEvent := func(m cdpMessage) {
+		if m.Method == "Page.loadEventFired" && m.SessionID == session.SessionID {
+			loaded = true
+		}
+	}
+	var navigation struct {
+		ErrorText string `json:"errorText"`
+	}
+	if err := c.call(session.SessionID, "Page.navigate", map[string]interface{}{"url": pageURL}, &navigation, onEvent); err != nil {
+		return nil, err
+	}
+	if navigation.ErrorText != "" {
+		return nil, fmt.Errorf("failed to load %s: %s", pageURL, navigation.ErrorText)
+	}
+	if err := c.waitEvent(session.SessionID, "Page.loadEventFired", loaded); err != nil {
+		return nil, err
+	}
+
+	var pdf struct {
+		Data string `json:"data"`
+	}
+	if err := c.call(session.SessionID, "Page.printToPDF", params, &pdf, nil); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(pdf.Data))
+}
@@ -0,0 +1,370 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// ConfigFilename is the default config file name, relative to the working directory.
+const ConfigFilename = "winspool.conf.json"
+
+type Config struct {
+	// How often to reconcile printers and jobs with the spooler. Changes are
+	// normally picked up from spooler notifications; this is the safety net.
+	NativePrinterPollInterval string `json:"native_printer_poll_interval,omitempty"`
+
+	// Maximum number of jobs printed concurrently per printer.
+	NativeJobQueueSize uint `json:"native_job_queue_size,omitempty"`
+
+	// How long the capabilities of printers are reused when listing them,
+	// e.g. "1h". They are queried again sooner when a driver, form or port
+	// changes. "0" queries drivers on every listing.
+	CapabilityCacheTTL string `json:"capability_cache_ttl,omitempty"`
+
+	// How calls that fail while the spooler service restarts are retried,
+	// such as {"attempts": 5, "initial_delay": "500ms", "max_delay": "10s"},
+	// the defaults. {"attempts": 1} doesn't retry.
+	SpoolerRetry *RetryConfig `json:"spooler_retry,omitempty"`
+
+	// Print server whose queues are managed, such as "\\\\PRINTSRV01",
+	// instead of those of this computer; --server overrides it.
+	PrintServer string `json:"print_server,omitempty"`
+	// List the printer connections of the user with the local printers.
+	PrinterConnections bool `json:"printer_connections,omitempty"`
+
+	// How long printer handles of job calls are kept open unused, e.g.
+	// "1m", the default. "0" opens a printer for each call.
+	PrinterHandleIdleTimeout string `json:"printer_handle_idle_timeout,omitempty"`
+
+	// Ghostscript executable used to convert PostScript jobs to PDF. Found
+	// in PATH when empty.
+	GhostscriptPath string `json:"ghostscript_path,omitempty"`
+
+	// Converter used to print HTML files and URLs. Chrome, Edge or Chromium,
+	// then wkhtmltopdf, are looked up when empty.
+	HTMLConverter HTMLConverter `json:"html_converter,omitempty"`
+
+	// Safety limits for rendering untrusted documents.
+	RenderLimits RenderLimits `json:"render_limits,omitempty"`
+
+	// PDF pages rendered at once, to images at up to render_dpi (300 when
+	// zero), while the previous pages spool, which speeds up large scanned
+	// documents. Vector pages are then printed as images too. Pages are
+	// drawn on the printer one at a time when below 2.
+	RenderWorkers int `json:"render_workers,omitempty"`
+	RenderDPI     int `json:"render_dpi,omitempty"`
+	// Renderer of PDFs, "poppler", the default, or "pdfium" in builds with
+	// it; printers override it with their own pdf_renderer.
+	PDFRenderer string `json:"pdf_renderer,omitempty"`
+	// Sends PDFs as-is to the printers whose driver speaks PDF, as its
+	// printer languages tell, as if they were pdf_direct, unless their
+	// pdf_direct is false.
+	PDFDirectDetect bool `json:"pdf_direct_detect,omitempty"`
+
+	// Document templates, such as delivery notes, by name: template files
+	// that write a layout from JSON data. See DocumentTemplate.
+	Templates map[string]string `json:"templates,omitempty"`
+	// Font family layout documents are rendered in, such as "Microsoft
+	// YaHei" for Chinese text; Arial when empty.
+	LayoutFont string `json:"layout_font,omitempty"`
+	// Font, size, margins, tab stops, header and footer plain text
+	// documents are rendered with, on printers without text_device_font or
+	// escp; the defaults of TextFormat when nil.
+	TextFormat *TextFormat `json:"text_format,omitempty"`
+
+	// Resume paused jobs of a printer when it comes back online, such as
+	// when a USB printer is plugged in again.
+	ResumeHeldJobsOnArrival bool `json:"resume_held_jobs_on_arrival,omitempty"`
+
+	// Time jobs interrupted by a paper out have to resume once paper is
+	// loaded, e.g. "1m". Jobs that haven't are restarted with
+	// restart_jobs_after_paper_out, and reported as not resumed otherwise.
+	PaperOutResumeTimeout string `json:"paper_out_resume_timeout,omitempty"`
+	// Print jobs that didn't resume after a paper out again from the start.
+	// Pages printed before the paper ran out are printed twice.
+	RestartJobsAfterPaperOut bool `json:"restart_jobs_after_paper_out,omitempty"`
+
+	// Folder the daemon keeps its job queue in, so that jobs are retried
+	// when the spooler fails and survive restarts. Jobs are printed right
+	// away, without retries, when empty.
+	JobQueueDir string `json:"job_queue_dir,omitempty"`
+	// Times a queued job is sent to the spooler before it fails; 10 when
+	// zero.
+	JobQueueMaxAttempts int `json:"job_queue_max_attempts,omitempty"`
+
+	// Where jobs are kept once finished: "store" deletes them from the
+	// Windows queue and keeps them in the job queue, "spooler" leaves them
+	// retained in the Windows queue until deleted there, and forgets them
+	// in the job queue once printed, "both" keeps them in both. When empty,
+	// jobs are released, and only printers that keep printed jobs show them.
+	JobRetention JobRetention `json:"job_retention,omitempty"`
+
+	// Named pipes the daemon accepts documents on, for legacy applications
+	// that can only print to a port or a pipe: what a client writes until
+	// it closes the pipe becomes a job.
+	Pipes []PipeConfig `json:"pipes,omitempty"`
+
+	// Folder the daemon writes a support bundle to when a job fails for
+	// good: a zip of its ticket, the DEVMODE and driver of the printer,
+	// print service events and the last log lines. Queued jobs keep its
+	// path. No bundles are written when empty.
+	SupportBundleDir string `json:"support_bundle_dir,omitempty"`
+	// Log lines kept for support bundles; 200 when zero.
+	SupportBundleLogLines int `json:"support_bundle_log_lines,omitempty"`
+
+	// File the daemon keeps per-printer queue and throughput metrics in.
+	// Metrics are only kept in memory when empty.
+	MetricsFile string `json:"metrics_file,omitempty"`
+
+	// URL that SLA breaches are posted to, as JSON.
+	SLAWebhook string `json:"sla_webhook,omitempty"`
+
+	// Secret shared by the coordinator and its agents: agents register
+	// with it, and clients send it to the coordinator, as a bearer token.
+	// Requests to the coordinator aren't authenticated when empty.
+	ClusterToken string `json:"cluster_token,omitempty"`
+
+	// Webhooks print system events are posted to by daemon and serve, each
+	// with the events its rules match. serve changes them at runtime at
+	// /events/routes, until it exits.
+	EventRoutes []EventRoute `json:"event_routes,omitempty"`
+
+	// Where daemon and serve record finished jobs: printer, user, document,
+	// pages and color, for chargeback.
+	Accounting *AccountingConfig `json:"accounting,omitempty"`
+
+	// Database file of the jobs held by the hold of their ticket, so that
+	// they can be released with a PIN, by another process than the one
+	// that printed them.
+	HeldJobsFile string `json:"held_jobs_file,omitempty"`
+
+	// Folder of the DEVMODEs "printer capture-devmode" keeps under a name,
+	// which the devmode_preset vendor ticket item of a job starts from.
+	DevModePresetsDir string `json:"devmode_presets_dir,omitempty"`
+
+	// Per-printer settings, keyed by native printer name.
+	Printers map[string]PrinterConfig `json:"printers,omitempty"`
+
+	// Named sets of printers that bulk operations, such as "printer pause
+	// --group", work on: printer names, or patterns such as "Label*".
+	PrinterGroups map[string][]string `json:"printer_groups,omitempty"`
+
+	// Printers that only exist in this process, for load and integration
+	// tests without hardware.
+	VirtualPrinters []VirtualPrinterConfig `json:"virtual_printers,omitempty"`
+
+	// Faults injected into spooler calls, for resilience tests only.
+	Faults []FaultConfig `json:"faults,omitempty"`
+}
+
+type PrinterConfig struct {
+	// Control sequences sent after every job, such as "feed:4" and "cut".
+	// See ParseControlSequences.
+	JobTrailer []string `json:"job_trailer,omitempty"`
+
+	// Query ESC/POS real-time status (cover, paper, cash drawer) when
+	// reading printer state. Only enable for ESC/POS printers on a
+	// bidirectional port.
+	ESCPOSStatus bool `json:"escpos_status,omitempty"`
+
+	// Command language of a thermal label printer, "zpl" or "tspl". Enables
+	// the darkness and print_speed vendor ticket items.
+	LabelLanguage LabelLanguage `json:"label_language,omitempty"`
+
+	// Identical ZPL labels sent as RAW jobs within this time of the first
+	// one, e.g. "2s", are printed as one job with a larger ^PQ quantity.
+	// Needs label_language "zpl". See LabelCoalescer.
+	CoalesceWindow string `json:"coalesce_window,omitempty"`
+
+	// Jobs with the same document and ticket as one submitted within this
+	// time, e.g. "30s", are duplicates, which duplicate_action "reject",
+	// the default, refuses, and "warn" prints with a warning. See
+	// DuplicateDetector.
+	DuplicateWindow string          `json:"duplicate_window,omitempty"`
+	DuplicateAction DuplicateAction `json:"duplicate_action,omitempty"`
+
+	// Service level expected from the printer; breaches are reported by
+	// daemon and serve.
+	SLA *SLAConfig `json:"sla,omitempty"`
+
+	// Device font plain text documents are printed in with TextOut, such as
+	// "Draft 10cpi" on dot-matrix printers, which are slow to print
+	// rendered pages. Plain text is not supported when empty.
+	TextDeviceFont string `json:"text_device_font,omitempty"`
+
+	// Page setup of an ESC/P dot-matrix printer. Plain text documents are
+	// then sent to the printer as ESC/P text in a RAW job, ahead of
+	// text_device_font, and forms can be filled with "job form".
+	ESCP *ESCPLayout `json:"escp,omitempty"`
+
+	// How plain text documents are rendered on the printer, instead of the
+	// global text_format.
+	TextFormat *TextFormat `json:"text_format,omitempty"`
+
+	// The printer interprets PDF itself: PDF documents are sent to it as-is
+	// in a RAW job, without rendering, and ticket options are ignored. The
+	// only way to print PDFs with builds without cgo. False renders PDFs
+	// even when pdf_direct_detect finds the driver speaks PDF.
+	PDFDirect *bool `json:"pdf_direct,omitempty"`
+
+	// Renderer of the PDFs of the printer, "poppler" or "pdfium", such as to
+	// compare them on a printer; the global pdf_renderer when empty.
+	PDFRenderer string `json:"pdf_renderer,omitempty"`
+
+	// Time of day the printer prints, such as "06:00-22:00", in local time.
+	// Jobs submitted outside of it are held by the spooler, and print when
+	// it opens, unless an administrator prints them now.
+	PrintWindow string `json:"print_window,omitempty"`
+
+	// Tenant, such as a customer or department, the printer belongs to,
+	// which event routes match on.
+	Tenant string `json:"tenant,omitempty"`
+
+	// Capabilities masked from what the driver reports, such as color or a
+	// broken tray, and refused in tickets.
+	Capabilities *CapabilityOverrides `json:"capabilities,omitempty"`
+
+	// Prices of sheets and sides, which "job simulate" prices jobs with.
+	Cost *CostConfig `json:"cost,omitempty"`
+}
+
+type SLAConfig struct {
+	// Longest time from submission to the first printed page, e.g. "2m".
+	StartWithin string `json:"start_within,omitempty"`
+	// Longest time from submission to the job being done, e.g. "15m".
+	FinishWithin string `json:"finish_within,omitempty"`
+}
+
+// GetStartWithin parses StartWithin; zero when empty.
+func (c *SLAConfig) GetStartWithin() (time.Duration, error) {
+	if c.StartWithin == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.StartWithin)
+}
+
+// GetFinishWithin parses FinishWithin; zero when empty.
+func (c *SLAConfig) GetFinishWithin() (time.Duration, error) {
+	if c.FinishWithin == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(c.FinishWithin)
+}
+
+// DefaultPipeMaxSize is the largest document a pipe accepts by default, in
+// bytes.
+const DefaultPipeMaxSize = 100 << 20
+
+// PipeConfig is a named pipe, \\.\pipe\<name>, that local applications write
+// documents to.
+type PipeConfig struct {
+	Name string `json:"name"`
+	// Printer the jobs print on; the default printer of the daemon user when
+	// empty.
+	Printer string `json:"printer,omitempty"`
+	// Job ticket file applied to the jobs.
+	Ticket string `json:"ticket,omitempty"`
+	// Send documents to the printer as-is, without the job queue, for
+	// printer languages that aren't detected, such as PCL. Otherwise the
+	// format is detected as with job add: PDF is rendered, and ZPL or
+	// ESC/POS sent as-is.
+	Raw bool `json:"raw,omitempty"`
+	// Largest document accepted, in bytes; DefaultPipeMaxSize when zero.
+	MaxSize int64 `json:"max_size,omitempty"`
+}
+
+// VirtualPrinterConfig defines a printer that accepts jobs like a spooler
+// queue, and writes their documents to a folder instead of printing them.
+type VirtualPrinterConfig struct {
+	Name string `json:"name"`
+	// Folder documents are written to; they are discarded when empty.
+	OutputDir string `json:"output_dir,omitempty"`
+	// Time before a job starts printing, and to print each page, e.g. "2s".
+	StartDelay string `json:"start_delay,omitempty"`
+	PageDelay  string `json:"page_delay,omitempty"`
+	// Fraction of jobs, from 0 to 1, that stop with an error partway
+	// through.
+	FailureRate float64 `json:"failure_rate,omitempty"`
+}
+
+// GetDelays parses StartDelay and PageDelay; zero when empty.
+func (c *VirtualPrinterConfig) GetDelays() (start, page time.Duration, err error) {
+	if c.StartDelay != "" {
+		if start, err = time.ParseDuration(c.StartDelay); err != nil {
+			return 0, 0, err
+		}
+	}
+	if c.PageDelay != "" {
+		if page, err = time.ParseDuration(c.PageDelay); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, page, nil
+}
+
+// DefaultConfig represents reasonable default values for Config fields.
+var DefaultConfig = Config{
+	NativePrinterPollInterval: "10m",
+	NativeJobQueueSize:        2,
+	PaperOutResumeTimeout:     "1m",
+	MetricsFile:               "winspool.metrics.json",
+}
+
+// GetConfig reads a Config from a JSON file. Fields missing from the file
+// keep their DefaultConfig values. A missing file yields the defaults.
+func GetConfig(filename string) (*Config, error) {
+	config := DefaultConfig
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &config, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(b, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// GetNativePrinterPollInterval parses NativePrinterPollInterval.
+func (c *Config) GetNativePrinterPollInterval() (time.Duration, error) {
+	return time.ParseDuration(c.NativePrinterPollInterval)
+}
+
+// GetCapabilityCacheTTL parses CapabilityCacheTTL; the default when empty.
+func (c *Config) GetCapabilityCacheTTL() (time.Duration, error) {
+	if c.CapabilityCacheTTL == "" {
+		return DefaultCapabilityCacheTTL, nil
+	}
+	return time.ParseDuration(c.CapabilityCacheTTL)
+}
+
+// GetPrinterHandleIdleTimeout parses PrinterHandleIdleTimeout; the default
+// when empty.
+func (c *Config) GetPrinterHandleIdleTimeout() (time.Duration, error) {
+	if c.PrinterHandleIdleTimeout == "" {
+		return DefaultHandleIdleTimeout, nil
+	}
+	return time.ParseDuration(c.PrinterHandleIdleTimeout)
+}
+
+// GetPaperOutResumeTimeout parses PaperOutResumeTimeout; the default when
+// empty.
+func (c *Config) GetPaperOutResumeTimeout() (time.Duration, error) {
+	if c.PaperOutResumeTimeout == "" {
+		return time.ParseDuration(DefaultConfig.PaperOutResumeTimeout)
+	}
+	return time.ParseDuration(c.PaperOutResumeTimeout)
+}
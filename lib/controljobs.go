@@ -0,0 +1,73 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "log"
+
+// ControlJobs send a document along with the control jobs of its printer,
+// in jobs of their own: label settings before it and a job trailer after
+// it, when not nil.
+type ControlJobs struct {
+	Settings []byte
+	Trailer  []byte
+
+	// Send queues a control job, held until resumed when held is set.
+	Send func(data []byte, held bool) (uint32, error)
+	// Resume lets a job held while the submission was queued print.
+	Resume func(jobID uint32) error
+	// Delete deletes a control job of a document that failed.
+	Delete func(jobID uint32) error
+}
+
+// Print sends the settings, the document with print and the trailer. The
+// jobs before the last are held until it's queued, then resumed, so that
+// the printer doesn't print jobs of other users submitted meanwhile between
+// them. When the document fails, the settings job is deleted, since it
+// would apply to whatever prints next. Once the document is queued,
+// failures are warnings of the result, so that callers don't print it
+// again.
+func (c *ControlJobs) Print(print func(held bool) (*PrintResult, error)) (*PrintResult, error) {
+	var jobIDs []uint32
+	if c.Settings != nil {
+		jobID, err := c.Send(c.Settings, true)
+		if err != nil {
+			return nil, err
+		}
+		jobIDs = append(jobIDs, jobID)
+	}
+
+	result, err := print(c.Trailer != nil)
+	if err != nil {
+		for _, jobID := range jobIDs {
+			if err := c.Delete(jobID); err != nil {
+				log.Printf("Failed to delete control job %d: %s", jobID, err)
+			}
+		}
+		return nil, err
+	}
+	result.JobIDs = append(jobIDs, result.JobID)
+	held := result.JobIDs[:len(jobIDs)]
+	if c.Trailer != nil {
+		held = result.JobIDs
+	}
+
+	if c.Trailer != nil {
+		if jobID, err := c.Send(c.Trailer, false); err != nil {
+			result.Warn("job_trailer", PrintWarningControlJob, "not sent: %s", err)
+		} else {
+			result.JobIDs = append(result.JobIDs, jobID)
+		}
+	}
+	for _, jobID := range held {
+		if err := c.Resume(jobID); err != nil {
+			result.Warn("document", PrintWarningControlJob, "job %d still held: %s", jobID, err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// controlQueue records the jobs of ControlJobs, numbered from 1.
+type controlQueue struct {
+	sent, held, resumed, deleted []uint32
+	trailerErr                   error
+}
+
+func (q *controlQueue) controlJobs(settings, trailer []byte) *ControlJobs {
+	return &ControlJobs{
+		Settings: settings,
+		Trailer:  trailer,
+		Send: func(data []byte, held bool) (uint32, error) {
+			if q.trailerErr != nil && string(data) == string(trailer) {
+				return 0, q.trailerErr
+			}
+			return q.queue(held), nil
+		},
+		Resume: func(jobID uint32) error {
+			q.resumed = append(q.resumed, jobID)
+			return nil
+		},
+		Delete: func(jobID uint32) error {
+			q.deleted = append(q.deleted, jobID)
+			return nil
+		},
+	}
+}
+
+func (q *controlQueue) queue(held bool) uint32 {
+	jobID := uint32(len(q.sent) + 1)
+	q.sent = append(q.sent, jobID)
+	if held {
+		q.held = append(q.held, jobID)
+	}
+	return jobID
+}
+
+func (q *controlQueue) print(held bool) (*PrintResult, error) {
+	return &PrintResult{JobID: q.queue(held)}, nil
+}
+
+func TestControlJobs(t *testing.T) {
+	var q controlQueue
+	result, err := q.controlJobs([]byte("^XA^PW400^XZ"), []byte("\x1dV\x01")).Print(q.print)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.JobID != 2 || !reflect.DeepEqual(result.JobIDs, []uint32{1, 2, 3}) {
+		t.Errorf("expected document 2 of jobs 1 to 3 got %d of %v", result.JobID, result.JobIDs)
+	}
+	// The settings and the document wait for the trailer.
+	if !reflect.DeepEqual(q.held, []uint32{1, 2}) || !reflect.DeepEqual(q.resumed, []uint32{1, 2}) {
+		t.Errorf("expected jobs 1 and 2 held then resumed got %v, %v", q.held, q.resumed)
+	}
+
+	// Without a trailer, the document is the last job, so isn't held.
+	q = controlQueue{}
+	if _, err = q.controlJobs([]byte("^XA^PW400^XZ"), nil).Print(q.print); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(q.held, []uint32{1}) || !reflect.DeepEqual(q.resumed, []uint32{1}) {
+		t.Errorf("expected the settings job held then resumed got %v, %v", q.held, q.resumed)
+	}
+
+	q = controlQueue{}
+	if result, err = q.controlJobs(nil, nil).Print(q.print); err != nil || len(q.held) != 0 || !reflect.DeepEqual(result.JobIDs, []uint32{1}) {
+		t.Errorf("expected the document alone got %+v, held %v: %v", result, q.held, err)
+	}
+}
+
+func TestControlJobsDocumentFails(t *testing.T) {
+	var q controlQueue
+	failed := errors.New("StartDocPrinter failed")
+	result, err := q.controlJobs([]byte("^XA^PW400^XZ"), []byte("\x1dV\x01")).Print(func(held bool) (*PrintResult, error) {
+		return nil, failed
+	})
+	if !errors.Is(err, failed) || result != nil {
+		t.Errorf("expected the document error got %+v, %v", result, err)
+	}
+	// The settings would apply to whatever prints next.
+	if !reflect.DeepEqual(q.deleted, []uint32{1}) || len(q.resumed) != 0 || len(q.sent) != 1 {
+		t.Errorf("expected the settings job deleted and no trailer got sent %v, deleted %v, resumed %v", q.sent, q.deleted, q.resumed)
+	}
+}
+
+func TestControlJobsTrailerFails(t *testing.T) {
+	q := controlQueue{trailerErr: fmt.Errorf("OpenPrinter failed")}
+	result, err := q.controlJobs(nil, []byte("\x1dV\x01")).Print(q.print)
+	// The document printed, so callers mustn't print it again.
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result.JobIDs, []uint32{1}) || len(result.Warnings) != 1 || result.Warnings[0].Reason != PrintWarningControlJob {
+		t.Errorf("expected the document with a trailer warning got %+v", result)
+	}
+	if !reflect.DeepEqual(q.resumed, []uint32{1}) || len(q.deleted) != 0 {
+		t.Errorf("expected the document resumed got resumed %v, deleted %v", q.resumed, q.deleted)
+	}
+}
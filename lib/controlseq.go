@@ -0,0 +1,61 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ESC/POS commands understood by most receipt printers.
+var controlSequencesByName = map[string][]byte{
+	"cut":          {0x1d, 0x56, 0x42, 0x00}, // GS V 66 0: feed to cutter, then full cut.
+	"partial_cut":  {0x1d, 0x56, 0x41, 0x00}, // GS V 65 0: feed to cutter, then partial cut.
+	"drawer_kick":  {0x1b, 0x70, 0x00, 0x19, 0xfa},
+	"drawer_kick2": {0x1b, 0x70, 0x01, 0x19, 0xfa},
+	"form_feed":    {0x0c},
+}
+
+// ParseControlSequences converts control sequence names from the config into
+// the bytes to send to the printer. Each item is one of:
+//
+//	cut, partial_cut, drawer_kick, drawer_kick2, form_feed
+//	feed:N        feed N lines (ESC d N)
+//	hex:1b640a    literal bytes
+func ParseControlSequences(items []string) ([]byte, error) {
+	var b []byte
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		switch {
+		case strings.HasPrefix(item, "hex:"):
+			raw, err := hex.DecodeString(strings.Replace(item[len("hex:"):], " ", "", -1))
+			if err != nil {
+				return nil, fmt.Errorf("invalid hex control sequence %q: %s", item, err)
+			}
+			b = append(b, raw...)
+
+		case strings.HasPrefix(item, "feed:"):
+			lines, err := strconv.ParseUint(item[len("feed:"):], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid feed control sequence %q, expected feed:0-255", item)
+			}
+			b = append(b, 0x1b, 0x64, byte(lines))
+
+		default:
+			seq, ok := controlSequencesByName[item]
+			if !ok {
+				return nil, fmt.Errorf("unknown control sequence %q", item)
+			}
+			b = append(b, seq...)
+		}
+	}
+	return b, nil
+}
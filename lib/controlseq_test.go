@@ -0,0 +1,31 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseControlSequences(t *testing.T) {
+	got, err := ParseControlSequences([]string{"feed:4", "cut", "hex:1b 70 00", "drawer_kick"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x1b, 0x64, 0x04, 0x1d, 0x56, 0x42, 0x00, 0x1b, 0x70, 0x00, 0x1b, 0x70, 0x00, 0x19, 0xfa}
+	if bytes.Compare(expected, got) != 0 {
+		t.Fatalf("expected %x got %x", expected, got)
+	}
+
+	for _, bad := range []string{"cutt", "feed:300", "feed:x", "hex:zz"} {
+		if _, err = ParseControlSequences([]string{bad}); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// ErrDriverMismatch is wrapped by the errors of DEVMODEs applied to a printer
+// with another driver, which would misread their private part.
+var ErrDriverMismatch = errors.New("DEVMODE is from another driver")
+
+// DevModeExport is the default DEVMODE of a printer queue, with the driver it
+// belongs to, so that it can be applied to the queues of other machines with
+// the same driver.
+type DevModeExport struct {
+	Printer       string `json:"printer"`
+	Driver        string `json:"driver"`
+	DriverVersion uint16 `json:"driver_version"`
+	// The whole DEVMODE, including the private part of the driver; base64
+	// in JSON.
+	DevMode []byte `json:"devmode"`
+}
+
+// CheckDriver checks that the DEVMODE can be applied to a printer with the
+// given driver.
+func (e *DevModeExport) CheckDriver(driver string, driverVersion uint16) error {
+	if !strings.EqualFold(e.Driver, driver) {
+		return fmt.Errorf("DEVMODE of %s doesn't apply to %s: %w", e.Driver, driver, ErrDriverMismatch)
+	}
+	if e.DriverVersion != driverVersion {
+		return fmt.Errorf("DEVMODE of %s version %#x doesn't apply to version %#x: %w", e.Driver, e.DriverVersion, driverVersion, ErrDriverMismatch)
+	}
+	return nil
+}
+
+// DevModeGetter is the part of a DEVMODE a DevModeSummary shows; the bools
+// tell whether the fields are set.
+type DevModeGetter interface {
+	GetCopies() (int16, bool)
+	GetColor() (int16, bool)
+	GetDuplex() (int16, bool)
+	GetOrientation() (int16, bool)
+	GetPaperSize() (int16, bool)
+	GetCollate() (int16, bool)
+}
+
+// DevModeSummary is what a job prints with, from its DEVMODE, for queue
+// listings. Fields the DEVMODE doesn't set are left empty.
+type DevModeSummary struct {
+	Copies      int                       `json:"copies,omitempty"`
+	Color       bool                      `json:"color"`
+	Duplex      model.DuplexType          `json:"duplex,omitempty"`
+	Orientation model.PageOrientationType `json:"orientation,omitempty"`
+	// DMPAPER value, such as 9 for A4.
+	PaperSize int16 `json:"paper_size,omitempty"`
+	Collate   bool  `json:"collate,omitempty"`
+}
+
+// SummarizeDevMode reads the summary of a DEVMODE.
+func SummarizeDevMode(devMode DevModeGetter) DevModeSummary {
+	var s DevModeSummary
+	if copies, ok := devMode.GetCopies(); ok {
+		s.Copies = int(copies)
+	}
+	if color, ok := devMode.GetColor(); ok {
+		s.Color = color == DevModeColorColor
+	}
+	if duplex, ok := devMode.GetDuplex(); ok {
+		for t, v := range duplexValueByType {
+			if v == duplex {
+				s.Duplex = t
+			}
+		}
+	}
+	if orientation, ok := devMode.GetOrientation(); ok {
+		for t, v := range pageOrientationByType {
+			if v == orientation {
+				s.Orientation = t
+			}
+		}
+	}
+	if paperSize, ok := devMode.GetPaperSize(); ok {
+		s.PaperSize = paperSize
+	}
+	if collate, ok := devMode.GetCollate(); ok {
+		s.Collate = collate == DevModeCollateTrue
+	}
+	return s
+}
+
+// Offsets of DEVMODEW fields, after the 32 WCHAR device name.
+const (
+	devModeDriverVersionOffset = 66
+	devModeSizeOffset          = 68
+	devModeDriverExtraOffset   = 70
+	// Up to dmFields, the least a DEVMODE has.
+	devModeMinSize = 76
+)
+
+// ParseDevModeHeader checks that data is a whole DEVMODEW, as its dmSize and
+// dmDriverExtra tell, and returns its dmDriverVersion.
+func ParseDevModeHeader(data []byte) (uint16, error) {
+	if len(data) < devModeMinSize {
+		return 0, fmt.Errorf("DEVMODE of %d bytes is too short", len(data))
+	}
+	size := int(binary.LittleEndian.Uint16(data[devModeSizeOffset:]))
+	driverExtra := int(binary.LittleEndian.Uint16(data[devModeDriverExtraOffset:]))
+	if size < devModeMinSize || size+driverExtra != len(data) {
+		return 0, fmt.Errorf("DEVMODE of %d bytes has dmSize %d and dmDriverExtra %d", len(data), size, driverExtra)
+	}
+	return binary.LittleEndian.Uint16(data[devModeDriverVersionOffset:]), nil
+}
+
+// Vendor ticket items of a DEVMODE the job starts from, before the ticket
+// options are applied, for the settings only the driver knows, such as
+// stapling or punching: DevModeID is a whole DEVMODE, base64 encoded as in
+// DevModeExport, and DevModePresetID the name of one captured in
+// DevModePresets. Full printer descriptions report the default DEVMODE as
+// the DevModeID vendor capability.
+const (
+	DevModeID       = "devmode"
+	DevModePresetID = "devmode_preset"
+)
+
+// TicketDevMode returns the DEVMODE of the vendor ticket items of a job on
+// printer, nil when it has none. Presets need presets.
+func TicketDevMode(printer string, ticket *model.JobTicket, presets *DevModePresets) (*DevModeExport, error) {
+	var export *DevModeExport
+	for _, item := range ticket.VendorTicketItem {
+		if item.ID != DevModeID && item.ID != DevModePresetID {
+			continue
+		}
+		if export != nil {
+			return nil, fmt.Errorf("ticket has more than one %s or %s vendor ticket item", DevModeID, DevModePresetID)
+		}
+		if item.ID == DevModePresetID {
+			if presets == nil {
+				return nil, fmt.Errorf("%s vendor ticket item needs a devmode_presets_dir", DevModePresetID)
+			}
+			var err error
+			if export, err = presets.Load(printer, item.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data, err := base64.StdEncoding.DecodeString(item.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s vendor ticket item is not base64: %s", DevModeID, err)
+		}
+		driverVersion, err := ParseDevModeHeader(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s vendor ticket item: %s", DevModeID, err)
+		}
+		export = &DevModeExport{Printer: printer, DriverVersion: driverVersion, DevMode: data}
+	}
+	return export, nil
+}
+
+// WithDevMode returns a copy of ticket with export as its only DEVMODE
+// vendor ticket item, for spoolers that don't read presets.
+func WithDevMode(ticket *model.JobTicket, export *DevModeExport) *model.JobTicket {
+	withDevMode := *ticket
+	withDevMode.VendorTicketItem = nil
+	for _, item := range ticket.VendorTicketItem {
+		if item.ID != DevModeID && item.ID != DevModePresetID {
+			withDevMode.VendorTicketItem = append(withDevMode.VendorTicketItem, item)
+		}
+	}
+	withDevMode.VendorTicketItem = append(withDevMode.VendorTicketItem, model.VendorTicketItem{
+		ID:    DevModeID,
+		Value: base64.StdEncoding.EncodeToString(export.DevMode),
+	})
+	return &withDevMode
+}
+
+var devModePresetName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// DevModePresets keeps DEVMODEs captured under a name, such as "staple" for
+// printing preferences with stapling on, as DevModeExport JSON files in Dir,
+// with a folder per printer.
+type DevModePresets struct {
+	Dir string
+}
+
+func (p *DevModePresets) printerDir(printer string) string {
+	// Printer names of shared printers have backslashes, as in \\server\name.
+	return filepath.Join(p.Dir, url.QueryEscape(printer))
+}
+
+func (p *DevModePresets) path(printer, name string) (string, error) {
+	if !devModePresetName.MatchString(name) {
+		return "", fmt.Errorf("DEVMODE preset name %q must be letters, digits, '.', '_' and '-'", name)
+	}
+	return filepath.Join(p.printerDir(printer), name+".json"), nil
+}
+
+// Save keeps the DEVMODE of export.Printer under name, replacing any preset
+// with that name.
+func (p *DevModePresets) Save(name string, export *DevModeExport) error {
+	fileName, err := p.path(export.Printer, name)
+	if err != nil {
+		return err
+	}
+	if _, err = ParseDevModeHeader(export.DevMode); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, data, 0644)
+}
+
+// Load returns the DEVMODE preset name of printer.
+func (p *DevModePresets) Load(printer, name string) (*DevModeExport, error) {
+	fileName, err := p.path(printer, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("printer %s has no DEVMODE preset %s", printer, name)
+	} else if err != nil {
+		return nil, err
+	}
+	var export DevModeExport
+	if err = json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("DEVMODE preset %s of %s: %s", name, printer, err)
+	}
+	if export.DriverVersion, err = ParseDevModeHeader(export.DevMode); err != nil {
+		return nil, fmt.Errorf("DEVMODE preset %s of %s: %s", name, printer, err)
+	}
+	return &export, nil
+}
+
+// Names lists the DEVMODE presets of printer, in order.
+func (p *DevModePresets) Names(printer string) ([]string, error) {
+	entries, err := ioutil.ReadDir(p.printerDir(printer))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if name := strings.TrimSuffix(entry.Name(), ".json"); !entry.IsDir() && name != entry.Name() {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Delete removes the DEVMODE preset name of printer.
+func (p *DevModePresets) Delete(printer, name string) error {
+	fileName, err := p.path(printer, name)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(fileName); os.IsNotExist(err) {
+		return fmt.Errorf("printer %s has no DEVMODE preset %s", printer, name)
+	}
+	return err
+}
@@ -0,0 +1,157 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func testDevMode(driverVersion uint16) []byte {
+	data := make([]byte, 220+16)
+	binary.LittleEndian.PutUint16(data[66:], driverVersion)
+	binary.LittleEndian.PutUint16(data[68:], 220)
+	binary.LittleEndian.PutUint16(data[70:], 16)
+	return data
+}
+
+func TestParseDevModeHeader(t *testing.T) {
+	data := make([]byte, 220+16)
+	binary.LittleEndian.PutUint16(data[66:], 0x0600)
+	binary.LittleEndian.PutUint16(data[68:], 220)
+	binary.LittleEndian.PutUint16(data[70:], 16)
+	if version, err := ParseDevModeHeader(data); version != 0x0600 || err != nil {
+		t.Errorf("expected driver version 0x600 got %#x: %v", version, err)
+	}
+	if _, err := ParseDevModeHeader(data[:220]); err == nil {
+		t.Error("expected error for a DEVMODE without its driver data")
+	}
+	if _, err := ParseDevModeHeader(data[:40]); err == nil {
+		t.Error("expected error for a short DEVMODE")
+	}
+}
+
+func TestDevModeExportCheckDriver(t *testing.T) {
+	export := DevModeExport{Driver: "HP Universal Printing PCL 6", DriverVersion: 0x0600}
+	if err := export.CheckDriver("hp universal printing pcl 6", 0x0600); err != nil {
+		t.Errorf("expected driver names to match regardless of case got %v", err)
+	}
+	if err := export.CheckDriver("HP Universal Printing PCL 6", 0x0601); !errors.Is(err, ErrDriverMismatch) {
+		t.Errorf("expected ErrDriverMismatch for another driver version got %v", err)
+	}
+	if err := export.CheckDriver("Microsoft Print To PDF", 0x0600); !errors.Is(err, ErrDriverMismatch) {
+		t.Errorf("expected ErrDriverMismatch for another driver got %v", err)
+	}
+}
+
+func TestDevModePresets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "winspool-presets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	presets := &DevModePresets{Dir: dir}
+
+	export := &DevModeExport{Printer: `\\server\office`, Driver: "HP Universal Printing PCL 6", DriverVersion: 0x0600, DevMode: testDevMode(0x0600)}
+	if err = presets.Save("staple", export); err != nil {
+		t.Fatal(err)
+	}
+	if err = presets.Save("../staple", export); err == nil {
+		t.Error("expected error for a name with a path")
+	}
+	loaded, err := presets.Load(export.Printer, "staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, export) {
+		t.Errorf("loaded %+v, expected %+v", loaded, export)
+	}
+	if _, err = presets.Load("other", "staple"); err == nil {
+		t.Error("expected error for the preset of another printer")
+	}
+	if names, err := presets.Names(export.Printer); err != nil || !reflect.DeepEqual(names, []string{"staple"}) {
+		t.Errorf("unexpected names %v, %v", names, err)
+	}
+
+	ticket := &model.JobTicket{VendorTicketItem: []model.VendorTicketItem{{ID: DevModePresetID, Value: "staple"}, {ID: LabelDarknessID, Value: "10"}}}
+	if got, err := TicketDevMode(export.Printer, ticket, presets); err != nil || !reflect.DeepEqual(got, export) {
+		t.Errorf("unexpected DEVMODE of preset %+v, %v", got, err)
+	}
+	if _, err := TicketDevMode(export.Printer, ticket, nil); err == nil {
+		t.Error("expected error for a preset without presets")
+	}
+
+	// As spoolers that don't read presets get it.
+	withDevMode := WithDevMode(ticket, export)
+	if len(ticket.VendorTicketItem) != 2 || ticket.VendorTicketItem[0].ID != DevModePresetID {
+		t.Error("expected the ticket not to change")
+	}
+	if len(withDevMode.VendorTicketItem) != 2 || withDevMode.VendorTicketItem[0].ID != LabelDarknessID || withDevMode.VendorTicketItem[1].Value != base64.StdEncoding.EncodeToString(export.DevMode) {
+		t.Errorf("unexpected vendor ticket items %+v", withDevMode.VendorTicketItem)
+	}
+	got, err := TicketDevMode(export.Printer, withDevMode, nil)
+	if err != nil || got.DriverVersion != 0x0600 || !reflect.DeepEqual(got.DevMode, export.DevMode) {
+		t.Errorf("unexpected DEVMODE %+v, %v", got, err)
+	}
+
+	two := &model.JobTicket{VendorTicketItem: append(withDevMode.VendorTicketItem, model.VendorTicketItem{ID: DevModePresetID, Value: "staple"})}
+	if _, err := TicketDevMode(export.Printer, two, presets); err == nil {
+		t.Error("expected error for two DEVMODEs")
+	}
+	short := &model.JobTicket{VendorTicketItem: []model.VendorTicketItem{{ID: DevModeID, Value: base64.StdEncoding.EncodeToString(export.DevMode[:100])}}}
+	if _, err := TicketDevMode(export.Printer, short, nil); err == nil {
+		t.Error("expected error for a partial DEVMODE")
+	}
+	if got, err := TicketDevMode(export.Printer, &model.JobTicket{}, presets); got != nil || err != nil {
+		t.Errorf("expected no DEVMODE got %+v, %v", got, err)
+	}
+
+	if err = presets.Delete(export.Printer, "staple"); err != nil {
+		t.Fatal(err)
+	}
+	if err = presets.Delete(export.Printer, "staple"); err == nil {
+		t.Error("expected error deleting a deleted preset")
+	}
+}
+
+// testDevModeGetter sets the fields it has values for.
+type testDevModeGetter map[string]int16
+
+func (g testDevModeGetter) get(field string) (int16, bool) {
+	v, ok := g[field]
+	return v, ok
+}
+
+func (g testDevModeGetter) GetCopies() (int16, bool)      { return g.get("copies") }
+func (g testDevModeGetter) GetColor() (int16, bool)       { return g.get("color") }
+func (g testDevModeGetter) GetDuplex() (int16, bool)      { return g.get("duplex") }
+func (g testDevModeGetter) GetOrientation() (int16, bool) { return g.get("orientation") }
+func (g testDevModeGetter) GetPaperSize() (int16, bool)   { return g.get("paper_size") }
+func (g testDevModeGetter) GetCollate() (int16, bool)     { return g.get("collate") }
+
+func TestSummarizeDevMode(t *testing.T) {
+	s := SummarizeDevMode(testDevModeGetter{
+		"copies": 2, "color": DevModeColorColor, "duplex": DevModeDuplexVertical,
+		"orientation": DevModeOrientationLandscape, "paper_size": 9, "collate": DevModeCollateTrue,
+	})
+	expected := DevModeSummary{Copies: 2, Color: true, Duplex: model.DuplexLongEdge, Orientation: model.PageOrientationLandscape, PaperSize: 9, Collate: true}
+	if s != expected {
+		t.Errorf("expected %+v, got %+v", expected, s)
+	}
+	if s = SummarizeDevMode(testDevModeGetter{"color": DevModeColorMonochrome}); s != (DevModeSummary{}) {
+		t.Errorf("expected only unset fields, got %+v", s)
+	}
+}
@@ -0,0 +1,252 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Where discovered printers were found.
+const (
+	// Shared printers the spooler browses, with PRINTER_ENUM_NETWORK.
+	DiscoverySourceNetwork = "NETWORK"
+	// IPP printers answering multicast DNS, as Bonjour and AirPrint find
+	// them.
+	DiscoverySourceMDNS = "MDNS"
+	// Devices answering a WS-Discovery probe for printers, as Windows finds
+	// WSD printers.
+	DiscoverySourceWSD = "WSD"
+)
+
+// DefaultDiscoveryTimeout is how long multicast scans wait for answers.
+const DefaultDiscoveryTimeout = 3 * time.Second
+
+// DiscoveredPrinter is a printer found on the network.
+type DiscoveredPrinter struct {
+	// Shared printers are named \\server\printer, which AddPrinterConnection
+	// connects; the others by their service instance or host.
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	// Where the printer is reached, such as ipp://host:631/ipp/print, or its
+	// WSD endpoint; empty for shared printers.
+	URI      string `json:"uri,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Location string `json:"location,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// SortDiscoveredPrinters sorts printers by source, then name.
+func SortDiscoveredPrinters(printers []DiscoveredPrinter) {
+	sort.Slice(printers, func(i, j int) bool {
+		if printers[i].Source != printers[j].Source {
+			return printers[i].Source < printers[j].Source
+		}
+		return printers[i].Name < printers[j].Name
+	})
+}
+
+var (
+	mdnsQueryGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	wsdQueryGroup  = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+)
+
+const mdnsIPPService = "_ipp._tcp.local."
+
+// BrowseMDNS asks the local network for IPP printers over multicast DNS,
+// and returns those that answer within timeout. The query is sent from
+// another port than 5353, so responders answer it directly, as RFC 6762
+// section 6.7 asks.
+func BrowseMDNS(timeout time.Duration) ([]DiscoveredPrinter, error) {
+	name, err := dnsmessage.NewName(mdnsIPPService)
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}}}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	responses, err := multicastQuery(mdnsQueryGroup, packet, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseMDNSResponses(responses), nil
+}
+
+// parseMDNSResponses returns the IPP printers of DNS-SD responses, from
+// their PTR, SRV, TXT and A records, whichever packets hold them.
+func parseMDNSResponses(responses [][]byte) []DiscoveredPrinter {
+	var instances []string
+	srvs := make(map[string]dnsmessage.SRVResource)
+	txts := make(map[string]map[string]string)
+	addresses := make(map[string]string)
+	for _, response := range responses {
+		var m dnsmessage.Message
+		if m.Unpack(response) != nil || !m.Header.Response {
+			continue
+		}
+		records := append(append(m.Answers, m.Authorities...), m.Additionals...)
+		for _, r := range records {
+			owner := strings.ToLower(r.Header.Name.String())
+			switch body := r.Body.(type) {
+			case *dnsmessage.PTRResource:
+				if owner == mdnsIPPService {
+					instances = append(instances, body.PTR.String())
+				}
+			case *dnsmessage.SRVResource:
+				srvs[owner] = *body
+			case *dnsmessage.TXTResource:
+				txts[owner] = parseDNSSDTXT(body.TXT)
+			case *dnsmessage.AResource:
+				addresses[owner] = net.IP(body.A[:]).String()
+			}
+		}
+	}
+
+	var printers []DiscoveredPrinter
+	seen := make(map[string]bool)
+	for _, instance := range instances {
+		key := strings.ToLower(instance)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		p := DiscoveredPrinter{Name: mdnsInstanceName(instance), Source: DiscoverySourceMDNS}
+		txt := txts[key]
+		p.Model, p.Location = txt["ty"], txt["note"]
+		if srv, ok := srvs[key]; ok {
+			host := strings.TrimSuffix(srv.Target.String(), ".")
+			if address, ok := addresses[strings.ToLower(srv.Target.String())]; ok {
+				host = address
+			}
+			u := url.URL{Scheme: "ipp", Host: net.JoinHostPort(host, strconv.Itoa(int(srv.Port))), Path: "/" + txt["rp"]}
+			p.URI = u.String()
+		}
+		printers = append(printers, p)
+	}
+	return printers
+}
+
+// mdnsInstanceName returns the name of a service instance, such as
+// "Office Printer" of "Office\ Printer._ipp._tcp.local.".
+func mdnsInstanceName(instance string) string {
+	name := strings.TrimSuffix(instance, "."+mdnsIPPService)
+	return strings.ReplaceAll(name, `\ `, " ")
+}
+
+// parseDNSSDTXT splits the key=value strings of a DNS-SD TXT record.
+func parseDNSSDTXT(txt []string) map[string]string {
+	values := make(map[string]string, len(txt))
+	for _, s := range txt {
+		if i := strings.IndexByte(s, '='); i > 0 {
+			values[strings.ToLower(s[:i])] = s[i+1:]
+		}
+	}
+	return values
+}
+
+// wsdProbe asks WS-Discovery devices of the printer type to answer; %s is
+// the message ID.
+const wsdProbe = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:wsd="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:wprt="http://schemas.microsoft.com/windows/2006/08/wdp/print">
+<soap:Header><wsa:To>urn:schemas-xmlsoap-org:ws:2005:04:discovery</wsa:To><wsa:Action>http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</wsa:Action><wsa:MessageID>urn:uuid:%s</wsa:MessageID></soap:Header>
+<soap:Body><wsd:Probe><wsd:Types>wprt:PrintDeviceType</wsd:Types></wsd:Probe></soap:Body>
+</soap:Envelope>`
+
+// ProbeWSD sends a WS-Discovery probe for printers, and returns the devices
+// that answer within timeout.
+func ProbeWSD(timeout time.Duration) ([]DiscoveredPrinter, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	id[6], id[8] = id[6]&0x0f|0x40, id[8]&0x3f|0x80
+	messageID := fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+	responses, err := multicastQuery(wsdQueryGroup, []byte(fmt.Sprintf(wsdProbe, messageID)), timeout)
+	if err != nil {
+		return nil, err
+	}
+	return parseWSDProbeMatches(responses), nil
+}
+
+type wsdProbeMatches struct {
+	Matches []struct {
+		Address string `xml:"EndpointReference>Address"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+// parseWSDProbeMatches returns the devices of ProbeMatches messages, once
+// per endpoint, named by the host of their first transport address.
+func parseWSDProbeMatches(responses [][]byte) []DiscoveredPrinter {
+	var printers []DiscoveredPrinter
+	seen := make(map[string]bool)
+	for _, response := range responses {
+		var m wsdProbeMatches
+		if xml.Unmarshal(response, &m) != nil {
+			continue
+		}
+		for _, match := range m.Matches {
+			address := strings.TrimSpace(match.Address)
+			if address == "" || seen[address] {
+				continue
+			}
+			seen[address] = true
+			p := DiscoveredPrinter{Name: address, Source: DiscoverySourceWSD, URI: address}
+			if xaddrs := strings.Fields(match.XAddrs); len(xaddrs) > 0 {
+				p.URI = xaddrs[0]
+				if u, err := url.Parse(xaddrs[0]); err == nil && u.Hostname() != "" {
+					p.Name = u.Hostname()
+				}
+			}
+			printers = append(printers, p)
+		}
+	}
+	return printers
+}
+
+// multicastQuery sends query to group, and returns the packets received in
+// answer within timeout.
+func multicastQuery(group *net.UDPAddr, query []byte, timeout time.Duration) ([][]byte, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err = conn.WriteToUDP(query, group); err != nil {
+		return nil, fmt.Errorf("failed to send query to %s: %s", group, err)
+	}
+	if err = conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	var responses [][]byte
+	for {
+		buf := make([]byte, 9000)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return responses, nil
+			}
+			return responses, err
+		}
+		responses = append(responses, buf[:n])
+	}
+}
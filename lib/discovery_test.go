@@ -0,0 +1,81 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseMDNSResponses(t *testing.T) {
+	service := dnsmessage.MustNewName(mdnsIPPService)
+	instance := dnsmessage.MustNewName(`Office\ Printer._ipp._tcp.local.`)
+	host := dnsmessage.MustNewName("office-printer.local.")
+	header := func(name dnsmessage.Name, typ dnsmessage.Type) dnsmessage.ResourceHeader {
+		return dnsmessage.ResourceHeader{Name: name, Type: typ, Class: dnsmessage.ClassINET, TTL: 120}
+	}
+	ptr := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Answers: []dnsmessage.Resource{
+			{Header: header(service, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: instance}},
+		},
+	}
+	// Some responders send the records of the instance apart.
+	records := dnsmessage.Message{
+		Header: dnsmessage.Header{Response: true},
+		Additionals: []dnsmessage.Resource{
+			{Header: header(instance, dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: host, Port: 631}},
+			{Header: header(instance, dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"txtvers=1", "rp=ipp/print", "ty=HP LaserJet M404", "note=2nd floor"}}},
+			{Header: header(host, dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}},
+		},
+	}
+	var responses [][]byte
+	for _, m := range []dnsmessage.Message{ptr, records, ptr} {
+		packet, err := m.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, packet)
+	}
+	responses = append(responses, []byte("not DNS"))
+
+	expected := []DiscoveredPrinter{{
+		Name:     "Office Printer",
+		Source:   DiscoverySourceMDNS,
+		URI:      "ipp://192.168.1.20:631/ipp/print",
+		Model:    "HP LaserJet M404",
+		Location: "2nd floor",
+	}}
+	if printers := parseMDNSResponses(responses); !reflect.DeepEqual(printers, expected) {
+		t.Errorf("expected %+v, got %+v", expected, printers)
+	}
+}
+
+func TestParseWSDProbeMatches(t *testing.T) {
+	match := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:wsd="http://schemas.xmlsoap.org/ws/2005/04/discovery">
+<soap:Body><wsd:ProbeMatches><wsd:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>urn:uuid:4509a320-00a0-008f-00b6-002507510eca</wsa:Address></wsa:EndpointReference>
+<wsd:Types>wprt:PrintDeviceType</wsd:Types>
+<wsd:XAddrs>http://192.168.1.21:3911/ http://[fe80::1]:3911/</wsd:XAddrs>
+</wsd:ProbeMatch></wsd:ProbeMatches></soap:Body>
+</soap:Envelope>`)
+
+	printers := parseWSDProbeMatches([][]byte{match, match, []byte("<garbage")})
+	expected := []DiscoveredPrinter{{
+		Name:   "192.168.1.21",
+		Source: DiscoverySourceWSD,
+		URI:    "http://192.168.1.21:3911/",
+	}}
+	if !reflect.DeepEqual(printers, expected) {
+		t.Errorf("expected %+v, got %+v", expected, printers)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// ErrDuplicateJob is wrapped by the errors of jobs refused because the
+// same document and ticket were just submitted to the printer.
+var ErrDuplicateJob = errors.New("duplicate job")
+
+// DuplicateAction is what is done with a duplicate job.
+type DuplicateAction string
+
+const (
+	// The job is refused with an error wrapping ErrDuplicateJob.
+	DuplicateActionReject DuplicateAction = "reject"
+	// The job is printed, with a warning.
+	DuplicateActionWarn DuplicateAction = "warn"
+)
+
+func (a DuplicateAction) Valid() bool {
+	return a == DuplicateActionReject || a == DuplicateActionWarn
+}
+
+// DuplicateJobKey hashes the content of a document and its ticket: jobs of
+// a printer with the same key are duplicates.
+func DuplicateJobKey(fileName string, ticket *model.JobTicket) ([sha256.Size]byte, error) {
+	var key [sha256.Size]byte
+	f, err := os.Open(fileName)
+	if err != nil {
+		return key, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return key, err
+	}
+	// The ticket is hashed apart from the document, so that neither can
+	// end where the other begins.
+	t, err := json.Marshal(ticket)
+	if err != nil {
+		return key, err
+	}
+	ticketHash := sha256.Sum256(t)
+	h.Write(ticketHash[:])
+	copy(key[:], h.Sum(nil))
+	return key, nil
+}
+
+// DuplicateDetector finds jobs submitted to a printer within Window of an
+// identical one, as when a submit button is clicked twice.
+type DuplicateDetector struct {
+	Window time.Duration
+	Action DuplicateAction
+
+	mutex sync.Mutex
+	now   func() time.Time
+	// Submission times by job key.
+	submitted map[[sha256.Size]byte]time.Time
+}
+
+// Submit notes a job, and returns the error or warning message to report
+// when an identical job was submitted within the window; the warning is
+// empty when the job isn't a duplicate. Forget the job when it fails, so
+// that it can be submitted again.
+func (d *DuplicateDetector) Submit(key [sha256.Size]byte) (warning string, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.submitted == nil {
+		d.submitted = make(map[[sha256.Size]byte]time.Time)
+	}
+	now := time.Now()
+	if d.now != nil {
+		now = d.now()
+	}
+	for k, t := range d.submitted {
+		if now.Sub(t) >= d.Window {
+			delete(d.submitted, k)
+		}
+	}
+	if previous, ok := d.submitted[key]; ok {
+		message := fmt.Sprintf("an identical job was submitted %s ago, within the duplicate window of %s", now.Sub(previous).Round(time.Millisecond), d.Window)
+		if d.Action == DuplicateActionWarn {
+			return message, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrDuplicateJob, message)
+	}
+	d.submitted[key] = now
+	return "", nil
+}
+
+// Forget drops a job noted by Submit.
+func (d *DuplicateDetector) Forget(key [sha256.Size]byte) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	delete(d.submitted, key)
+}
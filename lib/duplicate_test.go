@@ -0,0 +1,63 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestDuplicateDetector(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "report.pdf")
+	if err := ioutil.WriteFile(fileName, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	key, err := DuplicateJobKey(fileName, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := DuplicateJobKey(fileName, &model.JobTicket{Copies: &model.CopiesTicketItem{Copies: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key == other {
+		t.Fatal("expected tickets to change the key")
+	}
+
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	d := &DuplicateDetector{Window: 30 * time.Second, Action: DuplicateActionReject, now: func() time.Time { return now }}
+	if _, err := d.Submit(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Submit(other); err != nil {
+		t.Errorf("expected another ticket not to be a duplicate, got %v", err)
+	}
+	now = now.Add(10 * time.Second)
+	if _, err := d.Submit(key); !errors.Is(err, ErrDuplicateJob) {
+		t.Errorf("expected a duplicate job error, got %v", err)
+	}
+	d.Forget(other)
+	if _, err := d.Submit(other); err != nil {
+		t.Errorf("expected a forgotten job not to be a duplicate, got %v", err)
+	}
+	now = now.Add(30 * time.Second)
+	if _, err := d.Submit(key); err != nil {
+		t.Errorf("expected a job after the window not to be a duplicate, got %v", err)
+	}
+
+	d.Action = DuplicateActionWarn
+	if warning, err := d.Submit(key); err != nil || warning == "" {
+		t.Errorf("expected a warning, got %q, %v", warning, err)
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kinds of spooler failures, which the errors of spooler operations wrap,
+// so that callers tell them apart with errors.Is.
+var (
+	ErrPrinterNotFound    = errors.New("printer not found")
+	ErrJobNotFound        = errors.New("job not found")
+	ErrNoDefaultPrinter   = errors.New("no default printer")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrSpoolerUnavailable = errors.New("print spooler unavailable")
+	ErrInvalidHandle      = errors.New("invalid printer handle")
+)
+
+// Win32 error codes of the kinds of failures.
+const (
+	win32AccessDenied         = 5
+	win32InvalidHandle        = 6
+	win32ServiceNotActive     = 1062
+	win32RPCUnknownInterface  = 1717
+	win32RPCServerUnavailable = 1722
+	win32RPCCallFailed        = 1726
+	win32RPCCallFailedDNE     = 1727
+	win32InvalidPrinterName   = 1801
+	win32PrinterNotFound      = 3012
+)
+
+// Win32ErrorKind returns the kind of failure of a Win32 error code, one of
+// the errors above, or nil when the code isn't one of them.
+func Win32ErrorKind(code uint32) error {
+	switch code {
+	case win32AccessDenied:
+		return ErrAccessDenied
+	case win32InvalidHandle:
+		return ErrInvalidHandle
+	case win32InvalidPrinterName, win32PrinterNotFound:
+		return ErrPrinterNotFound
+	case win32ServiceNotActive, win32RPCServerUnavailable, win32RPCCallFailed, win32RPCCallFailedDNE, win32RPCUnknownInterface:
+		return ErrSpoolerUnavailable
+	}
+	return nil
+}
+
+// Win32Error is a failed Win32 call. errors.Is matches the kind of the code,
+// such as ErrPrinterNotFound for ERROR_INVALID_PRINTER_NAME, and the
+// underlying error, a syscall.Errno on Windows; errors.As gets the code.
+type Win32Error struct {
+	// The call, such as OpenPrinter, and what it was called on, such as a
+	// printer name, when known.
+	Op   string
+	Name string
+	Code uint32
+	Err  error
+}
+
+func (e *Win32Error) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("%s %s: %s", e.Op, e.Name, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Op, e.Err)
+}
+
+func (e *Win32Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Win32Error) Is(target error) bool {
+	kind := Win32ErrorKind(e.Code)
+	return kind != nil && target == kind
+}
+
+// kindError is a sentinel error that is also of a broader kind, such as
+// ErrAdminRequired, which is ErrAccessDenied.
+type kindError struct {
+	message string
+	kind    error
+}
+
+func (e *kindError) Error() string {
+	return e.message
+}
+
+func (e *kindError) Unwrap() error {
+	return e.kind
+}
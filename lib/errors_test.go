@@ -0,0 +1,67 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type testErrno uint32
+
+func (e testErrno) Error() string {
+	return fmt.Sprintf("errno %d", uint32(e))
+}
+
+func TestWin32Error(t *testing.T) {
+	errno := testErrno(1801)
+	err := fmt.Errorf("failed to print: %w", &Win32Error{Op: "OpenPrinter", Name: "Office", Code: uint32(errno), Err: errno})
+	if err.Error() != "failed to print: OpenPrinter Office: errno 1801" {
+		t.Errorf("unexpected message %q", err)
+	}
+	if !errors.Is(err, ErrPrinterNotFound) || errors.Is(err, ErrAccessDenied) {
+		t.Error("expected ERROR_INVALID_PRINTER_NAME to be ErrPrinterNotFound only")
+	}
+	if !errors.Is(err, errno) {
+		t.Error("expected the error code to be wrapped")
+	}
+	var win32Err *Win32Error
+	if !errors.As(err, &win32Err) || win32Err.Code != 1801 {
+		t.Errorf("expected the Win32 error, got %+v", win32Err)
+	}
+
+	for code, kind := range map[uint32]error{
+		5:    ErrAccessDenied,
+		6:    ErrInvalidHandle,
+		1722: ErrSpoolerUnavailable,
+		1062: ErrSpoolerUnavailable,
+		3012: ErrPrinterNotFound,
+	} {
+		if err := (&Win32Error{Op: "GetJob", Code: code, Err: testErrno(code)}); !errors.Is(err, kind) {
+			t.Errorf("expected code %d to be %s", code, kind)
+		}
+	}
+	if err := (&Win32Error{Op: "GetJob", Code: 87, Err: testErrno(87)}); Win32ErrorKind(87) != nil || errors.Is(err, ErrJobNotFound) {
+		t.Error("expected ERROR_INVALID_PARAMETER to have no kind")
+	}
+}
+
+func TestErrAdminRequired(t *testing.T) {
+	err := fmt.Errorf("pausing printer Office %w", ErrAdminRequired)
+	if !errors.Is(err, ErrAdminRequired) || !errors.Is(err, ErrAccessDenied) {
+		t.Error("expected ErrAdminRequired to be ErrAccessDenied")
+	}
+	if err.Error() != "pausing printer Office requires administrator" {
+		t.Errorf("unexpected message %q", err)
+	}
+	if errors.Is(ErrAccessDenied, ErrAdminRequired) {
+		t.Error("expected ErrAccessDenied not to be ErrAdminRequired")
+	}
+}
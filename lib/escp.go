@@ -0,0 +1,289 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ESCPLayout sets up the page of an ESC/P dot-matrix printer (Epson LQ/FX
+// and compatibles), and places fields on preprinted multi-part forms. Text
+// sent with it bypasses GDI, so all parts of the form get the impact of
+// every character.
+type ESCPLayout struct {
+	// Characters per inch: 10, 12 or 15, or condensed 17 or 20. 10 when
+	// zero.
+	CPI int `json:"cpi,omitempty"`
+	// 6 or 8; 6 when zero.
+	LinesPerInch int `json:"lines_per_inch,omitempty"`
+	// Lines per form; the printer setting is kept when zero. Form feeds move
+	// to the top of the next form.
+	FormLength int `json:"form_length,omitempty"`
+	// Columns left blank at the start of each line.
+	LeftMargin int `json:"left_margin,omitempty"`
+	// Characters per line, after which text wraps; no wrapping when zero.
+	Columns int `json:"columns,omitempty"`
+
+	// Positions of the values of a form, see Fill.
+	Fields []ESCPField `json:"fields,omitempty"`
+}
+
+// ESCPField is a value printed at a fixed position of a form.
+type ESCPField struct {
+	Name string `json:"name"`
+	// 1-based line and column of the first character.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	// Longer values are cut; unlimited when zero.
+	Width int `json:"width,omitempty"`
+	// Lines the value spans, one per line of the value, such as invoice
+	// items. 1 when zero; extra lines are dropped.
+	Lines int `json:"lines,omitempty"`
+	// Right aligns the value within Width.
+	AlignRight bool `json:"align_right,omitempty"`
+}
+
+// ESC/P commands.
+var (
+	escpInitialize       = []byte{0x1b, '@'}
+	escpPica             = []byte{0x1b, 'P'} // 10 cpi
+	escpElite            = []byte{0x1b, 'M'} // 12 cpi
+	escp15CPI            = []byte{0x1b, 'g'}
+	escpCondensed        = []byte{0x0f} // SI: 17 cpi from pica, 20 from elite
+	escpSixthInchLines   = []byte{0x1b, '2'}
+	escpEighthInchLines  = []byte{0x1b, '0'}
+	escpFormLength       = []byte{0x1b, 'C'}
+	escpLeftMargin       = []byte{0x1b, 'l'}
+	escpLineEnd          = []byte("\r\n")
+	escpFormFeed         = []byte{0x0c}
+	escpMaxCommandNumber = 127
+)
+
+// Validate checks the page setup and fields.
+func (l *ESCPLayout) Validate() error {
+	switch l.CPI {
+	case 0, 10, 12, 15, 17, 20:
+	default:
+		return fmt.Errorf("invalid cpi %d, expected 10, 12, 15, 17 or 20", l.CPI)
+	}
+	switch l.LinesPerInch {
+	case 0, 6, 8:
+	default:
+		return fmt.Errorf("invalid lines_per_inch %d, expected 6 or 8", l.LinesPerInch)
+	}
+	// Sent as a single byte; kept below 128 so that code page conversion
+	// leaves it alone.
+	if l.FormLength < 0 || l.FormLength > escpMaxCommandNumber {
+		return fmt.Errorf("invalid form_length %d, expected 1 to %d lines", l.FormLength, escpMaxCommandNumber)
+	}
+	if l.LeftMargin < 0 || l.LeftMargin > escpMaxCommandNumber {
+		return fmt.Errorf("invalid left_margin %d, expected 0 to %d columns", l.LeftMargin, escpMaxCommandNumber)
+	}
+	if l.Columns < 0 {
+		return fmt.Errorf("invalid columns %d", l.Columns)
+	}
+	names := make(map[string]bool, len(l.Fields))
+	for _, field := range l.Fields {
+		if field.Name == "" {
+			return fmt.Errorf("field at line %d without name", field.Line)
+		}
+		if names[field.Name] {
+			return fmt.Errorf("duplicate field %s", field.Name)
+		}
+		names[field.Name] = true
+		if field.Line < 1 || field.Column < 1 || field.Width < 0 || field.Lines < 0 {
+			return fmt.Errorf("invalid position of field %s", field.Name)
+		}
+		if l.FormLength > 0 && field.Line+field.lines()-1 > l.FormLength {
+			return fmt.Errorf("field %s ends past form_length %d", field.Name, l.FormLength)
+		}
+	}
+	return nil
+}
+
+func (f *ESCPField) lines() int {
+	if f.Lines < 1 {
+		return 1
+	}
+	return f.Lines
+}
+
+// setup returns the commands that set up the page.
+func (l *ESCPLayout) setup() []byte {
+	b := append([]byte{}, escpInitialize...)
+	switch l.CPI {
+	case 12:
+		b = append(b, escpElite...)
+	case 15:
+		b = append(b, escp15CPI...)
+	case 17:
+		b = append(append(b, escpPica...), escpCondensed...)
+	case 20:
+		b = append(append(b, escpElite...), escpCondensed...)
+	default:
+		b = append(b, escpPica...)
+	}
+	if l.LinesPerInch == 8 {
+		b = append(b, escpEighthInchLines...)
+	} else {
+		b = append(b, escpSixthInchLines...)
+	}
+	if l.FormLength > 0 {
+		b = append(append(b, escpFormLength...), byte(l.FormLength))
+	}
+	if l.LeftMargin > 0 {
+		b = append(append(b, escpLeftMargin...), byte(l.LeftMargin))
+	}
+	return b
+}
+
+// Encode converts plain text into an ESC/P job: the page setup, then the
+// text, wrapped at Columns and paginated at FormLength, each form ending
+// with a form feed. encode converts text into the code page of the printer;
+// the text is sent as UTF-8 when nil.
+func (l *ESCPLayout) Encode(text string, encode func(string) ([]byte, error)) ([]byte, error) {
+	if encode == nil {
+		encode = func(s string) ([]byte, error) { return []byte(s), nil }
+	}
+	columns, lines := l.Columns, l.FormLength
+	if columns == 0 {
+		columns = math.MaxInt32
+	}
+	if lines == 0 {
+		lines = math.MaxInt32
+	}
+
+	b := bytes.NewBuffer(l.setup())
+	for _, page := range LayoutText(text, columns, lines) {
+		for _, line := range page {
+			encoded, err := encode(line)
+			if err != nil {
+				return nil, err
+			}
+			b.Write(encoded)
+			b.Write(escpLineEnd)
+		}
+		b.Write(escpFormFeed)
+	}
+	return b.Bytes(), nil
+}
+
+// Fill lays out the values of a form at the positions of their fields, and
+// returns the text of a single form. Values of fields that the layout
+// doesn't have are an error, as they would silently not print. Wide (CJK)
+// characters take two columns, as on the printer.
+func (l *ESCPLayout) Fill(values map[string]string) (string, error) {
+	fields := make(map[string]*ESCPField, len(l.Fields))
+	for i := range l.Fields {
+		fields[l.Fields[i].Name] = &l.Fields[i]
+	}
+	var unknown []string
+	for name := range values {
+		if _, ok := fields[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return "", fmt.Errorf("form has no field %s", strings.Join(unknown, ", "))
+	}
+
+	var grid [][]rune
+	for _, field := range l.Fields {
+		value, ok := values[field.Name]
+		if !ok {
+			continue
+		}
+		for i, line := range strings.Split(strings.ReplaceAll(value, "\r\n", "\n"), "\n") {
+			if i == field.lines() {
+				break
+			}
+			row := field.Line - 1 + i
+			for len(grid) <= row {
+				grid = append(grid, nil)
+			}
+			grid[row] = placeText(grid[row], field.Column-1, fitText(line, field.Width, field.AlignRight))
+		}
+	}
+
+	formLines := make([]string, len(grid))
+	for i, row := range grid {
+		// Drop the fillers, which only kept the columns right.
+		compact := make([]rune, 0, len(row))
+		for _, r := range row {
+			if r != wideFiller {
+				compact = append(compact, r)
+			}
+		}
+		formLines[i] = strings.TrimRight(string(compact), " ")
+	}
+	return strings.Join(formLines, "\n"), nil
+}
+
+// Placeholder of the second column of wide characters in a row.
+const wideFiller = 0
+
+// placeText writes text into row from column, padding the row with spaces.
+// Rows hold a rune per column, so that fields after wide characters line up.
+func placeText(row []rune, column int, text string) []rune {
+	for _, r := range text {
+		width := runeWidth(r)
+		for len(row) < column+width {
+			row = append(row, ' ')
+		}
+		row[column] = r
+		if width == 2 {
+			row[column+1] = wideFiller
+		}
+		column += width
+	}
+	return row
+}
+
+// fitText cuts text to width columns, and right aligns it when asked.
+func fitText(text string, width int, alignRight bool) string {
+	text = expandTabs(text, textTabWidth)
+	if width == 0 {
+		return text
+	}
+	var b strings.Builder
+	used := 0
+	for _, r := range text {
+		if used+runeWidth(r) > width {
+			break
+		}
+		b.WriteRune(r)
+		used += runeWidth(r)
+	}
+	if alignRight {
+		return strings.Repeat(" ", width-used) + b.String()
+	}
+	return b.String()
+}
+
+// runeWidth returns the columns a character takes on the printer: two for
+// CJK and other wide characters, one otherwise.
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115f, // Hangul Jamo
+		r >= 0x2e80 && r <= 0xa4cf, // CJK radicals to Yi
+		r >= 0xac00 && r <= 0xd7a3, // Hangul syllables
+		r >= 0xf900 && r <= 0xfaff, // CJK compatibility ideographs
+		r >= 0xfe30 && r <= 0xfe4f, // CJK compatibility forms
+		r >= 0xff00 && r <= 0xff60, // Fullwidth forms
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestESCPLayoutEncode(t *testing.T) {
+	layout := ESCPLayout{CPI: 17, LinesPerInch: 8, FormLength: 2, LeftMargin: 3, Columns: 5}
+	if err := layout.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	job, err := layout.Encode("Invoice\nTotal\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte("\x1b@\x1bP\x0f\x1b0\x1bC\x02\x1bl\x03" +
+		"Invoi\r\nce\r\n\x0c" +
+		"Total\r\n\x0c")
+	if !bytes.Equal(job, expected) {
+		t.Errorf("expected %q got %q", expected, job)
+	}
+
+	if job, _ = (&ESCPLayout{}).Encode("", nil); !bytes.Equal(job, []byte("\x1b@\x1bP\x1b2\r\n\x0c")) {
+		t.Errorf("unexpected job of the default layout %q", job)
+	}
+}
+
+func TestESCPLayoutValidate(t *testing.T) {
+	for _, layout := range []ESCPLayout{
+		{CPI: 11},
+		{LinesPerInch: 7},
+		{FormLength: 128},
+		{LeftMargin: -1},
+		{Fields: []ESCPField{{Name: "a", Line: 1, Column: 1}, {Name: "a", Line: 2, Column: 1}}},
+		{Fields: []ESCPField{{Name: "a", Line: 0, Column: 1}}},
+		{FormLength: 10, Fields: []ESCPField{{Name: "items", Line: 8, Column: 1, Lines: 4}}},
+	} {
+		if err := layout.Validate(); err == nil {
+			t.Errorf("expected layout %+v to be invalid", layout)
+		}
+	}
+}
+
+func TestESCPLayoutFill(t *testing.T) {
+	layout := ESCPLayout{Fields: []ESCPField{
+		{Name: "customer", Line: 2, Column: 3, Width: 10},
+		{Name: "date", Line: 2, Column: 16},
+		{Name: "items", Line: 4, Column: 1, Lines: 2},
+		{Name: "total", Line: 7, Column: 5, Width: 8, AlignRight: true},
+	}}
+	text, err := layout.Fill(map[string]string{
+		"customer": "上海某某贸易有限公司",
+		"date":     "2015-06-01",
+		"items":    "Paper\r\nRibbon\nToner",
+		"total":    "12.50",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Five wide characters fill the 10 columns of customer.
+	expected := "\n  上海某某贸   2015-06-01\n\nPaper\nRibbon\n\n       12.50"
+	if text != expected {
+		t.Errorf("expected %q got %q", expected, text)
+	}
+
+	if _, err = layout.Fill(map[string]string{"amount": "1"}); err == nil {
+		t.Error("expected an unknown field to fail")
+	}
+}
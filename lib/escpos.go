@@ -0,0 +1,113 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// ESCPOSStatusRequests are the ESC/POS real-time status requests (DLE EOT n),
+// in the order their replies are passed to ParseESCPOSStatus: printer status,
+// offline cause, error cause, paper roll sensor.
+var ESCPOSStatusRequests = [4][]byte{
+	{0x10, 0x04, 0x01},
+	{0x10, 0x04, 0x02},
+	{0x10, 0x04, 0x03},
+	{0x10, 0x04, 0x04},
+}
+
+// ESCPOSStatus is the peripheral status of an ESC/POS receipt printer, which
+// the spooler knows nothing about.
+type ESCPOSStatus struct {
+	Offline bool
+	// Drawer kick-out connector pin 3 is high. Most cash drawers report
+	// open this way, but some are wired the other way around.
+	DrawerOpen           bool
+	CoverOpen            bool
+	PaperFeeding         bool
+	PaperOut             bool
+	PaperNearEnd         bool
+	CutterError          bool
+	UnrecoverableError   bool
+	AutoRecoverableError bool
+}
+
+// ParseESCPOSStatus decodes the one byte replies to ESCPOSStatusRequests.
+func ParseESCPOSStatus(replies [4]byte) (*ESCPOSStatus, error) {
+	for i, b := range replies {
+		// Bits 1 and 4 are always set, bits 0 and 7 always clear.
+		if b&0x93 != 0x12 {
+			return nil, fmt.Errorf("invalid reply %#02x to ESC/POS status request %d", b, i+1)
+		}
+	}
+
+	printer, offline, errorCause, paper := replies[0], replies[1], replies[2], replies[3]
+	return &ESCPOSStatus{
+		Offline:              printer&0x08 != 0,
+		DrawerOpen:           printer&0x04 != 0,
+		CoverOpen:            offline&0x04 != 0,
+		PaperFeeding:         offline&0x08 != 0,
+		PaperOut:             offline&0x20 != 0 || paper&0x60 != 0,
+		PaperNearEnd:         paper&0x0c != 0,
+		CutterError:          errorCause&0x08 != 0,
+		UnrecoverableError:   errorCause&0x20 != 0,
+		AutoRecoverableError: errorCause&0x40 != 0,
+	}, nil
+}
+
+// ApplyTo adds the peripheral status to printer state obtained from the spooler.
+func (s *ESCPOSStatus) ApplyTo(state *model.PrinterStateSection) {
+	if state.VendorState == nil {
+		state.VendorState = &model.VendorState{}
+	}
+	addVendorState := func(vendorState model.VendorStateType, description string) {
+		state.VendorState.Item = append(state.VendorState.Item, model.VendorStateItem{
+			State:                vendorState,
+			DescriptionLocalized: model.NewLocalizedString(description),
+		})
+	}
+
+	coverState := model.CoverStateOK
+	if s.CoverOpen {
+		state.State = model.CloudDeviceStateStopped
+		coverState = model.CoverStateOpen
+		addVendorState(model.VendorStateError, "cover open")
+	}
+	state.CoverState = &model.CoverState{
+		Item: []model.CoverStateItem{{VendorID: "cover", State: coverState}},
+	}
+
+	paper := model.InputTrayStateItem{VendorID: "roll", State: model.InputTrayStateOK}
+	if s.PaperOut {
+		state.State = model.CloudDeviceStateStopped
+		paper.State = model.InputTrayStateEmpty
+		addVendorState(model.VendorStateError, "paper out")
+	} else if s.PaperNearEnd {
+		paper.VendorMessage = "paper near end"
+		addVendorState(model.VendorStateWarning, "paper near end")
+	}
+	state.InputTrayState = &model.InputTrayState{Item: []model.InputTrayStateItem{paper}}
+
+	if s.CutterError {
+		state.State = model.CloudDeviceStateStopped
+		addVendorState(model.VendorStateError, "autocutter error")
+	}
+	if s.UnrecoverableError {
+		state.State = model.CloudDeviceStateStopped
+		addVendorState(model.VendorStateError, "unrecoverable printer error")
+	}
+	if s.AutoRecoverableError {
+		addVendorState(model.VendorStateWarning, "printer error, recovering")
+	}
+	if s.DrawerOpen {
+		addVendorState(model.VendorStateInfo, "cash drawer open")
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestParseESCPOSStatus(t *testing.T) {
+	// Drawer open, cover open, paper near end.
+	status, err := ParseESCPOSStatus([4]byte{0x16, 0x16, 0x12, 0x1e})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := ESCPOSStatus{DrawerOpen: true, CoverOpen: true, PaperNearEnd: true}
+	if *status != expected {
+		t.Fatalf("expected %+v got %+v", expected, *status)
+	}
+
+	state := model.PrinterStateSection{State: model.CloudDeviceStateIdle}
+	status.ApplyTo(&state)
+	if state.State != model.CloudDeviceStateStopped {
+		t.Errorf("expected %s got %s", model.CloudDeviceStateStopped, state.State)
+	}
+	if state.CoverState.Item[0].State != model.CoverStateOpen {
+		t.Errorf("expected cover %s got %s", model.CoverStateOpen, state.CoverState.Item[0].State)
+	}
+	if state.InputTrayState.Item[0].State != model.InputTrayStateOK {
+		t.Errorf("expected paper %s got %s", model.InputTrayStateOK, state.InputTrayState.Item[0].State)
+	}
+	if len(state.VendorState.Item) != 3 {
+		t.Errorf("expected 3 vendor state items got %d", len(state.VendorState.Item))
+	}
+
+	if _, err = ParseESCPOSStatus([4]byte{0x12, 0x12, 0x12, 0xff}); err == nil {
+		t.Error("expected error for invalid reply")
+	}
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type EventType string
+
+const (
+	EventPrinterAdded        EventType = "PRINTER_ADDED"
+	EventPrinterRemoved      EventType = "PRINTER_REMOVED"
+	EventPrinterStateChanged EventType = "PRINTER_STATE_CHANGED"
+	EventJobAdded            EventType = "JOB_ADDED"
+	EventJobStateChanged     EventType = "JOB_STATE_CHANGED"
+	EventJobProgress         EventType = "JOB_PROGRESS"
+)
+
+// Event is a change in the native print system, as delivered by Subscribe.
+type Event struct {
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	Printer string    `json:"printer"`
+
+	// Set for printer added and state changed events.
+	PrinterState *model.PrinterStateSection `json:"printer_state,omitempty"`
+
+	// Set for job events.
+	JobID    uint32                   `json:"job_id,omitempty"`
+	JobState *model.PrintJobStateDiff `json:"job_state,omitempty"`
+}
+
+// JobTransitions follows job notifications, and tells which ones are job
+// events: a job seen for the first time, a change of its state type, or
+// more pages printed.
+// It stops following jobs once they are done or aborted.
+type JobTransitions struct {
+	jobs map[uint32]*jobTransitionState
+}
+
+type jobTransitionState struct {
+	printer      string
+	status       *uint32
+	pagesPrinted *uint32
+	state        model.JobStateType
+	reported     int32
+}
+
+func NewJobTransitions() *JobTransitions {
+	return &JobTransitions{jobs: make(map[uint32]*jobTransitionState)}
+}
+
+// Apply merges a job notification with the previous ones of the job, and
+// returns the resulting event, if any.
+func (t *JobTransitions) Apply(change JobChange) (Event, bool) {
+	job, exists := t.jobs[change.JobID]
+	if !exists {
+		job = &jobTransitionState{}
+		t.jobs[change.JobID] = job
+	}
+	if change.PrinterName != "" {
+		job.printer = change.PrinterName
+	}
+	if change.Status != nil {
+		job.status = change.Status
+	}
+	if change.PagesPrinted != nil {
+		job.pagesPrinted = change.PagesPrinted
+	}
+	if job.status == nil {
+		return Event{}, false
+	}
+
+	diff := model.PrintJobStateDiff{State: ConvertJobStatus(*job.status)}
+	if job.pagesPrinted != nil {
+		pagesPrinted := int32(*job.pagesPrinted)
+		diff.PagesPrinted = &pagesPrinted
+	}
+	if diff.State.Type == model.JobStateDone || diff.State.Type == model.JobStateAborted {
+		delete(t.jobs, change.JobID)
+	}
+
+	event := Event{Type: EventJobStateChanged, Time: time.Now(), Printer: job.printer, JobID: change.JobID, JobState: &diff}
+	if job.state == "" {
+		event.Type = EventJobAdded
+	} else if job.state == diff.State.Type {
+		if diff.PagesPrinted == nil || *diff.PagesPrinted <= job.reported {
+			return Event{}, false
+		}
+		event.Type = EventJobProgress
+	}
+	job.state = diff.State.Type
+	if diff.PagesPrinted != nil {
+		job.reported = *diff.PagesPrinted
+	}
+	return event, true
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestJobTransitions(t *testing.T) {
+	spooling, printing, printed := JobStatusSpooling, JobStatusPrinting, JobStatusPrinted
+	pages := uint32(3)
+
+	transitions := NewJobTransitions()
+	steps := []struct {
+		change JobChange
+		event  EventType
+		state  model.JobStateType
+	}{
+		// Not enough to tell the state.
+		{JobChange{PrinterName: "a", JobID: 1, TotalPages: &pages}, "", ""},
+		{JobChange{JobID: 1, Status: &spooling}, EventJobAdded, model.JobStateInProgress},
+		// Still in progress.
+		{JobChange{JobID: 1, Status: &printing}, "", ""},
+		{JobChange{JobID: 1, PagesPrinted: &pages}, EventJobProgress, model.JobStateInProgress},
+		{JobChange{JobID: 1, PagesPrinted: &pages}, "", ""},
+		{JobChange{JobID: 1, Status: &printed}, EventJobStateChanged, model.JobStateDone},
+		// Forgotten once done.
+		{JobChange{JobID: 1, Status: &printed}, EventJobAdded, model.JobStateDone},
+	}
+	for i, step := range steps {
+		event, ok := transitions.Apply(step.change)
+		if !ok {
+			if step.event != "" {
+				t.Errorf("%d: expected %s event", i, step.event)
+			}
+			continue
+		}
+		if event.Type != step.event || event.JobState.State.Type != step.state {
+			t.Errorf("%d: expected %s %s got %s %s", i, step.event, step.state, event.Type, event.JobState.State.Type)
+		}
+		if step.event == EventJobStateChanged && (event.Printer != "a" || *event.JobState.PagesPrinted != 3) {
+			t.Errorf("%d: earlier values not kept: %+v", i, event)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// EventRecordVersion is the version of the EventRecord schema. Fields are
+// only added within a version; it changes when fields are renamed or
+// removed, or change meaning.
+const EventRecordVersion = 1
+
+// EventRecord is an event as written in NDJSON streams: one JSON object per
+// line, with flat fields that log shippers index without parsing nested
+// objects. Fields that don't apply to the event are omitted.
+type EventRecord struct {
+	Version int       `json:"version"`
+	Type    EventType `json:"type"`
+	// In UTC, with nanoseconds.
+	Time     time.Time     `json:"time"`
+	Severity EventSeverity `json:"severity"`
+	Printer  string        `json:"printer,omitempty"`
+
+	PrinterState model.CloudDeviceStateType `json:"printer_state,omitempty"`
+	// Vendor states of the printer, such as "toner low".
+	PrinterMessages []string `json:"printer_messages,omitempty"`
+
+	JobID    uint32             `json:"job_id,omitempty"`
+	JobState model.JobStateType `json:"job_state,omitempty"`
+	// Why the job is stopped or aborted, such as "CANCELLED" or
+	// "PRINT_FAILURE".
+	JobStateCause string `json:"job_state_cause,omitempty"`
+	PagesPrinted  *int32 `json:"pages_printed,omitempty"`
+	TotalPages    *int32 `json:"total_pages,omitempty"`
+}
+
+// NewEventRecord returns the record of an event.
+func NewEventRecord(e Event) EventRecord {
+	r := EventRecord{
+		Version:  EventRecordVersion,
+		Type:     e.Type,
+		Time:     e.Time.UTC(),
+		Severity: e.Severity(),
+		Printer:  e.Printer,
+		JobID:    e.JobID,
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+	if e.PrinterState != nil {
+		r.PrinterState = e.PrinterState.State
+		if e.PrinterState.VendorState != nil {
+			for _, item := range e.PrinterState.VendorState.Item {
+				if item.Description != "" {
+					r.PrinterMessages = append(r.PrinterMessages, item.Description)
+				}
+			}
+		}
+	}
+	if state := e.JobState; state != nil {
+		r.PagesPrinted, r.TotalPages = state.PagesPrinted, state.TotalPages
+		if state.State != nil {
+			r.JobState = state.State.Type
+			r.JobStateCause = jobStateCause(state.State)
+		}
+	}
+	return r
+}
+
+func jobStateCause(state *model.JobState) string {
+	switch {
+	case state.UserActionCause != nil:
+		return string(state.UserActionCause.ActionCode)
+	case state.DeviceStateCause != nil:
+		return string(state.DeviceStateCause.ErrorCode)
+	case state.DeviceActionCause != nil:
+		return string(state.DeviceActionCause.ErrorCode)
+	case state.ServiceActionCause != nil:
+		return string(state.ServiceActionCause.ErrorCode)
+	}
+	return ""
+}
+
+// EventRecordWriter writes event records as NDJSON. It is safe for
+// concurrent use.
+type EventRecordWriter struct {
+	mutex   sync.Mutex
+	encoder *json.Encoder
+}
+
+func NewEventRecordWriter(w io.Writer) *EventRecordWriter {
+	return &EventRecordWriter{encoder: json.NewEncoder(w)}
+}
+
+// Write writes a record, on its own line.
+func (w *EventRecordWriter) Write(r EventRecord) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.encoder.Encode(r)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestEventRecord(t *testing.T) {
+	pages := int32(2)
+	at := time.Date(2024, 5, 6, 9, 30, 0, 500, time.FixedZone("CST", 8*3600))
+	var b bytes.Buffer
+	w := NewEventRecordWriter(&b)
+	for _, e := range []Event{
+		{Type: EventJobStateChanged, Time: at, Printer: "Office", JobID: 12, JobState: &model.PrintJobStateDiff{
+			State:        &model.JobState{Type: model.JobStateAborted, DeviceActionCause: &model.DeviceActionCause{ErrorCode: model.DeviceActionCausePrintFailure}},
+			PagesPrinted: &pages,
+		}},
+		{Type: EventPrinterStateChanged, Time: at, Printer: "Office", PrinterState: &model.PrinterStateSection{
+			State:       model.CloudDeviceStateIdle,
+			VendorState: &model.VendorState{Item: []model.VendorStateItem{{State: model.VendorStateWarning, Description: "toner low"}}},
+		}},
+	} {
+		if err := w.Write(NewEventRecord(e)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The schema is stable: changing these lines needs a new version.
+	expected := `{"version":1,"type":"JOB_STATE_CHANGED","time":"2024-05-06T01:30:00.0000005Z","severity":"ERROR","printer":"Office","job_id":12,"job_state":"ABORTED","job_state_cause":"PRINT_FAILURE","pages_printed":2}
+{"version":1,"type":"PRINTER_STATE_CHANGED","time":"2024-05-06T01:30:00.0000005Z","severity":"WARNING","printer":"Office","printer_state":"IDLE","printer_messages":["toner low"]}
+`
+	if b.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
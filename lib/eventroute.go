@@ -0,0 +1,171 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type EventSeverity string
+
+const (
+	EventSeverityInfo    EventSeverity = "INFO"
+	EventSeverityWarning EventSeverity = "WARNING"
+	EventSeverityError   EventSeverity = "ERROR"
+)
+
+var eventSeverityRanks = map[EventSeverity]int{
+	EventSeverityInfo:    0,
+	EventSeverityWarning: 1,
+	EventSeverityError:   2,
+}
+
+var eventTypes = map[EventType]bool{
+	EventPrinterAdded:        true,
+	EventPrinterRemoved:      true,
+	EventPrinterStateChanged: true,
+	EventJobAdded:            true,
+	EventJobStateChanged:     true,
+	EventJobProgress:         true,
+}
+
+// Severity tells how much attention an event needs: an error for aborted
+// jobs and stopped printers, or printers with a vendor error state, a
+// warning for stopped jobs, removed printers and vendor warning states,
+// information otherwise.
+func (e Event) Severity() EventSeverity {
+	severity := EventSeverityInfo
+	raise := func(s EventSeverity) {
+		if eventSeverityRanks[s] > eventSeverityRanks[severity] {
+			severity = s
+		}
+	}
+	if e.Type == EventPrinterRemoved {
+		raise(EventSeverityWarning)
+	}
+	if e.JobState != nil && e.JobState.State != nil {
+		switch e.JobState.State.Type {
+		case model.JobStateAborted:
+			raise(EventSeverityError)
+		case model.JobStateStopped:
+			raise(EventSeverityWarning)
+		}
+	}
+	if e.PrinterState != nil {
+		if e.PrinterState.State == model.CloudDeviceStateStopped {
+			raise(EventSeverityError)
+		}
+		if e.PrinterState.VendorState != nil {
+			for _, item := range e.PrinterState.VendorState.Item {
+				switch item.State {
+				case model.VendorStateError:
+					raise(EventSeverityError)
+				case model.VendorStateWarning:
+					raise(EventSeverityWarning)
+				}
+			}
+		}
+	}
+	return severity
+}
+
+// EventRoute posts the events its rules match to a webhook. A rule that is
+// empty matches every event; an event has to match all of them.
+type EventRoute struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+
+	// Printer names, or path.Match patterns such as "Label*".
+	Printers []string `json:"printers,omitempty"`
+	// Tenants of printers, set by their tenant setting. Events of printers
+	// without a tenant only match routes without tenants.
+	Tenants []string    `json:"tenants,omitempty"`
+	Types   []EventType `json:"types,omitempty"`
+	// Least severity of events, INFO when empty.
+	MinSeverity EventSeverity `json:"min_severity,omitempty"`
+}
+
+// RoutedEvent is an event as posted by a route.
+type RoutedEvent struct {
+	Event
+	Route    string        `json:"route"`
+	Tenant   string        `json:"tenant,omitempty"`
+	Severity EventSeverity `json:"severity"`
+}
+
+// Validate checks that the route has a name and an http or https URL, and
+// that its rules are valid.
+func (r *EventRoute) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("event route has no name")
+	}
+	if u, err := url.Parse(r.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("event route %s: invalid url %q", r.Name, r.URL)
+	}
+	for _, printer := range r.Printers {
+		if _, err := path.Match(printer, ""); err != nil {
+			return fmt.Errorf("event route %s: bad pattern %q: %s", r.Name, printer, err)
+		}
+	}
+	for _, t := range r.Types {
+		if !eventTypes[t] {
+			return fmt.Errorf("event route %s: unknown event type %s", r.Name, t)
+		}
+	}
+	if _, ok := eventSeverityRanks[r.MinSeverity]; !ok && r.MinSeverity != "" {
+		return fmt.Errorf("event route %s: unknown severity %s", r.Name, r.MinSeverity)
+	}
+	return nil
+}
+
+// Matches tells whether the route posts an event of a printer of tenant.
+// The route is valid.
+func (r *EventRoute) Matches(event Event, tenant string) bool {
+	if len(r.Printers) > 0 {
+		matched := false
+		for _, printer := range r.Printers {
+			if ok, _ := path.Match(printer, event.Printer); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Tenants) > 0 {
+		matched := false
+		for _, t := range r.Tenants {
+			if t == tenant {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.Types) > 0 {
+		matched := false
+		for _, t := range r.Types {
+			if t == event.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return eventSeverityRanks[event.Severity()] >= eventSeverityRanks[r.MinSeverity]
+}
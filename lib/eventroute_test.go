@@ -0,0 +1,77 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestEventSeverity(t *testing.T) {
+	for _, c := range []struct {
+		event    Event
+		expected EventSeverity
+	}{
+		{Event{Type: EventJobAdded, JobState: &model.PrintJobStateDiff{State: &model.JobState{Type: model.JobStateQueued}}}, EventSeverityInfo},
+		{Event{Type: EventJobStateChanged, JobState: &model.PrintJobStateDiff{State: &model.JobState{Type: model.JobStateStopped}}}, EventSeverityWarning},
+		{Event{Type: EventJobStateChanged, JobState: &model.PrintJobStateDiff{State: &model.JobState{Type: model.JobStateAborted}}}, EventSeverityError},
+		{Event{Type: EventPrinterRemoved}, EventSeverityWarning},
+		{Event{Type: EventPrinterStateChanged, PrinterState: &model.PrinterStateSection{
+			State:       model.CloudDeviceStateIdle,
+			VendorState: &model.VendorState{Item: []model.VendorStateItem{{State: model.VendorStateWarning, Description: "toner low"}}},
+		}}, EventSeverityWarning},
+		{Event{Type: EventPrinterStateChanged, PrinterState: &model.PrinterStateSection{State: model.CloudDeviceStateStopped}}, EventSeverityError},
+	} {
+		if severity := c.event.Severity(); severity != c.expected {
+			t.Errorf("%+v: expected %s got %s", c.event, c.expected, severity)
+		}
+	}
+}
+
+func TestEventRouteMatches(t *testing.T) {
+	route := EventRoute{
+		Name:        "labels",
+		URL:         "https://hooks.example.com/labels",
+		Printers:    []string{"Label*", "Office"},
+		Tenants:     []string{"acme"},
+		Types:       []EventType{EventJobStateChanged, EventPrinterStateChanged},
+		MinSeverity: EventSeverityWarning,
+	}
+	if err := route.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	stopped := Event{Type: EventJobStateChanged, Printer: "Label 2", JobState: &model.PrintJobStateDiff{State: &model.JobState{Type: model.JobStateStopped}}}
+	if !route.Matches(stopped, "acme") {
+		t.Error("expected a stopped job of an acme label printer to match")
+	}
+	for name, matches := range map[string]bool{
+		"other tenant":   route.Matches(stopped, "globex"),
+		"no tenant":      route.Matches(stopped, ""),
+		"other printer":  route.Matches(Event{Type: stopped.Type, Printer: "Lab", JobState: stopped.JobState}, "acme"),
+		"other type":     route.Matches(Event{Type: EventJobProgress, Printer: "Office", JobState: stopped.JobState}, "acme"),
+		"lower severity": route.Matches(Event{Type: stopped.Type, Printer: "Office"}, "acme"),
+	} {
+		if matches {
+			t.Errorf("%s: expected no match", name)
+		}
+	}
+
+	for _, invalid := range []EventRoute{
+		{URL: "http://hooks"},
+		{Name: "a", URL: "hooks"},
+		{Name: "a", URL: "http://hooks", Printers: []string{"[a"}},
+		{Name: "a", URL: "http://hooks", Types: []EventType{"JOB_DONE"}},
+		{Name: "a", URL: "http://hooks", MinSeverity: "CRITICAL"},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", invalid)
+		}
+	}
+}
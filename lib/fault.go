@@ -0,0 +1,133 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrFaultInjected is wrapped by the errors of injected faults.
+var ErrFaultInjected = errors.New("injected fault")
+
+// FaultConfig makes calls to a spooler operation fail or stall, to test
+// retries, failover and watchdogs against a misbehaving spooler.
+type FaultConfig struct {
+	// Operation is a spooler method, such as "GetPrinters", "Print",
+	// "GetJobState" or "WatchChanges"; "*" matches all of them.
+	Operation string `json:"operation"`
+	// Printer restricts the fault to calls for this printer.
+	Printer string `json:"printer,omitempty"`
+	// Error the calls fail with. Calls continue after stalling when empty.
+	Error string `json:"error,omitempty"`
+	// Time calls are held for before failing or continuing, e.g. "30s".
+	Stall string `json:"stall,omitempty"`
+	// Matching calls let through before the fault applies.
+	Skip int `json:"skip,omitempty"`
+	// Calls the fault applies to; all the following calls when zero.
+	Count int `json:"count,omitempty"`
+}
+
+type fault struct {
+	FaultConfig
+	stall time.Duration
+	calls int
+}
+
+// Faults injects faults into the calls of a spooler. Faults apply in the
+// order they were added; a call gets the first fault that matches it. A nil
+// *Faults injects nothing.
+type Faults struct {
+	mutex  sync.Mutex
+	faults []*fault
+}
+
+// NewFaults creates the configured faults.
+func NewFaults(configs []FaultConfig) (*Faults, error) {
+	var f Faults
+	for _, config := range configs {
+		if err := f.Add(config); err != nil {
+			return nil, err
+		}
+	}
+	return &f, nil
+}
+
+// Add adds a fault, after the existing ones.
+func (f *Faults) Add(config FaultConfig) error {
+	if config.Operation == "" {
+		return errors.New("fault without operation")
+	}
+	if config.Error == "" && config.Stall == "" {
+		return fmt.Errorf("fault of %s has neither error nor stall", config.Operation)
+	}
+	if config.Skip < 0 || config.Count < 0 {
+		return fmt.Errorf("fault of %s has negative skip or count", config.Operation)
+	}
+	var stall time.Duration
+	if config.Stall != "" {
+		var err error
+		if stall, err = time.ParseDuration(config.Stall); err != nil {
+			return fmt.Errorf("invalid stall of fault of %s: %s", config.Operation, err)
+		}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = append(f.faults, &fault{FaultConfig: config, stall: stall})
+	return nil
+}
+
+// Clear removes all faults.
+func (f *Faults) Clear() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults = nil
+}
+
+// Inject applies the fault matching a call, if any: it stalls, then returns
+// the error of the fault. Returns nil when the call should proceed.
+func (f *Faults) Inject(operation, printerName string) error {
+	if f == nil {
+		return nil
+	}
+	fault := f.match(operation, printerName)
+	if fault == nil {
+		return nil
+	}
+	time.Sleep(fault.stall)
+	if fault.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", fault.Error, ErrFaultInjected)
+}
+
+func (f *Faults) match(operation, printerName string) *fault {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, fault := range f.faults {
+		if fault.Operation != "*" && fault.Operation != operation {
+			continue
+		}
+		if fault.Printer != "" && fault.Printer != printerName {
+			continue
+		}
+		fault.calls++
+		if fault.calls <= fault.Skip {
+			return nil
+		}
+		if fault.Count > 0 && fault.calls > fault.Skip+fault.Count {
+			continue
+		}
+		return fault
+	}
+	return nil
+}
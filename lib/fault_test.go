@@ -0,0 +1,62 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFaults(t *testing.T) {
+	var none *Faults
+	if err := none.Inject("GetPrinters", ""); err != nil {
+		t.Errorf("nil faults injected %v", err)
+	}
+
+	f, err := NewFaults([]FaultConfig{
+		{Operation: "GetJobState", Printer: "office", Error: "RPC server unavailable", Skip: 1, Count: 2},
+		{Operation: "*", Stall: "20ms", Count: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []bool{false, true, true, false}
+	for i, fail := range expected {
+		err := f.Inject("GetJobState", "office")
+		if fail != (err != nil) {
+			t.Errorf("call %d: expected failure %v got %v", i, fail, err)
+		}
+		if err != nil && (!errors.Is(err, ErrFaultInjected) || err.Error() != "RPC server unavailable: injected fault") {
+			t.Errorf("call %d: unexpected error %v", i, err)
+		}
+	}
+
+	// The stall was used up by the fourth call above.
+	start := time.Now()
+	if err = f.Inject("Print", "receipt"); err != nil || time.Since(start) > 10*time.Millisecond {
+		t.Errorf("expected call to proceed right away, got %v after %s", err, time.Since(start))
+	}
+	f.Clear()
+	if err = f.Inject("GetJobState", "office"); err != nil {
+		t.Errorf("cleared faults injected %v", err)
+	}
+
+	for _, config := range []FaultConfig{
+		{Error: "failed"},
+		{Operation: "Print"},
+		{Operation: "Print", Stall: "later"},
+		{Operation: "Print", Error: "failed", Count: -1},
+	} {
+		if _, err := NewFaults([]FaultConfig{config}); err == nil {
+			t.Errorf("expected error for %+v", config)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	ContentTypePDF  = "application/pdf"
+	ContentTypePNG  = "image/png"
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypeTIFF = "image/tiff"
+	ContentTypeXPS  = "application/vnd.ms-xpsdocument"
+	ContentTypeZIP  = "application/zip"
+	ContentTypeText = "text/plain"
+
+	// Printer command languages, sent to the printer as-is.
+	ContentTypeZPL    = "application/vnd.zebra-zpl"
+	ContentTypeESCPOS = "application/vnd.epson.escpos"
+)
+
+// Enough to recognize any supported format.
+const contentHeaderSize = 512
+
+var (
+	pdfMagic  = []byte("%PDF-")
+	pngMagic  = []byte("\x89PNG\r\n\x1a\n")
+	jpegMagic = []byte{0xff, 0xd8, 0xff}
+	zipMagic  = []byte("PK\x03\x04")
+)
+
+// ReadContentHeader reads the start of a file, enough for DetectContentType.
+func ReadContentHeader(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header := make([]byte, contentHeaderSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	return header[:n], nil
+}
+
+// DetectContentType recognizes a document by its first bytes, ignoring the
+// file name. Returns an empty string when the format is unknown.
+func DetectContentType(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, pdfMagic):
+		return ContentTypePDF
+	case bytes.HasPrefix(header, pwgRasterSyncWord):
+		return ContentTypePWGRaster
+	case bytes.HasPrefix(header, urfSyncWord):
+		return ContentTypeURF
+	case bytes.HasPrefix(header, pngMagic):
+		return ContentTypePNG
+	case bytes.HasPrefix(header, jpegMagic):
+		return ContentTypeJPEG
+	case bytes.HasPrefix(header, tiffMagicLE), bytes.HasPrefix(header, tiffMagicBE):
+		return ContentTypeTIFF
+	case bytes.HasPrefix(header, zipMagic):
+		return ContentTypeZIP
+	case IsPostScript(header):
+		return ContentTypePostScript
+	case IsHTML(header):
+		return ContentTypeHTML
+	case isZPL(header):
+		return ContentTypeZPL
+	case isESCPOS(header):
+		return ContentTypeESCPOS
+	case isLayout(header):
+		return ContentTypeLayout
+	// Some generators write a few bytes of garbage before the PDF header,
+	// which readers accept within the first 1024 bytes.
+	case bytes.Contains(header, pdfMagic):
+		return ContentTypePDF
+	case isText(header):
+		return ContentTypeText
+	}
+	return ""
+}
+
+// DetectFileContentType is DetectContentType on a file, which also looks
+// inside ZIP packages to tell XPS documents apart.
+func DetectFileContentType(fileName string) (string, error) {
+	header, err := ReadContentHeader(fileName)
+	if err != nil {
+		return "", err
+	}
+	contentType := DetectContentType(header)
+	if contentType != ContentTypeZIP {
+		return contentType, nil
+	}
+
+	r, err := zip.OpenReader(fileName)
+	if err != nil {
+		return contentType, nil
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if strings.HasSuffix(strings.ToLower(f.Name), ".fdseq") {
+			return ContentTypeXPS, nil
+		}
+	}
+	return contentType, nil
+}
+
+// IsRawContentType reports whether a content type is a printer command
+// language, which must bypass rendering.
+func IsRawContentType(contentType string) bool {
+	return contentType == ContentTypeZPL || contentType == ContentTypeESCPOS
+}
+
+// isZPL looks for a ZPL format start, after optional ~ commands such as ~SD.
+func isZPL(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("^XA")) && !bytes.HasPrefix(data, []byte("~")) {
+		return false
+	}
+	return bytes.Contains(data, []byte("^XA")) && isText(bytes.Replace(data, []byte("^"), nil, -1))
+}
+
+// isESCPOS looks for ESC @ (initialize), or a leading ESC/GS command.
+func isESCPOS(data []byte) bool {
+	if bytes.HasPrefix(data, []byte{0x1b, '@'}) {
+		return true
+	}
+	if len(data) < 2 || (data[0] != 0x1b && data[0] != 0x1d) {
+		return false
+	}
+	switch data[1] {
+	case '!', '-', '2', '3', '4', '5', 'E', 'G', 'J', 'M', 'R', 'a', 'd', 't', // ESC commands
+		'B', 'H', 'L', 'V', 'W', 'h', 'k', 'v', 'w', '(':
+		return true
+	}
+	return false
+}
+
+// isText reports whether data looks like text: no NUL bytes, and mostly
+// printable characters.
+func isText(data []byte) bool {
+	if len(data) == 0 || bytes.IndexByte(data, 0) >= 0 {
+		return false
+	}
+	control := 0
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\r' && b != '\t' && b != '\f' {
+			control++
+		}
+	}
+	return control*20 < len(data)
+}
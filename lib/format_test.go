@@ -0,0 +1,38 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "testing"
+
+func TestDetectContentType(t *testing.T) {
+	for data, expected := range map[string]string{
+		"%PDF-1.7\n":                      ContentTypePDF,
+		"\r\n\r\n%PDF-1.4\n":              ContentTypePDF,
+		"RaS2PwgRaster\x00":               ContentTypePWGRaster,
+		"UNIRAST\x00\x00\x00\x00\x01":     ContentTypeURF,
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\r": ContentTypePNG,
+		"\xff\xd8\xff\xe0\x00\x10JFIF":    ContentTypeJPEG,
+		"II*\x00\x08\x00\x00\x00":         ContentTypeTIFF,
+		"PK\x03\x04\x14\x00":              ContentTypeZIP,
+		"%!PS-Adobe-3.0\n":                ContentTypePostScript,
+		"<!DOCTYPE html>":                 ContentTypeHTML,
+		"^XA\n^FO50,50^FDHello^FS\n^XZ\n": ContentTypeZPL,
+		"~SD15^XA^PQ1^XZ":                 ContentTypeZPL,
+		"\x1b@Receipt\n\x1dV\x00":         ContentTypeESCPOS,
+		"\x1b!\x08Total 9.99\n":           ContentTypeESCPOS,
+		".layout 80x150 3\nTotal\n":       ContentTypeLayout,
+		".layouts\n":                      ContentTypeText,
+		"Hello, world.\n":                 ContentTypeText,
+		"\x00\x01\x02\x03":                "",
+	} {
+		if contentType := DetectContentType([]byte(data)); contentType != expected {
+			t.Errorf("%q: expected %q got %q", data, expected, contentType)
+		}
+	}
+}
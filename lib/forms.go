@@ -0,0 +1,99 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Kinds of forms.
+const (
+	// Added by users, such as label stock.
+	FormKindUser = "user"
+	// Standard paper sizes of Windows, which drivers report as paper codes.
+	FormKindBuiltin = "builtin"
+	// Added by printer drivers.
+	FormKindPrinter = "printer"
+)
+
+// Form is a paper size of the forms database of a print server, which the
+// printers of the server can print on at its custom dimensions.
+type Form struct {
+	Name          string `json:"name"`
+	Kind          string `json:"kind"`
+	WidthMicrons  int32  `json:"width_microns"`
+	HeightMicrons int32  `json:"height_microns"`
+}
+
+// ParseFormSize parses a form size in millimeters, WIDTHxHEIGHT, such as
+// 62x29 or 101.6x152.4, into microns.
+func ParseFormSize(s string) (widthMicrons, heightMicrons int32, err error) {
+	size := strings.SplitN(s, "x", 2)
+	if len(size) != 2 {
+		return 0, 0, fmt.Errorf("invalid form size %q, expected WIDTHxHEIGHT in millimeters", s)
+	}
+	width, err := parseLayoutNumber(size[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	height, err := parseLayoutNumber(size[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	// Forms are limited to what DEVMODE paper dimensions hold, in tenths
+	// of a millimeter.
+	if width > 3276.7 || height > 3276.7 {
+		return 0, 0, fmt.Errorf("form size %q is larger than 3276.7 mm", s)
+	}
+	return int32(width*1000 + 0.5), int32(height*1000 + 0.5), nil
+}
+
+// AddFormMediaSizes adds the forms users added to the media sizes a driver
+// reports, as custom sizes without a paper code, which tickets select by
+// their dimensions. Forms of sizes the driver already has, by name or by
+// dimensions, are left out, as are those of Windows and of drivers.
+func AddFormMediaSizes(mediaSize *model.MediaSize, forms []Form) *model.MediaSize {
+	var ms model.MediaSize
+	if mediaSize != nil {
+		ms = *mediaSize
+		ms.Option = append([]model.MediaSizeOption(nil), mediaSize.Option...)
+	}
+	names := make(map[string]bool, len(ms.Option))
+	for i := range ms.Option {
+		names[strings.ToLower(MediaSizeDisplayName(&ms.Option[i]))] = true
+	}
+
+	added := false
+	for _, form := range forms {
+		if form.Kind != FormKindUser || form.WidthMicrons <= 0 || form.HeightMicrons <= 0 || names[strings.ToLower(form.Name)] {
+			continue
+		}
+		if _, ok := MatchMediaSize(&ms, form.WidthMicrons, form.HeightMicrons, MediaSizeTolerance); ok {
+			continue
+		}
+		names[strings.ToLower(form.Name)] = true
+		ms.Option = append(ms.Option, model.MediaSizeOption{
+			Name:                       model.MediaSizeCustom,
+			WidthMicrons:               form.WidthMicrons,
+			HeightMicrons:              form.HeightMicrons,
+			CustomDisplayNameLocalized: model.NewLocalizedString(form.Name),
+		})
+		added = true
+	}
+	if !added {
+		return mediaSize
+	}
+	if mediaSize == nil {
+		ms.Option[0].IsDefault = true
+	}
+	return &ms
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestParseFormSize(t *testing.T) {
+	if w, h, err := ParseFormSize("101.6x152.4"); err != nil || w != 101600 || h != 152400 {
+		t.Errorf("expected 101600x152400, got %dx%d, %v", w, h, err)
+	}
+	for _, s := range []string{"62", "62x", "0x29", "5000x29"} {
+		if _, _, err := ParseFormSize(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestAddFormMediaSizes(t *testing.T) {
+	a4 := model.MediaSizeOption{Name: model.MediaSizeISOA4, WidthMicrons: 210000, HeightMicrons: 297000, IsDefault: true, VendorID: "9"}
+	driver := &model.MediaSize{Option: []model.MediaSizeOption{a4}}
+	forms := []Form{
+		{Name: "A4", Kind: FormKindBuiltin, WidthMicrons: 210000, HeightMicrons: 297000},
+		{Name: "Label 62x29", Kind: FormKindUser, WidthMicrons: 62000, HeightMicrons: 29000},
+		{Name: "My A4", Kind: FormKindUser, WidthMicrons: 210000, HeightMicrons: 297000},
+		{Name: "Label 62x29", Kind: FormKindUser, WidthMicrons: 62000, HeightMicrons: 100000},
+	}
+
+	ms := AddFormMediaSizes(driver, forms)
+	if len(ms.Option) != 2 || len(driver.Option) != 1 {
+		t.Fatalf("expected a form added to a copy of the sizes, got %+v", ms.Option)
+	}
+	label := ms.Option[1]
+	if MediaSizeDisplayName(&label) != "Label 62x29" || label.WidthMicrons != 62000 || label.HeightMicrons != 29000 || label.VendorID != "" || label.IsDefault {
+		t.Errorf("unexpected form option %+v", label)
+	}
+	if option, ok := MatchMediaSize(ms, 62000, 29000, MediaSizeTolerance); ok {
+		t.Errorf("expected forms not to be selected by paper code, matched %+v", option)
+	}
+
+	if AddFormMediaSizes(driver, forms[:1]) != driver {
+		t.Error("expected the sizes of the driver unchanged without user forms")
+	}
+	if ms := AddFormMediaSizes(nil, forms); ms == nil || len(ms.Option) != 2 || !ms.Option[0].IsDefault {
+		t.Errorf("expected forms to make the sizes of a driver reporting none, got %+v", ms)
+	}
+}
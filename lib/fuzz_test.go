@@ -0,0 +1,79 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func FuzzConvertJobStatus(f *testing.F) {
+	for _, status := range []uint32{0, JobStatusSpooling, JobStatusPrinted | JobStatusRetained, JobStatusError | JobStatusPrinting, JobStatusPaperOut, 0xffffffff} {
+		f.Add(status)
+	}
+
+	f.Fuzz(func(t *testing.T, status uint32) {
+		state := ConvertJobStatus(status)
+		switch state.Type {
+		case model.JobStateInProgress, model.JobStateDone, model.JobStateStopped, model.JobStateHeld:
+		case model.JobStateAborted:
+			if state.DeviceActionCause == nil && state.UserActionCause == nil {
+				t.Fatalf("status %#x aborted without a cause", status)
+			}
+		default:
+			t.Fatalf("status %#x has unexpected state %s", status, state.Type)
+		}
+		if status&(JobStatusSpooling|JobStatusPrinting) != 0 && state.Type != model.JobStateInProgress {
+			t.Fatalf("status %#x should be in progress, got %s", status, state.Type)
+		}
+	})
+}
+
+func FuzzParseESCPOSStatus(f *testing.F) {
+	f.Add(byte(0x16), byte(0x12), byte(0x12), byte(0x12))
+	f.Add(byte(0x1e), byte(0x72), byte(0x7e), byte(0x7e))
+	f.Add(byte(0xff), byte(0x00), byte(0x00), byte(0x00))
+
+	f.Fuzz(func(t *testing.T, b1, b2, b3, b4 byte) {
+		status, err := ParseESCPOSStatus([4]byte{b1, b2, b3, b4})
+		if err != nil {
+			return
+		}
+		state := model.PrinterStateSection{State: model.CloudDeviceStateIdle, VendorState: &model.VendorState{}}
+		status.ApplyTo(&state)
+	})
+}
+
+func FuzzImageDecoderTIFF(f *testing.F) {
+	f.Add(tiffFile([]tiffTestPage{{width: 2, height: 1, bits: 1, samples: 1, photometric: tiffBlackIsZero, compression: tiffCompressionNone, predictor: 1, strip: []byte{0x40}}}))
+	f.Add(tiffFile([]tiffTestPage{{width: 3, height: 1, bits: 8, samples: 1, photometric: tiffBlackIsZero, compression: tiffCompressionLZW, predictor: 2, strip: lzwCodes([]int{256, 'a', 258, 257})}}))
+	f.Add(tiffFile([]tiffTestPage{{width: 2, height: 1, bits: 8, samples: 3, photometric: tiffRGB, compression: tiffCompressionPackBits, predictor: 1, strip: []byte{0, 255, 0xff, 0}}}))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := NewImageDecoder(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		d.Limits = RenderLimits{MaxImageWidth: 1000, MaxImageHeight: 1000}
+		for i := 0; i < 10; i++ {
+			page, err := d.NextPage()
+			if err != nil {
+				return
+			}
+			if b := page.Image.Bounds(); b.Dx() > 1000 || b.Dy() > 1000 {
+				t.Fatalf("page of %v exceeds the limits", b)
+			}
+		}
+	})
+}
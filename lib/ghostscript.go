@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const ContentTypePostScript = "application/postscript"
+
+// Large documents can take a while; a hung interpreter shouldn't block the
+// printer forever.
+const ghostscriptTimeout = 5 * time.Minute
+
+// Ghostscript executables, in order of preference.
+var ghostscriptNames = []string{"gswin64c", "gswin32c", "gs"}
+
+// IsPostScript reports whether data starts like a PostScript or EPS document.
+func IsPostScript(data []byte) bool {
+	// Some Windows drivers emit a ^D before the header.
+	data = bytes.TrimPrefix(data, []byte{0x04})
+	return bytes.HasPrefix(data, []byte("%!")) ||
+		bytes.HasPrefix(data, []byte{0xc5, 0xd0, 0xd3, 0xc6}) // DOS EPS binary header.
+}
+
+// FindGhostscript returns the configured Ghostscript executable, or finds
+// one in PATH.
+func FindGhostscript(configured string) (string, error) {
+	if configured != "" {
+		return exec.LookPath(configured)
+	}
+	for _, name := range ghostscriptNames {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", errors.New("PostScript input needs Ghostscript, set ghostscript_path or add it to PATH")
+}
+
+// GhostscriptToPDF converts a PostScript file into PDF.
+func GhostscriptToPDF(gsPath, psFileName, pdfFileName string) error {
+	return GhostscriptMergePDF(gsPath, []string{psFileName}, pdfFileName)
+}
+
+// GhostscriptMergePDF writes the pages of PDF and PostScript files, in
+// order, into one PDF.
+func GhostscriptMergePDF(gsPath string, fileNames []string, pdfFileName string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ghostscriptTimeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	args := []string{"-q", "-dSAFER", "-dBATCH", "-dNOPAUSE",
+		"-sDEVICE=pdfwrite",
+		"-sOutputFile=" + pdfFileName,
+		"-f"}
+	cmd := exec.CommandContext(ctx, gsPath, append(args, fileNames...)...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("Ghostscript timed out after %s", ghostscriptTimeout)
+		}
+		return fmt.Errorf("Ghostscript failed: %s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
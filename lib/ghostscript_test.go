@@ -0,0 +1,24 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "testing"
+
+func TestIsPostScript(t *testing.T) {
+	for _, data := range []string{"%!PS-Adobe-3.0\n", "\x04%!PS\n", "\xc5\xd0\xd3\xc6\x20\x00"} {
+		if !IsPostScript([]byte(data)) {
+			t.Errorf("%q not detected as PostScript", data)
+		}
+	}
+	for _, data := range []string{"%PDF-1.7", "", "PS"} {
+		if IsPostScript([]byte(data)) {
+			t.Errorf("%q detected as PostScript", data)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultHandleIdleTimeout is how long printer handles are kept open unused
+// when the config doesn't say.
+const DefaultHandleIdleTimeout = time.Minute
+
+// handlePoolMaxIdle is how many unused handles are kept per printer and
+// access rights; more are closed when returned.
+const handlePoolMaxIdle = 4
+
+// HandlePool keeps printer handles open between spooler calls, by printer
+// name and access rights, rather than opening and closing one per call.
+// Handles are borrowed with Get, used by one caller at a time, and returned
+// with Put. Those unused for the idle timeout are closed, and all of them
+// are when one turns out invalid, since the spooler service restarted.
+// Open and Close must be set; otherwise the zero value is a pool with
+// DefaultHandleIdleTimeout.
+type HandlePool struct {
+	// Opens a printer with PRINTER_ACCESS_* rights, none as OpenPrinter
+	// does, and closes a handle.
+	Open  func(printerName string, access uint32) (uintptr, error)
+	Close func(handle uintptr) error
+
+	mutex          sync.Mutex
+	idleTimeout    time.Duration
+	idleTimeoutSet bool
+	// Unused handles, the most recently returned last.
+	idle  map[handleKey][]idleHandle
+	timer *time.Timer
+	// Replaced by tests.
+	now func() time.Time
+}
+
+type handleKey struct {
+	printerName string
+	access      uint32
+}
+
+type idleHandle struct {
+	handle uintptr
+	since  time.Time
+}
+
+// SetIdleTimeout sets how long handles are kept unused; zero closes them
+// once returned, as without a pool.
+func (p *HandlePool) SetIdleTimeout(timeout time.Duration) {
+	p.mutex.Lock()
+	p.idleTimeout, p.idleTimeoutSet = timeout, true
+	expired := p.expire()
+	p.mutex.Unlock()
+
+	p.closeAll(expired)
+}
+
+func (p *HandlePool) getIdleTimeout() time.Duration {
+	if !p.idleTimeoutSet {
+		return DefaultHandleIdleTimeout
+	}
+	return p.idleTimeout
+}
+
+func (p *HandlePool) getNow() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+	return time.Now()
+}
+
+// Get borrows a handle to a printer opened with access rights, the most
+// recently returned one, or a new one.
+func (p *HandlePool) Get(printerName string, access uint32) (uintptr, error) {
+	key := handleKey{printerName, access}
+	p.mutex.Lock()
+	expired := p.expire()
+	var handle uintptr
+	if handles := p.idle[key]; len(handles) > 0 {
+		handle = handles[len(handles)-1].handle
+		if len(handles) == 1 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = handles[:len(handles)-1]
+		}
+	}
+	p.mutex.Unlock()
+
+	p.closeAll(expired)
+	if handle != 0 {
+		return handle, nil
+	}
+	return p.Open(printerName, access)
+}
+
+// Put returns a handle borrowed with Get, or opened otherwise with the same
+// printer and rights. err is the error of the last call made with it: a
+// handle the spooler no longer knows, or one it failed to answer, is closed
+// with all those kept.
+func (p *HandlePool) Put(printerName string, access uint32, handle uintptr, err error) {
+	if handle == 0 {
+		return
+	}
+	if IsTransientSpoolerError(err) {
+		p.Invalidate()
+		p.Close(handle)
+		return
+	}
+
+	key := handleKey{printerName, access}
+	p.mutex.Lock()
+	expired := p.expire()
+	keep := p.getIdleTimeout() > 0 && len(p.idle[key]) < handlePoolMaxIdle
+	if keep {
+		if p.idle == nil {
+			p.idle = make(map[handleKey][]idleHandle)
+		}
+		p.idle[key] = append(p.idle[key], idleHandle{handle, p.getNow()})
+		if p.timer == nil {
+			p.timer = time.AfterFunc(p.getIdleTimeout(), p.reap)
+		}
+	}
+	p.mutex.Unlock()
+
+	p.closeAll(expired)
+	if !keep {
+		p.Close(handle)
+	}
+}
+
+// Invalidate closes all the handles kept, such as after the spooler service
+// restarted. Those borrowed are closed when returned with an error.
+func (p *HandlePool) Invalidate() {
+	p.mutex.Lock()
+	var handles []uintptr
+	for _, idle := range p.idle {
+		for _, h := range idle {
+			handles = append(handles, h.handle)
+		}
+	}
+	p.idle = nil
+	p.mutex.Unlock()
+
+	p.closeAll(handles)
+}
+
+// reap closes the handles unused for the idle timeout, and runs again while
+// some are kept.
+func (p *HandlePool) reap() {
+	p.mutex.Lock()
+	p.timer = nil
+	expired := p.expire()
+	if len(p.idle) > 0 {
+		p.timer = time.AfterFunc(p.getIdleTimeout(), p.reap)
+	}
+	p.mutex.Unlock()
+
+	p.closeAll(expired)
+}
+
+// expire takes the handles unused for the idle timeout out of the pool, to
+// be closed once the mutex, which must be held, is released.
+func (p *HandlePool) expire() []uintptr {
+	var expired []uintptr
+	timeout, now := p.getIdleTimeout(), p.getNow()
+	for key, idle := range p.idle {
+		kept := idle[:0]
+		for _, h := range idle {
+			if timeout > 0 && now.Sub(h.since) < timeout {
+				kept = append(kept, h)
+			} else {
+				expired = append(expired, h.handle)
+			}
+		}
+		if len(kept) == 0 {
+			delete(p.idle, key)
+		} else {
+			p.idle[key] = kept
+		}
+	}
+	return expired
+}
+
+func (p *HandlePool) closeAll(handles []uintptr) {
+	for _, handle := range handles {
+		p.Close(handle)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHandlePool(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	var opened uintptr
+	closed := map[uintptr]bool{}
+	p := HandlePool{
+		Open:  func(string, uint32) (uintptr, error) { opened++; return opened, nil },
+		Close: func(h uintptr) error { closed[h] = true; return nil },
+		now:   func() time.Time { return now },
+	}
+
+	h, _ := p.Get("office", 0)
+	p.Put("office", 0, h, nil)
+	if h2, _ := p.Get("office", 0); h2 != h || opened != 1 {
+		t.Fatalf("expected handle %d to be reused, got %d after %d opened", h, h2, opened)
+	}
+	if h2, _ := p.Get("office", 0); h2 == h {
+		t.Error("expected a borrowed handle not to be lent twice")
+	}
+	if h2, _ := p.Get("office", 8); h2 == h {
+		t.Error("expected handles not to be shared across access rights")
+	}
+
+	p.Put("office", 0, h, errors.New("job not found"))
+	if h2, _ := p.Get("office", 0); h2 != h || closed[h] {
+		t.Error("expected a handle to be kept after an error of the call")
+	}
+
+	p.Put("office", 0, h, nil)
+	now = now.Add(DefaultHandleIdleTimeout)
+	p.reap()
+	if !closed[h] {
+		t.Error("expected an idle handle to be closed after the timeout")
+	}
+	if h2, _ := p.Get("office", 0); h2 == h {
+		t.Error("expected a new handle after the timeout")
+	}
+
+	a, _ := p.Get("office", 0)
+	b, _ := p.Get("lobby", 0)
+	p.Put("lobby", 0, b, nil)
+	p.Put("office", 0, a, &Win32Error{Op: "GetJob", Code: 6, Err: testErrno(6)})
+	if !closed[a] || !closed[b] {
+		t.Error("expected all handles to be closed after an invalid handle")
+	}
+
+	p.SetIdleTimeout(0)
+	c, _ := p.Get("office", 0)
+	p.Put("office", 0, c, nil)
+	if !closed[c] {
+		t.Error("expected handles to be closed when returned with a zero timeout")
+	}
+}
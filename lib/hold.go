@@ -0,0 +1,180 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrWrongPIN is wrapped by the errors of releases with another PIN than
+// the one the job was held with.
+var ErrWrongPIN = errors.New("wrong PIN")
+
+// ErrJobNotHeld is wrapped by the errors of releases with a PIN of jobs
+// that aren't held.
+var ErrJobNotHeld = errors.New("job not held")
+
+// MaxWrongPINs is how many wrong PINs a held job takes before only an
+// operator can release it.
+const MaxWrongPINs = 5
+
+// HeldJob is a job held by the hold of its ticket until it is released.
+type HeldJob struct {
+	Printer string `json:"printer"`
+	JobID   uint32 `json:"job_id"`
+	// All the jobs of the submission, with label settings and trailers,
+	// which are released together.
+	JobIDs []uint32  `json:"job_ids"`
+	Title  string    `json:"title"`
+	User   string    `json:"user"`
+	Held   time.Time `json:"held"`
+	// Salted SHA-256 of the PIN, empty for jobs only an operator releases.
+	PINSalt   []byte `json:"pin_salt,omitempty"`
+	PINHash   []byte `json:"pin_hash,omitempty"`
+	WrongPINs int    `json:"wrong_pins,omitempty"`
+}
+
+// HasPIN tells whether the job can be released with a PIN.
+func (j *HeldJob) HasPIN() bool {
+	return len(j.PINHash) > 0
+}
+
+func hashPIN(salt []byte, pin string) []byte {
+	h := sha256.New()
+	h.Write(salt)
+	h.Write([]byte(pin))
+	return h.Sum(nil)
+}
+
+var heldJobsBucket = []byte("held")
+
+// HeldJobs keeps the held jobs in a database file, so that a job held by
+// one process, such as job add, can be released by another, such as
+// winspool serve when a user enters the PIN. Only a salted hash of a PIN is
+// kept. Like AccountingDB, the file is only open while it is used.
+type HeldJobs struct {
+	fileName string
+}
+
+// OpenHeldJobs creates the database file if needed.
+func OpenHeldJobs(fileName string) (*HeldJobs, error) {
+	h := HeldJobs{fileName: fileName}
+	if err := h.update(func(bucket *bolt.Bucket) error { return nil }); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (h *HeldJobs) update(fn func(bucket *bolt.Bucket) error) error {
+	return updateSharedDB("held jobs database", h.fileName, heldJobsBucket, fn)
+}
+
+func heldJobKey(printer string, jobID uint32) []byte {
+	return []byte(printer + "\x00" + strconv.FormatUint(uint64(jobID), 10))
+}
+
+func putHeldJob(bucket *bolt.Bucket, job *HeldJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(heldJobKey(job.Printer, job.JobID), value)
+}
+
+// Hold notes a held job, which can be released with pin unless it is
+// empty.
+func (h *HeldJobs) Hold(job HeldJob, pin string) error {
+	if pin != "" {
+		job.PINSalt = make([]byte, 16)
+		if _, err := rand.Read(job.PINSalt); err != nil {
+			return err
+		}
+		job.PINHash = hashPIN(job.PINSalt, pin)
+	}
+	return h.update(func(bucket *bolt.Bucket) error {
+		return putHeldJob(bucket, &job)
+	})
+}
+
+// Jobs returns the held jobs, by printer and job ID.
+func (h *HeldJobs) Jobs() ([]HeldJob, error) {
+	var jobs []HeldJob
+	err := h.update(func(bucket *bolt.Bucket) error {
+		return bucket.ForEach(func(k, v []byte) error {
+			var job HeldJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+// Check returns a held job, about to be released. With an empty pin, as an
+// operator releases jobs, it returns nil for jobs that aren't held here.
+// Otherwise pin must be the PIN of the job, and wrong PINs are counted: once
+// there were MaxWrongPINs, the job can't be released with a PIN anymore.
+func (h *HeldJobs) Check(printer string, jobID uint32, pin string) (*HeldJob, error) {
+	var found *HeldJob
+	var wrong error
+	err := h.update(func(bucket *bolt.Bucket) error {
+		v := bucket.Get(heldJobKey(printer, jobID))
+		if v == nil {
+			if pin != "" {
+				return fmt.Errorf("%w: job %d on %s", ErrJobNotHeld, jobID, printer)
+			}
+			return nil
+		}
+		var job HeldJob
+		if err := json.Unmarshal(v, &job); err != nil {
+			return err
+		}
+		if pin == "" {
+			found = &job
+			return nil
+		}
+		if !job.HasPIN() {
+			return fmt.Errorf("job %d on %s is held without a PIN, an operator releases it", jobID, printer)
+		}
+		if job.WrongPINs >= MaxWrongPINs {
+			return fmt.Errorf("%w: job %d on %s had %d wrong PINs, an operator must release it", ErrWrongPIN, jobID, printer, job.WrongPINs)
+		}
+		if subtle.ConstantTimeCompare(hashPIN(job.PINSalt, pin), job.PINHash) != 1 {
+			job.WrongPINs++
+			// The count is kept, so the error is returned after the
+			// transaction commits.
+			wrong = fmt.Errorf("%w for job %d on %s", ErrWrongPIN, jobID, printer)
+			return putHeldJob(bucket, &job)
+		}
+		found = &job
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return found, wrong
+}
+
+// Forget drops a job once it is released, or gone from the queue.
+func (h *HeldJobs) Forget(printer string, jobID uint32) error {
+	return h.update(func(bucket *bolt.Bucket) error {
+		return bucket.Delete(heldJobKey(printer, jobID))
+	})
+}
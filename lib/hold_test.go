@@ -0,0 +1,73 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeldJobs(t *testing.T) {
+	h, err := OpenHeldJobs(filepath.Join(t.TempDir(), "held.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if err = h.Hold(HeldJob{Printer: "Office", JobID: 7, JobIDs: []uint32{6, 7}, User: "alice", Held: now}, "4711"); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.Hold(HeldJob{Printer: "Office", JobID: 9, JobIDs: []uint32{9}, User: "bob", Held: now}, ""); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := h.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 2 || !jobs[0].HasPIN() || jobs[1].HasPIN() {
+		t.Fatalf("expected the job with a PIN and the one without got %+v", jobs)
+	}
+
+	if _, err = h.Check("Office", 7, "1234"); !errors.Is(err, ErrWrongPIN) {
+		t.Errorf("expected ErrWrongPIN got %v", err)
+	}
+	if job, err := h.Check("Office", 7, "4711"); err != nil || len(job.JobIDs) != 2 || job.WrongPINs != 1 {
+		t.Errorf("expected the job with its jobs and the wrong PIN counted got %+v, %v", job, err)
+	}
+	if _, err = h.Check("Office", 9, "4711"); err == nil {
+		t.Error("expected an error releasing a job without PIN with a PIN")
+	}
+	if job, err := h.Check("Office", 9, ""); err != nil || job == nil {
+		t.Errorf("expected an operator to release the job without PIN got %+v, %v", job, err)
+	}
+	if job, err := h.Check("Office", 12, ""); err != nil || job != nil {
+		t.Errorf("expected an operator to release jobs held elsewhere got %+v, %v", job, err)
+	}
+	if _, err = h.Check("Office", 12, "4711"); !errors.Is(err, ErrJobNotHeld) {
+		t.Errorf("expected ErrJobNotHeld got %v", err)
+	}
+
+	for i := 1; i < MaxWrongPINs; i++ {
+		h.Check("Office", 7, "0000")
+	}
+	if _, err = h.Check("Office", 7, "4711"); !errors.Is(err, ErrWrongPIN) {
+		t.Errorf("expected the right PIN refused after %d wrong ones got %v", MaxWrongPINs, err)
+	}
+	if job, err := h.Check("Office", 7, ""); err != nil || job == nil {
+		t.Errorf("expected an operator to release the job got %+v, %v", job, err)
+	}
+
+	if err = h.Forget("Office", 7); err != nil {
+		t.Fatal(err)
+	}
+	if jobs, _ = h.Jobs(); len(jobs) != 1 || jobs[0].JobID != 9 {
+		t.Errorf("expected the released job forgotten got %+v", jobs)
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const ContentTypeHTML = "text/html"
+
+// Pages with slow scripts or remote resources may take a while to load.
+const htmlConvertTimeout = 2 * time.Minute
+
+type HTMLConverterType string
+
+const (
+	// Headless Chrome, Edge or Chromium, driven with the DevTools protocol.
+	HTMLConverterChromium    HTMLConverterType = "chromium"
+	HTMLConverterWkhtmltopdf HTMLConverterType = "wkhtmltopdf"
+)
+
+// HTMLConverter selects the program that converts HTML to PDF.
+type HTMLConverter struct {
+	Type HTMLConverterType `json:"type,omitempty"`
+	Path string            `json:"path,omitempty"`
+}
+
+var chromiumNames = []string{"chrome", "msedge", "chromium", "chromium-browser", "google-chrome"}
+
+// Standard install locations on Windows, which aren't in PATH.
+var chromiumWindowsPaths = []struct{ dirEnv, path string }{
+	{"ProgramFiles", `Google\Chrome\Application\chrome.exe`},
+	{"ProgramFiles(x86)", `Google\Chrome\Application\chrome.exe`},
+	{"LocalAppData", `Google\Chrome\Application\chrome.exe`},
+	{"ProgramFiles(x86)", `Microsoft\Edge\Application\msedge.exe`},
+	{"ProgramFiles", `Microsoft\Edge\Application\msedge.exe`},
+}
+
+// HTMLPageOptions sets the PDF page size and margins, in microns.
+type HTMLPageOptions struct {
+	WidthMicrons  int32
+	HeightMicrons int32
+	TopMicrons    int32
+	RightMicrons  int32
+	BottomMicrons int32
+	LeftMicrons   int32
+
+	// BlockNetwork keeps the page from loading remote resources.
+	BlockNetwork bool
+}
+
+// DefaultHTMLPageOptions is A4 with 1 cm margins.
+var DefaultHTMLPageOptions = HTMLPageOptions{
+	WidthMicrons:  210000,
+	HeightMicrons: 297000,
+	TopMicrons:    10000,
+	RightMicrons:  10000,
+	BottomMicrons: 10000,
+	LeftMicrons:   10000,
+}
+
+// IsURL reports whether a job source is a web page rather than a file.
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// IsHTML reports whether data starts like an HTML document.
+func IsHTML(data []byte) bool {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	data = bytes.ToLower(bytes.TrimSpace(data))
+	return bytes.HasPrefix(data, []byte("<!doctype html")) || bytes.HasPrefix(data, []byte("<html"))
+}
+
+// FindHTMLConverter fills in the converter path, or finds a converter when
+// none is configured, preferring Chromium.
+func FindHTMLConverter(configured HTMLConverter) (HTMLConverter, error) {
+	if configured.Path != "" {
+		path, err := exec.LookPath(configured.Path)
+		if err != nil {
+			return configured, err
+		}
+		if configured.Type == "" {
+			configured.Type = HTMLConverterChromium
+			if strings.Contains(strings.ToLower(filepath.Base(path)), "wkhtmltopdf") {
+				configured.Type = HTMLConverterWkhtmltopdf
+			}
+		}
+		configured.Path = path
+		return configured, nil
+	}
+
+	if configured.Type == "" || configured.Type == HTMLConverterChromium {
+		for _, name := range chromiumNames {
+			if path, err := exec.LookPath(name); err == nil {
+				return HTMLConverter{Type: HTMLConverterChromium, Path: path}, nil
+			}
+		}
+		for _, candidate := range chromiumWindowsPaths {
+			dir := os.Getenv(candidate.dirEnv)
+			if dir == "" {
+				continue
+			}
+			path := filepath.Join(dir, candidate.path)
+			if _, err := os.Stat(path); err == nil {
+				return HTMLConverter{Type: HTMLConverterChromium, Path: path}, nil
+			}
+		}
+	}
+	if configured.Type == "" || configured.Type == HTMLConverterWkhtmltopdf {
+		if path, err := exec.LookPath("wkhtmltopdf"); err == nil {
+			return HTMLConverter{Type: HTMLConverterWkhtmltopdf, Path: path}, nil
+		}
+	}
+	return configured, errors.New("HTML input needs Chrome, Edge, Chromium or wkhtmltopdf, set html_converter or add one to PATH")
+}
+
+// fileURL converts a local file name into a file:// URL.
+func fileURL(fileName string) (string, error) {
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.ToSlash(abs)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path // C:/x
+	}
+	return (&url.URL{Scheme: "file", Path: path}).String(), nil
+}
+
+// HTMLToPDF converts an HTML file, or the web page at a URL, into PDF.
+func HTMLToPDF(converter HTMLConverter, source, pdfFileName string, options HTMLPageOptions) error {
+	if options.BlockNetwork && IsURL(source) {
+		return errors.New("URLs can't be printed while external references are disabled")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), htmlConvertTimeout)
+	defer cancel()
+
+	var err error
+	switch converter.Type {
+	case HTMLConverterChromium:
+		err = chromiumToPDF(ctx, converter.Path, source, pdfFileName, options)
+	case HTMLConverterWkhtmltopdf:
+		if options.BlockNetwork {
+			return errors.New("wkhtmltopdf can't block remote resources, use Chromium while external references are disabled")
+		}
+		err = wkhtmltopdfToPDF(ctx, converter.Path, source, pdfFileName, options)
+	default:
+		return fmt.Errorf("unknown HTML converter %q", converter.Type)
+	}
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("HTML conversion timed out after %s", htmlConvertTimeout)
+	}
+	return err
+}
+
+func wkhtmltopdfToPDF(ctx context.Context, path, source, pdfFileName string, options HTMLPageOptions) error {
+	mm := func(microns int32) string { return fmt.Sprintf("%.1fmm", float64(microns)/1000) }
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "--quiet", "--enable-local-file-access",
+		"--page-width", mm(options.WidthMicrons), "--page-height", mm(options.HeightMicrons),
+		"--margin-top", mm(options.TopMicrons), "--margin-right", mm(options.RightMicrons),
+		"--margin-bottom", mm(options.BottomMicrons), "--margin-left", mm(options.LeftMicrons),
+		source, pdfFileName)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wkhtmltopdf failed: %s: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+func chromiumToPDF(ctx context.Context, path, source, pdfFileName string, options HTMLPageOptions) error {
+	pageURL := source
+	if !IsURL(source) {
+		var err error
+		if pageURL, err = fileURL(source); err != nil {
+			return err
+		}
+	}
+
+	userDataDir, err := ioutil.TempDir("", "winspool-chromium-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(userDataDir)
+
+	cmd := exec.CommandContext(ctx, path, "--headless", "--disable-gpu", "--no-first-run",
+		"--no-default-browser-check", "--disable-extensions", "--remote-debugging-port=0",
+		"--user-data-dir="+userDataDir, "about:blank")
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	wsURL, err := waitDevToolsActivePort(ctx, userDataDir)
+	if err != nil {
+		return err
+	}
+	ws, err := dialWebSocket(wsURL, 10*time.Second)
+	if err != nil {
+		return err
+	}
+	defer ws.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.conn.SetDeadline(deadline)
+	}
+
+	inches := func(microns int32) float64 { return float64(microns) / 25400 }
+	client := cdpClient{ws: ws}
+	pdf, err := client.printToPDF(pageURL, map[string]interface{}{
+		"paperWidth":      inches(options.WidthMicrons),
+		"paperHeight":     inches(options.HeightMicrons),
+		"marginTop":       inches(options.TopMicrons),
+		"marginRight":     inches(options.RightMicrons),
+		"marginBottom":    inches(options.BottomMicrons),
+		"marginLeft":      inches(options.LeftMicrons),
+		"printBackground": true,
+	}, options.BlockNetwork)
+	if err != nil {
+		return err
+	}
+	client.call("", "Browser.close", nil, nil, nil)
+
+	return ioutil.WriteFile(pdfFileName, pdf, 0600)
+}
+
+// waitDevToolsActivePort waits for the browser to write the port and path of
+// its DevTools endpoint, and returns the endpoint URL.
+func waitDevToolsActivePort(ctx context.Context, userDataDir string) (string, error) {
+	fileName := filepath.Join(userDataDir, "DevToolsActivePort")
+	for {
+		if b, err := ioutil.ReadFile(fileName); err == nil {
+			lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+			if len(lines) == 2 {
+				return fmt.Sprintf("ws://127.0.0.1:%s%s", strings.TrimSpace(lines[0]), strings.TrimSpace(lines[1])), nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return "", errors.New("browser didn't open its DevTools port")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,50 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestIsHTML(t *testing.T) {
+	for _, data := range []string{"<!DOCTYPE html>\n<html>", "\xef\xbb\xbf  <html lang=\"en\">", "<!doctype HTML>"} {
+		if !IsHTML([]byte(data)) {
+			t.Errorf("%q not detected as HTML", data)
+		}
+	}
+	for _, data := range []string{"%PDF-1.7", "", "<?xml version=\"1.0\"?>"} {
+		if IsHTML([]byte(data)) {
+			t.Errorf("%q detected as HTML", data)
+		}
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	sender := &webSocketConn{conn: client, r: bufio.NewReader(client)}
+	receiver := &webSocketConn{conn: server, r: bufio.NewReader(server)}
+
+	for _, size := range []int{5, 300, 70000} {
+		payload := bytes.Repeat([]byte("x"), size)
+		go sender.writeFrame(0x1, payload)
+		message, err := receiver.readMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(message, payload) {
+			t.Errorf("%d byte message corrupted", size)
+		}
+	}
+}
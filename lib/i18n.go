@@ -0,0 +1,93 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"strings"
+)
+
+// Language is a language messages are shown in, as a BCP 47 tag.
+type Language string
+
+// Languages of the messages of the command line.
+const (
+	LanguageChinese Language = "zh-CN"
+	LanguageEnglish Language = "en-US"
+)
+
+// ParseLanguage reads a language tag, such as en, en-US or a POSIX locale
+// such as en_US.UTF-8. Returns false for languages there are no messages in.
+func ParseLanguage(s string) (Language, bool) {
+	s = strings.ToLower(s)
+	if i := strings.IndexAny(s, ".@"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.Replace(s, "_", "-", -1)
+	switch {
+	case s == "zh" || strings.HasPrefix(s, "zh-"):
+		return LanguageChinese, true
+	case s == "en" || strings.HasPrefix(s, "en-"):
+		return LanguageEnglish, true
+	}
+	return "", false
+}
+
+// DetectLanguage picks the language of a command line: the --lang flag of
+// args, else the LC_ALL, LC_MESSAGES or LANG environment variable, else def.
+// The flag is looked for before flags are parsed, so that usage is shown in
+// the language too.
+func DetectLanguage(args []string, getenv func(string) string, def Language) Language {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		var value string
+		switch {
+		case arg == "--lang" || arg == "-lang":
+			if i+1 < len(args) {
+				value = args[i+1]
+			}
+		case strings.HasPrefix(arg, "--lang="):
+			value = strings.TrimPrefix(arg, "--lang=")
+		case strings.HasPrefix(arg, "-lang="):
+			value = strings.TrimPrefix(arg, "-lang=")
+		default:
+			continue
+		}
+		if language, ok := ParseLanguage(value); ok {
+			return language
+		}
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		value := getenv(name)
+		if value == "" {
+			continue
+		}
+		// The first variable set decides, as with gettext; C and POSIX
+		// locales get the default.
+		if language, ok := ParseLanguage(value); ok {
+			return language
+		}
+		return def
+	}
+	return def
+}
+
+// Messages are catalogs of translations, by language, keyed by the message
+// in the language the source is written in.
+type Messages map[Language]map[string]string
+
+// Translate returns the translation of message, or message itself when the
+// catalog of the language doesn't have it.
+func (m Messages) Translate(language Language, message string) string {
+	if translated, ok := m[language][message]; ok {
+		return translated
+	}
+	return message
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "testing"
+
+func TestParseLanguage(t *testing.T) {
+	for s, expected := range map[string]Language{
+		"en":          LanguageEnglish,
+		"en-US":       LanguageEnglish,
+		"en_GB.UTF-8": LanguageEnglish,
+		"zh":          LanguageChinese,
+		"zh_CN.GBK":   LanguageChinese,
+		"zh-Hans":     LanguageChinese,
+	} {
+		if language, ok := ParseLanguage(s); !ok || language != expected {
+			t.Errorf("%s: expected %s, got %s", s, expected, language)
+		}
+	}
+	for _, s := range []string{"", "C", "fr_FR.UTF-8", "english"} {
+		if language, ok := ParseLanguage(s); ok {
+			t.Errorf("%s: unexpected %s", s, language)
+		}
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	env := map[string]string{"LANG": "en_US.UTF-8"}
+	getenv := func(name string) string { return env[name] }
+
+	if language := DetectLanguage([]string{"printer", "ls"}, getenv, LanguageChinese); language != LanguageEnglish {
+		t.Errorf("expected LANG to be used, got %s", language)
+	}
+	if language := DetectLanguage([]string{"--lang", "zh-CN", "printer", "ls"}, getenv, LanguageChinese); language != LanguageChinese {
+		t.Errorf("expected --lang to override LANG, got %s", language)
+	}
+	if language := DetectLanguage([]string{"--lang=fr", "printer"}, getenv, LanguageChinese); language != LanguageEnglish {
+		t.Errorf("expected an unknown --lang to be ignored, got %s", language)
+	}
+	if language := DetectLanguage([]string{"job", "add", "--", "--lang=en"}, func(string) string { return "" }, LanguageChinese); language != LanguageChinese {
+		t.Errorf("expected arguments after -- to be ignored, got %s", language)
+	}
+
+	env["LC_ALL"] = "C"
+	if language := DetectLanguage(nil, getenv, LanguageChinese); language != LanguageChinese {
+		t.Errorf("expected LC_ALL=C to get the default, got %s", language)
+	}
+}
+
+func TestMessagesTranslate(t *testing.T) {
+	messages := Messages{LanguageEnglish: {"打印机": "Printer"}}
+	if s := messages.Translate(LanguageEnglish, "打印机"); s != "Printer" {
+		t.Errorf("unexpected translation %q", s)
+	}
+	if s := messages.Translate(LanguageEnglish, "作业"); s != "作业" {
+		t.Errorf("expected untranslated messages to be kept, got %q", s)
+	}
+	if s := messages.Translate(LanguageChinese, "打印机"); s != "打印机" {
+		t.Errorf("expected the source language to be kept, got %q", s)
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+)
+
+// Resolution assumed for images that don't have one.
+const defaultImageDPI = 96
+
+// PageDecoder decodes the pages of a raster document or image, and returns
+// io.EOF after the last.
+type PageDecoder interface {
+	NextPage() (*RasterPage, error)
+}
+
+// IsImage reports whether data starts like a PNG, JPEG or TIFF image.
+func IsImage(data []byte) bool {
+	return bytes.HasPrefix(data, pngMagic) || bytes.HasPrefix(data, jpegMagic) ||
+		bytes.HasPrefix(data, tiffMagicLE) || bytes.HasPrefix(data, tiffMagicBE)
+}
+
+// ImageDecoder reads PNG and JPEG images as one page, and TIFF images as
+// one page per image in the file. Images with transparency are flattened
+// on white paper.
+type ImageDecoder struct {
+	// Limits are checked against each image size, before decoding.
+	Limits RenderLimits
+
+	r    io.ReadSeeker
+	tiff *tiffDecoder
+	done bool
+}
+
+// NewImageDecoder reads the header of an image.
+func NewImageDecoder(r io.ReadSeeker) (*ImageDecoder, error) {
+	header := make([]byte, 8)
+	n, _ := io.ReadFull(r, header)
+	if !IsImage(header[:n]) {
+		return nil, errors.New("not a PNG, JPEG or TIFF image")
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	d := ImageDecoder{r: r}
+	if bytes.HasPrefix(header, tiffMagicLE) || bytes.HasPrefix(header, tiffMagicBE) {
+		ra, ok := r.(io.ReaderAt)
+		if !ok {
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return nil, err
+			}
+			ra = bytes.NewReader(data)
+		}
+		var err error
+		if d.tiff, err = newTIFFDecoder(ra); err != nil {
+			return nil, err
+		}
+	}
+	return &d, nil
+}
+
+func (d *ImageDecoder) NextPage() (*RasterPage, error) {
+	if d.tiff != nil {
+		return d.nextTIFFPage()
+	}
+	if d.done {
+		return nil, io.EOF
+	}
+	d.done = true
+
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Limits.CheckImage(config.Width, config.Height); err != nil {
+		return nil, err
+	}
+
+	var img image.Image
+	xDPI, yDPI := 0, 0
+	switch format {
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+		xDPI, yDPI = pngResolution(data)
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+		xDPI, yDPI = jfifResolution(data)
+	default:
+		return nil, errors.New("not a PNG or JPEG image")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return newImagePage(img, xDPI, yDPI), nil
+}
+
+func (d *ImageDecoder) nextTIFFPage() (*RasterPage, error) {
+	ifd, err := d.tiff.readIFD()
+	if err != nil {
+		return nil, err
+	}
+	p, err := d.tiff.page(ifd)
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Limits.CheckImage(p.width, p.height); err != nil {
+		return nil, err
+	}
+	img, err := d.tiff.decode(p)
+	if err != nil {
+		return nil, err
+	}
+	xDPI, yDPI := p.resolution()
+	return newImagePage(img, xDPI, yDPI), nil
+}
+
+// newImagePage flattens images other than gray, CMYK and opaque RGBA on
+// white, so that transparent pixels print as paper rather than black.
+func newImagePage(img image.Image, xDPI, yDPI int) *RasterPage {
+	switch img.(type) {
+	case *image.Gray, *image.CMYK:
+	default:
+		if rgba, ok := img.(*image.RGBA); !ok || !rgba.Opaque() {
+			flat := image.NewRGBA(img.Bounds())
+			draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+			draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+			img = flat
+		}
+	}
+	if xDPI <= 0 || yDPI <= 0 {
+		xDPI, yDPI = defaultImageDPI, defaultImageDPI
+	}
+	return &RasterPage{XDPI: xDPI, YDPI: yDPI, Image: img}
+}
+
+// pngResolution reads the pHYs chunk, in pixels per meter; zero when absent.
+func pngResolution(data []byte) (int, int) {
+	for pos := len(pngMagic); pos+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		chunk := string(data[pos+4 : pos+8])
+		if chunk == "IDAT" || length < 0 || pos+12+length > len(data) {
+			break
+		}
+		if chunk == "pHYs" && length == 9 && data[pos+16] == 1 {
+			body := data[pos+8:]
+			ppm := func(v uint32) int { return int(float64(v)*0.0254 + 0.5) }
+			return ppm(binary.BigEndian.Uint32(body)), ppm(binary.BigEndian.Uint32(body[4:]))
+		}
+		pos += 12 + length
+	}
+	return 0, 0
+}
+
+// jfifResolution reads the density of the JFIF APP0 segment; zero when
+// absent or only an aspect ratio.
+func jfifResolution(data []byte) (int, int) {
+	// SOI, then APP0: marker, length, "JFIF\0", version, units, densities.
+	if len(data) < 18 || data[2] != 0xff || data[3] != 0xe0 || string(data[6:11]) != "JFIF\x00" {
+		return 0, 0
+	}
+	x, y := int(binary.BigEndian.Uint16(data[14:])), int(binary.BigEndian.Uint16(data[16:]))
+	switch data[13] {
+	case 1: // dots per inch
+		return x, y
+	case 2: // dots per cm
+		return int(float64(x)*2.54 + 0.5), int(float64(y)*2.54 + 0.5)
+	}
+	return 0, 0
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"testing"
+)
+
+type tiffTestPage struct {
+	width, height int
+	bits, samples uint16
+	photometric   uint16
+	compression   uint16
+	predictor     uint16
+	// Encoded strip, a single one for the whole page.
+	strip []byte
+}
+
+// tiffFile writes a little endian TIFF of pages, at 200 DPI.
+func tiffFile(pages []tiffTestPage) []byte {
+	var b bytes.Buffer
+	b.Write([]byte("II*\x00"))
+	binary.Write(&b, binary.LittleEndian, uint32(8))
+	for i, p := range pages {
+		// The IFD is followed by the resolution then the strip.
+		type entry struct {
+			tag, typ     uint16
+			count, value uint32
+		}
+		ifdOffset := uint32(b.Len())
+		entries := []entry{
+			{tiffImageWidth, 4, 1, uint32(p.width)},
+			{tiffImageLength, 4, 1, uint32(p.height)},
+			{tiffBitsPerSample, 3, 1, uint32(p.bits)},
+			{tiffCompression, 3, 1, uint32(p.compression)},
+			{tiffPhotometric, 3, 1, uint32(p.photometric)},
+			{tiffStripOffsets, 4, 1, 0},
+			{tiffSamplesPerPixel, 3, 1, uint32(p.samples)},
+			{tiffRowsPerStrip, 4, 1, uint32(p.height)},
+			{tiffStripByteCounts, 4, 1, uint32(len(p.strip))},
+			{tiffXResolution, 5, 1, 0},
+			{tiffYResolution, 5, 1, 0},
+			{tiffPredictor, 3, 1, uint32(p.predictor)},
+		}
+		resolution := ifdOffset + 2 + uint32(len(entries))*12 + 4
+		entries[9].value, entries[10].value = resolution, resolution
+		entries[5].value = resolution + 8
+
+		binary.Write(&b, binary.LittleEndian, uint16(len(entries)))
+		for _, e := range entries {
+			binary.Write(&b, binary.LittleEndian, e)
+		}
+		next := uint32(0)
+		if i < len(pages)-1 {
+			next = resolution + 8 + uint32(len(p.strip))
+		}
+		binary.Write(&b, binary.LittleEndian, next)
+		binary.Write(&b, binary.LittleEndian, [2]uint32{200, 1})
+		b.Write(p.strip)
+	}
+	return b.Bytes()
+}
+
+// lzwCodes packs TIFF LZW codes, growing the width like the decoder.
+func lzwCodes(codes []int) []byte {
+	var out []byte
+	var bits uint32
+	var nBits uint
+	width, tableLen := uint(9), 258
+	for i, code := range codes {
+		bits = bits<<width | uint32(code)
+		nBits += width
+		for nBits >= 8 {
+			out = append(out, byte(bits>>(nBits-8)))
+			nBits -= 8
+		}
+		switch {
+		case code == 256:
+			width, tableLen = 9, 258
+		case i > 0 && codes[i-1] != 256:
+			tableLen++
+		}
+		if tableLen+1 >= 1<<width && width < 12 {
+			width++
+		}
+	}
+	if nBits > 0 {
+		out = append(out, byte(bits<<(8-nBits)))
+	}
+	return out
+}
+
+func TestImageDecoderTIFF(t *testing.T) {
+	deflate := func(data []byte) []byte {
+		var b bytes.Buffer
+		w := zlib.NewWriter(&b)
+		w.Write(data)
+		w.Close()
+		return b.Bytes()
+	}
+	// 600 literal codes cross the 9 to 10 bit width change.
+	literals := []int{256}
+	for i := 0; i < 600; i++ {
+		literals = append(literals, i%200)
+	}
+	literals = append(literals, 257)
+
+	doc := tiffFile([]tiffTestPage{
+		// Bilevel, black is zero: a black then a white pixel.
+		{width: 2, height: 1, bits: 1, samples: 1, photometric: tiffBlackIsZero, compression: tiffCompressionNone, predictor: 1, strip: []byte{0x40}},
+		// RGB with PackBits: 2 red pixels, literal 255 then a run of 2 zeros.
+		{width: 2, height: 1, bits: 8, samples: 3, photometric: tiffRGB, compression: tiffCompressionPackBits, predictor: 1, strip: []byte{0, 255, 0xff, 0, 0, 255, 0xff, 0}},
+		// Gray, Deflate with horizontal differencing: 10, 30.
+		{width: 2, height: 1, bits: 8, samples: 1, photometric: tiffWhiteIsZero, compression: tiffCompressionDeflate, predictor: 2, strip: deflate([]byte{10, 20})},
+		// Gray, LZW.
+		{width: 600, height: 1, bits: 8, samples: 1, photometric: tiffBlackIsZero, compression: tiffCompressionLZW, predictor: 1, strip: lzwCodes(literals)},
+		// Gray, LZW reusing the code being defined: "aaa".
+		{width: 3, height: 1, bits: 8, samples: 1, photometric: tiffBlackIsZero, compression: tiffCompressionLZW, predictor: 1, strip: lzwCodes([]int{256, 'a', 258, 257})},
+	})
+	if !IsImage(doc) || DetectContentType(doc) != ContentTypeTIFF {
+		t.Fatal("TIFF not detected")
+	}
+
+	d, err := NewImageDecoder(bytes.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []*RasterPage
+	for {
+		page, err := d.NextPage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("page %d: %s", len(pages)+1, err)
+		}
+		pages = append(pages, page)
+	}
+	if len(pages) != 5 {
+		t.Fatalf("expected 5 pages got %d", len(pages))
+	}
+	if pages[0].XDPI != 200 || pages[0].YDPI != 200 {
+		t.Errorf("expected 200 DPI got %dx%d", pages[0].XDPI, pages[0].YDPI)
+	}
+	if g := pages[0].Image.(*image.Gray); g.Pix[0] != 0 || g.Pix[1] != 0xff {
+		t.Errorf("unexpected bilevel pixels %v", g.Pix)
+	}
+	if c := pages[1].Image.At(1, 0); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("expected red got %v", c)
+	}
+	if g := pages[2].Image.(*image.Gray); g.Pix[0] != 245 || g.Pix[1] != 225 {
+		t.Errorf("unexpected predicted pixels %v", g.Pix)
+	}
+	for x, g := 0, pages[3].Image.(*image.Gray); x < 600; x++ {
+		if g.Pix[x] != byte(x%200) {
+			t.Fatalf("LZW pixel %d: expected %d got %d", x, x%200, g.Pix[x])
+		}
+	}
+	if g := pages[4].Image.(*image.Gray); string(g.Pix) != "aaa" {
+		t.Errorf("expected aaa got %q", g.Pix)
+	}
+
+	d, _ = NewImageDecoder(bytes.NewReader(doc))
+	d.Limits = RenderLimits{MaxImageWidth: 100, MaxImageHeight: 100}
+	for i := 0; i < 3; i++ {
+		d.NextPage()
+	}
+	if _, err = d.NextPage(); err == nil {
+		t.Error("expected the 600 pixel wide page to exceed the limits")
+	}
+}
+
+func TestImageDecoderPNG(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.NRGBA{0, 0, 255, 255})
+	img.Set(1, 0, color.NRGBA{0, 0, 0, 0})
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := NewImageDecoder(bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := d.NextPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.XDPI != defaultImageDPI || page.Image.At(0, 0) != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("unexpected page %d DPI, %v", page.XDPI, page.Image.At(0, 0))
+	}
+	if c := page.Image.At(1, 0); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected transparency flattened on white got %v", c)
+	}
+	if _, err = d.NextPage(); err != io.EOF {
+		t.Errorf("expected a single page, got %v", err)
+	}
+
+	if _, err = NewImageDecoder(bytes.NewReader([]byte("%PDF-1.4"))); err == nil {
+		t.Error("expected error for a PDF")
+	}
+}
@@ -8,7 +8,12 @@ https://developers.google.com/open-source/licenses/bsd
 
 package lib
 
-import "github.com/gorpher/winspool-cgo/model"
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
 
 type Job struct {
 	NativePrinterName string
@@ -17,4 +22,119 @@ type Job struct {
 	JobID             string
 	Ticket            *model.JobTicket
 	UpdateJob         func(string, *model.PrintJobStateDiff) error
+	// Called when the job is interrupted, then again when the interruption
+	// ends; see JobInterruption.
+	ReportInterruption func(string, JobInterruption) error
+	// Called, if set, once Filename isn't needed anymore: when the job is
+	// printed, or copied into the job queue.
+	Cleanup func()
 }
+
+type JobRecovery string
+
+const (
+	// The job continued by itself.
+	JobRecoveryResumed JobRecovery = "RESUMED"
+	// The job didn't continue in time, and was printed again from the start.
+	JobRecoveryRestarted JobRecovery = "RESTARTED"
+	// The job didn't continue in time, and was left as it is.
+	JobRecoveryNotResumed JobRecovery = "NOT_RESUMED"
+	// The job was canceled or failed while interrupted.
+	JobRecoveryAborted JobRecovery = "ABORTED"
+)
+
+// Reason of a job interruption: the printer ran out of paper.
+const JobInterruptionPaperOut = "PAPER_OUT"
+
+// JobInterruption is a stop of a job for a printer condition, such as the
+// printer running out of paper.
+type JobInterruption struct {
+	// Printer condition, such as JobInterruptionPaperOut.
+	Reason string    `json:"reason"`
+	Start  time.Time `json:"start"`
+	// Zero, like Recovery, while the job is interrupted.
+	End      time.Time   `json:"end"`
+	Recovery JobRecovery `json:"recovery,omitempty"`
+}
+
+// PrintResult describes how a document was printed.
+type PrintResult struct {
+	JobID uint32 `json:"job_id"`
+
+	// All jobs sent for the document, in queue order, including control
+	// jobs such as label settings and trailers.
+	JobIDs []uint32 `json:"job_ids,omitempty"`
+
+	// Pages rendered, counting software copies; zero for RAW documents.
+	Pages int `json:"pages"`
+	// Sheets expected to come out of the printer, counting copies and duplex.
+	Sheets int `json:"sheets"`
+
+	Duration time.Duration `json:"duration"`
+	// Time to print each page, or each sheet side when N-up.
+	PageDurations []time.Duration `json:"page_durations,omitempty"`
+
+	// Ticket options that were not applied as requested.
+	Warnings []PrintWarning `json:"warnings,omitempty"`
+
+	// Identical label submissions printed by the job, this one included,
+	// when more than one; see LabelCoalescer.
+	Merged int `json:"merged,omitempty"`
+
+	// Files a soft proof of the document was written to, instead of a job.
+	ProofFiles []string `json:"proof_files,omitempty"`
+}
+
+type PrintWarningReason string
+
+const (
+	// The printer description lacks the capability.
+	PrintWarningUnsupported PrintWarningReason = "UNSUPPORTED"
+	// The renderer can't apply the option.
+	PrintWarningNotImplemented PrintWarningReason = "NOT_IMPLEMENTED"
+	// The value isn't one the printer accepts.
+	PrintWarningInvalidValue PrintWarningReason = "INVALID_VALUE"
+	// The option was applied in software instead of by the printer.
+	PrintWarningEmulated PrintWarningReason = "EMULATED"
+	// The document is sent as-is, so no option applies.
+	PrintWarningRawDocument PrintWarningReason = "RAW_DOCUMENT"
+	// An identical job was just submitted to the printer; see
+	// DuplicateDetector.
+	PrintWarningDuplicate PrintWarningReason = "DUPLICATE"
+	// Sending the control jobs of the document, such as its trailer,
+	// failed, while the document was queued.
+	PrintWarningControlJob PrintWarningReason = "CONTROL_JOB"
+)
+
+// PrintWarning is a ticket option that was dropped or applied differently.
+type PrintWarning struct {
+	// Ticket item, as named in the JSON ticket, e.g. "duplex".
+	Option  string             `json:"option"`
+	Reason  PrintWarningReason `json:"reason"`
+	Message string             `json:"message"`
+}
+
+func (w PrintWarning) String() string {
+	return fmt.Sprintf("%s: %s", w.Option, w.Message)
+}
+
+// Warn records a warning about a ticket option.
+func (r *PrintResult) Warn(option string, reason PrintWarningReason, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, PrintWarning{Option: option, Reason: reason, Message: fmt.Sprintf(format, args...)})
+}
+
+// PrintProgress is reported after each page of a document is rendered.
+type PrintProgress struct {
+	JobID uint32 `json:"job_id"`
+	// Pages rendered so far, counting software copies.
+	PagesRendered int `json:"pages_rendered"`
+	// Pages to render in total; zero when unknown upfront, as for raster
+	// streams.
+	TotalPages int `json:"total_pages,omitempty"`
+	// Size of the spooled job so far.
+	BytesSpooled int64 `json:"bytes_spooled"`
+}
+
+// ProgressFunc receives the progress of a print job, on the goroutine that
+// prints it; it should return quickly.
+type ProgressFunc func(PrintProgress)
@@ -0,0 +1,386 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// DefaultJobQueueMaxAttempts is how many times a queued job is sent to the
+// spooler before it fails, when the config doesn't say.
+const DefaultJobQueueMaxAttempts = 10
+
+// Finished jobs kept in the queue, for Jobs.
+const maxFinishedQueuedJobs = 1000
+
+type QueuedJobState string
+
+const (
+	QueuedJobQueued  QueuedJobState = "QUEUED"
+	QueuedJobPrinted QueuedJobState = "PRINTED"
+	QueuedJobFailed  QueuedJobState = "FAILED"
+)
+
+// JobRetention decides where jobs are kept once they are finished: in the
+// Windows queue, where users see them, in the job queue, or both.
+type JobRetention string
+
+const (
+	// Jobs are released once finished, and stay in the Windows queue only
+	// on printers that keep printed jobs.
+	JobRetentionDefault JobRetention = ""
+	// Jobs are deleted from the Windows queue once finished, even on
+	// printers that keep printed jobs, and only kept in the job queue.
+	JobRetentionStore JobRetention = "store"
+	// Jobs stay retained in the Windows queue until deleted there, and the
+	// job queue forgets them once printed.
+	JobRetentionSpooler JobRetention = "spooler"
+	// Jobs stay in both.
+	JobRetentionBoth JobRetention = "both"
+)
+
+// Valid reports whether r is a known retention.
+func (r JobRetention) Valid() bool {
+	switch r {
+	case JobRetentionDefault, JobRetentionStore, JobRetentionSpooler, JobRetentionBoth:
+		return true
+	}
+	return false
+}
+
+// KeepsInSpooler tells whether finished jobs are left retained in the
+// Windows queue.
+func (r JobRetention) KeepsInSpooler() bool {
+	return r == JobRetentionSpooler || r == JobRetentionBoth
+}
+
+// QueuedJob is a job in a JobQueue.
+type QueuedJob struct {
+	ID      uint64 `json:"id"`
+	Printer string `json:"printer"`
+	// Copy of the document in the queue folder, deleted once the job is
+	// finished.
+	Filename  string           `json:"filename"`
+	Title     string           `json:"title"`
+	Ticket    *model.JobTicket `json:"ticket,omitempty"`
+	Submitted time.Time        `json:"submitted"`
+
+	State    QueuedJobState `json:"state"`
+	Attempts int            `json:"attempts"`
+	// Time of the next attempt of a queued job that failed before, or of
+	// the first attempt of a job held until a time by its ticket.
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	// Error of the last attempt.
+	Error string `json:"error,omitempty"`
+	// Spooler job of a printed job.
+	NativeJobID uint32 `json:"native_job_id,omitempty"`
+	// Support bundle written when the job failed.
+	SupportBundle string `json:"support_bundle,omitempty"`
+}
+
+// PrintQueuedJobFunc sends a queued job to the spooler, and returns the ID
+// of the spooler job.
+type PrintQueuedJobFunc func(job *QueuedJob) (uint32, error)
+
+var jobsBucket = []byte("jobs")
+
+// JobQueue holds jobs on disk until the spooler accepts them, retrying
+// them with backoff when it fails for a reason that may pass, such as a
+// printer unplugged or a spooler restarting. Jobs survive restarts: a job
+// is sent at least once, and twice when the process stops after the
+// spooler accepted it but before the queue recorded it.
+type JobQueue struct {
+	db  *bolt.DB
+	dir string
+	// Attempts before a job fails.
+	MaxAttempts int
+	// Delete jobs once printed, rather than keeping them with the finished
+	// jobs, for JobRetentionSpooler. Failed jobs are kept.
+	ForgetPrinted bool
+	// RetryDelay, but for tests.
+	retryDelay func(retry int) time.Duration
+	// SupportBundle, if set, writes a support bundle about a job that
+	// failed, and returns its path, or "" when it couldn't.
+	SupportBundle func(job *QueuedJob, err error) string
+
+	wake chan struct{}
+	// Held while a job is sent, so that Close waits for it.
+	sending sync.Mutex
+}
+
+// OpenJobQueue opens the queue kept in dir, creating dir if needed. Only
+// one process can have a queue open.
+func OpenJobQueue(dir string) (*JobQueue, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "documents"), 0700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, "jobs.db"), 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("job queue %s is open in another process", dir)
+	} else if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(jobsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &JobQueue{db: db, dir: dir, MaxAttempts: DefaultJobQueueMaxAttempts, retryDelay: RetryDelay, wake: make(chan struct{}, 1)}, nil
+}
+
+// Close closes the queue, after the job being sent, if any.
+func (q *JobQueue) Close() error {
+	q.sending.Lock()
+	defer q.sending.Unlock()
+	return q.db.Close()
+}
+
+func jobKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+	return key
+}
+
+func putJob(tx *bolt.Tx, job *QueuedJob) error {
+	value, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(jobsBucket).Put(jobKey(job.ID), value)
+}
+
+// Submit copies the document of a job into the queue, and queues it. A
+// job held until a time by its ticket is sent then, so that it can be held
+// for longer than the spooler holds jobs.
+func (q *JobQueue) Submit(job *Job) (*QueuedJob, error) {
+	queued := &QueuedJob{
+		Printer:   job.NativePrinterName,
+		Title:     job.Title,
+		Ticket:    job.Ticket,
+		Submitted: time.Now(),
+		State:     QueuedJobQueued,
+	}
+	if job.Ticket != nil && job.Ticket.HoldUntil != nil {
+		queued.NextAttempt = job.Ticket.HoldUntil.Time
+	}
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		id, err := tx.Bucket(jobsBucket).NextSequence()
+		if err != nil {
+			return err
+		}
+		queued.ID = id
+		queued.Filename = filepath.Join(q.dir, "documents", strconv.FormatUint(id, 10))
+		if err = copyFile(job.Filename, queued.Filename); err != nil {
+			return err
+		}
+		return putJob(tx, queued)
+	})
+	if err != nil {
+		if queued.Filename != "" {
+			os.Remove(queued.Filename)
+		}
+		return nil, err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return queued, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Jobs returns the jobs of the queue, queued and finished, in submission
+// order.
+func (q *JobQueue) Jobs() ([]QueuedJob, error) {
+	var jobs []QueuedJob
+	err := q.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(jobsBucket).ForEach(func(k, v []byte) error {
+			var job QueuedJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+			return nil
+		})
+	})
+	return jobs, err
+}
+
+// next returns the queued job to send first, and whether it is due now.
+func (q *JobQueue) next(now time.Time) (*QueuedJob, bool, error) {
+	jobs, err := q.Jobs()
+	if err != nil {
+		return nil, false, err
+	}
+	var next *QueuedJob
+	for i := range jobs {
+		job := &jobs[i]
+		if job.State != QueuedJobQueued {
+			continue
+		}
+		if !job.NextAttempt.After(now) {
+			return job, true, nil
+		}
+		if next == nil || job.NextAttempt.Before(next.NextAttempt) {
+			next = job
+		}
+	}
+	return next, false, nil
+}
+
+// Run sends the queued jobs to the spooler with print, in submission order,
+// until ctx is done. Jobs waiting for a retry don't hold up the others.
+func (q *JobQueue) Run(ctx context.Context, print PrintQueuedJobFunc) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		job, due, err := q.next(time.Now())
+		if err != nil {
+			return err
+		}
+		if due {
+			if err = q.send(job, print); err != nil {
+				return err
+			}
+			continue
+		}
+
+		wait := time.Duration(1<<63 - 1)
+		if job != nil {
+			wait = time.Until(job.NextAttempt)
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-q.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+func (q *JobQueue) send(job *QueuedJob, print PrintQueuedJobFunc) error {
+	q.sending.Lock()
+	defer q.sending.Unlock()
+
+	job.Attempts++
+	nativeJobID, err := print(job)
+	switch {
+	case err == nil:
+		job.State, job.NativeJobID, job.Error = QueuedJobPrinted, nativeJobID, ""
+	case IsTransientPrintError(err) && job.Attempts < q.MaxAttempts:
+		job.Error = err.Error()
+		job.NextAttempt = time.Now().Add(q.retryDelay(job.Attempts))
+	default:
+		job.State, job.Error = QueuedJobFailed, err.Error()
+		if q.SupportBundle != nil {
+			job.SupportBundle = q.SupportBundle(job, err)
+		}
+	}
+	if job.State != QueuedJobQueued {
+		os.Remove(job.Filename)
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		if job.State == QueuedJobPrinted && q.ForgetPrinted {
+			return tx.Bucket(jobsBucket).Delete(jobKey(job.ID))
+		}
+		if err := putJob(tx, job); err != nil {
+			return err
+		}
+		if job.State == QueuedJobQueued {
+			return nil
+		}
+		return pruneFinishedJobs(tx)
+	})
+}
+
+// pruneFinishedJobs deletes the oldest finished jobs past
+// maxFinishedQueuedJobs.
+func pruneFinishedJobs(tx *bolt.Tx) error {
+	var finished [][]byte
+	bucket := tx.Bucket(jobsBucket)
+	err := bucket.ForEach(func(k, v []byte) error {
+		var job QueuedJob
+		if err := json.Unmarshal(v, &job); err != nil {
+			return err
+		}
+		if job.State != QueuedJobQueued {
+			finished = append(finished, append([]byte{}, k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for len(finished) > maxFinishedQueuedJobs {
+		if err = bucket.Delete(finished[0]); err != nil {
+			return err
+		}
+		finished = finished[1:]
+	}
+	return nil
+}
+
+// IsTransientPrintError tells whether printing may succeed when tried
+// again: errors of the job itself, such as invalid tickets or documents,
+// missing documents or missing rights, won't pass, and neither will
+// duplicates, which would print once their window passed, or jobs over
+// quota.
+func IsTransientPrintError(err error) bool {
+	var ticketErr *model.TicketError
+	var rangeErr *model.RangeError
+	switch {
+	case errors.As(err, &ticketErr), errors.As(err, &rangeErr):
+		return false
+	case errors.Is(err, ErrAccessDenied), errors.Is(err, ErrDriverMismatch), errors.Is(err, os.ErrNotExist):
+		return false
+	case errors.Is(err, ErrDuplicateJob), errors.Is(err, ErrQuotaExceeded), errors.Is(err, ErrInvalidDocument):
+		return false
+	}
+	return true
+}
@@ -0,0 +1,251 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestJobQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	document := filepath.Join(dir, "invoice.pdf")
+	if err = ioutil.WriteFile(document, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := OpenJobQueue(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range []string{"unplugged", "bad ticket"} {
+		if _, err = q.Submit(&Job{NativePrinterName: "office", Filename: document, Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Jobs survive the queue being reopened, as on restart.
+	if err = q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if q, err = OpenJobQueue(filepath.Join(dir, "queue")); err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if _, err = OpenJobQueue(filepath.Join(dir, "queue")); err == nil {
+		t.Error("expected error opening a queue that is already open")
+	}
+	q.retryDelay = func(int) time.Duration { return time.Millisecond }
+	// Only jobs that failed for good get a support bundle.
+	q.SupportBundle = func(job *QueuedJob, err error) string {
+		return fmt.Sprintf("bundle of %s: %s", job.Title, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	attempts := map[string]int{}
+	go func() {
+		defer close(done)
+		err := q.Run(ctx, func(job *QueuedJob) (uint32, error) {
+			attempts[job.Title]++
+			if body, err := ioutil.ReadFile(job.Filename); err != nil || string(body) != "%PDF-1.4" {
+				t.Errorf("expected the document in the queue got %q: %v", body, err)
+			}
+			if job.Title == "bad ticket" {
+				return 0, &model.TicketError{Problems: []string{"copies: too many"}}
+			}
+			if attempts[job.Title] < 3 {
+				return 0, errors.New("printer office not found")
+			}
+			return 12, nil
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var jobs []QueuedJob
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if jobs, err = q.Jobs(); err != nil {
+			t.Fatal(err)
+		}
+		if len(jobs) == 2 && jobs[0].State != QueuedJobQueued && jobs[1].State != QueuedJobQueued {
+			break
+		}
+	}
+	cancel()
+	<-done
+
+	if len(jobs) != 2 {
+		t.Fatalf("expected 2 jobs got %d", len(jobs))
+	}
+	if got := fmt.Sprintf("%s %d %d", jobs[0].State, jobs[0].Attempts, jobs[0].NativeJobID); got != "PRINTED 3 12" {
+		t.Errorf("expected the unplugged job printed on the third attempt got %s", got)
+	}
+	if jobs[1].State != QueuedJobFailed || jobs[1].Attempts != 1 {
+		t.Errorf("expected the job with a bad ticket to fail without retries got %s after %d", jobs[1].State, jobs[1].Attempts)
+	}
+	if jobs[0].SupportBundle != "" || jobs[1].SupportBundle != "bundle of bad ticket: invalid job ticket: copies: too many" {
+		t.Errorf("expected a support bundle for the failed job only got %q and %q", jobs[0].SupportBundle, jobs[1].SupportBundle)
+	}
+	for _, job := range jobs {
+		if _, err := os.Stat(job.Filename); !os.IsNotExist(err) {
+			t.Errorf("expected the document of finished job %d deleted", job.ID)
+		}
+	}
+}
+
+func TestJobQueuePermanentErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jobqueue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	q, err := OpenJobQueue(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.retryDelay = func(int) time.Duration { return time.Millisecond }
+
+	errs := map[string]error{
+		"duplicate": fmt.Errorf("%w of job 7 printed 10s ago", ErrDuplicateJob),
+		"quota":     fmt.Errorf("%w: 0 of 100 pages left today", ErrQuotaExceeded),
+		"encrypted": &PreflightError{Code: PreflightEncrypted, Message: "PDF is encrypted"},
+	}
+	for title := range errs {
+		document := filepath.Join(dir, title+".pdf")
+		if err = ioutil.WriteFile(document, []byte("%PDF-1.4"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = q.Submit(&Job{NativePrinterName: "office", Filename: document, Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		err := q.Run(ctx, func(job *QueuedJob) (uint32, error) {
+			return 0, errs[job.Title]
+		})
+		if err != nil {
+			t.Error(err)
+		}
+	}()
+
+	var jobs []QueuedJob
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if jobs, err = q.Jobs(); err != nil {
+			t.Fatal(err)
+		}
+		finished := 0
+		for _, job := range jobs {
+			if job.State != QueuedJobQueued {
+				finished++
+			}
+		}
+		if finished == len(errs) {
+			break
+		}
+	}
+	// Retries would be due by now.
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	<-done
+
+	if jobs, err = q.Jobs(); err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != len(errs) {
+		t.Fatalf("expected %d jobs got %d", len(errs), len(jobs))
+	}
+	for _, job := range jobs {
+		if job.State != QueuedJobFailed || job.Attempts != 1 {
+			t.Errorf("expected the %s job to fail without retries got %s after %d", job.Title, job.State, job.Attempts)
+		}
+	}
+}
+
+func TestJobQueueForgetPrinted(t *testing.T) {
+	dir := t.TempDir()
+	document := filepath.Join(dir, "label.zpl")
+	if err := ioutil.WriteFile(document, []byte("^XA^XZ"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	q, err := OpenJobQueue(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	q.ForgetPrinted = true
+	for _, title := range []string{"printed", "bad ticket"} {
+		job, err := q.Submit(&Job{NativePrinterName: "office", Filename: document, Title: title})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = q.send(job, func(job *QueuedJob) (uint32, error) {
+			if job.Title == "bad ticket" {
+				return 0, &model.TicketError{Problems: []string{"copies: too many"}}
+			}
+			return 3, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Printed jobs are left to the spooler; failed ones never reached it.
+	jobs, err := q.Jobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Title != "bad ticket" || jobs[0].State != QueuedJobFailed {
+		t.Errorf("expected only the failed job kept got %+v", jobs)
+	}
+}
+
+func TestJobQueueHoldUntil(t *testing.T) {
+	dir := t.TempDir()
+	document := filepath.Join(dir, "report.pdf")
+	if err := ioutil.WriteFile(document, []byte("%PDF-1.4"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	q, err := OpenJobQueue(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	night := time.Now().Add(48 * time.Hour)
+	ticket := &model.JobTicket{HoldUntil: &model.HoldUntilTicketItem{Time: night}}
+	if _, err = q.Submit(&Job{NativePrinterName: "office", Filename: document, Title: "night shift", Ticket: ticket}); err != nil {
+		t.Fatal(err)
+	}
+	job, due, err := q.next(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job == nil || due || !job.NextAttempt.Equal(night) {
+		t.Errorf("expected the job held until %s got %+v due %t", night, job, due)
+	}
+	if _, due, _ = q.next(night); !due {
+		t.Error("expected the job due once the hold is over")
+	}
+}
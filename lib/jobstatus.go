@@ -0,0 +1,141 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Spooler job status flags, as defined in winspool.h.
+const (
+	JobStatusPaused           uint32 = 0x00000001
+	JobStatusError            uint32 = 0x00000002
+	JobStatusDeleting         uint32 = 0x00000004
+	JobStatusSpooling         uint32 = 0x00000008
+	JobStatusPrinting         uint32 = 0x00000010
+	JobStatusOffline          uint32 = 0x00000020
+	JobStatusPaperOut         uint32 = 0x00000040
+	JobStatusPrinted          uint32 = 0x00000080
+	JobStatusDeleted          uint32 = 0x00000100
+	JobStatusBlockedDevQ      uint32 = 0x00000200
+	JobStatusUserIntervention uint32 = 0x00000400
+	JobStatusRestart          uint32 = 0x00000800
+	JobStatusComplete         uint32 = 0x00001000
+	JobStatusRetained         uint32 = 0x00002000
+	JobStatusRenderingLocally uint32 = 0x00004000
+)
+
+// jobStatusNames names the job status flags, in the order of their bits,
+// after the JOB_STATUS constants of winspool.h.
+var jobStatusNames = []struct {
+	flag uint32
+	name string
+}{
+	{JobStatusPaused, "paused"},
+	{JobStatusError, "error"},
+	{JobStatusDeleting, "deleting"},
+	{JobStatusSpooling, "spooling"},
+	{JobStatusPrinting, "printing"},
+	{JobStatusOffline, "offline"},
+	{JobStatusPaperOut, "paperout"},
+	{JobStatusPrinted, "printed"},
+	{JobStatusDeleted, "deleted"},
+	{JobStatusBlockedDevQ, "blocked_devq"},
+	{JobStatusUserIntervention, "user_intervention"},
+	{JobStatusRestart, "restart"},
+	{JobStatusComplete, "complete"},
+	{JobStatusRetained, "retained"},
+	{JobStatusRenderingLocally, "rendering_locally"},
+}
+
+// JobStatusNames decodes job status flags into their names, such as
+// printing or paperout; bits without a name are kept as a hex number.
+func JobStatusNames(status uint32) []string {
+	var names []string
+	for _, n := range jobStatusNames {
+		if status&n.flag != 0 {
+			names = append(names, n.name)
+			status &^= n.flag
+		}
+	}
+	if status != 0 {
+		names = append(names, fmt.Sprintf("%#x", status))
+	}
+	return names
+}
+
+// JobStatusString is JobStatusNames joined with commas, such as
+// "printing,paperout", for tables; "queued" without flags.
+func JobStatusString(status uint32) string {
+	if status == 0 {
+		return "queued"
+	}
+	return strings.Join(JobStatusNames(status), ",")
+}
+
+// Spooler job priorities, as defined in winspool.h. Jobs of a higher
+// priority print first.
+const (
+	JobPriorityMin     uint32 = 1
+	JobPriorityMax     uint32 = 99
+	JobPriorityDefault uint32 = 1
+)
+
+// ConvertJobStatus maps spooler job status flags to a job state.
+func ConvertJobStatus(status uint32) *model.JobState {
+	var state model.JobState
+
+	if status&(JobStatusSpooling|JobStatusPrinting) != 0 {
+		state.Type = model.JobStateInProgress
+
+	} else if status&(JobStatusPrinted|JobStatusComplete) != 0 {
+		state.Type = model.JobStateDone
+
+	} else if status&JobStatusPaused != 0 {
+		// Paused by a hold, or by hand, until released.
+		state.Type = model.JobStateHeld
+
+	} else if status == 0 {
+		state.Type = model.JobStateDone
+
+	} else if status&JobStatusError != 0 {
+		state.Type = model.JobStateAborted
+		state.DeviceActionCause = &model.DeviceActionCause{ErrorCode: model.DeviceActionCausePrintFailure}
+
+	} else if status&(JobStatusDeleting|JobStatusDeleted) != 0 {
+		state.Type = model.JobStateAborted
+		state.UserActionCause = &model.UserActionCause{ActionCode: model.UserActionCauseCanceled}
+
+	} else if status&(JobStatusOffline|JobStatusPaperOut|JobStatusBlockedDevQ|JobStatusUserIntervention) != 0 {
+		state.Type = model.JobStateStopped
+		if status&JobStatusPaperOut != 0 {
+			state.DeviceStateCause = &model.DeviceStateCause{ErrorCode: model.DeviceStateCauseInputTray}
+		} else {
+			state.DeviceStateCause = &model.DeviceStateCause{ErrorCode: model.DeviceStateCauseOther}
+		}
+
+	} else {
+		// Don't know what is going on. Get the job out of our queue.
+		state.Type = model.JobStateAborted
+		state.DeviceActionCause = &model.DeviceActionCause{ErrorCode: model.DeviceActionCauseOther}
+	}
+
+	return &state
+}
+
+// IsJobPaperOut tells whether a job is stopped for its printer being out of
+// paper. Jobs the printer is still printing are in progress instead; see
+// IsPaperOut for those.
+func IsJobPaperOut(state *model.PrintJobStateDiff) bool {
+	return state != nil && state.State != nil && state.State.Type == model.JobStateStopped &&
+		state.State.DeviceStateCause != nil && state.State.DeviceStateCause.ErrorCode == model.DeviceStateCauseInputTray
+}
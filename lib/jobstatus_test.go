@@ -0,0 +1,48 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestJobStatusNames(t *testing.T) {
+	for status, expected := range map[uint32][]string{
+		0:                                   nil,
+		JobStatusPrinting:                   {"printing"},
+		JobStatusPaused | JobStatusPaperOut: {"paused", "paperout"},
+		JobStatusRetained | 0x00100000:      {"retained", "0x100000"},
+	} {
+		if names := JobStatusNames(status); !reflect.DeepEqual(names, expected) {
+			t.Errorf("expected %v for %#x, got %v", expected, status, names)
+		}
+	}
+	if s := JobStatusString(JobStatusPrinting | JobStatusUserIntervention); s != "printing,user_intervention" {
+		t.Errorf("unexpected status %q", s)
+	}
+	if s := JobStatusString(0); s != "queued" {
+		t.Errorf("expected a job without flags to be queued, got %q", s)
+	}
+}
+
+func TestConvertJobStatusHeld(t *testing.T) {
+	for status, expected := range map[uint32]model.JobStateType{
+		JobStatusPaused:                      model.JobStateHeld,
+		JobStatusPaused | JobStatusRetained:  model.JobStateHeld,
+		JobStatusPaused | JobStatusPrinting:  model.JobStateInProgress,
+		JobStatusPrinted | JobStatusRetained: model.JobStateDone,
+	} {
+		if state := ConvertJobStatus(status); state.Type != expected {
+			t.Errorf("expected %s for %#x, got %s", expected, status, state.Type)
+		}
+	}
+}
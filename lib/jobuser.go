@@ -0,0 +1,112 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// JobUserID is the vendor ticket item of the user a job is submitted for,
+// when the process printing it submits it for someone else, such as
+// winspool serve for the requesting-user-name of an IPP job. Quotas, held
+// jobs and accounting count the job against this user rather than the
+// user of the process, which the spooler knows the job by.
+const JobUserID = "user"
+
+// TicketUser returns the JobUserID vendor ticket item of a ticket, empty
+// when it has none.
+func TicketUser(ticket *model.JobTicket) string {
+	if ticket == nil {
+		return ""
+	}
+	for _, item := range ticket.VendorTicketItem {
+		if item.ID == JobUserID {
+			return item.Value
+		}
+	}
+	return ""
+}
+
+// WithTicketUser returns a copy of ticket with user as its only JobUserID
+// vendor ticket item; ticket itself when user is empty.
+func WithTicketUser(ticket *model.JobTicket, user string) *model.JobTicket {
+	if user == "" {
+		return ticket
+	}
+	withUser := *ticket
+	withUser.VendorTicketItem = nil
+	for _, item := range ticket.VendorTicketItem {
+		if item.ID != JobUserID {
+			withUser.VendorTicketItem = append(withUser.VendorTicketItem, item)
+		}
+	}
+	withUser.VendorTicketItem = append(withUser.VendorTicketItem, model.VendorTicketItem{ID: JobUserID, Value: user})
+	return &withUser
+}
+
+// jobUsersTTL is how long JobUsers remembers a job, well past the time it
+// takes to print.
+const jobUsersTTL = 24 * time.Hour
+
+type jobUserKey struct {
+	printer string
+	jobID   uint32
+}
+
+type jobUser struct {
+	user string
+	set  time.Time
+}
+
+// JobUsers remembers the users spooled jobs were submitted for, by
+// TicketUser, for a day. The zero value is ready to use.
+type JobUsers struct {
+	mutex sync.Mutex
+	users map[jobUserKey]jobUser
+	now   func() time.Time
+}
+
+func (u *JobUsers) time() time.Time {
+	if u.now != nil {
+		return u.now()
+	}
+	return time.Now()
+}
+
+// Set notes the user a job was submitted for.
+func (u *JobUsers) Set(printer string, jobID uint32, user string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	now := u.time()
+	if u.users == nil {
+		u.users = make(map[jobUserKey]jobUser)
+	}
+	for key, job := range u.users {
+		if now.Sub(job.set) > jobUsersTTL {
+			delete(u.users, key)
+		}
+	}
+	u.users[jobUserKey{printer, jobID}] = jobUser{user: user, set: now}
+}
+
+// Get returns the user a job was submitted for, when noted.
+func (u *JobUsers) Get(printer string, jobID uint32) (string, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	job, ok := u.users[jobUserKey{printer, jobID}]
+	if !ok || u.time().Sub(job.set) > jobUsersTTL {
+		return "", false
+	}
+	return job.user, true
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestTicketUser(t *testing.T) {
+	ticket := &model.JobTicket{VendorTicketItem: []model.VendorTicketItem{{ID: LabelDarknessID, Value: "15"}, {ID: JobUserID, Value: "alice"}}}
+	if user := TicketUser(ticket); user != "alice" {
+		t.Errorf("expected alice got %q", user)
+	}
+	bob := WithTicketUser(ticket, "bob")
+	if user := TicketUser(bob); user != "bob" || len(bob.VendorTicketItem) != 2 {
+		t.Errorf("expected bob as the only user got %+v", bob.VendorTicketItem)
+	}
+	if TicketUser(ticket) != "alice" || WithTicketUser(ticket, "") != ticket {
+		t.Error("ticket changed")
+	}
+	if user := TicketUser(&model.JobTicket{}); user != "" {
+		t.Errorf("expected no user got %q", user)
+	}
+}
+
+func TestJobUsersQuotas(t *testing.T) {
+	now := time.Date(2020, 1, 2, 15, 0, 0, 0, time.Local)
+	var users JobUsers
+	users.now = func() time.Time { return now }
+
+	// A service prints for two users; the spooler knows both jobs by the
+	// service account.
+	users.Set("office", 1, "alice")
+	users.Set("office", 2, "bob")
+	db, err := OpenAccountingDB(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for jobID, pages := range map[uint32]int{1: 9, 2: 3} {
+		info := JobInfo{Printer: "office", JobID: jobID, User: "winspool", PagesPrinted: pages}
+		if user, ok := users.Get("office", jobID); ok {
+			info.User = user
+		}
+		if err := db.Record(AccountingRecord{Time: now.Add(-time.Hour), JobInfo: info, State: model.JobStateDone}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := NewQuotas(QuotaConfig{UserPagesPerDay: 10}, db)
+	q.now = users.now
+	if err := q.Check("alice", "office", 2); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected alice's quota to be exceeded, got %v", err)
+	}
+	if err := q.Check("bob", "office", 2); err != nil {
+		t.Errorf("expected bob within quota, got %v", err)
+	}
+
+	now = now.Add(jobUsersTTL + time.Minute)
+	if _, ok := users.Get("office", 1); ok {
+		t.Error("expected a job forgotten after a day")
+	}
+}
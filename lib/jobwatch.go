@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// IsJobFinished tells whether a job state is terminal: done or aborted.
+func IsJobFinished(state *model.PrintJobStateDiff) bool {
+	return state != nil && state.State != nil &&
+		(state.State.Type == model.JobStateDone || state.State.Type == model.JobStateAborted)
+}
+
+// WatchJob follows the state of a job until it is finished, and calls report
+// with every transition: a change of state type, or more pages printed.
+// getState reads the state of the job. It is read on events of the job, as
+// delivered by Subscribe, and every interval in case events are missed or
+// events is nil. Returns the final state, or the last one and the error of
+// ctx when it ends first.
+func WatchJob(ctx context.Context, jobID uint32, getState func() (*model.PrintJobStateDiff, error), events <-chan Event, interval time.Duration, report func(*model.PrintJobStateDiff)) (*model.PrintJobStateDiff, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *model.PrintJobStateDiff
+	for {
+		state, err := getState()
+		if err != nil {
+			return last, err
+		}
+		if isJobTransition(last, state) {
+			report(state)
+		}
+		last = state
+		if IsJobFinished(state) {
+			return state, nil
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return last, ctx.Err()
+			case <-ticker.C:
+				break wait
+			case event, ok := <-events:
+				if !ok {
+					// Polling only from now on.
+					events = nil
+					continue
+				}
+				if event.JobID == jobID {
+					break wait
+				}
+			}
+		}
+	}
+}
+
+func isJobTransition(last, state *model.PrintJobStateDiff) bool {
+	if last == nil {
+		return true
+	}
+	if (last.State == nil) != (state.State == nil) ||
+		last.State != nil && last.State.Type != state.State.Type {
+		return true
+	}
+	return state.PagesPrinted != nil && (last.PagesPrinted == nil || *state.PagesPrinted > *last.PagesPrinted)
+}
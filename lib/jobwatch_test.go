@@ -0,0 +1,73 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func jobState(stateType model.JobStateType, pagesPrinted int32) *model.PrintJobStateDiff {
+	return &model.PrintJobStateDiff{State: &model.JobState{Type: stateType}, PagesPrinted: &pagesPrinted}
+}
+
+func TestWatchJob(t *testing.T) {
+	states := []*model.PrintJobStateDiff{
+		jobState(model.JobStateQueued, 0),
+		jobState(model.JobStateQueued, 0),
+		jobState(model.JobStateInProgress, 0),
+		jobState(model.JobStateInProgress, 1),
+		jobState(model.JobStateInProgress, 1),
+		jobState(model.JobStateDone, 2),
+	}
+	getState := func() (*model.PrintJobStateDiff, error) {
+		state := states[0]
+		states = states[1:]
+		return state, nil
+	}
+	events := make(chan Event, 10)
+	events <- Event{JobID: 8}
+	for i := 0; i < 5; i++ {
+		events <- Event{JobID: 7}
+	}
+
+	var reported []*model.PrintJobStateDiff
+	final, err := WatchJob(context.Background(), 7, getState, events, time.Hour, func(state *model.PrintJobStateDiff) {
+		reported = append(reported, state)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if final.State.Type != model.JobStateDone {
+		t.Errorf("expected done got %s", final.State.Type)
+	}
+	if len(reported) != 4 {
+		t.Errorf("expected 4 transitions got %d", len(reported))
+	}
+}
+
+func TestWatchJobTimeout(t *testing.T) {
+	getState := func() (*model.PrintJobStateDiff, error) {
+		return jobState(model.JobStateStopped, 0), nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	// Polled without events.
+	final, err := WatchJob(ctx, 7, getState, nil, time.Millisecond, func(*model.PrintJobStateDiff) {})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded got %v", err)
+	}
+	if final == nil || final.State.Type != model.JobStateStopped {
+		t.Errorf("expected the last state got %+v", final)
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// LabelLanguage is the command language of a thermal label printer.
+type LabelLanguage string
+
+const (
+	LabelLanguageZPL  LabelLanguage = "zpl"  // Zebra, ZDesigner drivers.
+	LabelLanguageTSPL LabelLanguage = "tspl" // TSC.
+)
+
+// Vendor capability and ticket item IDs of label settings.
+const (
+	LabelDarknessID   = "darkness"
+	LabelPrintSpeedID = "print_speed"
+)
+
+type labelSettingRange struct {
+	darknessMin, darknessMax int
+	speedMin, speedMax       int
+}
+
+var labelSettingRanges = map[LabelLanguage]labelSettingRange{
+	LabelLanguageZPL:  {0, 30, 2, 14}, // ~SD darkness, ^PR inches per second.
+	LabelLanguageTSPL: {0, 15, 1, 12}, // DENSITY, SPEED inches per second.
+}
+
+// Valid reports whether l is a supported label language.
+func (l LabelLanguage) Valid() bool {
+	_, ok := labelSettingRanges[l]
+	return ok
+}
+
+// VendorCapabilities describes the darkness and print speed ranges accepted
+// by SettingsCommands.
+func (l LabelLanguage) VendorCapabilities() []model.VendorCapability {
+	r, ok := labelSettingRanges[l]
+	if !ok {
+		return nil
+	}
+	return []model.VendorCapability{
+		{
+			ID:                   LabelDarknessID,
+			Type:                 model.VendorCapabilityRange,
+			DisplayNameLocalized: model.NewLocalizedString("Darkness"),
+			RangeCap: &model.RangeCapability{
+				ValueType: model.RangeCapabilityValueInteger,
+				Min:       strconv.Itoa(r.darknessMin),
+				Max:       strconv.Itoa(r.darknessMax),
+			},
+		},
+		{
+			ID:                   LabelPrintSpeedID,
+			Type:                 model.VendorCapabilityRange,
+			DisplayNameLocalized: model.NewLocalizedString("Print speed (inches per second)"),
+			RangeCap: &model.RangeCapability{
+				ValueType: model.RangeCapabilityValueInteger,
+				Min:       strconv.Itoa(r.speedMin),
+				Max:       strconv.Itoa(r.speedMax),
+			},
+		},
+	}
+}
+
+// SettingsCommands converts the darkness and print speed vendor ticket items
+// into commands to send ahead of the job. Returns nil when the ticket sets
+// neither. Settings not in the ticket keep the printer's current value.
+func (l LabelLanguage) SettingsCommands(ticket *model.JobTicket) ([]byte, error) {
+	r, ok := labelSettingRanges[l]
+	if !ok {
+		return nil, fmt.Errorf("unknown label language %q", l)
+	}
+
+	darkness, speed := -1, -1
+	for _, item := range ticket.VendorTicketItem {
+		var err error
+		switch item.ID {
+		case LabelDarknessID:
+			darkness, err = parseLabelSetting(item, r.darknessMin, r.darknessMax)
+		case LabelPrintSpeedID:
+			speed, err = parseLabelSetting(item, r.speedMin, r.speedMax)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if darkness < 0 && speed < 0 {
+		return nil, nil
+	}
+
+	var commands string
+	switch l {
+	case LabelLanguageZPL:
+		commands = "^XA"
+		if speed >= 0 {
+			commands += fmt.Sprintf("^PR%d", speed)
+		}
+		if darkness >= 0 {
+			commands += fmt.Sprintf("~SD%02d", darkness)
+		}
+		commands += "^XZ\r\n"
+	case LabelLanguageTSPL:
+		if speed >= 0 {
+			commands += fmt.Sprintf("SPEED %d\r\n", speed)
+		}
+		if darkness >= 0 {
+			commands += fmt.Sprintf("DENSITY %d\r\n", darkness)
+		}
+	}
+	return []byte(commands), nil
+}
+
+func parseLabelSetting(item model.VendorTicketItem, min, max int) (int, error) {
+	value, err := strconv.Atoi(item.Value)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("invalid %s %q, expected an integer from %d to %d", item.ID, item.Value, min, max)
+	}
+	return value, nil
+}
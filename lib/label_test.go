@@ -0,0 +1,50 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestLabelSettingsCommands(t *testing.T) {
+	ticket := &model.JobTicket{
+		VendorTicketItem: []model.VendorTicketItem{
+			{ID: LabelDarknessID, Value: "8"},
+			{ID: LabelPrintSpeedID, Value: "4"},
+		},
+	}
+
+	got, err := LabelLanguageZPL.SettingsCommands(ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "^XA^PR4~SD08^XZ\r\n"; string(got) != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+	got, err = LabelLanguageTSPL.SettingsCommands(ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "SPEED 4\r\nDENSITY 8\r\n"; string(got) != expected {
+		t.Errorf("expected %q got %q", expected, got)
+	}
+
+	got, err = LabelLanguageZPL.SettingsCommands(&model.JobTicket{})
+	if err != nil || got != nil {
+		t.Errorf("expected no commands got %q, %v", got, err)
+	}
+
+	ticket.VendorTicketItem[0].Value = "20"
+	if _, err = LabelLanguageTSPL.SettingsCommands(ticket); err == nil {
+		t.Error("expected error for darkness out of range")
+	}
+}
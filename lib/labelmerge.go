@@ -0,0 +1,135 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Largest ^PQ quantity.
+const maxZPLQuantity = 99999999
+
+// Matches the quantity of a ^PQ command, which may be left out.
+var rZPLQuantity = regexp.MustCompile(`\^PQ(\d*)`)
+
+// MergeZPLQuantity returns a ZPL label format that prints count times what
+// data prints, by multiplying its ^PQ quantity, or adding one. Only data
+// holding a single format (^XA to ^XZ) can be merged; false is returned
+// otherwise, and when the prefix characters are changed (^CC, ~CC).
+func MergeZPLQuantity(data []byte, count int) ([]byte, bool) {
+	if count < 1 || bytes.Count(data, []byte("^XA")) != 1 || bytes.Count(data, []byte("^XZ")) != 1 ||
+		bytes.Contains(data, []byte("^CC")) || bytes.Contains(data, []byte("~CC")) {
+		return nil, false
+	}
+	end := bytes.Index(data, []byte("^XZ"))
+	if end < bytes.Index(data, []byte("^XA")) {
+		return nil, false
+	}
+
+	quantities := rZPLQuantity.FindAllSubmatchIndex(data, -1)
+	switch len(quantities) {
+	case 0:
+		if count == 1 {
+			return data, true
+		}
+		merged := append([]byte{}, data[:end]...)
+		merged = append(merged, "^PQ"+strconv.Itoa(count)...)
+		return append(merged, data[end:]...), true
+	case 1:
+		quantity := 1
+		if q := data[quantities[0][2]:quantities[0][3]]; len(q) > 0 {
+			quantity, _ = strconv.Atoi(string(q))
+		}
+		if quantity < 1 || quantity*count > maxZPLQuantity {
+			return nil, false
+		}
+		merged := append([]byte{}, data[:quantities[0][2]]...)
+		merged = append(merged, strconv.Itoa(quantity*count)...)
+		return append(merged, data[quantities[0][3]:]...), true
+	}
+	return nil, false
+}
+
+// LabelCoalescer merges identical ZPL labels submitted to a printer within
+// Window of the first one into a single job, whose ^PQ quantity counts them
+// all. Retry storms of label software then print each label as many times,
+// in one job. Submissions wait for the window to close, and all get the
+// result of the merged job.
+type LabelCoalescer struct {
+	Window time.Duration
+
+	mutex   sync.Mutex
+	pending map[[sha256.Size]byte]*pendingLabel
+}
+
+type pendingLabel struct {
+	count  int
+	done   chan struct{}
+	result *PrintResult
+	err    error
+}
+
+// Print prints data with print, merged with the identical labels submitted
+// within the window. Data that MergeZPLQuantity can't merge is printed
+// right away.
+func (c *LabelCoalescer) Print(data []byte, print func(data []byte) (*PrintResult, error)) (*PrintResult, error) {
+	if _, ok := MergeZPLQuantity(data, 1); !ok {
+		return print(data)
+	}
+	key := sha256.Sum256(data)
+
+	c.mutex.Lock()
+	if c.pending == nil {
+		c.pending = make(map[[sha256.Size]byte]*pendingLabel)
+	}
+	if label, ok := c.pending[key]; ok {
+		label.count++
+		c.mutex.Unlock()
+		<-label.done
+		return label.sharedResult()
+	}
+	label := &pendingLabel{count: 1, done: make(chan struct{})}
+	c.pending[key] = label
+	c.mutex.Unlock()
+
+	time.Sleep(c.Window)
+
+	c.mutex.Lock()
+	delete(c.pending, key)
+	count := label.count
+	c.mutex.Unlock()
+
+	if merged, ok := MergeZPLQuantity(data, count); ok {
+		label.result, label.err = print(merged)
+		if label.result != nil && count > 1 {
+			label.result.Merged = count
+		}
+	} else {
+		// The quantity would overflow ^PQ; one job per submission.
+		for i := 0; i < count && label.err == nil; i++ {
+			label.result, label.err = print(data)
+		}
+	}
+	close(label.done)
+	return label.sharedResult()
+}
+
+// sharedResult returns a copy of the result, for each submission.
+func (label *pendingLabel) sharedResult() (*PrintResult, error) {
+	if label.result == nil {
+		return nil, label.err
+	}
+	result := *label.result
+	return &result, label.err
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMergeZPLQuantity(t *testing.T) {
+	for _, c := range []struct {
+		data, merged string
+	}{
+		{"^XA^FO50,50^FDSKU-1^FS^XZ", "^XA^FO50,50^FDSKU-1^FS^PQ3^XZ"},
+		{"^XA^FDSKU-1^FS^PQ2,0,1,Y^XZ\r\n", "^XA^FDSKU-1^FS^PQ6,0,1,Y^XZ\r\n"},
+		{"^XA^FDSKU-1^FS^PQ^XZ", "^XA^FDSKU-1^FS^PQ3^XZ"},
+	} {
+		merged, ok := MergeZPLQuantity([]byte(c.data), 3)
+		if !ok || string(merged) != c.merged {
+			t.Errorf("%q: expected %q got %q", c.data, c.merged, merged)
+		}
+	}
+	for _, data := range []string{
+		"^XA^FDone^FS^XZ^XA^FDtwo^FS^XZ",
+		"^XA^CC~~XA~FDx~FS~XZ",
+		"SIZE 50 mm,30 mm\r\nPRINT 1\r\n",
+		"^XA^PQ99999999^XZ",
+	} {
+		if _, ok := MergeZPLQuantity([]byte(data), 3); ok {
+			t.Errorf("%q: expected not to be merged", data)
+		}
+	}
+}
+
+func TestLabelCoalescer(t *testing.T) {
+	c := LabelCoalescer{Window: 50 * time.Millisecond}
+	var mutex sync.Mutex
+	var printed []string
+	print := func(data []byte) (*PrintResult, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		printed = append(printed, string(data))
+		return &PrintResult{JobID: uint32(len(printed))}, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]*PrintResult, 4)
+	for i, data := range []string{"^XA^FDa^FS^XZ", "^XA^FDa^FS^XZ", "^XA^FDa^FS^XZ", "^XA^FDb^FS^XZ"} {
+		wg.Add(1)
+		go func(i int, data string) {
+			defer wg.Done()
+			results[i], _ = c.Print([]byte(data), print)
+		}(i, data)
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+
+	if len(printed) != 2 || printed[0] != "^XA^FDa^FS^PQ3^XZ" || printed[1] != "^XA^FDb^FS^XZ" {
+		t.Fatalf("expected the identical labels merged into one job got %q", printed)
+	}
+	for i := 0; i < 3; i++ {
+		if results[i].JobID != 1 || results[i].Merged != 3 {
+			t.Errorf("submission %d: expected job 1 merging 3 got %+v", i, results[i])
+		}
+	}
+	if results[3].JobID != 2 || results[3].Merged != 0 {
+		t.Errorf("expected another label in its own job got %+v", results[3])
+	}
+
+	// After the window, the label is printed again.
+	if result, _ := c.Print([]byte("^XA^FDa^FS^XZ"), print); result.JobID != 3 || printed[2] != "^XA^FDa^FS^XZ" {
+		t.Errorf("expected a new job after the window got %+v", result)
+	}
+}
@@ -0,0 +1,423 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentTypeLayout is a document in the layout language of ParseLayout,
+// such as one produced by a DocumentTemplate. It is rendered to PDF.
+const ContentTypeLayout = "application/vnd.winspool-layout"
+
+var layoutMagic = []byte(".layout")
+
+const (
+	pointsPerMM = 72 / 25.4
+
+	defaultLayoutFontSize = 10
+	defaultLayoutMargin   = 10
+	// Line height, relative to the font size.
+	layoutLineSpacing = 1.25
+	// Height taken by a rule, in points.
+	layoutRuleHeight = 6
+)
+
+// isLayout looks for the .layout first line.
+func isLayout(data []byte) bool {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if !bytes.HasPrefix(data, layoutMagic) {
+		return false
+	}
+	rest := data[len(layoutMagic):]
+	return len(rest) == 0 || rest[0] == ' ' || rest[0] == '\r' || rest[0] == '\n'
+}
+
+type LayoutAlign int
+
+const (
+	LayoutAlignLeft LayoutAlign = iota
+	LayoutAlignCenter
+	LayoutAlignRight
+)
+
+type LayoutBlockKind int
+
+const (
+	LayoutBlockText LayoutBlockKind = iota
+	LayoutBlockRule
+	LayoutBlockSpace
+	LayoutBlockPage
+)
+
+// LayoutColumn is a column of the text blocks following a .columns line.
+type LayoutColumn struct {
+	// Fraction of the text width.
+	Width float64
+	Align LayoutAlign
+}
+
+// LayoutBlock is a line of a layout document.
+type LayoutBlock struct {
+	Kind LayoutBlockKind
+	// Font size in points, and weight, of a text block.
+	Size float64
+	Bold bool
+	// Alignment of a text block without columns.
+	Align LayoutAlign
+	// Text of a text block; one cell per column when Columns isn't empty.
+	Cells   []string
+	Columns []LayoutColumn
+	// Height of a space block, in millimeters.
+	Space float64
+}
+
+// Layout is a document parsed by ParseLayout.
+type Layout struct {
+	// Page size in millimeters; zero when left to the job.
+	Width, Height float64
+	// Margin on all sides of the page in millimeters.
+	Margin float64
+	Blocks []LayoutBlock
+}
+
+// ParseLayout parses a document in a line-based layout language, simple
+// enough to be written by a template, such as a delivery note or a ticket.
+// The first line is
+//
+//	.layout [WIDTHxHEIGHT [MARGIN]]
+//
+// with the page size and margin in millimeters, such as 80x150 3 for a
+// receipt; the page size of the job and 10 mm margins when left out. Other
+// lines starting with a dot are directives:
+//
+//	.font SIZE              font size in points, 10 at first
+//	.bold, .regular         font weight
+//	.left, .center, .right  alignment of the following lines
+//	.columns W[l|c|r]...    following lines are rows, with cells
+//	                        separated by tabs, in columns of W percent of
+//	                        the text width, aligned left, center or right
+//	.columns                ends rows
+//	.rule                   horizontal line
+//	.space MM               vertical space
+//	.page                   page break
+//
+// Other lines are text, wrapped at words when too long; an empty line is an
+// empty line of text. A cell starting with ".." starts with a dot.
+func ParseLayout(data []byte) (*Layout, error) {
+	text, ok := DecodeText(data)
+	if !ok {
+		return nil, fmt.Errorf("layout is not valid UTF-8")
+	}
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	text = strings.TrimSuffix(text, "\n")
+	lines := strings.Split(text, "\n")
+	if !isLayout([]byte(lines[0])) {
+		return nil, fmt.Errorf("layout must start with a .layout line")
+	}
+
+	layout := Layout{Margin: defaultLayoutMargin}
+	if err := layout.parseHeader(strings.Fields(lines[0])[1:]); err != nil {
+		return nil, err
+	}
+
+	style := LayoutBlock{Kind: LayoutBlockText, Size: defaultLayoutFontSize}
+	for i, line := range lines[1:] {
+		lineNumber := i + 2
+		if !strings.HasPrefix(line, ".") || strings.HasPrefix(line, "..") {
+			block := style
+			if len(block.Columns) > 0 {
+				block.Cells = strings.Split(line, "\t")
+			} else {
+				block.Cells = []string{line}
+			}
+			for j, cell := range block.Cells {
+				if strings.HasPrefix(cell, "..") {
+					block.Cells[j] = cell[1:]
+				}
+			}
+			layout.Blocks = append(layout.Blocks, block)
+			continue
+		}
+
+		fields := strings.Fields(line[1:])
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("line %d: missing directive", lineNumber)
+		}
+		directive, args := fields[0], fields[1:]
+		expectArgs := func(n int) error {
+			if len(args) != n {
+				return fmt.Errorf("line %d: .%s expects %d arguments, got %d", lineNumber, directive, n, len(args))
+			}
+			return nil
+		}
+		var err error
+		switch directive {
+		case "font":
+			if err = expectArgs(1); err == nil {
+				style.Size, err = parseLayoutNumber(args[0])
+			}
+		case "bold", "regular":
+			err = expectArgs(0)
+			style.Bold = directive == "bold"
+		case "left", "center", "right":
+			err = expectArgs(0)
+			style.Align = map[string]LayoutAlign{"left": LayoutAlignLeft, "center": LayoutAlignCenter, "right": LayoutAlignRight}[directive]
+		case "columns":
+			style.Columns, err = parseLayoutColumns(args)
+		case "rule", "page":
+			if err = expectArgs(0); err == nil {
+				kind := LayoutBlockRule
+				if directive == "page" {
+					kind = LayoutBlockPage
+				}
+				layout.Blocks = append(layout.Blocks, LayoutBlock{Kind: kind})
+			}
+		case "space":
+			var space float64
+			if err = expectArgs(1); err == nil {
+				if space, err = parseLayoutNumber(args[0]); err == nil {
+					layout.Blocks = append(layout.Blocks, LayoutBlock{Kind: LayoutBlockSpace, Space: space})
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown directive .%s", directive)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", lineNumber, err)
+		}
+	}
+	return &layout, nil
+}
+
+func (l *Layout) parseHeader(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	if len(args) > 2 {
+		return fmt.Errorf("line 1: .layout expects a page size and a margin, got %q", strings.Join(args, " "))
+	}
+	size := strings.SplitN(args[0], "x", 2)
+	if len(size) != 2 {
+		return fmt.Errorf("line 1: invalid page size %q, expected WIDTHxHEIGHT", args[0])
+	}
+	var err error
+	if l.Width, err = parseLayoutNumber(size[0]); err != nil {
+		return fmt.Errorf("line 1: %s", err)
+	}
+	if l.Height, err = parseLayoutNumber(size[1]); err != nil {
+		return fmt.Errorf("line 1: %s", err)
+	}
+	if len(args) == 2 {
+		if l.Margin, err = strconv.ParseFloat(args[1], 64); err != nil || l.Margin < 0 {
+			return fmt.Errorf("line 1: invalid margin %q", args[1])
+		}
+		if 2*l.Margin >= l.Width || 2*l.Margin >= l.Height {
+			return fmt.Errorf("line 1: margin %s leaves no room on the page", args[1])
+		}
+	}
+	return nil
+}
+
+// parseLayoutNumber parses a positive size.
+func parseLayoutNumber(s string) (float64, error) {
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
+
+func parseLayoutColumns(args []string) ([]LayoutColumn, error) {
+	var columns []LayoutColumn
+	var total float64
+	for _, arg := range args {
+		column := LayoutColumn{Align: LayoutAlignLeft}
+		switch arg[len(arg)-1] {
+		case 'l':
+			arg = arg[:len(arg)-1]
+		case 'c':
+			column.Align, arg = LayoutAlignCenter, arg[:len(arg)-1]
+		case 'r':
+			column.Align, arg = LayoutAlignRight, arg[:len(arg)-1]
+		}
+		width, err := parseLayoutNumber(arg)
+		if err != nil {
+			return nil, err
+		}
+		column.Width = width / 100
+		total += width
+		columns = append(columns, column)
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("columns are %g%% of the text width, more than 100%%", total)
+	}
+	return columns, nil
+}
+
+// TextMeasurer returns the width of text in points, with the font of a
+// layout in size points.
+type TextMeasurer func(text string, size float64, bold bool) float64
+
+// PlacedText is a line of text on a page, at its left end on the baseline,
+// in points from the top left corner of the page.
+type PlacedText struct {
+	X, Y float64
+	Size float64
+	Bold bool
+	Text string
+}
+
+// PlacedRule is a horizontal line on a page, in points.
+type PlacedRule struct {
+	X1, X2, Y float64
+}
+
+type LayoutPage struct {
+	Texts []PlacedText
+	Rules []PlacedRule
+}
+
+func (p *LayoutPage) empty() bool {
+	return len(p.Texts) == 0 && len(p.Rules) == 0
+}
+
+// PageSize returns the page size of the document in points: its own when it
+// has one, the media size of the job otherwise.
+func (l *Layout) PageSize(widthMicrons, heightMicrons int32) (width, height float64) {
+	if l.Width > 0 {
+		return l.Width * pointsPerMM, l.Height * pointsPerMM
+	}
+	return float64(widthMicrons) * 72 / 25400, float64(heightMicrons) * 72 / 25400
+}
+
+// Pages lays out the document on pages of width by height points, breaking
+// pages when they are full. A trailing page break doesn't add an empty page.
+func (l *Layout) Pages(width, height float64, measure TextMeasurer) []LayoutPage {
+	margin := l.Margin * pointsPerMM
+	left, right, bottom := margin, width-margin, height-margin
+
+	pages := []LayoutPage{{}}
+	y := margin
+	newPage := func() {
+		pages = append(pages, LayoutPage{})
+		y = margin
+	}
+	// room breaks the page when height doesn't fit, unless the page is
+	// empty: what is taller than a page is cut at its bottom.
+	room := func(height float64) {
+		if y+height > bottom && !pages[len(pages)-1].empty() {
+			newPage()
+		}
+	}
+
+	for _, block := range l.Blocks {
+		page := &pages[len(pages)-1]
+		switch block.Kind {
+		case LayoutBlockPage:
+			newPage()
+		case LayoutBlockSpace:
+			y += block.Space * pointsPerMM
+			if y > bottom {
+				newPage()
+			}
+		case LayoutBlockRule:
+			room(layoutRuleHeight)
+			page = &pages[len(pages)-1]
+			page.Rules = append(page.Rules, PlacedRule{X1: left, X2: right, Y: y + layoutRuleHeight/2})
+			y += layoutRuleHeight
+		case LayoutBlockText:
+			columns := block.Columns
+			if len(columns) == 0 {
+				columns = []LayoutColumn{{Width: 1, Align: block.Align}}
+			}
+			measureText := func(text string) float64 {
+				return measure(text, block.Size, block.Bold)
+			}
+			var cells [][]string
+			x := left
+			var xs []float64
+			rows := 1
+			for i, column := range columns {
+				var cell string
+				if i < len(block.Cells) {
+					cell = block.Cells[i]
+				}
+				wrapped := wrapWords(cell, column.Width*(right-left), measureText)
+				cells = append(cells, wrapped)
+				xs = append(xs, x)
+				x += column.Width * (right - left)
+				if len(wrapped) > rows {
+					rows = len(wrapped)
+				}
+			}
+
+			lineHeight := block.Size * layoutLineSpacing
+			for row := 0; row < rows; row++ {
+				room(lineHeight)
+				page = &pages[len(pages)-1]
+				for i, column := range columns {
+					if row >= len(cells[i]) || cells[i][row] == "" {
+						continue
+					}
+					text := cells[i][row]
+					x, columnWidth := xs[i], column.Width*(right-left)
+					switch column.Align {
+					case LayoutAlignCenter:
+						x += (columnWidth - measureText(text)) / 2
+					case LayoutAlignRight:
+						x += columnWidth - measureText(text)
+					}
+					page.Texts = append(page.Texts, PlacedText{X: x, Y: y + block.Size, Size: block.Size, Bold: block.Bold, Text: text})
+				}
+				y += lineHeight
+			}
+		}
+	}
+
+	if len(pages) > 1 && pages[len(pages)-1].empty() {
+		pages = pages[:len(pages)-1]
+	}
+	return pages
+}
+
+// wrapWords cuts text into lines at most width wide, at spaces, and within
+// words longer than a line.
+func wrapWords(text string, width float64, measure func(string) float64) []string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return []string{""}
+	}
+	var lines []string
+	var line string
+	for _, word := range words {
+		if line != "" && measure(line+" "+word) <= width {
+			line += " " + word
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		for measure(word) > width && utf8.RuneCountInString(word) > 1 {
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && measure(string(runes[:n])) > width {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		line = word
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+// Characters half as wide as the font size.
+func measureFixed(text string, size float64, bold bool) float64 {
+	return float64(utf8.RuneCountInString(text)) * size / 2
+}
+
+func TestParseLayout(t *testing.T) {
+	layout, err := ParseLayout([]byte(".layout 80x150 3\r\n.font 14\n.bold\n.center\nDelivery note\n.regular\n.left\n.columns 60 40r\nItem\tQty\n..5 mm screws\t100\n.columns\n.rule\n.space 4\n.page\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Width != 80 || layout.Height != 150 || layout.Margin != 3 {
+		t.Errorf("expected an 80x150 page with 3 mm margins got %gx%g %g", layout.Width, layout.Height, layout.Margin)
+	}
+	columns := []LayoutColumn{{Width: 0.6, Align: LayoutAlignLeft}, {Width: 0.4, Align: LayoutAlignRight}}
+	expected := []LayoutBlock{
+		{Kind: LayoutBlockText, Size: 14, Bold: true, Align: LayoutAlignCenter, Cells: []string{"Delivery note"}},
+		{Kind: LayoutBlockText, Size: 14, Cells: []string{"Item", "Qty"}, Columns: columns},
+		{Kind: LayoutBlockText, Size: 14, Cells: []string{".5 mm screws", "100"}, Columns: columns},
+		{Kind: LayoutBlockRule},
+		{Kind: LayoutBlockSpace, Space: 4},
+		{Kind: LayoutBlockPage},
+	}
+	if !reflect.DeepEqual(layout.Blocks, expected) {
+		t.Errorf("expected blocks\n%+v\ngot\n%+v", expected, layout.Blocks)
+	}
+
+	if layout, err = ParseLayout([]byte(".layout\nText")); err != nil || layout.Width != 0 || layout.Margin != defaultLayoutMargin {
+		t.Errorf("expected the job page size and default margins got %+v, %v", layout, err)
+	}
+
+	for _, data := range []string{
+		"Text\n",
+		".layouts\n",
+		".layout 80\n",
+		".layout 80x150 40\n",
+		".layout\n.font\n",
+		".layout\n.font big\n",
+		".layout\n.columns 60 60\n",
+		".layout\n.frame\n",
+		".layout\n.\n",
+		".layout\n\xff\n",
+	} {
+		if _, err := ParseLayout([]byte(data)); err == nil {
+			t.Errorf("%q: expected an error", data)
+		}
+	}
+}
+
+func TestLayoutPages(t *testing.T) {
+	layout, err := ParseLayout([]byte(".layout\n.center\nTitle\n.left\none two three four\n.columns 50 50r\nA\t1\n.columns\n.rule\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout.Margin = 0
+	// 10 characters wide, and 4 lines high.
+	pages := layout.Pages(50, 50, measureFixed)
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages got %d: %+v", len(pages), pages)
+	}
+	expected := []PlacedText{
+		{X: 12.5, Y: 10, Size: 10, Text: "Title"},
+		{X: 0, Y: 22.5, Size: 10, Text: "one two"},
+		{X: 0, Y: 35, Size: 10, Text: "three four"},
+		{X: 0, Y: 47.5, Size: 10, Text: "A"},
+		{X: 45, Y: 47.5, Size: 10, Text: "1"},
+	}
+	if !reflect.DeepEqual(pages[0].Texts, expected) {
+		t.Errorf("expected texts\n%+v\ngot\n%+v", expected, pages[0].Texts)
+	}
+	if rules := pages[1].Rules; len(rules) != 1 || rules[0] != (PlacedRule{X1: 0, X2: 50, Y: layoutRuleHeight / 2}) {
+		t.Errorf("expected the rule at the top of page 2 got %+v", rules)
+	}
+
+	// Breaks within words longer than a line, and a trailing page break.
+	layout, _ = ParseLayout([]byte(".layout\nabcdefghijklmno\n.page\n"))
+	layout.Margin = 0
+	pages = layout.Pages(50, 50, measureFixed)
+	if len(pages) != 1 || len(pages[0].Texts) != 2 || pages[0].Texts[0].Text != "abcdefghij" || pages[0].Texts[1].Text != "klmno" {
+		t.Errorf("expected the word cut on one page got %+v", pages)
+	}
+
+	// The page size of the layout wins.
+	layout, _ = ParseLayout([]byte(".layout 100x50\n"))
+	if width, height := layout.PageSize(210000, 297000); width != 100*pointsPerMM || height != 50*pointsPerMM {
+		t.Errorf("expected a 100x50 mm page got %gx%g points", width, height)
+	}
+	layout, _ = ParseLayout([]byte(".layout\n"))
+	if width, _ := layout.PageSize(25400, 25400); width != 72 {
+		t.Errorf("expected the media size of the job got %g points", width)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// RenderLimits protect the service from untrusted documents that would hang
+// or exhaust the renderer. Zero values mean no limit.
+type RenderLimits struct {
+	// Documents with more pages are rejected before printing starts.
+	MaxPages int `json:"max_pages,omitempty"`
+
+	// Largest image, embedded or rendered, in pixels.
+	MaxImageWidth  int `json:"max_image_width,omitempty"`
+	MaxImageHeight int `json:"max_image_height,omitempty"`
+
+	// Longest a single page may take to render, e.g. "30s". The job is
+	// deleted when a page takes longer.
+	PageTimeout string `json:"page_timeout,omitempty"`
+
+	// Reject PDFs with actions that reach outside the document (launch,
+	// remote go-to, form submission, JavaScript), and keep HTML conversion
+	// from loading remote resources.
+	DisableExternalReferences bool `json:"disable_external_references,omitempty"`
+}
+
+// GetPageTimeout parses PageTimeout; zero when not set.
+func (l *RenderLimits) GetPageTimeout() (time.Duration, error) {
+	if l.PageTimeout == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(l.PageTimeout)
+}
+
+// CheckPages fails when a document has too many pages.
+func (l *RenderLimits) CheckPages(pages int) error {
+	if l.MaxPages > 0 && pages > l.MaxPages {
+		return fmt.Errorf("document has %d pages, more than the limit of %d", pages, l.MaxPages)
+	}
+	return nil
+}
+
+// CheckImage fails when an image is larger than the limits.
+func (l *RenderLimits) CheckImage(width, height int) error {
+	if (l.MaxImageWidth > 0 && width > l.MaxImageWidth) || (l.MaxImageHeight > 0 && height > l.MaxImageHeight) {
+		return fmt.Errorf("%dx%d image is larger than the limit of %dx%d", width, height, l.MaxImageWidth, l.MaxImageHeight)
+	}
+	return nil
+}
+
+var (
+	// Image XObjects are streams, which can't be stored in object streams,
+	// so their dictionaries are always readable without decompressing.
+	pdfImageDictionary = regexp.MustCompile(`<<(?:[^<>]|<<[^<>]*>>)*/Subtype\s*/Image\b(?:[^<>]|<<[^<>]*>>)*>>`)
+	pdfWidth           = regexp.MustCompile(`/Width\s+(\d+)\b`)
+	pdfHeight          = regexp.MustCompile(`/Height\s+(\d+)\b`)
+
+	pdfExternalActions = regexp.MustCompile(`/S\s*/(Launch|GoToR|GoToE|SubmitForm|ImportData|JavaScript)\b|/(JavaScript|JS)\s*[(<\d]`)
+)
+
+// Images are scanned in overlapping chunks, so that no dictionary is split.
+const (
+	pdfScanChunk   = 1 << 20
+	pdfScanOverlap = 4096
+)
+
+// CheckPDF scans a PDF file for images larger than the limits, and for
+// external references when they are disabled. It works on the raw file
+// bytes, so that nothing is decoded.
+func (l *RenderLimits) CheckPDF(fileName string) error {
+	if l.MaxImageWidth <= 0 && l.MaxImageHeight <= 0 && !l.DisableExternalReferences {
+		return nil
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, pdfScanChunk)
+	var tail []byte
+	for {
+		chunk := make([]byte, pdfScanChunk)
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			data := append(tail, chunk[:n]...)
+			if err := l.checkPDFBytes(data); err != nil {
+				return err
+			}
+			if len(data) > pdfScanOverlap {
+				tail = append([]byte{}, data[len(data)-pdfScanOverlap:]...)
+			} else {
+				tail = data
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *RenderLimits) checkPDFBytes(data []byte) error {
+	if l.DisableExternalReferences {
+		if m := pdfExternalActions.Find(data); m != nil {
+			return fmt.Errorf("document has external references (%s), which are disabled", bytes.TrimSpace(m))
+		}
+	}
+	if l.MaxImageWidth <= 0 && l.MaxImageHeight <= 0 {
+		return nil
+	}
+	for _, dictionary := range pdfImageDictionary.FindAll(data, -1) {
+		width, height := pdfInt(pdfWidth, dictionary), pdfInt(pdfHeight, dictionary)
+		if err := l.CheckImage(width, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pdfInt(re *regexp.Regexp, dictionary []byte) int {
+	m := re.FindSubmatch(dictionary)
+	if m == nil {
+		return 0
+	}
+	i, err := strconv.Atoi(string(m[1]))
+	if err != nil {
+		// Too large for an int.
+		return int(^uint(0) >> 1)
+	}
+	return i
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestPDF(t *testing.T, body string) string {
+	fileName := filepath.Join(t.TempDir(), "test.pdf")
+	if err := ioutil.WriteFile(fileName, []byte("%PDF-1.4\n"+body+"\n%%EOF\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return fileName
+}
+
+func TestCheckPDFImages(t *testing.T) {
+	limits := RenderLimits{MaxImageWidth: 5000, MaxImageHeight: 5000}
+
+	small := writeTestPDF(t, "4 0 obj\n<< /Type /XObject /Subtype /Image /Width 640 /Height 480 /DecodeParms << /Columns 640 >> >>\nstream\nendstream\nendobj")
+	if err := limits.CheckPDF(small); err != nil {
+		t.Errorf("small image rejected: %s", err)
+	}
+
+	large := writeTestPDF(t, "4 0 obj\n<</Type/XObject/Subtype/Image/Width 100000/Height 10>>\nstream\nendstream\nendobj")
+	if err := limits.CheckPDF(large); err == nil {
+		t.Error("large image accepted")
+	}
+}
+
+func TestCheckPDFExternalReferences(t *testing.T) {
+	fileName := writeTestPDF(t, "5 0 obj\n<< /S /Launch /F (cmd.exe) >>\nendobj")
+
+	limits := RenderLimits{}
+	if err := limits.CheckPDF(fileName); err != nil {
+		t.Errorf("rejected without limits: %s", err)
+	}
+	limits.DisableExternalReferences = true
+	if err := limits.CheckPDF(fileName); err == nil {
+		t.Error("launch action accepted")
+	}
+
+	links := writeTestPDF(t, "5 0 obj\n<< /S /URI /URI (https://example.com) >>\nendobj")
+	if err := limits.CheckPDF(links); err != nil {
+		t.Errorf("link rejected: %s", err)
+	}
+}
+
+func TestCheckPages(t *testing.T) {
+	limits := RenderLimits{MaxPages: 10}
+	if err := limits.CheckPages(10); err != nil {
+		t.Error(err)
+	}
+	if err := limits.CheckPages(11); err == nil {
+		t.Error("11 pages accepted")
+	}
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"strings"
+	"sync"
+)
+
+// LogTail keeps the last lines written to it, such as the log of a
+// process, for support bundles.
+type LogTail struct {
+	mutex sync.Mutex
+	max   int
+	lines []string
+	// Start of an unfinished line.
+	partial string
+}
+
+func NewLogTail(lines int) *LogTail {
+	return &LogTail{max: lines}
+}
+
+func (t *LogTail) Write(p []byte) (int, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	lines := strings.Split(t.partial+string(p), "\n")
+	t.partial = lines[len(lines)-1]
+	t.lines = append(t.lines, lines[:len(lines)-1]...)
+	if len(t.lines) > t.max {
+		t.lines = append(t.lines[:0], t.lines[len(t.lines)-t.max:]...)
+	}
+	return len(p), nil
+}
+
+// Lines returns the last lines written, oldest first.
+func (t *LogTail) Lines() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string{}, t.lines...)
+}
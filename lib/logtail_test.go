@@ -0,0 +1,30 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestLogTail(t *testing.T) {
+	tail := NewLogTail(3)
+	for i := 1; i <= 5; i++ {
+		fmt.Fprintf(tail, "line %d\n", i)
+	}
+	tail.Write([]byte("line "))
+	if lines := tail.Lines(); !reflect.DeepEqual(lines, []string{"line 3", "line 4", "line 5"}) {
+		t.Errorf("expected the last 3 lines got %q", lines)
+	}
+	tail.Write([]byte("6\nline 7\n"))
+	if lines := tail.Lines(); !reflect.DeepEqual(lines, []string{"line 5", "line 6", "line 7"}) {
+		t.Errorf("expected lines written in parts to be joined got %q", lines)
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "github.com/gorpher/winspool-cgo/model"
+
+// MediaSizeTolerance absorbs rounding between inch and metric definitions
+// of the same paper, e.g. 215.9 mm vs 216 mm Letter.
+const MediaSizeTolerance = 2000
+
+// MatchMediaSize finds the option closest to the given dimensions, when
+// both are within tolerance microns. Options without a vendor ID are skipped,
+// since they can't be selected by code.
+func MatchMediaSize(mediaSize *model.MediaSize, widthMicrons, heightMicrons, tolerance int32) (*model.MediaSizeOption, bool) {
+	if mediaSize == nil {
+		return nil, false
+	}
+
+	var best *model.MediaSizeOption
+	var bestDistance int32
+	for i := range mediaSize.Option {
+		option := &mediaSize.Option[i]
+		if option.VendorID == "" {
+			continue
+		}
+		dw, dh := abs32(option.WidthMicrons-widthMicrons), abs32(option.HeightMicrons-heightMicrons)
+		if dw > tolerance || dh > tolerance {
+			continue
+		}
+		if best == nil || dw+dh < bestDistance {
+			best, bestDistance = option, dw+dh
+		}
+	}
+	return best, best != nil
+}
+
+// MediaSizeByVendorID finds the option of a paper code of the driver.
+func MediaSizeByVendorID(mediaSize *model.MediaSize, vendorID string) (*model.MediaSizeOption, bool) {
+	if mediaSize == nil || vendorID == "" {
+		return nil, false
+	}
+	for i := range mediaSize.Option {
+		if option := &mediaSize.Option[i]; option.VendorID == vendorID {
+			return option, true
+		}
+	}
+	return nil, false
+}
+
+// MediaSizeDisplayName names a media size by its standard name, or else as
+// the driver names it.
+func MediaSizeDisplayName(option *model.MediaSizeOption) string {
+	if option.Name == model.MediaSizeCustom || option.Name == "" {
+		return displayName(option.CustomDisplayName, option.CustomDisplayNameLocalized)
+	}
+	return string(option.Name)
+}
+
+// DMBIN values of DEVMODE dmDefaultSource, as defined in wingdi.h. Values
+// from DevModeBinUser up are trays specific to the driver.
+const (
+	DevModeBinUpper          int16 = 1
+	DevModeBinLower          int16 = 2
+	DevModeBinMiddle         int16 = 3
+	DevModeBinManual         int16 = 4
+	DevModeBinEnvelope       int16 = 5
+	DevModeBinEnvelopeManual int16 = 6
+	DevModeBinAuto           int16 = 7
+	DevModeBinTractor        int16 = 8
+	DevModeBinSmallFormat    int16 = 9
+	DevModeBinLargeFormat    int16 = 10
+	DevModeBinLargeCapacity  int16 = 11
+	DevModeBinCassette       int16 = 14
+	DevModeBinFormSource     int16 = 15
+	DevModeBinUser           int16 = 256
+)
+
+var mediaSourceTypeByBin = map[int16]model.MediaSourceType{
+	DevModeBinUpper:          model.MediaSourceUpper,
+	DevModeBinLower:          model.MediaSourceLower,
+	DevModeBinMiddle:         model.MediaSourceMiddle,
+	DevModeBinManual:         model.MediaSourceManual,
+	DevModeBinEnvelope:       model.MediaSourceEnvelope,
+	DevModeBinEnvelopeManual: model.MediaSourceEnvelopeManual,
+	DevModeBinAuto:           model.MediaSourceAuto,
+	DevModeBinTractor:        model.MediaSourceTractor,
+	DevModeBinSmallFormat:    model.MediaSourceSmallFormat,
+	DevModeBinLargeFormat:    model.MediaSourceLargeFormat,
+	DevModeBinLargeCapacity:  model.MediaSourceLargeCapacity,
+	DevModeBinCassette:       model.MediaSourceCassette,
+	DevModeBinFormSource:     model.MediaSourceFormSource,
+}
+
+// MediaSourceTypeOfBin returns the media source type of a DMBIN value;
+// CUSTOM for the trays of the driver.
+func MediaSourceTypeOfBin(bin int16) model.MediaSourceType {
+	if t, ok := mediaSourceTypeByBin[bin]; ok {
+		return t
+	}
+	return model.MediaSourceCustom
+}
+
+// MatchMediaSource finds the first tray of the given type. Options without
+// a vendor ID are skipped, since they can't be selected by code.
+func MatchMediaSource(mediaSource *model.MediaSource, sourceType model.MediaSourceType) (*model.MediaSourceOption, bool) {
+	if mediaSource == nil || sourceType == "" {
+		return nil, false
+	}
+	for i := range mediaSource.Option {
+		if option := &mediaSource.Option[i]; option.Type == sourceType && option.VendorID != "" {
+			return option, true
+		}
+	}
+	return nil, false
+}
+
+func abs32(i int32) int32 {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
@@ -0,0 +1,47 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestMatchMediaSize(t *testing.T) {
+	mediaSize := &model.MediaSize{Option: []model.MediaSizeOption{
+		{VendorID: "1", WidthMicrons: 215900, HeightMicrons: 279400}, // Letter
+		{VendorID: "9", WidthMicrons: 210000, HeightMicrons: 297000}, // A4
+		{VendorID: "", WidthMicrons: 216000, HeightMicrons: 279000},
+		{VendorID: "256", WidthMicrons: 80000, HeightMicrons: 200000},
+	}}
+
+	for _, test := range []struct {
+		width, height int32
+		vendorID      string
+	}{
+		{216000, 279000, "1"},
+		{210000, 297000, "9"},
+		{211500, 298500, "9"},
+		{80000, 201000, "256"},
+		{297000, 210000, ""}, // Landscape A4 isn't a paper code.
+		{100000, 150000, ""},
+	} {
+		option, ok := MatchMediaSize(mediaSize, test.width, test.height, MediaSizeTolerance)
+		if test.vendorID == "" {
+			if ok {
+				t.Errorf("%dx%d: unexpected match %s", test.width, test.height, option.VendorID)
+			}
+			continue
+		}
+		if !ok || option.VendorID != test.vendorID {
+			t.Errorf("%dx%d: expected %s got %+v", test.width, test.height, test.vendorID, option)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"context"
+	"io"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// NativePrintSystem is what print backends have in common:
+// winspool.WinSpool on Windows, and winspoolsim.Spooler, which keeps
+// printers and jobs in memory, so that code depending on it runs on any OS.
+// Backends implement more, such as RestartJob or SetJobPriority; callers
+// check for those with a type assertion. Documents are printed with the
+// Print of a backend, as rendering differs.
+type NativePrintSystem interface {
+	GetPrinters() ([]Printer, error)
+	GetDefaultPrinter() (string, error)
+	GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error)
+
+	// PrintRaw sends data to the printer as-is, in the spooler datatype;
+	// RAW when empty.
+	PrintRaw(printerName string, data io.Reader, docName, datatype string) (*PrintResult, error)
+	CancelJob(printerName string, jobID uint32) error
+	// ReleaseJob deletes a finished job the spooler retained.
+	ReleaseJob(printerName string, jobID uint32) error
+
+	PausePrinter(printerName string) error
+	ResumePrinter(printerName string) error
+	PurgePrinter(printerName string) error
+
+	// WatchChanges signals spooler changes until done is closed.
+	WatchChanges(done <-chan struct{}) (<-chan SpoolerChange, error)
+	// Subscribe reports printer and job events until ctx is done.
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
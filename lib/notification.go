@@ -0,0 +1,56 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+// SpoolerChange describes what kind of objects changed in the native print system.
+type SpoolerChange uint8
+
+const (
+	SpoolerChangePrinter SpoolerChange = 1 << iota
+	SpoolerChangeJob
+)
+
+// JobChange carries the job fields reported by a spooler notification, so
+// that job state can be followed without querying each job. Fields that
+// were not part of the notification are nil.
+type JobChange struct {
+	// Empty when the printer name didn't change; job IDs are unique to the
+	// spooler.
+	PrinterName  string
+	JobID        uint32
+	Status       *uint32
+	TotalPages   *uint32
+	PagesPrinted *uint32
+}
+
+// DeviceEvent tells whether a device was plugged or unplugged.
+type DeviceEvent uint8
+
+const (
+	DeviceArrival DeviceEvent = iota + 1
+	DeviceRemoval
+)
+
+func (e DeviceEvent) String() string {
+	switch e {
+	case DeviceArrival:
+		return "arrival"
+	case DeviceRemoval:
+		return "removal"
+	default:
+		return "unknown"
+	}
+}
+
+// DeviceChange reports a printer device that was plugged or unplugged.
+type DeviceChange struct {
+	Event DeviceEvent
+	// Device interface path, like \\?\USB#VID_04B8&PID_0202#...
+	Name string
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "github.com/gorpher/winspool-cgo/model"
+
+// NUpCell is the area of a sheet one document page is printed in, in
+// points.
+type NUpCell struct {
+	X, Y, Width, Height float64
+}
+
+// Fit returns the scale and offset that draw a page of the given size in
+// points as large as it fits in the cell, centered.
+func (c NUpCell) Fit(wPagePoints, hPagePoints float64) (scale, xOffsetPoints, yOffsetPoints float64) {
+	scale = c.Width / wPagePoints
+	if s := c.Height / hPagePoints; s < scale {
+		scale = s
+	}
+	return scale, c.X + (c.Width-wPagePoints*scale)/2, c.Y + (c.Height-hPagePoints*scale)/2
+}
+
+// NUpCells divides an area of a sheet into cells for pagesPerSheet pages,
+// in layout order. Of the grids of pagesPerSheet cells, such as 3x2 and 2x3,
+// the one that prints pages of the given size largest is used.
+func NUpCells(pagesPerSheet int, layout model.NUpLayoutType, x, y, w, h, wPagePoints, hPagePoints float64) []NUpCell {
+	columns, rows, best := 1, pagesPerSheet, 0.0
+	for c := 1; c <= pagesPerSheet; c++ {
+		if pagesPerSheet%c != 0 {
+			continue
+		}
+		r := pagesPerSheet / c
+		scale, _, _ := NUpCell{Width: w / float64(c), Height: h / float64(r)}.Fit(wPagePoints, hPagePoints)
+		// Ties go to more columns, as on landscape sheets.
+		if scale >= best {
+			columns, rows, best = c, r, scale
+		}
+	}
+
+	cells := make([]NUpCell, pagesPerSheet)
+	wCell, hCell := w/float64(columns), h/float64(rows)
+	for i := range cells {
+		var column, row int
+		switch layout {
+		case model.NUpDownThenRight:
+			column, row = i/rows, i%rows
+		case model.NUpLeftThenDown:
+			column, row = columns-1-i%columns, i/columns
+		case model.NUpDownThenLeft:
+			column, row = columns-1-i/rows, i%rows
+		default:
+			column, row = i%columns, i/columns
+		}
+		cells[i] = NUpCell{X: x + float64(column)*wCell, Y: y + float64(row)*hCell, Width: wCell, Height: hCell}
+	}
+	return cells
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// A4 in points.
+const wA4, hA4 = 595.0, 842.0
+
+func TestNUpCells(t *testing.T) {
+	// 4-up on a portrait sheet is a 2x2 grid, filled in rows.
+	cells := NUpCells(4, "", 10, 20, wA4, hA4, wA4, hA4)
+	want := []NUpCell{
+		{10, 20, wA4 / 2, hA4 / 2}, {10 + wA4/2, 20, wA4 / 2, hA4 / 2},
+		{10, 20 + hA4/2, wA4 / 2, hA4 / 2}, {10 + wA4/2, 20 + hA4/2, wA4 / 2, hA4 / 2},
+	}
+	for i := range want {
+		if cells[i] != want[i] {
+			t.Errorf("4-up cell %d: expected %+v got %+v", i, want[i], cells[i])
+		}
+	}
+
+	// 2 portrait pages on a landscape sheet go side by side, and fill it.
+	cells = NUpCells(2, model.NUpRightThenDown, 0, 0, hA4, wA4, wA4, hA4)
+	if len(cells) != 2 || cells[0].X != 0 || cells[1].X != hA4/2 || cells[1].Y != 0 {
+		t.Errorf("expected 2 columns got %+v", cells)
+	}
+	scale, x, y := cells[1].Fit(wA4, hA4)
+	if scale < 0.7 || scale > 0.71 || y != 0 || x <= hA4/2 {
+		t.Errorf("expected the second page scaled to 0.707 and centered in its half got %g at %g,%g", scale, x, y)
+	}
+
+	// 6-up on a landscape sheet is 3 columns by 2 rows.
+	for _, test := range []struct {
+		layout   model.NUpLayoutType
+		col, row []int
+	}{
+		{model.NUpRightThenDown, []int{0, 1, 2, 0, 1, 2}, []int{0, 0, 0, 1, 1, 1}},
+		{model.NUpDownThenRight, []int{0, 0, 1, 1, 2, 2}, []int{0, 1, 0, 1, 0, 1}},
+		{model.NUpLeftThenDown, []int{2, 1, 0, 2, 1, 0}, []int{0, 0, 0, 1, 1, 1}},
+		{model.NUpDownThenLeft, []int{2, 2, 1, 1, 0, 0}, []int{0, 1, 0, 1, 0, 1}},
+	} {
+		cells = NUpCells(6, test.layout, 0, 0, 900, 600, wA4, hA4)
+		for i, cell := range cells {
+			if cell.X != float64(test.col[i])*300 || cell.Y != float64(test.row[i])*300 {
+				t.Errorf("%s cell %d: expected column %d row %d got %+v", test.layout, i, test.col[i], test.row[i], cell)
+			}
+		}
+	}
+}
+
+func TestSheetsNUp(t *testing.T) {
+	settings := TicketSettings{Copies: 2, NUp: 4, Duplex: true}
+	// 9 pages take 3 sides, on 2 sheets, times 2 copies.
+	if sheets := settings.Sheets(9); sheets != 4 {
+		t.Errorf("expected 4 sheets got %d", sheets)
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PagePipeline renders pages on several workers, and hands them to a single
+// writer in page order, so that decoding the next pages overlaps spooling
+// the current one.
+type PagePipeline struct {
+	// Pages rendered at once; 1 when zero.
+	Workers int
+	// Pages rendered ahead of the writer at most, which bounds the memory
+	// taken by rendered pages; Workers when smaller.
+	Ahead int
+	// Longest the writer waits for a page; no limit when zero.
+	PageTimeout time.Duration
+
+	// Render renders page i with worker, a number below Workers; calls with
+	// the same worker are never concurrent.
+	Render func(worker, i int) (interface{}, error)
+	// Write takes the rendered pages, in order.
+	Write func(i int, page interface{}) error
+	// Discard frees pages rendered but not written, after an error.
+	Discard func(page interface{})
+	// Finished is called once all workers returned, after Run returns when
+	// a page timed out: renders can't be interrupted.
+	Finished func()
+}
+
+type renderedPage struct {
+	i    int
+	page interface{}
+	err  error
+}
+
+// Run renders and writes pages 0 to count-1, and returns the first error.
+func (p *PagePipeline) Run(count int) error {
+	workers := p.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	ahead := p.Ahead
+	if ahead < workers {
+		ahead = workers
+	}
+
+	// A slot is taken before rendering a page, and freed once it is
+	// written, so that results never block.
+	slots := make(chan struct{}, ahead)
+	next := make(chan int)
+	results := make(chan renderedPage, ahead)
+	stop := make(chan struct{})
+	go func() {
+		defer close(next)
+		for i := 0; i < count; i++ {
+			select {
+			case slots <- struct{}{}:
+			case <-stop:
+				return
+			}
+			select {
+			case next <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := range next {
+				page, err := p.Render(worker, i)
+				results <- renderedPage{i: i, page: page, err: err}
+			}
+		}(worker)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(results)
+		close(finished)
+	}()
+
+	discard := func(r renderedPage) {
+		if r.err == nil && p.Discard != nil {
+			p.Discard(r.page)
+		}
+	}
+	// drain stops the workers, and frees what they rendered once they
+	// returned.
+	drain := func(pending map[int]renderedPage) {
+		close(stop)
+		for _, r := range pending {
+			discard(r)
+		}
+		for r := range results {
+			discard(r)
+		}
+		if p.Finished != nil {
+			p.Finished()
+		}
+	}
+
+	pending := make(map[int]renderedPage)
+	var timeout <-chan time.Time
+	for want := 0; want < count; {
+		r, ok := pending[want]
+		if !ok {
+			if p.PageTimeout > 0 && timeout == nil {
+				timeout = time.After(p.PageTimeout)
+			}
+			select {
+			case r = <-results:
+				pending[r.i] = r
+			case <-timeout:
+				go drain(pending)
+				return fmt.Errorf("page took longer than %s to render", p.PageTimeout)
+			}
+			continue
+		}
+
+		delete(pending, want)
+		timeout = nil
+		err := r.err
+		if err == nil {
+			err = p.Write(want, r.page)
+		}
+		if err != nil {
+			drain(pending)
+			return err
+		}
+		<-slots
+		want++
+	}
+
+	<-finished
+	if p.Finished != nil {
+		p.Finished()
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPagePipeline(t *testing.T) {
+	var mutex sync.Mutex
+	var written []int
+	// Pages rendered and not yet written or discarded.
+	var outstanding, maxOutstanding int
+	busy := make(map[int]bool)
+	p := PagePipeline{
+		Workers: 3,
+		Ahead:   4,
+		Render: func(worker, i int) (interface{}, error) {
+			mutex.Lock()
+			if busy[worker] {
+				t.Errorf("worker %d used concurrently", worker)
+			}
+			busy[worker] = true
+			mutex.Unlock()
+			// Later pages render faster, to finish out of order.
+			time.Sleep(time.Duration(10-i%10) * time.Millisecond)
+			mutex.Lock()
+			defer mutex.Unlock()
+			busy[worker] = false
+			outstanding++
+			if outstanding > maxOutstanding {
+				maxOutstanding = outstanding
+			}
+			return i * 10, nil
+		},
+		Write: func(i int, page interface{}) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if page.(int) != i*10 {
+				t.Errorf("page %d written with the render of %d", i, page.(int)/10)
+			}
+			written = append(written, i)
+			outstanding--
+			return nil
+		},
+	}
+	if err := p.Run(20); err != nil {
+		t.Fatal(err)
+	}
+	for i, page := range written {
+		if page != i {
+			t.Fatalf("expected pages in order got %v", written)
+		}
+	}
+	if len(written) != 20 || maxOutstanding > 4 {
+		t.Errorf("expected 20 pages with at most 4 ahead got %d with %d", len(written), maxOutstanding)
+	}
+}
+
+func TestPagePipelineError(t *testing.T) {
+	var mutex sync.Mutex
+	var written, discarded int
+	failed := errors.New("bad page")
+	finished := false
+	p := PagePipeline{
+		Workers: 2,
+		Render: func(worker, i int) (interface{}, error) {
+			if i == 5 {
+				return nil, failed
+			}
+			return i, nil
+		},
+		Write: func(i int, page interface{}) error {
+			written++
+			return nil
+		},
+		Discard: func(page interface{}) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			discarded++
+		},
+		Finished: func() { finished = true },
+	}
+	if err := p.Run(100); err != failed {
+		t.Fatalf("expected the render error got %v", err)
+	}
+	if written != 5 || !finished {
+		t.Errorf("expected 5 pages written before the error, then finished got %d, %t", written, finished)
+	}
+	// Pages 6 and after may have been rendered, never more than Ahead.
+	if discarded > 2 {
+		t.Errorf("expected at most 2 pages discarded got %d", discarded)
+	}
+}
+
+func TestPagePipelineTimeout(t *testing.T) {
+	release := make(chan struct{})
+	finished := make(chan struct{})
+	p := PagePipeline{
+		Workers:     2,
+		PageTimeout: 20 * time.Millisecond,
+		Render: func(worker, i int) (interface{}, error) {
+			if i == 1 {
+				<-release
+			}
+			return i, nil
+		},
+		Write:    func(i int, page interface{}) error { return nil },
+		Finished: func() { close(finished) },
+	}
+	if err := p.Run(3); err == nil {
+		t.Fatal("expected a timeout")
+	}
+	select {
+	case <-finished:
+		t.Fatal("expected Finished to wait for the render")
+	default:
+	}
+	close(release)
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("expected Finished once the render returned")
+	}
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// PagePlacement tells where document pages are drawn on the paper, from the
+// fit_to_page, margins and scale ticket options.
+type PagePlacement struct {
+	// Pages are fit to the printable area of the paper, rather than to the
+	// whole paper.
+	FitToPage bool
+	// Pages are fit within these margins of the paper instead, such as to
+	// print on pre-printed forms.
+	Margins *model.MarginsTicketItem
+	// Pages are drawn at this percentage of their size, from the top left
+	// corner of the margins, or of the paper, rather than fit; 0 fits.
+	ScalePercent int
+}
+
+// Area returns the area of the paper pages are placed in, in points: the
+// paper less the margins, the printable area with FitToPage, and else the
+// whole paper. Fails when the margins leave no room.
+func (p PagePlacement) Area(wPaperPoints, hPaperPoints float64, printable NUpCell) (NUpCell, error) {
+	if m := p.Margins; m != nil {
+		points := func(microns int32) float64 { return float64(microns) * 72 / 25400 }
+		area := NUpCell{
+			X:      points(m.LeftMicrons),
+			Y:      points(m.TopMicrons),
+			Width:  wPaperPoints - points(m.LeftMicrons) - points(m.RightMicrons),
+			Height: hPaperPoints - points(m.TopMicrons) - points(m.BottomMicrons),
+		}
+		if area.Width <= 0 || area.Height <= 0 {
+			return NUpCell{}, fmt.Errorf("margins leave no room on %.0fx%.0f mm paper", wPaperPoints/pointsPerMM, hPaperPoints/pointsPerMM)
+		}
+		return area, nil
+	}
+	if p.FitToPage {
+		return printable, nil
+	}
+	return NUpCell{Width: wPaperPoints, Height: hPaperPoints}, nil
+}
+
+// Place returns the scale and offset that draw a page of the given size in
+// points on the paper. Fit pages are centered on the paper, unless margins
+// are set, in which case they are centered within them.
+func (p PagePlacement) Place(wDocPoints, hDocPoints, wPaperPoints, hPaperPoints float64, printable NUpCell) (scale, xOffsetPoints, yOffsetPoints float64, err error) {
+	area, err := p.Area(wPaperPoints, hPaperPoints, printable)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if p.ScalePercent > 0 {
+		return float64(p.ScalePercent) / 100, area.X, area.Y, nil
+	}
+	scale, xOffsetPoints, yOffsetPoints = area.Fit(wDocPoints, hDocPoints)
+	if p.Margins == nil {
+		// Centered on the paper, even when the printable area isn't.
+		xOffsetPoints = (wPaperPoints - wDocPoints*scale) / 2
+		yOffsetPoints = (hPaperPoints - hDocPoints*scale) / 2
+	}
+	return scale, xOffsetPoints, yOffsetPoints, nil
+}
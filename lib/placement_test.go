@@ -0,0 +1,53 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"math"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestPagePlacement(t *testing.T) {
+	printable := NUpCell{X: 12, Y: 12, Width: wA4 - 24, Height: hA4 - 36}
+	near := func(a, b float64) bool { return math.Abs(a-b) < 0.01 }
+
+	// A5 page fit to A4 paper, centered.
+	scale, x, y, err := PagePlacement{}.Place(wA4/math.Sqrt2, hA4/math.Sqrt2, wA4, hA4, printable)
+	if err != nil || !near(scale, math.Sqrt2) || !near(x, 0) || !near(y, 0) {
+		t.Errorf("expected A5 to grow to A4 got %g at %g,%g (%v)", scale, x, y, err)
+	}
+	// Fit to the printable area, still centered on the paper.
+	scale, x, _, _ = PagePlacement{FitToPage: true}.Place(wA4, hA4, wA4, hA4, printable)
+	if !near(scale, (hA4-36)/hA4) || !near(x, (wA4-wA4*scale)/2) {
+		t.Errorf("expected a page fit to the printable area got %g at x %g", scale, x)
+	}
+
+	// 1 inch margins fit the page within them.
+	margins := &model.MarginsTicketItem{TopMicrons: 25400, RightMicrons: 25400, BottomMicrons: 25400, LeftMicrons: 25400}
+	scale, x, y, _ = PagePlacement{FitToPage: true, Margins: margins}.Place(wA4, hA4, wA4, hA4, printable)
+	if !near(scale, (wA4-144)/wA4) || !near(x, 72) || !near(y, 72+((hA4-144)-hA4*scale)/2) {
+		t.Errorf("expected a page fit within the margins got %g at %g,%g", scale, x, y)
+	}
+
+	// A scale is applied as is, from the corner of the margins.
+	scale, x, y, _ = PagePlacement{Margins: &model.MarginsTicketItem{TopMicrons: 5000, LeftMicrons: 10000}, ScalePercent: 100}.Place(wA4, hA4, wA4, hA4, printable)
+	if scale != 1 || !near(x, 10000*72/25400.0) || !near(y, 5000*72/25400.0) {
+		t.Errorf("expected actual size at the margins got %g at %g,%g", scale, x, y)
+	}
+	scale, x, y, _ = PagePlacement{ScalePercent: 50}.Place(wA4, hA4, wA4, hA4, printable)
+	if scale != 0.5 || x != 0 || y != 0 {
+		t.Errorf("expected half size at the paper corner got %g at %g,%g", scale, x, y)
+	}
+
+	if _, _, _, err = (PagePlacement{Margins: &model.MarginsTicketItem{LeftMicrons: 150000, RightMicrons: 100000}}).Place(wA4, hA4, wA4, hA4, printable); err == nil {
+		t.Error("expected an error for margins wider than the paper")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"math"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// JobPlan is what printing a document would do, worked out without
+// starting a job: the ticket as applied to the printer, and the pages,
+// sheets and cost of the job.
+type JobPlan struct {
+	Printer     string `json:"printer"`
+	ContentType string `json:"content_type"`
+
+	// Pages of the document; zero when only known once printed, as for
+	// RAW documents and plain text.
+	DocumentPages int `json:"document_pages"`
+	// Pages printed, counting copies.
+	Pages  int `json:"pages"`
+	Copies int `json:"copies"`
+	// Sheet sides printed on, and sheets, counting copies.
+	Sides  int `json:"sides"`
+	Sheets int `json:"sheets"`
+
+	Color   bool `json:"color"`
+	Duplex  bool `json:"duplex"`
+	NUp     int  `json:"n_up"`
+	Booklet bool `json:"booklet,omitempty"`
+	// Paper, as named by the driver.
+	Paper string `json:"paper,omitempty"`
+
+	// Pages are fit to the printable area, within margins or scaled, as in
+	// PagePlacement; else they are fit to the paper.
+	FitToPage    bool                     `json:"fit_to_page,omitempty"`
+	Margins      *model.MarginsTicketItem `json:"margins,omitempty"`
+	ScalePercent int                      `json:"scale_percent,omitempty"`
+
+	// Cost of the job, when the printer has a cost config.
+	Cost     *JobCost       `json:"cost,omitempty"`
+	Warnings []PrintWarning `json:"warnings,omitempty"`
+}
+
+// Plan returns the plan of a document of pages pages printed with these
+// settings.
+func (s TicketSettings) Plan(pages int) JobPlan {
+	printed := s.PagesPrinted(pages)
+	return JobPlan{
+		DocumentPages: pages,
+		Pages:         printed * s.Copies,
+		Copies:        s.Copies,
+		Sides:         s.Sides(printed),
+		Sheets:        s.Sheets(printed),
+		Duplex:        s.Duplex,
+		NUp:           s.NUp,
+		Booklet:       s.Booklet,
+		FitToPage:     s.Placement.FitToPage,
+		Margins:       s.Placement.Margins,
+		ScalePercent:  s.Placement.ScalePercent,
+	}
+}
+
+// CostConfig prices the jobs of a printer, in a currency of choice.
+type CostConfig struct {
+	// Such as "EUR"; only shown with the cost.
+	Currency string `json:"currency,omitempty"`
+	// Price of a sheet of paper.
+	PerSheet float64 `json:"per_sheet,omitempty"`
+	// Price of printing one side of a sheet, in monochrome or in color.
+	PerMonoSide  float64 `json:"per_mono_side,omitempty"`
+	PerColorSide float64 `json:"per_color_side,omitempty"`
+}
+
+// JobCost is the price of a job.
+type JobCost struct {
+	Currency string  `json:"currency,omitempty"`
+	Amount   float64 `json:"amount"`
+}
+
+func (c *CostConfig) Validate() error {
+	if c.PerSheet < 0 || c.PerMonoSide < 0 || c.PerColorSide < 0 {
+		return errors.New("prices must not be negative")
+	}
+	return nil
+}
+
+// Cost prices the sheets and sides of a plan. The amount is rounded to
+// 1/10000, which absorbs floating point error when shown.
+func (c *CostConfig) Cost(plan *JobPlan) *JobCost {
+	perSide := c.PerMonoSide
+	if plan.Color {
+		perSide = c.PerColorSide
+	}
+	amount := float64(plan.Sheets)*c.PerSheet + float64(plan.Sides)*perSide
+	return &JobCost{Currency: c.Currency, Amount: math.Round(amount*10000) / 10000}
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestJobPlan(t *testing.T) {
+	for _, c := range []struct {
+		name                  string
+		settings              TicketSettings
+		pages                 int
+		printed, sides, sheet int
+	}{
+		{"simplex", TicketSettings{Copies: 2, NUp: 1}, 5, 10, 10, 10},
+		{"duplex", TicketSettings{Copies: 2, NUp: 1, Duplex: true}, 5, 10, 10, 6},
+		{"4-up duplex", TicketSettings{Copies: 1, NUp: 4, Duplex: true}, 9, 9, 3, 2},
+		{"software copies duplex", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 1, Duplex: true}, 5, 10, 10, 6},
+		{"booklet", TicketSettings{Copies: 1, NUp: 1, Duplex: true, Booklet: true}, 6, 6, 4, 2},
+		{"page range", TicketSettings{Copies: 3, NUp: 1, PageRange: &model.PageRangeTicketItem{Interval: []model.PageRangeInterval{{Start: 2, End: 3}}}}, 5, 6, 6, 6},
+	} {
+		plan := c.settings.Plan(c.pages)
+		if plan.DocumentPages != c.pages || plan.Pages != c.printed || plan.Sides != c.sides || plan.Sheets != c.sheet {
+			t.Errorf("%s: expected %d pages, %d printed on %d sides of %d sheets, got %+v", c.name, c.pages, c.printed, c.sides, c.sheet, plan)
+		}
+	}
+}
+
+func TestPadsCopies(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		settings TicketSettings
+		pages    int
+		pads     bool
+	}{
+		{"odd duplex", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 1, Duplex: true}, 5, true},
+		{"even duplex", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 1, Duplex: true}, 6, false},
+		{"simplex", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 1}, 5, false},
+		{"driver copies", TicketSettings{Copies: 2, SoftwareCopies: 1, NUp: 1, Duplex: true}, 5, false},
+		{"4-up odd sides", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 4, Duplex: true}, 9, true},
+		{"booklet", TicketSettings{Copies: 2, SoftwareCopies: 2, NUp: 1, Duplex: true, Booklet: true}, 5, false},
+	} {
+		if pads := c.settings.PadsCopies(c.pages); pads != c.pads {
+			t.Errorf("%s: expected pads %v got %v", c.name, c.pads, pads)
+		}
+	}
+}
+
+func TestCostConfig(t *testing.T) {
+	cost := CostConfig{Currency: "EUR", PerSheet: 0.01, PerMonoSide: 0.02, PerColorSide: 0.1}
+	if err := cost.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	plan := JobPlan{Sheets: 3, Sides: 5}
+	if c := cost.Cost(&plan); c.Amount != 0.13 || c.Currency != "EUR" {
+		t.Errorf("expected 0.13 EUR, got %+v", c)
+	}
+	plan.Color = true
+	if c := cost.Cost(&plan); c.Amount != 0.53 {
+		t.Errorf("expected 0.53 in color, got %+v", c)
+	}
+	if err := (&CostConfig{PerSheet: -1}).Validate(); err == nil {
+		t.Error("expected a negative price to be invalid")
+	}
+}
@@ -0,0 +1,177 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+)
+
+// ErrInvalidDocument is wrapped by the errors of documents that fail
+// preflight, which are PreflightErrors.
+var ErrInvalidDocument = errors.New("invalid document")
+
+// Problems of documents found by preflight, the codes of PreflightErrors.
+const (
+	// The PDF needs a password to be opened.
+	PreflightEncrypted = "encrypted"
+	// The PDF can't be read, such as when it is truncated.
+	PreflightCorrupt = "corrupt"
+	PreflightNoPages = "no_pages"
+	// A page is larger than PDF allows, or has no size.
+	PreflightInvalidPageSize = "invalid_page_size"
+)
+
+// MaxPDFPagePoints is the largest page side PDF allows, 200 inches.
+const MaxPDFPagePoints = 14400
+
+// PreflightError is a document that can't be printed, found before
+// rendering starts.
+type PreflightError struct {
+	// One of the Preflight* problems.
+	Code string `json:"code"`
+	// The page of the problem, from 1; 0 when about the whole document.
+	Page    int    `json:"page,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e *PreflightError) Error() string {
+	if e.Page > 0 {
+		return fmt.Sprintf("page %d: %s", e.Page, e.Message)
+	}
+	return e.Message
+}
+
+func (e *PreflightError) Unwrap() error {
+	return ErrInvalidDocument
+}
+
+// PDFScan is what the raw bytes of a PDF tell of it, before it is parsed.
+type PDFScan struct {
+	// The trailer references an encryption dictionary.
+	Encrypted bool
+	// The file doesn't end with %%EOF, as when a download was cut short.
+	Truncated bool
+}
+
+// The trailer, or the cross-reference stream, and %%EOF end the file, after
+// which a few bytes of garbage are tolerated.
+const pdfTailSize = 64 << 10
+
+var pdfEncrypt = regexp.MustCompile(`/Encrypt\s*(?:\d+\s+\d+\s+R|<<)`)
+
+// ScanPDF reads the end of a PDF file for its encryption and truncation.
+func ScanPDF(fileName string) (PDFScan, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return PDFScan{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return PDFScan{}, err
+	}
+	offset := info.Size() - pdfTailSize
+	if offset < 0 {
+		offset = 0
+	}
+	tail := make([]byte, info.Size()-offset)
+	if _, err = f.ReadAt(tail, offset); err != nil && err != io.EOF {
+		return PDFScan{}, err
+	}
+	eof := bytes.LastIndex(tail, []byte("%%EOF"))
+	return PDFScan{
+		Encrypted: pdfEncrypt.Match(tail),
+		Truncated: eof < 0 || len(bytes.TrimSpace(tail[eof+5:])) > 1024,
+	}, nil
+}
+
+// OpenError returns the PreflightError of a PDF the renderer failed to
+// open, with err.
+func (s PDFScan) OpenError(err error) *PreflightError {
+	if s.Encrypted {
+		return &PreflightError{Code: PreflightEncrypted, Message: fmt.Sprintf("PDF is encrypted and needs a password: %s", err)}
+	}
+	if s.Truncated {
+		return &PreflightError{Code: PreflightCorrupt, Message: fmt.Sprintf("PDF is truncated: %s", err)}
+	}
+	return &PreflightError{Code: PreflightCorrupt, Message: fmt.Sprintf("PDF is corrupt: %s", err)}
+}
+
+// CheckPreflightPages fails when a document has no pages.
+func CheckPreflightPages(pages int) error {
+	if pages <= 0 {
+		return &PreflightError{Code: PreflightNoPages, Message: "document has no pages"}
+	}
+	return nil
+}
+
+// CheckPreflightPageSize fails when a page, from 1, has no size or is larger
+// than PDF allows, which renders absurdly scaled, or not at all.
+func CheckPreflightPageSize(page int, wPoints, hPoints float64) error {
+	if !(wPoints > 0 && hPoints > 0) || math.IsInf(wPoints, 0) || math.IsInf(hPoints, 0) {
+		return &PreflightError{Code: PreflightInvalidPageSize, Page: page, Message: fmt.Sprintf("page has no size, %gx%g points", wPoints, hPoints)}
+	}
+	if wPoints > MaxPDFPagePoints || hPoints > MaxPDFPagePoints {
+		return &PreflightError{Code: PreflightInvalidPageSize, Page: page, Message: fmt.Sprintf("%.0fx%.0f mm page is larger than PDF allows, %.0f mm",
+			wPoints/pointsPerMM, hPoints/pointsPerMM, MaxPDFPagePoints/pointsPerMM)}
+	}
+	return nil
+}
+
+// PreflightReport is what printing a document on a printer would do to its
+// pages, found before any rendering.
+type PreflightReport struct {
+	Printer     string `json:"printer"`
+	ContentType string `json:"content_type"`
+	// The PDF is encrypted, but opens without a password.
+	Encrypted bool `json:"encrypted,omitempty"`
+	Pages     int  `json:"pages"`
+	// Sizes of the pages, in document order of their first page.
+	PageSizes []PreflightPageSize `json:"page_sizes"`
+	// Any page is printed at another size than its own.
+	Scaling bool    `json:"scaling"`
+	Plan    JobPlan `json:"plan"`
+}
+
+// PreflightPageSize is a size of pages of a document, and how they are
+// printed on the paper.
+type PreflightPageSize struct {
+	WidthMicrons  int32 `json:"width_microns"`
+	HeightMicrons int32 `json:"height_microns"`
+	// Pages of this size, and the first of them, from 1.
+	Pages     int `json:"pages"`
+	FirstPage int `json:"first_page"`
+	// Percentage of their size the pages print at.
+	ScalePercent float64 `json:"scale_percent"`
+}
+
+// AddPageSize counts a page, from 1, of the given size in points, printed
+// at scale, by the size in microns, so that sizes differing by rounding
+// count as one.
+func (r *PreflightReport) AddPageSize(page int, wPoints, hPoints, scale float64) {
+	width, height := int32(math.Round(wPoints*25400/72)), int32(math.Round(hPoints*25400/72))
+	percent := math.Round(scale*1000) / 10
+	if percent != 100 {
+		r.Scaling = true
+	}
+	for i := range r.PageSizes {
+		size := &r.PageSizes[i]
+		if abs32(size.WidthMicrons-width) <= MediaSizeTolerance && abs32(size.HeightMicrons-height) <= MediaSizeTolerance && size.ScalePercent == percent {
+			size.Pages++
+			return
+		}
+	}
+	r.PageSizes = append(r.PageSizes, PreflightPageSize{WidthMicrons: width, HeightMicrons: height, Pages: 1, FirstPage: page, ScalePercent: percent})
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScanPDF(t *testing.T) {
+	dir, err := ioutil.TempDir("", "preflight")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := map[string]struct {
+		data                 string
+		encrypted, truncated bool
+	}{
+		"plain":     {"%PDF-1.4\n1 0 obj\n<< >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n", false, false},
+		"encrypted": {"%PDF-1.4\ntrailer\n<< /Root 1 0 R /Encrypt 5 0 R >>\n%%EOF", true, false},
+		"metadata":  {"%PDF-1.4\n<< /EncryptMetadata false >>\ntrailer\n<< /Root 1 0 R >>\n%%EOF", false, false},
+		"truncated": {"%PDF-1.4\n1 0 obj\n<< /Length 1000 >>\nstream\n", false, true},
+	}
+	for name, test := range tests {
+		fileName := filepath.Join(dir, name+".pdf")
+		if err := ioutil.WriteFile(fileName, []byte(test.data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		scan, err := ScanPDF(fileName)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		if scan.Encrypted != test.encrypted || scan.Truncated != test.truncated {
+			t.Errorf("%s: expected encrypted %v and truncated %v, got %+v", name, test.encrypted, test.truncated, scan)
+		}
+	}
+
+	var preflightErr *PreflightError
+	err = PDFScan{Encrypted: true}.OpenError(errors.New("Poppler/GLib: Document is encrypted"))
+	if !errors.As(err, &preflightErr) || preflightErr.Code != PreflightEncrypted || !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("expected an encrypted PreflightError, got %v", err)
+	}
+	if err := (PDFScan{Truncated: true}).OpenError(errors.New("unknown error")); err.Code != PreflightCorrupt {
+		t.Errorf("expected a corrupt PreflightError, got %v", err)
+	}
+}
+
+func TestCheckPreflightPageSize(t *testing.T) {
+	if err := CheckPreflightPageSize(1, 595, 842); err != nil {
+		t.Errorf("expected A4 to pass, got %s", err)
+	}
+	for _, size := range [][2]float64{{0, 842}, {595, -1}, {20000, 842}} {
+		err := CheckPreflightPageSize(3, size[0], size[1])
+		var preflightErr *PreflightError
+		if !errors.As(err, &preflightErr) || preflightErr.Code != PreflightInvalidPageSize || preflightErr.Page != 3 {
+			t.Errorf("expected an invalid page size error for %v, got %v", size, err)
+		}
+	}
+	if err := CheckPreflightPages(0); !errors.Is(err, ErrInvalidDocument) {
+		t.Errorf("expected an error for no pages, got %v", err)
+	}
+}
+
+func TestPreflightReportAddPageSize(t *testing.T) {
+	var report PreflightReport
+	report.AddPageSize(1, 595.28, 841.89, 1)
+	report.AddPageSize(2, 595, 842, 1)
+	if report.Scaling || len(report.PageSizes) != 1 || report.PageSizes[0].Pages != 2 {
+		t.Fatalf("expected 2 unscaled A4 pages, got %+v", report)
+	}
+	report.AddPageSize(3, 1190.55, 841.89, 0.5)
+	if !report.Scaling || len(report.PageSizes) != 2 {
+		t.Fatalf("expected a scaled A3 page, got %+v", report)
+	}
+	if a3 := report.PageSizes[1]; a3.WidthMicrons != 420000 || a3.HeightMicrons != 297000 || a3.FirstPage != 3 || a3.ScalePercent != 50 {
+		t.Errorf("unexpected page size %+v", a3)
+	}
+}
@@ -26,12 +26,15 @@ type Printer struct {
 	DefaultDisplayName  string                           // CUPS: printer-info;                GCP: default_display_name field
 	Manufacturer        string                           // CUPS: PPD;                         GCP: manufacturer field
 	Model               string                           // CUPS: PPD;                         GCP: model field
+	SerialNumber        string                           // Windows: SNMP prtGeneralSerialNumber
+	DeviceUUID          string                           // Windows: WSD endpoint or PnP container ID
 	GCPVersion          string                           //                                    GCP: gcpVersion field
 	SetupURL            string                           //                                    GCP: setup_url field
 	SupportURL          string                           //                                    GCP: support_url field
 	UpdateURL           string                           //                                    GCP: update_url field
 	ConnectorVersion    string                           //                                    GCP: firmware field
 	State               *model.PrinterStateSection       // CUPS: various;                     GCP: semantic_state field
+	Offline             bool                             // Windows: PRINTER_STATUS_OFFLINE or PRINTER_ATTRIBUTE_WORK_OFFLINE, set for unplugged USB printers
 	Description         *model.PrinterDescriptionSection // CUPS: translated PPD;              GCP: capabilities field
 	CapsHash            string                           // CUPS: hash of PPD;                 GCP: capsHash field
 	Tags                map[string]string                // CUPS: all printer attributes;      GCP: repeated tag field
@@ -60,6 +63,19 @@ func (p *Printer) GetHostname() (string, bool) {
 	return "", false
 }
 
+// IsPaperOut tells whether a printer state has an empty input tray.
+func IsPaperOut(state *model.PrinterStateSection) bool {
+	if state == nil || state.InputTrayState == nil {
+		return false
+	}
+	for _, item := range state.InputTrayState.Item {
+		if item.State == model.InputTrayStateEmpty {
+			return true
+		}
+	}
+	return false
+}
+
 type PrinterDiffOperation int8
 
 const (
@@ -77,6 +93,8 @@ type PrinterDiff struct {
 	DefaultDisplayNameChanged  bool
 	ManufacturerChanged        bool
 	ModelChanged               bool
+	SerialNumberChanged        bool
+	DeviceUUIDChanged          bool
 	GCPVersionChanged          bool
 	SetupURLChanged            bool
 	SupportURLChanged          bool
@@ -171,6 +189,12 @@ func diffPrinter(pn, pg *Printer) PrinterDiff {
 	if pg.Model != pn.Model {
 		d.ModelChanged = true
 	}
+	if pg.SerialNumber != pn.SerialNumber {
+		d.SerialNumberChanged = true
+	}
+	if pg.DeviceUUID != pn.DeviceUUID {
+		d.DeviceUUIDChanged = true
+	}
 	if pg.GCPVersion != pn.GCPVersion {
 		if pg.GCPVersion > pn.GCPVersion {
 			panic("GCP version cannot be downgraded; delete GCP printers")
@@ -222,7 +246,7 @@ func diffPrinter(pn, pg *Printer) PrinterDiff {
 	}
 
 	if d.DefaultDisplayNameChanged || d.ManufacturerChanged || d.ModelChanged ||
-		d.GCPVersionChanged || d.SetupURLChanged || d.SupportURLChanged ||
+		d.SerialNumberChanged || d.DeviceUUIDChanged || d.GCPVersionChanged || d.SetupURLChanged || d.SupportURLChanged ||
 		d.UpdateURLChanged || d.ConnectorVersionChanged || d.StateChanged ||
 		d.DescriptionChanged || d.CapsHashChanged || d.TagsChanged ||
 		d.DuplexMapChanged || d.QuotaEnabledChanged || d.DailyQuotaChanged ||
@@ -0,0 +1,38 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PrintServerName normalizes the name of a print server, such as PRINTSRV01
+// or \\PRINTSRV01, to \\PRINTSRV01, as the spooler names it; empty stays
+// empty, for the local spooler.
+func PrintServerName(name string) (string, error) {
+	host := strings.TrimPrefix(name, `\\`)
+	if name == "" {
+		return "", nil
+	}
+	if host == "" || strings.ContainsAny(host, `\/`) {
+		return "", fmt.Errorf("invalid print server %q, expected \\\\server", name)
+	}
+	return `\\` + host, nil
+}
+
+// PrinterPath names a printer of a print server as the spooler does, such as
+// \\PRINTSRV01\Office for Office. Names already of a server are kept, and so
+// are all names without a server.
+func PrinterPath(server, printerName string) string {
+	if server == "" || printerName == "" || strings.HasPrefix(printerName, `\\`) {
+		return printerName
+	}
+	return server + `\` + printerName
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import "testing"
+
+func TestPrintServerName(t *testing.T) {
+	for name, expected := range map[string]string{"": "", "PRINTSRV01": `\\PRINTSRV01`, `\\PRINTSRV01`: `\\PRINTSRV01`} {
+		if server, err := PrintServerName(name); err != nil || server != expected {
+			t.Errorf("expected %q for %q, got %q %v", expected, name, server, err)
+		}
+	}
+	for _, name := range []string{`\\`, `\\PRINTSRV01\Office`, "a/b"} {
+		if _, err := PrintServerName(name); err == nil {
+			t.Errorf("expected %q to be invalid", name)
+		}
+	}
+}
+
+func TestPrinterPath(t *testing.T) {
+	if p := PrinterPath(`\\PRINTSRV01`, "Office"); p != `\\PRINTSRV01\Office` {
+		t.Errorf("unexpected path %q", p)
+	}
+	for _, p := range []string{PrinterPath(`\\PRINTSRV01`, `\\OTHER\Office`), PrinterPath("", "Office")} {
+		if p != `\\OTHER\Office` && p != "Office" {
+			t.Errorf("expected the name to be kept, got %q", p)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+const oneDay = 24 * time.Hour
+
+// PrintWindow is the time of day a printer prints jobs, in local time, e.g.
+// 06:00 to 22:00. Jobs submitted outside of it are held until it opens. A
+// window whose End is before its Start spans midnight.
+type PrintWindow struct {
+	// Since midnight; Start is included and End is not.
+	Start, End time.Duration
+}
+
+// ParsePrintWindow parses a window such as "06:00-22:00" or "22:00-06:00".
+func ParsePrintWindow(s string) (*PrintWindow, error) {
+	var startHour, startMinute, endHour, endMinute int
+	var rest string
+	n, _ := fmt.Sscanf(s, "%d:%d-%d:%d%s", &startHour, &startMinute, &endHour, &endMinute, &rest)
+	if n != 4 {
+		return nil, fmt.Errorf("invalid print window %q, expected HH:MM-HH:MM", s)
+	}
+	for _, t := range [][2]int{{startHour, startMinute}, {endHour, endMinute}} {
+		if t[0] < 0 || t[0] > 24 || t[1] < 0 || t[1] > 59 || t[0] == 24 && t[1] != 0 {
+			return nil, fmt.Errorf("invalid time of day %02d:%02d in print window %q", t[0], t[1], s)
+		}
+	}
+	w := PrintWindow{
+		Start: time.Duration(startHour)*time.Hour + time.Duration(startMinute)*time.Minute,
+		End:   time.Duration(endHour)*time.Hour + time.Duration(endMinute)*time.Minute,
+	}
+	if w.Start == w.End || w.Start == oneDay && w.End == 0 || w.Start == 0 && w.End == oneDay {
+		return nil, fmt.Errorf("print window %q is always open or never, leave it out", s)
+	}
+	w.Start %= oneDay
+	w.End %= oneDay
+	return &w, nil
+}
+
+func (w *PrintWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return format(w.Start) + "-" + format(w.End)
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	year, month, day := t.Date()
+	return t.Sub(time.Date(year, month, day, 0, 0, 0, 0, t.Location()))
+}
+
+// Contains tells whether the window is open at t.
+func (w *PrintWindow) Contains(t time.Time) bool {
+	d := sinceMidnight(t)
+	if w.Start < w.End {
+		return w.Start <= d && d < w.End
+	}
+	return w.Start <= d || d < w.End
+}
+
+// NextOpen returns when the window opens after t, or t when it is open.
+func (w *PrintWindow) NextOpen(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	year, month, day := t.Date()
+	open := time.Date(year, month, day, 0, 0, 0, 0, t.Location()).Add(w.Start)
+	if !open.After(t) {
+		open = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location()).Add(w.Start)
+	}
+	return open
+}
+
+// UTCMinutes returns the window in minutes since midnight UTC, as the
+// StartTime and UntilTime of spooler jobs are, with the UTC offset of t.
+func (w *PrintWindow) UTCMinutes(t time.Time) (start, until uint32) {
+	_, offset := t.Zone()
+	toUTC := func(d time.Duration) uint32 {
+		d = (d - time.Duration(offset)*time.Second) % oneDay
+		if d < 0 {
+			d += oneDay
+		}
+		return uint32(d / time.Minute)
+	}
+	return toUTC(w.Start), toUTC(w.End)
+}
+
+// HoldWindow returns the window that holds a job submitted at now until
+// until, to the minute: it opens at until and closes at the time of day of
+// now. It is nil when until isn't ahead of now. The spooler holds jobs by
+// time of day, so jobs can't be held for a day or longer; the job queue of
+// the daemon holds them as long as needed.
+func HoldWindow(until, now time.Time) (*PrintWindow, error) {
+	if !until.After(now) {
+		return nil, nil
+	}
+	// Rounded so that the job never prints before until.
+	start, end := until.Truncate(time.Minute), now.Truncate(time.Minute)
+	if start.Before(until) {
+		start = start.Add(time.Minute)
+	}
+	if start.Sub(end) >= oneDay {
+		return nil, fmt.Errorf("jobs can be held for less than a day, not until %s; submit the job to the daemon with a job_queue_dir to hold it longer", until.Format(time.RFC3339))
+	}
+	return &PrintWindow{Start: sinceMidnight(start.In(now.Location())), End: sinceMidnight(end)}, nil
+}
+
+// JobWindow returns the window a job is held outside of: the hold window
+// of the hold_until of its ticket, which takes the place of the print
+// window of the printer, or else that print window.
+func JobWindow(printerWindow *PrintWindow, ticket *model.JobTicket, now time.Time) (*PrintWindow, error) {
+	if ticket == nil || ticket.HoldUntil == nil {
+		return printerWindow, nil
+	}
+	window, err := HoldWindow(ticket.HoldUntil.Time, now)
+	if err != nil || window != nil {
+		return window, err
+	}
+	return printerWindow, nil
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestParsePrintWindow(t *testing.T) {
+	for _, s := range []string{"06:00-22:00", "22:30-06:00", "00:00-12:00"} {
+		w, err := ParsePrintWindow(s)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if w.String() != s {
+			t.Errorf("expected %s got %s", s, w)
+		}
+	}
+	if w, err := ParsePrintWindow("08:00-24:00"); err != nil || w.End != 0 {
+		t.Errorf("expected 24:00 to be midnight got %v, %v", w, err)
+	}
+	for _, s := range []string{"", "06:00", "6-22", "06:00-22:00 daily", "25:00-06:00", "06:60-22:00", "08:00-08:00", "00:00-24:00"} {
+		if _, err := ParsePrintWindow(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestPrintWindowContains(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2021, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+	day, _ := ParsePrintWindow("06:00-22:00")
+	night, _ := ParsePrintWindow("22:00-06:00")
+	for _, c := range []struct {
+		t          time.Time
+		day, night bool
+	}{
+		{at(5, 59), false, true},
+		{at(6, 0), true, false},
+		{at(12, 0), true, false},
+		{at(21, 59), true, false},
+		{at(22, 0), false, true},
+		{at(0, 0), false, true},
+	} {
+		if day.Contains(c.t) != c.day || night.Contains(c.t) != c.night {
+			t.Errorf("at %s expected day %t night %t", c.t.Format("15:04"), c.day, c.night)
+		}
+	}
+
+	if open := day.NextOpen(at(23, 0)); !open.Equal(time.Date(2021, 3, 11, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the window to open the next morning got %s", open)
+	}
+	if open := day.NextOpen(at(4, 0)); !open.Equal(at(6, 0)) {
+		t.Errorf("expected the window to open at 06:00 got %s", open)
+	}
+	if open := night.NextOpen(at(1, 0)); !open.Equal(at(1, 0)) {
+		t.Errorf("expected an open window to open now got %s", open)
+	}
+}
+
+func TestPrintWindowUTCMinutes(t *testing.T) {
+	w, _ := ParsePrintWindow("06:00-22:00")
+	tokyo := time.Date(2021, 3, 10, 12, 0, 0, 0, time.FixedZone("JST", 9*60*60))
+	if start, until := w.UTCMinutes(tokyo); start != 21*60 || until != 13*60 {
+		t.Errorf("expected 21:00-13:00 UTC got %d-%d minutes", start, until)
+	}
+	newYork := time.Date(2021, 3, 10, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	if start, until := w.UTCMinutes(newYork); start != 11*60 || until != 3*60 {
+		t.Errorf("expected 11:00-03:00 UTC got %d-%d minutes", start, until)
+	}
+}
+
+func TestHoldWindow(t *testing.T) {
+	now := time.Date(2021, 3, 10, 14, 30, 20, 0, time.UTC)
+	w, err := HoldWindow(time.Date(2021, 3, 10, 22, 0, 30, 0, time.UTC), now)
+	if err != nil || w.String() != "22:01-14:30" {
+		t.Errorf("expected 22:01-14:30 got %v, %v", w, err)
+	}
+	if w.Contains(now) || !w.Contains(now.Add(7*time.Hour+31*time.Minute)) {
+		t.Errorf("expected the job to be held until 22:01")
+	}
+	if w, err = HoldWindow(time.Date(2021, 3, 11, 6, 0, 0, 0, time.UTC), now); err != nil || w.String() != "06:00-14:30" {
+		t.Errorf("expected 06:00-14:30 the next morning got %v, %v", w, err)
+	}
+	if w, err = HoldWindow(now.Add(-time.Minute), now); w != nil || err != nil {
+		t.Errorf("expected no window for a time past got %v, %v", w, err)
+	}
+	if _, err = HoldWindow(now.Add(oneDay), now); err == nil {
+		t.Error("expected an error for a day ahead")
+	}
+
+	printerWindow, _ := ParsePrintWindow("06:00-22:00")
+	ticket := &model.JobTicket{HoldUntil: &model.HoldUntilTicketItem{Time: now.Add(time.Hour)}}
+	if w, _ = JobWindow(printerWindow, ticket, now); w.String() != "15:31-14:30" {
+		t.Errorf("expected the hold to replace the print window got %v", w)
+	}
+	ticket.HoldUntil.Time = now.Add(-time.Hour)
+	if w, _ = JobWindow(printerWindow, ticket, now); w != printerWindow {
+		t.Errorf("expected the print window once the hold is past got %v", w)
+	}
+}
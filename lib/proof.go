@@ -0,0 +1,84 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+)
+
+// ProofFormat is the file format soft proofs are written in.
+type ProofFormat string
+
+const (
+	// One PDF, with a page per sheet side.
+	ProofFormatPDF ProofFormat = "pdf"
+	// One PNG per sheet side, named as ProofPageFileName.
+	ProofFormatPNG ProofFormat = "png"
+)
+
+// ProofFormatFromPath returns the format of a proof written to path, from
+// its extension.
+func ProofFormatFromPath(path string) (ProofFormat, error) {
+	switch format := ProofFormat(strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))); format {
+	case ProofFormatPDF, ProofFormatPNG:
+		return format, nil
+	}
+	return "", fmt.Errorf("%s: proofs are written as .pdf or .png", path)
+}
+
+// ProofPageFileName returns the file a PNG proof of path has sheet side n
+// in, from 1: invoice.png has invoice-1.png, invoice-2.png and so on.
+func ProofPageFileName(path string, n int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(path, ext), n, ext)
+}
+
+// GrayBGRX converts pixels stored as B, G, R and an unused byte, as in
+// Cairo RGB24 image surfaces, to gray in place, the way monochrome jobs
+// come out of the printer.
+func GrayBGRX(data []byte, stride, width, height int) {
+	for y := 0; y < height; y++ {
+		row := data[y*stride : y*stride+width*4]
+		for x := 0; x < width*4; x += 4 {
+			v := luma(row[x+2], row[x+1], row[x])
+			row[x], row[x+1], row[x+2] = v, v, v
+		}
+	}
+}
+
+// BGRXImage copies pixels stored as B, G, R and an unused byte into an
+// image, gray when gray is set.
+func BGRXImage(data []byte, stride, width, height int, gray bool) image.Image {
+	if gray {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			row, pix := data[y*stride:], img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				pix[x] = luma(row[x*4+2], row[x*4+1], row[x*4])
+			}
+		}
+		return img
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		row, pix := data[y*stride:], img.Pix[y*img.Stride:]
+		for x := 0; x < width; x++ {
+			pix[x*4], pix[x*4+1], pix[x*4+2], pix[x*4+3] = row[x*4+2], row[x*4+1], row[x*4], 0xff
+		}
+	}
+	return img
+}
+
+// luma weighs colors as color.GrayModel does.
+func luma(r, g, b byte) byte {
+	return byte((19595*uint32(r) + 38470*uint32(g) + 7471*uint32(b) + 1<<15) >> 16)
+}
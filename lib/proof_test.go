@@ -0,0 +1,49 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestProofFormat(t *testing.T) {
+	for path, expected := range map[string]ProofFormat{"proof.pdf": ProofFormatPDF, `C:\out\Proof.PNG`: ProofFormatPNG} {
+		if format, err := ProofFormatFromPath(path); err != nil || format != expected {
+			t.Errorf("%s: expected %s got %s (%v)", path, expected, format, err)
+		}
+	}
+	if _, err := ProofFormatFromPath("proof.tiff"); err == nil {
+		t.Error("expected an error for a .tiff proof")
+	}
+	if name := ProofPageFileName(`out\invoice.png`, 2); name != `out\invoice-2.png` {
+		t.Errorf("unexpected page file name %s", name)
+	}
+}
+
+func TestBGRXImage(t *testing.T) {
+	// 2x1 pixels, pure red then white, with a padded stride.
+	data := []byte{0, 0, 0xff, 0, 0xff, 0xff, 0xff, 0, 9, 9, 9, 9}
+	img := BGRXImage(data, 12, 2, 1, false).(*image.RGBA)
+	if c := img.RGBAAt(0, 0); c != (color.RGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("expected red got %v", c)
+	}
+
+	red := color.GrayModel.Convert(color.RGBA{0xff, 0, 0, 0xff}).(color.Gray).Y
+	gray := BGRXImage(data, 12, 2, 1, true).(*image.Gray)
+	if gray.GrayAt(0, 0).Y != red || gray.GrayAt(1, 0).Y != 0xff {
+		t.Errorf("expected %d and 255 got %v", red, gray.Pix)
+	}
+
+	GrayBGRX(data, 12, 2, 1)
+	if data[0] != red || data[1] != red || data[2] != red || data[4] != 0xff || data[8] != 9 {
+		t.Errorf("expected gray pixels and untouched padding got %v", data)
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrQuotaExceeded is wrapped by the errors of jobs refused because the
+// user or printer would print more pages today than their quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaConfig limits the pages printed a day, from midnight local time, as
+// recorded in the accounting database. Zero is unlimited.
+type QuotaConfig struct {
+	// Pages each user can print a day, unless listed in Users.
+	UserPagesPerDay int `json:"user_pages_per_day,omitempty"`
+	// Pages a day of users, by user name, as in JOB_INFO_2; zero exempts
+	// the user from UserPagesPerDay.
+	Users map[string]int `json:"users,omitempty"`
+	// Pages a day of printers, by native printer name.
+	Printers map[string]int `json:"printers,omitempty"`
+}
+
+func (c *QuotaConfig) Validate() error {
+	if c.UserPagesPerDay < 0 {
+		return errors.New("user_pages_per_day must not be negative")
+	}
+	for user, pages := range c.Users {
+		if pages < 0 {
+			return fmt.Errorf("quota of user %s must not be negative", user)
+		}
+	}
+	for printer, pages := range c.Printers {
+		if pages < 0 {
+			return fmt.Errorf("quota of printer %s must not be negative", printer)
+		}
+	}
+	return nil
+}
+
+// userLimit returns the pages a day of a user; user names are compared
+// without case, as Windows does.
+func (c *QuotaConfig) userLimit(user string) int {
+	for name, pages := range c.Users {
+		if strings.EqualFold(name, user) {
+			return pages
+		}
+	}
+	return c.UserPagesPerDay
+}
+
+// QuotaError reports a job that would exceed a quota.
+type QuotaError struct {
+	// "user" or "printer".
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Limit int    `json:"limit"`
+	// Pages printed today, and pages of the job.
+	Used  int `json:"used"`
+	Pages int `json:"pages"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s: %s %s has printed %d of %d pages today, the job has %d", ErrQuotaExceeded, e.Kind, e.Name, e.Used, e.Limit, e.Pages)
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Quotas checks jobs against a quota config, with the pages printed today
+// read from an accounting database. Jobs are counted once recorded, so
+// jobs still printing aren't.
+type Quotas struct {
+	config QuotaConfig
+	db     *AccountingDB
+	now    func() time.Time
+}
+
+func NewQuotas(config QuotaConfig, db *AccountingDB) *Quotas {
+	return &Quotas{config: config, db: db, now: time.Now}
+}
+
+// Limits tells whether the jobs of user on printer have a quota, so that
+// callers only count pages when needed.
+func (q *Quotas) Limits(user, printer string) bool {
+	return q.config.userLimit(user) > 0 || q.config.Printers[printer] > 0
+}
+
+// Check returns a *QuotaError when a job of pages pages by user on printer
+// would exceed a quota; jobs of unknown size, with zero pages, are only
+// refused once the quota is used up.
+func (q *Quotas) Check(user, printer string, pages int) error {
+	userLimit, printerLimit := q.config.userLimit(user), q.config.Printers[printer]
+	if userLimit <= 0 && printerLimit <= 0 {
+		return nil
+	}
+	now := q.now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	records, err := q.db.Records(midnight, time.Time{})
+	if err != nil {
+		return fmt.Errorf("failed to read the pages printed today: %s", err)
+	}
+	var userUsed, printerUsed int
+	for i := range records {
+		r := &records[i]
+		if strings.EqualFold(r.User, user) {
+			userUsed += r.Pages()
+		}
+		if r.Printer == printer {
+			printerUsed += r.Pages()
+		}
+	}
+	exceeds := func(limit, used int) bool {
+		return limit > 0 && (used+pages > limit || used >= limit)
+	}
+	if exceeds(userLimit, userUsed) {
+		return &QuotaError{Kind: "user", Name: user, Limit: userLimit, Used: userUsed, Pages: pages}
+	}
+	if exceeds(printerLimit, printerUsed) {
+		return &QuotaError{Kind: "printer", Name: printer, Limit: printerLimit, Used: printerUsed, Pages: pages}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestQuotas(t *testing.T) {
+	db, err := OpenAccountingDB(filepath.Join(t.TempDir(), "jobs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 15, 0, 0, 0, time.Local)
+	for _, r := range []AccountingRecord{
+		{Time: now.AddDate(0, 0, -1), JobInfo: JobInfo{Printer: "office", User: "alice", PagesPrinted: 50}, State: model.JobStateDone},
+		{Time: now.Add(-time.Hour), JobInfo: JobInfo{Printer: "office", User: "alice", PagesPrinted: 8}, State: model.JobStateDone},
+		{Time: now.Add(-time.Hour), JobInfo: JobInfo{Printer: "office", User: "bob", PagesPrinted: 30}, State: model.JobStateDone},
+	} {
+		if err := db.Record(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := QuotaConfig{UserPagesPerDay: 10, Users: map[string]int{"bob": 100, "dave": 0}, Printers: map[string]int{"office": 40}}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	q := NewQuotas(config, db)
+	q.now = func() time.Time { return now }
+
+	if !q.Limits("carol", "lobby") || q.Limits("dave", "lobby") {
+		t.Error("expected carol to have a quota on lobby, and dave none")
+	}
+	if err := q.Check("ALICE", "lobby", 2); err != nil {
+		t.Errorf("expected 2 more pages of alice to be within quota, got %v", err)
+	}
+	var quotaErr *QuotaError
+	if err := q.Check("alice", "lobby", 3); !errors.As(err, &quotaErr) || !errors.Is(err, ErrQuotaExceeded) || quotaErr.Kind != "user" || quotaErr.Used != 8 {
+		t.Errorf("expected alice's quota to be exceeded, got %v", err)
+	}
+	if err := q.Check("bob", "office", 3); !errors.As(err, &quotaErr) || quotaErr.Kind != "printer" || quotaErr.Used != 38 {
+		t.Errorf("expected office's quota to be exceeded, got %v", err)
+	}
+	if err := q.Check("bob", "office", 0); err != nil {
+		t.Errorf("expected a job of unknown size within quota, got %v", err)
+	}
+
+	if err := (&QuotaConfig{Printers: map[string]int{"office": -1}}).Validate(); err == nil {
+		t.Error("expected a negative quota to be invalid")
+	}
+}
@@ -0,0 +1,368 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Content types of the raster formats sent by driverless (IPP Everywhere,
+// AirPrint) clients.
+const (
+	ContentTypePWGRaster = "image/pwg-raster"
+	ContentTypeURF       = "image/urf"
+)
+
+var (
+	pwgRasterSyncWord = []byte("RaS2")
+	urfSyncWord       = []byte("UNIRAST\x00")
+)
+
+const (
+	pwgRasterHeaderSize = 1796
+	urfPageHeaderSize   = 32
+
+	// Decoded pages are held in memory; refuse pages larger than this.
+	maxRasterPageBytes = 1 << 30
+)
+
+// IsRaster reports whether data starts with a PWG Raster or URF sync word.
+func IsRaster(data []byte) bool {
+	return bytes.HasPrefix(data, pwgRasterSyncWord) || bytes.HasPrefix(data, urfSyncWord)
+}
+
+type rasterColor int
+
+const (
+	rasterGray  rasterColor = iota // 0 is black.
+	rasterBlack                    // 0 is white.
+	rasterRGB
+	rasterCMYK
+)
+
+var pwgRasterColors = map[uint32]rasterColor{
+	0:  rasterGray,  // W
+	1:  rasterRGB,   // RGB
+	3:  rasterBlack, // K
+	6:  rasterCMYK,  // CMYK
+	18: rasterGray,  // sGray
+	19: rasterRGB,   // sRGB
+	20: rasterRGB,   // AdobeRGB
+}
+
+var urfColors = map[byte]rasterColor{
+	0: rasterGray, // sGray
+	1: rasterRGB,  // sRGB
+	3: rasterRGB,  // AdobeRGB
+	4: rasterGray, // W
+	5: rasterRGB,  // RGB
+	6: rasterCMYK, // CMYK
+}
+
+// RasterPage is a decoded page of a raster document.
+type RasterPage struct {
+	XDPI, YDPI int
+
+	// *image.Gray, *image.RGBA or *image.CMYK.
+	Image image.Image
+}
+
+// RasterDecoder reads PWG Raster (PWG 5102.4) and Apple Raster (URF)
+// documents, one page at a time.
+type RasterDecoder struct {
+	// Limits are checked against each page header, before decoding.
+	Limits RenderLimits
+
+	r   *bufio.Reader
+	urf bool
+}
+
+// NewRasterDecoder reads the sync word of a raster document.
+func NewRasterDecoder(r io.Reader) (*RasterDecoder, error) {
+	d := RasterDecoder{r: bufio.NewReader(r)}
+
+	syncWord, err := d.r.Peek(len(urfSyncWord))
+	if err != nil && !bytes.HasPrefix(syncWord, pwgRasterSyncWord) {
+		return nil, errors.New("not a PWG Raster or URF document")
+	}
+	switch {
+	case bytes.HasPrefix(syncWord, pwgRasterSyncWord):
+		d.r.Discard(len(pwgRasterSyncWord))
+	case bytes.Equal(syncWord, urfSyncWord):
+		// The sync word is followed by the page count, which may be zero
+		// when streaming, so don't rely on it.
+		if _, err = d.r.Discard(len(urfSyncWord) + 4); err != nil {
+			return nil, fmt.Errorf("truncated URF header: %s", err)
+		}
+		d.urf = true
+	default:
+		return nil, errors.New("not a PWG Raster or URF document")
+	}
+
+	return &d, nil
+}
+
+type rasterPageHeader struct {
+	width, height   uint32
+	bitsPerColor    uint32
+	bitsPerPixel    uint32
+	color           rasterColor
+	xDPI, yDPI      uint32
+	bytesPerLine    int
+	bytesPerPixel   int
+	whiteByte       byte
+	colorComponents int
+}
+
+// NextPage decodes the next page. Returns io.EOF after the last page.
+func (d *RasterDecoder) NextPage() (*RasterPage, error) {
+	var header *rasterPageHeader
+	var err error
+	if d.urf {
+		header, err = d.readURFHeader()
+	} else {
+		header, err = d.readPWGRasterHeader()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = d.Limits.CheckImage(int(header.width), int(header.height)); err != nil {
+		return nil, err
+	}
+
+	img, err := d.readPixels(header)
+	if err != nil {
+		return nil, err
+	}
+	return &RasterPage{XDPI: int(header.xDPI), YDPI: int(header.yDPI), Image: img}, nil
+}
+
+func (d *RasterDecoder) readFullHeader(size int) ([]byte, error) {
+	b := make([]byte, size)
+	n, err := io.ReadFull(d.r, b)
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("truncated raster page header: %s", err)
+	}
+	return b, nil
+}
+
+func (d *RasterDecoder) readPWGRasterHeader() (*rasterPageHeader, error) {
+	b, err := d.readFullHeader(pwgRasterHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	u32 := func(offset int) uint32 { return binary.BigEndian.Uint32(b[offset:]) }
+
+	if colorOrder := u32(396); colorOrder != 0 {
+		return nil, fmt.Errorf("unsupported PWG Raster color order %d", colorOrder)
+	}
+	colorSpace := u32(400)
+	color, ok := pwgRasterColors[colorSpace]
+	if !ok {
+		return nil, fmt.Errorf("unsupported PWG Raster color space %d", colorSpace)
+	}
+	return newRasterPageHeader(u32(372), u32(376), u32(384), u32(388), color, u32(276), u32(280))
+}
+
+func (d *RasterDecoder) readURFHeader() (*rasterPageHeader, error) {
+	b, err := d.readFullHeader(urfPageHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	u32 := func(offset int) uint32 { return binary.BigEndian.Uint32(b[offset:]) }
+
+	color, ok := urfColors[b[1]]
+	if !ok {
+		return nil, fmt.Errorf("unsupported URF color space %d", b[1])
+	}
+	bitsPerPixel := uint32(b[0])
+	components := uint32(1)
+	switch color {
+	case rasterRGB:
+		components = 3
+	case rasterCMYK:
+		components = 4
+	}
+	dpi := u32(20)
+	return newRasterPageHeader(u32(12), u32(16), bitsPerPixel/components, bitsPerPixel, color, dpi, dpi)
+}
+
+func newRasterPageHeader(width, height, bitsPerColor, bitsPerPixel uint32, color rasterColor, xDPI, yDPI uint32) (*rasterPageHeader, error) {
+	h := rasterPageHeader{
+		width:        width,
+		height:       height,
+		bitsPerColor: bitsPerColor,
+		bitsPerPixel: bitsPerPixel,
+		color:        color,
+		xDPI:         xDPI,
+		yDPI:         yDPI,
+	}
+
+	switch color {
+	case rasterGray, rasterBlack:
+		h.colorComponents = 1
+	case rasterRGB:
+		h.colorComponents = 3
+	case rasterCMYK:
+		h.colorComponents = 4
+	}
+	if color == rasterGray || color == rasterRGB {
+		h.whiteByte = 0xff
+	}
+
+	switch {
+	case bitsPerColor == 1 && h.colorComponents == 1 && bitsPerPixel == 1:
+	case (bitsPerColor == 8 || bitsPerColor == 16) && bitsPerPixel == bitsPerColor*uint32(h.colorComponents):
+	default:
+		return nil, fmt.Errorf("unsupported raster format, %d bits per color and %d bits per pixel", bitsPerColor, bitsPerPixel)
+	}
+
+	if width == 0 || height == 0 {
+		return nil, fmt.Errorf("invalid raster page size %dx%d", width, height)
+	}
+	if uint64(width)*uint64(height)*4 > maxRasterPageBytes {
+		return nil, fmt.Errorf("raster page too large, %dx%d", width, height)
+	}
+	if xDPI == 0 || yDPI == 0 {
+		return nil, fmt.Errorf("invalid raster resolution %dx%d", xDPI, yDPI)
+	}
+
+	h.bytesPerLine = int((uint64(width)*uint64(bitsPerPixel) + 7) / 8)
+	h.bytesPerPixel = int(bitsPerPixel / 8)
+	if h.bytesPerPixel == 0 {
+		h.bytesPerPixel = 1
+	}
+	return &h, nil
+}
+
+func (d *RasterDecoder) readPixels(h *rasterPageHeader) (image.Image, error) {
+	rect := image.Rect(0, 0, int(h.width), int(h.height))
+	var img image.Image
+	var setRow func(y int, line []byte)
+
+	switch h.color {
+	case rasterGray, rasterBlack:
+		gray := image.NewGray(rect)
+		img = gray
+		setRow = func(y int, line []byte) {
+			row := gray.Pix[y*gray.Stride : y*gray.Stride+int(h.width)]
+			for x := range row {
+				var v byte
+				switch h.bitsPerColor {
+				case 1:
+					// 1 is ink for K, light for W.
+					if line[x/8]&(0x80>>uint(x%8)) != 0 {
+						v = 0xff
+					}
+				case 8:
+					v = line[x]
+				case 16:
+					v = line[x*2]
+				}
+				if h.color == rasterBlack {
+					v = 0xff - v
+				}
+				row[x] = v
+			}
+		}
+
+	case rasterRGB:
+		rgba := image.NewRGBA(rect)
+		img = rgba
+		setRow = func(y int, line []byte) {
+			row := rgba.Pix[y*rgba.Stride : y*rgba.Stride+int(h.width)*4]
+			step := int(h.bitsPerColor / 8)
+			for x := 0; x < int(h.width); x++ {
+				for c := 0; c < 3; c++ {
+					row[x*4+c] = line[(x*3+c)*step]
+				}
+				row[x*4+3] = 0xff
+			}
+		}
+
+	case rasterCMYK:
+		cmyk := image.NewCMYK(rect)
+		img = cmyk
+		setRow = func(y int, line []byte) {
+			row := cmyk.Pix[y*cmyk.Stride : y*cmyk.Stride+int(h.width)*4]
+			step := int(h.bitsPerColor / 8)
+			for i := range row {
+				row[i] = line[i*step]
+			}
+		}
+	}
+
+	line := make([]byte, h.bytesPerLine)
+	for y := 0; y < int(h.height); {
+		repeat, err := d.r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("truncated raster data at line %d: %s", y, err)
+		}
+		if err = d.readLine(h, line); err != nil {
+			return nil, fmt.Errorf("invalid raster data at line %d: %s", y, err)
+		}
+		for i := 0; i <= int(repeat) && y < int(h.height); i++ {
+			setRow(y, line)
+			y++
+		}
+	}
+	return img, nil
+}
+
+// readLine decodes one line of the PackBits-like compression shared by PWG
+// Raster and URF.
+func (d *RasterDecoder) readLine(h *rasterPageHeader, line []byte) error {
+	for x := 0; x < len(line); {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		if c == 128 {
+			// The rest of the line is white.
+			for ; x < len(line); x++ {
+				line[x] = h.whiteByte
+			}
+			return nil
+		}
+
+		if c < 128 {
+			n := (int(c) + 1) * h.bytesPerPixel
+			if x+n > len(line) {
+				return errors.New("pixel run past end of line")
+			}
+			if _, err = io.ReadFull(d.r, line[x:x+h.bytesPerPixel]); err != nil {
+				return err
+			}
+			for i := h.bytesPerPixel; i < n; i++ {
+				line[x+i] = line[x+i-h.bytesPerPixel]
+			}
+			x += n
+		} else {
+			n := (257 - int(c)) * h.bytesPerPixel
+			if x+n > len(line) {
+				return errors.New("literal pixels past end of line")
+			}
+			if _, err = io.ReadFull(d.r, line[x:x+n]); err != nil {
+				return err
+			}
+			x += n
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+	"testing"
+)
+
+func TestDecodePWGRaster(t *testing.T) {
+	header := make([]byte, pwgRasterHeaderSize)
+	put := func(offset int, v uint32) { binary.BigEndian.PutUint32(header[offset:], v) }
+	put(276, 300) // HWResolution
+	put(280, 300)
+	put(372, 4)  // Width
+	put(376, 3)  // Height
+	put(384, 8)  // BitsPerColor
+	put(388, 8)  // BitsPerPixel
+	put(392, 4)  // BytesPerLine
+	put(400, 18) // sGray
+
+	var doc bytes.Buffer
+	doc.Write(pwgRasterSyncWord)
+	doc.Write(header)
+	// Two lines: 0x10 repeated twice, then two literal pixels.
+	doc.Write([]byte{0x01, 0x01, 0x10, 0xff, 0x20, 0x30})
+	// One line: 0x40, then white.
+	doc.Write([]byte{0x00, 0x00, 0x40, 0x80})
+
+	d, err := NewRasterDecoder(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := d.NextPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.XDPI != 300 || page.YDPI != 300 {
+		t.Errorf("expected 300x300 DPI got %dx%d", page.XDPI, page.YDPI)
+	}
+	expected := []byte{
+		0x10, 0x10, 0x20, 0x30,
+		0x10, 0x10, 0x20, 0x30,
+		0x40, 0xff, 0xff, 0xff,
+	}
+	if got := page.Image.(*image.Gray).Pix; !bytes.Equal(expected, got) {
+		t.Errorf("expected %x got %x", expected, got)
+	}
+
+	if _, err = d.NextPage(); err != io.EOF {
+		t.Errorf("expected EOF got %v", err)
+	}
+}
+
+func TestDecodeURF(t *testing.T) {
+	header := make([]byte, urfPageHeaderSize)
+	header[0] = 24 // Bits per pixel
+	header[1] = 1  // sRGB
+	binary.BigEndian.PutUint32(header[12:], 2)
+	binary.BigEndian.PutUint32(header[16:], 1)
+	binary.BigEndian.PutUint32(header[20:], 600)
+
+	var doc bytes.Buffer
+	doc.Write(urfSyncWord)
+	doc.Write([]byte{0, 0, 0, 1})
+	doc.Write(header)
+	doc.Write([]byte{0x00, 0x01, 0xff, 0x00, 0x00})
+
+	if !IsRaster(doc.Bytes()) {
+		t.Fatal("URF not detected")
+	}
+	d, err := NewRasterDecoder(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := d.NextPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0xff, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0xff}
+	if got := page.Image.(*image.RGBA).Pix; !bytes.Equal(expected, got) {
+		t.Errorf("expected %x got %x", expected, got)
+	}
+
+	if _, err = NewRasterDecoder(bytes.NewReader([]byte("%PDF-1.4"))); err == nil {
+		t.Error("expected error for PDF")
+	}
+}
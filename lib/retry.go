@@ -0,0 +1,111 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Defaults of RetryPolicy: five calls in all, waiting about 0.5s, 1s, 2s
+// and 4s in between, which outlasts a restart of the spooler service.
+const (
+	DefaultRetryAttempts     = 5
+	DefaultRetryInitialDelay = 500 * time.Millisecond
+	DefaultRetryMaxDelay     = 10 * time.Second
+)
+
+// IsTransientSpoolerError tells whether a spooler call may succeed when made
+// again: while the spooler service restarts, calls fail with
+// RPC_S_SERVER_UNAVAILABLE, and handles opened before fail afterwards.
+func IsTransientSpoolerError(err error) bool {
+	return errors.Is(err, ErrSpoolerUnavailable) || errors.Is(err, ErrInvalidHandle)
+}
+
+// RetryPolicy retries spooler calls that fail with transient errors, with
+// an exponential backoff. The zero policy retries with the defaults.
+type RetryPolicy struct {
+	// Calls made in all, DefaultRetryAttempts when zero; 1 doesn't retry.
+	Attempts int
+	// Wait before the first retry, doubled for each following one up to
+	// MaxDelay, and randomized like Backoff. The defaults when zero.
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+
+	// Waits between calls; time.Sleep when nil.
+	sleep func(time.Duration)
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't transient,
+// or the attempts are used up, and returns its last error. Retries are
+// logged as retries of op, such as "OpenPrinter Office".
+func (p RetryPolicy) Do(op string, fn func() error) error {
+	attempts, delay, maxDelay := p.Attempts, p.InitialDelay, p.MaxDelay
+	if attempts <= 0 {
+		attempts = DefaultRetryAttempts
+	}
+	if delay <= 0 {
+		delay = DefaultRetryInitialDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = DefaultRetryMaxDelay
+	}
+	sleep := p.sleep
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts || !IsTransientSpoolerError(err) {
+			return err
+		}
+		wait := time.Duration((rand.Float64()*(2*randomizationFactor) + (1 - randomizationFactor)) * float64(delay))
+		log.Printf("Retrying %s in %s, attempt %d of %d: %s", op, wait.Round(time.Millisecond), attempt+1, attempts, err)
+		sleep(wait)
+		if delay *= 2; delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+}
+
+// RetryConfig is a RetryPolicy in the config file.
+type RetryConfig struct {
+	Attempts int `json:"attempts,omitempty"`
+	// Durations, such as "500ms".
+	InitialDelay string `json:"initial_delay,omitempty"`
+	MaxDelay     string `json:"max_delay,omitempty"`
+}
+
+// Policy parses the config; the zero policy for a nil config.
+func (c *RetryConfig) Policy() (RetryPolicy, error) {
+	var p RetryPolicy
+	if c == nil {
+		return p, nil
+	}
+	if c.Attempts < 0 {
+		return p, fmt.Errorf("negative attempts %d", c.Attempts)
+	}
+	p.Attempts = c.Attempts
+	var err error
+	if c.InitialDelay != "" {
+		if p.InitialDelay, err = time.ParseDuration(c.InitialDelay); err != nil || p.InitialDelay <= 0 {
+			return p, fmt.Errorf("invalid initial_delay %q", c.InitialDelay)
+		}
+	}
+	if c.MaxDelay != "" {
+		if p.MaxDelay, err = time.ParseDuration(c.MaxDelay); err != nil || p.MaxDelay <= 0 {
+			return p, fmt.Errorf("invalid max_delay %q", c.MaxDelay)
+		}
+	}
+	return p, nil
+}
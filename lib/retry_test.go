@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	var waits []time.Duration
+	p := RetryPolicy{InitialDelay: time.Second, MaxDelay: 3 * time.Second, sleep: func(d time.Duration) { waits = append(waits, d) }}
+	unavailable := &Win32Error{Op: "OpenPrinter", Code: 1722, Err: testErrno(1722)}
+
+	calls := 0
+	err := p.Do("OpenPrinter office", func() error {
+		calls++
+		if calls < 3 {
+			return unavailable
+		}
+		return nil
+	})
+	if err != nil || calls != 3 || len(waits) != 2 {
+		t.Fatalf("expected success on the third call, got %v after %d calls", err, calls)
+	}
+	if waits[0] < 500*time.Millisecond || waits[0] >= 1500*time.Millisecond || waits[1] < time.Second || waits[1] >= 3*time.Second {
+		t.Errorf("unexpected waits %v", waits)
+	}
+
+	waits, calls = nil, 0
+	err = p.Do("GetJob", func() error {
+		calls++
+		return unavailable
+	})
+	if !errors.Is(err, ErrSpoolerUnavailable) || calls != DefaultRetryAttempts {
+		t.Errorf("expected %d calls, got %d: %v", DefaultRetryAttempts, calls, err)
+	}
+	// 1s, 2s, then capped at 3s, randomized by half.
+	if len(waits) != DefaultRetryAttempts-1 || waits[3] > 4500*time.Millisecond {
+		t.Errorf("unexpected waits %v", waits)
+	}
+
+	calls = 0
+	denied := fmt.Errorf("cancelling job 7 %w", ErrAdminRequired)
+	if err = p.Do("SetJob", func() error { calls++; return denied }); err != denied || calls != 1 {
+		t.Errorf("expected errors that aren't transient not to be retried, got %d calls", calls)
+	}
+
+	calls = 0
+	p.Attempts = 1
+	if err = p.Do("SetJob", func() error { calls++; return unavailable }); err == nil || calls != 1 {
+		t.Errorf("expected a single call, got %d", calls)
+	}
+}
+
+func TestRetryConfig(t *testing.T) {
+	var c *RetryConfig
+	if p, err := c.Policy(); err != nil || p.Attempts != 0 {
+		t.Errorf("expected the zero policy, got %+v %v", p, err)
+	}
+	c = &RetryConfig{Attempts: 3, InitialDelay: "200ms", MaxDelay: "5s"}
+	if p, err := c.Policy(); err != nil || p.Attempts != 3 || p.InitialDelay != 200*time.Millisecond || p.MaxDelay != 5*time.Second {
+		t.Errorf("unexpected policy %+v %v", p, err)
+	}
+	for _, c := range []RetryConfig{{Attempts: -1}, {InitialDelay: "soon"}, {MaxDelay: "-1s"}} {
+		if _, err := c.Policy(); err == nil {
+			t.Errorf("expected %+v to be invalid", c)
+		}
+	}
+}
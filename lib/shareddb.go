@@ -0,0 +1,45 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// openSharedDB opens a database file that processes take turns at, such as
+// the daemon writing and the CLI reading, waiting a while for the process
+// that has it open. Close it once done, for the others.
+func openSharedDB(name, fileName string) (*bolt.DB, error) {
+	db, err := bolt.Open(fileName, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s %s is busy", name, fileName)
+	}
+	return db, err
+}
+
+// updateSharedDB runs fn in a transaction on a bucket of a shared database
+// file, creating the file and bucket if needed.
+func updateSharedDB(name, fileName string, bucketName []byte, fn func(bucket *bolt.Bucket) error) error {
+	db, err := openSharedDB(name, fileName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(bucketName)
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+}
@@ -0,0 +1,241 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OIDs from the Printer MIB (RFC 3805) and Host Resources MIB (RFC 2790).
+const (
+	SNMPOIDPrtGeneralSerialNumber = "1.3.6.1.2.1.43.5.1.1.17.1"
+	SNMPOIDHrDeviceDescr          = "1.3.6.1.2.1.25.3.2.1.3.1"
+)
+
+const (
+	snmpPort = 161
+
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+
+	snmpGetRequest  = 0xa0
+	snmpGetResponse = 0xa2
+)
+
+// SNMPGetString sends an SNMPv1 GetRequest for oid to host and returns
+// the value as a string, if the agent answered with an OCTET STRING.
+func SNMPGetString(host, community, oid string, timeout time.Duration) (string, error) {
+	requestID := rand.Int31()
+	request, err := encodeSNMPGetRequest(community, oid, requestID)
+	if err != nil {
+		return "", err
+	}
+
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, strconv.Itoa(snmpPort)), timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return "", err
+	}
+	if _, err = conn.Write(request); err != nil {
+		return "", err
+	}
+
+	response := make([]byte, 1500)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", err
+	}
+
+	return decodeSNMPGetResponse(response[:n], requestID)
+}
+
+func encodeSNMPGetRequest(community, oid string, requestID int32) ([]byte, error) {
+	encodedOID, err := berEncodeOID(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	varBind := berTLV(berSequence, append(berTLV(berOID, encodedOID), berTLV(berNull, nil)...))
+	varBindList := berTLV(berSequence, varBind)
+
+	var pdu []byte
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(int64(requestID)))...)
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...) // error-status
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...) // error-index
+	pdu = append(pdu, varBindList...)
+
+	var message []byte
+	message = append(message, berTLV(berInteger, berEncodeInt(0))...) // version-1
+	message = append(message, berTLV(berOctetString, []byte(community))...)
+	message = append(message, berTLV(snmpGetRequest, pdu)...)
+
+	return berTLV(berSequence, message), nil
+}
+
+func decodeSNMPGetResponse(data []byte, requestID int32) (string, error) {
+	message, _, err := berExpect(data, berSequence)
+	if err != nil {
+		return "", err
+	}
+	_, message, err = berExpect(message, berInteger) // version
+	if err != nil {
+		return "", err
+	}
+	_, message, err = berExpect(message, berOctetString) // community
+	if err != nil {
+		return "", err
+	}
+	pdu, _, err := berExpect(message, snmpGetResponse)
+	if err != nil {
+		return "", err
+	}
+
+	id, pdu, err := berExpect(pdu, berInteger)
+	if err != nil {
+		return "", err
+	}
+	if berDecodeInt(id) != int64(requestID) {
+		return "", errors.New("SNMP response has unexpected request ID")
+	}
+	errorStatus, pdu, err := berExpect(pdu, berInteger)
+	if err != nil {
+		return "", err
+	}
+	if status := berDecodeInt(errorStatus); status != 0 {
+		return "", fmt.Errorf("SNMP agent returned error status %d", status)
+	}
+	_, pdu, err = berExpect(pdu, berInteger) // error-index
+	if err != nil {
+		return "", err
+	}
+
+	varBindList, _, err := berExpect(pdu, berSequence)
+	if err != nil {
+		return "", err
+	}
+	varBind, _, err := berExpect(varBindList, berSequence)
+	if err != nil {
+		return "", err
+	}
+	_, varBind, err = berExpect(varBind, berOID)
+	if err != nil {
+		return "", err
+	}
+	value, _, err := berExpect(varBind, berOctetString)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(bytes.TrimRight(value, "\x00"))), nil
+}
+
+// berTLV encodes a single tag-length-value triple.
+func berTLV(tag byte, value []byte) []byte {
+	b := []byte{tag}
+	l := len(value)
+	switch {
+	case l < 0x80:
+		b = append(b, byte(l))
+	case l <= 0xff:
+		b = append(b, 0x81, byte(l))
+	default:
+		b = append(b, 0x82, byte(l>>8), byte(l))
+	}
+	return append(b, value...)
+}
+
+// berExpect reads one TLV with the given tag from data, returning its value
+// and the remaining bytes.
+func berExpect(data []byte, tag byte) ([]byte, []byte, error) {
+	if len(data) < 2 {
+		return nil, nil, errors.New("SNMP response truncated")
+	}
+	if data[0] != tag {
+		return nil, nil, fmt.Errorf("SNMP response has tag 0x%02x, expected 0x%02x", data[0], tag)
+	}
+
+	l, offset := int(data[1]), 2
+	if l&0x80 != 0 {
+		n := l & 0x7f
+		if n == 0 || n > 2 || len(data) < 2+n {
+			return nil, nil, errors.New("SNMP response has invalid length")
+		}
+		l = 0
+		for i := 0; i < n; i++ {
+			l = l<<8 | int(data[2+i])
+		}
+		offset += n
+	}
+	if len(data) < offset+l {
+		return nil, nil, errors.New("SNMP response truncated")
+	}
+
+	return data[offset : offset+l], data[offset+l:], nil
+}
+
+func berEncodeInt(i int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(i)}, b...)
+		if (i >= -0x80 && i < 0x80) || len(b) == 8 {
+			return b
+		}
+		i >>= 8
+	}
+}
+
+func berDecodeInt(b []byte) int64 {
+	var i int64
+	for n, c := range b {
+		if n == 0 && c&0x80 != 0 {
+			i = -1
+		}
+		i = i<<8 | int64(c)
+	}
+	return i
+}
+
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid OID %q", oid)
+	}
+	ids := make([]uint64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OID %q", oid)
+		}
+		ids[i] = id
+	}
+
+	b := []byte{byte(ids[0]*40 + ids[1])}
+	for _, id := range ids[2:] {
+		chunk := []byte{byte(id & 0x7f)}
+		for id >>= 7; id > 0; id >>= 7 {
+			chunk = append([]byte{byte(id&0x7f) | 0x80}, chunk...)
+		}
+		b = append(b, chunk...)
+	}
+	return b, nil
+}
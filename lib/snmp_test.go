@@ -0,0 +1,101 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBEREncodeOID(t *testing.T) {
+	got, err := berEncodeOID("1.3.6.1.2.1.43.5.1.1.17.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x2b, 0x06, 0x01, 0x02, 0x01, 0x2b, 0x05, 0x01, 0x01, 0x11, 0x01}
+	if bytes.Compare(expected, got) != 0 {
+		t.Fatalf("expected %x got %x", expected, got)
+	}
+
+	got, err = berEncodeOID("1.3.6.1.4.1.311")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []byte{0x2b, 0x06, 0x01, 0x04, 0x01, 0x82, 0x37}
+	if bytes.Compare(expected, got) != 0 {
+		t.Fatalf("expected %x got %x", expected, got)
+	}
+
+	if _, err = berEncodeOID("1"); err == nil {
+		t.Fatal("expected error for short OID")
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	for _, i := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 30} {
+		if got := berDecodeInt(berEncodeInt(i)); got != i {
+			t.Errorf("round trip of %d returned %d", i, got)
+		}
+	}
+}
+
+func TestSNMPGetResponse(t *testing.T) {
+	requestID := int32(0x1234)
+	oid, _ := berEncodeOID(SNMPOIDPrtGeneralSerialNumber)
+	varBind := berTLV(berSequence, append(berTLV(berOID, oid), berTLV(berOctetString, []byte("CNB1234567\x00"))...))
+
+	var pdu []byte
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(int64(requestID)))...)
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...)
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...)
+	pdu = append(pdu, berTLV(berSequence, varBind)...)
+
+	var message []byte
+	message = append(message, berTLV(berInteger, berEncodeInt(0))...)
+	message = append(message, berTLV(berOctetString, []byte("public"))...)
+	message = append(message, berTLV(snmpGetResponse, pdu)...)
+	response := berTLV(berSequence, message)
+
+	serial, err := decodeSNMPGetResponse(response, requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial != "CNB1234567" {
+		t.Fatalf("expected CNB1234567 got %q", serial)
+	}
+
+	if _, err = decodeSNMPGetResponse(response, requestID+1); err == nil {
+		t.Fatal("expected error for mismatched request ID")
+	}
+	if _, err = decodeSNMPGetResponse(response[:len(response)-4], requestID); err == nil {
+		t.Fatal("expected error for truncated response")
+	}
+}
+
+func TestSNMPGetRequest(t *testing.T) {
+	request, err := encodeSNMPGetRequest("public", SNMPOIDPrtGeneralSerialNumber, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message, rest, err := berExpect(request, berSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("unexpected %d trailing bytes", len(rest))
+	}
+	_, message, _ = berExpect(message, berInteger)
+	community, message, _ := berExpect(message, berOctetString)
+	if string(community) != "public" {
+		t.Fatalf("expected community public got %q", community)
+	}
+	if _, _, err = berExpect(message, snmpGetRequest); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DocumentTemplate is a Go text/template that writes a layout, such as a
+// delivery note filled in with the data of an order, so that small
+// documents can be printed without a PDF generator. See ParseLayout.
+type DocumentTemplate struct {
+	template *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	"cell":  layoutCell,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// Current time in a time.Format layout, such as "2006-01-02".
+	"now": func(layout string) string { return time.Now().Format(layout) },
+}
+
+// layoutCell makes a value safe to write as text or as a cell: line ends
+// and tabs become spaces, and a leading dot is escaped, so that data can't
+// start directives or cells.
+func layoutCell(v interface{}) string {
+	s := strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\t", " ").Replace(fmt.Sprint(v))
+	if strings.HasPrefix(s, ".") {
+		s = "." + s
+	}
+	return s
+}
+
+// ParseDocumentTemplate parses a template. Besides the standard functions,
+// templates have cell, which should wrap values from data, upper, lower and
+// now.
+func ParseDocumentTemplate(name, text string) (*DocumentTemplate, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &DocumentTemplate{template: t}, nil
+}
+
+// LoadDocumentTemplates parses template files, by template name.
+func LoadDocumentTemplates(files map[string]string) (map[string]*DocumentTemplate, error) {
+	templates := make(map[string]*DocumentTemplate, len(files))
+	for name, fileName := range files {
+		text, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("template %s: %s", name, err)
+		}
+		if templates[name], err = ParseDocumentTemplate(name, string(text)); err != nil {
+			return nil, fmt.Errorf("template %s: %s", name, err)
+		}
+	}
+	return templates, nil
+}
+
+// Execute fills in the template with data, such as decoded JSON, and
+// returns the layout written, which it checks with ParseLayout.
+func (t *DocumentTemplate) Execute(data interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := t.template.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	if _, err := ParseLayout(b.Bytes()); err != nil {
+		return nil, fmt.Errorf("template %s: %s", t.template.Name(), err)
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDocumentTemplate(t *testing.T) {
+	tmpl, err := ParseDocumentTemplate("delivery-note", `.layout 80x150 3
+.bold
+Order {{cell .order}}
+.regular
+.columns 70 30r
+{{range .lines}}{{cell .item}}	{{.qty}}
+{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var data interface{}
+	json.Unmarshal([]byte(`{"order": "A-17", "lines": [{"item": ".5 mm\tscrews", "qty": 100}, {"item": "Nuts", "qty": 50}]}`), &data)
+	document, err := tmpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	layout, err := ParseLayout(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cells [][]string
+	for _, block := range layout.Blocks {
+		cells = append(cells, block.Cells)
+	}
+	expected := [][]string{{"Order A-17"}, {".5 mm screws", "100"}, {"Nuts", "50"}}
+	if !reflect.DeepEqual(cells, expected) {
+		t.Errorf("expected %q got %q", expected, cells)
+	}
+
+	if _, err = tmpl.Execute(map[string]interface{}{"lines": nil}); err == nil {
+		t.Error("expected an error for missing data")
+	}
+	bad, _ := ParseDocumentTemplate("bad", ".layout\n.frame\n")
+	if _, err = bad.Execute(nil); err == nil {
+		t.Error("expected an error for an invalid layout")
+	}
+	if _, err = ParseDocumentTemplate("bad", "{{.order"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// TestPageInfo is what a test page prints about the printer it checks.
+type TestPageInfo struct {
+	Printer string
+	Driver  string
+	Port    string
+	// Display name of the default paper, if known.
+	Paper      string
+	XDPI, YDPI int32
+	// Color ramps are printed besides the gray ramp.
+	Color bool
+	Time  time.Time
+}
+
+// PlacedLine is a line on a page, in points, Width wide.
+type PlacedLine struct {
+	X1, Y1, X2, Y2 float64
+	Width          float64
+}
+
+// PlacedPatch is a filled rectangle on a page, in points, of an RGB color
+// with components from 0 to 1.
+type PlacedPatch struct {
+	X, Y, Width, Height float64
+	R, G, B             float64
+}
+
+// TestPage is a diagnostic page, to draw lines first, then patches, then
+// texts.
+type TestPage struct {
+	Lines   []PlacedLine
+	Patches []PlacedPatch
+	Texts   []PlacedText
+}
+
+const (
+	// Spacing of the grid, in millimeters, with a heavier line every
+	// testPageMajorGrid.
+	testPageGrid      = 10
+	testPageMajorGrid = 50
+	testPageTextSize  = 9
+	testPageTitleSize = 14
+	// Steps of the ramps, from 0 to 100%.
+	testPageRampSteps = 11
+)
+
+// Inks of the ramps of a test page, from white to full.
+var testPageRamps = []struct {
+	name    string
+	r, g, b float64
+}{
+	{"Gray", 0, 0, 0},
+	{"Red", 1, 0, 0},
+	{"Green", 0, 1, 0},
+	{"Blue", 0, 0, 1},
+	{"Cyan", 0, 1, 1},
+	{"Magenta", 1, 0, 1},
+	{"Yellow", 1, 1, 0},
+}
+
+// NewTestPage lays out a test page on paper of the given size in points: a
+// millimeter grid over the whole paper, which the printer clips to its
+// printable area, a border just within the printable area, the paper
+// center, the printer information, and gray ramps, and color ones for
+// color printers. What doesn't fit in the printable area is left out, as
+// on small labels.
+func NewTestPage(info TestPageInfo, wPaperPoints, hPaperPoints float64, printable NUpCell) *TestPage {
+	page := &TestPage{}
+	gridStep := testPageGrid * pointsPerMM
+	for i := 0; float64(i)*gridStep <= wPaperPoints; i++ {
+		x := float64(i) * gridStep
+		page.Lines = append(page.Lines, PlacedLine{X1: x, Y1: 0, X2: x, Y2: hPaperPoints, Width: testPageLineWidth(i)})
+	}
+	for i := 0; float64(i)*gridStep <= hPaperPoints; i++ {
+		y := float64(i) * gridStep
+		page.Lines = append(page.Lines, PlacedLine{X1: 0, Y1: y, X2: wPaperPoints, Y2: y, Width: testPageLineWidth(i)})
+	}
+
+	const border = 1.0
+	left, top := printable.X+border/2, printable.Y+border/2
+	right, bottom := printable.X+printable.Width-border/2, printable.Y+printable.Height-border/2
+	page.Lines = append(page.Lines,
+		PlacedLine{X1: left, Y1: top, X2: right, Y2: top, Width: border},
+		PlacedLine{X1: right, Y1: top, X2: right, Y2: bottom, Width: border},
+		PlacedLine{X1: right, Y1: bottom, X2: left, Y2: bottom, Width: border},
+		PlacedLine{X1: left, Y1: bottom, X2: left, Y2: top, Width: border})
+	cx, cy, arm := wPaperPoints/2, hPaperPoints/2, 5*pointsPerMM
+	page.Lines = append(page.Lines,
+		PlacedLine{X1: cx - arm, Y1: cy, X2: cx + arm, Y2: cy, Width: border},
+		PlacedLine{X1: cx, Y1: cy - arm, X2: cx, Y2: cy + arm, Width: border})
+
+	pad := 5 * pointsPerMM
+	x, y := printable.X+pad, printable.Y+pad
+	width := printable.Width - 2*pad
+	limit := printable.Y + printable.Height - pad
+	mm := func(points float64) float64 { return points / pointsPerMM }
+	lines := []string{
+		"Printer: " + info.Printer,
+		"Driver: " + info.Driver,
+		"Port: " + info.Port,
+		fmt.Sprintf("Resolution: %dx%d dpi", info.XDPI, info.YDPI),
+		fmt.Sprintf("Paper: %.1f x %.1f mm", mm(wPaperPoints), mm(hPaperPoints)),
+		fmt.Sprintf("Printable area: %.1f x %.1f mm", mm(printable.Width), mm(printable.Height)),
+		fmt.Sprintf("Margins: top %.1f, right %.1f, bottom %.1f, left %.1f mm",
+			mm(printable.Y), mm(wPaperPoints-printable.X-printable.Width), mm(hPaperPoints-printable.Y-printable.Height), mm(printable.X)),
+		fmt.Sprintf("Grid: %d mm", testPageGrid),
+		"Printed: " + info.Time.Format("2006-01-02 15:04:05"),
+	}
+	if info.Paper != "" {
+		lines[4] = fmt.Sprintf("Paper: %s, %.1f x %.1f mm", info.Paper, mm(wPaperPoints), mm(hPaperPoints))
+	}
+
+	// The text sits on white, over the grid.
+	textTop := y
+	y += testPageTitleSize
+	if y > limit {
+		return page
+	}
+	texts := []PlacedText{{X: x, Y: y, Size: testPageTitleSize, Bold: true, Text: "Test page"}}
+	for _, line := range lines {
+		if y+testPageTextSize*1.5 > limit {
+			break
+		}
+		y += testPageTextSize * 1.5
+		texts = append(texts, PlacedText{X: x, Y: y, Size: testPageTextSize, Text: line})
+	}
+	y += testPageTextSize / 2
+	page.Patches = append(page.Patches, PlacedPatch{X: x - pad/2, Y: textTop - pad/2, Width: width + pad, Height: y - textTop + pad/2, R: 1, G: 1, B: 1})
+	page.Texts = append(page.Texts, texts...)
+
+	ramps := testPageRamps[:1]
+	if info.Color {
+		ramps = testPageRamps
+	}
+	labelWidth := 20 * pointsPerMM
+	stepWidth := (width - labelWidth) / testPageRampSteps
+	rampHeight, rampGap := 8*pointsPerMM, 2*pointsPerMM
+	if stepWidth <= 0 {
+		return page
+	}
+	y += pad
+	for _, ramp := range ramps {
+		if y+rampHeight > limit {
+			break
+		}
+		page.Patches = append(page.Patches, PlacedPatch{X: x - pad/2, Y: y - rampGap/2, Width: width + pad, Height: rampHeight + rampGap, R: 1, G: 1, B: 1})
+		page.Texts = append(page.Texts, PlacedText{X: x, Y: y + rampHeight/2 + testPageTextSize/3, Size: testPageTextSize, Text: ramp.name})
+		for i := 0; i < testPageRampSteps; i++ {
+			ink := float64(i) / (testPageRampSteps - 1)
+			page.Patches = append(page.Patches, PlacedPatch{
+				X:      x + labelWidth + float64(i)*stepWidth,
+				Y:      y,
+				Width:  stepWidth,
+				Height: rampHeight,
+				R:      1 - ink*(1-ramp.r),
+				G:      1 - ink*(1-ramp.g),
+				B:      1 - ink*(1-ramp.b),
+			})
+		}
+		y += rampHeight + rampGap
+	}
+	return page
+}
+
+// testPageLineWidth is the width of the ith grid line, in points.
+func testPageLineWidth(i int) float64 {
+	if i%(testPageMajorGrid/testPageGrid) == 0 {
+		return 0.75
+	}
+	return 0.25
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewTestPage(t *testing.T) {
+	info := TestPageInfo{Printer: "Office", Driver: "HP Universal Printing PCL 6", Port: "IP_10.0.0.5", XDPI: 600, YDPI: 600, Time: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	w, h := 210*pointsPerMM, 297*pointsPerMM
+	printable := NUpCell{X: 4 * pointsPerMM, Y: 5 * pointsPerMM, Width: 202 * pointsPerMM, Height: 287 * pointsPerMM}
+
+	page := NewTestPage(info, w, h, printable)
+	// 22 vertical and 30 horizontal grid lines, the border and the center.
+	if len(page.Lines) != 22+30+4+2 {
+		t.Errorf("expected 58 lines, got %d", len(page.Lines))
+	}
+	var text []string
+	for _, placed := range page.Texts {
+		text = append(text, placed.Text)
+	}
+	all := strings.Join(text, "\n")
+	for _, want := range []string{"Driver: HP Universal Printing PCL 6", "Resolution: 600x600 dpi", "Margins: top 5.0, right 4.0, bottom 5.0, left 4.0 mm", "Printed: 2026-01-02 03:04:05", "Gray"} {
+		if !strings.Contains(all, want) {
+			t.Errorf("expected %q on the page, got:\n%s", want, all)
+		}
+	}
+	if strings.Contains(all, "Cyan") {
+		t.Error("expected no color ramps on a monochrome printer")
+	}
+	// The text background, and a background and steps for the gray ramp.
+	if len(page.Patches) != 1+1+testPageRampSteps {
+		t.Errorf("expected %d patches, got %d", 2+testPageRampSteps, len(page.Patches))
+	}
+	for _, p := range page.Patches {
+		if p.X < printable.X || p.Y < printable.Y || p.X+p.Width > printable.X+printable.Width+0.001 || p.Y+p.Height > printable.Y+printable.Height {
+			t.Errorf("patch %+v is outside the printable area", p)
+		}
+	}
+	if last := page.Patches[len(page.Patches)-1]; last.R != 0 || last.G != 0 || last.B != 0 {
+		t.Errorf("expected the gray ramp to end in black, got %+v", last)
+	}
+
+	info.Color = true
+	if page := NewTestPage(info, w, h, printable); len(page.Patches) != 1+len(testPageRamps)*(1+testPageRampSteps) {
+		t.Errorf("expected color ramps, got %d patches", len(page.Patches))
+	}
+
+	label := NewTestPage(info, 62*pointsPerMM, 29*pointsPerMM, NUpCell{Width: 62 * pointsPerMM, Height: 29 * pointsPerMM})
+	for _, placed := range label.Texts {
+		if placed.Y > 29*pointsPerMM {
+			t.Errorf("text %q is below a label", placed.Text)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Tab stops of plain text documents, in columns.
+const textTabWidth = 8
+
+// Defaults of TextFormat.
+const (
+	DefaultTextFont   = "Courier New"
+	DefaultTextSize   = 10
+	DefaultTextMargin = 15
+)
+
+// Lines of rendered plain text are this many times the font size apart.
+const textLineSpacing = 1.2
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// DecodeText decodes a UTF-8 plain text document, without its byte order
+// mark. Returns false when the data isn't valid UTF-8, in which case it is
+// likely in a legacy code page.
+func DecodeText(data []byte) (string, bool) {
+	data = bytes.TrimPrefix(data, utf8BOM)
+	if !utf8.Valid(data) {
+		return "", false
+	}
+	return string(data), true
+}
+
+// LayoutText splits plain text into pages of at most lines lines, of at most
+// columns characters each. Lines end with LF, CR LF or CR; longer lines wrap.
+// Form feeds start a new page, and tabs are expanded to the next tab stop.
+// A trailing line end or form feed doesn't start an empty page.
+func LayoutText(text string, columns, lines int) [][]string {
+	return layoutText(text, columns, lines, textTabWidth, true)
+}
+
+// layoutText is LayoutText with tab stops every tabWidth columns, and long
+// lines cut at columns unless wrap.
+func layoutText(text string, columns, lines, tabWidth int, wrap bool) [][]string {
+	if columns < 1 {
+		columns = 1
+	}
+	if lines < 1 {
+		lines = 1
+	}
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	text = strings.TrimRight(text, "\n\f")
+
+	var pages [][]string
+	for _, sheet := range strings.Split(text, "\f") {
+		var page []string
+		for _, line := range strings.Split(sheet, "\n") {
+			line = expandTabs(line, tabWidth)
+			wrapped := []string{line}
+			if wrap {
+				wrapped = wrapLine(line, columns)
+			} else if runes := []rune(line); len(runes) > columns {
+				wrapped = []string{string(runes[:columns])}
+			}
+			for _, wrapped := range wrapped {
+				if len(page) == lines {
+					pages = append(pages, page)
+					page = nil
+				}
+				page = append(page, wrapped)
+			}
+		}
+		pages = append(pages, page)
+	}
+	return pages
+}
+
+func expandTabs(line string, tabWidth int) string {
+	if !strings.ContainsRune(line, '\t') {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := tabWidth - column%tabWidth
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// wrapLine cuts a line into pieces of at most columns characters. An empty
+// line stays a single empty line.
+func wrapLine(line string, columns int) []string {
+	runes := []rune(line)
+	if len(runes) <= columns {
+		return []string{line}
+	}
+	var wrapped []string
+	for len(runes) > columns {
+		wrapped = append(wrapped, string(runes[:columns]))
+		runes = runes[columns:]
+	}
+	return append(wrapped, string(runes))
+}
+
+// TextFormat is how plain text documents, such as log files and reports,
+// are rendered on printers without text_device_font or escp. The zero value
+// has the defaults.
+type TextFormat struct {
+	// Font family, DefaultTextFont when empty. Lines are as many columns
+	// wide as the digit 0 of the font fits, which suits fixed-pitch fonts.
+	Font string `json:"font,omitempty"`
+	// Font size in points, DefaultTextSize when zero.
+	Size float64 `json:"size,omitempty"`
+	// Margin on all sides of the page in millimeters, DefaultTextMargin when
+	// zero. The margins of the ticket override it.
+	Margin float64 `json:"margin,omitempty"`
+	// Long lines are cut at the right margin instead of wrapping.
+	NoWrap bool `json:"no_wrap,omitempty"`
+	// Tab stops are every this many columns, 8 when zero.
+	TabWidth int `json:"tab_width,omitempty"`
+	// Line printed on top and at the bottom of every page, none when empty,
+	// such as "{file}||{page}/{pages}". Up to 3 parts separated by | are
+	// aligned left, center and right. {file} is the title of the job,
+	// {page} and {pages} count pages and {date} is when it prints.
+	Header string `json:"header,omitempty"`
+	Footer string `json:"footer,omitempty"`
+}
+
+var textFormatField = regexp.MustCompile(`\{([a-z]*)\}`)
+
+var textFormatFields = map[string]bool{"file": true, "page": true, "pages": true, "date": true}
+
+func (f TextFormat) Validate() error {
+	if f.Size < 0 || f.Size > 0 && (f.Size < 4 || f.Size > 144) {
+		return fmt.Errorf("size %g is not between 4 and 144 points", f.Size)
+	}
+	if f.Margin < 0 || f.Margin >= 100 {
+		return fmt.Errorf("margin %g is not between 0 and 100 mm", f.Margin)
+	}
+	if f.TabWidth < 0 || f.TabWidth > 64 {
+		return fmt.Errorf("tab_width %d is not between 1 and 64", f.TabWidth)
+	}
+	for name, line := range map[string]string{"header": f.Header, "footer": f.Footer} {
+		if strings.Count(line, "|") > 2 {
+			return fmt.Errorf("%s has more than 3 parts", name)
+		}
+		for _, field := range textFormatField.FindAllStringSubmatch(line, -1) {
+			if !textFormatFields[field[1]] {
+				return fmt.Errorf("%s has unknown field %s, not {file}, {page}, {pages} or {date}", name, field[0])
+			}
+		}
+	}
+	return nil
+}
+
+// FontFamily returns the font of the text.
+func (f TextFormat) FontFamily() string {
+	if f.Font == "" {
+		return DefaultTextFont
+	}
+	return f.Font
+}
+
+// FontSize returns the size of the font of the text, in points.
+func (f TextFormat) FontSize() float64 {
+	if f.Size == 0 {
+		return DefaultTextSize
+	}
+	return f.Size
+}
+
+// Area returns the area text is laid out in on a page of width by height
+// points, within the ticket margins when not nil.
+func (f TextFormat) Area(width, height float64, margins *model.MarginsTicketItem) (NUpCell, error) {
+	margin := f.Margin
+	if margin == 0 {
+		margin = DefaultTextMargin
+	}
+	top, right, bottom, left := margin*pointsPerMM, margin*pointsPerMM, margin*pointsPerMM, margin*pointsPerMM
+	if margins != nil {
+		points := func(microns int32) float64 { return float64(microns) * 72 / 25400 }
+		top, right, bottom, left = points(margins.TopMicrons), points(margins.RightMicrons), points(margins.BottomMicrons), points(margins.LeftMicrons)
+	}
+	area := NUpCell{X: left, Y: top, Width: width - left - right, Height: height - top - bottom}
+	if area.Width < f.FontSize() || area.Height < f.FontSize()*textLineSpacing {
+		return NUpCell{}, errors.New("margins leave no room for text on the page")
+	}
+	return area, nil
+}
+
+// TextFields are what the header and footer of a TextFormat show.
+type TextFields struct {
+	// Title of the job.
+	File string
+	Date time.Time
+}
+
+// Pages lays out text on pages within area, in points, where measure
+// returns the width of text in the font. Pages have the header on their
+// first line and the footer on their last, each followed or preceded by a
+// blank line.
+func (f TextFormat) Pages(text string, fields TextFields, area NUpCell, measure func(text string) float64) ([]LayoutPage, error) {
+	size := f.FontSize()
+	lineHeight := size * textLineSpacing
+	areaLines := int(area.Height / lineHeight)
+	lines := areaLines
+	bodyTop := area.Y
+	if f.Header != "" {
+		lines -= 2
+		bodyTop += 2 * lineHeight
+	}
+	if f.Footer != "" {
+		lines -= 2
+	}
+	if lines < 1 {
+		return nil, errors.New("header and footer leave no room for text on the page")
+	}
+	charWidth := measure("0")
+	if charWidth <= 0 {
+		charWidth = size * 0.6
+	}
+	tabWidth := f.TabWidth
+	if tabWidth == 0 {
+		tabWidth = textTabWidth
+	}
+	textPages := layoutText(text, int(area.Width/charWidth), lines, tabWidth, !f.NoWrap)
+
+	// placeLine places the parts of a header or footer on the baseline y.
+	placeLine := func(page *LayoutPage, line string, number int, y float64) {
+		fill := func(field string) string {
+			switch field {
+			case "{file}":
+				return fields.File
+			case "{page}":
+				return strconv.Itoa(number)
+			case "{pages}":
+				return strconv.Itoa(len(textPages))
+			case "{date}":
+				return fields.Date.Format("2006-01-02 15:04")
+			}
+			return field
+		}
+		// Fields are filled in after splitting, as titles may have a |.
+		for i, part := range strings.SplitN(line, "|", 3) {
+			if part = textFormatField.ReplaceAllStringFunc(part, fill); part == "" {
+				continue
+			}
+			x := area.X
+			switch i {
+			case 1:
+				x += (area.Width - measure(part)) / 2
+			case 2:
+				x += area.Width - measure(part)
+			}
+			// What is wider than the area starts at its left.
+			if x < area.X {
+				x = area.X
+			}
+			page.Texts = append(page.Texts, PlacedText{X: x, Y: y, Size: size, Text: part})
+		}
+	}
+
+	pages := make([]LayoutPage, len(textPages))
+	for i, textPage := range textPages {
+		page := &pages[i]
+		if f.Header != "" {
+			placeLine(page, f.Header, i+1, area.Y+size)
+		}
+		for j, line := range textPage {
+			if strings.TrimSpace(line) != "" {
+				page.Texts = append(page.Texts, PlacedText{X: area.X, Y: bodyTop + float64(j)*lineHeight + size, Size: size, Text: line})
+			}
+		}
+		if f.Footer != "" {
+			placeLine(page, f.Footer, i+1, area.Y+float64(areaLines-1)*lineHeight+size)
+		}
+	}
+	return pages, nil
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestDecodeText(t *testing.T) {
+	if text, ok := DecodeText([]byte("\xef\xbb\xbfInvoice 发票\r\n")); !ok || text != "Invoice 发票\r\n" {
+		t.Errorf("unexpected UTF-8 text %q", text)
+	}
+	// "发票" in GBK.
+	if _, ok := DecodeText([]byte("\xb7\xa2\xc6\xb1")); ok {
+		t.Error("expected legacy code page text to be rejected")
+	}
+}
+
+func TestLayoutText(t *testing.T) {
+	text := "Qty\tItem\r\n1\tPaper\r\n2\tRibbon, black\n\fTotal\n"
+	expected := [][]string{
+		{"Qty     ", "Item", "1       "},
+		{"Paper", "2       ", "Ribbon, "},
+		{"black", ""},
+		{"Total"},
+	}
+	if pages := LayoutText(text, 8, 3); !reflect.DeepEqual(pages, expected) {
+		t.Errorf("expected %q got %q", expected, pages)
+	}
+
+	if pages := LayoutText("", 80, 66); len(pages) != 1 || len(pages[0]) != 1 {
+		t.Errorf("expected a single blank page got %q", pages)
+	}
+}
+
+func TestTextFormatValidate(t *testing.T) {
+	valid := []TextFormat{{}, {Font: "Consolas", Size: 9, Margin: 10, TabWidth: 4, Header: "{file}|{date}|{page}/{pages}"}}
+	for _, format := range valid {
+		if err := format.Validate(); err != nil {
+			t.Errorf("expected %+v to be valid, got %s", format, err)
+		}
+	}
+	invalid := []TextFormat{{Size: 2}, {Margin: -1}, {TabWidth: 100}, {Header: "a|b|c|d"}, {Footer: "{user}"}}
+	for _, format := range invalid {
+		if err := format.Validate(); err == nil {
+			t.Errorf("expected %+v to be invalid", format)
+		}
+	}
+}
+
+func TestTextFormatPages(t *testing.T) {
+	// Every character is 6 points wide.
+	measure := func(text string) float64 { return 6 * float64(len([]rune(text))) }
+	format := TextFormat{Size: 10, TabWidth: 4, Header: "{file}||{page}/{pages}", Footer: "|{date}|"}
+	// 10 columns and 7 lines: the header, 3 lines of text and the footer.
+	area := NUpCell{X: 10, Y: 20, Width: 60, Height: 84}
+	fields := TextFields{File: "app|1.log", Date: time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)}
+	pages, err := format.Pages("a\tb\n0123456789abc\n\nlast", fields, area, measure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("expected 2 pages, got %+v", pages)
+	}
+	expected := []PlacedText{
+		{X: 10, Y: 30, Size: 10, Text: "app|1.log"},
+		{X: 52, Y: 30, Size: 10, Text: "1/2"},
+		{X: 10, Y: 54, Size: 10, Text: "a   b"},
+		{X: 10, Y: 66, Size: 10, Text: "0123456789"},
+		{X: 10, Y: 78, Size: 10, Text: "abc"},
+		{X: 10, Y: 102, Size: 10, Text: "2024-03-01 09:30"},
+	}
+	if !reflect.DeepEqual(pages[0].Texts, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pages[0].Texts)
+	}
+
+	format.NoWrap = true
+	if pages, err = format.Pages("0123456789abc", fields, area, measure); err != nil || len(pages) != 1 || pages[0].Texts[2].Text != "0123456789" {
+		t.Errorf("expected the long line to be cut, got %+v, %v", pages, err)
+	}
+
+	if _, err = format.Pages("text", fields, NUpCell{Width: 60, Height: 48}, measure); err == nil {
+		t.Error("expected an error when the header and footer fill the page")
+	}
+}
+
+func TestTextFormatArea(t *testing.T) {
+	area, err := TextFormat{Margin: 10}.Area(200, 300, nil)
+	if err != nil || area.X != 10*pointsPerMM || area.Width != 200-20*pointsPerMM {
+		t.Errorf("unexpected area %+v, %v", area, err)
+	}
+	margins := &model.MarginsTicketItem{TopMicrons: 25400, LeftMicrons: 12700}
+	if area, err = (TextFormat{}).Area(200, 300, margins); err != nil || area.X != 36 || area.Y != 72 || area.Width != 164 || area.Height != 228 {
+		t.Errorf("expected the ticket margins, got %+v, %v", area, err)
+	}
+	if _, err = (TextFormat{Margin: 80}).Area(400, 400, nil); err == nil {
+		t.Error("expected an error when the margins fill the page")
+	}
+}
@@ -0,0 +1,390 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// DEVMODE field values, as defined in wingdi.h.
+const (
+	DevModeOrientationPortrait  int16 = 1
+	DevModeOrientationLandscape int16 = 2
+
+	DevModeColorMonochrome int16 = 1
+	DevModeColorColor      int16 = 2
+
+	DevModeDuplexSimplex    int16 = 1
+	DevModeDuplexVertical   int16 = 2
+	DevModeDuplexHorizontal int16 = 3
+
+	DevModeCollateFalse int16 = 0
+	DevModeCollateTrue  int16 = 1
+)
+
+var (
+	colorValueByType = map[model.ColorType]int16{
+		model.ColorTypeStandardColor:      DevModeColorColor,
+		model.ColorTypeStandardMonochrome: DevModeColorMonochrome,
+		// Ignore the rest, since we don't advertise them.
+	}
+
+	duplexValueByType = map[model.DuplexType]int16{
+		model.DuplexNoDuplex:  DevModeDuplexSimplex,
+		model.DuplexLongEdge:  DevModeDuplexVertical,
+		model.DuplexShortEdge: DevModeDuplexHorizontal,
+	}
+
+	pageOrientationByType = map[model.PageOrientationType]int16{
+		model.PageOrientationPortrait:  DevModeOrientationPortrait,
+		model.PageOrientationLandscape: DevModeOrientationLandscape,
+		// Ignore model.PageOrientationAuto for ticket parsing, in order to interpret "auto".
+	}
+)
+
+// DevModeSetter is the part of a DEVMODE that job tickets change.
+type DevModeSetter interface {
+	SetColor(color int16)
+	SetDuplex(duplex int16)
+	SetOrientation(orientation int16)
+	SetCopies(copies int16)
+	SetPaperSize(paperSize int16)
+	ClearPaperSize()
+	SetPaperLength(length int16)
+	ClearPaperLength()
+	SetPaperWidth(width int16)
+	ClearPaperWidth()
+	SetCollate(collate int16)
+	SetDefaultSource(source int16)
+}
+
+// TicketSettings are the parts of a ticket applied while rendering, rather
+// than by the driver.
+type TicketSettings struct {
+	Placement PagePlacement
+	Duplex    bool
+
+	// Copies requested by the ticket.
+	Copies int
+	// Times the document is rendered, when the driver can't make the copies.
+	SoftwareCopies int
+
+	// Pages to print; all when nil.
+	PageRange *model.PageRangeTicketItem
+
+	// Document pages printed on each side of a sheet; 1 unless N-up, and
+	// the order they are placed in.
+	NUp       int
+	NUpLayout model.NUpLayoutType
+	// Pages are imposed two per side for a saddle-stitched booklet; see
+	// BookletSides.
+	Booklet bool
+}
+
+// PrintsPage tells whether the 1-based page of the document is printed.
+func (s TicketSettings) PrintsPage(page int) bool {
+	return s.PageRange == nil || s.PageRange.Contains(int32(page))
+}
+
+// CheckPageRange fails when the page range selects none of the pages of a
+// document of pages pages.
+func (s TicketSettings) CheckPageRange(pages int) error {
+	if s.PageRange == nil || s.PagesPrinted(pages) > 0 {
+		return nil
+	}
+	return &model.TicketError{Problems: []string{fmt.Sprintf("page_range selects none of the %d pages of the document", pages)}}
+}
+
+// PagesPrinted is the number of pages printed, per copy, of a document of
+// pages pages.
+func (s TicketSettings) PagesPrinted(pages int) int {
+	if s.PageRange == nil {
+		return pages
+	}
+	return int(s.PageRange.Count(int32(pages)))
+}
+
+// Sheets is the number of sheets printed for a document of pages pages.
+func (s TicketSettings) Sheets(pages int) int {
+	sheets := s.sidesPerCopy(pages)
+	if s.Duplex {
+		sheets = (sheets + 1) / 2
+	}
+	return sheets * s.Copies
+}
+
+// Sides is the number of sheet sides printed on for a document of pages
+// pages.
+func (s TicketSettings) Sides(pages int) int {
+	return s.sidesPerCopy(pages) * s.Copies
+}
+
+// PadsCopies tells whether a blank side follows each software copy but the
+// last of a document of pages pages, so that the next copy starts on a new
+// sheet when duplexing an odd number of sides.
+func (s TicketSettings) PadsCopies(pages int) bool {
+	return s.Duplex && s.SoftwareCopies > 1 && s.sidesPerCopy(pages)%2 == 1
+}
+
+func (s TicketSettings) sidesPerCopy(pages int) int {
+	if s.Booklet {
+		return (pages + 3) / 4 * 2
+	} else if s.NUp > 1 {
+		return (pages + s.NUp - 1) / s.NUp
+	}
+	return pages
+}
+
+// ApplyTicket sets the DEVMODE fields a ticket asks for, as far as the
+// printer description allows, and records a warning in result for every
+// option that isn't applied as requested.
+func ApplyTicket(devMode DevModeSetter, description *model.PrinterDescriptionSection, ticket *model.JobTicket, result *PrintResult) (TicketSettings, error) {
+	settings := TicketSettings{Copies: 1, SoftwareCopies: 1, NUp: 1}
+
+	if ticket.Color != nil && description.Color != nil {
+		if color, ok := colorValueByType[ticket.Color.Type]; ok {
+			devMode.SetColor(color)
+		} else if ticket.Color.VendorID != "" {
+			v, err := parseInt16("color.vendor_id", ticket.Color.VendorID)
+			if err != nil {
+				return settings, err
+			}
+			devMode.SetColor(v)
+		} else {
+			result.Warn("color", PrintWarningInvalidValue, "color type %s not supported, ignored", ticket.Color.Type)
+		}
+	} else if ticket.Color != nil {
+		result.Warn("color", PrintWarningUnsupported, "printer doesn't report color capabilities, ignored")
+	}
+
+	if ticket.Duplex != nil && description.Duplex != nil {
+		if duplex, ok := duplexValueByType[ticket.Duplex.Type]; ok {
+			devMode.SetDuplex(duplex)
+			settings.Duplex = ticket.Duplex.Type != model.DuplexNoDuplex
+		} else {
+			result.Warn("duplex", PrintWarningInvalidValue, "duplex type %s not supported, ignored", ticket.Duplex.Type)
+		}
+	} else if ticket.Duplex != nil && ticket.Duplex.Type != model.DuplexNoDuplex {
+		result.Warn("duplex", PrintWarningUnsupported, "printer doesn't support duplex, printing one-sided")
+	}
+
+	if ticket.PageOrientation != nil && description.PageOrientation != nil {
+		if pageOrientation, ok := pageOrientationByType[ticket.PageOrientation.Type]; ok {
+			devMode.SetOrientation(pageOrientation)
+		} else {
+			result.Warn("page_orientation", PrintWarningInvalidValue, "page orientation %s not supported, ignored", ticket.PageOrientation.Type)
+		}
+	} else if ticket.PageOrientation != nil {
+		result.Warn("page_orientation", PrintWarningUnsupported, "printer doesn't report orientation capabilities, ignored")
+	}
+
+	if ticket.Copies != nil && ticket.Copies.Copies > 0 {
+		settings.Copies = int(ticket.Copies.Copies)
+	}
+	if ticket.Copies != nil && description.Copies != nil {
+		maxCopies := int(description.Copies.Max)
+		if maxCopies <= 0 || maxCopies > math.MaxInt16 {
+			maxCopies = math.MaxInt16
+		}
+		if settings.Copies > maxCopies {
+			result.Warn("copies", PrintWarningEmulated, "%d copies exceed the driver limit of %d, applied in software", settings.Copies, maxCopies)
+			settings.SoftwareCopies = settings.Copies
+		} else if ticket.Copies.Copies > 0 {
+			devMode.SetCopies(int16(settings.Copies))
+		}
+	} else if settings.Copies > 1 {
+		result.Warn("copies", PrintWarningEmulated, "printer doesn't support copies, applied in software")
+		settings.SoftwareCopies = settings.Copies
+	}
+
+	if ticket.FitToPage != nil && description.FitToPage != nil {
+		if ticket.FitToPage.Type == model.FitToPageFitToPage {
+			settings.Placement.FitToPage = true
+		}
+	} else if ticket.FitToPage != nil {
+		result.Warn("fit_to_page", PrintWarningUnsupported, "printer doesn't report fit to page capabilities, ignored")
+	}
+
+	if ticket.MediaSize != nil && description.MediaSize != nil {
+		vendorID := ticket.MediaSize.VendorID
+		// Several drivers ignore custom dimensions, so prefer the paper code
+		// of a known size.
+		if vendorID == "" {
+			if option, ok := MatchMediaSize(description.MediaSize, ticket.MediaSize.WidthMicrons, ticket.MediaSize.HeightMicrons, MediaSizeTolerance); ok {
+				vendorID = option.VendorID
+			}
+		}
+		if vendorID != "" {
+			v, err := parseInt16("media_size.vendor_id", vendorID)
+			if err != nil {
+				return settings, err
+			}
+			devMode.SetPaperSize(v)
+			devMode.ClearPaperLength()
+			devMode.ClearPaperWidth()
+		} else {
+			// DEVMODE paper dimensions are in tenths of a millimeter.
+			length, err := checkInt16("media_size.height_microns", int64(ticket.MediaSize.HeightMicrons), 1, 100)
+			if err != nil {
+				return settings, err
+			}
+			width, err := checkInt16("media_size.width_microns", int64(ticket.MediaSize.WidthMicrons), 1, 100)
+			if err != nil {
+				return settings, err
+			}
+			devMode.ClearPaperSize()
+			devMode.SetPaperLength(length)
+			devMode.SetPaperWidth(width)
+		}
+	} else if ticket.MediaSize != nil {
+		result.Warn("media_size", PrintWarningUnsupported, "printer doesn't report media sizes, printing on the default paper")
+	}
+
+	if ticket.MediaSource != nil && description.MediaSource != nil {
+		vendorID := ticket.MediaSource.VendorID
+		if vendorID == "" {
+			if option, ok := MatchMediaSource(description.MediaSource, ticket.MediaSource.Type); ok {
+				vendorID = option.VendorID
+			}
+		}
+		if vendorID != "" {
+			v, err := parseInt16("media_source.vendor_id", vendorID)
+			if err != nil {
+				return settings, err
+			}
+			devMode.SetDefaultSource(v)
+		} else {
+			result.Warn("media_source", PrintWarningInvalidValue, "printer has no %s tray, printing from the default tray", ticket.MediaSource.Type)
+		}
+	} else if ticket.MediaSource != nil {
+		result.Warn("media_source", PrintWarningUnsupported, "printer doesn't report trays, printing from the default tray")
+	}
+
+	if ticket.Collate != nil && description.Collate != nil {
+		if ticket.Collate.Collate {
+			devMode.SetCollate(DevModeCollateTrue)
+		} else {
+			devMode.SetCollate(DevModeCollateFalse)
+		}
+	} else if ticket.Collate != nil && settings.Copies > 1 && settings.SoftwareCopies == 1 {
+		result.Warn("collate", PrintWarningUnsupported, "printer doesn't support collation, ignored")
+	}
+
+	if ticket.Margins != nil {
+		settings.Placement.Margins = ticket.Margins
+	}
+	if ticket.Scale != nil && ticket.Scale.Percent > 0 {
+		settings.Placement.ScalePercent = int(ticket.Scale.Percent)
+		if ticket.FitToPage != nil && ticket.FitToPage.Type != model.FitToPageNoFitting {
+			result.Warn("fit_to_page", PrintWarningInvalidValue, "pages are printed at %d%%, ignored", ticket.Scale.Percent)
+		}
+	}
+	if ticket.DPI != nil {
+		result.Warn("dpi", PrintWarningNotImplemented, "resolution is chosen by the driver, ignored")
+	}
+	if ticket.PageRange != nil && len(ticket.PageRange.Interval) > 0 {
+		settings.PageRange = ticket.PageRange
+	}
+	if ticket.Booklet != nil && ticket.Booklet.Booklet {
+		settings.Booklet = true
+		if description.Duplex != nil {
+			if ticket.Duplex != nil && ticket.Duplex.Type != model.DuplexShortEdge {
+				result.Warn("duplex", PrintWarningInvalidValue, "booklets print duplex along the short edge, ignored")
+			}
+			devMode.SetDuplex(DevModeDuplexHorizontal)
+			settings.Duplex = true
+		} else {
+			result.Warn("booklet", PrintWarningUnsupported, "printer doesn't support duplex, printing the sides of the booklet one-sided")
+		}
+		if description.PageOrientation != nil {
+			devMode.SetOrientation(DevModeOrientationLandscape)
+		}
+		if ticket.NUp != nil && ticket.NUp.PagesPerSheet > 1 {
+			result.Warn("n_up", PrintWarningInvalidValue, "booklets print 2 pages per side, ignored")
+		}
+		if settings.Placement.ScalePercent > 0 {
+			result.Warn("scale", PrintWarningInvalidValue, "booklet pages are fit to their half of the sheet, ignored")
+			settings.Placement.ScalePercent = 0
+		}
+	} else if ticket.NUp != nil && ticket.NUp.PagesPerSheet > 1 {
+		switch ticket.NUp.PagesPerSheet {
+		case 2, 4, 6:
+			settings.NUp, settings.NUpLayout = int(ticket.NUp.PagesPerSheet), ticket.NUp.Layout
+			// Two or six portrait pages fit best on a landscape sheet.
+			if settings.NUp != 4 && ticket.PageOrientation == nil && description.PageOrientation != nil {
+				devMode.SetOrientation(DevModeOrientationLandscape)
+			}
+			if settings.Placement.ScalePercent > 0 {
+				result.Warn("scale", PrintWarningInvalidValue, "N-up pages are fit to their cell, ignored")
+				settings.Placement.ScalePercent = 0
+			}
+		default:
+			result.Warn("n_up", PrintWarningInvalidValue, "%d pages per sheet not supported, printing one per sheet", ticket.NUp.PagesPerSheet)
+		}
+	}
+	if ticket.ReverseOrder != nil && ticket.ReverseOrder.ReverseOrder {
+		result.Warn("reverse_order", PrintWarningNotImplemented, "reverse order is not supported, printing in order")
+	}
+
+	return settings, nil
+}
+
+// TicketOptions lists the JSON names of the options set in a ticket, but
+// for hold_until and hold, which delay the job without changing how it
+// prints.
+func TicketOptions(ticket *model.JobTicket) []string {
+	var options []string
+	for _, option := range []struct {
+		name string
+		set  bool
+	}{
+		{"color", ticket.Color != nil},
+		{"duplex", ticket.Duplex != nil},
+		{"page_orientation", ticket.PageOrientation != nil},
+		{"copies", ticket.Copies != nil},
+		{"margins", ticket.Margins != nil},
+		{"dpi", ticket.DPI != nil},
+		{"fit_to_page", ticket.FitToPage != nil},
+		{"scale", ticket.Scale != nil},
+		{"page_range", ticket.PageRange != nil},
+		{"media_size", ticket.MediaSize != nil},
+		{"media_source", ticket.MediaSource != nil},
+		{"collate", ticket.Collate != nil},
+		{"reverse_order", ticket.ReverseOrder != nil},
+		{"n_up", ticket.NUp != nil},
+		{"booklet", ticket.Booklet != nil},
+	} {
+		if option.set {
+			options = append(options, option.name)
+		}
+	}
+	return options
+}
+
+// parseInt16 parses a vendor ID into a 16 bit DEVMODE value.
+func parseInt16(option, vendorID string) (int16, error) {
+	v, err := strconv.ParseInt(vendorID, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q is not a number", option, vendorID)
+	}
+	return checkInt16(option, v, 1, 1)
+}
+
+// checkInt16 divides a ticket value by unit, and checks that the result fits
+// a 16 bit DEVMODE field and is at least min.
+func checkInt16(option string, value, min, unit int64) (int16, error) {
+	if value/unit < min || value/unit > math.MaxInt16 {
+		return 0, &model.RangeError{Option: option, Value: value, Min: min * unit, Max: math.MaxInt16 * unit}
+	}
+	return int16(value / unit), nil
+}
@@ -0,0 +1,456 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"io/ioutil"
+)
+
+var (
+	tiffMagicLE = []byte("II*\x00")
+	tiffMagicBE = []byte("MM\x00*")
+)
+
+const (
+	tiffImageWidth      = 256
+	tiffImageLength     = 257
+	tiffBitsPerSample   = 258
+	tiffCompression     = 259
+	tiffPhotometric     = 262
+	tiffStripOffsets    = 273
+	tiffSamplesPerPixel = 277
+	tiffRowsPerStrip    = 278
+	tiffStripByteCounts = 279
+	tiffXResolution     = 282
+	tiffYResolution     = 283
+	tiffPlanarConfig    = 284
+	tiffResolutionUnit  = 296
+	tiffPredictor       = 317
+	tiffColorMap        = 320
+	tiffTileWidth       = 322
+
+	tiffCompressionNone     = 1
+	tiffCompressionLZW      = 5
+	tiffCompressionDeflate  = 8
+	tiffCompressionPackBits = 32773
+	tiffCompressionDeflate2 = 32946
+
+	tiffWhiteIsZero = 0
+	tiffBlackIsZero = 1
+	tiffRGB         = 2
+	tiffPalette     = 3
+	tiffCMYK        = 5
+
+	// Largest IFD entry count, and strip count, accepted.
+	tiffMaxEntries = 1 << 16
+	// Largest decoded page.
+	tiffMaxImageBytes = 1 << 31
+)
+
+// tiffDecoder reads baseline TIFF images, one IFD (page) at a time:
+// bilevel, 8 bit gray, palette, RGB and CMYK strips, uncompressed or
+// compressed with LZW, Deflate or PackBits.
+type tiffDecoder struct {
+	r     io.ReaderAt
+	order binary.ByteOrder
+	// Offset of the next IFD to read; zero after the last.
+	next uint32
+	seen map[uint32]bool
+}
+
+type tiffIFD map[uint16][]uint32
+
+func (ifd tiffIFD) get(tag uint16, def uint32) uint32 {
+	if values := ifd[tag]; len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
+
+func newTIFFDecoder(r io.ReaderAt) (*tiffDecoder, error) {
+	header := make([]byte, 8)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("invalid TIFF: %s", err)
+	}
+	d := tiffDecoder{r: r, seen: make(map[uint32]bool)}
+	switch {
+	case bytes.HasPrefix(header, tiffMagicLE):
+		d.order = binary.LittleEndian
+	case bytes.HasPrefix(header, tiffMagicBE):
+		d.order = binary.BigEndian
+	default:
+		return nil, errors.New("not a TIFF image")
+	}
+	d.next = d.order.Uint32(header[4:])
+	return &d, nil
+}
+
+// readIFD reads the next IFD, and io.EOF after the last.
+func (d *tiffDecoder) readIFD() (tiffIFD, error) {
+	if d.next == 0 {
+		return nil, io.EOF
+	}
+	if d.seen[d.next] {
+		return nil, errors.New("invalid TIFF: IFD loop")
+	}
+	d.seen[d.next] = true
+
+	countBytes := make([]byte, 2)
+	if _, err := d.r.ReadAt(countBytes, int64(d.next)); err != nil {
+		return nil, fmt.Errorf("invalid TIFF IFD: %s", err)
+	}
+	count := int(d.order.Uint16(countBytes))
+	entries := make([]byte, count*12+4)
+	if _, err := d.r.ReadAt(entries, int64(d.next)+2); err != nil {
+		return nil, fmt.Errorf("invalid TIFF IFD: %s", err)
+	}
+
+	ifd := make(tiffIFD)
+	for i := 0; i < count; i++ {
+		entry := entries[i*12 : i*12+12]
+		tag := d.order.Uint16(entry)
+		values, err := d.readValues(d.order.Uint16(entry[2:]), d.order.Uint32(entry[4:]), entry[8:12])
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIFF tag %d: %s", tag, err)
+		}
+		if values != nil {
+			ifd[tag] = values
+		}
+	}
+	d.next = d.order.Uint32(entries[count*12:])
+	return ifd, nil
+}
+
+// readValues reads the integer values of an entry; rationals are read as
+// numerator, denominator pairs. Other types are ignored.
+func (d *tiffDecoder) readValues(typ uint16, count uint32, inline []byte) ([]uint32, error) {
+	if count > tiffMaxEntries {
+		return nil, fmt.Errorf("%d values", count)
+	}
+	var size uint32
+	switch typ {
+	case 1: // BYTE
+		size = 1
+	case 3: // SHORT
+		size = 2
+	case 4: // LONG
+		size = 4
+	case 5: // RATIONAL
+		size, count = 4, count*2
+	default:
+		return nil, nil
+	}
+
+	data := inline
+	if size*count > 4 {
+		data = make([]byte, size*count)
+		if _, err := d.r.ReadAt(data, int64(d.order.Uint32(inline))); err != nil {
+			return nil, err
+		}
+	}
+	values := make([]uint32, count)
+	for i := range values {
+		switch size {
+		case 1:
+			values[i] = uint32(data[i])
+		case 2:
+			values[i] = uint32(d.order.Uint16(data[i*2:]))
+		case 4:
+			values[i] = d.order.Uint32(data[i*4:])
+		}
+	}
+	return values, nil
+}
+
+type tiffPage struct {
+	ifd                tiffIFD
+	width, height      int
+	bits, samples      int
+	compression        uint32
+	photometric        uint32
+	predictor          uint32
+	offsets, byteCount []uint32
+	rowsPerStrip       int
+}
+
+func (d *tiffDecoder) page(ifd tiffIFD) (*tiffPage, error) {
+	p := tiffPage{
+		ifd:          ifd,
+		width:        int(ifd.get(tiffImageWidth, 0)),
+		height:       int(ifd.get(tiffImageLength, 0)),
+		bits:         int(ifd.get(tiffBitsPerSample, 1)),
+		samples:      int(ifd.get(tiffSamplesPerPixel, 1)),
+		compression:  ifd.get(tiffCompression, tiffCompressionNone),
+		photometric:  ifd.get(tiffPhotometric, tiffBlackIsZero),
+		predictor:    ifd.get(tiffPredictor, 1),
+		offsets:      ifd[tiffStripOffsets],
+		byteCount:    ifd[tiffStripByteCounts],
+		rowsPerStrip: int(ifd.get(tiffRowsPerStrip, ifd.get(tiffImageLength, 0))),
+	}
+	switch {
+	case p.width <= 0 || p.height <= 0:
+		return nil, errors.New("invalid TIFF: missing image size")
+	case ifd[tiffTileWidth] != nil:
+		return nil, errors.New("tiled TIFF images are not supported")
+	case ifd.get(tiffPlanarConfig, 1) != 1:
+		return nil, errors.New("planar TIFF images are not supported")
+	case len(p.offsets) == 0 || len(p.offsets) != len(p.byteCount):
+		return nil, errors.New("invalid TIFF: bad strips")
+	case p.rowsPerStrip <= 0:
+		return nil, errors.New("invalid TIFF: bad rows per strip")
+	case p.samples < 1 || p.samples > 8:
+		return nil, fmt.Errorf("invalid TIFF: %d samples per pixel", p.samples)
+	}
+	switch {
+	case p.bits == 1 && (p.photometric == tiffWhiteIsZero || p.photometric == tiffBlackIsZero) && p.samples == 1:
+	case p.bits == 8 && (p.photometric == tiffWhiteIsZero || p.photometric == tiffBlackIsZero) && p.samples >= 1:
+	case p.bits == 8 && p.photometric == tiffPalette && p.samples == 1 && len(ifd[tiffColorMap]) == 3*256:
+	case p.bits == 8 && p.photometric == tiffRGB && p.samples >= 3:
+	case p.bits == 8 && p.photometric == tiffCMYK && p.samples >= 4:
+	default:
+		return nil, fmt.Errorf("%d bit TIFF images with %d samples and photometric interpretation %d are not supported", p.bits, p.samples, p.photometric)
+	}
+	return &p, nil
+}
+
+// resolution returns the DPI of a page, zero when not set.
+func (p *tiffPage) resolution() (int, int) {
+	dpi := func(tag uint16) int {
+		values := p.ifd[tag]
+		if len(values) != 2 || values[1] == 0 {
+			return 0
+		}
+		v := float64(values[0]) / float64(values[1])
+		switch p.ifd.get(tiffResolutionUnit, 2) {
+		case 2: // inch
+			return int(v + 0.5)
+		case 3: // centimeter
+			return int(v*2.54 + 0.5)
+		}
+		return 0
+	}
+	return dpi(tiffXResolution), dpi(tiffYResolution)
+}
+
+func (d *tiffDecoder) decode(p *tiffPage) (image.Image, error) {
+	rowBytes := (p.width*p.bits*p.samples + 7) / 8
+	if int64(rowBytes)*int64(p.height) > tiffMaxImageBytes {
+		return nil, fmt.Errorf("%dx%d TIFF image is too large", p.width, p.height)
+	}
+	data := make([]byte, 0, rowBytes*p.height)
+	for i, offset := range p.offsets {
+		rows := p.rowsPerStrip
+		if remaining := p.height - i*p.rowsPerStrip; remaining < rows {
+			rows = remaining
+		}
+		if rows <= 0 {
+			break
+		}
+		// Compression doesn't make any strip much larger than raw.
+		if int(p.byteCount[i]) > 2*rows*rowBytes+1024 {
+			return nil, fmt.Errorf("invalid TIFF strip %d: %d bytes", i, p.byteCount[i])
+		}
+		compressed := make([]byte, p.byteCount[i])
+		if _, err := d.r.ReadAt(compressed, int64(offset)); err != nil {
+			return nil, fmt.Errorf("invalid TIFF strip %d: %s", i, err)
+		}
+		strip, err := tiffDecompress(p.compression, compressed, rows*rowBytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TIFF strip %d: %s", i, err)
+		}
+		if len(strip) < rows*rowBytes {
+			return nil, fmt.Errorf("invalid TIFF strip %d: %d bytes, want %d", i, len(strip), rows*rowBytes)
+		}
+		strip = strip[:rows*rowBytes]
+		if p.predictor == 2 && p.bits == 8 {
+			for y := 0; y < rows; y++ {
+				row := strip[y*rowBytes : (y+1)*rowBytes]
+				for x := p.samples; x < len(row); x++ {
+					row[x] += row[x-p.samples]
+				}
+			}
+		}
+		data = append(data, strip...)
+	}
+	if len(data) < rowBytes*p.height {
+		return nil, errors.New("invalid TIFF: missing strips")
+	}
+
+	rect := image.Rect(0, 0, p.width, p.height)
+	switch p.photometric {
+	case tiffWhiteIsZero, tiffBlackIsZero:
+		img := image.NewGray(rect)
+		invert := p.photometric == tiffWhiteIsZero
+		for y := 0; y < p.height; y++ {
+			row := data[y*rowBytes:]
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < p.width; x++ {
+				var v byte
+				if p.bits == 1 {
+					if row[x/8]&(0x80>>uint(x%8)) != 0 {
+						v = 0xff
+					}
+				} else {
+					v = row[x*p.samples]
+				}
+				if invert {
+					v = 0xff - v
+				}
+				pix[x] = v
+			}
+		}
+		return img, nil
+	case tiffPalette:
+		colorMap := p.ifd[tiffColorMap]
+		palette := make(color.Palette, 256)
+		for i := range palette {
+			palette[i] = color.RGBA64{uint16(colorMap[i]), uint16(colorMap[256+i]), uint16(colorMap[512+i]), 0xffff}
+		}
+		img := image.NewPaletted(rect, palette)
+		for y := 0; y < p.height; y++ {
+			copy(img.Pix[y*img.Stride:], data[y*rowBytes:y*rowBytes+p.width])
+		}
+		return img, nil
+	case tiffRGB:
+		img := image.NewRGBA(rect)
+		alpha := p.samples >= 4
+		for y := 0; y < p.height; y++ {
+			row := data[y*rowBytes:]
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < p.width; x++ {
+				s := row[x*p.samples:]
+				pix[x*4], pix[x*4+1], pix[x*4+2], pix[x*4+3] = s[0], s[1], s[2], 0xff
+				if alpha {
+					// Composite unassociated alpha over white.
+					a := uint16(s[3])
+					for c := 0; c < 3; c++ {
+						pix[x*4+c] = byte((uint16(s[c])*a + 0xff*(0xff-a)) / 0xff)
+					}
+				}
+			}
+		}
+		return img, nil
+	default:
+		img := image.NewCMYK(rect)
+		for y := 0; y < p.height; y++ {
+			row := data[y*rowBytes:]
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < p.width; x++ {
+				copy(pix[x*4:x*4+4], row[x*p.samples:])
+			}
+		}
+		return img, nil
+	}
+}
+
+func tiffDecompress(compression uint32, data []byte, size int) ([]byte, error) {
+	switch compression {
+	case tiffCompressionNone:
+		return data, nil
+	case tiffCompressionLZW:
+		return tiffLZWDecode(data, size)
+	case tiffCompressionDeflate, tiffCompressionDeflate2:
+		r, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(io.LimitReader(r, int64(size)))
+	case tiffCompressionPackBits:
+		return packBitsDecode(data, size)
+	}
+	return nil, fmt.Errorf("TIFF compression %d is not supported", compression)
+}
+
+// tiffLZWDecode decodes TIFF LZW: MSB first codes of 9 to 12 bits, with the
+// code width growing one code early. Stops after size bytes.
+func tiffLZWDecode(data []byte, size int) ([]byte, error) {
+	const clearCode, eoiCode = 256, 257
+
+	out := make([]byte, 0, size)
+	table := make([][]byte, 258, 4096)
+	for i := 0; i < 256; i++ {
+		table[i] = []byte{byte(i)}
+	}
+	width := uint(9)
+	var bits uint32
+	var nBits uint
+	var prev []byte
+	for pos := 0; len(out) < size; {
+		for nBits < width && pos < len(data) {
+			bits = bits<<8 | uint32(data[pos])
+			nBits += 8
+			pos++
+		}
+		if nBits < width {
+			break
+		}
+		code := int(bits>>(nBits-width)) & (1<<width - 1)
+		nBits -= width
+
+		if code == clearCode {
+			table, width, prev = table[:258], 9, nil
+			continue
+		}
+		if code == eoiCode {
+			break
+		}
+		var entry []byte
+		switch {
+		case code < len(table) && table[code] != nil:
+			entry = table[code]
+		case code == len(table) && prev != nil:
+			entry = append(append(make([]byte, 0, len(prev)+1), prev...), prev[0])
+		default:
+			return nil, fmt.Errorf("invalid LZW code %d", code)
+		}
+		out = append(out, entry...)
+		if prev != nil && len(table) < 4096 {
+			table = append(table, append(append(make([]byte, 0, len(prev)+1), prev...), entry[0]))
+		}
+		prev = entry
+		if len(table)+1 >= 1<<width && width < 12 {
+			width++
+		}
+	}
+	return out, nil
+}
+
+func packBitsDecode(data []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	for i := 0; i < len(data) && len(out) < size; {
+		n := int(int8(data[i]))
+		i++
+		switch {
+		case n >= 0:
+			if i+n+1 > len(data) {
+				return nil, errors.New("truncated PackBits literal")
+			}
+			out = append(out, data[i:i+n+1]...)
+			i += n + 1
+		case n != -128:
+			if i >= len(data) {
+				return nil, errors.New("truncated PackBits run")
+			}
+			for j := 0; j < 1-n; j++ {
+				out = append(out, data[i])
+			}
+			i++
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,53 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const webhookTimeout = 10 * time.Second
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// PostWebhook posts v as JSON to url, and fails unless the response status
+// is 2xx.
+func PostWebhook(url string, v interface{}) error {
+	return PostWebhookToken(url, "", v)
+}
+
+// PostWebhookToken is PostWebhook with token as bearer token, unless it is
+// empty.
+func PostWebhookToken(url, token string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// JobInfoGetter is implemented by print systems that tell who submitted a
+// job, such as winspool.WinSpool.
+type JobInfoGetter interface {
+	GetJobInfo(printerName string, jobID uint32) (*lib.JobInfo, error)
+}
+
+// Accountant follows jobs from print system events, and records each job
+// to a sink once it is done or aborted.
+type Accountant struct {
+	jobs JobInfoGetter
+	sink lib.AccountingSink
+	now  func() time.Time
+
+	mutex sync.Mutex
+	infos map[uint32]*lib.JobInfo
+	// Pages rendered by this process, by job.
+	rendered map[uint32]int
+	// When jobs were recorded, for an hour, as finished jobs can be
+	// reported again.
+	recorded map[uint32]time.Time
+}
+
+// NewAccountant returns an accountant that looks jobs up in jobs.
+func NewAccountant(jobs JobInfoGetter, sink lib.AccountingSink) *Accountant {
+	return &Accountant{
+		jobs:     jobs,
+		sink:     sink,
+		now:      time.Now,
+		infos:    make(map[uint32]*lib.JobInfo),
+		rendered: make(map[uint32]int),
+		recorded: make(map[uint32]time.Time),
+	}
+}
+
+// Rendered notes the pages rendered for a job this process printed, which
+// are recorded when the spooler doesn't count pages.
+func (a *Accountant) Rendered(jobID uint32, pages int) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rendered[jobID] = pages
+}
+
+// Observe follows jobs, and records them once done or aborted. The job is
+// looked up when first seen and again when finished, as it may be deleted
+// from the queue by then.
+func (a *Accountant) Observe(event lib.Event) {
+	if event.JobID == 0 || event.JobState == nil || event.JobState.State == nil {
+		return
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if _, ok := a.recorded[event.JobID]; ok {
+		return
+	}
+	info, exists := a.infos[event.JobID]
+	if !exists {
+		info = &lib.JobInfo{Printer: event.Printer, JobID: event.JobID, Submitted: event.Time}
+		a.infos[event.JobID] = info
+		a.lookUp(info)
+	}
+	if p := event.JobState.PagesPrinted; p != nil && int(*p) > info.PagesPrinted {
+		info.PagesPrinted = int(*p)
+	}
+	if p := event.JobState.TotalPages; p != nil && int(*p) > info.TotalPages {
+		info.TotalPages = int(*p)
+	}
+
+	t := event.JobState.State.Type
+	if t != model.JobStateDone && t != model.JobStateAborted {
+		return
+	}
+	if exists {
+		a.lookUp(info)
+	}
+	record := lib.AccountingRecord{
+		Time:          event.Time,
+		JobInfo:       *info,
+		State:         t,
+		RenderedPages: a.rendered[event.JobID],
+	}
+	if record.Time.IsZero() {
+		record.Time = a.now()
+	}
+	delete(a.infos, event.JobID)
+	delete(a.rendered, event.JobID)
+	now := a.now()
+	for jobID, at := range a.recorded {
+		if now.Sub(at) > time.Hour {
+			delete(a.recorded, jobID)
+		}
+	}
+	a.recorded[event.JobID] = now
+	if err := a.sink.Record(record); err != nil {
+		log.Printf("Failed to record job %d on %s: %s", event.JobID, event.Printer, err)
+	}
+}
+
+// lookUp refreshes info from the print system, keeping what is known when
+// the job can't be found, and page counts that only grow.
+func (a *Accountant) lookUp(info *lib.JobInfo) {
+	found, err := a.jobs.GetJobInfo(info.Printer, info.JobID)
+	if err != nil {
+		return
+	}
+	if found.PagesPrinted < info.PagesPrinted {
+		found.PagesPrinted = info.PagesPrinted
+	}
+	if found.TotalPages < info.TotalPages {
+		found.TotalPages = info.TotalPages
+	}
+	if found.Submitted.IsZero() {
+		found.Submitted = info.Submitted
+	}
+	*info = *found
+}
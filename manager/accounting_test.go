@@ -0,0 +1,70 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type fakeJobInfos map[uint32]lib.JobInfo
+
+func (f fakeJobInfos) GetJobInfo(printerName string, jobID uint32) (*lib.JobInfo, error) {
+	info, ok := f[jobID]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return &info, nil
+}
+
+type fakeAccountingSink []lib.AccountingRecord
+
+func (f *fakeAccountingSink) Record(r lib.AccountingRecord) error {
+	*f = append(*f, r)
+	return nil
+}
+
+func (f *fakeAccountingSink) Close() error {
+	return nil
+}
+
+func TestAccountant(t *testing.T) {
+	jobs := fakeJobInfos{
+		1: {Printer: "a", JobID: 1, User: "alice", Document: "report.pdf", Color: true, TotalPages: 4},
+		2: {Printer: "a", JobID: 2, User: "bob", Document: "memo.txt"},
+	}
+	var sink fakeAccountingSink
+	a := NewAccountant(jobs, &sink)
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+
+	a.Observe(jobEvent(1, model.JobStateInProgress, 0))
+	a.Observe(jobEvent(2, model.JobStateInProgress, 0))
+	a.Rendered(2, 3)
+	a.Observe(jobEvent(1, model.JobStateInProgress, 2))
+	// Deleted from the queue once done: what was known is recorded.
+	delete(jobs, 1)
+	a.Observe(jobEvent(1, model.JobStateDone, 4))
+	a.Observe(jobEvent(2, model.JobStateDone, 0))
+	a.Observe(jobEvent(2, model.JobStateDone, 0))
+
+	if len(sink) != 2 {
+		t.Fatalf("expected 2 records, got %+v", sink)
+	}
+	if r := sink[0]; r.User != "alice" || r.Document != "report.pdf" || !r.Color || r.PagesPrinted != 4 || r.Pages() != 4 || !r.Time.Equal(now) {
+		t.Errorf("unexpected record of job 1: %+v", r)
+	}
+	if r := sink[1]; r.User != "bob" || r.RenderedPages != 3 || r.Pages() != 3 || r.State != model.JobStateDone {
+		t.Errorf("unexpected record of job 2: %+v", r)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"log"
+	"sync"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// EventRouter posts print system events to the webhooks of the routes that
+// match them. Routes can be changed while events are observed.
+type EventRouter struct {
+	// Tenants of the printers that have one, by printer name.
+	tenants map[string]string
+	post    func(url string, v interface{}) error
+
+	mutex  sync.Mutex
+	routes []lib.EventRoute
+}
+
+// NewEventRouter returns a router with routes, that knows the tenants of
+// printers.
+func NewEventRouter(routes []lib.EventRoute, printers map[string]lib.PrinterConfig) (*EventRouter, error) {
+	r := EventRouter{tenants: make(map[string]string), post: lib.PostWebhook}
+	for name, config := range printers {
+		if config.Tenant != "" {
+			r.tenants[name] = config.Tenant
+		}
+	}
+	for _, route := range routes {
+		if err := r.SetRoute(route); err != nil {
+			return nil, err
+		}
+	}
+	return &r, nil
+}
+
+// Routes returns the routes, in the order they were added.
+func (r *EventRouter) Routes() []lib.EventRoute {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]lib.EventRoute{}, r.routes...)
+}
+
+// SetRoute adds a route, or replaces the route with its name.
+func (r *EventRouter) SetRoute(route lib.EventRoute) error {
+	if err := route.Validate(); err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := range r.routes {
+		if r.routes[i].Name == route.Name {
+			r.routes[i] = route
+			return nil
+		}
+	}
+	r.routes = append(r.routes, route)
+	return nil
+}
+
+// DeleteRoute deletes a route, and tells whether it existed.
+func (r *EventRouter) DeleteRoute(name string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i := range r.routes {
+		if r.routes[i].Name == name {
+			r.routes = append(r.routes[:i], r.routes[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Route returns the event as posted by each route that matches it, with
+// their URLs.
+func (r *EventRouter) Route(event lib.Event) ([]lib.RoutedEvent, []string) {
+	tenant := r.tenants[event.Printer]
+	severity := event.Severity()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var events []lib.RoutedEvent
+	var urls []string
+	for i := range r.routes {
+		if r.routes[i].Matches(event, tenant) {
+			events = append(events, lib.RoutedEvent{Event: event, Route: r.routes[i].Name, Tenant: tenant, Severity: severity})
+			urls = append(urls, r.routes[i].URL)
+		}
+	}
+	return events, urls
+}
+
+// Observe posts an event to the routes that match it, in the background.
+// Failures are logged; events are not retried.
+func (r *EventRouter) Observe(event lib.Event) {
+	events, urls := r.Route(event)
+	for i := range events {
+		routed, url := events[i], urls[i]
+		go func() {
+			if err := r.post(url, routed); err != nil {
+				log.Printf("Failed to post %s event of %s to route %s: %s", routed.Type, routed.Printer, routed.Route, err)
+			}
+		}()
+	}
+}
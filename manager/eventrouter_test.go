@@ -0,0 +1,76 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestEventRouter(t *testing.T) {
+	r, err := NewEventRouter([]lib.EventRoute{
+		{Name: "all", URL: "http://hooks/all"},
+		{Name: "acme-errors", URL: "http://hooks/acme", Tenants: []string{"acme"}, MinSeverity: lib.EventSeverityError},
+		{Name: "labels", URL: "http://hooks/labels", Printers: []string{"Label*"}, Types: []lib.EventType{lib.EventJobStateChanged}},
+	}, map[string]lib.PrinterConfig{"a": {Tenant: "acme"}, "Label 1": {}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	posted := make(chan lib.RoutedEvent, 10)
+	r.post = func(url string, v interface{}) error {
+		posted <- v.(lib.RoutedEvent)
+		return nil
+	}
+
+	routes := func(event lib.Event) []string {
+		events, _ := r.Route(event)
+		var names []string
+		for _, e := range events {
+			names = append(names, e.Route)
+		}
+		return names
+	}
+	aborted := jobEvent(1, model.JobStateAborted, 0)
+	aborted.Type = lib.EventJobStateChanged
+	if names := routes(aborted); len(names) != 2 || names[0] != "all" || names[1] != "acme-errors" {
+		t.Errorf("expected all and acme-errors got %v", names)
+	}
+	label := jobEvent(2, model.JobStateDone, 1)
+	label.Type, label.Printer = lib.EventJobStateChanged, "Label 1"
+	if names := routes(label); len(names) != 2 || names[1] != "labels" {
+		t.Errorf("expected all and labels got %v", names)
+	}
+	label.Type = lib.EventJobProgress
+	if names := routes(label); len(names) != 1 {
+		t.Errorf("expected all got %v", names)
+	}
+
+	if err = r.SetRoute(lib.EventRoute{Name: "all", URL: "ftp://hooks"}); err == nil {
+		t.Error("expected an error for an ftp route")
+	}
+	if err = r.SetRoute(lib.EventRoute{Name: "all", URL: "http://hooks/all", MinSeverity: lib.EventSeverityWarning}); err != nil {
+		t.Fatal(err)
+	}
+	if !r.DeleteRoute("labels") || r.DeleteRoute("labels") {
+		t.Error("expected labels to be deleted once")
+	}
+	if routes := r.Routes(); len(routes) != 2 || routes[0].MinSeverity != lib.EventSeverityWarning {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+
+	r.Observe(label)
+	r.Observe(aborted)
+	for i := 0; i < 2; i++ {
+		if e := <-posted; e.JobID != 1 || e.Tenant != "acme" || e.Severity != lib.EventSeverityError {
+			t.Errorf("unexpected posted event %+v", e)
+		}
+	}
+}
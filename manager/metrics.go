@@ -0,0 +1,251 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+const (
+	metricsBucketDuration = time.Hour
+	// Hourly buckets kept per printer.
+	metricsBucketCount = 24
+)
+
+// MetricsBucket aggregates the jobs of a printer over a period.
+type MetricsBucket struct {
+	Start     time.Time `json:"start"`
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	// Sum and count of the times from job submission to the first printed page.
+	FirstPageMillis int64 `json:"first_page_ms"`
+	FirstPageCount  int   `json:"first_page_count"`
+	MaxQueueDepth   int   `json:"max_queue_depth"`
+}
+
+func (b *MetricsBucket) add(o *MetricsBucket) {
+	b.Completed += o.Completed
+	b.Failed += o.Failed
+	b.FirstPageMillis += o.FirstPageMillis
+	b.FirstPageCount += o.FirstPageCount
+	if o.MaxQueueDepth > b.MaxQueueDepth {
+		b.MaxQueueDepth = o.MaxQueueDepth
+	}
+}
+
+type printerMetrics struct {
+	// Oldest first, at most metricsBucketCount.
+	Buckets []MetricsBucket `json:"buckets"`
+	// Since the printer was first seen, kept when buckets are dropped.
+	Totals MetricsBucket `json:"totals"`
+}
+
+type metricsJob struct {
+	printer   string
+	added     time.Time
+	firstPage bool
+}
+
+// PrinterStats summarizes the metrics of a printer.
+type PrinterStats struct {
+	Printer    string `json:"printer"`
+	QueueDepth int    `json:"queue_depth"`
+	// Over the buckets kept, up to the last 24 hours.
+	JobsPerHour          float64         `json:"jobs_per_hour"`
+	AvgTimeToFirstPageMs int64           `json:"avg_time_to_first_page_ms"`
+	FailureRate          float64         `json:"failure_rate"`
+	MaxQueueDepth        int             `json:"max_queue_depth"`
+	Totals               MetricsBucket   `json:"totals"`
+	History              []MetricsBucket `json:"history"`
+}
+
+// Metrics tracks queue depth, throughput, time to first page and failures
+// per printer, from print system events. Aggregates are kept in hourly
+// buckets and can be saved to, and loaded from, a file.
+type Metrics struct {
+	filename string
+	now      func() time.Time
+
+	mutex    sync.Mutex
+	printers map[string]*printerMetrics
+	jobs     map[uint32]*metricsJob
+}
+
+// NewMetrics returns metrics loaded from filename, if it exists. With an
+// empty filename, metrics are only kept in memory.
+func NewMetrics(filename string) (*Metrics, error) {
+	m := Metrics{
+		filename: filename,
+		now:      time.Now,
+		printers: make(map[string]*printerMetrics),
+		jobs:     make(map[uint32]*metricsJob),
+	}
+	if filename == "" {
+		return &m, nil
+	}
+
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &m.printers); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Save writes the aggregates to the metrics file.
+func (m *Metrics) Save() error {
+	if m.filename == "" {
+		return nil
+	}
+
+	m.mutex.Lock()
+	b, err := json.Marshal(m.printers)
+	m.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := m.filename + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.filename)
+}
+
+// Observe accounts for an event.
+func (m *Metrics) Observe(event lib.Event) {
+	if event.JobID == 0 || event.JobState == nil || event.JobState.State == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	job, exists := m.jobs[event.JobID]
+	if !exists {
+		if event.Printer == "" {
+			return
+		}
+		job = &metricsJob{printer: event.Printer, added: now}
+		m.jobs[event.JobID] = job
+	}
+	bucket := m.bucket(job.printer, now)
+
+	if !job.firstPage && event.JobState.PagesPrinted != nil && *event.JobState.PagesPrinted > 0 {
+		job.firstPage = true
+		bucket.FirstPageMillis += int64(now.Sub(job.added) / time.Millisecond)
+		bucket.FirstPageCount++
+	}
+
+	switch event.JobState.State.Type {
+	case model.JobStateDone:
+		bucket.Completed++
+		delete(m.jobs, event.JobID)
+	case model.JobStateAborted:
+		bucket.Failed++
+		delete(m.jobs, event.JobID)
+	}
+
+	if depth := m.queueDepth(job.printer); depth > bucket.MaxQueueDepth {
+		bucket.MaxQueueDepth = depth
+	}
+}
+
+// bucket returns the current bucket of a printer, starting a new one, and
+// folding the oldest into the totals, as time passes.
+func (m *Metrics) bucket(printer string, now time.Time) *MetricsBucket {
+	pm, exists := m.printers[printer]
+	if !exists {
+		pm = &printerMetrics{Totals: MetricsBucket{Start: now}}
+		m.printers[printer] = pm
+	}
+
+	start := now.Truncate(metricsBucketDuration)
+	if n := len(pm.Buckets); n == 0 || pm.Buckets[n-1].Start.Before(start) {
+		pm.Buckets = append(pm.Buckets, MetricsBucket{Start: start})
+		for len(pm.Buckets) > metricsBucketCount {
+			pm.Totals.add(&pm.Buckets[0])
+			pm.Buckets = pm.Buckets[1:]
+		}
+	}
+	return &pm.Buckets[len(pm.Buckets)-1]
+}
+
+func (m *Metrics) queueDepth(printer string) int {
+	depth := 0
+	for _, job := range m.jobs {
+		if job.printer == printer {
+			depth++
+		}
+	}
+	return depth
+}
+
+// Stats returns the metrics of all printers, sorted by name.
+func (m *Metrics) Stats() []PrinterStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	stats := make([]PrinterStats, 0, len(m.printers))
+	for name, pm := range m.printers {
+		s := PrinterStats{
+			Printer:    name,
+			QueueDepth: m.queueDepth(name),
+			History:    append([]MetricsBucket{}, pm.Buckets...),
+		}
+
+		var window MetricsBucket
+		since := now.Add(-metricsBucketCount * metricsBucketDuration)
+		for i := range pm.Buckets {
+			if pm.Buckets[i].Start.After(since) {
+				window.add(&pm.Buckets[i])
+				if window.Start.IsZero() {
+					window.Start = pm.Buckets[i].Start
+				}
+			}
+		}
+		if !window.Start.IsZero() {
+			hours := now.Sub(window.Start).Hours()
+			if hours < 1 {
+				hours = 1
+			}
+			s.JobsPerHour = float64(window.Completed) / hours
+		}
+		if window.FirstPageCount > 0 {
+			s.AvgTimeToFirstPageMs = window.FirstPageMillis / int64(window.FirstPageCount)
+		}
+		if finished := window.Completed + window.Failed; finished > 0 {
+			s.FailureRate = float64(window.Failed) / float64(finished)
+		}
+		s.MaxQueueDepth = window.MaxQueueDepth
+
+		s.Totals = pm.Totals
+		for i := range pm.Buckets {
+			s.Totals.add(&pm.Buckets[i])
+		}
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Printer < stats[j].Printer })
+	return stats
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func jobEvent(jobID uint32, state model.JobStateType, pagesPrinted int32) lib.Event {
+	return lib.Event{
+		Printer:  "a",
+		JobID:    jobID,
+		JobState: &model.PrintJobStateDiff{State: &model.JobState{Type: state}, PagesPrinted: &pagesPrinted},
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "metrics.json")
+	m, err := NewMetrics(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	m.Observe(jobEvent(1, model.JobStateInProgress, 0))
+	m.Observe(jobEvent(2, model.JobStateInProgress, 0))
+	now = now.Add(4 * time.Second)
+	m.Observe(jobEvent(1, model.JobStateInProgress, 1))
+	m.Observe(jobEvent(1, model.JobStateDone, 2))
+	now = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.Observe(jobEvent(2, model.JobStateAborted, 0))
+
+	stats := m.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("expected stats of 1 printer got %d", len(stats))
+	}
+	s := stats[0]
+	if s.QueueDepth != 0 || s.MaxQueueDepth != 2 || s.Totals.Completed != 1 || s.Totals.Failed != 1 {
+		t.Errorf("unexpected counts %+v", s)
+	}
+	if s.AvgTimeToFirstPageMs != 4000 {
+		t.Errorf("expected 4s to first page got %dms", s.AvgTimeToFirstPageMs)
+	}
+	if s.FailureRate != 0.5 || s.JobsPerHour != 0.5 || len(s.History) != 2 {
+		t.Errorf("expected 0.5 failure rate and jobs per hour over 2 buckets got %+v", s)
+	}
+
+	if err = m.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewMetrics(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.now = m.now
+	if got := loaded.Stats(); len(got) != 1 || got[0].Totals != s.Totals {
+		t.Errorf("expected %+v after reload got %+v", s.Totals, got)
+	}
+}
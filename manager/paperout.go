@@ -0,0 +1,192 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// A job is interrupted by a paper out when its own status says so, or when
+// its printer runs out of paper while printing it; drivers often keep such
+// jobs printing. Once paper is loaded, the job has paperOutResumeTimeout to
+// show progress, after which it is restarted or reported as not resumed.
+
+// followInterruption starts or ends the interruption of a job from its new
+// state.
+func (pm *PrinterManager) followInterruption(tj *trackedJob, state *model.PrintJobStateDiff) {
+	if state.State == nil {
+		return
+	}
+	printerName := tj.job.NativePrinterName
+	if tj.interruption == nil {
+		if lib.IsJobPaperOut(state) || pm.paperOut[printerName] && state.State.Type == model.JobStateInProgress {
+			pm.interrupt(tj, state)
+		}
+		return
+	}
+
+	switch {
+	case state.State.Type == model.JobStateDone:
+		pm.endInterruption(tj, lib.JobRecoveryResumed)
+	case state.State.Type == model.JobStateAborted:
+		pm.endInterruption(tj, lib.JobRecoveryAborted)
+	case pm.paperOut[printerName]:
+		// Still out of paper.
+	case !tj.resumeBy.IsZero():
+		// Paper was loaded; wait for progress until resumeBy.
+		if pagesAdvanced(tj, state) {
+			pm.endInterruption(tj, lib.JobRecoveryResumed)
+		}
+	case !lib.IsJobPaperOut(state):
+		// The printer never reported the paper out, only the job did.
+		pm.endInterruption(tj, lib.JobRecoveryResumed)
+	}
+}
+
+func pagesAdvanced(tj *trackedJob, state *model.PrintJobStateDiff) bool {
+	return state.PagesPrinted != nil && tj.interruptedPages >= 0 && *state.PagesPrinted > tj.interruptedPages
+}
+
+func (pm *PrinterManager) interrupt(tj *trackedJob, state *model.PrintJobStateDiff) {
+	tj.interruption = &lib.JobInterruption{Reason: lib.JobInterruptionPaperOut, Start: time.Now()}
+	tj.interruptedPages = -1
+	if state.PagesPrinted != nil {
+		tj.interruptedPages = *state.PagesPrinted
+	}
+	tj.resumeBy = time.Time{}
+	log.Printf("Job %d on %s interrupted, out of paper", tj.nativeJobID, tj.job.NativePrinterName)
+	pm.reportInterruption(tj)
+}
+
+func (pm *PrinterManager) endInterruption(tj *trackedJob, recovery lib.JobRecovery) {
+	tj.interruption.End = time.Now()
+	tj.interruption.Recovery = recovery
+	log.Printf("Job %d on %s %s after %s out of paper", tj.nativeJobID, tj.job.NativePrinterName, recovery,
+		tj.interruption.End.Sub(tj.interruption.Start).Round(time.Second))
+	pm.reportInterruption(tj)
+	tj.interruption, tj.resumeBy = nil, time.Time{}
+}
+
+func (pm *PrinterManager) reportInterruption(tj *trackedJob) {
+	if tj.job.ReportInterruption == nil {
+		return
+	}
+	if err := tj.job.ReportInterruption(tj.job.JobID, *tj.interruption); err != nil {
+		log.Printf("Failed to report interruption of job %s: %s", tj.job.JobID, err)
+	}
+}
+
+// printerJobs returns the tracked jobs of a printer.
+func (pm *PrinterManager) printerJobs(printerName string) []*trackedJob {
+	pm.jobsMutex.Lock()
+	defer pm.jobsMutex.Unlock()
+
+	var jobs []*trackedJob
+	for _, tj := range pm.jobs {
+		if tj.job.NativePrinterName == printerName {
+			jobs = append(jobs, tj)
+		}
+	}
+	return jobs
+}
+
+// interruptJobs interrupts the jobs a printer is printing as it runs out of
+// paper.
+func (pm *PrinterManager) interruptJobs(printerName string) {
+	for _, tj := range pm.printerJobs(printerName) {
+		if tj.interruption != nil {
+			// Out of paper again before resuming.
+			tj.resumeBy = time.Time{}
+			continue
+		}
+		if tj.state != nil && tj.state.State != nil && tj.state.State.Type == model.JobStateInProgress {
+			pm.interrupt(tj, tj.state)
+		}
+	}
+}
+
+// paperLoaded gives the interrupted jobs of a printer time to resume.
+func (pm *PrinterManager) paperLoaded(printerName string) {
+	resumeBy := time.Now().Add(pm.paperOutResumeTimeout)
+	for _, tj := range pm.printerJobs(printerName) {
+		if tj.interruption != nil {
+			tj.resumeBy = resumeBy
+			if pm.resumeCheck == nil {
+				pm.resumeCheck = time.After(pm.paperOutResumeTimeout)
+			}
+		}
+	}
+}
+
+// checkResumed checks the interrupted jobs that are due to have resumed,
+// and restarts those that haven't.
+func (pm *PrinterManager) checkResumed() {
+	pm.jobsMutex.Lock()
+	jobs := make([]*trackedJob, 0, len(pm.jobs))
+	for _, tj := range pm.jobs {
+		jobs = append(jobs, tj)
+	}
+	pm.jobsMutex.Unlock()
+
+	now := time.Now()
+	var next time.Time
+	for _, tj := range jobs {
+		if tj.interruption == nil || tj.resumeBy.IsZero() {
+			continue
+		}
+		if now.Before(tj.resumeBy) {
+			if next.IsZero() || tj.resumeBy.Before(next) {
+				next = tj.resumeBy
+			}
+			continue
+		}
+
+		atomic.AddUint64(&pm.stats.GetJobStateCalls, 1)
+		state, err := pm.native.GetJobState(tj.job.NativePrinterName, tj.nativeJobID)
+		if err != nil {
+			log.Printf("Failed to get state of job %d on %s: %s", tj.nativeJobID, tj.job.NativePrinterName, err)
+			tj.resumeBy = now.Add(pm.paperOutResumeTimeout)
+			if next.IsZero() || tj.resumeBy.Before(next) {
+				next = tj.resumeBy
+			}
+			continue
+		}
+		pm.updateJob(tj, state)
+		if tj.interruption == nil {
+			continue
+		}
+		// No progress is visible without a page count; give the benefit of
+		// the doubt to jobs that print.
+		if state.State != nil && state.State.Type == model.JobStateInProgress && (state.PagesPrinted == nil || tj.interruptedPages < 0) {
+			pm.endInterruption(tj, lib.JobRecoveryResumed)
+			continue
+		}
+		pm.endInterruption(tj, pm.restartJob(tj))
+	}
+	if !next.IsZero() {
+		pm.resumeCheck = time.After(next.Sub(now))
+	}
+}
+
+func (pm *PrinterManager) restartJob(tj *trackedJob) lib.JobRecovery {
+	restarter, ok := pm.native.(JobRestarter)
+	if !pm.restartJobsAfterPaperOut || !ok {
+		return lib.JobRecoveryNotResumed
+	}
+	if err := restarter.RestartJob(tj.job.NativePrinterName, tj.nativeJobID); err != nil {
+		log.Printf("Failed to restart job %d on %s: %s", tj.nativeJobID, tj.job.NativePrinterName, err)
+		return lib.JobRecoveryNotResumed
+	}
+	return lib.JobRecoveryRestarted
+}
@@ -0,0 +1,533 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+const (
+	// Spooler notifications arrive in bursts (one per written page, etc);
+	// wait this long after the first one before syncing.
+	notificationSettleDelay = 500 * time.Millisecond
+
+	// Used instead of the configured interval when change notifications
+	// are unavailable.
+	fallbackPollInterval = 30 * time.Second
+)
+
+// NativePrintSystem is the subset of lib.NativePrintSystem that
+// PrinterManager relies on.
+type NativePrintSystem interface {
+	GetPrinters() ([]lib.Printer, error)
+	GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error)
+	ReleaseJob(printerName string, jobID uint32) error
+	WatchChanges(done <-chan struct{}) (<-chan lib.SpoolerChange, error)
+}
+
+// JobChangeWatcher is implemented by native print systems that report job
+// field values with their notifications. PrinterManager then follows jobs
+// from the notifications, instead of querying tracked jobs on every change.
+type JobChangeWatcher interface {
+	WatchJobChanges(done <-chan struct{}) (<-chan lib.JobChange, error)
+}
+
+// DeviceWatcher is implemented by native print systems that report printer
+// devices being plugged and unplugged. PrinterManager then syncs printers
+// right away, instead of waiting for the spooler to signal a change.
+type DeviceWatcher interface {
+	WatchDevices(done <-chan struct{}) (<-chan lib.DeviceChange, error)
+}
+
+// JobRestarter is implemented by native print systems that can print a job
+// again from the start.
+type JobRestarter interface {
+	RestartJob(printerName string, jobID uint32) error
+}
+
+// JobCanceler is implemented by native print systems that can delete a
+// job, which PrinterManager does with finished jobs for JobRetentionStore.
+type JobCanceler interface {
+	CancelJob(printerName string, jobID uint32) error
+}
+
+// HeldJobResumer is implemented by native print systems that can resume
+// the paused jobs of a printer.
+type HeldJobResumer interface {
+	ResumeHeldJobs(printerName string) (int, error)
+}
+
+type PrinterEventType string
+
+const (
+	PrinterAdded   PrinterEventType = "ADDED"
+	PrinterRemoved PrinterEventType = "REMOVED"
+	PrinterOnline  PrinterEventType = "ONLINE"
+	PrinterOffline PrinterEventType = "OFFLINE"
+	// The printer ran out of paper, or paper was loaded again.
+	PrinterPaperOut    PrinterEventType = "PAPER_OUT"
+	PrinterPaperLoaded PrinterEventType = "PAPER_LOADED"
+)
+
+// PrinterEvent reports a printer that appeared, disappeared, or went online
+// or offline, as seen by a sync.
+type PrinterEvent struct {
+	Printer string           `json:"printer"`
+	Type    PrinterEventType `json:"type"`
+}
+
+// Size of the printer event channel; events are dropped when it is full.
+const printerEventQueueSize = 64
+
+// Stats counts the work done against the spooler, so that notification-driven
+// sync can be compared against plain polling.
+type Stats struct {
+	Notifications    uint64 `json:"notifications"`
+	JobChanges       uint64 `json:"job_changes"`
+	DeviceChanges    uint64 `json:"device_changes"`
+	PrinterSyncs     uint64 `json:"printer_syncs"`
+	JobSyncs         uint64 `json:"job_syncs"`
+	Reconciliations  uint64 `json:"reconciliations"`
+	GetPrintersCalls uint64 `json:"get_printers_calls"`
+	GetJobStateCalls uint64 `json:"get_job_state_calls"`
+}
+
+type trackedJob struct {
+	job         *lib.Job
+	nativeJobID uint32
+	state       *model.PrintJobStateDiff
+
+	// Last values reported by WatchJobChanges.
+	status       *uint32
+	pagesPrinted *uint32
+
+	// Set while the job is interrupted, see followInterruption.
+	interruption *lib.JobInterruption
+	// Pages printed when the job was interrupted; -1 when unknown.
+	interruptedPages int32
+	// Time the job has to resume by, set once the condition clears.
+	resumeBy time.Time
+}
+
+// PrinterManager keeps printer and job state in sync with the spooler.
+type PrinterManager struct {
+	native            NativePrintSystem
+	printers          *lib.ConcurrentPrinterMap
+	reconcileInterval time.Duration
+	nativeJobQueue    uint
+	resumeHeldJobs    bool
+	jobRetention      lib.JobRetention
+
+	paperOutResumeTimeout    time.Duration
+	restartJobsAfterPaperOut bool
+	// Printers out of paper as of the last sync. Like the interruptions of
+	// tracked jobs, only used by the sync goroutine.
+	paperOut map[string]bool
+	// Fires when the next interrupted job is due to have resumed.
+	resumeCheck <-chan time.Time
+
+	events chan PrinterEvent
+
+	jobs      map[uint32]*trackedJob
+	jobsMutex sync.Mutex
+
+	stats Stats
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+func NewPrinterManager(native NativePrintSystem, config *lib.Config) (*PrinterManager, error) {
+	reconcileInterval, err := config.GetNativePrinterPollInterval()
+	if err != nil {
+		return nil, err
+	}
+	paperOutResumeTimeout, err := config.GetPaperOutResumeTimeout()
+	if err != nil {
+		return nil, err
+	}
+	if !config.JobRetention.Valid() {
+		return nil, fmt.Errorf("invalid job_retention %q", config.JobRetention)
+	}
+	if config.JobRetention == lib.JobRetentionStore {
+		if _, ok := native.(JobCanceler); !ok {
+			return nil, errors.New("job_retention store needs a print system that can delete jobs")
+		}
+	}
+
+	pm := PrinterManager{
+		native:            native,
+		printers:          lib.NewConcurrentPrinterMap(nil),
+		reconcileInterval: reconcileInterval,
+		nativeJobQueue:    config.NativeJobQueueSize,
+		resumeHeldJobs:    config.ResumeHeldJobsOnArrival,
+		jobRetention:      config.JobRetention,
+
+		paperOutResumeTimeout:    paperOutResumeTimeout,
+		restartJobsAfterPaperOut: config.RestartJobsAfterPaperOut,
+		paperOut:                 make(map[string]bool),
+
+		events: make(chan PrinterEvent, printerEventQueueSize),
+		jobs:   make(map[uint32]*trackedJob),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	// No events for the printers found at startup.
+	if err = pm.syncPrinters(false); err != nil {
+		return nil, err
+	}
+
+	go pm.run()
+
+	return &pm, nil
+}
+
+// Quit stops syncing and waits for the sync goroutine to exit.
+func (pm *PrinterManager) Quit() {
+	close(pm.quit)
+	<-pm.done
+}
+
+// GetPrinter gets a printer by native name.
+func (pm *PrinterManager) GetPrinter(name string) (lib.Printer, bool) {
+	return pm.printers.GetByNativeName(name)
+}
+
+// GetPrinters gets all printers, as of the last sync.
+func (pm *PrinterManager) GetPrinters() []lib.Printer {
+	return pm.printers.GetAll()
+}
+
+// PrinterEvents returns the channel printer events are sent to. Events are
+// dropped when nobody receives them.
+func (pm *PrinterManager) PrinterEvents() <-chan PrinterEvent {
+	return pm.events
+}
+
+// GetStats returns a snapshot of the spooler work counters.
+func (pm *PrinterManager) GetStats() Stats {
+	return Stats{
+		Notifications:    atomic.LoadUint64(&pm.stats.Notifications),
+		JobChanges:       atomic.LoadUint64(&pm.stats.JobChanges),
+		DeviceChanges:    atomic.LoadUint64(&pm.stats.DeviceChanges),
+		PrinterSyncs:     atomic.LoadUint64(&pm.stats.PrinterSyncs),
+		JobSyncs:         atomic.LoadUint64(&pm.stats.JobSyncs),
+		Reconciliations:  atomic.LoadUint64(&pm.stats.Reconciliations),
+		GetPrintersCalls: atomic.LoadUint64(&pm.stats.GetPrintersCalls),
+		GetJobStateCalls: atomic.LoadUint64(&pm.stats.GetJobStateCalls),
+	}
+}
+
+// TrackJob follows the state of a native job, calling job.UpdateJob whenever
+// it changes, until the job is done or aborted.
+func (pm *PrinterManager) TrackJob(job *lib.Job, nativeJobID uint32) {
+	pm.jobsMutex.Lock()
+	defer pm.jobsMutex.Unlock()
+
+	pm.jobs[nativeJobID] = &trackedJob{job: job, nativeJobID: nativeJobID, interruptedPages: -1}
+}
+
+func (pm *PrinterManager) run() {
+	defer close(pm.done)
+
+	changes, err := pm.native.WatchChanges(pm.quit)
+	interval := pm.reconcileInterval
+	if err != nil {
+		log.Printf("Spooler change notifications unavailable, polling every %s: %s", fallbackPollInterval, err)
+		changes = nil
+		if interval > fallbackPollInterval {
+			interval = fallbackPollInterval
+		}
+	}
+
+	var jobChanges <-chan lib.JobChange
+	if watcher, ok := pm.native.(JobChangeWatcher); ok && changes != nil {
+		if jobChanges, err = watcher.WatchJobChanges(pm.quit); err != nil {
+			log.Printf("Spooler job notifications unavailable, querying jobs on change: %s", err)
+			jobChanges = nil
+		}
+	}
+
+	var deviceChanges <-chan lib.DeviceChange
+	if watcher, ok := pm.native.(DeviceWatcher); ok {
+		if deviceChanges, err = watcher.WatchDevices(pm.quit); err != nil {
+			log.Printf("Device notifications unavailable: %s", err)
+			deviceChanges = nil
+		}
+	}
+
+	reconcile := time.NewTicker(interval)
+	defer func() { reconcile.Stop() }()
+
+	var pending lib.SpoolerChange
+	var settle <-chan time.Time
+
+	for {
+		select {
+		case <-pm.quit:
+			return
+
+		case change, ok := <-changes:
+			if !ok {
+				log.Printf("Spooler change notifications stopped, polling every %s", fallbackPollInterval)
+				changes = nil
+				if interval > fallbackPollInterval {
+					reconcile.Stop()
+					reconcile = time.NewTicker(fallbackPollInterval)
+				}
+				continue
+			}
+			atomic.AddUint64(&pm.stats.Notifications, 1)
+			pending |= change
+			if settle == nil {
+				settle = time.After(notificationSettleDelay)
+			}
+
+		case change, ok := <-jobChanges:
+			if !ok {
+				log.Print("Spooler job notifications stopped, querying jobs on change")
+				jobChanges = nil
+				continue
+			}
+			atomic.AddUint64(&pm.stats.JobChanges, 1)
+			pm.applyJobChange(change)
+
+		case change, ok := <-deviceChanges:
+			if !ok {
+				log.Print("Device notifications stopped")
+				deviceChanges = nil
+				continue
+			}
+			atomic.AddUint64(&pm.stats.DeviceChanges, 1)
+			if err := pm.syncPrinters(true); err != nil {
+				log.Printf("Failed to sync printers after device %s: %s", change.Event, err)
+			}
+			// The spooler may take a moment to update the queue; sync again.
+			pending |= lib.SpoolerChangePrinter
+			if settle == nil {
+				settle = time.After(notificationSettleDelay)
+			}
+
+		case <-settle:
+			if pending&lib.SpoolerChangePrinter != 0 {
+				if err := pm.syncPrinters(true); err != nil {
+					log.Printf("Failed to sync printers: %s", err)
+				}
+			}
+			if pending&lib.SpoolerChangeJob != 0 && jobChanges == nil {
+				pm.syncJobs()
+			}
+			pending, settle = 0, nil
+
+		case <-pm.resumeCheck:
+			pm.resumeCheck = nil
+			pm.checkResumed()
+
+		case <-reconcile.C:
+			atomic.AddUint64(&pm.stats.Reconciliations, 1)
+			if err := pm.syncPrinters(true); err != nil {
+				log.Printf("Failed to reconcile printers: %s", err)
+			}
+			pm.syncJobs()
+		}
+	}
+}
+
+// syncPrinters refreshes printers, and with notify, sends events for the
+// printers that changed.
+func (pm *PrinterManager) syncPrinters(notify bool) error {
+	atomic.AddUint64(&pm.stats.PrinterSyncs, 1)
+	atomic.AddUint64(&pm.stats.GetPrintersCalls, 1)
+
+	printers, err := pm.native.GetPrinters()
+	if err != nil {
+		return err
+	}
+
+	var events []PrinterEvent
+	seen := make(map[string]bool, len(printers))
+	paperOut := make(map[string]bool)
+	for i := range printers {
+		seen[printers[i].Name] = true
+		old, exists := pm.printers.GetByNativeName(printers[i].Name)
+		switch {
+		case !exists:
+			events = append(events, PrinterEvent{Printer: printers[i].Name, Type: PrinterAdded})
+		case old.Offline && !printers[i].Offline:
+			events = append(events, PrinterEvent{Printer: printers[i].Name, Type: PrinterOnline})
+		case !old.Offline && printers[i].Offline:
+			events = append(events, PrinterEvent{Printer: printers[i].Name, Type: PrinterOffline})
+		}
+		if lib.IsPaperOut(printers[i].State) {
+			paperOut[printers[i].Name] = true
+		}
+		if exists && paperOut[printers[i].Name] != pm.paperOut[printers[i].Name] {
+			eventType := PrinterPaperLoaded
+			if paperOut[printers[i].Name] {
+				eventType = PrinterPaperOut
+			}
+			events = append(events, PrinterEvent{Printer: printers[i].Name, Type: eventType})
+		}
+
+		// Don't lose track of the semaphore of printers that may be printing.
+		if old, exists := pm.printers.GetByNativeName(printers[i].Name); exists && old.NativeJobSemaphore != nil {
+			printers[i].NativeJobSemaphore = old.NativeJobSemaphore
+		} else {
+			printers[i].NativeJobSemaphore = lib.NewSemaphore(pm.nativeJobQueue)
+		}
+	}
+	for _, old := range pm.printers.GetAll() {
+		if !seen[old.Name] {
+			events = append(events, PrinterEvent{Printer: old.Name, Type: PrinterRemoved})
+		}
+	}
+	pm.printers.Refresh(printers)
+	pm.paperOut = paperOut
+
+	if !notify {
+		return nil
+	}
+	for _, event := range events {
+		if pm.resumeHeldJobs && (event.Type == PrinterOnline || event.Type == PrinterAdded) {
+			pm.resumeJobs(event.Printer)
+		}
+		switch event.Type {
+		case PrinterPaperOut:
+			pm.interruptJobs(event.Printer)
+		case PrinterPaperLoaded:
+			pm.paperLoaded(event.Printer)
+		}
+		select {
+		case pm.events <- event:
+		default:
+			log.Printf("Printer event queue full, dropped %s %s", event.Printer, event.Type)
+		}
+	}
+	return nil
+}
+
+func (pm *PrinterManager) resumeJobs(printerName string) {
+	resumer, ok := pm.native.(HeldJobResumer)
+	if !ok {
+		return
+	}
+	resumed, err := resumer.ResumeHeldJobs(printerName)
+	if err != nil {
+		log.Printf("Failed to resume held jobs on %s: %s", printerName, err)
+	}
+	if resumed > 0 {
+		log.Printf("Resumed %d held jobs on %s, back online", resumed, printerName)
+	}
+}
+
+// syncJobs refreshes the state of all tracked jobs, and stops tracking jobs
+// that reached a final state.
+func (pm *PrinterManager) syncJobs() {
+	pm.jobsMutex.Lock()
+	jobs := make([]*trackedJob, 0, len(pm.jobs))
+	for _, tj := range pm.jobs {
+		jobs = append(jobs, tj)
+	}
+	pm.jobsMutex.Unlock()
+
+	if len(jobs) == 0 {
+		return
+	}
+	atomic.AddUint64(&pm.stats.JobSyncs, 1)
+
+	for _, tj := range jobs {
+		atomic.AddUint64(&pm.stats.GetJobStateCalls, 1)
+		state, err := pm.native.GetJobState(tj.job.NativePrinterName, tj.nativeJobID)
+		if err != nil {
+			log.Printf("Failed to get state of job %d on %s: %s", tj.nativeJobID, tj.job.NativePrinterName, err)
+			continue
+		}
+
+		pm.updateJob(tj, state)
+	}
+}
+
+// applyJobChange updates a tracked job from the values of a job notification.
+func (pm *PrinterManager) applyJobChange(change lib.JobChange) {
+	pm.jobsMutex.Lock()
+	tj, exists := pm.jobs[change.JobID]
+	pm.jobsMutex.Unlock()
+	if !exists || (change.PrinterName != "" && change.PrinterName != tj.job.NativePrinterName) {
+		return
+	}
+
+	if change.Status != nil {
+		tj.status = change.Status
+	}
+	if change.PagesPrinted != nil {
+		tj.pagesPrinted = change.PagesPrinted
+	}
+	if tj.status == nil {
+		// Not enough to tell the state yet.
+		return
+	}
+
+	state := model.PrintJobStateDiff{State: lib.ConvertJobStatus(*tj.status)}
+	if tj.pagesPrinted != nil {
+		pagesPrinted := int32(*tj.pagesPrinted)
+		state.PagesPrinted = &pagesPrinted
+	}
+	pm.updateJob(tj, &state)
+}
+
+// updateJob reports a changed job state, and stops tracking the job once it
+// reaches a final state, releasing or deleting it as the job retention
+// says. Held jobs stay tracked and in the queue until released.
+func (pm *PrinterManager) updateJob(tj *trackedJob, state *model.PrintJobStateDiff) {
+	if !reflect.DeepEqual(state, tj.state) {
+		tj.state = state
+		if tj.job.UpdateJob != nil {
+			if err := tj.job.UpdateJob(tj.job.JobID, state); err != nil {
+				log.Printf("Failed to update job %s: %s", tj.job.JobID, err)
+			}
+		}
+	}
+	pm.followInterruption(tj, state)
+
+	if state.State != nil && (state.State.Type == model.JobStateDone || state.State.Type == model.JobStateAborted) {
+		pm.jobsMutex.Lock()
+		delete(pm.jobs, tj.nativeJobID)
+		pm.jobsMutex.Unlock()
+
+		pm.retireJob(tj)
+	}
+}
+
+// retireJob releases or deletes a finished job, or leaves it retained in
+// the Windows queue.
+func (pm *PrinterManager) retireJob(tj *trackedJob) {
+	if tj.state != nil && tj.state.State != nil && tj.state.State.Type == model.JobStateHeld {
+		return
+	}
+	switch {
+	case pm.jobRetention.KeepsInSpooler():
+	case pm.jobRetention == lib.JobRetentionStore:
+		if err := pm.native.(JobCanceler).CancelJob(tj.job.NativePrinterName, tj.nativeJobID); err != nil {
+			log.Printf("Failed to delete job %d on %s: %s", tj.nativeJobID, tj.job.NativePrinterName, err)
+		}
+	default:
+		if err := pm.native.ReleaseJob(tj.job.NativePrinterName, tj.nativeJobID); err != nil {
+			log.Printf("Failed to release job %d on %s: %s", tj.nativeJobID, tj.job.NativePrinterName, err)
+		}
+	}
+}
@@ -0,0 +1,414 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type testNative struct {
+	mutex    sync.Mutex
+	printers []lib.Printer
+	jobState model.JobStateType
+	released []uint32
+	changes  chan lib.SpoolerChange
+}
+
+func (n *testNative) GetPrinters() ([]lib.Printer, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return append([]lib.Printer{}, n.printers...), nil
+}
+
+func (n *testNative) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	return &model.PrintJobStateDiff{State: &model.JobState{Type: n.jobState}}, nil
+}
+
+func (n *testNative) ReleaseJob(printerName string, jobID uint32) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.released = append(n.released, jobID)
+	return nil
+}
+
+func (n *testNative) WatchChanges(done <-chan struct{}) (<-chan lib.SpoolerChange, error) {
+	return n.changes, nil
+}
+
+func TestNotificationsDriveSync(t *testing.T) {
+	native := &testNative{
+		printers: []lib.Printer{{Name: "a"}},
+		jobState: model.JobStateInProgress,
+		changes:  make(chan lib.SpoolerChange, 10),
+	}
+	pm, err := NewPrinterManager(native, &lib.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+
+	if _, exists := pm.GetPrinter("a"); !exists {
+		t.Fatal("printer a missing after initial sync")
+	}
+
+	updates := make(chan model.JobStateType, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "a",
+		JobID:             "job",
+		UpdateJob: func(jobID string, diff *model.PrintJobStateDiff) error {
+			updates <- diff.State.Type
+			return nil
+		},
+	}, 7)
+
+	native.mutex.Lock()
+	native.printers = append(native.printers, lib.Printer{Name: "b"})
+	native.mutex.Unlock()
+
+	// A burst of notifications should result in a single sync.
+	for i := 0; i < 5; i++ {
+		native.changes <- lib.SpoolerChangePrinter | lib.SpoolerChangeJob
+	}
+
+	select {
+	case state := <-updates:
+		if state != model.JobStateInProgress {
+			t.Fatalf("expected %s got %s", model.JobStateInProgress, state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job update not received")
+	}
+
+	if _, exists := pm.GetPrinter("b"); !exists {
+		t.Fatal("printer b missing after notification")
+	}
+
+	native.mutex.Lock()
+	native.jobState = model.JobStateDone
+	native.mutex.Unlock()
+	native.changes <- lib.SpoolerChangeJob
+
+	select {
+	case state := <-updates:
+		if state != model.JobStateDone {
+			t.Fatalf("expected %s got %s", model.JobStateDone, state)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job update not received")
+	}
+
+	stats := pm.GetStats()
+	if stats.Notifications != 6 {
+		t.Errorf("expected 6 notifications got %d", stats.Notifications)
+	}
+	if stats.GetPrintersCalls != 2 {
+		t.Errorf("expected 2 GetPrinters calls got %d", stats.GetPrintersCalls)
+	}
+}
+
+type testJobNative struct {
+	testNative
+	jobChanges chan lib.JobChange
+}
+
+func (n *testJobNative) WatchJobChanges(done <-chan struct{}) (<-chan lib.JobChange, error) {
+	return n.jobChanges, nil
+}
+
+func TestJobChangesReplaceQueries(t *testing.T) {
+	native := &testJobNative{
+		testNative: testNative{
+			printers: []lib.Printer{{Name: "a"}},
+			changes:  make(chan lib.SpoolerChange, 10),
+		},
+		jobChanges: make(chan lib.JobChange, 10),
+	}
+	pm, err := NewPrinterManager(native, &lib.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+
+	updates := make(chan *model.PrintJobStateDiff, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "a",
+		JobID:             "job",
+		UpdateJob: func(jobID string, diff *model.PrintJobStateDiff) error {
+			updates <- diff
+			return nil
+		},
+	}, 7)
+
+	expect := func(state model.JobStateType, pagesPrinted int32) {
+		t.Helper()
+		select {
+		case diff := <-updates:
+			if diff.State.Type != state || diff.PagesPrinted == nil || *diff.PagesPrinted != pagesPrinted {
+				t.Fatalf("expected %s with %d pages printed got %+v", state, pagesPrinted, diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("job update not received")
+		}
+	}
+
+	printing, printed, pages := lib.JobStatusPrinting, lib.JobStatusPrinted, uint32(1)
+	native.changes <- lib.SpoolerChangeJob
+	native.jobChanges <- lib.JobChange{PrinterName: "a", JobID: 7, Status: &printing, PagesPrinted: &pages}
+	expect(model.JobStateInProgress, 1)
+
+	// Values missing from a notification are kept from the previous ones.
+	pages2 := uint32(2)
+	native.jobChanges <- lib.JobChange{JobID: 7, PagesPrinted: &pages2}
+	expect(model.JobStateInProgress, 2)
+
+	// Other jobs are ignored.
+	native.jobChanges <- lib.JobChange{JobID: 8, Status: &printed}
+	native.jobChanges <- lib.JobChange{JobID: 7, Status: &printed}
+	expect(model.JobStateDone, 2)
+
+	// Give a pending settle delay time to pass.
+	time.Sleep(2 * notificationSettleDelay)
+	native.mutex.Lock()
+	released := append([]uint32{}, native.released...)
+	native.mutex.Unlock()
+	if len(released) != 1 || released[0] != 7 {
+		t.Errorf("expected job 7 released got %v", released)
+	}
+	if stats := pm.GetStats(); stats.GetJobStateCalls != 0 || stats.JobChanges != 4 {
+		t.Errorf("expected 4 job changes without GetJobState calls, got %+v", stats)
+	}
+}
+
+func TestHeldJobsStayTracked(t *testing.T) {
+	native := &testJobNative{
+		testNative: testNative{
+			printers: []lib.Printer{{Name: "a"}},
+			changes:  make(chan lib.SpoolerChange, 10),
+		},
+		jobChanges: make(chan lib.JobChange, 10),
+	}
+	pm, err := NewPrinterManager(native, &lib.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+
+	updates := make(chan *model.PrintJobStateDiff, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "a",
+		JobID:             "job",
+		UpdateJob: func(jobID string, diff *model.PrintJobStateDiff) error {
+			updates <- diff
+			return nil
+		},
+	}, 7)
+
+	paused := lib.JobStatusPaused
+	native.changes <- lib.SpoolerChangeJob
+	native.jobChanges <- lib.JobChange{PrinterName: "a", JobID: 7, Status: &paused}
+	select {
+	case diff := <-updates:
+		if diff.State.Type != model.JobStateHeld {
+			t.Fatalf("expected a paused job held got %+v", diff.State)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("job update not received")
+	}
+
+	time.Sleep(2 * notificationSettleDelay)
+	native.mutex.Lock()
+	released := append([]uint32{}, native.released...)
+	native.mutex.Unlock()
+	if len(released) != 0 {
+		t.Errorf("expected a held job not released got %v", released)
+	}
+	pm.jobsMutex.Lock()
+	_, tracked := pm.jobs[7]
+	pm.jobsMutex.Unlock()
+	if !tracked {
+		t.Error("expected a held job still tracked")
+	}
+}
+
+type testPaperNative struct {
+	testNative
+	pagesPrinted int32
+	restarted    []uint32
+}
+
+func (n *testPaperNative) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	pagesPrinted := n.pagesPrinted
+	return &model.PrintJobStateDiff{State: &model.JobState{Type: n.jobState}, PagesPrinted: &pagesPrinted}, nil
+}
+
+func (n *testPaperNative) RestartJob(printerName string, jobID uint32) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.restarted = append(n.restarted, jobID)
+	return nil
+}
+
+func (n *testPaperNative) setPaperOut(paperOut bool) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.printers[0].State = &model.PrinterStateSection{State: model.CloudDeviceStateIdle}
+	if paperOut {
+		n.printers[0].State.InputTrayState = &model.InputTrayState{Item: []model.InputTrayStateItem{{VendorID: "paper", State: model.InputTrayStateEmpty}}}
+	}
+}
+
+func TestPaperOutRestart(t *testing.T) {
+	native := &testPaperNative{
+		testNative: testNative{
+			printers: []lib.Printer{{Name: "a"}},
+			jobState: model.JobStateInProgress,
+			changes:  make(chan lib.SpoolerChange, 10),
+		},
+		pagesPrinted: 1,
+	}
+	config := lib.DefaultConfig
+	config.PaperOutResumeTimeout = "100ms"
+	config.RestartJobsAfterPaperOut = true
+	pm, err := NewPrinterManager(native, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+
+	interruptions := make(chan lib.JobInterruption, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "a",
+		JobID:             "job",
+		ReportInterruption: func(jobID string, interruption lib.JobInterruption) error {
+			interruptions <- interruption
+			return nil
+		},
+	}, 7)
+	expectEvent := func(eventType PrinterEventType) {
+		t.Helper()
+		select {
+		case event := <-pm.PrinterEvents():
+			if event.Type != eventType {
+				t.Fatalf("expected %s got %s", eventType, event.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s event not received", eventType)
+		}
+	}
+	expectInterruption := func(recovery lib.JobRecovery) {
+		t.Helper()
+		select {
+		case interruption := <-interruptions:
+			if interruption.Reason != lib.JobInterruptionPaperOut || interruption.Recovery != recovery {
+				t.Fatalf("expected interruption with recovery %q got %+v", recovery, interruption)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("interruption not reported")
+		}
+	}
+
+	native.changes <- lib.SpoolerChangeJob
+	time.Sleep(2 * notificationSettleDelay)
+
+	// The spooler keeps printing the job while the printer is out of paper.
+	native.setPaperOut(true)
+	native.changes <- lib.SpoolerChangePrinter
+	expectEvent(PrinterPaperOut)
+	expectInterruption("")
+
+	// Paper is loaded, but no more pages get printed.
+	native.setPaperOut(false)
+	native.changes <- lib.SpoolerChangePrinter
+	expectEvent(PrinterPaperLoaded)
+	expectInterruption(lib.JobRecoveryRestarted)
+
+	native.mutex.Lock()
+	restarted := append([]uint32{}, native.restarted...)
+	native.mutex.Unlock()
+	if len(restarted) != 1 || restarted[0] != 7 {
+		t.Errorf("expected job 7 restarted got %v", restarted)
+	}
+}
+
+type testCancelNative struct {
+	testNative
+	cancelled []uint32
+}
+
+func (n *testCancelNative) CancelJob(printerName string, jobID uint32) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.cancelled = append(n.cancelled, jobID)
+	return nil
+}
+
+func TestJobRetention(t *testing.T) {
+	for _, test := range []struct {
+		retention           lib.JobRetention
+		released, cancelled int
+	}{
+		{lib.JobRetentionDefault, 1, 0},
+		{lib.JobRetentionStore, 0, 1},
+		{lib.JobRetentionSpooler, 0, 0},
+		{lib.JobRetentionBoth, 0, 0},
+	} {
+		native := &testCancelNative{testNative: testNative{
+			printers: []lib.Printer{{Name: "a"}},
+			jobState: model.JobStateDone,
+			changes:  make(chan lib.SpoolerChange, 10),
+		}}
+		config := lib.DefaultConfig
+		config.JobRetention = test.retention
+		pm, err := NewPrinterManager(native, &config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan struct{})
+		pm.TrackJob(&lib.Job{
+			NativePrinterName: "a",
+			JobID:             "job",
+			UpdateJob: func(jobID string, diff *model.PrintJobStateDiff) error {
+				close(done)
+				return nil
+			},
+		}, 7)
+		native.changes <- lib.SpoolerChangeJob
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("job update not received")
+		}
+		pm.Quit()
+
+		native.mutex.Lock()
+		if len(native.released) != test.released || len(native.cancelled) != test.cancelled {
+			t.Errorf("job_retention %q: expected %d released and %d deleted got %v and %v", test.retention, test.released, test.cancelled, native.released, native.cancelled)
+		}
+		native.mutex.Unlock()
+	}
+
+	config := lib.DefaultConfig
+	config.JobRetention = "forever"
+	if _, err := NewPrinterManager(&testCancelNative{}, &config); err == nil {
+		t.Error("expected error for an unknown job_retention")
+	}
+	config.JobRetention = lib.JobRetentionStore
+	if _, err := NewPrinterManager(&testNative{}, &config); err == nil {
+		t.Error("expected error for job_retention store without a way to delete jobs")
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type SLABreachType string
+
+const (
+	// The first page wasn't printed in time.
+	SLABreachStart SLABreachType = "START"
+	// The job wasn't done in time.
+	SLABreachFinish SLABreachType = "FINISH"
+)
+
+// SLABreach reports a job that missed the service level of its printer.
+type SLABreach struct {
+	Type      SLABreachType            `json:"type"`
+	Printer   string                   `json:"printer"`
+	JobID     uint32                   `json:"job_id"`
+	Submitted time.Time                `json:"submitted"`
+	Limit     string                   `json:"limit"`
+	Elapsed   string                   `json:"elapsed"`
+	JobState  *model.PrintJobStateDiff `json:"job_state,omitempty"`
+}
+
+func (b SLABreach) String() string {
+	return fmt.Sprintf("job %d on %s missed its %s SLA of %s, %s after submission", b.JobID, b.Printer, b.Type, b.Limit, b.Elapsed)
+}
+
+type sla struct {
+	startWithin, finishWithin time.Duration
+}
+
+type slaJob struct {
+	printer   string
+	submitted time.Time
+	started   bool
+	state     *model.PrintJobStateDiff
+	// Breaches already reported.
+	reported map[SLABreachType]bool
+}
+
+// SLAMonitor follows jobs from print system events, and reports the jobs
+// that don't start or finish within the limits configured for their printer.
+type SLAMonitor struct {
+	slas map[string]sla
+	now  func() time.Time
+
+	mutex sync.Mutex
+	jobs  map[uint32]*slaJob
+	// Breaches found by Observe, until the next check.
+	pending []SLABreach
+}
+
+// NewSLAMonitor returns a monitor of the printers with an SLA in printers.
+func NewSLAMonitor(printers map[string]lib.PrinterConfig) (*SLAMonitor, error) {
+	m := SLAMonitor{
+		slas: make(map[string]sla),
+		now:  time.Now,
+		jobs: make(map[uint32]*slaJob),
+	}
+	for name, config := range printers {
+		if config.SLA == nil {
+			continue
+		}
+		startWithin, err := config.SLA.GetStartWithin()
+		if err != nil {
+			return nil, fmt.Errorf("invalid sla.start_within of printer %s: %s", name, err)
+		}
+		finishWithin, err := config.SLA.GetFinishWithin()
+		if err != nil {
+			return nil, fmt.Errorf("invalid sla.finish_within of printer %s: %s", name, err)
+		}
+		if startWithin > 0 || finishWithin > 0 {
+			m.slas[name] = sla{startWithin, finishWithin}
+		}
+	}
+	return &m, nil
+}
+
+// Observe follows the jobs of printers with an SLA.
+func (m *SLAMonitor) Observe(event lib.Event) {
+	if event.JobID == 0 || event.JobState == nil || event.JobState.State == nil {
+		return
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	at := event.Time
+	if at.IsZero() {
+		at = m.now()
+	}
+	job, exists := m.jobs[event.JobID]
+	if !exists {
+		if _, ok := m.slas[event.Printer]; !ok {
+			return
+		}
+		job = &slaJob{printer: event.Printer, submitted: at, reported: make(map[SLABreachType]bool)}
+		m.jobs[event.JobID] = job
+	}
+	job.state = event.JobState
+	limits := m.slas[job.printer]
+	// Jobs that start or end late are reported as they do, since the next
+	// check would no longer see them late.
+	terminal := event.JobState.State.Type == model.JobStateDone || event.JobState.State.Type == model.JobStateAborted
+	if !job.started && (terminal || event.JobState.PagesPrinted != nil && *event.JobState.PagesPrinted > 0) {
+		m.pending = m.checkBreach(m.pending, event.JobID, job, SLABreachStart, limits.startWithin, at)
+		job.started = true
+	}
+	if terminal {
+		m.pending = m.checkBreach(m.pending, event.JobID, job, SLABreachFinish, limits.finishWithin, at)
+		delete(m.jobs, event.JobID)
+	}
+}
+
+// checkBreach adds the breach of limit by a job at a time to breaches,
+// unless it is within limit or already reported.
+func (m *SLAMonitor) checkBreach(breaches []SLABreach, jobID uint32, job *slaJob, breachType SLABreachType, limit time.Duration, at time.Time) []SLABreach {
+	elapsed := at.Sub(job.submitted)
+	if limit <= 0 || elapsed <= limit || job.reported[breachType] {
+		return breaches
+	}
+	job.reported[breachType] = true
+	return append(breaches, SLABreach{
+		Type:      breachType,
+		Printer:   job.printer,
+		JobID:     jobID,
+		Submitted: job.submitted,
+		Limit:     limit.String(),
+		Elapsed:   elapsed.Round(time.Second).String(),
+		JobState:  job.state,
+	})
+}
+
+// Check returns the breaches that happened since the previous check, in
+// job order. Each breach of a job is reported once.
+func (m *SLAMonitor) Check() []SLABreach {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := m.now()
+	breaches := m.pending
+	m.pending = nil
+	for jobID, job := range m.jobs {
+		limits := m.slas[job.printer]
+		if !job.started {
+			breaches = m.checkBreach(breaches, jobID, job, SLABreachStart, limits.startWithin, now)
+		}
+		breaches = m.checkBreach(breaches, jobID, job, SLABreachFinish, limits.finishWithin, now)
+	}
+
+	sort.Slice(breaches, func(i, j int) bool {
+		if breaches[i].JobID != breaches[j].JobID {
+			return breaches[i].JobID < breaches[j].JobID
+		}
+		return breaches[i].Type > breaches[j].Type
+	})
+	return breaches
+}
@@ -0,0 +1,80 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestSLAMonitor(t *testing.T) {
+	m, err := NewSLAMonitor(map[string]lib.PrinterConfig{
+		"a": {SLA: &lib.SLAConfig{StartWithin: "2m", FinishWithin: "15m"}},
+		"b": {},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	m.Observe(jobEvent(1, model.JobStateInProgress, 0))
+	m.Observe(jobEvent(2, model.JobStateInProgress, 0))
+	other := jobEvent(3, model.JobStateInProgress, 0)
+	other.Printer = "b"
+	m.Observe(other)
+
+	now = now.Add(time.Minute)
+	m.Observe(jobEvent(2, model.JobStateInProgress, 1))
+	if breaches := m.Check(); len(breaches) != 0 {
+		t.Fatalf("unexpected breaches %v", breaches)
+	}
+
+	now = now.Add(2 * time.Minute)
+	breaches := m.Check()
+	if len(breaches) != 1 || breaches[0].JobID != 1 || breaches[0].Type != SLABreachStart || breaches[0].Elapsed != "3m0s" {
+		t.Fatalf("expected start breach of job 1 got %v", breaches)
+	}
+	if breaches = m.Check(); len(breaches) != 0 {
+		t.Fatalf("breaches reported twice: %v", breaches)
+	}
+
+	m.Observe(jobEvent(2, model.JobStateDone, 1))
+	now = now.Add(15 * time.Minute)
+	breaches = m.Check()
+	if len(breaches) != 1 || breaches[0].JobID != 1 || breaches[0].Type != SLABreachFinish {
+		t.Fatalf("expected finish breach of job 1 got %v", breaches)
+	}
+
+	// Late between checks: job 4 starts late, job 5 finishes late and
+	// leaves the queue before the next check.
+	m.Observe(jobEvent(4, model.JobStateInProgress, 0))
+	m.Observe(jobEvent(5, model.JobStateInProgress, 1))
+	now = now.Add(5 * time.Minute)
+	m.Observe(jobEvent(4, model.JobStateInProgress, 1))
+	now = now.Add(11 * time.Minute)
+	m.Observe(jobEvent(5, model.JobStateDone, 3))
+	m.Observe(jobEvent(4, model.JobStateDone, 1))
+	breaches = m.Check()
+	if len(breaches) != 3 || breaches[0].JobID != 4 || breaches[0].Type != SLABreachStart || breaches[0].Elapsed != "5m0s" ||
+		breaches[1].JobID != 4 || breaches[1].Type != SLABreachFinish ||
+		breaches[2].JobID != 5 || breaches[2].Type != SLABreachFinish || breaches[2].Elapsed != "16m0s" {
+		t.Fatalf("expected the late start and finish of job 4 and late finish of job 5 got %v", breaches)
+	}
+	if breaches = m.Check(); len(breaches) != 0 {
+		t.Fatalf("breaches reported twice: %v", breaches)
+	}
+
+	if _, err = NewSLAMonitor(map[string]lib.PrinterConfig{"a": {SLA: &lib.SLAConfig{StartWithin: "soon"}}}); err == nil {
+		t.Error("expected invalid duration error")
+	}
+}
@@ -24,6 +24,7 @@ type PrinterDescriptionSection struct {
 	FitToPage            *FitToPage              `json:"fit_to_page,omitempty"`
 	PageRange            *PageRange              `json:"page_range,omitempty"`
 	MediaSize            *MediaSize              `json:"media_size,omitempty"`
+	MediaSource          *MediaSource            `json:"media_source,omitempty"`
 	Collate              *Collate                `json:"collate,omitempty"`
 	ReverseOrder         *ReverseOrder           `json:"reverse_order,omitempty"`
 }
@@ -96,6 +97,9 @@ func (a *PrinterDescriptionSection) Absorb(b *PrinterDescriptionSection) {
 	if b.MediaSize != nil {
 		a.MediaSize = b.MediaSize
 	}
+	if b.MediaSource != nil {
+		a.MediaSource = b.MediaSource
+	}
 	if b.Collate != nil {
 		a.Collate = b.Collate
 	}
@@ -444,6 +448,40 @@ type MediaSizeOption struct {
 	CustomDisplayNameLocalized *[]LocalizedString `json:"custom_display_name_localized,omitempty"`
 }
 
+// MediaSource lists the paper trays (bins) a job can be fed from.
+type MediaSource struct {
+	Option []MediaSourceOption `json:"option"`
+}
+
+type MediaSourceType string
+
+// Media sources, after the DMBIN values of DEVMODE dmDefaultSource. Trays
+// specific to a driver are CUSTOM, told apart by vendor ID.
+const (
+	MediaSourceAuto           MediaSourceType = "AUTO"
+	MediaSourceUpper          MediaSourceType = "UPPER"
+	MediaSourceMiddle         MediaSourceType = "MIDDLE"
+	MediaSourceLower          MediaSourceType = "LOWER"
+	MediaSourceManual         MediaSourceType = "MANUAL"
+	MediaSourceEnvelope       MediaSourceType = "ENVELOPE"
+	MediaSourceEnvelopeManual MediaSourceType = "ENVELOPE_MANUAL"
+	MediaSourceTractor        MediaSourceType = "TRACTOR"
+	MediaSourceSmallFormat    MediaSourceType = "SMALL_FORMAT"
+	MediaSourceLargeFormat    MediaSourceType = "LARGE_FORMAT"
+	MediaSourceLargeCapacity  MediaSourceType = "LARGE_CAPACITY"
+	MediaSourceCassette       MediaSourceType = "CASSETTE"
+	MediaSourceFormSource     MediaSourceType = "FORM_SOURCE"
+	MediaSourceCustom         MediaSourceType = "CUSTOM"
+)
+
+type MediaSourceOption struct {
+	Type                       MediaSourceType    `json:"type"`
+	IsDefault                  bool               `json:"is_default"` // default = false
+	CustomDisplayName          string             `json:"custom_display_name,omitempty"`
+	VendorID                   string             `json:"vendor_id,omitempty"`
+	CustomDisplayNameLocalized *[]LocalizedString `json:"custom_display_name_localized,omitempty"`
+}
+
 type MediaSizeName string
 
 const (
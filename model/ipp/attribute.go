@@ -0,0 +1,202 @@
+// Package ipp converts between model types and IPP attributes, and encodes
+// and decodes IPP messages, for the IPP server.
+package ipp
+
+import "fmt"
+
+// Tag is an IPP value tag, RFC 8010 section 3.5.2.
+type Tag byte
+
+const (
+	TagInteger         Tag = 0x21
+	TagBoolean         Tag = 0x22
+	TagEnum            Tag = 0x23
+	TagResolution      Tag = 0x32
+	TagRangeOfInteger  Tag = 0x33
+	TagBeginCollection Tag = 0x34
+	TagText            Tag = 0x41 // textWithoutLanguage
+	TagName            Tag = 0x42 // nameWithoutLanguage
+	TagKeyword         Tag = 0x44
+	TagMimeMediaType   Tag = 0x49
+)
+
+// Value is an attribute value. Its type depends on the tag:
+//
+//	TagInteger, TagEnum                          int32
+//	TagBoolean                                   bool
+//	TagText, TagName, TagKeyword, TagMimeMediaType  string
+//	TagURI, TagCharset, TagNaturalLanguage       string
+//	TagOctetString                               string
+//	TagDateTime                                  time.Time
+//	TagResolution                                Resolution
+//	TagRangeOfInteger                            Range
+//	TagBeginCollection                           Collection
+//	TagNoValue, TagUnknown, TagUnsupported       no value
+type Value interface{}
+
+type ResolutionUnits byte
+
+const (
+	ResolutionDotsPerInch ResolutionUnits = 3
+	ResolutionDotsPerCm   ResolutionUnits = 4
+)
+
+type Resolution struct {
+	CrossFeed int32
+	Feed      int32
+	Units     ResolutionUnits
+}
+
+type Range struct {
+	Lower int32
+	Upper int32
+}
+
+// Collection is the value of a collection attribute, such as media-col.
+type Collection = Attributes
+
+type Attribute struct {
+	Name   string
+	Tag    Tag
+	Values []Value
+}
+
+func newAttribute(name string, tag Tag, values ...Value) Attribute {
+	return Attribute{Name: name, Tag: tag, Values: values}
+}
+
+// Attributes is an ordered list of attributes, as in an attribute group.
+type Attributes []Attribute
+
+// Get returns the attribute named name.
+func (attrs Attributes) Get(name string) (Attribute, bool) {
+	for _, a := range attrs {
+		if a.Name == name {
+			return a, true
+		}
+	}
+	return Attribute{}, false
+}
+
+func (a Attribute) checkTag(tags ...Tag) error {
+	for _, tag := range tags {
+		if a.Tag == tag {
+			if len(a.Values) == 0 {
+				return fmt.Errorf("attribute %s has no value", a.Name)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("attribute %s has unexpected value tag %#02x", a.Name, byte(a.Tag))
+}
+
+// Ints returns the values of an integer or enum attribute.
+func (a Attribute) Ints() ([]int32, error) {
+	if err := a.checkTag(TagInteger, TagEnum); err != nil {
+		return nil, err
+	}
+	ints := make([]int32, len(a.Values))
+	for i, v := range a.Values {
+		n, ok := v.(int32)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s has a %T value, expected int32", a.Name, v)
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
+
+// IntValue returns the first value of an integer or enum attribute.
+func (a Attribute) IntValue() (int32, error) {
+	ints, err := a.Ints()
+	if err != nil {
+		return 0, err
+	}
+	return ints[0], nil
+}
+
+// BoolValue returns the first value of a boolean attribute.
+func (a Attribute) BoolValue() (bool, error) {
+	if err := a.checkTag(TagBoolean); err != nil {
+		return false, err
+	}
+	b, ok := a.Values[0].(bool)
+	if !ok {
+		return false, fmt.Errorf("attribute %s has a %T value, expected bool", a.Name, a.Values[0])
+	}
+	return b, nil
+}
+
+// Strings returns the values of a keyword, name, text, mimeMediaType, uri,
+// charset or naturalLanguage attribute.
+func (a Attribute) Strings() ([]string, error) {
+	if err := a.checkTag(TagKeyword, TagName, TagText, TagMimeMediaType, TagURI, TagCharset, TagNaturalLanguage); err != nil {
+		return nil, err
+	}
+	s := make([]string, len(a.Values))
+	for i, v := range a.Values {
+		str, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s has a %T value, expected string", a.Name, v)
+		}
+		s[i] = str
+	}
+	return s, nil
+}
+
+// StringValue returns the first value of a string attribute, see Strings.
+func (a Attribute) StringValue() (string, error) {
+	s, err := a.Strings()
+	if err != nil {
+		return "", err
+	}
+	return s[0], nil
+}
+
+// Resolutions returns the values of a resolution attribute.
+func (a Attribute) Resolutions() ([]Resolution, error) {
+	if err := a.checkTag(TagResolution); err != nil {
+		return nil, err
+	}
+	resolutions := make([]Resolution, len(a.Values))
+	for i, v := range a.Values {
+		r, ok := v.(Resolution)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s has a %T value, expected Resolution", a.Name, v)
+		}
+		resolutions[i] = r
+	}
+	return resolutions, nil
+}
+
+// Ranges returns the values of a rangeOfInteger attribute.
+func (a Attribute) Ranges() ([]Range, error) {
+	if err := a.checkTag(TagRangeOfInteger); err != nil {
+		return nil, err
+	}
+	ranges := make([]Range, len(a.Values))
+	for i, v := range a.Values {
+		r, ok := v.(Range)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s has a %T value, expected Range", a.Name, v)
+		}
+		ranges[i] = r
+	}
+	return ranges, nil
+}
+
+// Collections returns the values of a collection attribute.
+func (a Attribute) Collections() ([]Collection, error) {
+	if err := a.checkTag(TagBeginCollection); err != nil {
+		return nil, err
+	}
+	collections := make([]Collection, len(a.Values))
+	for i, v := range a.Values {
+		c, ok := v.(Collection)
+		if !ok {
+			return nil, fmt.Errorf("attribute %s has a %T value, expected Collection", a.Name, v)
+		}
+		collections[i] = c
+	}
+	return collections, nil
+}
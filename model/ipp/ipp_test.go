@@ -0,0 +1,131 @@
+package ipp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+func TestJobTicketRoundTrip(t *testing.T) {
+	ticket := &model.JobTicket{
+		Copies:          &model.CopiesTicketItem{Copies: 3},
+		Duplex:          &model.DuplexTicketItem{Type: model.DuplexLongEdge},
+		Color:           &model.ColorTicketItem{Type: model.ColorTypeStandardMonochrome},
+		PageOrientation: &model.PageOrientationTicketItem{Type: model.PageOrientationLandscape},
+		DPI:             &model.DPITicketItem{HorizontalDPI: 600, VerticalDPI: 600},
+		PageRange: &model.PageRangeTicketItem{Interval: []model.PageRangeInterval{
+			{Start: 1, End: 2}, {Start: 5},
+		}},
+		MediaSize:    &model.MediaSizeTicketItem{WidthMicrons: 210000, HeightMicrons: 297000},
+		MediaSource:  &model.MediaSourceTicketItem{Type: model.MediaSourceManual},
+		Margins:      &model.MarginsTicketItem{TopMicrons: 5000, RightMicrons: 5000, BottomMicrons: 5000, LeftMicrons: 5000},
+		Collate:      &model.CollateTicketItem{Collate: true},
+		FitToPage:    &model.FitToPageTicketItem{Type: model.FitToPageFitToPage},
+		ReverseOrder: &model.ReverseOrderTicketItem{ReverseOrder: true},
+		NUp:          &model.NUpTicketItem{PagesPerSheet: 4, Layout: model.NUpDownThenRight},
+		Booklet:      &model.BookletTicketItem{Booklet: true},
+	}
+
+	attrs := JobTicketToAttributes(ticket)
+	if a, ok := attrs.Get("sides"); !ok || a.Values[0] != "two-sided-long-edge" {
+		t.Errorf("unexpected sides %+v", a)
+	}
+
+	got, err := JobTicketFromAttributes(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ticket, got) {
+		t.Errorf("expected %+v got %+v", ticket, got)
+	}
+
+	if _, err = JobTicketFromAttributes(Attributes{newAttribute("sides", TagKeyword, "both")}); err == nil {
+		t.Error("expected error for unknown sides")
+	}
+	if _, err = JobTicketFromAttributes(Attributes{newAttribute("copies", TagKeyword, "2")}); err == nil {
+		t.Error("expected error for wrong value tag")
+	}
+}
+
+func TestPrinterDescriptionRoundTrip(t *testing.T) {
+	d := &model.PrinterDescriptionSection{
+		SupportedContentType: model.NewSupportedContentType("application/pdf"),
+		Copies:               &model.Copies{Default: 1, Max: 99},
+		Duplex: &model.Duplex{Option: []model.DuplexOption{
+			{Type: model.DuplexNoDuplex, IsDefault: true},
+			{Type: model.DuplexLongEdge},
+		}},
+		PageOrientation: &model.PageOrientation{Option: []model.PageOrientationOption{
+			{Type: model.PageOrientationPortrait, IsDefault: true},
+			{Type: model.PageOrientationLandscape},
+		}},
+		DPI: &model.DPI{Option: []model.DPIOption{
+			{HorizontalDPI: 300, VerticalDPI: 300},
+			{HorizontalDPI: 600, VerticalDPI: 600, IsDefault: true},
+		}},
+		MediaSize: &model.MediaSize{Option: []model.MediaSizeOption{
+			{Name: model.MediaSizeCustom, WidthMicrons: 210000, HeightMicrons: 297000, IsDefault: true},
+			{Name: model.MediaSizeCustom, WidthMicrons: 80000, HeightMicrons: 200000},
+		}},
+		MediaSource: &model.MediaSource{Option: []model.MediaSourceOption{
+			{Type: model.MediaSourceAuto},
+			{Type: model.MediaSourceLower, IsDefault: true},
+		}},
+		PageRange:    &model.PageRange{},
+		Collate:      &model.Collate{Default: true},
+		ReverseOrder: &model.ReverseOrder{Default: false},
+	}
+
+	got, err := PrinterDescriptionFromAttributes(PrinterDescriptionToAttributes(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, got) {
+		t.Errorf("expected %+v got %+v", d, got)
+	}
+}
+
+func TestMediaNames(t *testing.T) {
+	for _, test := range []struct {
+		name                        string
+		widthMicrons, heightMicrons int32
+	}{
+		{"iso_a4_210x297mm", 210000, 297000},
+		{"na_letter_8.5x11in", 215900, 279400},
+		{"custom_62x29mm", 62000, 29000},
+		{"custom_101.5x50mm", 101500, 50000},
+	} {
+		if name := MediaName(test.widthMicrons, test.heightMicrons); name != test.name {
+			t.Errorf("expected %s for %dx%d got %s", test.name, test.widthMicrons, test.heightMicrons, name)
+		}
+		if w, h, err := ParseMediaName(test.name); err != nil || w != test.widthMicrons || h != test.heightMicrons {
+			t.Errorf("expected %dx%d for %s got %dx%d %v", test.widthMicrons, test.heightMicrons, test.name, w, h, err)
+		}
+	}
+	if name := MediaName(210100, 296900); name != "iso_a4_210x297mm" {
+		t.Errorf("expected a size close to A4 named A4, got %s", name)
+	}
+	if w, h, err := ParseMediaName("na-letter"); err != nil || w != 215900 || h != 279400 {
+		t.Errorf("expected letter for na-letter got %dx%d %v", w, h, err)
+	}
+	if w, h, err := ParseMediaName("om_small-photo_100x150mm"); err != nil || w != 100000 || h != 150000 {
+		t.Errorf("unexpected size of om_small-photo_100x150mm %dx%d %v", w, h, err)
+	}
+	for _, name := range []string{"photo", "iso_a4_210x297", "iso_a4_210mm", "custom_0x10mm", "custom_NaNx10mm"} {
+		if _, _, err := ParseMediaName(name); err == nil {
+			t.Errorf("expected error for media %q", name)
+		}
+	}
+
+	ticket, err := JobTicketFromAttributes(Attributes{newAttribute("media", TagKeyword, "iso_a5_148x210mm")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.MediaSize == nil || ticket.MediaSize.WidthMicrons != 148000 || ticket.MediaSize.HeightMicrons != 210000 {
+		t.Errorf("unexpected media size %+v", ticket.MediaSize)
+	}
+	if _, err = JobTicketFromAttributes(Attributes{newAttribute("media", TagKeyword, "photo")}); err == nil {
+		t.Error("expected error for a media without a size")
+	}
+}
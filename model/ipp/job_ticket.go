@@ -0,0 +1,478 @@
+package ipp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// IPP media dimensions and margins are in hundredths of millimeters.
+const micronsPerHundredthMM = 10
+
+// End of the last page range interval when the ticket doesn't set one.
+const pageRangeToEnd = math.MaxInt32
+
+var sidesByDuplex = map[model.DuplexType]string{
+	model.DuplexNoDuplex:  "one-sided",
+	model.DuplexLongEdge:  "two-sided-long-edge",
+	model.DuplexShortEdge: "two-sided-short-edge",
+}
+
+var colorModesByColorType = map[model.ColorType]string{
+	model.ColorTypeStandardColor:      "color",
+	model.ColorTypeCustomColor:        "color",
+	model.ColorTypeStandardMonochrome: "monochrome",
+	model.ColorTypeCustomMonochrome:   "monochrome",
+	model.ColorTypeAuto:               "auto",
+}
+
+var colorTypesByColorMode = map[string]model.ColorType{
+	"color":              model.ColorTypeStandardColor,
+	"monochrome":         model.ColorTypeStandardMonochrome,
+	"process-monochrome": model.ColorTypeStandardMonochrome,
+	"bi-level":           model.ColorTypeStandardMonochrome,
+	"process-bi-level":   model.ColorTypeStandardMonochrome,
+	"auto":               model.ColorTypeAuto,
+}
+
+// orientation-requested enum values, RFC 8011 section 5.2.10.
+const (
+	orientationPortrait         int32 = 3
+	orientationLandscape        int32 = 4
+	orientationReverseLandscape int32 = 5
+	orientationReversePortrait  int32 = 6
+	orientationNone             int32 = 7
+)
+
+var orientationsByPageOrientation = map[model.PageOrientationType]int32{
+	model.PageOrientationPortrait:  orientationPortrait,
+	model.PageOrientationLandscape: orientationLandscape,
+	model.PageOrientationAuto:      orientationNone,
+}
+
+var pageOrientationsByOrientation = map[int32]model.PageOrientationType{
+	orientationPortrait:         model.PageOrientationPortrait,
+	orientationLandscape:        model.PageOrientationLandscape,
+	orientationReverseLandscape: model.PageOrientationLandscape,
+	orientationReversePortrait:  model.PageOrientationPortrait,
+	orientationNone:             model.PageOrientationAuto,
+}
+
+// There is no print-scaling keyword for growing only, so GROW_TO_PAGE
+// becomes "fit".
+var printScalingsByFitToPage = map[model.FitToPageType]string{
+	model.FitToPageNoFitting:    "none",
+	model.FitToPageFitToPage:    "fit",
+	model.FitToPageGrowToPage:   "fit",
+	model.FitToPageShrinkToPage: "auto-fit",
+	model.FitToPageFillPage:     "fill",
+}
+
+var fitToPagesByPrintScaling = map[string]model.FitToPageType{
+	"none":     model.FitToPageNoFitting,
+	"fit":      model.FitToPageFitToPage,
+	"auto":     model.FitToPageFitToPage,
+	"auto-fit": model.FitToPageShrinkToPage,
+	"fill":     model.FitToPageFillPage,
+}
+
+// media-source keywords, PWG 5100.7. Trays without a keyword, such as those
+// of the driver, have no IPP equivalent.
+var mediaSourcesByType = map[model.MediaSourceType]string{
+	model.MediaSourceAuto:          "auto",
+	model.MediaSourceUpper:         "top",
+	model.MediaSourceMiddle:        "middle",
+	model.MediaSourceLower:         "bottom",
+	model.MediaSourceManual:        "manual",
+	model.MediaSourceEnvelope:      "envelope",
+	model.MediaSourceTractor:       "tractor",
+	model.MediaSourceLargeCapacity: "large-capacity",
+}
+
+var mediaSourceTypesBySource = map[string]model.MediaSourceType{
+	"auto":           model.MediaSourceAuto,
+	"main":           model.MediaSourceAuto,
+	"top":            model.MediaSourceUpper,
+	"middle":         model.MediaSourceMiddle,
+	"bottom":         model.MediaSourceLower,
+	"manual":         model.MediaSourceManual,
+	"by-pass-tray":   model.MediaSourceManual,
+	"envelope":       model.MediaSourceEnvelope,
+	"tractor":        model.MediaSourceTractor,
+	"large-capacity": model.MediaSourceLargeCapacity,
+}
+
+// presentation-direction-number-up keywords, PWG 5100.3.
+var presentationDirectionsByNUpLayout = map[model.NUpLayoutType]string{
+	model.NUpRightThenDown: "toright-tobottom",
+	model.NUpDownThenRight: "tobottom-toright",
+	model.NUpLeftThenDown:  "toleft-tobottom",
+	model.NUpDownThenLeft:  "tobottom-toleft",
+}
+
+var nUpLayoutsByPresentationDirection = map[string]model.NUpLayoutType{
+	"toright-tobottom": model.NUpRightThenDown,
+	"tobottom-toright": model.NUpDownThenRight,
+	"toleft-tobottom":  model.NUpLeftThenDown,
+	"tobottom-toleft":  model.NUpDownThenLeft,
+}
+
+// imposition-template keywords, PWG 5100.3.
+const (
+	impositionNone      = "none"
+	impositionSignature = "signature"
+)
+
+const (
+	collatedCopies   = "separate-documents-collated-copies"
+	uncollatedCopies = "separate-documents-uncollated-copies"
+	sameOrder        = "same-order-face-down"
+	reverseOrder     = "reverse-order-face-down"
+)
+
+var duplexesBySides = map[string]model.DuplexType{
+	"one-sided":            model.DuplexNoDuplex,
+	"two-sided-long-edge":  model.DuplexLongEdge,
+	"two-sided-short-edge": model.DuplexShortEdge,
+}
+
+// JobTicketToAttributes converts a ticket into job template attributes.
+// Vendor ticket items and media vendor IDs have no IPP equivalent and are
+// dropped.
+func JobTicketToAttributes(ticket *model.JobTicket) Attributes {
+	var attrs Attributes
+
+	if ticket.Copies != nil {
+		attrs = append(attrs, newAttribute("copies", TagInteger, ticket.Copies.Copies))
+	}
+	if ticket.Duplex != nil {
+		if sides, ok := sidesByDuplex[ticket.Duplex.Type]; ok {
+			attrs = append(attrs, newAttribute("sides", TagKeyword, sides))
+		}
+	}
+	if ticket.Color != nil {
+		if colorMode, ok := colorModesByColorType[ticket.Color.Type]; ok {
+			attrs = append(attrs, newAttribute("print-color-mode", TagKeyword, colorMode))
+		}
+	}
+	if ticket.PageOrientation != nil {
+		if orientation, ok := orientationsByPageOrientation[ticket.PageOrientation.Type]; ok {
+			attrs = append(attrs, newAttribute("orientation-requested", TagEnum, orientation))
+		}
+	}
+	if ticket.DPI != nil {
+		attrs = append(attrs, newAttribute("printer-resolution", TagResolution, Resolution{
+			CrossFeed: ticket.DPI.HorizontalDPI,
+			Feed:      ticket.DPI.VerticalDPI,
+			Units:     ResolutionDotsPerInch,
+		}))
+	}
+	if ticket.PageRange != nil && len(ticket.PageRange.Interval) > 0 {
+		values := make([]Value, len(ticket.PageRange.Interval))
+		for i, interval := range ticket.PageRange.Interval {
+			end := interval.End
+			if end == 0 {
+				end = pageRangeToEnd
+			}
+			values[i] = Range{Lower: interval.Start, Upper: end}
+		}
+		attrs = append(attrs, newAttribute("page-ranges", TagRangeOfInteger, values...))
+	}
+	if mediaCol := mediaColFromTicket(ticket); len(mediaCol) > 0 {
+		attrs = append(attrs, newAttribute("media-col", TagBeginCollection, mediaCol))
+	}
+	if ticket.Collate != nil {
+		handling := uncollatedCopies
+		if ticket.Collate.Collate {
+			handling = collatedCopies
+		}
+		attrs = append(attrs, newAttribute("multiple-document-handling", TagKeyword, handling))
+	}
+	if ticket.FitToPage != nil {
+		if scaling, ok := printScalingsByFitToPage[ticket.FitToPage.Type]; ok {
+			attrs = append(attrs, newAttribute("print-scaling", TagKeyword, scaling))
+		}
+	}
+	if ticket.ReverseOrder != nil {
+		delivery := sameOrder
+		if ticket.ReverseOrder.ReverseOrder {
+			delivery = reverseOrder
+		}
+		attrs = append(attrs, newAttribute("page-delivery", TagKeyword, delivery))
+	}
+	if ticket.Booklet != nil {
+		imposition := impositionNone
+		if ticket.Booklet.Booklet {
+			imposition = impositionSignature
+		}
+		attrs = append(attrs, newAttribute("imposition-template", TagKeyword, imposition))
+	}
+	if ticket.NUp != nil {
+		attrs = append(attrs, newAttribute("number-up", TagInteger, ticket.NUp.PagesPerSheet))
+		if direction, ok := presentationDirectionsByNUpLayout[ticket.NUp.Layout]; ok {
+			attrs = append(attrs, newAttribute("presentation-direction-number-up", TagKeyword, direction))
+		}
+	}
+
+	return attrs
+}
+
+func mediaColFromTicket(ticket *model.JobTicket) Collection {
+	var mediaCol Collection
+	if ticket.MediaSize != nil && ticket.MediaSize.WidthMicrons > 0 && ticket.MediaSize.HeightMicrons > 0 {
+		mediaCol = append(mediaCol, newAttribute("media-size", TagBeginCollection,
+			mediaSizeCollection(ticket.MediaSize.WidthMicrons, ticket.MediaSize.HeightMicrons)))
+	}
+	if ticket.MediaSource != nil {
+		if source, ok := mediaSourcesByType[ticket.MediaSource.Type]; ok {
+			mediaCol = append(mediaCol, newAttribute("media-source", TagKeyword, source))
+		}
+	}
+	if m := ticket.Margins; m != nil {
+		mediaCol = append(mediaCol,
+			newAttribute("media-top-margin", TagInteger, m.TopMicrons/micronsPerHundredthMM),
+			newAttribute("media-right-margin", TagInteger, m.RightMicrons/micronsPerHundredthMM),
+			newAttribute("media-bottom-margin", TagInteger, m.BottomMicrons/micronsPerHundredthMM),
+			newAttribute("media-left-margin", TagInteger, m.LeftMicrons/micronsPerHundredthMM))
+	}
+	return mediaCol
+}
+
+func mediaSizeCollection(widthMicrons, heightMicrons int32) Collection {
+	return Collection{
+		newAttribute("x-dimension", TagInteger, widthMicrons/micronsPerHundredthMM),
+		newAttribute("y-dimension", TagInteger, heightMicrons/micronsPerHundredthMM),
+	}
+}
+
+// parseMediaSize reads the dimensions of a media-size collection, in microns.
+func parseMediaSize(mediaSize Collection) (int32, int32, error) {
+	var dimensions [2]int32
+	for i, name := range []string{"x-dimension", "y-dimension"} {
+		a, ok := mediaSize.Get(name)
+		if !ok {
+			return 0, 0, fmt.Errorf("media-size without %s", name)
+		}
+		d, err := a.IntValue()
+		if err != nil {
+			return 0, 0, err
+		}
+		dimensions[i] = d * micronsPerHundredthMM
+	}
+	return dimensions[0], dimensions[1], nil
+}
+
+// JobTicketFromAttributes converts job template attributes into a ticket.
+// Attributes that don't map to a ticket item are ignored; values that can't
+// be converted are an error.
+func JobTicketFromAttributes(attrs Attributes) (*model.JobTicket, error) {
+	var ticket model.JobTicket
+
+	for _, a := range attrs {
+		switch a.Name {
+		case "copies":
+			copies, err := a.IntValue()
+			if err != nil {
+				return nil, err
+			}
+			ticket.Copies = &model.CopiesTicketItem{Copies: copies}
+
+		case "sides":
+			sides, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			duplex, ok := duplexesBySides[sides]
+			if !ok {
+				return nil, fmt.Errorf("unsupported sides %q", sides)
+			}
+			ticket.Duplex = &model.DuplexTicketItem{Type: duplex}
+
+		case "print-color-mode":
+			colorMode, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			colorType, ok := colorTypesByColorMode[colorMode]
+			if !ok {
+				return nil, fmt.Errorf("unsupported print-color-mode %q", colorMode)
+			}
+			ticket.Color = &model.ColorTicketItem{Type: colorType}
+
+		case "orientation-requested":
+			orientation, err := a.IntValue()
+			if err != nil {
+				return nil, err
+			}
+			pageOrientation, ok := pageOrientationsByOrientation[orientation]
+			if !ok {
+				return nil, fmt.Errorf("unsupported orientation-requested %d", orientation)
+			}
+			ticket.PageOrientation = &model.PageOrientationTicketItem{Type: pageOrientation}
+
+		case "printer-resolution":
+			resolutions, err := a.Resolutions()
+			if err != nil {
+				return nil, err
+			}
+			r := resolutions[0]
+			if r.Units == ResolutionDotsPerCm {
+				r.CrossFeed, r.Feed = int32(math.Round(float64(r.CrossFeed)*2.54)), int32(math.Round(float64(r.Feed)*2.54))
+			}
+			ticket.DPI = &model.DPITicketItem{HorizontalDPI: r.CrossFeed, VerticalDPI: r.Feed}
+
+		case "page-ranges":
+			ranges, err := a.Ranges()
+			if err != nil {
+				return nil, err
+			}
+			intervals := make([]model.PageRangeInterval, len(ranges))
+			for i, r := range ranges {
+				intervals[i].Start = r.Lower
+				if r.Upper != pageRangeToEnd {
+					intervals[i].End = r.Upper
+				}
+			}
+			ticket.PageRange = &model.PageRangeTicketItem{Interval: intervals}
+
+		case "media":
+			media, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			width, height, err := ParseMediaName(media)
+			if err != nil {
+				return nil, err
+			}
+			ticket.MediaSize = &model.MediaSizeTicketItem{WidthMicrons: width, HeightMicrons: height}
+
+		case "media-col":
+			collections, err := a.Collections()
+			if err != nil {
+				return nil, err
+			}
+			if err = mediaColToTicket(collections[0], &ticket); err != nil {
+				return nil, err
+			}
+
+		case "multiple-document-handling":
+			handling, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			switch handling {
+			case collatedCopies:
+				ticket.Collate = &model.CollateTicketItem{Collate: true}
+			case uncollatedCopies:
+				ticket.Collate = &model.CollateTicketItem{Collate: false}
+			}
+
+		case "imposition-template":
+			imposition, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			switch imposition {
+			case impositionSignature:
+				ticket.Booklet = &model.BookletTicketItem{Booklet: true}
+			case impositionNone:
+				ticket.Booklet = &model.BookletTicketItem{Booklet: false}
+			}
+
+		case "number-up":
+			n, err := a.IntValue()
+			if err != nil {
+				return nil, err
+			}
+			if ticket.NUp == nil {
+				ticket.NUp = &model.NUpTicketItem{}
+			}
+			ticket.NUp.PagesPerSheet = n
+
+		case "presentation-direction-number-up":
+			direction, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			layout, ok := nUpLayoutsByPresentationDirection[direction]
+			if !ok {
+				return nil, fmt.Errorf("unsupported presentation-direction-number-up %q", direction)
+			}
+			if ticket.NUp == nil {
+				ticket.NUp = &model.NUpTicketItem{PagesPerSheet: 1}
+			}
+			ticket.NUp.Layout = layout
+
+		case "print-scaling":
+			scaling, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			fitToPage, ok := fitToPagesByPrintScaling[scaling]
+			if !ok {
+				return nil, fmt.Errorf("unsupported print-scaling %q", scaling)
+			}
+			ticket.FitToPage = &model.FitToPageTicketItem{Type: fitToPage}
+
+		case "page-delivery":
+			delivery, err := a.StringValue()
+			if err != nil {
+				return nil, err
+			}
+			ticket.ReverseOrder = &model.ReverseOrderTicketItem{ReverseOrder: strings.HasPrefix(delivery, "reverse-order")}
+		}
+	}
+
+	return &ticket, nil
+}
+
+func mediaColToTicket(mediaCol Collection, ticket *model.JobTicket) error {
+	if a, ok := mediaCol.Get("media-size"); ok {
+		collections, err := a.Collections()
+		if err != nil {
+			return err
+		}
+		width, height, err := parseMediaSize(collections[0])
+		if err != nil {
+			return err
+		}
+		ticket.MediaSize = &model.MediaSizeTicketItem{WidthMicrons: width, HeightMicrons: height}
+	}
+	if a, ok := mediaCol.Get("media-source"); ok {
+		source, err := a.StringValue()
+		if err != nil {
+			return err
+		}
+		sourceType, ok := mediaSourceTypesBySource[source]
+		if !ok {
+			return fmt.Errorf("unsupported media-source %q", source)
+		}
+		ticket.MediaSource = &model.MediaSourceTicketItem{Type: sourceType}
+	}
+
+	var margins model.MarginsTicketItem
+	var hasMargins bool
+	for name, microns := range map[string]*int32{
+		"media-top-margin":    &margins.TopMicrons,
+		"media-right-margin":  &margins.RightMicrons,
+		"media-bottom-margin": &margins.BottomMicrons,
+		"media-left-margin":   &margins.LeftMicrons,
+	} {
+		a, ok := mediaCol.Get(name)
+		if !ok {
+			continue
+		}
+		margin, err := a.IntValue()
+		if err != nil {
+			return err
+		}
+		*microns = margin * micronsPerHundredthMM
+		hasMargins = true
+	}
+	if hasMargins {
+		ticket.Margins = &margins
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package ipp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// micronsPerInch converts the inch dimensions of media names.
+const micronsPerInch = 25400
+
+// Sizes within this of a standard size have its name.
+const mediaNameToleranceMicrons = 500
+
+// Standard media sizes, by PWG 5101.1 self-describing name, with the IPP/1.1
+// keywords older clients send for them.
+var standardMedia = []struct {
+	name                        string
+	legacy                      []string
+	widthMicrons, heightMicrons int32
+}{
+	{"iso_a3_297x420mm", []string{"iso-a3", "a3"}, 297000, 420000},
+	{"iso_a4_210x297mm", []string{"iso-a4", "a4"}, 210000, 297000},
+	{"iso_a5_148x210mm", []string{"iso-a5", "a5"}, 148000, 210000},
+	{"iso_a6_105x148mm", []string{"iso-a6", "a6"}, 105000, 148000},
+	{"iso_b5_176x250mm", []string{"iso-b5"}, 176000, 250000},
+	{"jis_b5_182x257mm", []string{"jis-b5"}, 182000, 257000},
+	{"iso_c5_162x229mm", []string{"iso-c5"}, 162000, 229000},
+	{"iso_dl_110x220mm", []string{"iso-designated"}, 110000, 220000},
+	{"na_letter_8.5x11in", []string{"na-letter", "letter"}, 215900, 279400},
+	{"na_legal_8.5x14in", []string{"na-legal", "legal"}, 215900, 355600},
+	{"na_ledger_11x17in", []string{"tabloid", "ledger"}, 279400, 431800},
+	{"na_executive_7.25x10.5in", []string{"executive"}, 184150, 266700},
+	{"na_number-10_4.125x9.5in", []string{"na-number-10-envelope"}, 104775, 241300},
+	{"na_index-4x6_4x6in", nil, 101600, 152400},
+}
+
+// MediaName returns the PWG self-describing media name of a size, such as
+// iso_a4_210x297mm, or custom_62x29mm for sizes without a standard name.
+func MediaName(widthMicrons, heightMicrons int32) string {
+	for _, m := range standardMedia {
+		if abs(m.widthMicrons-widthMicrons) <= mediaNameToleranceMicrons && abs(m.heightMicrons-heightMicrons) <= mediaNameToleranceMicrons {
+			return m.name
+		}
+	}
+	mm := func(microns int32) string {
+		return strconv.FormatFloat(float64(microns)/1000, 'f', -1, 64)
+	}
+	return fmt.Sprintf("custom_%sx%smm", mm(widthMicrons), mm(heightMicrons))
+}
+
+// ParseMediaName returns the size of a media name, in microns: a PWG
+// self-describing name, whose last part is the size, or an IPP/1.1 keyword
+// of a standard size.
+func ParseMediaName(name string) (int32, int32, error) {
+	for _, m := range standardMedia {
+		for _, legacy := range m.legacy {
+			if name == legacy {
+				return m.widthMicrons, m.heightMicrons, nil
+			}
+		}
+	}
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return 0, 0, fmt.Errorf("unsupported media %q", name)
+	}
+	size := name[i+1:]
+	var perUnit float64
+	switch {
+	case strings.HasSuffix(size, "mm"):
+		perUnit = 1000
+	case strings.HasSuffix(size, "in"):
+		perUnit = micronsPerInch
+	default:
+		return 0, 0, fmt.Errorf("media %q without mm or in size", name)
+	}
+	dimensions := strings.Split(size[:len(size)-2], "x")
+	if len(dimensions) != 2 {
+		return 0, 0, fmt.Errorf("media %q without a WxH size", name)
+	}
+	var microns [2]int32
+	for j, d := range dimensions {
+		v, err := strconv.ParseFloat(d, 64)
+		if err != nil || !(v > 0) || v*perUnit > math.MaxInt32 {
+			return 0, 0, fmt.Errorf("media %q has an invalid size", name)
+		}
+		microns[j] = int32(math.Round(v * perUnit))
+	}
+	return microns[0], microns[1], nil
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,493 @@
+package ipp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Delimiter tags of attribute groups, RFC 8010 section 3.5.1.
+type GroupTag byte
+
+const (
+	GroupOperation   GroupTag = 0x01
+	GroupJob         GroupTag = 0x02
+	groupEnd         GroupTag = 0x03
+	GroupPrinter     GroupTag = 0x04
+	GroupUnsupported GroupTag = 0x05
+)
+
+// Value tags not used by model conversions.
+const (
+	// Out-of-band values, which have no value.
+	TagUnsupported Tag = 0x10
+	TagUnknown     Tag = 0x12
+	TagNoValue     Tag = 0x13
+
+	TagOctetString     Tag = 0x30
+	TagDateTime        Tag = 0x31
+	TagEndCollection   Tag = 0x37
+	TagURI             Tag = 0x45
+	TagURIScheme       Tag = 0x46
+	TagCharset         Tag = 0x47
+	TagNaturalLanguage Tag = 0x48
+	TagMemberAttrName  Tag = 0x4a
+
+	// Decoded as TagText and TagName, without the language.
+	tagTextWithLanguage Tag = 0x35
+	tagNameWithLanguage Tag = 0x36
+)
+
+// Operations, RFC 8011 section 5.4.15.
+const (
+	OpPrintJob             uint16 = 0x0002
+	OpValidateJob          uint16 = 0x0004
+	OpCancelJob            uint16 = 0x0008
+	OpGetJobAttributes     uint16 = 0x0009
+	OpGetJobs              uint16 = 0x000a
+	OpGetPrinterAttributes uint16 = 0x000b
+)
+
+// Status codes, RFC 8011 appendix B.
+const (
+	StatusOK                             uint16 = 0x0000
+	StatusBadRequest                     uint16 = 0x0400
+	StatusForbidden                      uint16 = 0x0401
+	StatusNotPossible                    uint16 = 0x0404
+	StatusNotFound                       uint16 = 0x0406
+	StatusDocumentFormatNotSupported     uint16 = 0x040a
+	StatusAttributesOrValuesNotSupported uint16 = 0x040b
+	StatusDocumentFormatError            uint16 = 0x0411
+	StatusInternalError                  uint16 = 0x0500
+	StatusOperationNotSupported          uint16 = 0x0501
+	StatusVersionNotSupported            uint16 = 0x0503
+)
+
+// Collections nested deeper than this are rejected when decoding.
+const maxCollectionDepth = 16
+
+// Group is an attribute group of a message, such as the operation
+// attributes.
+type Group struct {
+	Tag        GroupTag
+	Attributes Attributes
+}
+
+// Message is an IPP request or response, RFC 8010 section 3.1. The
+// document of a request follows it in the stream.
+type Message struct {
+	// Such as 0x0200 for IPP/2.0.
+	Version uint16
+	// Operation of a request, status of a response.
+	Code      uint16
+	RequestID uint32
+	Groups    []Group
+}
+
+// Group returns the attributes of the first group with tag, nil when there
+// is none.
+func (m *Message) Group(tag GroupTag) Attributes {
+	for _, g := range m.Groups {
+		if g.Tag == tag {
+			return g.Attributes
+		}
+	}
+	return nil
+}
+
+// AddGroup appends a group, even an empty one.
+func (m *Message) AddGroup(tag GroupTag, attrs Attributes) {
+	m.Groups = append(m.Groups, Group{Tag: tag, Attributes: attrs})
+}
+
+// NewAttribute returns an attribute with the values, as described by Value.
+func NewAttribute(name string, tag Tag, values ...Value) Attribute {
+	return newAttribute(name, tag, values...)
+}
+
+// Encode writes the message, up to the end of its attributes.
+func (m *Message) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	e := encoder{w: bw}
+	e.uint16(m.Version)
+	e.uint16(m.Code)
+	e.uint32(m.RequestID)
+	for _, g := range m.Groups {
+		e.byte(byte(g.Tag))
+		for _, a := range g.Attributes {
+			e.attribute(a.Name, a)
+		}
+	}
+	e.byte(byte(groupEnd))
+	if e.err != nil {
+		return e.err
+	}
+	return bw.Flush()
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (e *encoder) byte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+func (e *encoder) uint16(v uint16) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, v)
+	}
+}
+
+func (e *encoder) uint32(v uint32) {
+	if e.err == nil {
+		e.err = binary.Write(e.w, binary.BigEndian, v)
+	}
+}
+
+func (e *encoder) bytes(b []byte) {
+	if e.err != nil {
+		return
+	}
+	if len(b) > 0xffff {
+		e.err = fmt.Errorf("value of %d bytes is too long", len(b))
+		return
+	}
+	e.uint16(uint16(len(b)))
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+// attribute writes the values of a, the first one named name, the next ones
+// as additional values.
+func (e *encoder) attribute(name string, a Attribute) {
+	values := a.Values
+	if len(values) == 0 {
+		// Out-of-band values have none.
+		values = []Value{nil}
+	}
+	for i, v := range values {
+		if i > 0 {
+			name = ""
+		}
+		e.byte(byte(a.Tag))
+		e.bytes([]byte(name))
+		if a.Tag == TagBeginCollection {
+			members, ok := v.(Collection)
+			if !ok {
+				e.fail(a, v)
+				return
+			}
+			e.bytes(nil)
+			for _, member := range members {
+				e.byte(byte(TagMemberAttrName))
+				e.bytes(nil)
+				e.bytes([]byte(member.Name))
+				e.attribute("", member)
+			}
+			e.byte(byte(TagEndCollection))
+			e.bytes(nil)
+			e.bytes(nil)
+			continue
+		}
+		value, ok := encodeValue(a.Tag, v)
+		if !ok {
+			e.fail(a, v)
+			return
+		}
+		e.bytes(value)
+	}
+}
+
+func (e *encoder) fail(a Attribute, v Value) {
+	if e.err == nil {
+		e.err = fmt.Errorf("attribute %s with value tag %#02x can't have a %T value", a.Name, byte(a.Tag), v)
+	}
+}
+
+func encodeValue(tag Tag, v Value) ([]byte, bool) {
+	switch tag {
+	case TagUnsupported, TagUnknown, TagNoValue:
+		return nil, true
+	case TagInteger, TagEnum:
+		n, ok := v.(int32)
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(n))
+		return b, ok
+	case TagBoolean:
+		b, ok := v.(bool)
+		if b {
+			return []byte{1}, ok
+		}
+		return []byte{0}, ok
+	case TagResolution:
+		r, ok := v.(Resolution)
+		b := make([]byte, 9)
+		binary.BigEndian.PutUint32(b, uint32(r.CrossFeed))
+		binary.BigEndian.PutUint32(b[4:], uint32(r.Feed))
+		b[8] = byte(r.Units)
+		return b, ok
+	case TagRangeOfInteger:
+		r, ok := v.(Range)
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint32(b, uint32(r.Lower))
+		binary.BigEndian.PutUint32(b[4:], uint32(r.Upper))
+		return b, ok
+	case TagDateTime:
+		t, ok := v.(time.Time)
+		return encodeDateTime(t), ok
+	}
+	s, ok := v.(string)
+	return []byte(s), ok
+}
+
+// encodeDateTime encodes t as a DateAndTime of RFC 2579.
+func encodeDateTime(t time.Time) []byte {
+	_, offset := t.Zone()
+	direction := byte('+')
+	if offset < 0 {
+		direction, offset = '-', -offset
+	}
+	b := make([]byte, 11)
+	binary.BigEndian.PutUint16(b, uint16(t.Year()))
+	b[2], b[3], b[4], b[5], b[6] = byte(t.Month()), byte(t.Day()), byte(t.Hour()), byte(t.Minute()), byte(t.Second())
+	b[7] = byte(t.Nanosecond() / 100000000)
+	b[8], b[9], b[10] = direction, byte(offset/3600), byte(offset%3600/60)
+	return b
+}
+
+// DecodeMessage reads a message up to the end of its attributes, leaving
+// the document of a request in r.
+func DecodeMessage(r io.Reader) (*Message, error) {
+	d := decoder{r: r}
+	var m Message
+	m.Version = d.uint16()
+	m.Code = d.uint16()
+	m.RequestID = d.uint32()
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	var group *Group
+	var name string
+	tag := d.byte()
+	for d.err == nil {
+		if tag == byte(groupEnd) {
+			return &m, nil
+		}
+		if tag < 0x10 {
+			m.Groups = append(m.Groups, Group{Tag: GroupTag(tag)})
+			group = &m.Groups[len(m.Groups)-1]
+			tag = d.byte()
+			continue
+		}
+		if group == nil {
+			return nil, errors.New("IPP attribute outside of a group")
+		}
+		if name == "" {
+			name = string(d.bytes())
+		}
+		var a Attribute
+		a, tag, name = d.attribute(name, Tag(tag), 0)
+		if d.err != nil {
+			break
+		}
+		group.Attributes = append(group.Attributes, a)
+	}
+	if d.err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return nil, d.err
+}
+
+type decoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.read(1); d.err == nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.read(2); d.err == nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) uint32() uint32 {
+	if b := d.read(4); d.err == nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.uint16()
+	return d.read(int(n))
+}
+
+// attribute reads the values of the attribute named name, from the tag of
+// its first value, and returns it with the tag that follows, and the name
+// of the next attribute when that tag starts one.
+func (d *decoder) attribute(name string, tag Tag, depth int) (Attribute, byte, string) {
+	a := Attribute{Name: name}
+	for {
+		var v Value
+		tag, v = d.value(tag, depth)
+		if d.err != nil {
+			return a, 0, ""
+		}
+		if a.Tag == 0 {
+			a.Tag = tag
+		}
+		if v != nil {
+			a.Values = append(a.Values, v)
+		}
+
+		next := d.byte()
+		if d.err != nil || next < 0x10 || next == byte(TagEndCollection) || next == byte(TagMemberAttrName) {
+			return a, next, ""
+		}
+		// Additional values have no name.
+		if name := string(d.bytes()); d.err != nil || name != "" {
+			return a, next, name
+		}
+		tag = Tag(next)
+	}
+}
+
+// value reads the value of a tag, after its name, and returns the tag it's
+// kept with.
+func (d *decoder) value(tag Tag, depth int) (Tag, Value) {
+	b := d.bytes()
+	if d.err != nil {
+		return tag, nil
+	}
+	length := func(n int) bool {
+		if len(b) != n {
+			d.err = fmt.Errorf("IPP value with tag %#02x has %d bytes, expected %d", byte(tag), len(b), n)
+			return false
+		}
+		return true
+	}
+	switch {
+	case tag >= 0x10 && tag < 0x20:
+		return tag, nil
+	case tag == TagInteger || tag == TagEnum:
+		if !length(4) {
+			return tag, nil
+		}
+		return tag, int32(binary.BigEndian.Uint32(b))
+	case tag == TagBoolean:
+		if !length(1) {
+			return tag, nil
+		}
+		return tag, b[0] != 0
+	case tag == TagResolution:
+		if !length(9) {
+			return tag, nil
+		}
+		return tag, Resolution{CrossFeed: int32(binary.BigEndian.Uint32(b)), Feed: int32(binary.BigEndian.Uint32(b[4:])), Units: ResolutionUnits(b[8])}
+	case tag == TagRangeOfInteger:
+		if !length(8) {
+			return tag, nil
+		}
+		return tag, Range{Lower: int32(binary.BigEndian.Uint32(b)), Upper: int32(binary.BigEndian.Uint32(b[4:]))}
+	case tag == TagDateTime:
+		if !length(11) {
+			return tag, nil
+		}
+		return tag, decodeDateTime(b)
+	case tag == tagTextWithLanguage || tag == tagNameWithLanguage:
+		s, ok := withoutLanguage(b)
+		if !ok {
+			d.err = fmt.Errorf("IPP value with tag %#02x is malformed", byte(tag))
+		}
+		if tag == tagTextWithLanguage {
+			return TagText, s
+		}
+		return TagName, s
+	case tag == TagBeginCollection:
+		if depth >= maxCollectionDepth {
+			d.err = errors.New("IPP collections are nested too deep")
+			return tag, nil
+		}
+		return tag, d.collection(depth + 1)
+	}
+	return tag, string(b)
+}
+
+// collection reads the members of a collection, up to its end.
+func (d *decoder) collection(depth int) Collection {
+	members := Collection{}
+	tag := d.byte()
+	for d.err == nil {
+		switch Tag(tag) {
+		case TagEndCollection:
+			d.bytes()
+			d.bytes()
+			return members
+		case TagMemberAttrName:
+			d.bytes()
+			name := string(d.bytes())
+			valueTag := d.byte()
+			if d.err != nil {
+				return nil
+			}
+			// Member values have no name.
+			d.bytes()
+			var member Attribute
+			member, tag, _ = d.attribute(name, Tag(valueTag), depth)
+			members = append(members, member)
+		default:
+			d.err = fmt.Errorf("IPP collection member without a name, tag %#02x", tag)
+		}
+	}
+	return nil
+}
+
+func withoutLanguage(b []byte) (string, bool) {
+	if len(b) < 2 {
+		return "", false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n+2 {
+		return "", false
+	}
+	b = b[2+n:]
+	n = int(binary.BigEndian.Uint16(b))
+	if len(b) != 2+n {
+		return "", false
+	}
+	return string(b[2:]), true
+}
+
+func decodeDateTime(b []byte) time.Time {
+	offset := int(b[9])*3600 + int(b[10])*60
+	if b[8] == '-' {
+		offset = -offset
+	}
+	return time.Date(int(binary.BigEndian.Uint16(b)), time.Month(b[2]), int(b[3]), int(b[4]), int(b[5]), int(b[6]), int(b[7])*100000000,
+		time.FixedZone("", offset))
+}
@@ -0,0 +1,82 @@
+package ipp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMessageRoundTrip(t *testing.T) {
+	m := &Message{Version: 0x0200, Code: 0x0002, RequestID: 42}
+	m.AddGroup(GroupOperation, Attributes{
+		newAttribute("attributes-charset", TagCharset, "utf-8"),
+		newAttribute("attributes-natural-language", TagNaturalLanguage, "en"),
+		newAttribute("printer-uri", TagURI, "ipp://localhost/ipp/print/office"),
+		newAttribute("requested-attributes", TagKeyword, "printer-name", "media-col-database"),
+	})
+	m.AddGroup(GroupJob, Attributes{
+		newAttribute("copies", TagInteger, int32(2)),
+		newAttribute("page-ranges", TagRangeOfInteger, Range{Lower: 1, Upper: 3}, Range{Lower: 5, Upper: 5}),
+		newAttribute("printer-resolution", TagResolution, Resolution{CrossFeed: 600, Feed: 600, Units: ResolutionDotsPerInch}),
+		newAttribute("media-col", TagBeginCollection, Collection{
+			newAttribute("media-size", TagBeginCollection, mediaSizeCollection(210000, 297000)),
+			newAttribute("media-source", TagKeyword, "manual"),
+		}),
+		newAttribute("printer-is-accepting-jobs", TagBoolean, true),
+		newAttribute("date-time-at-creation", TagDateTime, time.Date(2024, 3, 1, 8, 30, 15, 0, time.FixedZone("", -5*3600))),
+		newAttribute("job-name", TagNoValue),
+	})
+
+	var b bytes.Buffer
+	if err := m.Encode(&b); err != nil {
+		t.Fatal(err)
+	}
+	b.WriteString("%PDF-1.4")
+	got, err := DecodeMessage(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Times are compared by value, not by location.
+	created, _ := got.Groups[1].Attributes.Get("date-time-at-creation")
+	if !created.Values[0].(time.Time).Equal(m.Groups[1].Attributes[5].Values[0].(time.Time)) {
+		t.Errorf("expected %v got %v", m.Groups[1].Attributes[5].Values[0], created.Values[0])
+	}
+	got.Groups[1].Attributes[5].Values = m.Groups[1].Attributes[5].Values
+	if !reflect.DeepEqual(m, got) {
+		t.Errorf("expected %+v got %+v", m, got)
+	}
+	if document, _ := ioutil.ReadAll(&b); string(document) != "%PDF-1.4" {
+		t.Errorf("expected the document after the attributes got %q", document)
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	message := []byte{
+		0x01, 0x01, 0x00, 0x0b, 0x00, 0x00, 0x00, 0x01,
+		byte(GroupOperation),
+		// requesting-user-name with a language, as some clients send it.
+		byte(tagNameWithLanguage), 0x00, 0x14,
+	}
+	message = append(message, "requesting-user-name"...)
+	message = append(message, 0x00, 0x09, 0x00, 0x02, 'e', 'n', 0x00, 0x03, 'b', 'o', 'b', byte(groupEnd))
+	m, err := DecodeMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, ok := m.Group(GroupOperation).Get("requesting-user-name"); !ok || a.Tag != TagName || a.Values[0] != "bob" {
+		t.Errorf("unexpected requesting-user-name %+v", a)
+	}
+
+	for i := 1; i < len(message); i++ {
+		if _, err := DecodeMessage(bytes.NewReader(message[:i])); err == nil {
+			t.Errorf("expected an error for a message cut at %d bytes", i)
+		}
+	}
+	// An integer of 2 bytes.
+	bad := []byte{0x02, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, byte(GroupJob), byte(TagInteger), 0x00, 0x01, 'c', 0x00, 0x02, 0x00, 0x01, byte(groupEnd)}
+	if _, err := DecodeMessage(bytes.NewReader(bad)); err == nil {
+		t.Error("expected an error for a short integer")
+	}
+}
@@ -0,0 +1,509 @@
+package ipp
+
+import (
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// keywordAttributes builds the -supported and -default attributes of a
+// keyword capability. Keywords are deduplicated, keeping the first.
+func keywordAttributes(name string, keywords []string, defaultKeyword string) Attributes {
+	if len(keywords) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(keywords))
+	values := make([]Value, 0, len(keywords))
+	for _, keyword := range keywords {
+		if !seen[keyword] {
+			seen[keyword] = true
+			values = append(values, keyword)
+		}
+	}
+	if defaultKeyword == "" {
+		defaultKeyword = keywords[0]
+	}
+	return Attributes{
+		newAttribute(name+"-supported", TagKeyword, values...),
+		newAttribute(name+"-default", TagKeyword, defaultKeyword),
+	}
+}
+
+// PrinterDescriptionToAttributes converts printer capabilities into
+// printer description attributes.
+func PrinterDescriptionToAttributes(d *model.PrinterDescriptionSection) Attributes {
+	var attrs Attributes
+
+	if d.SupportedContentType != nil {
+		values := make([]Value, 0, len(*d.SupportedContentType))
+		for _, ct := range *d.SupportedContentType {
+			values = append(values, ct.ContentType)
+		}
+		if len(values) > 0 {
+			attrs = append(attrs, newAttribute("document-format-supported", TagMimeMediaType, values...))
+		}
+	}
+
+	if d.Copies != nil {
+		attrs = append(attrs,
+			newAttribute("copies-default", TagInteger, d.Copies.Default),
+			newAttribute("copies-supported", TagRangeOfInteger, Range{Lower: 1, Upper: d.Copies.Max}))
+	}
+
+	if d.Duplex != nil {
+		var keywords []string
+		var defaultKeyword string
+		for _, o := range d.Duplex.Option {
+			if sides, ok := sidesByDuplex[o.Type]; ok {
+				keywords = append(keywords, sides)
+				if o.IsDefault {
+					defaultKeyword = sides
+				}
+			}
+		}
+		attrs = append(attrs, keywordAttributes("sides", keywords, defaultKeyword)...)
+	}
+
+	if d.Color != nil {
+		var keywords []string
+		var defaultKeyword string
+		for _, o := range d.Color.Option {
+			if colorMode, ok := colorModesByColorType[o.Type]; ok {
+				keywords = append(keywords, colorMode)
+				if o.IsDefault {
+					defaultKeyword = colorMode
+				}
+			}
+		}
+		attrs = append(attrs, keywordAttributes("print-color-mode", keywords, defaultKeyword)...)
+	}
+
+	if d.PageOrientation != nil && len(d.PageOrientation.Option) > 0 {
+		values := make([]Value, 0, len(d.PageOrientation.Option))
+		defaultValue := orientationsByPageOrientation[d.PageOrientation.Option[0].Type]
+		for _, o := range d.PageOrientation.Option {
+			if orientation, ok := orientationsByPageOrientation[o.Type]; ok {
+				values = append(values, orientation)
+				if o.IsDefault {
+					defaultValue = orientation
+				}
+			}
+		}
+		if len(values) > 0 {
+			attrs = append(attrs,
+				newAttribute("orientation-requested-supported", TagEnum, values...),
+				newAttribute("orientation-requested-default", TagEnum, defaultValue))
+		}
+	}
+
+	if d.DPI != nil && len(d.DPI.Option) > 0 {
+		values := make([]Value, len(d.DPI.Option))
+		var defaultValue Value
+		for i, o := range d.DPI.Option {
+			values[i] = Resolution{CrossFeed: o.HorizontalDPI, Feed: o.VerticalDPI, Units: ResolutionDotsPerInch}
+			if o.IsDefault || defaultValue == nil {
+				defaultValue = values[i]
+			}
+		}
+		attrs = append(attrs,
+			newAttribute("printer-resolution-supported", TagResolution, values...),
+			newAttribute("printer-resolution-default", TagResolution, defaultValue))
+	}
+
+	var mediaColDefault Collection
+	if d.MediaSize != nil {
+		values := make([]Value, 0, len(d.MediaSize.Option))
+		var defaultSize Value
+		var names []string
+		var defaultName string
+		for _, o := range d.MediaSize.Option {
+			if o.WidthMicrons <= 0 || o.HeightMicrons <= 0 {
+				continue
+			}
+			size := mediaSizeCollection(o.WidthMicrons, o.HeightMicrons)
+			values = append(values, size)
+			name := MediaName(o.WidthMicrons, o.HeightMicrons)
+			names = append(names, name)
+			if o.IsDefault || defaultSize == nil {
+				defaultSize = size
+				defaultName = name
+			}
+		}
+		if len(values) > 0 {
+			attrs = append(attrs, newAttribute("media-size-supported", TagBeginCollection, values...))
+			attrs = append(attrs, keywordAttributes("media", names, defaultName)...)
+			mediaColDefault = append(mediaColDefault, newAttribute("media-size", TagBeginCollection, defaultSize))
+		}
+	}
+
+	if d.MediaSource != nil {
+		var values []Value
+		var defaultSource string
+		seen := make(map[string]bool)
+		for _, o := range d.MediaSource.Option {
+			source, ok := mediaSourcesByType[o.Type]
+			if !ok || seen[source] {
+				continue
+			}
+			seen[source] = true
+			values = append(values, source)
+			if o.IsDefault || defaultSource == "" {
+				defaultSource = source
+			}
+		}
+		if len(values) > 0 {
+			attrs = append(attrs, newAttribute("media-source-supported", TagKeyword, values...))
+			mediaColDefault = append(mediaColDefault, newAttribute("media-source", TagKeyword, defaultSource))
+		}
+	}
+
+	if len(mediaColDefault) > 0 {
+		attrs = append(attrs, newAttribute("media-col-default", TagBeginCollection, mediaColDefault))
+	}
+
+	if d.Margins != nil && len(d.Margins.Option) > 0 {
+		var top, right, bottom, left []Value
+		for _, o := range d.Margins.Option {
+			top = append(top, o.TopMicrons/micronsPerHundredthMM)
+			right = append(right, o.RightMicrons/micronsPerHundredthMM)
+			bottom = append(bottom, o.BottomMicrons/micronsPerHundredthMM)
+			left = append(left, o.LeftMicrons/micronsPerHundredthMM)
+		}
+		attrs = append(attrs,
+			newAttribute("media-top-margin-supported", TagInteger, top...),
+			newAttribute("media-right-margin-supported", TagInteger, right...),
+			newAttribute("media-bottom-margin-supported", TagInteger, bottom...),
+			newAttribute("media-left-margin-supported", TagInteger, left...))
+	}
+
+	if d.PageRange != nil {
+		attrs = append(attrs, newAttribute("page-ranges-supported", TagBoolean, true))
+	}
+
+	if d.Collate != nil {
+		defaultKeyword := uncollatedCopies
+		if d.Collate.Default {
+			defaultKeyword = collatedCopies
+		}
+		attrs = append(attrs, keywordAttributes("multiple-document-handling",
+			[]string{collatedCopies, uncollatedCopies}, defaultKeyword)...)
+	}
+
+	if d.FitToPage != nil {
+		var keywords []string
+		var defaultKeyword string
+		for _, o := range d.FitToPage.Option {
+			if scaling, ok := printScalingsByFitToPage[o.Type]; ok {
+				keywords = append(keywords, scaling)
+				if o.IsDefault {
+					defaultKeyword = scaling
+				}
+			}
+		}
+		attrs = append(attrs, keywordAttributes("print-scaling", keywords, defaultKeyword)...)
+	}
+
+	if d.ReverseOrder != nil {
+		defaultKeyword := sameOrder
+		if d.ReverseOrder.Default {
+			defaultKeyword = reverseOrder
+		}
+		attrs = append(attrs, keywordAttributes("page-delivery", []string{sameOrder, reverseOrder}, defaultKeyword)...)
+	}
+
+	return attrs
+}
+
+// stringsWithDefault reads the -supported and -default attributes of a
+// keyword capability.
+func stringsWithDefault(attrs Attributes, name string) ([]string, string, error) {
+	a, ok := attrs.Get(name + "-supported")
+	if !ok {
+		return nil, "", nil
+	}
+	supported, err := a.Strings()
+	if err != nil {
+		return nil, "", err
+	}
+	var defaultValue string
+	if a, ok := attrs.Get(name + "-default"); ok {
+		if defaultValue, err = a.StringValue(); err != nil {
+			return nil, "", err
+		}
+	}
+	return supported, defaultValue, nil
+}
+
+// PrinterDescriptionFromAttributes converts printer description attributes
+// into printer capabilities. Keyword values without a model equivalent are
+// skipped. Media sizes are returned as custom sizes, with dimensions only.
+func PrinterDescriptionFromAttributes(attrs Attributes) (*model.PrinterDescriptionSection, error) {
+	var d model.PrinterDescriptionSection
+
+	if a, ok := attrs.Get("document-format-supported"); ok {
+		formats, err := a.Strings()
+		if err != nil {
+			return nil, err
+		}
+		contentTypes := make([]model.SupportedContentType, len(formats))
+		for i, format := range formats {
+			contentTypes[i].ContentType = format
+		}
+		d.SupportedContentType = &contentTypes
+	}
+
+	if a, ok := attrs.Get("copies-supported"); ok {
+		ranges, err := a.Ranges()
+		if err != nil {
+			return nil, err
+		}
+		d.Copies = &model.Copies{Default: 1, Max: ranges[0].Upper}
+		if a, ok := attrs.Get("copies-default"); ok {
+			if d.Copies.Default, err = a.IntValue(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	sides, defaultSides, err := stringsWithDefault(attrs, "sides")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sides {
+		if duplex, ok := duplexesBySides[s]; ok {
+			if d.Duplex == nil {
+				d.Duplex = &model.Duplex{}
+			}
+			d.Duplex.Option = append(d.Duplex.Option, model.DuplexOption{Type: duplex, IsDefault: s == defaultSides})
+		}
+	}
+
+	colorModes, defaultColorMode, err := stringsWithDefault(attrs, "print-color-mode")
+	if err != nil {
+		return nil, err
+	}
+	seenColorTypes := make(map[model.ColorType]bool)
+	for _, colorMode := range colorModes {
+		colorType, ok := colorTypesByColorMode[colorMode]
+		if !ok || seenColorTypes[colorType] {
+			continue
+		}
+		seenColorTypes[colorType] = true
+		if d.Color == nil {
+			d.Color = &model.Color{}
+		}
+		d.Color.Option = append(d.Color.Option, model.ColorOption{
+			VendorID:  colorMode,
+			Type:      colorType,
+			IsDefault: colorMode == defaultColorMode,
+		})
+	}
+
+	if a, ok := attrs.Get("orientation-requested-supported"); ok {
+		orientations, err := a.Ints()
+		if err != nil {
+			return nil, err
+		}
+		var defaultOrientation int32
+		if a, ok := attrs.Get("orientation-requested-default"); ok {
+			if defaultOrientation, err = a.IntValue(); err != nil {
+				return nil, err
+			}
+		}
+		seen := make(map[model.PageOrientationType]bool)
+		for _, orientation := range orientations {
+			pageOrientation, ok := pageOrientationsByOrientation[orientation]
+			if !ok || seen[pageOrientation] {
+				continue
+			}
+			seen[pageOrientation] = true
+			if d.PageOrientation == nil {
+				d.PageOrientation = &model.PageOrientation{}
+			}
+			d.PageOrientation.Option = append(d.PageOrientation.Option, model.PageOrientationOption{
+				Type:      pageOrientation,
+				IsDefault: orientation == defaultOrientation,
+			})
+		}
+	}
+
+	if a, ok := attrs.Get("printer-resolution-supported"); ok {
+		resolutions, err := a.Resolutions()
+		if err != nil {
+			return nil, err
+		}
+		var defaultResolution Resolution
+		if a, ok := attrs.Get("printer-resolution-default"); ok {
+			defaults, err := a.Resolutions()
+			if err != nil {
+				return nil, err
+			}
+			defaultResolution = defaults[0]
+		}
+		d.DPI = &model.DPI{}
+		for _, r := range resolutions {
+			if r.Units != ResolutionDotsPerInch {
+				return nil, fmt.Errorf("unsupported printer-resolution units %d", r.Units)
+			}
+			d.DPI.Option = append(d.DPI.Option, model.DPIOption{
+				HorizontalDPI: r.CrossFeed,
+				VerticalDPI:   r.Feed,
+				IsDefault:     r == defaultResolution,
+			})
+		}
+	}
+
+	if a, ok := attrs.Get("media-size-supported"); ok {
+		sizes, err := a.Collections()
+		if err != nil {
+			return nil, err
+		}
+		var defaultWidth, defaultHeight int32
+		if a, ok := attrs.Get("media-col-default"); ok {
+			mediaCols, err := a.Collections()
+			if err != nil {
+				return nil, err
+			}
+			if a, ok := mediaCols[0].Get("media-size"); ok {
+				defaultSizes, err := a.Collections()
+				if err != nil {
+					return nil, err
+				}
+				if defaultWidth, defaultHeight, err = parseMediaSize(defaultSizes[0]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		d.MediaSize = &model.MediaSize{}
+		for _, size := range sizes {
+			width, height, err := parseMediaSize(size)
+			if err != nil {
+				return nil, err
+			}
+			d.MediaSize.Option = append(d.MediaSize.Option, model.MediaSizeOption{
+				Name:          model.MediaSizeCustom,
+				WidthMicrons:  width,
+				HeightMicrons: height,
+				IsDefault:     width == defaultWidth && height == defaultHeight,
+			})
+		}
+	}
+
+	if a, ok := attrs.Get("media-source-supported"); ok {
+		sources, err := a.Strings()
+		if err != nil {
+			return nil, err
+		}
+		var defaultSource string
+		if a, ok := attrs.Get("media-col-default"); ok {
+			mediaCols, err := a.Collections()
+			if err != nil {
+				return nil, err
+			}
+			if a, ok := mediaCols[0].Get("media-source"); ok {
+				if defaultSource, err = a.StringValue(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		seen := make(map[model.MediaSourceType]bool)
+		for _, source := range sources {
+			sourceType, ok := mediaSourceTypesBySource[source]
+			if !ok || seen[sourceType] {
+				continue
+			}
+			seen[sourceType] = true
+			if d.MediaSource == nil {
+				d.MediaSource = &model.MediaSource{}
+			}
+			d.MediaSource.Option = append(d.MediaSource.Option, model.MediaSourceOption{
+				Type:      sourceType,
+				IsDefault: source == defaultSource,
+			})
+		}
+	}
+
+	if a, ok := attrs.Get("media-top-margin-supported"); ok {
+		top, err := a.Ints()
+		if err != nil {
+			return nil, err
+		}
+		margins := make([][]int32, 3)
+		for i, name := range []string{"media-right-margin-supported", "media-bottom-margin-supported", "media-left-margin-supported"} {
+			a, ok := attrs.Get(name)
+			if !ok {
+				return nil, fmt.Errorf("media-top-margin-supported without %s", name)
+			}
+			if margins[i], err = a.Ints(); err != nil {
+				return nil, err
+			}
+			if len(margins[i]) != len(top) {
+				return nil, fmt.Errorf("%s has %d values, media-top-margin-supported has %d", name, len(margins[i]), len(top))
+			}
+		}
+		d.Margins = &model.Margins{}
+		for i := range top {
+			o := model.MarginsOption{
+				Type:          model.MarginsStandard,
+				TopMicrons:    top[i] * micronsPerHundredthMM,
+				RightMicrons:  margins[0][i] * micronsPerHundredthMM,
+				BottomMicrons: margins[1][i] * micronsPerHundredthMM,
+				LeftMicrons:   margins[2][i] * micronsPerHundredthMM,
+				IsDefault:     i == 0,
+			}
+			if o.TopMicrons == 0 && o.RightMicrons == 0 && o.BottomMicrons == 0 && o.LeftMicrons == 0 {
+				o.Type = model.MarginsBorderless
+			}
+			d.Margins.Option = append(d.Margins.Option, o)
+		}
+	}
+
+	if a, ok := attrs.Get("page-ranges-supported"); ok {
+		supported, err := a.BoolValue()
+		if err != nil {
+			return nil, err
+		}
+		if supported {
+			d.PageRange = &model.PageRange{}
+		}
+	}
+
+	handlings, defaultHandling, err := stringsWithDefault(attrs, "multiple-document-handling")
+	if err != nil {
+		return nil, err
+	}
+	for _, handling := range handlings {
+		if handling == collatedCopies {
+			d.Collate = &model.Collate{Default: defaultHandling == collatedCopies}
+		}
+	}
+
+	scalings, defaultScaling, err := stringsWithDefault(attrs, "print-scaling")
+	if err != nil {
+		return nil, err
+	}
+	seenFitToPages := make(map[model.FitToPageType]bool)
+	for _, scaling := range scalings {
+		fitToPage, ok := fitToPagesByPrintScaling[scaling]
+		if !ok || seenFitToPages[fitToPage] {
+			continue
+		}
+		seenFitToPages[fitToPage] = true
+		if d.FitToPage == nil {
+			d.FitToPage = &model.FitToPage{}
+		}
+		d.FitToPage.Option = append(d.FitToPage.Option, model.FitToPageOption{Type: fitToPage, IsDefault: scaling == defaultScaling})
+	}
+
+	deliveries, defaultDelivery, err := stringsWithDefault(attrs, "page-delivery")
+	if err != nil {
+		return nil, err
+	}
+	for _, delivery := range deliveries {
+		if delivery == reverseOrder {
+			d.ReverseOrder = &model.ReverseOrder{Default: defaultDelivery == reverseOrder}
+		}
+	}
+
+	return &d, nil
+}
@@ -10,6 +10,9 @@ type PrintJobState struct {
 type PrintJobStateDiff struct {
 	State        *JobState `json:"state,omitempty"`
 	PagesPrinted *int32    `json:"pages_printed,omitempty"`
+	// Pages and bytes spooled so far, which grow while the job spools.
+	TotalPages   *int32 `json:"total_pages,omitempty"`
+	SpooledBytes *int64 `json:"spooled_bytes,omitempty"`
 }
 
 type JobStateType string
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type JobTicket struct {
 	VendorTicketItem []VendorTicketItem         `json:"vendor_ticket_item,omitempty"`
 	Color            *ColorTicketItem           `json:"color,omitempty"`
@@ -9,10 +11,16 @@ type JobTicket struct {
 	Margins          *MarginsTicketItem         `json:"margins,omitempty"`
 	DPI              *DPITicketItem             `json:"dpi,omitempty"`
 	FitToPage        *FitToPageTicketItem       `json:"fit_to_page,omitempty"`
+	Scale            *ScaleTicketItem           `json:"scale,omitempty"`
 	PageRange        *PageRangeTicketItem       `json:"page_range,omitempty"`
 	MediaSize        *MediaSizeTicketItem       `json:"media_size,omitempty"`
+	MediaSource      *MediaSourceTicketItem     `json:"media_source,omitempty"`
 	Collate          *CollateTicketItem         `json:"collate,omitempty"`
 	ReverseOrder     *ReverseOrderTicketItem    `json:"reverse_order,omitempty"`
+	NUp              *NUpTicketItem             `json:"n_up,omitempty"`
+	Booklet          *BookletTicketItem         `json:"booklet,omitempty"`
+	HoldUntil        *HoldUntilTicketItem       `json:"hold_until,omitempty"`
+	Hold             *HoldTicketItem            `json:"hold,omitempty"`
 }
 
 type VendorTicketItem struct {
@@ -54,10 +62,43 @@ type FitToPageTicketItem struct {
 	Type FitToPageType `json:"type"`
 }
 
+// ScaleTicketItem prints pages at a percentage of their size, from the top
+// left corner of the margins, instead of fitting them to the paper, so that
+// labels and pre-printed forms line up.
+type ScaleTicketItem struct {
+	// 1 to 1000.
+	Percent int32 `json:"percent"`
+}
+
 type PageRangeTicketItem struct {
 	Interval []PageRangeInterval `json:"interval"`
 }
 
+// Contains tells whether the 1-based page is selected; all pages are
+// selected by an empty range.
+func (r *PageRangeTicketItem) Contains(page int32) bool {
+	if len(r.Interval) == 0 {
+		return true
+	}
+	for _, interval := range r.Interval {
+		if page >= interval.Start && (interval.End == 0 || page <= interval.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns the number of pages selected in a document of pages pages.
+func (r *PageRangeTicketItem) Count(pages int32) int32 {
+	var count int32
+	for page := int32(1); page <= pages; page++ {
+		if r.Contains(page) {
+			count++
+		}
+	}
+	return count
+}
+
 type MediaSizeTicketItem struct {
 	WidthMicrons     int32  `json:"width_microns"`
 	HeightMicrons    int32  `json:"height_microns"`
@@ -65,6 +106,12 @@ type MediaSizeTicketItem struct {
 	VendorID         string `json:"vendor_id"`
 }
 
+// MediaSourceTicketItem selects a tray by vendor ID, or else by type.
+type MediaSourceTicketItem struct {
+	Type     MediaSourceType `json:"type,omitempty"`
+	VendorID string          `json:"vendor_id,omitempty"`
+}
+
 type CollateTicketItem struct {
 	Collate bool `json:"collate"`
 }
@@ -72,3 +119,40 @@ type CollateTicketItem struct {
 type ReverseOrderTicketItem struct {
 	ReverseOrder bool `json:"reverse_order"`
 }
+
+// NUpTicketItem prints several document pages on each side of a sheet,
+// scaled down, such as for handouts.
+type NUpTicketItem struct {
+	// 1, 2, 4 or 6.
+	PagesPerSheet int32         `json:"pages_per_sheet"`
+	Layout        NUpLayoutType `json:"layout,omitempty"` // default = RIGHT_THEN_DOWN
+}
+
+// BookletTicketItem prints pages two per side, duplex along the short edge,
+// in the order that makes a saddle-stitched booklet once the sheets are
+// folded in half.
+type BookletTicketItem struct {
+	Booklet bool `json:"booklet"`
+}
+
+// HoldUntilTicketItem holds the job in the queue until a time, such as
+// during the night; a time already past prints it right away.
+type HoldUntilTicketItem struct {
+	Time time.Time `json:"time"`
+}
+
+// HoldTicketItem holds the job paused until it is released, by an operator
+// or with its PIN, for secure printing.
+type HoldTicketItem struct {
+	PIN string `json:"pin,omitempty"`
+}
+
+// NUpLayoutType is the order pages are placed in on a sheet.
+type NUpLayoutType string
+
+const (
+	NUpRightThenDown NUpLayoutType = "RIGHT_THEN_DOWN"
+	NUpDownThenRight NUpLayoutType = "DOWN_THEN_RIGHT"
+	NUpLeftThenDown  NUpLayoutType = "LEFT_THEN_DOWN"
+	NUpDownThenLeft  NUpLayoutType = "DOWN_THEN_LEFT"
+)
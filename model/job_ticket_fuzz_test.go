@@ -0,0 +1,49 @@
+//go:build go1.18
+// +build go1.18
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func FuzzParseJobTicket(f *testing.F) {
+	f.Add([]byte(`{"copies": {"copies": 2}, "duplex": {"type": "LONG_EDGE"}}`))
+	f.Add([]byte(`{"media_size": {"width_microns": 210000, "height_microns": 297000}, "page_range": {"interval": [{"start": 1, "end": 3}]}}`))
+	f.Add([]byte(`{"vendor_ticket_item": [{"id": "darkness", "value": "15"}], "color": {"type": "STANDARD_MONOCHROME"}}`))
+	f.Add([]byte(`{} {}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, strict := range []bool{false, true} {
+			ticket, err := ParseJobTicket(data, ParseJobTicketOptions{Strict: strict})
+			if err != nil {
+				continue
+			}
+			if strict {
+				if err = ticket.Validate(); err != nil {
+					t.Fatalf("strictly parsed ticket is invalid: %s", err)
+				}
+			}
+
+			// A parsed ticket survives a round trip. Compare the encodings, since
+			// empty lists are omitted and come back as nil.
+			b, err := json.Marshal(ticket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			again, err := ParseJobTicket(b, ParseJobTicketOptions{Strict: strict})
+			if err != nil {
+				t.Fatalf("re-parsing %s: %s", b, err)
+			}
+			b2, err := json.Marshal(again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(b, b2) {
+				t.Fatalf("round trip changed the ticket: %s became %s", b, b2)
+			}
+		}
+	})
+}
@@ -0,0 +1,255 @@
+package model
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// JobTicketSchema is the JSON schema of JobTicket, for integrators that
+// validate tickets on their side.
+//
+//go:embed job_ticket.schema.json
+var JobTicketSchema []byte
+
+type ParseJobTicketOptions struct {
+	// Strict rejects unknown fields and values out of range, instead of
+	// silently ignoring them when printing.
+	Strict bool
+}
+
+// ParseJobTicket unmarshals a JSON job ticket.
+func ParseJobTicket(data []byte, options ParseJobTicketOptions) (*JobTicket, error) {
+	var ticket JobTicket
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if options.Strict {
+		decoder.DisallowUnknownFields()
+	}
+	if err := decoder.Decode(&ticket); err != nil {
+		return nil, &TicketError{Problems: []string{err.Error()}}
+	}
+	if options.Strict {
+		if decoder.More() {
+			return nil, &TicketError{Problems: []string{"unexpected data after the ticket"}}
+		}
+		if err := ticket.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &ticket, nil
+}
+
+// ParsePageRange parses a list of 1-based pages and intervals, e.g.
+// "1-3,7,9-", where an interval without end runs to the last page.
+func ParsePageRange(s string) (*PageRangeTicketItem, error) {
+	var r PageRangeTicketItem
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end := part, part
+		if i := strings.Index(part, "-"); i >= 0 {
+			start, end = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+1:])
+		}
+		var interval PageRangeInterval
+		n, err := strconv.ParseInt(start, 10, 32)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid page range %q: bad start page %q", s, start)
+		}
+		interval.Start = int32(n)
+		if end != "" {
+			n, err = strconv.ParseInt(end, 10, 32)
+			if err != nil || int32(n) < interval.Start {
+				return nil, fmt.Errorf("invalid page range %q: bad end page %q", s, end)
+			}
+			interval.End = int32(n)
+		}
+		r.Interval = append(r.Interval, interval)
+	}
+	if len(r.Interval) == 0 {
+		return nil, fmt.Errorf("invalid page range %q: no pages", s)
+	}
+	return &r, nil
+}
+
+// ParseMargins parses margins in millimeters, as in CSS: "10" for all
+// sides, "10,5" for top and bottom then left and right, or "10,5,8,5" for
+// top, right, bottom and left.
+func ParseMargins(s string) (*MarginsTicketItem, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) == 3 || len(parts) > 4 {
+		return nil, fmt.Errorf("invalid margins %q: give 1, 2 or 4 values", s)
+	}
+	microns := make([]int32, len(parts))
+	for i, part := range parts {
+		mm, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || mm < 0 || mm > 1000 {
+			return nil, fmt.Errorf("invalid margins %q: bad margin %q", s, part)
+		}
+		microns[i] = int32(mm*1000 + 0.5)
+	}
+	switch len(microns) {
+	case 1:
+		microns = []int32{microns[0], microns[0], microns[0], microns[0]}
+	case 2:
+		microns = []int32{microns[0], microns[1], microns[0], microns[1]}
+	}
+	return &MarginsTicketItem{TopMicrons: microns[0], RightMicrons: microns[1], BottomMicrons: microns[2], LeftMicrons: microns[3]}, nil
+}
+
+// ParseNUp parses a number of pages per sheet, optionally followed by a
+// layout, e.g. "4" or "4:down-then-right".
+func ParseNUp(s string) (*NUpTicketItem, error) {
+	count, layout := s, ""
+	if i := strings.Index(s, ":"); i >= 0 {
+		count, layout = s[:i], s[i+1:]
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(count), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid n-up %q: bad pages per sheet %q", s, count)
+	}
+	item := &NUpTicketItem{
+		PagesPerSheet: int32(n),
+		Layout:        NUpLayoutType(strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(layout), "-", "_"))),
+	}
+	if err = (&JobTicket{NUp: item}).Validate(); err != nil {
+		return nil, fmt.Errorf("invalid n-up %q: %s", s, err)
+	}
+	return item, nil
+}
+
+// TicketError lists the problems found in a job ticket.
+type TicketError struct {
+	Problems []string
+}
+
+func (e *TicketError) Error() string {
+	return fmt.Sprintf("invalid job ticket: %s", strings.Join(e.Problems, "; "))
+}
+
+// RangeError is a ticket value outside the range a printer driver accepts.
+type RangeError struct {
+	// Ticket field, as named in the JSON ticket, e.g. "copies.copies".
+	Option   string
+	Value    int64
+	Min, Max int64
+}
+
+func (e *RangeError) Error() string {
+	return fmt.Sprintf("%s %d is out of range, must be between %d and %d", e.Option, e.Value, e.Min, e.Max)
+}
+
+// Validate checks that enum values are known and numbers are in range.
+// All problems found are reported in a single error.
+func (t *JobTicket) Validate() error {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	for i, item := range t.VendorTicketItem {
+		if item.ID == "" {
+			add("vendor_ticket_item[%d].id is empty", i)
+		}
+	}
+	if t.Color != nil {
+		switch t.Color.Type {
+		case "", ColorTypeStandardColor, ColorTypeStandardMonochrome, ColorTypeCustomColor, ColorTypeCustomMonochrome, ColorTypeAuto:
+		default:
+			add("unknown color.type %q", t.Color.Type)
+		}
+	}
+	if t.Duplex != nil {
+		switch t.Duplex.Type {
+		case DuplexNoDuplex, DuplexLongEdge, DuplexShortEdge:
+		default:
+			add("unknown duplex.type %q", t.Duplex.Type)
+		}
+	}
+	if t.PageOrientation != nil {
+		switch t.PageOrientation.Type {
+		case PageOrientationPortrait, PageOrientationLandscape, PageOrientationAuto:
+		default:
+			add("unknown page_orientation.type %q", t.PageOrientation.Type)
+		}
+	}
+	if t.Copies != nil && t.Copies.Copies < 1 {
+		add("copies.copies must be at least 1, got %d", t.Copies.Copies)
+	}
+	if t.Margins != nil {
+		if t.Margins.TopMicrons < 0 || t.Margins.RightMicrons < 0 || t.Margins.BottomMicrons < 0 || t.Margins.LeftMicrons < 0 {
+			add("margins must not be negative")
+		}
+	}
+	if t.DPI != nil && (t.DPI.HorizontalDPI < 1 || t.DPI.VerticalDPI < 1) {
+		add("dpi must be positive, got %dx%d", t.DPI.HorizontalDPI, t.DPI.VerticalDPI)
+	}
+	if t.FitToPage != nil {
+		switch t.FitToPage.Type {
+		case FitToPageNoFitting, FitToPageFitToPage, FitToPageGrowToPage, FitToPageShrinkToPage, FitToPageFillPage:
+		default:
+			add("unknown fit_to_page.type %q", t.FitToPage.Type)
+		}
+	}
+	if t.Scale != nil && (t.Scale.Percent < 1 || t.Scale.Percent > 1000) {
+		add("scale.percent must be from 1 to 1000, got %d", t.Scale.Percent)
+	}
+	if t.PageRange != nil {
+		for i, interval := range t.PageRange.Interval {
+			if interval.Start < 1 {
+				add("page_range.interval[%d].start must be at least 1, got %d", i, interval.Start)
+			}
+			if interval.End != 0 && interval.End < interval.Start {
+				add("page_range.interval[%d].end %d is before start %d", i, interval.End, interval.Start)
+			}
+		}
+	}
+	if t.MediaSize != nil && t.MediaSize.VendorID == "" {
+		if t.MediaSize.WidthMicrons <= 0 || t.MediaSize.HeightMicrons <= 0 {
+			add("media_size needs a vendor_id, or positive width_microns and height_microns")
+		}
+	}
+	if t.MediaSource != nil {
+		switch t.MediaSource.Type {
+		case MediaSourceAuto, MediaSourceUpper, MediaSourceMiddle, MediaSourceLower, MediaSourceManual,
+			MediaSourceEnvelope, MediaSourceEnvelopeManual, MediaSourceTractor, MediaSourceSmallFormat,
+			MediaSourceLargeFormat, MediaSourceLargeCapacity, MediaSourceCassette, MediaSourceFormSource:
+		case "", MediaSourceCustom:
+			if t.MediaSource.VendorID == "" {
+				add("media_source needs a vendor_id, or a type other than CUSTOM")
+			}
+		default:
+			add("unknown media_source.type %q", t.MediaSource.Type)
+		}
+	}
+
+	if t.NUp != nil {
+		switch t.NUp.PagesPerSheet {
+		case 1, 2, 4, 6:
+		default:
+			add("n_up.pages_per_sheet must be 1, 2, 4 or 6, got %d", t.NUp.PagesPerSheet)
+		}
+		switch t.NUp.Layout {
+		case "", NUpRightThenDown, NUpDownThenRight, NUpLeftThenDown, NUpDownThenLeft:
+		default:
+			add("unknown n_up.layout %q", t.NUp.Layout)
+		}
+	}
+	if t.HoldUntil != nil && t.HoldUntil.Time.IsZero() {
+		add("hold_until.time is empty")
+	}
+	if t.Hold != nil && t.Hold.PIN != "" {
+		if len(t.Hold.PIN) < 4 || len(t.Hold.PIN) > 12 || strings.Trim(t.Hold.PIN, "0123456789") != "" {
+			add("hold.pin must be 4 to 12 digits")
+		}
+	}
+
+	if len(problems) > 0 {
+		return &TicketError{Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package model
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseJobTicket(t *testing.T) {
+	typo := []byte(`{"copies": {"copies": 2}, "duplx": {"type": "LONG_EDGE"}}`)
+
+	ticket, err := ParseJobTicket(typo, ParseJobTicketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Copies.Copies != 2 || ticket.Duplex != nil {
+		t.Errorf("unexpected ticket %+v", ticket)
+	}
+
+	_, err = ParseJobTicket(typo, ParseJobTicketOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "duplx") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+
+	_, err = ParseJobTicket([]byte(`{"copies": {"copies": 0}, "duplex": {"type": "LONG"}}`), ParseJobTicketOptions{Strict: true})
+	if err == nil || !strings.Contains(err.Error(), "copies") || !strings.Contains(err.Error(), "LONG") {
+		t.Errorf("expected range and enum errors, got %v", err)
+	}
+	var ticketErr *TicketError
+	if !errors.As(err, &ticketErr) || len(ticketErr.Problems) != 2 {
+		t.Errorf("expected a TicketError with 2 problems, got %#v", err)
+	}
+
+	for _, tray := range []string{`{"type": "TOP"}`, `{"type": "CUSTOM"}`, `{}`} {
+		if _, err = ParseJobTicket([]byte(`{"media_source": `+tray+`}`), ParseJobTicketOptions{Strict: true}); err == nil {
+			t.Errorf("expected error for media_source %s", tray)
+		}
+	}
+	if _, err = ParseJobTicket([]byte(`{"media_source": {"type": "CUSTOM", "vendor_id": "260"}}`), ParseJobTicketOptions{Strict: true}); err != nil {
+		t.Errorf("unexpected error for driver tray: %v", err)
+	}
+	for _, pin := range []string{"123", "12ab", "1234567890123"} {
+		if _, err = ParseJobTicket([]byte(`{"hold": {"pin": "`+pin+`"}}`), ParseJobTicketOptions{Strict: true}); err == nil {
+			t.Errorf("expected error for hold.pin %s", pin)
+		}
+	}
+}
+
+func TestJobTicketSchema(t *testing.T) {
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(JobTicketSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every ticket field should be described by the schema.
+	var fields map[string]interface{}
+	b, _ := json.Marshal(JobTicket{
+		VendorTicketItem: []VendorTicketItem{{}},
+		Color:            &ColorTicketItem{},
+		Duplex:           &DuplexTicketItem{},
+		PageOrientation:  &PageOrientationTicketItem{},
+		Copies:           &CopiesTicketItem{},
+		Margins:          &MarginsTicketItem{},
+		DPI:              &DPITicketItem{},
+		FitToPage:        &FitToPageTicketItem{},
+		Scale:            &ScaleTicketItem{},
+		PageRange:        &PageRangeTicketItem{},
+		MediaSize:        &MediaSizeTicketItem{},
+		Collate:          &CollateTicketItem{},
+		ReverseOrder:     &ReverseOrderTicketItem{},
+		NUp:              &NUpTicketItem{},
+		Booklet:          &BookletTicketItem{},
+		HoldUntil:        &HoldUntilTicketItem{},
+		Hold:             &HoldTicketItem{},
+	})
+	json.Unmarshal(b, &fields)
+	for field := range fields {
+		if _, ok := schema.Properties[field]; !ok {
+			t.Errorf("field %s missing from schema", field)
+		}
+	}
+}
+
+func TestParsePageRange(t *testing.T) {
+	r, err := ParsePageRange("1-3, 7,9-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageRangeInterval{{Start: 1, End: 3}, {Start: 7, End: 7}, {Start: 9}}
+	if len(r.Interval) != len(want) {
+		t.Fatalf("expected %v got %v", want, r.Interval)
+	}
+	for i := range want {
+		if r.Interval[i] != want[i] {
+			t.Errorf("expected %v got %v", want, r.Interval)
+		}
+	}
+
+	var selected []int32
+	for page := int32(1); page <= 10; page++ {
+		if r.Contains(page) {
+			selected = append(selected, page)
+		}
+	}
+	if len(selected) != 6 || selected[3] != 7 || selected[5] != 10 || r.Count(10) != 6 || r.Count(2) != 2 {
+		t.Errorf("unexpected pages selected %v", selected)
+	}
+	if (&PageRangeTicketItem{}).Count(4) != 4 {
+		t.Error("empty range should select all pages")
+	}
+
+	for _, s := range []string{"", "0", "3-1", "a-2", "-4", ","} {
+		if _, err := ParsePageRange(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseMargins(t *testing.T) {
+	for s, want := range map[string]MarginsTicketItem{
+		"10":          {10000, 10000, 10000, 10000},
+		"10, 5":       {10000, 5000, 10000, 5000},
+		"1,2.5,3,0.4": {1000, 2500, 3000, 400},
+	} {
+		got, err := ParseMargins(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+		} else if *got != want {
+			t.Errorf("%q: expected %+v got %+v", s, want, *got)
+		}
+	}
+	for _, s := range []string{"", "1,2,3", "-1", "a", "1,2,3,4,5"} {
+		if _, err := ParseMargins(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseNUp(t *testing.T) {
+	for s, want := range map[string]NUpTicketItem{
+		"4":                   {PagesPerSheet: 4},
+		"2:down-then-right":   {PagesPerSheet: 2, Layout: NUpDownThenRight},
+		" 6 : LEFT_THEN_DOWN": {PagesPerSheet: 6, Layout: NUpLeftThenDown},
+	} {
+		got, err := ParseNUp(s)
+		if err != nil {
+			t.Errorf("%q: %v", s, err)
+		} else if *got != want {
+			t.Errorf("%q: expected %+v got %+v", s, want, *got)
+		}
+	}
+	for _, s := range []string{"", "3", "four", "4:spiral"} {
+		if _, err := ParseNUp(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+// Package rpc exposes the spooler over gRPC, with the service of
+// rpc/spoolerpb, for typed remote access to Windows print hosts. The
+// generated spoolerpb.SpoolerClient is the client.
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/rpc/spoolerpb"
+	"github.com/gorpher/winspool-cgo/server"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultPollInterval is how often StreamJobEvents reads the state of a job
+// between spooler events.
+const DefaultPollInterval = 2 * time.Second
+
+// Server implements spoolerpb.SpoolerServer over the same printers and
+// spooler as the HTTP server; register it with
+// spoolerpb.RegisterSpoolerServer.
+type Server struct {
+	spoolerpb.UnimplementedSpoolerServer
+
+	Printers server.Printers
+	Spooler  server.Spooler
+
+	// Subscribes to spooler events, so that StreamJobEvents sees changes
+	// without waiting for the next poll; winspool.WinSpool.Subscribe. Jobs
+	// are only polled when nil.
+	Subscribe func(ctx context.Context) (<-chan lib.Event, error)
+	// DefaultPollInterval when zero.
+	PollInterval time.Duration
+
+	// Limits the size of submitted documents; server.DefaultMaxUploadSize
+	// when zero.
+	MaxUploadSize int64
+	// Parse tickets strictly, rejecting unknown fields and invalid values.
+	StrictTickets bool
+}
+
+func (s *Server) printer(name string) (*lib.Printer, error) {
+	printer, exists := s.Printers.GetPrinter(name)
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "printer %s not found", name)
+	}
+	return &printer, nil
+}
+
+// spoolerError converts the errors of the spooler to gRPC status errors.
+func spoolerError(err error) error {
+	var ticketErr *model.TicketError
+	var rangeErr *model.RangeError
+	switch {
+	case errors.Is(err, lib.ErrAccessDenied):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, lib.ErrPrinterNotFound), errors.Is(err, lib.ErrJobNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, lib.ErrSpoolerUnavailable):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, lib.ErrQuotaExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, lib.ErrDuplicateJob):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.As(err, &ticketErr) || errors.As(err, &rangeErr), errors.Is(err, lib.ErrInvalidDocument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) ListPrinters(ctx context.Context, req *spoolerpb.ListPrintersRequest) (*spoolerpb.ListPrintersResponse, error) {
+	printers := s.Printers.GetPrinters()
+	sort.Slice(printers, func(i, j int) bool { return printers[i].Name < printers[j].Name })
+
+	response := &spoolerpb.ListPrintersResponse{}
+	for _, printer := range printers {
+		p := &spoolerpb.Printer{
+			Name:         printer.Name,
+			DisplayName:  printer.DefaultDisplayName,
+			Manufacturer: printer.Manufacturer,
+			Model:        printer.Model,
+			Offline:      printer.Offline,
+		}
+		if printer.State != nil {
+			p.State = string(printer.State.State)
+		}
+		response.Printers = append(response.Printers, p)
+	}
+	return response, nil
+}
+
+func (s *Server) GetCapabilities(ctx context.Context, req *spoolerpb.GetCapabilitiesRequest) (*spoolerpb.Capabilities, error) {
+	printer, err := s.printer(req.Printer)
+	if err != nil {
+		return nil, err
+	}
+	cdd, err := json.Marshal(printer.Description)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &spoolerpb.Capabilities{Printer: printer.Name, Cdd: cdd}, nil
+}
+
+func (s *Server) SubmitJob(stream spoolerpb.Spooler_SubmitJobServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	header := req.GetHeader()
+	if header == nil {
+		return status.Error(codes.InvalidArgument, "the first message must be the header")
+	}
+	printer, err := s.printer(header.Printer)
+	if err != nil {
+		return err
+	}
+	ticket := &model.JobTicket{}
+	if len(header.Ticket) > 0 {
+		if ticket, err = model.ParseJobTicket(header.Ticket, model.ParseJobTicketOptions{Strict: s.StrictTickets}); err != nil {
+			return status.Errorf(codes.InvalidArgument, "invalid ticket: %s", err)
+		}
+	}
+	title := header.Title
+	if title == "" {
+		title = "document"
+	}
+
+	dir, err := ioutil.TempDir("", "winspool-job")
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "document")
+	if err = s.receiveDocument(stream, fileName); err != nil {
+		return err
+	}
+
+	result, err := s.Spooler.Print(printer, fileName, title, ticket)
+	if err != nil {
+		return spoolerError(err)
+	}
+	return stream.SendAndClose(&spoolerpb.SubmitJobResponse{
+		JobId:  result.JobID,
+		JobIds: result.JobIDs,
+		Pages:  int32(result.Pages),
+	})
+}
+
+// receiveDocument writes the chunks that follow the header to fileName.
+func (s *Server) receiveDocument(stream spoolerpb.Spooler_SubmitJobServer, fileName string) error {
+	maxSize := s.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = server.DefaultMaxUploadSize
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer f.Close()
+
+	var size int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		chunk := req.GetChunk()
+		if req.GetHeader() != nil {
+			return status.Error(codes.InvalidArgument, "only the first message can be a header")
+		}
+		if size += int64(len(chunk)); size > maxSize {
+			return status.Errorf(codes.ResourceExhausted, "document larger than %d bytes", maxSize)
+		}
+		if _, err = f.Write(chunk); err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+	}
+	if size == 0 {
+		return status.Error(codes.InvalidArgument, "missing document")
+	}
+	if err = f.Close(); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return nil
+}
+
+func (s *Server) GetJobState(ctx context.Context, req *spoolerpb.GetJobStateRequest) (*spoolerpb.JobState, error) {
+	printer, err := s.printer(req.Printer)
+	if err != nil {
+		return nil, err
+	}
+	state, err := s.Spooler.GetJobState(printer.Name, req.JobId)
+	if err != nil {
+		return nil, spoolerError(err)
+	}
+	return newJobState(state), nil
+}
+
+func (s *Server) StreamJobEvents(req *spoolerpb.StreamJobEventsRequest, stream spoolerpb.Spooler_StreamJobEventsServer) error {
+	printer, err := s.printer(req.Printer)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	var events <-chan lib.Event
+	if s.Subscribe != nil {
+		// Polling still follows the job when events are unavailable.
+		events, _ = s.Subscribe(ctx)
+	}
+	interval := s.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	var sendErr error
+	getState := func() (*model.PrintJobStateDiff, error) {
+		return s.Spooler.GetJobState(printer.Name, req.JobId)
+	}
+	_, err = lib.WatchJob(ctx, req.JobId, getState, events, interval, func(state *model.PrintJobStateDiff) {
+		if sendErr == nil {
+			if sendErr = stream.Send(newJobState(state)); sendErr != nil {
+				cancel()
+			}
+		}
+	})
+	switch {
+	case sendErr != nil:
+		return sendErr
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case err != nil:
+		return spoolerError(err)
+	}
+	return nil
+}
+
+func (s *Server) CancelJob(ctx context.Context, req *spoolerpb.CancelJobRequest) (*spoolerpb.CancelJobResponse, error) {
+	printer, err := s.printer(req.Printer)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.Spooler.CancelJob(printer.Name, req.JobId); err != nil {
+		return nil, spoolerError(err)
+	}
+	return &spoolerpb.CancelJobResponse{}, nil
+}
+
+func newJobState(state *model.PrintJobStateDiff) *spoolerpb.JobState {
+	js := &spoolerpb.JobState{
+		PagesPrinted: state.PagesPrinted,
+		TotalPages:   state.TotalPages,
+		SpooledBytes: state.SpooledBytes,
+	}
+	if state.State == nil {
+		return js
+	}
+	js.Type = string(state.State.Type)
+	switch cause := state.State; {
+	case cause.UserActionCause != nil:
+		js.Cause = string(cause.UserActionCause.ActionCode)
+	case cause.DeviceStateCause != nil:
+		js.Cause = string(cause.DeviceStateCause.ErrorCode)
+	case cause.DeviceActionCause != nil:
+		js.Cause = string(cause.DeviceActionCause.ErrorCode)
+	case cause.ServiceActionCause != nil:
+		js.Cause = string(cause.ServiceActionCause.ErrorCode)
+	}
+	return js
+}
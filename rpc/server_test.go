@@ -0,0 +1,183 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/rpc/spoolerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type testPrinters []lib.Printer
+
+func (p testPrinters) GetPrinter(name string) (lib.Printer, bool) {
+	for _, printer := range p {
+		if printer.Name == name {
+			return printer, true
+		}
+	}
+	return lib.Printer{}, false
+}
+
+func (p testPrinters) GetPrinters() []lib.Printer {
+	return append([]lib.Printer{}, p...)
+}
+
+// testSpooler prints one job, whose states are returned in turn.
+type testSpooler struct {
+	mutex    sync.Mutex
+	document []byte
+	title    string
+	ticket   *model.JobTicket
+	states   []*model.PrintJobStateDiff
+}
+
+func (s *testSpooler) Print(printer *lib.Printer, fileName, title string, ticket *model.JobTicket) (*lib.PrintResult, error) {
+	document, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	s.document, s.title, s.ticket = document, title, ticket
+	return &lib.PrintResult{JobID: 7, JobIDs: []uint32{7}, Pages: 2}, nil
+}
+
+func (s *testSpooler) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if jobID != 7 {
+		return nil, fmt.Errorf("job %d not found", jobID)
+	}
+	state := s.states[0]
+	if len(s.states) > 1 {
+		s.states = s.states[1:]
+	}
+	return state, nil
+}
+
+func (s *testSpooler) CancelJob(printerName string, jobID uint32) error {
+	return fmt.Errorf("cancelling job %d of another user %w", jobID, lib.ErrAdminRequired)
+}
+
+func pages(n int32) *int32 { return &n }
+
+func newTestClient(t *testing.T, s *Server) spoolerpb.SpoolerClient {
+	listener := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	spoolerpb.RegisterSpoolerServer(srv, s)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return spoolerpb.NewSpoolerClient(conn)
+}
+
+func TestServer(t *testing.T) {
+	printers := testPrinters{{
+		Name:        "office",
+		Model:       "LaserJet",
+		State:       &model.PrinterStateSection{State: model.CloudDeviceStateIdle},
+		Description: &model.PrinterDescriptionSection{Copies: &model.Copies{Default: 1, Max: 99}},
+	}}
+	spooler := &testSpooler{states: []*model.PrintJobStateDiff{
+		{State: &model.JobState{Type: model.JobStateInProgress}, PagesPrinted: pages(0)},
+		{State: &model.JobState{Type: model.JobStateInProgress}, PagesPrinted: pages(0)},
+		{State: &model.JobState{Type: model.JobStateInProgress}, PagesPrinted: pages(1)},
+		{State: &model.JobState{Type: model.JobStateDone}, PagesPrinted: pages(2)},
+	}}
+	client := newTestClient(t, &Server{Printers: printers, Spooler: spooler, PollInterval: time.Millisecond})
+	ctx := context.Background()
+
+	list, err := client.ListPrinters(ctx, &spoolerpb.ListPrintersRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Printers) != 1 || list.Printers[0].Name != "office" || list.Printers[0].State != "IDLE" {
+		t.Errorf("unexpected printers %v", list.Printers)
+	}
+	caps, err := client.GetCapabilities(ctx, &spoolerpb.GetCapabilitiesRequest{Printer: "office"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"copies":{"default":1,"max":99}}`; string(caps.Cdd) != want {
+		t.Errorf("expected capabilities %s got %s", want, caps.Cdd)
+	}
+	if _, err = client.GetCapabilities(ctx, &spoolerpb.GetCapabilitiesRequest{Printer: "missing"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a missing printer got %v", err)
+	}
+
+	submit, err := client.SubmitJob(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := &spoolerpb.SubmitJobRequest_Header{Printer: "office", Title: "invoice", Ticket: []byte(`{"copies": {"copies": 2}}`)}
+	for _, req := range []*spoolerpb.SubmitJobRequest{
+		{Part: &spoolerpb.SubmitJobRequest_Header_{Header: header}},
+		{Part: &spoolerpb.SubmitJobRequest_Chunk{Chunk: []byte("%PDF-1.4 ")}},
+		{Part: &spoolerpb.SubmitJobRequest_Chunk{Chunk: []byte("document")}},
+	} {
+		if err = submit.Send(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	result, err := submit.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.JobId != 7 || result.Pages != 2 {
+		t.Errorf("unexpected result %v", result)
+	}
+	if string(spooler.document) != "%PDF-1.4 document" || spooler.title != "invoice" || spooler.ticket.Copies.Copies != 2 {
+		t.Errorf("unexpected document %q titled %q", spooler.document, spooler.title)
+	}
+
+	events, err := client.StreamJobEvents(ctx, &spoolerpb.StreamJobEventsRequest{Printer: "office", JobId: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var printed []int32
+	for {
+		state, err := events.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		printed = append(printed, state.GetPagesPrinted())
+		if state.Type == "DONE" && state.GetPagesPrinted() != 2 {
+			t.Errorf("expected 2 pages printed when done got %d", state.GetPagesPrinted())
+		}
+	}
+	if fmt.Sprint(printed) != "[0 1 2]" {
+		t.Errorf("expected one event per transition got pages %v", printed)
+	}
+
+	if _, err = client.CancelJob(ctx, &spoolerpb.CancelJobRequest{Printer: "office", JobId: 7}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("expected PermissionDenied got %v", err)
+	}
+}
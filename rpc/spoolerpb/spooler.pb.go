@@ -0,0 +1,1162 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+// The spooler of a Windows print host, for remote control over gRPC.
+//
+// Regenerate spooler.pb.go and spooler_grpc.pb.go with:
+//
+//	protoc --go_out=. --go_opt=paths=source_relative \
+//	  --go-grpc_out=. --go-grpc_opt=paths=source_relative spooler.proto
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.28.1
+// 	protoc        (unknown)
+// source: spooler.proto
+
+package spoolerpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Printer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name         string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	DisplayName  string `protobuf:"bytes,2,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	Manufacturer string `protobuf:"bytes,3,opt,name=manufacturer,proto3" json:"manufacturer,omitempty"`
+	Model        string `protobuf:"bytes,4,opt,name=model,proto3" json:"model,omitempty"`
+	// CloudDeviceState: IDLE, PROCESSING or STOPPED.
+	State   string `protobuf:"bytes,5,opt,name=state,proto3" json:"state,omitempty"`
+	Offline bool   `protobuf:"varint,6,opt,name=offline,proto3" json:"offline,omitempty"`
+}
+
+func (x *Printer) Reset() {
+	*x = Printer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Printer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Printer) ProtoMessage() {}
+
+func (x *Printer) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Printer.ProtoReflect.Descriptor instead.
+func (*Printer) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Printer) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Printer) GetDisplayName() string {
+	if x != nil {
+		return x.DisplayName
+	}
+	return ""
+}
+
+func (x *Printer) GetManufacturer() string {
+	if x != nil {
+		return x.Manufacturer
+	}
+	return ""
+}
+
+func (x *Printer) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *Printer) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Printer) GetOffline() bool {
+	if x != nil {
+		return x.Offline
+	}
+	return false
+}
+
+type ListPrintersRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListPrintersRequest) Reset() {
+	*x = ListPrintersRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPrintersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPrintersRequest) ProtoMessage() {}
+
+func (x *ListPrintersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPrintersRequest.ProtoReflect.Descriptor instead.
+func (*ListPrintersRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{1}
+}
+
+type ListPrintersResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printers []*Printer `protobuf:"bytes,1,rep,name=printers,proto3" json:"printers,omitempty"`
+}
+
+func (x *ListPrintersResponse) Reset() {
+	*x = ListPrintersResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListPrintersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListPrintersResponse) ProtoMessage() {}
+
+func (x *ListPrintersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListPrintersResponse.ProtoReflect.Descriptor instead.
+func (*ListPrintersResponse) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ListPrintersResponse) GetPrinters() []*Printer {
+	if x != nil {
+		return x.Printers
+	}
+	return nil
+}
+
+type GetCapabilitiesRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+}
+
+func (x *GetCapabilitiesRequest) Reset() {
+	*x = GetCapabilitiesRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetCapabilitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCapabilitiesRequest) ProtoMessage() {}
+
+func (x *GetCapabilitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCapabilitiesRequest.ProtoReflect.Descriptor instead.
+func (*GetCapabilitiesRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GetCapabilitiesRequest) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+type Capabilities struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+	// The printer section of a Cloud Device Description, as JSON.
+	Cdd []byte `protobuf:"bytes,2,opt,name=cdd,proto3" json:"cdd,omitempty"`
+}
+
+func (x *Capabilities) Reset() {
+	*x = Capabilities{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Capabilities) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Capabilities) ProtoMessage() {}
+
+func (x *Capabilities) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Capabilities.ProtoReflect.Descriptor instead.
+func (*Capabilities) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Capabilities) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+func (x *Capabilities) GetCdd() []byte {
+	if x != nil {
+		return x.Cdd
+	}
+	return nil
+}
+
+type SubmitJobRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Part:
+	//	*SubmitJobRequest_Header_
+	//	*SubmitJobRequest_Chunk
+	Part isSubmitJobRequest_Part `protobuf_oneof:"part"`
+}
+
+func (x *SubmitJobRequest) Reset() {
+	*x = SubmitJobRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobRequest) ProtoMessage() {}
+
+func (x *SubmitJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobRequest.ProtoReflect.Descriptor instead.
+func (*SubmitJobRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{5}
+}
+
+func (m *SubmitJobRequest) GetPart() isSubmitJobRequest_Part {
+	if m != nil {
+		return m.Part
+	}
+	return nil
+}
+
+func (x *SubmitJobRequest) GetHeader() *SubmitJobRequest_Header {
+	if x, ok := x.GetPart().(*SubmitJobRequest_Header_); ok {
+		return x.Header
+	}
+	return nil
+}
+
+func (x *SubmitJobRequest) GetChunk() []byte {
+	if x, ok := x.GetPart().(*SubmitJobRequest_Chunk); ok {
+		return x.Chunk
+	}
+	return nil
+}
+
+type isSubmitJobRequest_Part interface {
+	isSubmitJobRequest_Part()
+}
+
+type SubmitJobRequest_Header_ struct {
+	Header *SubmitJobRequest_Header `protobuf:"bytes,1,opt,name=header,proto3,oneof"`
+}
+
+type SubmitJobRequest_Chunk struct {
+	Chunk []byte `protobuf:"bytes,2,opt,name=chunk,proto3,oneof"`
+}
+
+func (*SubmitJobRequest_Header_) isSubmitJobRequest_Part() {}
+
+func (*SubmitJobRequest_Chunk) isSubmitJobRequest_Part() {}
+
+type SubmitJobResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	JobId uint32 `protobuf:"varint,1,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+	// All jobs sent for the document, in queue order.
+	JobIds []uint32 `protobuf:"varint,2,rep,packed,name=job_ids,json=jobIds,proto3" json:"job_ids,omitempty"`
+	// Pages rendered, counting software copies; zero for RAW documents.
+	Pages int32 `protobuf:"varint,3,opt,name=pages,proto3" json:"pages,omitempty"`
+}
+
+func (x *SubmitJobResponse) Reset() {
+	*x = SubmitJobResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobResponse) ProtoMessage() {}
+
+func (x *SubmitJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobResponse.ProtoReflect.Descriptor instead.
+func (*SubmitJobResponse) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SubmitJobResponse) GetJobId() uint32 {
+	if x != nil {
+		return x.JobId
+	}
+	return 0
+}
+
+func (x *SubmitJobResponse) GetJobIds() []uint32 {
+	if x != nil {
+		return x.JobIds
+	}
+	return nil
+}
+
+func (x *SubmitJobResponse) GetPages() int32 {
+	if x != nil {
+		return x.Pages
+	}
+	return 0
+}
+
+type GetJobStateRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+	JobId   uint32 `protobuf:"varint,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+}
+
+func (x *GetJobStateRequest) Reset() {
+	*x = GetJobStateRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetJobStateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetJobStateRequest) ProtoMessage() {}
+
+func (x *GetJobStateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetJobStateRequest.ProtoReflect.Descriptor instead.
+func (*GetJobStateRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetJobStateRequest) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+func (x *GetJobStateRequest) GetJobId() uint32 {
+	if x != nil {
+		return x.JobId
+	}
+	return 0
+}
+
+type JobState struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// JobStateType: QUEUED, IN_PROGRESS, STOPPED, DONE or ABORTED.
+	Type string `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	// The code of the action or device state that caused a stopped or
+	// aborted state, e.g. CANCELLED or INPUT_TRAY.
+	Cause        string `protobuf:"bytes,2,opt,name=cause,proto3" json:"cause,omitempty"`
+	PagesPrinted *int32 `protobuf:"varint,3,opt,name=pages_printed,json=pagesPrinted,proto3,oneof" json:"pages_printed,omitempty"`
+	TotalPages   *int32 `protobuf:"varint,4,opt,name=total_pages,json=totalPages,proto3,oneof" json:"total_pages,omitempty"`
+	SpooledBytes *int64 `protobuf:"varint,5,opt,name=spooled_bytes,json=spooledBytes,proto3,oneof" json:"spooled_bytes,omitempty"`
+}
+
+func (x *JobState) Reset() {
+	*x = JobState{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *JobState) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*JobState) ProtoMessage() {}
+
+func (x *JobState) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use JobState.ProtoReflect.Descriptor instead.
+func (*JobState) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *JobState) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *JobState) GetCause() string {
+	if x != nil {
+		return x.Cause
+	}
+	return ""
+}
+
+func (x *JobState) GetPagesPrinted() int32 {
+	if x != nil && x.PagesPrinted != nil {
+		return *x.PagesPrinted
+	}
+	return 0
+}
+
+func (x *JobState) GetTotalPages() int32 {
+	if x != nil && x.TotalPages != nil {
+		return *x.TotalPages
+	}
+	return 0
+}
+
+func (x *JobState) GetSpooledBytes() int64 {
+	if x != nil && x.SpooledBytes != nil {
+		return *x.SpooledBytes
+	}
+	return 0
+}
+
+type StreamJobEventsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+	JobId   uint32 `protobuf:"varint,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+}
+
+func (x *StreamJobEventsRequest) Reset() {
+	*x = StreamJobEventsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StreamJobEventsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamJobEventsRequest) ProtoMessage() {}
+
+func (x *StreamJobEventsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamJobEventsRequest.ProtoReflect.Descriptor instead.
+func (*StreamJobEventsRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StreamJobEventsRequest) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+func (x *StreamJobEventsRequest) GetJobId() uint32 {
+	if x != nil {
+		return x.JobId
+	}
+	return 0
+}
+
+type CancelJobRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+	JobId   uint32 `protobuf:"varint,2,opt,name=job_id,json=jobId,proto3" json:"job_id,omitempty"`
+}
+
+func (x *CancelJobRequest) Reset() {
+	*x = CancelJobRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CancelJobRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobRequest) ProtoMessage() {}
+
+func (x *CancelJobRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobRequest.ProtoReflect.Descriptor instead.
+func (*CancelJobRequest) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *CancelJobRequest) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+func (x *CancelJobRequest) GetJobId() uint32 {
+	if x != nil {
+		return x.JobId
+	}
+	return 0
+}
+
+type CancelJobResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *CancelJobResponse) Reset() {
+	*x = CancelJobResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CancelJobResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CancelJobResponse) ProtoMessage() {}
+
+func (x *CancelJobResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CancelJobResponse.ProtoReflect.Descriptor instead.
+func (*CancelJobResponse) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{11}
+}
+
+type SubmitJobRequest_Header struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Printer string `protobuf:"bytes,1,opt,name=printer,proto3" json:"printer,omitempty"`
+	Title   string `protobuf:"bytes,2,opt,name=title,proto3" json:"title,omitempty"`
+	// Cloud Job Ticket, as JSON; the printer defaults apply when empty.
+	Ticket []byte `protobuf:"bytes,3,opt,name=ticket,proto3" json:"ticket,omitempty"`
+}
+
+func (x *SubmitJobRequest_Header) Reset() {
+	*x = SubmitJobRequest_Header{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_spooler_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubmitJobRequest_Header) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubmitJobRequest_Header) ProtoMessage() {}
+
+func (x *SubmitJobRequest_Header) ProtoReflect() protoreflect.Message {
+	mi := &file_spooler_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubmitJobRequest_Header.ProtoReflect.Descriptor instead.
+func (*SubmitJobRequest_Header) Descriptor() ([]byte, []int) {
+	return file_spooler_proto_rawDescGZIP(), []int{5, 0}
+}
+
+func (x *SubmitJobRequest_Header) GetPrinter() string {
+	if x != nil {
+		return x.Printer
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest_Header) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *SubmitJobRequest_Header) GetTicket() []byte {
+	if x != nil {
+		return x.Ticket
+	}
+	return nil
+}
+
+var File_spooler_proto protoreflect.FileDescriptor
+
+var file_spooler_proto_rawDesc = []byte{
+	0x0a, 0x0d, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12,
+	0x13, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65,
+	0x72, 0x2e, 0x76, 0x31, 0x22, 0xaa, 0x01, 0x0a, 0x07, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x64, 0x69, 0x73, 0x70, 0x6c, 0x61, 0x79, 0x5f,
+	0x6e, 0x61, 0x6d, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x64, 0x69, 0x73, 0x70,
+	0x6c, 0x61, 0x79, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x6d, 0x61, 0x6e, 0x75, 0x66,
+	0x61, 0x63, 0x74, 0x75, 0x72, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x6d,
+	0x61, 0x6e, 0x75, 0x66, 0x61, 0x63, 0x74, 0x75, 0x72, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x6d,
+	0x6f, 0x64, 0x65, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x6d, 0x6f, 0x64, 0x65,
+	0x6c, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x05, 0x73, 0x74, 0x61, 0x74, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x6f, 0x66, 0x66, 0x6c, 0x69,
+	0x6e, 0x65, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x6f, 0x66, 0x66, 0x6c, 0x69, 0x6e,
+	0x65, 0x22, 0x15, 0x0a, 0x13, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x50, 0x0a, 0x14, 0x4c, 0x69, 0x73, 0x74,
+	0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x38, 0x0a, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x1c, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70,
+	0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x52, 0x08, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x22, 0x32, 0x0a, 0x16, 0x47, 0x65,
+	0x74, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x22, 0x3a,
+	0x0a, 0x0c, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x18,
+	0x0a, 0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x12, 0x10, 0x0a, 0x03, 0x63, 0x64, 0x64, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x63, 0x64, 0x64, 0x22, 0xcc, 0x01, 0x0a, 0x10, 0x53,
+	0x75, 0x62, 0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x46, 0x0a, 0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x2c, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c,
+	0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x48, 0x00, 0x52,
+	0x06, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x16, 0x0a, 0x05, 0x63, 0x68, 0x75, 0x6e, 0x6b,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x48, 0x00, 0x52, 0x05, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x1a,
+	0x50, 0x0a, 0x06, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x72, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x12, 0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x74, 0x69, 0x63,
+	0x6b, 0x65, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x06, 0x74, 0x69, 0x63, 0x6b, 0x65,
+	0x74, 0x42, 0x06, 0x0a, 0x04, 0x70, 0x61, 0x72, 0x74, 0x22, 0x59, 0x0a, 0x11, 0x53, 0x75, 0x62,
+	0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x15,
+	0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05,
+	0x6a, 0x6f, 0x62, 0x49, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x73,
+	0x18, 0x02, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x06, 0x6a, 0x6f, 0x62, 0x49, 0x64, 0x73, 0x12, 0x14,
+	0x0a, 0x05, 0x70, 0x61, 0x67, 0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x70,
+	0x61, 0x67, 0x65, 0x73, 0x22, 0x45, 0x0a, 0x12, 0x47, 0x65, 0x74, 0x4a, 0x6f, 0x62, 0x53, 0x74,
+	0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x72,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x12, 0x15, 0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x49, 0x64, 0x22, 0xe2, 0x01, 0x0a, 0x08,
+	0x4a, 0x6f, 0x62, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x63, 0x61, 0x75, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x63, 0x61, 0x75,
+	0x73, 0x65, 0x12, 0x28, 0x0a, 0x0d, 0x70, 0x61, 0x67, 0x65, 0x73, 0x5f, 0x70, 0x72, 0x69, 0x6e,
+	0x74, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x48, 0x00, 0x52, 0x0c, 0x70, 0x61, 0x67,
+	0x65, 0x73, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x64, 0x88, 0x01, 0x01, 0x12, 0x24, 0x0a, 0x0b,
+	0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x70, 0x61, 0x67, 0x65, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x05, 0x48, 0x01, 0x52, 0x0a, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x50, 0x61, 0x67, 0x65, 0x73, 0x88,
+	0x01, 0x01, 0x12, 0x28, 0x0a, 0x0d, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x64, 0x5f, 0x62, 0x79,
+	0x74, 0x65, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x48, 0x02, 0x52, 0x0c, 0x73, 0x70, 0x6f,
+	0x6f, 0x6c, 0x65, 0x64, 0x42, 0x79, 0x74, 0x65, 0x73, 0x88, 0x01, 0x01, 0x42, 0x10, 0x0a, 0x0e,
+	0x5f, 0x70, 0x61, 0x67, 0x65, 0x73, 0x5f, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x64, 0x42, 0x0e,
+	0x0a, 0x0c, 0x5f, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f, 0x70, 0x61, 0x67, 0x65, 0x73, 0x42, 0x10,
+	0x0a, 0x0e, 0x5f, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x64, 0x5f, 0x62, 0x79, 0x74, 0x65, 0x73,
+	0x22, 0x49, 0x0a, 0x16, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65,
+	0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x70, 0x72,
+	0x69, 0x6e, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x72, 0x69,
+	0x6e, 0x74, 0x65, 0x72, 0x12, 0x15, 0x0a, 0x06, 0x6a, 0x6f, 0x62, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x49, 0x64, 0x22, 0x43, 0x0a, 0x10, 0x43,
+	0x61, 0x6e, 0x63, 0x65, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x07, 0x70, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x12, 0x15, 0x0a, 0x06, 0x6a, 0x6f, 0x62,
+	0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6a, 0x6f, 0x62, 0x49, 0x64,
+	0x22, 0x13, 0x0a, 0x11, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x32, 0xc3, 0x04, 0x0a, 0x07, 0x53, 0x70, 0x6f, 0x6f, 0x6c, 0x65,
+	0x72, 0x12, 0x63, 0x0a, 0x0c, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x73, 0x12, 0x28, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f,
+	0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x72, 0x69, 0x6e,
+	0x74, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x29, 0x2e, 0x77, 0x69,
+	0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76,
+	0x31, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x50, 0x72, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x61, 0x0a, 0x0f, 0x47, 0x65, 0x74, 0x43, 0x61, 0x70,
+	0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x2b, 0x2e, 0x77, 0x69, 0x6e, 0x73,
+	0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e,
+	0x47, 0x65, 0x74, 0x43, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x70,
+	0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x12, 0x5c, 0x0a, 0x09, 0x53, 0x75, 0x62,
+	0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x12, 0x25, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62,
+	0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e,
+	0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72,
+	0x2e, 0x76, 0x31, 0x2e, 0x53, 0x75, 0x62, 0x6d, 0x69, 0x74, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x28, 0x01, 0x12, 0x55, 0x0a, 0x0b, 0x47, 0x65, 0x74, 0x4a, 0x6f,
+	0x62, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x27, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f,
+	0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x47, 0x65, 0x74,
+	0x4a, 0x6f, 0x62, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x1d, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c,
+	0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x5f,
+	0x0a, 0x0f, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4a, 0x6f, 0x62, 0x45, 0x76, 0x65, 0x6e, 0x74,
+	0x73, 0x12, 0x2b, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f,
+	0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x53, 0x74, 0x72, 0x65, 0x61, 0x6d, 0x4a, 0x6f,
+	0x62, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d,
+	0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65,
+	0x72, 0x2e, 0x76, 0x31, 0x2e, 0x4a, 0x6f, 0x62, 0x53, 0x74, 0x61, 0x74, 0x65, 0x30, 0x01, 0x12,
+	0x5a, 0x0a, 0x09, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x4a, 0x6f, 0x62, 0x12, 0x25, 0x2e, 0x77,
+	0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e,
+	0x76, 0x31, 0x2e, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c, 0x4a, 0x6f, 0x62, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x26, 0x2e, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2e, 0x73,
+	0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x2e, 0x76, 0x31, 0x2e, 0x43, 0x61, 0x6e, 0x63, 0x65, 0x6c,
+	0x4a, 0x6f, 0x62, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x2f, 0x5a, 0x2d, 0x67,
+	0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x67, 0x6f, 0x72, 0x70, 0x68, 0x65,
+	0x72, 0x2f, 0x77, 0x69, 0x6e, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x2d, 0x63, 0x67, 0x6f, 0x2f, 0x72,
+	0x70, 0x63, 0x2f, 0x73, 0x70, 0x6f, 0x6f, 0x6c, 0x65, 0x72, 0x70, 0x62, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_spooler_proto_rawDescOnce sync.Once
+	file_spooler_proto_rawDescData = file_spooler_proto_rawDesc
+)
+
+func file_spooler_proto_rawDescGZIP() []byte {
+	file_spooler_proto_rawDescOnce.Do(func() {
+		file_spooler_proto_rawDescData = protoimpl.X.CompressGZIP(file_spooler_proto_rawDescData)
+	})
+	return file_spooler_proto_rawDescData
+}
+
+var file_spooler_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_spooler_proto_goTypes = []interface{}{
+	(*Printer)(nil),                 // 0: winspool.spooler.v1.Printer
+	(*ListPrintersRequest)(nil),     // 1: winspool.spooler.v1.ListPrintersRequest
+	(*ListPrintersResponse)(nil),    // 2: winspool.spooler.v1.ListPrintersResponse
+	(*GetCapabilitiesRequest)(nil),  // 3: winspool.spooler.v1.GetCapabilitiesRequest
+	(*Capabilities)(nil),            // 4: winspool.spooler.v1.Capabilities
+	(*SubmitJobRequest)(nil),        // 5: winspool.spooler.v1.SubmitJobRequest
+	(*SubmitJobResponse)(nil),       // 6: winspool.spooler.v1.SubmitJobResponse
+	(*GetJobStateRequest)(nil),      // 7: winspool.spooler.v1.GetJobStateRequest
+	(*JobState)(nil),                // 8: winspool.spooler.v1.JobState
+	(*StreamJobEventsRequest)(nil),  // 9: winspool.spooler.v1.StreamJobEventsRequest
+	(*CancelJobRequest)(nil),        // 10: winspool.spooler.v1.CancelJobRequest
+	(*CancelJobResponse)(nil),       // 11: winspool.spooler.v1.CancelJobResponse
+	(*SubmitJobRequest_Header)(nil), // 12: winspool.spooler.v1.SubmitJobRequest.Header
+}
+var file_spooler_proto_depIdxs = []int32{
+	0,  // 0: winspool.spooler.v1.ListPrintersResponse.printers:type_name -> winspool.spooler.v1.Printer
+	12, // 1: winspool.spooler.v1.SubmitJobRequest.header:type_name -> winspool.spooler.v1.SubmitJobRequest.Header
+	1,  // 2: winspool.spooler.v1.Spooler.ListPrinters:input_type -> winspool.spooler.v1.ListPrintersRequest
+	3,  // 3: winspool.spooler.v1.Spooler.GetCapabilities:input_type -> winspool.spooler.v1.GetCapabilitiesRequest
+	5,  // 4: winspool.spooler.v1.Spooler.SubmitJob:input_type -> winspool.spooler.v1.SubmitJobRequest
+	7,  // 5: winspool.spooler.v1.Spooler.GetJobState:input_type -> winspool.spooler.v1.GetJobStateRequest
+	9,  // 6: winspool.spooler.v1.Spooler.StreamJobEvents:input_type -> winspool.spooler.v1.StreamJobEventsRequest
+	10, // 7: winspool.spooler.v1.Spooler.CancelJob:input_type -> winspool.spooler.v1.CancelJobRequest
+	2,  // 8: winspool.spooler.v1.Spooler.ListPrinters:output_type -> winspool.spooler.v1.ListPrintersResponse
+	4,  // 9: winspool.spooler.v1.Spooler.GetCapabilities:output_type -> winspool.spooler.v1.Capabilities
+	6,  // 10: winspool.spooler.v1.Spooler.SubmitJob:output_type -> winspool.spooler.v1.SubmitJobResponse
+	8,  // 11: winspool.spooler.v1.Spooler.GetJobState:output_type -> winspool.spooler.v1.JobState
+	8,  // 12: winspool.spooler.v1.Spooler.StreamJobEvents:output_type -> winspool.spooler.v1.JobState
+	11, // 13: winspool.spooler.v1.Spooler.CancelJob:output_type -> winspool.spooler.v1.CancelJobResponse
+	8,  // [8:14] is the sub-list for method output_type
+	2,  // [2:8] is the sub-list for method input_type
+	2,  // [2:2] is the sub-list for extension type_name
+	2,  // [2:2] is the sub-list for extension extendee
+	0,  // [0:2] is the sub-list for field type_name
+}
+
+func init() { file_spooler_proto_init() }
+func file_spooler_proto_init() {
+	if File_spooler_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_spooler_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Printer); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListPrintersRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListPrintersResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetCapabilitiesRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Capabilities); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitJobRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitJobResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetJobStateRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*JobState); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StreamJobEventsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CancelJobRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CancelJobResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_spooler_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SubmitJobRequest_Header); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_spooler_proto_msgTypes[5].OneofWrappers = []interface{}{
+		(*SubmitJobRequest_Header_)(nil),
+		(*SubmitJobRequest_Chunk)(nil),
+	}
+	file_spooler_proto_msgTypes[8].OneofWrappers = []interface{}{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_spooler_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_spooler_proto_goTypes,
+		DependencyIndexes: file_spooler_proto_depIdxs,
+		MessageInfos:      file_spooler_proto_msgTypes,
+	}.Build()
+	File_spooler_proto = out.File
+	file_spooler_proto_rawDesc = nil
+	file_spooler_proto_goTypes = nil
+	file_spooler_proto_depIdxs = nil
+}
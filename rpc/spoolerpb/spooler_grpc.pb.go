@@ -0,0 +1,363 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: spooler.proto
+
+package spoolerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SpoolerClient is the client API for Spooler service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SpoolerClient interface {
+	// Lists the printers of the host, by name.
+	ListPrinters(ctx context.Context, in *ListPrintersRequest, opts ...grpc.CallOption) (*ListPrintersResponse, error)
+	// Returns the capabilities of a printer.
+	GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error)
+	// Prints a document. The first message has the header, the others chunks
+	// of the document, in order.
+	SubmitJob(ctx context.Context, opts ...grpc.CallOption) (Spooler_SubmitJobClient, error)
+	GetJobState(ctx context.Context, in *GetJobStateRequest, opts ...grpc.CallOption) (*JobState, error)
+	// Streams the state of a job every time it changes: a new state type, or
+	// more pages printed. The stream ends once the job is done or aborted.
+	StreamJobEvents(ctx context.Context, in *StreamJobEventsRequest, opts ...grpc.CallOption) (Spooler_StreamJobEventsClient, error)
+	// Fails with PERMISSION_DENIED for jobs of other users when the host
+	// lacks administrator rights.
+	CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error)
+}
+
+type spoolerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSpoolerClient(cc grpc.ClientConnInterface) SpoolerClient {
+	return &spoolerClient{cc}
+}
+
+func (c *spoolerClient) ListPrinters(ctx context.Context, in *ListPrintersRequest, opts ...grpc.CallOption) (*ListPrintersResponse, error) {
+	out := new(ListPrintersResponse)
+	err := c.cc.Invoke(ctx, "/winspool.spooler.v1.Spooler/ListPrinters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spoolerClient) GetCapabilities(ctx context.Context, in *GetCapabilitiesRequest, opts ...grpc.CallOption) (*Capabilities, error) {
+	out := new(Capabilities)
+	err := c.cc.Invoke(ctx, "/winspool.spooler.v1.Spooler/GetCapabilities", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spoolerClient) SubmitJob(ctx context.Context, opts ...grpc.CallOption) (Spooler_SubmitJobClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Spooler_ServiceDesc.Streams[0], "/winspool.spooler.v1.Spooler/SubmitJob", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &spoolerSubmitJobClient{stream}
+	return x, nil
+}
+
+type Spooler_SubmitJobClient interface {
+	Send(*SubmitJobRequest) error
+	CloseAndRecv() (*SubmitJobResponse, error)
+	grpc.ClientStream
+}
+
+type spoolerSubmitJobClient struct {
+	grpc.ClientStream
+}
+
+func (x *spoolerSubmitJobClient) Send(m *SubmitJobRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *spoolerSubmitJobClient) CloseAndRecv() (*SubmitJobResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(SubmitJobResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *spoolerClient) GetJobState(ctx context.Context, in *GetJobStateRequest, opts ...grpc.CallOption) (*JobState, error) {
+	out := new(JobState)
+	err := c.cc.Invoke(ctx, "/winspool.spooler.v1.Spooler/GetJobState", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *spoolerClient) StreamJobEvents(ctx context.Context, in *StreamJobEventsRequest, opts ...grpc.CallOption) (Spooler_StreamJobEventsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Spooler_ServiceDesc.Streams[1], "/winspool.spooler.v1.Spooler/StreamJobEvents", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &spoolerStreamJobEventsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Spooler_StreamJobEventsClient interface {
+	Recv() (*JobState, error)
+	grpc.ClientStream
+}
+
+type spoolerStreamJobEventsClient struct {
+	grpc.ClientStream
+}
+
+func (x *spoolerStreamJobEventsClient) Recv() (*JobState, error) {
+	m := new(JobState)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *spoolerClient) CancelJob(ctx context.Context, in *CancelJobRequest, opts ...grpc.CallOption) (*CancelJobResponse, error) {
+	out := new(CancelJobResponse)
+	err := c.cc.Invoke(ctx, "/winspool.spooler.v1.Spooler/CancelJob", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SpoolerServer is the server API for Spooler service.
+// All implementations must embed UnimplementedSpoolerServer
+// for forward compatibility
+type SpoolerServer interface {
+	// Lists the printers of the host, by name.
+	ListPrinters(context.Context, *ListPrintersRequest) (*ListPrintersResponse, error)
+	// Returns the capabilities of a printer.
+	GetCapabilities(context.Context, *GetCapabilitiesRequest) (*Capabilities, error)
+	// Prints a document. The first message has the header, the others chunks
+	// of the document, in order.
+	SubmitJob(Spooler_SubmitJobServer) error
+	GetJobState(context.Context, *GetJobStateRequest) (*JobState, error)
+	// Streams the state of a job every time it changes: a new state type, or
+	// more pages printed. The stream ends once the job is done or aborted.
+	StreamJobEvents(*StreamJobEventsRequest, Spooler_StreamJobEventsServer) error
+	// Fails with PERMISSION_DENIED for jobs of other users when the host
+	// lacks administrator rights.
+	CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error)
+	mustEmbedUnimplementedSpoolerServer()
+}
+
+// UnimplementedSpoolerServer must be embedded to have forward compatible implementations.
+type UnimplementedSpoolerServer struct {
+}
+
+func (UnimplementedSpoolerServer) ListPrinters(context.Context, *ListPrintersRequest) (*ListPrintersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListPrinters not implemented")
+}
+func (UnimplementedSpoolerServer) GetCapabilities(context.Context, *GetCapabilitiesRequest) (*Capabilities, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCapabilities not implemented")
+}
+func (UnimplementedSpoolerServer) SubmitJob(Spooler_SubmitJobServer) error {
+	return status.Errorf(codes.Unimplemented, "method SubmitJob not implemented")
+}
+func (UnimplementedSpoolerServer) GetJobState(context.Context, *GetJobStateRequest) (*JobState, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetJobState not implemented")
+}
+func (UnimplementedSpoolerServer) StreamJobEvents(*StreamJobEventsRequest, Spooler_StreamJobEventsServer) error {
+	return status.Errorf(codes.Unimplemented, "method StreamJobEvents not implemented")
+}
+func (UnimplementedSpoolerServer) CancelJob(context.Context, *CancelJobRequest) (*CancelJobResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CancelJob not implemented")
+}
+func (UnimplementedSpoolerServer) mustEmbedUnimplementedSpoolerServer() {}
+
+// UnsafeSpoolerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SpoolerServer will
+// result in compilation errors.
+type UnsafeSpoolerServer interface {
+	mustEmbedUnimplementedSpoolerServer()
+}
+
+func RegisterSpoolerServer(s grpc.ServiceRegistrar, srv SpoolerServer) {
+	s.RegisterService(&Spooler_ServiceDesc, srv)
+}
+
+func _Spooler_ListPrinters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListPrintersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpoolerServer).ListPrinters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/winspool.spooler.v1.Spooler/ListPrinters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpoolerServer).ListPrinters(ctx, req.(*ListPrintersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Spooler_GetCapabilities_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCapabilitiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpoolerServer).GetCapabilities(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/winspool.spooler.v1.Spooler/GetCapabilities",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpoolerServer).GetCapabilities(ctx, req.(*GetCapabilitiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Spooler_SubmitJob_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SpoolerServer).SubmitJob(&spoolerSubmitJobServer{stream})
+}
+
+type Spooler_SubmitJobServer interface {
+	SendAndClose(*SubmitJobResponse) error
+	Recv() (*SubmitJobRequest, error)
+	grpc.ServerStream
+}
+
+type spoolerSubmitJobServer struct {
+	grpc.ServerStream
+}
+
+func (x *spoolerSubmitJobServer) SendAndClose(m *SubmitJobResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *spoolerSubmitJobServer) Recv() (*SubmitJobRequest, error) {
+	m := new(SubmitJobRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Spooler_GetJobState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetJobStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpoolerServer).GetJobState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/winspool.spooler.v1.Spooler/GetJobState",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpoolerServer).GetJobState(ctx, req.(*GetJobStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Spooler_StreamJobEvents_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamJobEventsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SpoolerServer).StreamJobEvents(m, &spoolerStreamJobEventsServer{stream})
+}
+
+type Spooler_StreamJobEventsServer interface {
+	Send(*JobState) error
+	grpc.ServerStream
+}
+
+type spoolerStreamJobEventsServer struct {
+	grpc.ServerStream
+}
+
+func (x *spoolerStreamJobEventsServer) Send(m *JobState) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Spooler_CancelJob_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CancelJobRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SpoolerServer).CancelJob(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/winspool.spooler.v1.Spooler/CancelJob",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SpoolerServer).CancelJob(ctx, req.(*CancelJobRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Spooler_ServiceDesc is the grpc.ServiceDesc for Spooler service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Spooler_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "winspool.spooler.v1.Spooler",
+	HandlerType: (*SpoolerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListPrinters",
+			Handler:    _Spooler_ListPrinters_Handler,
+		},
+		{
+			MethodName: "GetCapabilities",
+			Handler:    _Spooler_GetCapabilities_Handler,
+		},
+		{
+			MethodName: "GetJobState",
+			Handler:    _Spooler_GetJobState_Handler,
+		},
+		{
+			MethodName: "CancelJob",
+			Handler:    _Spooler_CancelJob_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SubmitJob",
+			Handler:       _Spooler_SubmitJob_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "StreamJobEvents",
+			Handler:       _Spooler_StreamJobEvents_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "spooler.proto",
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// DefaultRegisterInterval is how often agents renew their registration,
+// well within DefaultAgentTTL.
+const DefaultRegisterInterval = 30 * time.Second
+
+// Agent registers the printers of a server with coordinators.
+type Agent struct {
+	// Base URLs of the coordinator instances; all are registered with, so
+	// that a follower can take over with current registrations.
+	Coordinators []string
+	// Unique name of the agent within the cluster.
+	Name string
+	// Base URL of this agent's server, as reachable from the coordinator.
+	URL      string
+	Printers Printers
+	// Cluster token the coordinators require; see Coordinator.Token.
+	Token string
+
+	// DefaultRegisterInterval when zero.
+	Interval time.Duration
+}
+
+// Register registers the current printers with a coordinator once.
+func (a *Agent) Register(coordinator string) error {
+	return lib.PostWebhookToken(strings.TrimRight(coordinator, "/")+"/agents", a.Token, Registration{
+		Agent:    a.Name,
+		URL:      a.URL,
+		Printers: a.Printers.GetPrinters(),
+	})
+}
+
+// Run registers with the coordinators now and periodically, so that printer
+// changes are picked up and the registrations don't expire, until done
+// is closed.
+func (a *Agent) Run(done <-chan struct{}) {
+	interval := a.Interval
+	if interval <= 0 {
+		interval = DefaultRegisterInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	registered := make(map[string]bool)
+	for {
+		for _, coordinator := range a.Coordinators {
+			if err := a.Register(coordinator); err != nil {
+				log.Printf("Failed to register with coordinator %s: %s", coordinator, err)
+				registered[coordinator] = false
+			} else if !registered[coordinator] {
+				log.Printf("Registered with coordinator %s as %s", coordinator, a.Name)
+				registered[coordinator] = true
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
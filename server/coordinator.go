@@ -0,0 +1,452 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// DefaultAgentTTL is how long a registration is kept without being renewed.
+const DefaultAgentTTL = 90 * time.Second
+
+// Jobs submitted through the coordinator are kept this long.
+const clusterJobRetention = 24 * time.Hour
+
+// Registration is what an agent posts to the coordinator, and renews
+// periodically.
+type Registration struct {
+	// Unique name of the agent, e.g. the host name.
+	Agent string `json:"agent"`
+	// Base URL of the agent's server, as reachable from the coordinator.
+	URL      string        `json:"url"`
+	Printers []lib.Printer `json:"printers"`
+}
+
+// ClusterPrinter is a printer of the cluster, with the agent that serves it.
+type ClusterPrinter struct {
+	lib.Printer
+	Agent string `json:"agent"`
+}
+
+type agent struct {
+	Registration
+	url      *url.URL
+	proxy    *httputil.ReverseProxy
+	lastSeen time.Time
+}
+
+// Coordinator gives one API over the printers of many agents. Agents
+// register their printers with POST /agents; the coordinator lists the
+// printers of all agents, and forwards every other printer request to the
+// agent that serves the printer:
+//
+//	POST   /agents                 register or renew an agent
+//	GET    /agents                 registered agents
+//	GET    /printers               printers of all agents
+//	GET    /jobs                   jobs submitted through the coordinator
+//	*      /printers/{name}/...    forwarded to the agent
+//
+// When agents at different sites have printers with the same name,
+// requests pick one with ?agent=name; requests about a job submitted
+// through the coordinator go to the agent that printed it.
+//
+// For high availability, run several instances with RunElection on a
+// shared lease and Store: only the leader serves requests, the others
+// answer 503, and a new leader resumes from the stored state.
+type Coordinator struct {
+	// Registrations not renewed within TTL are dropped; DefaultAgentTTL when zero.
+	TTL time.Duration
+	// Keeps agents and jobs for the next leader; optional.
+	Store ClusterStore
+	// Bearer token agents register with and clients send, so that nobody
+	// else can register an agent to have jobs sent to them; requests
+	// aren't authenticated when empty.
+	Token string
+
+	now     func() time.Time
+	mutex   sync.Mutex
+	agents  map[string]*agent
+	jobs    []ClusterJob
+	leading bool
+	leader  string
+
+	saveMutex sync.Mutex
+}
+
+// NewCoordinator returns a coordinator without agents, leading until
+// RunElection is called.
+func NewCoordinator() *Coordinator {
+	return &Coordinator{now: time.Now, agents: make(map[string]*agent), leading: true}
+}
+
+// RunElection takes part in leader election until done is closed, then
+// releases the lease. The leader steps down once its lease expired without
+// a renewal, as another instance may have taken it over.
+func (c *Coordinator) RunElection(lease Lease, done <-chan struct{}) {
+	c.mutex.Lock()
+	c.leading = false
+	c.mutex.Unlock()
+
+	ticker := time.NewTicker(lease.TTL() / 3)
+	defer ticker.Stop()
+	var renewed time.Time
+	for {
+		held, holder, err := lease.TryAcquire()
+		if err != nil {
+			log.Printf("Failed to acquire coordinator lease: %s", err)
+			if c.now().Sub(renewed) >= lease.TTL() {
+				c.setLeader(false, "")
+			}
+		} else {
+			if held {
+				renewed = c.now()
+			}
+			c.setLeader(held, holder)
+		}
+
+		select {
+		case <-done:
+			c.setLeader(false, "")
+			if err := lease.Release(); err != nil {
+				log.Printf("Failed to release coordinator lease: %s", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Coordinator) setLeader(leading bool, holder string) {
+	c.mutex.Lock()
+	wasLeading := c.leading
+	c.leading, c.leader = leading, holder
+	c.mutex.Unlock()
+
+	if leading && !wasLeading {
+		log.Print("Became the coordinator leader")
+		c.loadState()
+	} else if !leading && wasLeading && holder == "" {
+		log.Print("No longer the coordinator leader")
+	} else if !leading && wasLeading {
+		log.Printf("No longer the coordinator leader, %s is", holder)
+	}
+}
+
+// loadState merges the stored state, saved by the previous leader, with
+// the registrations received meanwhile.
+func (c *Coordinator) loadState() {
+	if c.Store == nil {
+		return
+	}
+	state, err := c.Store.Load()
+	if err != nil {
+		log.Printf("Failed to load cluster state: %s", err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, a := range state.Agents {
+		if existing, exists := c.agents[a.Agent]; exists && !existing.lastSeen.Before(a.LastSeen) {
+			continue
+		}
+		c.setAgent(a.Registration, a.LastSeen)
+	}
+	type jobKey struct {
+		printer, agent string
+		jobID          uint32
+	}
+	known := make(map[jobKey]bool, len(c.jobs))
+	for _, job := range c.jobs {
+		known[jobKey{job.Printer, job.Agent, job.JobID}] = true
+	}
+	for _, job := range state.Jobs {
+		if !known[jobKey{job.Printer, job.Agent, job.JobID}] {
+			c.jobs = append(c.jobs, job)
+		}
+	}
+}
+
+// saveState stores the state, when leading.
+func (c *Coordinator) saveState() {
+	if c.Store == nil {
+		return
+	}
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+
+	c.mutex.Lock()
+	if !c.leading {
+		c.mutex.Unlock()
+		return
+	}
+	var state ClusterState
+	for _, a := range c.live() {
+		state.Agents = append(state.Agents, AgentState{Registration: a.Registration, LastSeen: a.lastSeen})
+	}
+	state.Jobs = append(state.Jobs, c.jobs...)
+	c.mutex.Unlock()
+
+	if err := c.Store.Save(&state); err != nil {
+		log.Printf("Failed to save cluster state: %s", err)
+	}
+}
+
+func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if !c.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="winspool"`)
+		writeError(w, http.StatusUnauthorized, "missing or wrong cluster token")
+		return
+	}
+
+	c.mutex.Lock()
+	leading, leader := c.leading, c.leader
+	c.mutex.Unlock()
+	// Followers keep registrations current, to serve right away when
+	// they take over.
+	if !leading && !(len(parts) == 1 && parts[0] == "agents" && r.Method == http.MethodPost) {
+		writeError(w, http.StatusServiceUnavailable, "not the leader, %s is", leader)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "agents":
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, c.registrations())
+		case http.MethodPost:
+			c.register(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+	case len(parts) == 1 && parts[0] == "printers":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+			return
+		}
+		writeJSON(w, http.StatusOK, c.printers())
+	case len(parts) == 1 && parts[0] == "jobs":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+			return
+		}
+		c.mutex.Lock()
+		jobs := append([]ClusterJob{}, c.jobs...)
+		c.mutex.Unlock()
+		writeJSON(w, http.StatusOK, jobs)
+	case len(parts) >= 2 && parts[0] == "printers":
+		c.forward(w, r, parts[1], parts[2:])
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+}
+
+// authorized tells whether a request has the bearer token of the cluster,
+// if there is one.
+func (c *Coordinator) authorized(r *http.Request) bool {
+	if c.Token == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+c.Token)) == 1
+}
+
+func (c *Coordinator) register(w http.ResponseWriter, r *http.Request) {
+	var reg Registration
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, DefaultMaxUploadSize)).Decode(&reg); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid registration: %s", err)
+		return
+	}
+	if reg.Agent == "" {
+		writeError(w, http.StatusBadRequest, "invalid registration: missing agent")
+		return
+	}
+	u, err := url.Parse(reg.URL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "invalid registration: invalid url %q", reg.URL)
+		return
+	}
+
+	c.mutex.Lock()
+	c.setAgent(reg, c.now())
+	c.mutex.Unlock()
+	c.saveState()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setAgent must be called with the mutex held.
+func (c *Coordinator) setAgent(reg Registration, lastSeen time.Time) {
+	a, exists := c.agents[reg.Agent]
+	if !exists || a.URL != reg.URL {
+		u, err := url.Parse(reg.URL)
+		if err != nil {
+			log.Printf("Ignoring agent %s with invalid url %q", reg.Agent, reg.URL)
+			return
+		}
+		a = &agent{url: u, proxy: httputil.NewSingleHostReverseProxy(u)}
+		name := reg.Agent
+		a.proxy.ModifyResponse = func(resp *http.Response) error {
+			return c.recordJob(name, resp)
+		}
+		c.agents[reg.Agent] = a
+	}
+	a.Registration = reg
+	a.lastSeen = lastSeen
+}
+
+// recordJob keeps the jobs submitted through the coordinator, to route
+// later requests about them to the agent, even after a failover.
+func (c *Coordinator) recordJob(agentName string, resp *http.Response) error {
+	parts := strings.Split(strings.Trim(resp.Request.URL.Path, "/"), "/")
+	if resp.Request.Method != http.MethodPost || resp.StatusCode != http.StatusCreated || len(parts) != 3 || parts[2] != "jobs" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		JobID uint32 `json:"job_id"`
+	}
+	if err = json.Unmarshal(body, &result); err != nil || result.JobID == 0 {
+		return nil
+	}
+
+	c.mutex.Lock()
+	now := c.now()
+	jobs := c.jobs[:0]
+	for _, job := range c.jobs {
+		if now.Sub(job.Submitted) < clusterJobRetention {
+			jobs = append(jobs, job)
+		}
+	}
+	c.jobs = append(jobs, ClusterJob{Printer: parts[1], Agent: agentName, JobID: result.JobID, Submitted: now})
+	c.mutex.Unlock()
+	c.saveState()
+	return nil
+}
+
+// live returns the agents whose registration hasn't expired, dropping the
+// others. Must be called with the mutex held.
+func (c *Coordinator) live() []*agent {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultAgentTTL
+	}
+	now := c.now()
+	agents := make([]*agent, 0, len(c.agents))
+	for name, a := range c.agents {
+		if now.Sub(a.lastSeen) > ttl {
+			delete(c.agents, name)
+			continue
+		}
+		agents = append(agents, a)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Agent < agents[j].Agent })
+	return agents
+}
+
+func (c *Coordinator) registrations() []Registration {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var regs []Registration
+	for _, a := range c.live() {
+		regs = append(regs, a.Registration)
+	}
+	return regs
+}
+
+func (c *Coordinator) printers() []ClusterPrinter {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	printers := []ClusterPrinter{}
+	for _, a := range c.live() {
+		for _, p := range a.Printers {
+			printers = append(printers, ClusterPrinter{Printer: p, Agent: a.Agent})
+		}
+	}
+	sort.SliceStable(printers, func(i, j int) bool { return printers[i].Name < printers[j].Name })
+	return printers
+}
+
+func (c *Coordinator) forward(w http.ResponseWriter, r *http.Request, printerName string, parts []string) {
+	wanted := r.URL.Query().Get("agent")
+
+	c.mutex.Lock()
+	if wanted == "" && len(parts) == 2 && parts[0] == "jobs" {
+		wanted = c.jobAgent(printerName, parts[1])
+	}
+	var found []*agent
+	for _, a := range c.live() {
+		if wanted != "" && a.Agent != wanted {
+			continue
+		}
+		for _, p := range a.Printers {
+			if p.Name == printerName {
+				found = append(found, a)
+				break
+			}
+		}
+	}
+	c.mutex.Unlock()
+
+	switch len(found) {
+	case 0:
+		if wanted != "" {
+			writeError(w, http.StatusNotFound, "printer %s not found on agent %s", printerName, wanted)
+			return
+		}
+		writeError(w, http.StatusNotFound, "printer %s not found", printerName)
+	case 1:
+		found[0].proxy.ServeHTTP(w, r)
+	default:
+		names := make([]string, len(found))
+		for i, a := range found {
+			names[i] = a.Agent
+		}
+		writeError(w, http.StatusConflict, "printer %s is served by agents %s, pick one with ?agent=", printerName, strings.Join(names, ", "))
+	}
+}
+
+// jobAgent returns the agent that printed a job submitted through the
+// coordinator, empty when unknown or ambiguous. Must be called with the
+// mutex held.
+func (c *Coordinator) jobAgent(printerName, jobID string) string {
+	agent := ""
+	for _, job := range c.jobs {
+		if job.Printer != printerName || fmt.Sprint(job.JobID) != jobID {
+			continue
+		}
+		if agent != "" && agent != job.Agent {
+			return ""
+		}
+		agent = job.Agent
+	}
+	return agent
+}
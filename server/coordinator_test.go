@@ -0,0 +1,132 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCoordinator(t *testing.T) {
+	coordinator := NewCoordinator()
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	coordinator.now = func() time.Time { return now }
+	cs := httptest.NewServer(coordinator)
+	defer cs.Close()
+
+	spoolers := map[string]*testSpooler{}
+	for _, site := range []struct {
+		name     string
+		printers testPrinters
+	}{
+		{"paris", testPrinters{{Name: "office"}, {Name: "labels"}}},
+		{"lyon", testPrinters{{Name: "office"}}},
+	} {
+		spoolers[site.name] = &testSpooler{}
+		as := httptest.NewServer(&Server{Printers: site.printers, Spooler: spoolers[site.name]})
+		defer as.Close()
+		agent := &Agent{Coordinators: []string{cs.URL}, Name: site.name, URL: as.URL, Printers: site.printers}
+		if err := agent.Register(cs.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	do := func(method, path string) *http.Response {
+		r, err := http.NewRequest(method, cs.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := do("GET", "/printers")
+	var printers []ClusterPrinter
+	err := json.NewDecoder(resp.Body).Decode(&printers)
+	resp.Body.Close()
+	if err != nil || len(printers) != 3 || printers[0].Name != "labels" || printers[0].Agent != "paris" {
+		t.Fatalf("unexpected cluster printers %+v %v", printers, err)
+	}
+
+	if resp = do("DELETE", "/printers/labels/jobs/3"); resp.StatusCode != http.StatusNoContent || spoolers["paris"].cancelled != 3 {
+		t.Errorf("request not forwarded to the agent: %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	if resp = do("DELETE", "/printers/office/jobs/4"); resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected 409 for ambiguous printer got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	if resp = do("DELETE", "/printers/office/jobs/4?agent=lyon"); resp.StatusCode != http.StatusNoContent || spoolers["lyon"].cancelled != 4 {
+		t.Errorf("request not forwarded to the picked agent: %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+	if resp = do("GET", "/printers/missing"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for missing printer got %d", resp.StatusCode)
+	}
+	resp.Body.Close()
+
+	now = now.Add(DefaultAgentTTL + time.Second)
+	if regs := coordinator.registrations(); len(regs) != 0 {
+		t.Errorf("expired registrations kept: %+v", regs)
+	}
+
+	r := httptest.NewRequest("POST", "/agents", nil)
+	w := httptest.NewRecorder()
+	coordinator.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for empty registration got %d", w.Code)
+	}
+}
+
+func TestCoordinatorToken(t *testing.T) {
+	coordinator := NewCoordinator()
+	coordinator.Token = "secret"
+	cs := httptest.NewServer(coordinator)
+	defer cs.Close()
+
+	printers := testPrinters{{Name: "office"}}
+	as := httptest.NewServer(&Server{Printers: printers, Spooler: &testSpooler{}})
+	defer as.Close()
+	intruder := &Agent{Name: "intruder", URL: as.URL, Printers: printers}
+	if err := intruder.Register(cs.URL); err == nil {
+		t.Fatal("expected registration without the cluster token to fail")
+	}
+	agent := &Agent{Name: "paris", URL: as.URL, Printers: printers, Token: "secret"}
+	if err := agent.Register(cs.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	for token, expected := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		r, _ := http.NewRequest("GET", cs.URL+"/printers/office", nil)
+		if token != "" {
+			r.Header.Set("Authorization", token)
+		}
+		resp, err := http.DefaultClient.Do(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != expected {
+			t.Errorf("authorization %q: expected %d got %d", token, expected, resp.StatusCode)
+		}
+	}
+	if regs := coordinator.registrations(); len(regs) != 1 || regs[0].Agent != "paris" {
+		t.Errorf("expected only paris registered got %+v", regs)
+	}
+}
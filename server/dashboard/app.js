@@ -0,0 +1,190 @@
+// Dashboard over the REST API of the server; it polls, since the API has no
+// push channel.
+"use strict";
+
+const refreshInterval = 5000;
+// History rows whose state is queried on each refresh.
+const historyStates = 20;
+
+let selected = "";
+
+// Names of the JOB_STATUS flags of a job, as the server decodes them.
+function statusText(job) {
+  const names = job.StatusNames || [];
+  return names.length ? names.join(", ") : "queued";
+}
+
+async function api(path, options) {
+  const response = await fetch(path, options);
+  if (response.status === 204) {
+    return null;
+  }
+  const body = await response.json();
+  if (!response.ok) {
+    throw new Error(body.error || response.statusText);
+  }
+  return body;
+}
+
+function cell(row, text) {
+  const td = document.createElement("td");
+  td.textContent = text;
+  row.appendChild(td);
+  return td;
+}
+
+function printerState(printer) {
+  if (printer.Offline) {
+    return "OFFLINE";
+  }
+  return printer.State ? printer.State.state : "UNKNOWN";
+}
+
+async function refreshPrinters() {
+  const printers = await api("/printers");
+  const grid = document.getElementById("printers");
+  const select = document.querySelector("#submit select[name=printer]");
+  grid.replaceChildren();
+  const current = select.value;
+  select.replaceChildren();
+  for (const printer of printers) {
+    const state = printerState(printer);
+    const card = document.createElement("div");
+    card.className = "printer " + state + (printer.Offline ? " offline" : "");
+    if (printer.Name === selected) {
+      card.classList.add("selected");
+    }
+    const name = document.createElement("div");
+    name.className = "name";
+    name.textContent = printer.DefaultDisplayName || printer.Name;
+    const status = document.createElement("div");
+    status.className = "state";
+    status.textContent = state;
+    card.append(name, status);
+    card.onclick = () => {
+      selected = printer.Name;
+      refresh();
+    };
+    grid.appendChild(card);
+
+    const option = document.createElement("option");
+    option.value = option.textContent = printer.Name;
+    select.appendChild(option);
+  }
+  select.value = current || selected;
+}
+
+async function refreshQueue() {
+  const queue = document.getElementById("queue");
+  if (!selected) {
+    return;
+  }
+  document.getElementById("queue-printer").textContent = selected;
+  const path = "/printers/" + encodeURIComponent(selected) + "/jobs";
+  let jobs;
+  try {
+    jobs = await api(path);
+  } catch (e) {
+    queue.replaceChildren();
+    cell(queue.insertRow(), e.message).className = "error";
+    return;
+  }
+  queue.replaceChildren();
+  for (const job of jobs || []) {
+    const row = queue.insertRow();
+    cell(row, job.JobID);
+    cell(row, job.Document);
+    cell(row, job.UserName);
+    cell(row, new Date(job.Submitted).toLocaleString());
+    cell(row, job.PagesPrinted + "/" + job.TotalPages);
+    cell(row, statusText(job));
+    const cancel = document.createElement("button");
+    cancel.textContent = "Cancel";
+    cancel.onclick = async () => {
+      try {
+        await api(path + "/" + job.JobID, {method: "DELETE"});
+      } catch (e) {
+        alert(e.message);
+      }
+      refreshQueue();
+    };
+    cell(row, "").appendChild(cancel);
+  }
+}
+
+async function refreshHistory() {
+  const query = document.getElementById("search").value;
+  const jobs = await api("/jobs?q=" + encodeURIComponent(query));
+  const history = document.getElementById("history");
+  history.replaceChildren();
+  jobs.forEach((job, i) => {
+    const row = history.insertRow();
+    cell(row, new Date(job.submitted).toLocaleString());
+    cell(row, job.printer);
+    cell(row, job.job_id);
+    cell(row, job.title);
+    cell(row, job.pages);
+    const state = cell(row, "");
+    if (i < historyStates) {
+      api("/printers/" + encodeURIComponent(job.printer) + "/jobs/" + job.job_id)
+        .then((s) => {
+          state.textContent = s.state ? s.state.type : "";
+        })
+        .catch(() => {});
+    }
+  });
+}
+
+function parsePages(pages) {
+  return pages.split(",").filter((s) => s.trim()).map((s) => {
+    const [start, end] = s.split("-");
+    const interval = {start: parseInt(start, 10)};
+    if (end === undefined) {
+      interval.end = interval.start;
+    } else if (end.trim()) {
+      interval.end = parseInt(end, 10);
+    }
+    return interval;
+  });
+}
+
+async function submit(event) {
+  event.preventDefault();
+  const form = event.target;
+  const output = document.getElementById("submit-result");
+  const ticket = {copies: {copies: parseInt(form.copies.value, 10) || 1}};
+  if (form.pages.value.trim()) {
+    ticket.page_range = {interval: parsePages(form.pages.value)};
+  }
+  const body = new FormData();
+  body.append("file", form.file.files[0]);
+  body.append("ticket", JSON.stringify(ticket));
+  if (form.title.value) {
+    body.append("title", form.title.value);
+  }
+  output.className = "";
+  output.textContent = "Submitting...";
+  try {
+    const result = await api("/printers/" + encodeURIComponent(form.printer.value) + "/jobs", {method: "POST", body});
+    output.textContent = "Job " + result.job_id + ", " + result.pages + " pages";
+    form.file.value = "";
+  } catch (e) {
+    output.className = "error";
+    output.textContent = e.message;
+  }
+  refresh();
+}
+
+async function refresh() {
+  try {
+    await Promise.all([refreshPrinters(), refreshQueue(), refreshHistory()]);
+    document.getElementById("updated").textContent = "Updated " + new Date().toLocaleTimeString();
+  } catch (e) {
+    document.getElementById("updated").textContent = e.message;
+  }
+}
+
+document.getElementById("submit").addEventListener("submit", submit);
+document.getElementById("search").addEventListener("input", refreshHistory);
+refresh();
+setInterval(refresh, refreshInterval);
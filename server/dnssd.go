@@ -0,0 +1,511 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model/ipp"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	// TTL of advertised records, in seconds; records are announced again
+	// before they expire.
+	dnssdTTL = 120
+	// TTL of answers to legacy unicast queries, RFC 6762 section 6.7.
+	dnssdLegacyTTL = 10
+	// How often printers are compared with the ones announced.
+	dnssdRefreshInterval = 30 * time.Second
+
+	// The top bit of the class of questions asks for a unicast response, and
+	// of unique records tells caches to flush other records of the name.
+	dnssdUnicastResponse = 0x8000
+	dnssdCacheFlush      = 0x8000
+)
+
+const (
+	dnssdIPPService     = "_ipp._tcp.local."
+	dnssdPrinterService = "_printer._tcp.local."
+	// Subtype AirPrint clients browse for.
+	dnssdUniversalSubtype = "_universal._sub._ipp._tcp.local."
+	dnssdServices         = "_services._dns-sd._udp.local."
+)
+
+// Advertiser announces the printers served by IPPServer over multicast DNS
+// service discovery (Bonjour), as _ipp._tcp services with TXT records built
+// from their capabilities, so that AirPrint and IPP Everywhere clients on
+// the local network find them without configuration. Printers also get a
+// _printer._tcp service on port 0, which reserves their name without
+// offering LPD.
+type Advertiser struct {
+	Printers Printers
+	// Port of the HTTP server that serves IPPServer.
+	Port int
+	// Host name the printers are advertised on, without ".local"; the
+	// computer name when empty.
+	HostName string
+	// Also tell clients to use ipps, when the server listens with TLS.
+	TLS bool
+}
+
+// dnssdRecord is a resource record, and the records answered along with it.
+type dnssdRecord struct {
+	header     dnsmessage.ResourceHeader
+	body       dnsmessage.ResourceBody
+	additional []*dnssdRecord
+}
+
+// dnssdZone holds the records of the printers announced.
+type dnssdZone struct {
+	// A records of the host.
+	addresses []*dnssdRecord
+	// Service types, for browsers that enumerate them, when there are
+	// printers.
+	services []*dnssdRecord
+	// Records of each printer, by instance name, PTRs first.
+	printers map[string][]*dnssdRecord
+	// TXT of each printer, to tell when it changes.
+	txts map[string]string
+}
+
+// Run answers queries for the printers, and announces them when they are
+// added or change, until done is closed. Printers are then withdrawn.
+func (a *Advertiser) Run(done <-chan struct{}) error {
+	host := a.HostName
+	if host == "" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	host = dnssdLabel(strings.SplitN(host, ".", 2)[0]) + ".local."
+
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("failed to listen for mDNS queries: %s", err)
+	}
+	defer conn.Close()
+
+	zones := make(chan *dnssdZone, 1)
+	go func() {
+		defer close(zones)
+		var zone *dnssdZone
+		refresh := time.NewTicker(dnssdRefreshInterval)
+		defer refresh.Stop()
+		// Announced twice, a second apart, as RFC 6762 section 8.3 asks.
+		announce := time.After(time.Second)
+		for {
+			next := a.zone(host, localIPv4s())
+			a.send(conn, mdnsGroup, next.changes(zone))
+			zone = next
+			zones <- zone
+			select {
+			case <-done:
+				a.send(conn, mdnsGroup, (&dnssdZone{}).changes(zone))
+				return
+			case <-announce:
+				zone = nil
+			case <-refresh.C:
+			}
+		}
+	}()
+
+	current := <-zones
+	packets := make(chan dnssdPacket)
+	go readDNSSDPackets(conn, packets, done)
+	for {
+		select {
+		case zone, ok := <-zones:
+			if !ok {
+				return nil
+			}
+			current = zone
+		case p := <-packets:
+			a.answer(conn, current, p)
+		}
+	}
+}
+
+type dnssdPacket struct {
+	data []byte
+	from *net.UDPAddr
+}
+
+// readDNSSDPackets reads packets until the connection is closed, or done.
+func readDNSSDPackets(conn *net.UDPConn, packets chan<- dnssdPacket, done <-chan struct{}) {
+	for {
+		buf := make([]byte, 9000)
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case packets <- dnssdPacket{buf[:n], from}:
+		case <-done:
+			return
+		}
+	}
+}
+
+// localIPv4s returns the addresses of the interfaces queries are received
+// on.
+func localIPv4s() [][4]byte {
+	var ips [][4]byte
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	for _, i := range interfaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagMulticast == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := i.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				if ip := ipNet.IP.To4(); ip != nil {
+					ips = append(ips, [4]byte{ip[0], ip[1], ip[2], ip[3]})
+				}
+			}
+		}
+	}
+	return ips
+}
+
+// dnssdLabel makes s a DNS label: at most 63 bytes, without dots, which
+// names can't escape.
+func dnssdLabel(s string) string {
+	s = strings.ReplaceAll(s, ".", "-")
+	for len(s) > 63 {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return s
+}
+
+func dnssdName(s string) dnsmessage.Name {
+	return dnsmessage.MustNewName(s)
+}
+
+// zone returns the records of the printers, on host at ips.
+func (a *Advertiser) zone(host string, ips [][4]byte) *dnssdZone {
+	zone := &dnssdZone{printers: make(map[string][]*dnssdRecord), txts: make(map[string]string)}
+	var addresses []*dnssdRecord
+	for _, ip := range ips {
+		addresses = append(addresses, &dnssdRecord{
+			header: dnsmessage.ResourceHeader{Name: dnssdName(host), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET | dnssdCacheFlush, TTL: dnssdTTL},
+			body:   &dnsmessage.AResource{A: ip},
+		})
+	}
+	zone.addresses = addresses
+
+	for _, printer := range a.Printers.GetPrinters() {
+		instance := dnssdLabel(printer.Name)
+		if _, exists := zone.printers[instance]; exists {
+			continue
+		}
+		txt := printerTXT(&printer, a.TLS)
+		ippInstance := dnssdName(instance + "." + dnssdIPPService)
+		lpdInstance := dnssdName(instance + "." + dnssdPrinterService)
+		unique := func(name dnsmessage.Name, t dnsmessage.Type) dnsmessage.ResourceHeader {
+			return dnsmessage.ResourceHeader{Name: name, Type: t, Class: dnsmessage.ClassINET | dnssdCacheFlush, TTL: dnssdTTL}
+		}
+		shared := func(service string) dnsmessage.ResourceHeader {
+			return dnsmessage.ResourceHeader{Name: dnssdName(service), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: dnssdTTL}
+		}
+		srv := &dnssdRecord{
+			header:     unique(ippInstance, dnsmessage.TypeSRV),
+			body:       &dnsmessage.SRVResource{Port: uint16(a.Port), Target: dnssdName(host)},
+			additional: addresses,
+		}
+		txtRecord := &dnssdRecord{header: unique(ippInstance, dnsmessage.TypeTXT), body: &dnsmessage.TXTResource{TXT: txt}}
+		lpdSRV := &dnssdRecord{
+			header:     unique(lpdInstance, dnsmessage.TypeSRV),
+			body:       &dnsmessage.SRVResource{Port: 0, Target: dnssdName(host)},
+			additional: addresses,
+		}
+		lpdTXT := &dnssdRecord{header: unique(lpdInstance, dnsmessage.TypeTXT), body: &dnsmessage.TXTResource{TXT: []string{"txtvers=1"}}}
+		zone.printers[instance] = []*dnssdRecord{
+			{header: shared(dnssdIPPService), body: &dnsmessage.PTRResource{PTR: ippInstance}, additional: []*dnssdRecord{srv, txtRecord}},
+			{header: shared(dnssdUniversalSubtype), body: &dnsmessage.PTRResource{PTR: ippInstance}, additional: []*dnssdRecord{srv, txtRecord}},
+			{header: shared(dnssdPrinterService), body: &dnsmessage.PTRResource{PTR: lpdInstance}, additional: []*dnssdRecord{lpdSRV, lpdTXT}},
+			srv, txtRecord, lpdSRV, lpdTXT,
+		}
+		zone.txts[instance] = strings.Join(txt, "\x00")
+	}
+	if len(zone.printers) > 0 {
+		for _, service := range []string{dnssdIPPService, dnssdPrinterService} {
+			zone.services = append(zone.services, &dnssdRecord{
+				header: dnsmessage.ResourceHeader{Name: dnssdName(dnssdServices), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: dnssdTTL},
+				body:   &dnsmessage.PTRResource{PTR: dnssdName(service)},
+			})
+		}
+	}
+	return zone
+}
+
+// records returns the records of the zone, the addresses of the host last.
+func (z *dnssdZone) records() []*dnssdRecord {
+	instances := make([]string, 0, len(z.printers))
+	for instance := range z.printers {
+		instances = append(instances, instance)
+	}
+	sort.Strings(instances)
+	var records []*dnssdRecord
+	for _, instance := range instances {
+		records = append(records, z.printers[instance]...)
+	}
+	records = append(records, z.services...)
+	return append(records, z.addresses...)
+}
+
+// changes returns the records to announce for z to replace previous, nil
+// for none: the records of printers added or changed, and the records of
+// printers removed with a TTL of 0.
+func (z *dnssdZone) changes(previous *dnssdZone) []*dnssdRecord {
+	if previous == nil {
+		return z.records()
+	}
+	var records []*dnssdRecord
+	for instance, printerRecords := range z.printers {
+		if txt, exists := previous.txts[instance]; !exists || txt != z.txts[instance] {
+			records = append(records, printerRecords...)
+		}
+	}
+	if len(previous.services) == 0 {
+		records = append(records, z.services...)
+	}
+	goodbye := func(r *dnssdRecord) {
+		g := dnssdRecord{header: r.header, body: r.body}
+		g.header.TTL = 0
+		records = append(records, &g)
+	}
+	for instance, printerRecords := range previous.printers {
+		if _, exists := z.printers[instance]; !exists {
+			for _, r := range printerRecords {
+				goodbye(r)
+			}
+		}
+	}
+	if len(z.services) == 0 {
+		for _, r := range previous.services {
+			goodbye(r)
+		}
+	}
+	if len(records) > 0 {
+		records = append(records, z.addresses...)
+	}
+	return records
+}
+
+// answer answers the questions of a query that the zone has records for.
+func (a *Advertiser) answer(conn *net.UDPConn, zone *dnssdZone, p dnssdPacket) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(p.data)
+	if err != nil || header.Response {
+		return
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return
+	}
+
+	var answers []*dnssdRecord
+	unicast := false
+	for _, q := range questions {
+		for _, r := range zone.records() {
+			if (q.Type == r.header.Type || q.Type == dnsmessage.TypeALL) && strings.EqualFold(q.Name.String(), r.header.Name.String()) {
+				answers = append(answers, r)
+			}
+		}
+		if q.Class&dnssdUnicastResponse != 0 {
+			unicast = true
+		}
+	}
+	if len(answers) == 0 {
+		return
+	}
+
+	// Queries from ports other than 5353 come from simple resolvers, which
+	// get a conventional unicast DNS response.
+	if p.from.Port != mdnsGroup.Port {
+		a.sendMessage(conn, p.from, header.ID, questions, answers, dnssdLegacyTTL)
+	} else if unicast {
+		a.sendMessage(conn, p.from, 0, nil, answers, 0)
+	} else {
+		a.send(conn, mdnsGroup, answers)
+	}
+}
+
+func (a *Advertiser) send(conn *net.UDPConn, to *net.UDPAddr, answers []*dnssdRecord) {
+	if len(answers) > 0 {
+		a.sendMessage(conn, to, 0, nil, answers, 0)
+	}
+}
+
+// sendMessage sends a response with answers and the records that go along
+// with them, with TTLs capped at maxTTL unless zero.
+func (a *Advertiser) sendMessage(conn *net.UDPConn, to *net.UDPAddr, id uint16, questions []dnsmessage.Question, answers []*dnssdRecord, maxTTL uint32) {
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, Response: true, Authoritative: true})
+	b.EnableCompression()
+	add := func(r *dnssdRecord) error {
+		h := r.header
+		if maxTTL > 0 {
+			// Legacy resolvers don't know the cache flush bit.
+			h.Class &^= dnssdCacheFlush
+			if h.TTL > maxTTL {
+				h.TTL = maxTTL
+			}
+		}
+		switch body := r.body.(type) {
+		case *dnsmessage.PTRResource:
+			return b.PTRResource(h, *body)
+		case *dnsmessage.SRVResource:
+			return b.SRVResource(h, *body)
+		case *dnsmessage.TXTResource:
+			return b.TXTResource(h, *body)
+		case *dnsmessage.AResource:
+			return b.AResource(h, *body)
+		}
+		return fmt.Errorf("unexpected record %T", r.body)
+	}
+
+	err := b.StartQuestions()
+	for i := 0; err == nil && i < len(questions); i++ {
+		err = b.Question(questions[i])
+	}
+	if err == nil {
+		err = b.StartAnswers()
+	}
+	sent := make(map[*dnssdRecord]bool)
+	for i := 0; err == nil && i < len(answers); i++ {
+		if !sent[answers[i]] {
+			sent[answers[i]] = true
+			err = add(answers[i])
+		}
+	}
+	if err == nil {
+		err = b.StartAdditionals()
+	}
+	// Additional records bring theirs: the addresses of an SRV record.
+	pending := append([]*dnssdRecord{}, answers...)
+	for len(pending) > 0 && err == nil {
+		r := pending[0]
+		pending = pending[1:]
+		for i := 0; err == nil && i < len(r.additional); i++ {
+			if !sent[r.additional[i]] {
+				sent[r.additional[i]] = true
+				err = add(r.additional[i])
+				pending = append(pending, r.additional[i])
+			}
+		}
+	}
+	var msg []byte
+	if err == nil {
+		msg, err = b.Finish()
+	}
+	if err == nil {
+		_, err = conn.WriteToUDP(msg, to)
+	}
+	if err != nil {
+		log.Printf("Failed to send mDNS response to %s: %s", to, err)
+	}
+}
+
+// printerTXT returns the TXT record of the _ipp._tcp service of a printer,
+// with the keys of the Bonjour Printing and AirPrint specifications.
+func printerTXT(printer *lib.Printer, tls bool) []string {
+	makeAndModel := strings.TrimSpace(printer.Manufacturer + " " + printer.Model)
+	if makeAndModel == "" {
+		makeAndModel = printer.Name
+	}
+	state, _ := ippPrinterState(printer)
+	txt := []string{
+		"txtvers=1",
+		"qtotal=1",
+		"rp=" + strings.TrimPrefix(IPPPathPrefix, "/") + url.PathEscape(printer.Name),
+		"ty=" + makeAndModel,
+		"kind=document",
+		fmt.Sprintf("printer-state=%d", state),
+	}
+	if printer.Model != "" {
+		txt = append(txt, "product=("+printer.Model+")")
+	}
+	if location := printer.Tags["printer-location"]; location != "" {
+		txt = append(txt, "note="+location)
+	}
+	if printer.DeviceUUID != "" {
+		txt = append(txt, "UUID="+printer.DeviceUUID)
+	}
+	if tls {
+		txt = append(txt, "TLS=1.2")
+	}
+
+	color, duplex := "F", "F"
+	resolutions := defaultResolutions
+	// Documents are detected from their content, so any format the client
+	// sends prints.
+	pdl := "application/octet-stream"
+	if printer.Description != nil {
+		for _, a := range ipp.PrinterDescriptionToAttributes(printer.Description) {
+			values, _ := a.Strings()
+			switch a.Name {
+			case "print-color-mode-supported":
+				for _, v := range values {
+					if v == "color" {
+						color = "T"
+					}
+				}
+			case "sides-supported":
+				if len(values) > 1 {
+					duplex = "T"
+				}
+			case "printer-resolution-supported":
+				resolutions = a.Values
+			case "document-format-supported":
+				for _, v := range values {
+					// TXT strings are limited to 255 bytes.
+					if len("pdl=")+len(pdl)+1+len(v) <= 255 {
+						pdl += "," + v
+					}
+				}
+			}
+		}
+	}
+	var urf []string
+	for _, v := range urfSupported(resolutions) {
+		urf = append(urf, v.(string))
+	}
+	txt = append(txt, "pdl="+pdl, "URF="+strings.Join(urf, ","), "Color="+color, "Duplex="+duplex)
+
+	// Strings over 255 bytes can't be encoded; long names and locations are
+	// cut.
+	for i, s := range txt {
+		for len(s) > 255 {
+			_, size := utf8.DecodeLastRuneInString(s)
+			s = s[:len(s)-size]
+		}
+		txt[i] = s
+	}
+	return txt
+}
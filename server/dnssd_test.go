@@ -0,0 +1,118 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestPrinterTXT(t *testing.T) {
+	printer := &lib.Printer{
+		Name:         "Front Desk",
+		Manufacturer: "HP",
+		Model:        "Color LaserJet",
+		DeviceUUID:   "4509a320-00a0-008f-00b6-002507510eca",
+		Tags:         map[string]string{"printer-location": "Lobby"},
+		Description: &model.PrinterDescriptionSection{
+			SupportedContentType: &[]model.SupportedContentType{{ContentType: lib.ContentTypePDF}, {ContentType: lib.ContentTypeURF}},
+			Color:                &model.Color{Option: []model.ColorOption{{Type: model.ColorTypeStandardColor, IsDefault: true}, {Type: model.ColorTypeStandardMonochrome}}},
+		},
+	}
+	txt := strings.Join(printerTXT(printer, false), "\n")
+	for _, expected := range []string{
+		"rp=ipp/print/Front%20Desk", "ty=HP Color LaserJet", "product=(Color LaserJet)", "note=Lobby",
+		"UUID=4509a320-00a0-008f-00b6-002507510eca", "pdl=application/octet-stream,application/pdf,image/urf",
+		"URF=V1.4,CP1,W8,SRGB24,RS300", "Color=T", "Duplex=F", "printer-state=3",
+	} {
+		if !strings.Contains(txt+"\n", expected+"\n") {
+			t.Errorf("expected %s in\n%s", expected, txt)
+		}
+	}
+}
+
+func TestAdvertiserAnswer(t *testing.T) {
+	a := &Advertiser{Printers: testPrinters{{Name: "Office"}, {Name: "Lab"}}, Port: 8631}
+	zone := a.zone("winhost.local.", [][4]byte{{192, 0, 2, 1}})
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: 7})
+	b.StartQuestions()
+	b.Question(dnsmessage.Question{Name: dnsmessage.MustNewName("_universal._sub._ipp._tcp.local."), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET})
+	query, err := b.Finish()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// From a port other than 5353, as legacy resolvers query.
+	a.answer(conn, zone, dnssdPacket{query, client.LocalAddr().(*net.UDPAddr)})
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 9000)
+	n, _, err := client.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m dnsmessage.Message
+	if err = m.Unpack(buf[:n]); err != nil {
+		t.Fatal(err)
+	}
+	if m.ID != 7 || len(m.Questions) != 1 || len(m.Answers) != 2 {
+		t.Fatalf("expected 2 answers to query 7 got %+v", m)
+	}
+	var srvs, txts, as int
+	for _, r := range m.Additionals {
+		if r.Header.TTL > dnssdLegacyTTL || r.Header.Class != dnsmessage.ClassINET {
+			t.Errorf("expected legacy TTL and class got %+v", r.Header)
+		}
+		switch body := r.Body.(type) {
+		case *dnsmessage.SRVResource:
+			srvs++
+			if body.Port != 8631 || body.Target.String() != "winhost.local." {
+				t.Errorf("unexpected SRV %+v", body)
+			}
+		case *dnsmessage.TXTResource:
+			txts++
+		case *dnsmessage.AResource:
+			as++
+		}
+	}
+	if srvs != 2 || txts != 2 || as != 1 {
+		t.Errorf("expected SRV and TXT records of 2 printers and an address got %+v", m.Additionals)
+	}
+
+	a.Printers = testPrinters{{Name: "Office"}}
+	var goodbyes int
+	for _, r := range a.zone("winhost.local.", [][4]byte{{192, 0, 2, 1}}).changes(zone) {
+		if r.header.TTL == 0 {
+			goodbyes++
+			if !strings.HasPrefix(r.header.Name.String(), "Lab.") && !strings.HasPrefix(r.body.(*dnsmessage.PTRResource).PTR.String(), "Lab.") {
+				t.Errorf("unexpected goodbye %+v", r)
+			}
+		}
+	}
+	if goodbyes != 7 {
+		t.Errorf("expected the 7 records of Lab withdrawn got %d", goodbyes)
+	}
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// DefaultLeaseTTL is how long a leader holds its lease without renewing it.
+const DefaultLeaseTTL = 15 * time.Second
+
+// Lease elects one leader among the coordinator instances of an HA
+// deployment.
+type Lease interface {
+	// TryAcquire acquires the lease, or renews it when already held, and
+	// returns the current holder.
+	TryAcquire() (held bool, holder string, err error)
+	// Release gives up the lease, if held, so that another instance can
+	// take over without waiting for it to expire.
+	Release() error
+	// TTL is how long the lease is held without renewal.
+	TTL() time.Duration
+}
+
+type leaseRecord struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// FileLease is a lease kept in a file, on storage shared by the instances,
+// e.g. an SMB share.
+type FileLease struct {
+	path   string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewFileLease returns a lease kept in path, acquired as holder. A zero ttl
+// means DefaultLeaseTTL.
+func NewFileLease(path, holder string, ttl time.Duration) *FileLease {
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	return &FileLease{path: path, holder: holder, ttl: ttl, now: time.Now}
+}
+
+func (l *FileLease) TTL() time.Duration {
+	return l.ttl
+}
+
+// lock serializes read-modify-write cycles of the lease file between
+// instances. A lock left behind by a crashed instance is broken after ttl.
+func (l *FileLease) lock() (func(), error) {
+	lockPath := l.path + ".lock"
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := os.Stat(lockPath); err == nil && l.now().Sub(fi.ModTime()) > l.ttl {
+			os.Remove(lockPath)
+			continue
+		}
+		if attempt >= 10 {
+			return nil, fmt.Errorf("lease %s is locked", l.path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func (l *FileLease) read() (leaseRecord, error) {
+	var record leaseRecord
+	b, err := ioutil.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return record, nil
+	} else if err != nil {
+		return record, err
+	}
+	if err = json.Unmarshal(b, &record); err != nil {
+		return record, fmt.Errorf("invalid lease %s: %s", l.path, err)
+	}
+	return record, nil
+}
+
+func (l *FileLease) TryAcquire() (bool, string, error) {
+	unlock, err := l.lock()
+	if err != nil {
+		return false, "", err
+	}
+	defer unlock()
+
+	record, err := l.read()
+	if err != nil {
+		return false, "", err
+	}
+	now := l.now()
+	if record.Holder != "" && record.Holder != l.holder && now.Before(record.Expires) {
+		return false, record.Holder, nil
+	}
+
+	b, err := json.Marshal(leaseRecord{Holder: l.holder, Expires: now.Add(l.ttl)})
+	if err != nil {
+		return false, "", err
+	}
+	if err = writeFileAtomic(l.path, b); err != nil {
+		return false, "", err
+	}
+	return true, l.holder, nil
+}
+
+func (l *FileLease) Release() error {
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	record, err := l.read()
+	if err != nil || record.Holder != l.holder {
+		return err
+	}
+	return os.Remove(l.path)
+}
+
+// ClusterJob is a job submitted through the coordinator.
+type ClusterJob struct {
+	Printer   string    `json:"printer"`
+	Agent     string    `json:"agent"`
+	JobID     uint32    `json:"job_id"`
+	Submitted time.Time `json:"submitted"`
+}
+
+type AgentState struct {
+	Registration
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// ClusterState is the state of the coordinator that survives a failover.
+type ClusterState struct {
+	Agents []AgentState `json:"agents"`
+	Jobs   []ClusterJob `json:"jobs"`
+}
+
+// ClusterStore keeps the coordinator state where all instances see it.
+type ClusterStore interface {
+	Load() (*ClusterState, error)
+	Save(state *ClusterState) error
+}
+
+// FileStore keeps the cluster state in a JSON file, on storage shared by
+// the instances.
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) Load() (*ClusterState, error) {
+	var state ClusterState
+	b, err := ioutil.ReadFile(s.Path)
+	if os.IsNotExist(err) {
+		return &state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &state); err != nil {
+		return nil, fmt.Errorf("invalid cluster state %s: %s", s.Path, err)
+	}
+	return &state, nil
+}
+
+func (s *FileStore) Save(state *ClusterState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(s.Path, b)
+}
+
+func writeFileAtomic(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
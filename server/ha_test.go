@@ -0,0 +1,159 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileLease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lease")
+	now := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+	a, b := NewFileLease(path, "a", time.Minute), NewFileLease(path, "b", time.Minute)
+	a.now = func() time.Time { return now }
+	b.now = a.now
+
+	if held, _, err := a.TryAcquire(); !held || err != nil {
+		t.Fatalf("a should acquire a free lease: %v", err)
+	}
+	if held, holder, err := b.TryAcquire(); held || holder != "a" || err != nil {
+		t.Fatalf("b shouldn't acquire a held lease, holder %s: %v", holder, err)
+	}
+
+	now = now.Add(30 * time.Second)
+	if held, _, err := a.TryAcquire(); !held || err != nil {
+		t.Fatalf("a should renew its lease: %v", err)
+	}
+	now = now.Add(45 * time.Second)
+	if held, _, _ := b.TryAcquire(); held {
+		t.Fatal("b shouldn't acquire a renewed lease")
+	}
+
+	// a stops renewing, e.g. its host failed.
+	now = now.Add(time.Minute)
+	if held, _, err := b.TryAcquire(); !held || err != nil {
+		t.Fatalf("b should take over an expired lease: %v", err)
+	}
+	if err := a.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, _ := a.TryAcquire(); held {
+		t.Fatal("a release shouldn't drop the lease of b")
+	}
+	if err := b.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if held, _, _ := a.TryAcquire(); !held {
+		t.Fatal("a should acquire a released lease")
+	}
+}
+
+// failingLease is acquired once, then can't be renewed.
+type failingLease struct {
+	acquired bool
+}
+
+func (l *failingLease) TryAcquire() (bool, string, error) {
+	if l.acquired {
+		return false, "", errors.New("lease store unreachable")
+	}
+	l.acquired = true
+	return true, "a", nil
+}
+
+func (l *failingLease) Release() error     { return nil }
+func (l *failingLease) TTL() time.Duration { return 30 * time.Millisecond }
+
+func TestCoordinatorStepsDown(t *testing.T) {
+	c := NewCoordinator()
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		c.RunElection(&failingLease{}, done)
+		close(stopped)
+	}()
+	defer func() {
+		close(done)
+		<-stopped
+	}()
+
+	leading := func() bool {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		return c.leading
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !leading() {
+		if time.Now().After(deadline) {
+			t.Fatal("lease acquired without leading")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for leading() {
+		if time.Now().After(deadline) {
+			t.Fatal("leader didn't step down once its lease expired")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoordinatorFailover(t *testing.T) {
+	store := &FileStore{Path: filepath.Join(t.TempDir(), "cluster.json")}
+	spooler := &testSpooler{}
+	as := httptest.NewServer(&Server{Printers: testPrinters{{Name: "office"}}, Spooler: spooler})
+	defer as.Close()
+
+	do := func(c *Coordinator, method, path string, body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, bytes.NewReader(body))
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, r)
+		return w
+	}
+	reg, _ := json.Marshal(Registration{Agent: "paris", URL: as.URL, Printers: testPrinters{{Name: "office"}}})
+
+	leader := NewCoordinator()
+	leader.Store = store
+	follower := NewCoordinator()
+	follower.Store = store
+	follower.setLeader(false, "leader")
+
+	if w := do(leader, "POST", "/agents", reg); w.Code != http.StatusNoContent {
+		t.Fatalf("register: %d %s", w.Code, w.Body)
+	}
+	body, contentType := multipartBody(t, map[string]string{"file": "%PDF-1.4"})
+	r := httptest.NewRequest("POST", "/printers/office/jobs", body)
+	r.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+	leader.ServeHTTP(w, r)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("submit job: %d %s", w.Code, w.Body)
+	}
+
+	if w := do(follower, "GET", "/printers", nil); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 from a follower got %d", w.Code)
+	}
+
+	// The leader fails; the follower takes over with the stored state.
+	follower.setLeader(true, "follower")
+	var jobs []ClusterJob
+	w = do(follower, "GET", "/jobs", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &jobs); err != nil || len(jobs) != 1 || jobs[0].Agent != "paris" || jobs[0].JobID != 7 {
+		t.Fatalf("jobs not taken over: %s", w.Body)
+	}
+	if w := do(follower, "DELETE", "/printers/office/jobs/7", nil); w.Code != http.StatusNoContent || spooler.cancelled != 7 {
+		t.Errorf("cancel after failover: %d %s", w.Code, w.Body)
+	}
+}
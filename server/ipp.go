@@ -0,0 +1,636 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/model/ipp"
+)
+
+// IPPPathPrefix is the path printers are served at by IPPServer, followed
+// by the printer name.
+const IPPPathPrefix = "/ipp/print/"
+
+var ippOperations = []ipp.Value{
+	int32(ipp.OpPrintJob), int32(ipp.OpValidateJob), int32(ipp.OpCancelJob),
+	int32(ipp.OpGetJobAttributes), int32(ipp.OpGetJobs), int32(ipp.OpGetPrinterAttributes),
+}
+
+// job-state enum values, RFC 8011 section 5.3.7.
+const (
+	ippJobPending           int32 = 3
+	ippJobPendingHeld       int32 = 4
+	ippJobProcessing        int32 = 5
+	ippJobProcessingStopped int32 = 6
+	ippJobCanceled          int32 = 7
+	ippJobAborted           int32 = 8
+	ippJobCompleted         int32 = 9
+)
+
+var ippJobStatesByType = map[model.JobStateType]int32{
+	model.JobStateDraft:      ippJobPending,
+	model.JobStateQueued:     ippJobPending,
+	model.JobStateHeld:       ippJobPendingHeld,
+	model.JobStateInProgress: ippJobProcessing,
+	model.JobStateStopped:    ippJobProcessingStopped,
+	model.JobStateDone:       ippJobCompleted,
+	model.JobStateAborted:    ippJobAborted,
+}
+
+var ippJobStateReasons = map[int32]string{
+	ippJobPending:           "job-queued",
+	ippJobPendingHeld:       "job-held-by-user",
+	ippJobProcessing:        "job-printing",
+	ippJobProcessingStopped: "job-stopped",
+	ippJobCanceled:          "job-canceled-by-user",
+	ippJobAborted:           "aborted-by-system",
+	ippJobCompleted:         "job-completed-successfully",
+}
+
+// Resolutions of printers that don't tell theirs.
+var defaultResolutions = []ipp.Value{ipp.Resolution{CrossFeed: 300, Feed: 300, Units: ipp.ResolutionDotsPerInch}}
+
+// printer-state enum values, RFC 8011 section 5.4.11.
+var ippPrinterStatesByType = map[model.CloudDeviceStateType]int32{
+	model.CloudDeviceStateIdle:       3,
+	model.CloudDeviceStateProcessing: 4,
+	model.CloudDeviceStateStopped:    5,
+}
+
+// IPPServer serves every printer as an IPP Everywhere printer at
+// IPPPathPrefix and its name, so that Linux, macOS and mobile clients print
+// through Windows without a driver for the printer. It implements
+// Print-Job, Validate-Job, Cancel-Job, Get-Job-Attributes, Get-Jobs and
+// Get-Printer-Attributes, over IPP/1.1 and 2.0. Job template attributes
+// are converted to job tickets.
+type IPPServer struct {
+	Printers Printers
+	Spooler  Spooler
+
+	// Limits the size of submitted documents; DefaultMaxUploadSize when zero.
+	MaxUploadSize int64
+
+	startOnce sync.Once
+	started   time.Time
+
+	jobsMutex sync.Mutex
+	// Jobs submitted over IPP, oldest first.
+	jobs []*ippJob
+}
+
+// ippJob is a job submitted over IPP.
+type ippJob struct {
+	printer string
+	id      uint32
+	name    string
+	user    string
+	created time.Time
+	// Last state read from the spooler.
+	state int32
+}
+
+func (j *ippJob) completed() bool {
+	return j.state >= ippJobCanceled
+}
+
+// ippError fails an operation with an IPP status.
+type ippError struct {
+	status  uint16
+	message string
+}
+
+func (e *ippError) Error() string { return e.message }
+
+func newIPPError(status uint16, format string, a ...interface{}) *ippError {
+	return &ippError{status: status, message: fmt.Sprintf(format, a...)}
+}
+
+func (s *IPPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.startOnce.Do(func() { s.started = time.Now() })
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "IPP requests are POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if contentType := r.Header.Get("Content-Type"); contentType != "application/ipp" {
+		http.Error(w, "expected an application/ipp body", http.StatusUnsupportedMediaType)
+		return
+	}
+	maxSize := s.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	request, err := ipp.DecodeMessage(r.Body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid IPP request: %s", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &ipp.Message{Version: request.Version, RequestID: request.RequestID}
+	if response.Version > 0x0200 {
+		response.Version = 0x0200
+	}
+	attrs, err := s.serveOperation(r, request)
+	var ippErr *ippError
+	if errors.As(err, &ippErr) {
+		response.Code = ippErr.status
+	} else if err != nil {
+		response.Code = ipp.StatusInternalError
+	}
+	operation := ipp.Attributes{
+		ipp.NewAttribute("attributes-charset", ipp.TagCharset, "utf-8"),
+		ipp.NewAttribute("attributes-natural-language", ipp.TagNaturalLanguage, "en"),
+	}
+	if err != nil {
+		operation = append(operation, ipp.NewAttribute("status-message", ipp.TagText, err.Error()))
+	}
+	response.AddGroup(ipp.GroupOperation, operation)
+	response.Groups = append(response.Groups, attrs...)
+
+	w.Header().Set("Content-Type", "application/ipp")
+	if err := response.Encode(w); err != nil {
+		log.Printf("Failed to write IPP response: %s", err)
+	}
+}
+
+// serveOperation runs the operation of a request, and returns the groups
+// of the response that follow the operation attributes.
+func (s *IPPServer) serveOperation(r *http.Request, request *ipp.Message) ([]ipp.Group, error) {
+	if major := request.Version >> 8; major < 1 || major > 2 || request.Version == 0x0100 {
+		return nil, newIPPError(ipp.StatusVersionNotSupported, "IPP/%d.%d is not supported", major, request.Version&0xff)
+	}
+	if !strings.HasPrefix(r.URL.Path, IPPPathPrefix) {
+		return nil, newIPPError(ipp.StatusNotFound, "%s is not a printer", r.URL.Path)
+	}
+	name := strings.TrimPrefix(r.URL.Path, IPPPathPrefix)
+	printer, exists := s.Printers.GetPrinter(name)
+	if !exists {
+		return nil, newIPPError(ipp.StatusNotFound, "printer %s not found", name)
+	}
+	operation := request.Group(ipp.GroupOperation)
+	printerURI := ippPrinterURI(r, printer.Name)
+
+	switch request.Code {
+	case ipp.OpGetPrinterAttributes:
+		attrs := filterAttributes(s.printerAttributes(&printer, printerURI), operation)
+		return []ipp.Group{{Tag: ipp.GroupPrinter, Attributes: attrs}}, nil
+
+	case ipp.OpValidateJob:
+		_, err := jobTicket(request)
+		return nil, err
+
+	case ipp.OpPrintJob:
+		job, err := s.printJob(r, &printer, request)
+		if err != nil {
+			return nil, err
+		}
+		return []ipp.Group{{Tag: ipp.GroupJob, Attributes: jobAttributes(job, printerURI)}}, nil
+
+	case ipp.OpGetJobAttributes:
+		jobID, err := requestJobID(operation)
+		if err != nil {
+			return nil, err
+		}
+		job, err := s.jobState(printer.Name, jobID)
+		if err != nil {
+			return nil, err
+		}
+		return []ipp.Group{{Tag: ipp.GroupJob, Attributes: filterAttributes(jobAttributes(job, printerURI), operation)}}, nil
+
+	case ipp.OpGetJobs:
+		return s.getJobs(printer.Name, printerURI, operation)
+
+	case ipp.OpCancelJob:
+		jobID, err := requestJobID(operation)
+		if err != nil {
+			return nil, err
+		}
+		if err = s.checkJobOwner(printer.Name, jobID, operation); err != nil {
+			return nil, err
+		}
+		if err = s.Spooler.CancelJob(printer.Name, jobID); errors.Is(err, lib.ErrAccessDenied) {
+			return nil, newIPPError(ipp.StatusForbidden, "%s", err)
+		} else if err != nil {
+			return nil, newIPPError(ipp.StatusNotPossible, "%s", err)
+		}
+		s.jobsMutex.Lock()
+		if job := s.findJob(printer.Name, jobID); job != nil {
+			job.state = ippJobCanceled
+		}
+		s.jobsMutex.Unlock()
+		return nil, nil
+	}
+	return nil, newIPPError(ipp.StatusOperationNotSupported, "operation %#04x is not supported", request.Code)
+}
+
+// ippPrinterURI returns the URI the request reached the printer at.
+func ippPrinterURI(r *http.Request, name string) string {
+	scheme := "ipp"
+	if r.TLS != nil {
+		scheme = "ipps"
+	}
+	return fmt.Sprintf("%s://%s%s%s", scheme, r.Host, IPPPathPrefix, url.PathEscape(name))
+}
+
+// printerAttributes returns the printer description attributes of a
+// printer, with its capabilities.
+func (s *IPPServer) printerAttributes(printer *lib.Printer, printerURI string) ipp.Attributes {
+	state, reason := ippPrinterState(printer)
+	makeAndModel := strings.TrimSpace(printer.Manufacturer + " " + printer.Model)
+	if makeAndModel == "" {
+		makeAndModel = printer.Name
+	}
+	info := printer.DefaultDisplayName
+	if info == "" {
+		info = printer.Name
+	}
+
+	s.jobsMutex.Lock()
+	var queued int32
+	for _, job := range s.jobs {
+		if job.printer == printer.Name && !job.completed() {
+			queued++
+		}
+	}
+	s.jobsMutex.Unlock()
+
+	attrs := ipp.Attributes{
+		ipp.NewAttribute("printer-uri-supported", ipp.TagURI, printerURI),
+		ipp.NewAttribute("uri-security-supported", ipp.TagKeyword, "none"),
+		ipp.NewAttribute("uri-authentication-supported", ipp.TagKeyword, "none"),
+		ipp.NewAttribute("printer-name", ipp.TagName, printer.Name),
+		ipp.NewAttribute("printer-info", ipp.TagText, info),
+		ipp.NewAttribute("printer-make-and-model", ipp.TagText, makeAndModel),
+		ipp.NewAttribute("printer-state", ipp.TagEnum, state),
+		ipp.NewAttribute("printer-state-reasons", ipp.TagKeyword, reason),
+		ipp.NewAttribute("printer-is-accepting-jobs", ipp.TagBoolean, true),
+		ipp.NewAttribute("queued-job-count", ipp.TagInteger, queued),
+		ipp.NewAttribute("printer-up-time", ipp.TagInteger, int32(time.Since(s.started)/time.Second)+1),
+		ipp.NewAttribute("ipp-versions-supported", ipp.TagKeyword, "1.1", "2.0"),
+		ipp.NewAttribute("ipp-features-supported", ipp.TagKeyword, "ipp-everywhere"),
+		ipp.NewAttribute("operations-supported", ipp.TagEnum, ippOperations...),
+		ipp.NewAttribute("charset-configured", ipp.TagCharset, "utf-8"),
+		ipp.NewAttribute("charset-supported", ipp.TagCharset, "utf-8"),
+		ipp.NewAttribute("natural-language-configured", ipp.TagNaturalLanguage, "en"),
+		ipp.NewAttribute("generated-natural-language-supported", ipp.TagNaturalLanguage, "en"),
+		ipp.NewAttribute("document-format-default", ipp.TagMimeMediaType, "application/octet-stream"),
+		ipp.NewAttribute("compression-supported", ipp.TagKeyword, "none"),
+		ipp.NewAttribute("pdl-override-supported", ipp.TagKeyword, "attempted"),
+		ipp.NewAttribute("multiple-document-jobs-supported", ipp.TagBoolean, false),
+		ipp.NewAttribute("job-creation-attributes-supported", ipp.TagKeyword,
+			"copies", "sides", "print-color-mode", "orientation-requested", "printer-resolution", "page-ranges",
+			"media", "media-col", "multiple-document-handling", "print-scaling", "page-delivery", "number-up",
+			"presentation-direction-number-up", "imposition-template"),
+	}
+	if printer.DeviceUUID != "" {
+		attrs = append(attrs, ipp.NewAttribute("printer-uuid", ipp.TagURI, "urn:uuid:"+printer.DeviceUUID))
+	}
+
+	// Documents are detected from their content, whatever format clients
+	// tell.
+	formats := []ipp.Value{"application/octet-stream"}
+	resolutions := defaultResolutions
+	if printer.Description != nil {
+		for _, a := range ipp.PrinterDescriptionToAttributes(printer.Description) {
+			switch a.Name {
+			case "document-format-supported":
+				formats = append(formats, a.Values...)
+				continue
+			case "printer-resolution-supported":
+				resolutions = a.Values
+			}
+			attrs = append(attrs, a)
+		}
+	}
+	return append(attrs,
+		ipp.NewAttribute("document-format-supported", ipp.TagMimeMediaType, formats...),
+		ipp.NewAttribute("pwg-raster-document-resolution-supported", ipp.TagResolution, resolutions...),
+		ipp.NewAttribute("pwg-raster-document-type-supported", ipp.TagKeyword, "black_1", "sgray_8", "srgb_8"),
+		ipp.NewAttribute("urf-supported", ipp.TagKeyword, urfSupported(resolutions)...))
+}
+
+// urfSupported returns the Apple raster (URF) capabilities printed at
+// resolutions.
+func urfSupported(resolutions []ipp.Value) []ipp.Value {
+	urf := []ipp.Value{"V1.4", "CP1", "W8", "SRGB24"}
+	for _, v := range resolutions {
+		urf = append(urf, fmt.Sprintf("RS%d", v.(ipp.Resolution).CrossFeed))
+	}
+	return urf
+}
+
+// ippPrinterState returns the printer-state and printer-state-reasons of a
+// printer. Offline printers are stopped.
+func ippPrinterState(printer *lib.Printer) (int32, string) {
+	if printer.Offline {
+		return 5, "offline-report"
+	}
+	if printer.State != nil {
+		if state, ok := ippPrinterStatesByType[printer.State.State]; ok {
+			return state, "none"
+		}
+	}
+	return 3, "none"
+}
+
+// filterAttributes keeps the attributes of the requested-attributes of a
+// request, all of them when it has none or asks for a group of them.
+func filterAttributes(attrs, operation ipp.Attributes) ipp.Attributes {
+	a, ok := operation.Get("requested-attributes")
+	if !ok {
+		return attrs
+	}
+	names, err := a.Strings()
+	if err != nil {
+		return attrs
+	}
+	requested := make(map[string]bool, len(names))
+	for _, name := range names {
+		switch name {
+		case "all", "printer-description", "job-template", "job-description", "job-status", "printer-status":
+			return attrs
+		}
+		requested[name] = true
+	}
+	var filtered ipp.Attributes
+	for _, a := range attrs {
+		if requested[a.Name] {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// jobTicket converts the job template attributes of a request into a
+// valid ticket.
+func jobTicket(request *ipp.Message) (*model.JobTicket, error) {
+	ticket, err := ipp.JobTicketFromAttributes(request.Group(ipp.GroupJob))
+	if err == nil {
+		err = ticket.Validate()
+	}
+	if err != nil {
+		return nil, newIPPError(ipp.StatusAttributesOrValuesNotSupported, "%s", err)
+	}
+	return ticket, nil
+}
+
+// printJob prints the document that follows a Print-Job request.
+func (s *IPPServer) printJob(r *http.Request, printer *lib.Printer, request *ipp.Message) (*ippJob, error) {
+	ticket, err := jobTicket(request)
+	if err != nil {
+		return nil, err
+	}
+	operation := request.Group(ipp.GroupOperation)
+	stringAttribute := func(names ...string) string {
+		for _, name := range names {
+			if a, ok := operation.Get(name); ok {
+				if v, err := a.StringValue(); err == nil && v != "" {
+					return v
+				}
+			}
+		}
+		return ""
+	}
+	title := stringAttribute("job-name", "document-name")
+	if title == "" {
+		title = "IPP job"
+	}
+	user := stringAttribute("requesting-user-name")
+	// Quotas and accounting count the job against the user who sent it.
+	ticket = lib.WithTicketUser(ticket, user)
+
+	dir, err := ioutil.TempDir("", "winspool-ipp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	fileName := filepath.Join(dir, "document")
+	if err = saveFile(fileName, r.Body); err != nil {
+		return nil, newIPPError(ipp.StatusBadRequest, "failed to read the document: %s", err)
+	}
+	if contentType, err := lib.DetectFileContentType(fileName); err != nil {
+		return nil, err
+	} else if contentType == "" {
+		return nil, newIPPError(ipp.StatusDocumentFormatNotSupported, "unrecognized document format")
+	}
+
+	result, err := s.Spooler.Print(printer, fileName, title, ticket)
+	if errors.Is(err, lib.ErrAccessDenied) || errors.Is(err, lib.ErrQuotaExceeded) {
+		return nil, newIPPError(ipp.StatusForbidden, "%s", err)
+	} else if errors.Is(err, lib.ErrDuplicateJob) {
+		return nil, newIPPError(ipp.StatusNotPossible, "%s", err)
+	} else if errors.Is(err, lib.ErrInvalidDocument) {
+		return nil, newIPPError(ipp.StatusDocumentFormatError, "%s", err)
+	} else if printErrorStatus(err) == http.StatusBadRequest {
+		return nil, newIPPError(ipp.StatusAttributesOrValuesNotSupported, "%s", err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	job := &ippJob{
+		printer: printer.Name,
+		id:      result.JobID,
+		name:    title,
+		user:    user,
+		created: time.Now(),
+		state:   ippJobPending,
+	}
+	s.jobsMutex.Lock()
+	if len(s.jobs) >= maxSubmittedJobs {
+		s.jobs = append(s.jobs[:0], s.jobs[1:]...)
+	}
+	s.jobs = append(s.jobs, job)
+	s.jobsMutex.Unlock()
+	return job, nil
+}
+
+func requestJobID(operation ipp.Attributes) (uint32, error) {
+	if a, ok := operation.Get("job-id"); ok {
+		id, err := a.IntValue()
+		if err != nil || id <= 0 {
+			return 0, newIPPError(ipp.StatusBadRequest, "invalid job-id")
+		}
+		return uint32(id), nil
+	}
+	if a, ok := operation.Get("job-uri"); ok {
+		uri, _ := a.StringValue()
+		var id uint32
+		if i := strings.LastIndex(uri, "/"); i >= 0 {
+			if _, err := fmt.Sscan(uri[i+1:], &id); err == nil && id > 0 {
+				return id, nil
+			}
+		}
+		return 0, newIPPError(ipp.StatusNotFound, "job %s not found", uri)
+	}
+	return 0, newIPPError(ipp.StatusBadRequest, "missing job-id")
+}
+
+// findJob returns the job submitted over IPP, nil when it wasn't. The jobs
+// mutex is held.
+func (s *IPPServer) findJob(printerName string, jobID uint32) *ippJob {
+	for _, job := range s.jobs {
+		if job.printer == printerName && job.id == jobID {
+			return job
+		}
+	}
+	return nil
+}
+
+// checkJobOwner fails unless a job was submitted over IPP by the requesting
+// user, so IPP clients can't cancel others' jobs or jobs of the spooler.
+func (s *IPPServer) checkJobOwner(printerName string, jobID uint32, operation ipp.Attributes) error {
+	var user string
+	if a, ok := operation.Get("requesting-user-name"); ok {
+		user, _ = a.StringValue()
+	}
+	s.jobsMutex.Lock()
+	defer s.jobsMutex.Unlock()
+	job := s.findJob(printerName, jobID)
+	if job == nil {
+		return newIPPError(ipp.StatusForbidden, "job %d on %s wasn't submitted over IPP", jobID, printerName)
+	}
+	if job.user != "" && job.user != user {
+		return newIPPError(ipp.StatusForbidden, "job %d on %s belongs to %s", jobID, printerName, job.user)
+	}
+	return nil
+}
+
+// jobState returns a job, with its state read from the spooler, including
+// jobs that weren't submitted over IPP.
+func (s *IPPServer) jobState(printerName string, jobID uint32) (*ippJob, error) {
+	s.jobsMutex.Lock()
+	job := s.findJob(printerName, jobID)
+	var copied ippJob
+	if job != nil {
+		copied = *job
+	}
+	s.jobsMutex.Unlock()
+	if job != nil && copied.completed() {
+		return &copied, nil
+	}
+
+	state, err := s.Spooler.GetJobState(printerName, jobID)
+	if err != nil || jobGone(state) {
+		if job == nil {
+			return nil, newIPPError(ipp.StatusNotFound, "job %d not found on %s", jobID, printerName)
+		}
+		// Deleted from the queue once printed.
+		copied.state = ippJobCompleted
+	} else if state.State != nil {
+		copied.state = ippJobStatesByType[state.State.Type]
+		if state.State.Type == model.JobStateAborted && state.State.UserActionCause != nil {
+			copied.state = ippJobCanceled
+		}
+	}
+	if job == nil {
+		copied.printer, copied.id = printerName, jobID
+		return &copied, nil
+	}
+	s.jobsMutex.Lock()
+	job.state = copied.state
+	s.jobsMutex.Unlock()
+	return &copied, nil
+}
+
+// jobGone tells whether a job state is that of a job no longer in the
+// spooler: aborted for no other cause, without the counts of a spooled job.
+func jobGone(state *model.PrintJobStateDiff) bool {
+	if state.State == nil || state.State.Type != model.JobStateAborted || state.PagesPrinted != nil {
+		return false
+	}
+	cause := state.State.DeviceActionCause
+	return state.State.UserActionCause == nil && cause != nil && cause.ErrorCode == model.DeviceActionCauseOther
+}
+
+// getJobs lists the jobs submitted over IPP to a printer, newest first:
+// those not completed, unless which-jobs is "completed" or "all".
+func (s *IPPServer) getJobs(printerName, printerURI string, operation ipp.Attributes) ([]ipp.Group, error) {
+	which := "not-completed"
+	if a, ok := operation.Get("which-jobs"); ok {
+		which, _ = a.StringValue()
+	}
+	if which != "not-completed" && which != "completed" && which != "all" {
+		return nil, newIPPError(ipp.StatusAttributesOrValuesNotSupported, "which-jobs %s is not supported", which)
+	}
+	var user string
+	if a, ok := operation.Get("my-jobs"); ok {
+		if mine, _ := a.BoolValue(); mine {
+			if a, ok := operation.Get("requesting-user-name"); ok {
+				user, _ = a.StringValue()
+			}
+		}
+	}
+	limit := int32(-1)
+	if a, ok := operation.Get("limit"); ok {
+		limit, _ = a.IntValue()
+	}
+
+	s.jobsMutex.Lock()
+	var ids []uint32
+	for i := len(s.jobs) - 1; i >= 0; i-- {
+		if job := s.jobs[i]; job.printer == printerName && (user == "" || job.user == user) {
+			ids = append(ids, job.id)
+		}
+	}
+	s.jobsMutex.Unlock()
+
+	var groups []ipp.Group
+	for _, id := range ids {
+		if limit >= 0 && int32(len(groups)) >= limit {
+			break
+		}
+		job, err := s.jobState(printerName, id)
+		if err != nil {
+			continue
+		}
+		if which == "not-completed" && job.completed() || which == "completed" && !job.completed() {
+			continue
+		}
+		groups = append(groups, ipp.Group{Tag: ipp.GroupJob, Attributes: filterAttributes(jobAttributes(job, printerURI), operation)})
+	}
+	return groups, nil
+}
+
+func jobAttributes(job *ippJob, printerURI string) ipp.Attributes {
+	reason, ok := ippJobStateReasons[job.state]
+	if !ok {
+		reason = "none"
+	}
+	attrs := ipp.Attributes{
+		ipp.NewAttribute("job-id", ipp.TagInteger, int32(job.id)),
+		ipp.NewAttribute("job-uri", ipp.TagURI, fmt.Sprintf("%s/jobs/%d", printerURI, job.id)),
+		ipp.NewAttribute("job-printer-uri", ipp.TagURI, printerURI),
+		ipp.NewAttribute("job-state", ipp.TagEnum, job.state),
+		ipp.NewAttribute("job-state-reasons", ipp.TagKeyword, reason),
+	}
+	if job.name != "" {
+		attrs = append(attrs, ipp.NewAttribute("job-name", ipp.TagName, job.name))
+	}
+	if job.user != "" {
+		attrs = append(attrs, ipp.NewAttribute("job-originating-user-name", ipp.TagName, job.user))
+	}
+	if !job.created.IsZero() {
+		attrs = append(attrs, ipp.NewAttribute("date-time-at-creation", ipp.TagDateTime, job.created))
+	}
+	return attrs
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/model/ipp"
+)
+
+func TestIPPServer(t *testing.T) {
+	spooler := &testSpooler{}
+	s := &Server{
+		Printers: testPrinters{{Name: "office", Manufacturer: "HP", Model: "LaserJet", Description: &model.PrinterDescriptionSection{
+			SupportedContentType: &[]model.SupportedContentType{{ContentType: "application/pdf"}},
+			Copies:               &model.Copies{Default: 1, Max: 9},
+			MediaSize: &model.MediaSize{Option: []model.MediaSizeOption{
+				{WidthMicrons: 215900, HeightMicrons: 279400},
+				{WidthMicrons: 210000, HeightMicrons: 297000, IsDefault: true},
+			}},
+		}}},
+		Spooler: spooler,
+	}
+	s.IPP = &IPPServer{Printers: s.Printers, Spooler: spooler}
+
+	do := func(path string, code uint16, operation, job ipp.Attributes, document string) *ipp.Message {
+		t.Helper()
+		request := &ipp.Message{Version: 0x0200, Code: code, RequestID: 3}
+		request.AddGroup(ipp.GroupOperation, append(ipp.Attributes{
+			ipp.NewAttribute("attributes-charset", ipp.TagCharset, "utf-8"),
+			ipp.NewAttribute("attributes-natural-language", ipp.TagNaturalLanguage, "en"),
+			ipp.NewAttribute("printer-uri", ipp.TagURI, "ipp://example.com"+path),
+		}, operation...))
+		if job != nil {
+			request.AddGroup(ipp.GroupJob, job)
+		}
+		var body bytes.Buffer
+		if err := request.Encode(&body); err != nil {
+			t.Fatal(err)
+		}
+		body.WriteString(document)
+		r := httptest.NewRequest(http.MethodPost, path, &body)
+		r.Host = "example.com"
+		r.Header.Set("Content-Type", "application/ipp")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected HTTP 200 got %d: %s", w.Code, w.Body)
+		}
+		response, err := ipp.DecodeMessage(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.RequestID != 3 {
+			t.Errorf("expected request ID 3 got %d", response.RequestID)
+		}
+		return response
+	}
+
+	m := do("/ipp/print/office", ipp.OpGetPrinterAttributes, ipp.Attributes{
+		ipp.NewAttribute("requested-attributes", ipp.TagKeyword, "printer-uri-supported", "document-format-supported", "copies-supported"),
+	}, nil, "")
+	printer := m.Group(ipp.GroupPrinter)
+	if len(printer) != 3 {
+		t.Errorf("expected the 3 requested attributes got %+v", printer)
+	}
+	if a, _ := printer.Get("printer-uri-supported"); len(a.Values) != 1 || a.Values[0] != "ipp://example.com/ipp/print/office" {
+		t.Errorf("unexpected printer-uri-supported %+v", a)
+	}
+	if a, _ := printer.Get("document-format-supported"); len(a.Values) != 2 || a.Values[1] != "application/pdf" {
+		t.Errorf("unexpected document-format-supported %+v", a)
+	}
+	if a, _ := printer.Get("copies-supported"); len(a.Values) != 1 || a.Values[0] != (ipp.Range{Lower: 1, Upper: 9}) {
+		t.Errorf("unexpected copies-supported %+v", a)
+	}
+
+	m = do("/ipp/print/office", ipp.OpGetPrinterAttributes, ipp.Attributes{
+		ipp.NewAttribute("requested-attributes", ipp.TagKeyword, "media-supported", "media-default"),
+	}, nil, "")
+	printer = m.Group(ipp.GroupPrinter)
+	if a, _ := printer.Get("media-supported"); len(a.Values) != 2 || a.Values[0] != "na_letter_8.5x11in" || a.Values[1] != "iso_a4_210x297mm" {
+		t.Errorf("unexpected media-supported %+v", a)
+	}
+	if a, _ := printer.Get("media-default"); len(a.Values) != 1 || a.Values[0] != "iso_a4_210x297mm" {
+		t.Errorf("unexpected media-default %+v", a)
+	}
+
+	m = do("/ipp/print/office", ipp.OpPrintJob, ipp.Attributes{
+		ipp.NewAttribute("requesting-user-name", ipp.TagName, "bob"),
+		ipp.NewAttribute("job-name", ipp.TagName, "invoice"),
+	}, ipp.Attributes{ipp.NewAttribute("copies", ipp.TagInteger, int32(2))}, "%PDF-1.4\n")
+	if m.Code != ipp.StatusOK {
+		t.Fatalf("expected Print-Job to succeed got %#04x", m.Code)
+	}
+	if string(spooler.document) != "%PDF-1.4\n" || spooler.title != "invoice" || spooler.ticket.Copies == nil || spooler.ticket.Copies.Copies != 2 {
+		t.Errorf("unexpected job %q %s %+v", spooler.document, spooler.title, spooler.ticket)
+	}
+	if user := lib.TicketUser(spooler.ticket); user != "bob" {
+		t.Errorf("expected the job submitted for bob got %q", user)
+	}
+	if a, _ := m.Group(ipp.GroupJob).Get("job-uri"); len(a.Values) != 1 || a.Values[0] != "ipp://example.com/ipp/print/office/jobs/7" {
+		t.Errorf("unexpected job-uri %+v", a)
+	}
+
+	m = do("/ipp/print/office", ipp.OpGetJobs, ipp.Attributes{
+		ipp.NewAttribute("requesting-user-name", ipp.TagName, "bob"),
+		ipp.NewAttribute("my-jobs", ipp.TagBoolean, true),
+	}, nil, "")
+	if len(m.Groups) != 2 {
+		t.Fatalf("expected one job got %+v", m.Groups)
+	}
+	if a, _ := m.Groups[1].Attributes.Get("job-state"); a.Values[0] != int32(5) {
+		t.Errorf("expected a processing job got %+v", a)
+	}
+
+	// Printed jobs leave the spooler, which then reports them aborted.
+	spooler.finish(7)
+	m = do("/ipp/print/office", ipp.OpGetJobAttributes, ipp.Attributes{ipp.NewAttribute("job-id", ipp.TagInteger, int32(7))}, nil, "")
+	if a, _ := m.Group(ipp.GroupJob).Get("job-state"); m.Code != ipp.StatusOK || len(a.Values) != 1 || a.Values[0] != int32(9) {
+		t.Errorf("expected job 7 completed once out of the queue got %#04x, %+v", m.Code, a)
+	}
+	m = do("/ipp/print/office", ipp.OpGetJobAttributes, ipp.Attributes{ipp.NewAttribute("job-id", ipp.TagInteger, int32(8))}, nil, "")
+	if m.Code != ipp.StatusNotFound {
+		t.Errorf("expected unknown job 8 not found got %#04x", m.Code)
+	}
+
+	// Only the user who submitted a job over IPP cancels it.
+	for _, attributes := range []ipp.Attributes{
+		{ipp.NewAttribute("job-id", ipp.TagInteger, int32(7)), ipp.NewAttribute("requesting-user-name", ipp.TagName, "eve")},
+		{ipp.NewAttribute("job-id", ipp.TagInteger, int32(9)), ipp.NewAttribute("requesting-user-name", ipp.TagName, "bob")},
+	} {
+		if m = do("/ipp/print/office", ipp.OpCancelJob, attributes, nil, ""); m.Code != ipp.StatusForbidden || spooler.cancelled != 0 {
+			t.Errorf("expected cancel %+v forbidden got %#04x, %d", attributes, m.Code, spooler.cancelled)
+		}
+	}
+	m = do("/ipp/print/office", ipp.OpCancelJob, ipp.Attributes{ipp.NewAttribute("job-id", ipp.TagInteger, int32(7)), ipp.NewAttribute("requesting-user-name", ipp.TagName, "bob")}, nil, "")
+	if m.Code != ipp.StatusOK || spooler.cancelled != 7 {
+		t.Errorf("expected job 7 canceled got %#04x, %d", m.Code, spooler.cancelled)
+	}
+	// Denied for other reasons than lacking administrator rights.
+	spooler.cancelErr = fmt.Errorf("job 7: %w", lib.ErrAccessDenied)
+	m = do("/ipp/print/office", ipp.OpCancelJob, ipp.Attributes{ipp.NewAttribute("job-id", ipp.TagInteger, int32(7)), ipp.NewAttribute("requesting-user-name", ipp.TagName, "bob")}, nil, "")
+	if m.Code != ipp.StatusForbidden {
+		t.Errorf("expected a denied cancel forbidden got %#04x", m.Code)
+	}
+	spooler.cancelErr = nil
+	m = do("/ipp/print/office", ipp.OpGetJobs, nil, nil, "")
+	if len(m.Groups) != 1 {
+		t.Errorf("expected no job not completed got %+v", m.Groups)
+	}
+
+	for name, c := range map[string]struct {
+		path     string
+		code     uint16
+		job      ipp.Attributes
+		document string
+		status   uint16
+	}{
+		"unknown printer":  {"/ipp/print/lab", ipp.OpGetPrinterAttributes, nil, "", ipp.StatusNotFound},
+		"invalid ticket":   {"/ipp/print/office", ipp.OpValidateJob, ipp.Attributes{ipp.NewAttribute("copies", ipp.TagInteger, int32(0))}, "", ipp.StatusAttributesOrValuesNotSupported},
+		"unknown document": {"/ipp/print/office", ipp.OpPrintJob, nil, "\x00\x01\x02", ipp.StatusDocumentFormatNotSupported},
+		"unknown op":       {"/ipp/print/office", 0x0010, nil, "", ipp.StatusOperationNotSupported},
+	} {
+		if m := do(c.path, c.code, nil, c.job, c.document); m.Code != c.status {
+			t.Errorf("%s: expected status %#04x got %#04x", name, c.status, m.Code)
+		}
+	}
+}
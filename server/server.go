@@ -0,0 +1,620 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+// Package server exposes printers and job submission over HTTP, so that
+// Windows printing can be driven from other hosts.
+package server
+
+import (
+	"archive/zip"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// DefaultMaxUploadSize limits the size of submitted documents.
+const DefaultMaxUploadSize = 64 << 20
+
+// Submitted jobs kept for GET /jobs.
+const maxSubmittedJobs = 1000
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+// Printers looks up printers; manager.PrinterManager implements it.
+type Printers interface {
+	GetPrinter(name string) (lib.Printer, bool)
+	GetPrinters() []lib.Printer
+}
+
+// Spooler prints and controls jobs; winspool.WinSpool implements it.
+type Spooler interface {
+	Print(printer *lib.Printer, fileName, title string, ticket *model.JobTicket) (*lib.PrintResult, error)
+	GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error)
+	CancelJob(printerName string, jobID uint32) error
+}
+
+// Proofer renders documents as the Spooler would print them, into files;
+// winspool.WinSpool implements it. Proofs are not found when the Spooler
+// doesn't.
+type Proofer interface {
+	Proof(printer *lib.Printer, fileName string, ticket *model.JobTicket, format lib.ProofFormat, outPath string) (*lib.PrintResult, error)
+}
+
+// Releaser releases held jobs with the PIN they were held with;
+// winspool.WinSpool implements it. Releases are not found when the Spooler
+// doesn't.
+type Releaser interface {
+	ReleaseHeldJob(printerName string, jobID uint32, pin string) error
+}
+
+// EventRoutes are the routes print system events are posted to;
+// manager.EventRouter implements it.
+type EventRoutes interface {
+	Routes() []lib.EventRoute
+	SetRoute(route lib.EventRoute) error
+	DeleteRoute(name string) bool
+}
+
+// Server handles the REST API:
+//
+//	GET    /printers                       printers
+//	GET    /printers/{name}                printer, with capabilities
+//	GET    /printers/{name}/capabilities   capabilities only
+//	POST   /printers/{name}/jobs           submit a job, multipart "file" and optional "ticket" and "title"
+//	GET    /printers/{name}/jobs/{id}      job state
+//	DELETE /printers/{name}/jobs/{id}      cancel a job
+//	POST   /printers/{name}/jobs/{id}/release  release a held job, JSON {"pin": "..."}
+//	POST   /printers/{name}/proof?format=  render a job as it would print, without printing it: a PDF,
+//	                                       or a zip of a PNG per sheet side with format=png
+//	GET    /printers/{name}/jobs           queued jobs, when Jobs is set
+//	GET    /jobs?q=text                    jobs submitted through the server, newest first
+//	GET    /metrics                        printer metrics, when Metrics is set
+//	GET    /events/routes                  event routes, when EventRoutes is set
+//	PUT    /events/routes/{name}           add or replace an event route
+//	DELETE /events/routes/{name}           delete an event route
+//	GET    /ui/                            web dashboard over the API
+//	POST   /ipp/print/{name}               IPP requests, when IPP is set
+type Server struct {
+	Printers Printers
+	Spooler  Spooler
+
+	// Returns printer metrics; /metrics is not found when nil.
+	Metrics func() interface{}
+	// Returns the jobs queued on a printer; listing them is not allowed
+	// when nil.
+	Jobs func(printerName string) (interface{}, error)
+
+	// Limits the size of submitted documents; DefaultMaxUploadSize when zero.
+	MaxUploadSize int64
+	// Parse tickets strictly, rejecting unknown fields and invalid values.
+	StrictTickets bool
+
+	// Templates jobs can be submitted with instead of a file, by name.
+	Templates map[string]*lib.DocumentTemplate
+	// Serves printers over IPP; /ipp is not found when nil.
+	IPP *IPPServer
+	// Event routes changed at /events/routes; not found when nil.
+	EventRoutes EventRoutes
+
+	submittedMutex sync.Mutex
+	submitted      []SubmittedJob
+}
+
+// SubmittedJob is a job submitted through the server.
+type SubmittedJob struct {
+	Printer   string    `json:"printer"`
+	JobID     uint32    `json:"job_id"`
+	Title     string    `json:"title"`
+	Pages     int       `json:"pages"`
+	Submitted time.Time `json:"submitted"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write HTTP response: %s", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	writeJSON(w, status, errorResponse{Error: fmt.Sprintf(format, a...)})
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && crossOrigin(r) {
+		writeError(w, http.StatusForbidden, "%s requests from %s are not allowed", r.Method, r.Header.Get("Origin"))
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.URL.Path == "/":
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	case parts[0] == "ui":
+		dashboard, _ := fs.Sub(dashboardFiles, "dashboard")
+		http.StripPrefix("/ui", http.FileServer(http.FS(dashboard))).ServeHTTP(w, r)
+	case len(parts) == 1 && parts[0] == "printers":
+		s.allow(w, r, http.MethodGet, s.listPrinters)
+	case len(parts) == 1 && parts[0] == "jobs":
+		s.allow(w, r, http.MethodGet, s.listSubmittedJobs)
+	case len(parts) == 1 && parts[0] == "metrics" && s.Metrics != nil:
+		s.allow(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, s.Metrics())
+		})
+	case len(parts) >= 2 && parts[0] == "events" && parts[1] == "routes" && s.EventRoutes != nil:
+		s.serveEventRoutes(w, r, parts[2:])
+	case parts[0] == "ipp" && s.IPP != nil:
+		s.IPP.ServeHTTP(w, r)
+	case len(parts) >= 2 && parts[0] == "printers":
+		printer, exists := s.Printers.GetPrinter(parts[1])
+		if !exists {
+			writeError(w, http.StatusNotFound, "printer %s not found", parts[1])
+			return
+		}
+		s.servePrinter(w, r, &printer, parts[2:])
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+}
+
+// crossOrigin reports whether a browser sent the request from a page of
+// another origin, as any web page the user opens can, to submit jobs to
+// localhost. Other clients send no Origin.
+func crossOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || u.Host != r.Host
+}
+
+func (s *Server) servePrinter(w http.ResponseWriter, r *http.Request, printer *lib.Printer, parts []string) {
+	switch {
+	case len(parts) == 0:
+		s.allow(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, printer)
+		})
+	case len(parts) == 1 && parts[0] == "capabilities":
+		s.allow(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, printer.Description)
+		})
+	case len(parts) == 1 && parts[0] == "jobs":
+		switch {
+		case r.Method == http.MethodGet && s.Jobs != nil:
+			jobs, err := s.Jobs(printer.Name)
+			if err != nil {
+				writeError(w, spoolerErrorStatus(err), "%s", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, jobs)
+		default:
+			s.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+				s.submitJob(w, r, printer)
+			})
+		}
+	case len(parts) == 1 && parts[0] == "proof":
+		proofer, ok := s.Spooler.(Proofer)
+		if !ok {
+			writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+			return
+		}
+		s.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.proofJob(w, r, printer, proofer)
+		})
+	case len(parts) == 2 && parts[0] == "jobs":
+		jobID, err := strconv.ParseUint(parts[1], 10, 32)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "job %s not found", parts[1])
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			state, err := s.Spooler.GetJobState(printer.Name, uint32(jobID))
+			if err != nil {
+				writeError(w, spoolerErrorStatus(err), "%s", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, state)
+		case http.MethodDelete:
+			if err := s.Spooler.CancelJob(printer.Name, uint32(jobID)); err != nil {
+				writeError(w, spoolerErrorStatus(err), "%s", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+	case len(parts) == 3 && parts[0] == "jobs" && parts[2] == "release":
+		releaser, ok := s.Spooler.(Releaser)
+		jobID, err := strconv.ParseUint(parts[1], 10, 32)
+		if !ok || err != nil {
+			writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+			return
+		}
+		s.allow(w, r, http.MethodPost, func(w http.ResponseWriter, r *http.Request) {
+			s.releaseJob(w, r, printer, uint32(jobID), releaser)
+		})
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+}
+
+// releaseJob releases a held job with its PIN. The PIN is required, as
+// anyone reaching the server could otherwise release jobs like an operator.
+func (s *Server) releaseJob(w http.ResponseWriter, r *http.Request, printer *lib.Printer, jobID uint32, releaser Releaser) {
+	var request struct {
+		PIN string `json:"pin"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, 1<<10)).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request: %s", err)
+		return
+	}
+	if request.PIN == "" {
+		writeError(w, http.StatusBadRequest, "missing pin")
+		return
+	}
+	err := releaser.ReleaseHeldJob(printer.Name, jobID, request.PIN)
+	switch {
+	case errors.Is(err, lib.ErrWrongPIN):
+		writeError(w, http.StatusForbidden, "%s", err)
+	case errors.Is(err, lib.ErrJobNotHeld):
+		writeError(w, http.StatusNotFound, "%s", err)
+	case err != nil:
+		writeError(w, spoolerErrorStatus(err), "%s", err)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) serveEventRoutes(w http.ResponseWriter, r *http.Request, parts []string) {
+	switch {
+	case len(parts) == 0:
+		s.allow(w, r, http.MethodGet, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, http.StatusOK, s.EventRoutes.Routes())
+		})
+	case len(parts) == 1:
+		switch r.Method {
+		case http.MethodPut:
+			var route lib.EventRoute
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, DefaultMaxUploadSize)).Decode(&route); err != nil {
+				writeError(w, http.StatusBadRequest, "invalid event route: %s", err)
+				return
+			}
+			route.Name = parts[0]
+			if err := s.EventRoutes.SetRoute(route); err != nil {
+				writeError(w, http.StatusBadRequest, "%s", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, route)
+		case http.MethodDelete:
+			if !s.EventRoutes.DeleteRoute(parts[0]) {
+				writeError(w, http.StatusNotFound, "event route %s not found", parts[0])
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "PUT, DELETE")
+			writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		}
+	default:
+		writeError(w, http.StatusNotFound, "%s not found", r.URL.Path)
+	}
+}
+
+func (s *Server) allow(w http.ResponseWriter, r *http.Request, method string, handler http.HandlerFunc) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeError(w, http.StatusMethodNotAllowed, "method %s not allowed", r.Method)
+		return
+	}
+	handler(w, r)
+}
+
+func (s *Server) listPrinters(w http.ResponseWriter, r *http.Request) {
+	printers := s.Printers.GetPrinters()
+	sort.Slice(printers, func(i, j int) bool { return printers[i].Name < printers[j].Name })
+	writeJSON(w, http.StatusOK, printers)
+}
+
+// listSubmittedJobs lists the jobs submitted through the server, filtered
+// by ?q=, which matches the printer or title case-insensitively.
+func (s *Server) listSubmittedJobs(w http.ResponseWriter, r *http.Request) {
+	query := strings.ToLower(r.URL.Query().Get("q"))
+
+	s.submittedMutex.Lock()
+	defer s.submittedMutex.Unlock()
+	jobs := []SubmittedJob{}
+	for i := len(s.submitted) - 1; i >= 0; i-- {
+		job := s.submitted[i]
+		if query == "" || strings.Contains(strings.ToLower(job.Printer), query) || strings.Contains(strings.ToLower(job.Title), query) {
+			jobs = append(jobs, job)
+		}
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (s *Server) recordSubmitted(job SubmittedJob) {
+	s.submittedMutex.Lock()
+	defer s.submittedMutex.Unlock()
+	if len(s.submitted) >= maxSubmittedJobs {
+		s.submitted = append(s.submitted[:0], s.submitted[1:]...)
+	}
+	s.submitted = append(s.submitted, job)
+}
+
+func (s *Server) submitJob(w http.ResponseWriter, r *http.Request, printer *lib.Printer) {
+	dir, err := ioutil.TempDir("", "winspool-job")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fileName, title, ticket, ok := s.readJob(w, r, dir)
+	if !ok {
+		return
+	}
+
+	result, err := s.Spooler.Print(printer, fileName, title, ticket)
+	if err != nil {
+		writeError(w, printErrorStatus(err), "%s", err)
+		return
+	}
+	s.recordSubmitted(SubmittedJob{Printer: printer.Name, JobID: result.JobID, Title: title, Pages: result.Pages, Submitted: time.Now()})
+	writeJSON(w, http.StatusCreated, result)
+}
+
+// proofJob renders a job submitted as to submitJob, and replies with the
+// proof. Warnings about the ticket are in the X-Print-Warnings header, as
+// JSON.
+func (s *Server) proofJob(w http.ResponseWriter, r *http.Request, printer *lib.Printer, proofer Proofer) {
+	format := lib.ProofFormat(r.URL.Query().Get("format"))
+	switch format {
+	case "":
+		format = lib.ProofFormatPDF
+	case lib.ProofFormatPDF, lib.ProofFormatPNG:
+	default:
+		writeError(w, http.StatusBadRequest, "format %s not supported, expected pdf or png", format)
+		return
+	}
+
+	dir, err := ioutil.TempDir("", "winspool-proof")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "%s", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	fileName, title, ticket, ok := s.readJob(w, r, dir)
+	if !ok {
+		return
+	}
+
+	result, err := proofer.Proof(printer, fileName, ticket, format, filepath.Join(dir, "proof."+string(format)))
+	if err != nil {
+		writeError(w, printErrorStatus(err), "%s", err)
+		return
+	}
+	if len(result.Warnings) > 0 {
+		warnings, _ := json.Marshal(result.Warnings)
+		w.Header().Set("X-Print-Warnings", string(warnings))
+	}
+	base := strings.TrimSuffix(title, filepath.Ext(title))
+	if format == lib.ProofFormatPDF {
+		if len(result.ProofFiles) == 0 {
+			writeError(w, http.StatusBadRequest, "no pages to proof")
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", base+"-proof.pdf"))
+		f, err := os.Open(result.ProofFiles[0])
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "%s", err)
+			return
+		}
+		defer f.Close()
+		io.Copy(w, f)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", base+"-proof.zip"))
+	z := zip.NewWriter(w)
+	for _, fileName := range result.ProofFiles {
+		if err := addZipFile(z, fileName); err != nil {
+			// Too late for an error response.
+			log.Printf("Failed to write proof of %s: %s", title, err)
+			return
+		}
+	}
+	if err := z.Close(); err != nil {
+		log.Printf("Failed to write proof of %s: %s", title, err)
+	}
+}
+
+// printErrorStatus returns the status of a failed job: a bad request for
+// invalid tickets, a DEVMODE of another driver, or documents that fail
+// preflight, forbidden for jobs over quota, a conflict for duplicate jobs,
+// and else the status of spoolerErrorStatus.
+func printErrorStatus(err error) int {
+	var ticketErr *model.TicketError
+	var rangeErr *model.RangeError
+	if errors.As(err, &ticketErr) || errors.As(err, &rangeErr) || errors.Is(err, lib.ErrDriverMismatch) || errors.Is(err, lib.ErrInvalidDocument) {
+		return http.StatusBadRequest
+	}
+	if errors.Is(err, lib.ErrQuotaExceeded) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, lib.ErrDuplicateJob) {
+		return http.StatusConflict
+	}
+	return spoolerErrorStatus(err)
+}
+
+// spoolerErrorStatus returns the status of a failed spooler operation, by
+// the kind of failure: not found for printers and jobs that don't exist,
+// forbidden when access is denied, unavailable while the spooler service
+// doesn't answer, and else an internal error.
+func spoolerErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, lib.ErrPrinterNotFound), errors.Is(err, lib.ErrJobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, lib.ErrAccessDenied):
+		return http.StatusForbidden
+	case errors.Is(err, lib.ErrSpoolerUnavailable):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func addZipFile(z *zip.Writer, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := z.Create(filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// readJob reads the document, ticket and title of a multipart/form-data
+// job into dir, with the document filled in from a template when one is
+// named. An error is written when it returns false.
+func (s *Server) readJob(w http.ResponseWriter, r *http.Request, dir string) (fileName, title string, ticket *model.JobTicket, ok bool) {
+	maxSize := s.MaxUploadSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxUploadSize
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data body: %s", err)
+		return
+	}
+
+	var templateName string
+	var templateData []byte
+	ticket = &model.JobTicket{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			writeError(w, http.StatusBadRequest, "failed to read the body: %s", err)
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			title = part.FileName()
+			fileName = filepath.Join(dir, "document")
+			err = saveFile(fileName, part)
+		case "ticket":
+			var body []byte
+			if body, err = ioutil.ReadAll(part); err == nil {
+				ticket, err = model.ParseJobTicket(body, model.ParseJobTicketOptions{Strict: s.StrictTickets})
+			}
+		case "title":
+			var body []byte
+			if body, err = ioutil.ReadAll(part); err == nil {
+				title = string(body)
+			}
+		case "template":
+			var body []byte
+			if body, err = ioutil.ReadAll(part); err == nil {
+				templateName = string(body)
+			}
+		case "data":
+			templateData, err = ioutil.ReadAll(part)
+		}
+		part.Close()
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid %s: %s", part.FormName(), err)
+			return
+		}
+	}
+	if templateName != "" {
+		if fileName != "" {
+			writeError(w, http.StatusBadRequest, "expected a file or a template, not both")
+			return
+		}
+		if title == "" {
+			title = templateName
+		}
+		fileName = filepath.Join(dir, "document")
+		if err = writeTemplate(fileName, s.Templates[templateName], templateName, templateData); err != nil {
+			writeError(w, http.StatusBadRequest, "%s", err)
+			return
+		}
+	}
+	if fileName == "" {
+		writeError(w, http.StatusBadRequest, "missing file")
+		return
+	}
+	if title == "" {
+		title = "document"
+	}
+	return fileName, title, ticket, true
+}
+
+// writeTemplate fills in a template with JSON data, and saves the layout.
+func writeTemplate(fileName string, t *lib.DocumentTemplate, name string, data []byte) error {
+	if t == nil {
+		return fmt.Errorf("template %s not found", name)
+	}
+	var v interface{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return fmt.Errorf("invalid data: %s", err)
+		}
+	}
+	document, err := t.Execute(v)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, document, 0600)
+}
+
+func saveFile(fileName string, src io.Reader) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(f, src); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
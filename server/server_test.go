@@ -0,0 +1,366 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/manager"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+type testPrinters []lib.Printer
+
+func (p testPrinters) GetPrinter(name string) (lib.Printer, bool) {
+	for _, printer := range p {
+		if printer.Name == name {
+			return printer, true
+		}
+	}
+	return lib.Printer{}, false
+}
+
+func (p testPrinters) GetPrinters() []lib.Printer {
+	return append([]lib.Printer{}, p...)
+}
+
+type testSpooler struct {
+	document  []byte
+	title     string
+	ticket    *model.JobTicket
+	cancelled uint32
+	cancelErr error
+	released  uint32
+	// Jobs in the queue, which leave it once printed with finish.
+	spooled map[uint32]bool
+}
+
+func (s *testSpooler) Print(printer *lib.Printer, fileName, title string, ticket *model.JobTicket) (*lib.PrintResult, error) {
+	document, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	s.document, s.title, s.ticket = document, title, ticket
+	if s.spooled == nil {
+		s.spooled = map[uint32]bool{}
+	}
+	s.spooled[7] = true
+	return &lib.PrintResult{JobID: 7, JobIDs: []uint32{7}, Pages: 1}, nil
+}
+
+// GetJobState reports jobs no longer in the queue as WinSpool does, aborted
+// without an error.
+func (s *testSpooler) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
+	if !s.spooled[jobID] {
+		return &model.PrintJobStateDiff{State: &model.JobState{
+			Type:              model.JobStateAborted,
+			DeviceActionCause: &model.DeviceActionCause{ErrorCode: model.DeviceActionCauseOther},
+		}}, nil
+	}
+	pagesPrinted := int32(0)
+	return &model.PrintJobStateDiff{State: &model.JobState{Type: model.JobStateInProgress}, PagesPrinted: &pagesPrinted}, nil
+}
+
+// finish prints a job, which leaves the queue.
+func (s *testSpooler) finish(jobID uint32) {
+	delete(s.spooled, jobID)
+}
+
+func (s *testSpooler) Proof(printer *lib.Printer, fileName string, ticket *model.JobTicket, format lib.ProofFormat, outPath string) (*lib.PrintResult, error) {
+	result := &lib.PrintResult{Pages: 2, Warnings: []lib.PrintWarning{{Option: "color", Reason: lib.PrintWarningUnsupported}}}
+	if format == lib.ProofFormatPDF {
+		result.ProofFiles = []string{outPath}
+	} else {
+		result.ProofFiles = []string{lib.ProofPageFileName(outPath, 1), lib.ProofPageFileName(outPath, 2)}
+	}
+	for _, name := range result.ProofFiles {
+		if err := ioutil.WriteFile(name, []byte(filepath.Base(name)), 0600); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+func (s *testSpooler) CancelJob(printerName string, jobID uint32) error {
+	s.cancelled = jobID
+	return s.cancelErr
+}
+
+func (s *testSpooler) ReleaseHeldJob(printerName string, jobID uint32, pin string) error {
+	if pin != "4711" {
+		return fmt.Errorf("%w for job %d on %s", lib.ErrWrongPIN, jobID, printerName)
+	}
+	s.released = jobID
+	return nil
+}
+
+func multipartBody(t *testing.T, fields map[string]string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for name, value := range fields {
+		var err error
+		if name == "file" {
+			var part io.Writer
+			part, err = w.CreateFormFile("file", "invoice.pdf")
+			if err == nil {
+				_, err = part.Write([]byte(value))
+			}
+		} else {
+			err = w.WriteField(name, value)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	return &body, w.FormDataContentType()
+}
+
+func TestServer(t *testing.T) {
+	spooler := &testSpooler{}
+	note, err := lib.ParseDocumentTemplate("delivery-note", ".layout\nTotal {{cell .total}}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Printers:  testPrinters{{Name: "office", Description: &model.PrinterDescriptionSection{Copies: &model.Copies{Max: 9}}}},
+		Spooler:   spooler,
+		Templates: map[string]*lib.DocumentTemplate{"delivery-note": note},
+	}
+	do := func(method, path string, body *bytes.Buffer, contentType string) *httptest.ResponseRecorder {
+		if body == nil {
+			body = &bytes.Buffer{}
+		}
+		r := httptest.NewRequest(method, path, body)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := do("GET", "/printers", nil, ""); w.Code != http.StatusOK {
+		t.Errorf("list printers: %d %s", w.Code, w.Body)
+	}
+	if w := do("GET", "/printers/missing", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for missing printer got %d", w.Code)
+	}
+	w := do("GET", "/printers/office/capabilities", nil, "")
+	var description model.PrinterDescriptionSection
+	if err := json.Unmarshal(w.Body.Bytes(), &description); err != nil || description.Copies == nil || description.Copies.Max != 9 {
+		t.Errorf("unexpected capabilities %s", w.Body)
+	}
+
+	body, contentType := multipartBody(t, map[string]string{
+		"file":   "%PDF-1.4",
+		"ticket": `{"copies": {"copies": 2}}`,
+	})
+	w = do("POST", "/printers/office/jobs", body, contentType)
+	var result lib.PrintResult
+	if err := json.Unmarshal(w.Body.Bytes(), &result); w.Code != http.StatusCreated || err != nil || result.JobID != 7 {
+		t.Fatalf("submit job: %d %s", w.Code, w.Body)
+	}
+	if string(spooler.document) != "%PDF-1.4" || spooler.title != "invoice.pdf" || spooler.ticket.Copies.Copies != 2 {
+		t.Errorf("job not submitted as sent: %q %q %+v", spooler.document, spooler.title, spooler.ticket)
+	}
+
+	spooler.title = ""
+	body, contentType = multipartBody(t, map[string]string{"template": "delivery-note", "data": `{"total": "9.99"}`})
+	if w = do("POST", "/printers/office/jobs", body, contentType); w.Code != http.StatusCreated {
+		t.Fatalf("submit template job: %d %s", w.Code, w.Body)
+	}
+	if string(spooler.document) != ".layout\nTotal 9.99\n" || spooler.title != "delivery-note" {
+		t.Errorf("expected the filled in delivery note got %q %q", spooler.document, spooler.title)
+	}
+	for _, fields := range []map[string]string{
+		{"template": "missing"},
+		{"template": "delivery-note", "data": `{"total": `},
+		{"template": "delivery-note", "data": `{}`},
+		{"template": "delivery-note", "file": "%PDF-1.4"},
+	} {
+		body, contentType = multipartBody(t, fields)
+		if w = do("POST", "/printers/office/jobs", body, contentType); w.Code != http.StatusBadRequest {
+			t.Errorf("%v: expected 400 got %d", fields, w.Code)
+		}
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"file": "x", "ticket": `{"copies": `})
+	if w = do("POST", "/printers/office/jobs", body, contentType); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid ticket got %d", w.Code)
+	}
+
+	body, contentType = multipartBody(t, map[string]string{"file": "%PDF-1.4"})
+	w = do("POST", "/printers/office/proof", body, contentType)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/pdf" || w.Body.String() != "proof.pdf" || w.Header().Get("X-Print-Warnings") == "" {
+		t.Errorf("proof: %d %v %s", w.Code, w.Header(), w.Body)
+	}
+	body, contentType = multipartBody(t, map[string]string{"file": "%PDF-1.4"})
+	w = do("POST", "/printers/office/proof?format=png", body, contentType)
+	z, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if err != nil || len(z.File) != 2 || z.File[1].Name != "proof-2.png" {
+		t.Errorf("expected a zip of 2 PNG proofs got %d %s (%v)", w.Code, w.Body, err)
+	}
+	body, contentType = multipartBody(t, map[string]string{"file": "%PDF-1.4"})
+	if w = do("POST", "/printers/office/proof?format=tiff", body, contentType); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a tiff proof got %d", w.Code)
+	}
+
+	if w = do("GET", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusOK {
+		t.Errorf("job state: %d %s", w.Code, w.Body)
+	}
+	if w = do("DELETE", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusNoContent || spooler.cancelled != 7 {
+		t.Errorf("cancel job: %d %s", w.Code, w.Body)
+	}
+	spooler.cancelErr = fmt.Errorf("cancelling job 7 of another user on office %w", lib.ErrAdminRequired)
+	if w = do("DELETE", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 cancelling the job of another user got %d", w.Code)
+	}
+	spooler.cancelErr = fmt.Errorf("%w: job 7 on office", lib.ErrJobNotFound)
+	if w = do("DELETE", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 cancelling a missing job got %d", w.Code)
+	}
+	spooler.cancelErr = &lib.Win32Error{Op: "OpenPrinter", Name: "office", Code: 1722, Err: errors.New("RPC server unavailable")}
+	if w = do("DELETE", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while the spooler is unavailable got %d", w.Code)
+	}
+	if w = do("POST", "/printers/office/jobs/7/release", bytes.NewBufferString(`{"pin": "1234"}`), "application/json"); w.Code != http.StatusForbidden {
+		t.Errorf("expected 403 releasing with a wrong PIN got %d", w.Code)
+	}
+	if w = do("POST", "/printers/office/jobs/7/release", bytes.NewBufferString(`{}`), "application/json"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 releasing without PIN got %d", w.Code)
+	}
+	if w = do("POST", "/printers/office/jobs/7/release", bytes.NewBufferString(`{"pin": "4711"}`), "application/json"); w.Code != http.StatusNoContent || spooler.released != 7 {
+		t.Errorf("release job: %d %s", w.Code, w.Body)
+	}
+	if w = do("PUT", "/printers/office/jobs/7", nil, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 got %d", w.Code)
+	}
+	if w = do("GET", "/printers/office/jobs", nil, ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 listing jobs without Jobs got %d", w.Code)
+	}
+
+	var submitted []SubmittedJob
+	w = do("GET", "/jobs?q=INVOICE", nil, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil || len(submitted) != 1 || submitted[0].JobID != 7 || submitted[0].Printer != "office" {
+		t.Errorf("unexpected submitted jobs %s", w.Body)
+	}
+	w = do("GET", "/jobs?q=receipt", nil, "")
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil || len(submitted) != 0 {
+		t.Errorf("expected no submitted jobs matching got %s", w.Body)
+	}
+}
+
+func TestEventRoutes(t *testing.T) {
+	router, err := manager.NewEventRouter([]lib.EventRoute{{Name: "all", URL: "http://hooks/all"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{Printers: testPrinters{}, Spooler: &testSpooler{}, EventRoutes: router}
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest(method, path, bytes.NewBufferString(body)))
+		return w
+	}
+
+	if w := do("PUT", "/events/routes/errors", `{"url": "https://hooks/errors", "tenants": ["acme"], "min_severity": "ERROR"}`); w.Code != http.StatusOK {
+		t.Errorf("put route: %d %s", w.Code, w.Body)
+	}
+	for _, body := range []string{`{"url": "https://hooks/errors", "min_severity": "FATAL"}`, `{"url": `} {
+		if w := do("PUT", "/events/routes/errors", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 got %d", body, w.Code)
+		}
+	}
+	if w := do("DELETE", "/events/routes/all", ""); w.Code != http.StatusNoContent {
+		t.Errorf("delete route: %d %s", w.Code, w.Body)
+	}
+	if w := do("DELETE", "/events/routes/all", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting a missing route got %d", w.Code)
+	}
+
+	var routes []lib.EventRoute
+	w := do("GET", "/events/routes", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &routes); err != nil || len(routes) != 1 || routes[0].Name != "errors" || routes[0].Tenants[0] != "acme" {
+		t.Errorf("unexpected routes %s", w.Body)
+	}
+}
+
+func TestCrossOriginRequests(t *testing.T) {
+	spooler := &testSpooler{}
+	s := &Server{Printers: testPrinters{{Name: "office"}}, Spooler: spooler}
+	do := func(method, path, origin string) *httptest.ResponseRecorder {
+		body, contentType := multipartBody(t, map[string]string{"file": "%PDF-1.4"})
+		r := httptest.NewRequest(method, "http://127.0.0.1:8631"+path, body)
+		r.Header.Set("Content-Type", contentType)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	// Web pages the user opens can't submit jobs to localhost.
+	for _, origin := range []string{"https://evil.example", "http://127.0.0.1:8080", "null"} {
+		if w := do("POST", "/printers/office/jobs", origin); w.Code != http.StatusForbidden || spooler.document != nil {
+			t.Errorf("%s: expected 403 got %d %s", origin, w.Code, w.Body)
+		}
+	}
+	if w := do("DELETE", "/printers/office/jobs/7", "https://evil.example"); w.Code != http.StatusForbidden || spooler.cancelled != 0 {
+		t.Errorf("expected a cross-origin cancel forbidden got %d", w.Code)
+	}
+	// The dashboard, and clients that aren't browsers, can.
+	for _, origin := range []string{"http://127.0.0.1:8631", ""} {
+		if w := do("POST", "/printers/office/jobs", origin); w.Code != http.StatusCreated {
+			t.Errorf("%q: expected 201 got %d %s", origin, w.Code, w.Body)
+		}
+	}
+	if w := do("GET", "/printers", "https://evil.example"); w.Code != http.StatusOK {
+		t.Errorf("expected GET allowed got %d", w.Code)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	s := &Server{
+		Printers: testPrinters{{Name: "office"}},
+		Spooler:  &testSpooler{},
+		Jobs: func(printerName string) (interface{}, error) {
+			return []map[string]interface{}{{"JobID": 3, "Document": "invoice.pdf"}}, nil
+		},
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w
+	}
+
+	if w := get("/"); w.Code != http.StatusFound || w.Header().Get("Location") != "/ui/" {
+		t.Errorf("expected redirect to the dashboard got %d %s", w.Code, w.Header().Get("Location"))
+	}
+	for _, path := range []string{"/ui/", "/ui/app.js", "/ui/style.css"} {
+		if w := get(path); w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("%s: %d", path, w.Code)
+		}
+	}
+	if w := get("/printers/office/jobs"); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte("invoice.pdf")) {
+		t.Errorf("queued jobs: %d %s", w.Code, w.Body)
+	}
+}
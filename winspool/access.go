@@ -0,0 +1,66 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"golang.org/x/sys/windows"
+)
+
+// IsElevated reports whether the process runs with administrator rights,
+// i.e. as an administrator with UAC elevation, or as a service.
+func IsElevated() bool {
+	return windows.GetCurrentProcessToken().IsElevated()
+}
+
+// CheckPrinterAdmin fails with lib.ErrAdminRequired unless the process may
+// administer a printer: it opens the printer, on Server for names of its
+// printers, with PRINTER_ACCESS_ADMINISTER, which the ACL of the queue
+// grants, to delegated printer administrators as well as to elevated
+// administrators. Virtual printers check on each operation.
+func (ws *WinSpool) CheckPrinterAdmin(printerName string) error {
+	if ws.isVirtual(printerName) {
+		return nil
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER)
+	if err != nil {
+		return accessError(err, "administering printer "+printerName)
+	}
+	hPrinter.ClosePrinter()
+	return nil
+}
+
+// CheckServerAdmin is CheckPrinterAdmin for the print server itself, Server
+// or the local one, opened with SERVER_ACCESS_ADMINISTER, which adding and
+// deleting printers, ports and forms needs.
+func (ws *WinSpool) CheckServerAdmin() error {
+	hServer, err := OpenPrintServerAccess(ws.Server, SERVER_ACCESS_ADMINISTER)
+	if err != nil {
+		name := ws.Server
+		if name == "" {
+			name = "local"
+		}
+		return accessError(err, "administering print server "+name)
+	}
+	hServer.ClosePrinter()
+	return nil
+}
+
+// accessError wraps ERROR_ACCESS_DENIED in lib.ErrAdminRequired, and returns
+// other errors unchanged.
+func accessError(err error, operation string) error {
+	if errors.Is(err, ERROR_ACCESS_DENIED) {
+		return fmt.Errorf("%s %w", operation, lib.ErrAdminRequired)
+	}
+	return err
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+const defaultBatchTimeout = 5 * time.Minute
+
+// BatchDocument is one document of a batch submitted with PrintBatch.
+type BatchDocument struct {
+	FileName string
+	Title    string
+	Ticket   *model.JobTicket
+}
+
+type BatchOptions struct {
+	// Exclusive pauses the queue while the batch is submitted, then places the
+	// batch jobs next to each other, so that no other job prints in between.
+	Exclusive bool
+
+	// Timeout limits how long the queue stays paused; when it expires the
+	// queue is resumed and the remaining documents are not submitted.
+	// Defaults to 5 minutes.
+	Timeout time.Duration
+}
+
+// PrintBatch prints documents in order, and returns the job IDs of the
+// submitted documents.
+//
+// In exclusive mode, when a document fails to print, the jobs already
+// submitted are deleted before the queue is resumed, so that a partial
+// batch doesn't print. A queue that was paused before the batch is left
+// paused.
+func (ws *WinSpool) PrintBatch(printer *lib.Printer, docs []BatchDocument, options BatchOptions) ([]uint32, error) {
+	jobIDs := make([]uint32, 0, len(docs))
+	// Document and control jobs, in queue order.
+	var allJobIDs []uint32
+
+	// Virtual printers have no queue to pause, so their batches are
+	// submitted as-is.
+	if !options.Exclusive || ws.isVirtual(printer.Name) {
+		for _, doc := range docs {
+			result, err := ws.Print(printer, doc.FileName, doc.Title, doc.Ticket)
+			if err != nil {
+				return jobIDs, err
+			}
+			jobIDs = append(jobIDs, result.JobID)
+		}
+		return jobIDs, nil
+	}
+
+	timeout := options.Timeout
+	if timeout <= 0 {
+		timeout = defaultBatchTimeout
+	}
+
+	hPrinter, err := OpenPrinterAccess(printer.Name, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		return nil, accessError(err, "pausing printer "+printer.Name)
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return nil, err
+	}
+	if pi2.GetStatus()&PRINTER_STATUS_PAUSED == 0 {
+		if err = hPrinter.SetPrinterCommand(PRINTER_CONTROL_PAUSE); err != nil {
+			return nil, accessError(err, "pausing printer "+printer.Name)
+		}
+	}
+
+	var resumeOnce sync.Once
+	var timedOut bool
+	var mutex sync.Mutex
+	resume := func() {
+		resumeOnce.Do(func() {
+			if pi2.GetStatus()&PRINTER_STATUS_PAUSED != 0 {
+				return
+			}
+			if err := hPrinter.SetPrinterCommand(PRINTER_CONTROL_RESUME); err != nil {
+				log.Printf("Failed to resume printer %s after batch: %s", printer.Name, err)
+			}
+		})
+	}
+	// Resume even if a single document takes longer than the timeout to spool.
+	timer := time.AfterFunc(timeout, func() {
+		mutex.Lock()
+		timedOut = true
+		mutex.Unlock()
+		resume()
+	})
+	defer timer.Stop()
+	defer resume()
+
+	for i, doc := range docs {
+		mutex.Lock()
+		expired := timedOut
+		mutex.Unlock()
+		if expired {
+			return jobIDs, fmt.Errorf("batch timed out after %s, %d of %d documents submitted", timeout, i, len(docs))
+		}
+
+		result, err := ws.printWithControlJobs(printer, doc.FileName, doc.Title, "", doc.Ticket, nil)
+		if result != nil {
+			allJobIDs = append(allJobIDs, result.JobIDs...)
+		}
+		if err != nil {
+			deleteBatchJobs(hPrinter, allJobIDs)
+			return nil, fmt.Errorf("batch document %d (%s) failed: %w", i+1, doc.FileName, err)
+		}
+		jobIDs = append(jobIDs, result.JobID)
+	}
+
+	if err = arrangeBatchJobs(hPrinter, allJobIDs); err != nil {
+		return jobIDs, err
+	}
+
+	return jobIDs, nil
+}
+
+// arrangeBatchJobs moves the jobs right behind the first one, in order, ahead of
+// any job submitted by someone else while the batch was spooling.
+func arrangeBatchJobs(hPrinter HANDLE, jobIDs []uint32) error {
+	if len(jobIDs) < 2 {
+		return nil
+	}
+
+	first, err := hPrinter.GetJob(int32(jobIDs[0]))
+	if err != nil {
+		return err
+	}
+	position := first.GetPosition()
+
+	for i, jobID := range jobIDs[1:] {
+		ji1, err := hPrinter.GetJob(int32(jobID))
+		if err != nil {
+			return err
+		}
+		want := position + uint32(i) + 1
+		if ji1.position == want {
+			continue
+		}
+		ji1.position = want
+		if err = hPrinter.SetJobInfo1(int32(jobID), ji1); err != nil {
+			return fmt.Errorf("failed to move job %d to position %d: %w", jobID, want, err)
+		}
+	}
+
+	return nil
+}
+
+func deleteBatchJobs(hPrinter HANDLE, jobIDs []uint32) {
+	for _, jobID := range jobIDs {
+		if err := hPrinter.SetJobCommand(int32(jobID), JOB_CONTROL_DELETE); err != nil {
+			log.Printf("Failed to delete batch job %d: %s", jobID, err)
+		}
+	}
+}
@@ -12,6 +12,8 @@ package winspool
 /*
 #cgo pkg-config: cairo-win32
 #include <cairo-win32.h>
+#include <cairo-pdf.h>
+#include <stdlib.h> // free
 */
 import "C"
 import (
@@ -19,6 +21,9 @@ import (
 	"unsafe"
 )
 
+// Documents are rendered with Poppler and Cairo; see nocgo.go.
+const renderingAvailable = true
+
 func cairoStatusToError(status C.cairo_status_t) error {
 	s := C.cairo_status_to_string(status)
 	return fmt.Errorf("Cairo error: %s", C.GoString(s))
@@ -40,6 +45,19 @@ func CairoWin32PrintingSurfaceCreate(hDC HDC) (CairoSurface, error) {
 	return s, nil
 }
 
+// CairoPDFSurfaceCreate creates a PDF file of pages width by height points.
+func CairoPDFSurfaceCreate(filename string, width, height float64) (CairoSurface, error) {
+	cFilename := C.CString(filename)
+	defer C.free(unsafe.Pointer(cFilename))
+	surface := C.cairo_pdf_surface_create(cFilename, C.double(width), C.double(height))
+	s := CairoSurface(unsafe.Pointer(surface))
+	if err := s.status(); err != nil {
+		C.cairo_surface_destroy(surface)
+		return 0, err
+	}
+	return s, nil
+}
+
 func (s CairoSurface) status() error {
 	status := C.cairo_surface_status(s.nativePointer())
 	if status != 0 {
@@ -80,6 +98,19 @@ func (s *CairoSurface) GetDeviceScale() (float64, float64, error) {
 	return xScale, yScale, s.status()
 }
 
+// SetDeviceScale scales what is drawn on the surface, such as to draw in
+// points on an image surface of pixels.
+func (s CairoSurface) SetDeviceScale(xScale, yScale float64) error {
+	C.cairo_surface_set_device_scale(s.nativePointer(), C.double(xScale), C.double(yScale))
+	return s.status()
+}
+
+// SetPDFSize sets the size of the next pages of a PDF surface, in points.
+func (s CairoSurface) SetPDFSize(width, height float64) error {
+	C.cairo_pdf_surface_set_size(s.nativePointer(), C.double(width), C.double(height))
+	return s.status()
+}
+
 func (s *CairoSurface) SetFallbackResolution(xPPI, yPPI float64) error {
 	C.cairo_surface_set_fallback_resolution(s.nativePointer(), C.double(xPPI), C.double(yPPI))
 	return s.status()
@@ -164,3 +195,107 @@ func (c CairoContext) Rectangle(x, y, width, height float64) error {
 	C.cairo_rectangle(c.nativePointer(), C.double(x), C.double(y), C.double(width), C.double(height))
 	return c.status()
 }
+
+// CairoImageSurfaceCreateRGB24 creates an image surface with 32 bits per
+// pixel, stored as native-endian 0x00RRGGBB.
+func CairoImageSurfaceCreateRGB24(width, height int) (CairoSurface, error) {
+	surface := C.cairo_image_surface_create(C.CAIRO_FORMAT_RGB24, C.int(width), C.int(height))
+	s := CairoSurface(unsafe.Pointer(surface))
+	if err := s.status(); err != nil {
+		s.Destroy()
+		return 0, err
+	}
+	return s, nil
+}
+
+// ImageData returns the pixels of an image surface, and the length of a row
+// in bytes. Call Flush before writing to the pixels and MarkDirty after.
+func (s CairoSurface) ImageData() ([]byte, int) {
+	data := C.cairo_image_surface_get_data(s.nativePointer())
+	stride := int(C.cairo_image_surface_get_stride(s.nativePointer()))
+	height := int(C.cairo_image_surface_get_height(s.nativePointer()))
+	return unsafe.Slice((*byte)(unsafe.Pointer(data)), stride*height), stride
+}
+
+func (s CairoSurface) Flush() error {
+	C.cairo_surface_flush(s.nativePointer())
+	return s.status()
+}
+
+func (s CairoSurface) MarkDirty() error {
+	C.cairo_surface_mark_dirty(s.nativePointer())
+	return s.status()
+}
+
+func (c CairoContext) SetSourceSurface(surface CairoSurface, x, y float64) error {
+	C.cairo_set_source_surface(c.nativePointer(), surface.nativePointer(), C.double(x), C.double(y))
+	return c.status()
+}
+
+func (c CairoContext) SetSourceRGB(red, green, blue float64) error {
+	C.cairo_set_source_rgb(c.nativePointer(), C.double(red), C.double(green), C.double(blue))
+	return c.status()
+}
+
+func (c CairoContext) Paint() error {
+	C.cairo_paint(c.nativePointer())
+	return c.status()
+}
+
+// SelectFontFace selects a font by family name, such as "Arial".
+func (c CairoContext) SelectFontFace(family string, bold bool) error {
+	cFamily := C.CString(family)
+	defer C.free(unsafe.Pointer(cFamily))
+	var weight C.cairo_font_weight_t = C.CAIRO_FONT_WEIGHT_NORMAL
+	if bold {
+		weight = C.CAIRO_FONT_WEIGHT_BOLD
+	}
+	C.cairo_select_font_face(c.nativePointer(), cFamily, C.CAIRO_FONT_SLANT_NORMAL, weight)
+	return c.status()
+}
+
+func (c CairoContext) SetFontSize(size float64) error {
+	C.cairo_set_font_size(c.nativePointer(), C.double(size))
+	return c.status()
+}
+
+// TextWidth returns how far text advances the current point.
+func (c CairoContext) TextWidth(text string) (float64, error) {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	var extents C.cairo_text_extents_t
+	C.cairo_text_extents(c.nativePointer(), cText, &extents)
+	return float64(extents.x_advance), c.status()
+}
+
+func (c CairoContext) ShowText(text string) error {
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.cairo_show_text(c.nativePointer(), cText)
+	return c.status()
+}
+
+func (c CairoContext) MoveTo(x, y float64) error {
+	C.cairo_move_to(c.nativePointer(), C.double(x), C.double(y))
+	return c.status()
+}
+
+func (c CairoContext) LineTo(x, y float64) error {
+	C.cairo_line_to(c.nativePointer(), C.double(x), C.double(y))
+	return c.status()
+}
+
+func (c CairoContext) SetLineWidth(width float64) error {
+	C.cairo_set_line_width(c.nativePointer(), C.double(width))
+	return c.status()
+}
+
+func (c CairoContext) Stroke() error {
+	C.cairo_stroke(c.nativePointer())
+	return c.status()
+}
+
+func (c CairoContext) Fill() error {
+	C.cairo_fill(c.nativePointer())
+	return c.status()
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// GetPrinterCapabilities returns the full description of a printer: the
+// description of GetPrinter, with the resolutions, media types and other
+// vendor capabilities the driver reports, and the formats winspool prints.
+func (ws *WinSpool) GetPrinterCapabilities(printerName string) (*model.PrinterDescriptionSection, error) {
+	if err := ws.Faults.Inject("GetPrinterCapabilities", printerName); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printerName) {
+		printer, err := ws.getVirtualPrinter(printerName)
+		if err != nil {
+			return nil, err
+		}
+		driver, err := ws.virtual.DriverCapabilities(printerName)
+		if err != nil {
+			return nil, err
+		}
+		return lib.FullDescription(printer.Description, driver), nil
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return nil, err
+	}
+	printer, err := ws.convertPrinter(pi2)
+	if err != nil {
+		return nil, err
+	}
+	return lib.FullDescription(printer.Description, getDriverCapabilities(pi2)), nil
+}
+
+// getDriverCapabilities queries the driver of a printer for what the
+// description of GetPrinters leaves out. DeviceCapabilities fails for what
+// a driver doesn't support, which is then left out.
+func getDriverCapabilities(pi2 *PrinterInfo2) *lib.DriverCapabilities {
+	printerName := pi2.GetPrinterName()
+	portName := pi2.GetPortName()
+	devMode := pi2.GetDevMode()
+
+	driver := lib.DriverCapabilities{DevMode: devMode.Bytes()}
+
+	if resolutions, err := DeviceCapabilitiesInt32Pairs(printerName, portName, DC_ENUMRESOLUTIONS); err == nil {
+		for i := 0; i+1 < len(resolutions); i += 2 {
+			driver.Resolutions = append(driver.Resolutions, lib.Resolution{X: resolutions[i], Y: resolutions[i+1]})
+		}
+	}
+	if x, y, ok := devMode.GetResolution(); ok {
+		driver.DefaultResolution = lib.Resolution{X: int32(x), Y: int32(y)}
+	}
+
+	if mediaTypes, err := DeviceCapabilitiesUint32Array(printerName, portName, DC_MEDIATYPES); err == nil {
+		// Media type names are at most 64 characters.
+		if names, err := DeviceCapabilitiesStrings(printerName, portName, DC_MEDIATYPENAMES, 64*2); err == nil {
+			driver.MediaTypes, driver.MediaTypeNames = mediaTypes, names
+		}
+	}
+	if def, ok := devMode.GetMediaType(); ok {
+		driver.DefaultMediaType = def
+	}
+
+	if staple, err := DeviceCapabilitiesInt32(printerName, portName, DC_STAPLE); err == nil {
+		driver.Staple = staple > 0
+	}
+
+	driver.Personalities = getPersonalities(printerName, portName)
+
+	return &driver
+}
+
+// getPersonalities returns the printer languages of the driver of a
+// printer, none when it doesn't tell.
+func getPersonalities(printerName, portName string) []string {
+	// Printer languages are at most 32 characters.
+	names, err := DeviceCapabilitiesStrings(printerName, portName, DC_PERSONALITY, 32*2)
+	if err != nil {
+		return nil
+	}
+	var personalities []string
+	for _, personality := range names {
+		if personality != "" {
+			personalities = append(personalities, personality)
+		}
+	}
+	return personalities
+}
@@ -0,0 +1,111 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// prepareDocument detects the document format, and converts documents that
+// can't be opened directly into PDF. Returns the file to print, its content
+// type, and a function that removes temporary files.
+func (ws *WinSpool) prepareDocument(fileName string, ticket *model.JobTicket) (string, string, func(), error) {
+	if lib.IsURL(fileName) {
+		return ws.convertToPDF(func(pdf string) error {
+			return ws.htmlToPDF(fileName, pdf, ticket)
+		})
+	}
+
+	contentType, err := lib.DetectFileContentType(fileName)
+	if err != nil {
+		return "", "", nil, err
+	}
+	switch contentType {
+	case lib.ContentTypePDF, lib.ContentTypePWGRaster, lib.ContentTypeURF, lib.ContentTypePNG, lib.ContentTypeJPEG, lib.ContentTypeTIFF,
+		lib.ContentTypeZPL, lib.ContentTypeESCPOS, lib.ContentTypeText:
+		return fileName, contentType, func() {}, nil
+	case lib.ContentTypePostScript:
+		gsPath, err := lib.FindGhostscript(ws.GhostscriptPath)
+		if err != nil {
+			return "", "", nil, err
+		}
+		return ws.convertToPDF(func(pdf string) error {
+			return lib.GhostscriptToPDF(gsPath, fileName, pdf)
+		})
+	case lib.ContentTypeHTML:
+		return ws.convertToPDF(func(pdf string) error {
+			return ws.htmlToPDF(fileName, pdf, ticket)
+		})
+	case lib.ContentTypeLayout:
+		if !renderingAvailable {
+			return "", "", nil, fmt.Errorf("%s: printing %s documents: %w", fileName, contentType, ErrNoRenderer)
+		}
+		return ws.convertToPDF(func(pdf string) error {
+			return ws.layoutToPDF(fileName, pdf, ticket)
+		})
+	case "":
+		return "", "", nil, fmt.Errorf("%s: unrecognized document format", fileName)
+	}
+	return "", "", nil, fmt.Errorf("%s: %s documents are not supported", fileName, contentType)
+}
+
+// laysOutMargins tells whether prepareDocument lays the document out within
+// the ticket margins, which are then not applied again when printing.
+func laysOutMargins(fileName string) bool {
+	if lib.IsURL(fileName) {
+		return true
+	}
+	contentType, err := lib.DetectFileContentType(fileName)
+	return err == nil && contentType == lib.ContentTypeHTML
+}
+
+// convertToPDF runs convert against a new temporary PDF file.
+func (ws *WinSpool) convertToPDF(convert func(pdf string) error) (string, string, func(), error) {
+	pdf, err := ioutil.TempFile("", "winspool-*.pdf")
+	if err != nil {
+		return "", "", nil, err
+	}
+	pdf.Close()
+	cleanup := func() { os.Remove(pdf.Name()) }
+
+	if err = convert(pdf.Name()); err != nil {
+		cleanup()
+		return "", "", nil, err
+	}
+	return pdf.Name(), lib.ContentTypePDF, cleanup, nil
+}
+
+// htmlToPDF lays out the page with the ticket media size and margins.
+func (ws *WinSpool) htmlToPDF(source, pdf string, ticket *model.JobTicket) error {
+	converter, err := lib.FindHTMLConverter(ws.HTMLConverter)
+	if err != nil {
+		return err
+	}
+
+	options := lib.DefaultHTMLPageOptions
+	options.BlockNetwork = ws.RenderLimits.DisableExternalReferences
+	if ticket != nil && ticket.MediaSize != nil && ticket.MediaSize.WidthMicrons > 0 && ticket.MediaSize.HeightMicrons > 0 {
+		options.WidthMicrons = ticket.MediaSize.WidthMicrons
+		options.HeightMicrons = ticket.MediaSize.HeightMicrons
+	}
+	if ticket != nil && ticket.Margins != nil {
+		options.TopMicrons = ticket.Margins.TopMicrons
+		options.RightMicrons = ticket.Margins.RightMicrons
+		options.BottomMicrons = ticket.Margins.BottomMicrons
+		options.LeftMicrons = ticket.Margins.LeftMicrons
+	}
+
+	return lib.HTMLToPDF(converter, source, pdf, options)
+}
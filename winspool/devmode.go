@@ -0,0 +1,167 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// ExportDevMode returns the default DEVMODE of a printer queue, with the
+// settings tuned in the driver dialogs, to apply to other queues with
+// ImportDevMode.
+func (ws *WinSpool) ExportDevMode(printerName string) (*lib.DevModeExport, error) {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ExportDevMode(printerName)
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return nil, err
+	}
+	devMode := pi2.GetDevMode()
+	if devMode == nil {
+		// No global default yet; the driver defaults apply.
+		if devMode, err = hPrinter.DocumentPropertiesGet(printerName); err != nil {
+			return nil, err
+		}
+	}
+	return &lib.DevModeExport{
+		Printer:       printerName,
+		Driver:        pi2.GetDriverName(),
+		DriverVersion: devMode.GetDriverVersion(),
+		DevMode:       devMode.Bytes(),
+	}, nil
+}
+
+// ImportDevMode makes an exported DEVMODE the default of a printer queue,
+// without opening any driver dialog. The queue must have the same driver and
+// driver version. The driver validates the DEVMODE against the printer
+// before it is set.
+func (ws *WinSpool) ImportDevMode(printerName string, export *lib.DevModeExport) error {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ImportDevMode(printerName, export)
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		return accessError(err, "setting the default DEVMODE of "+printerName)
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return err
+	}
+	devMode, err := validateDevModeExport(hPrinter, printerName, pi2, export)
+	if err != nil {
+		return err
+	}
+	if err = hPrinter.SetPrinterDevMode(devMode); err != nil {
+		return accessError(err, "setting the default DEVMODE of "+printerName)
+	}
+	return nil
+}
+
+// validateDevModeExport returns the DEVMODE of an export once the driver of
+// the printer, which must be the same and of the same version, validated it.
+func validateDevModeExport(hPrinter HANDLE, printerName string, pi2 *PrinterInfo2, export *lib.DevModeExport) (*DevMode, error) {
+	driverVersion, err := lib.ParseDevModeHeader(export.DevMode)
+	if err != nil {
+		return nil, err
+	}
+	if driverVersion != export.DriverVersion {
+		return nil, fmt.Errorf("DEVMODE has driver version %#x, not %#x", driverVersion, export.DriverVersion)
+	}
+	current, err := hPrinter.DocumentPropertiesGet(printerName)
+	if err != nil {
+		return nil, err
+	}
+	if err = export.CheckDriver(pi2.GetDriverName(), current.GetDriverVersion()); err != nil {
+		return nil, err
+	}
+	devMode := NewDevModeFromBytes(export.DevMode)
+	if devMode.GetDriverExtra() != current.GetDriverExtra() {
+		return nil, fmt.Errorf("DEVMODE has %d bytes of driver data, %s expects %d: %w",
+			devMode.GetDriverExtra(), printerName, current.GetDriverExtra(), lib.ErrDriverMismatch)
+	}
+	if err = hPrinter.DocumentPropertiesSet(printerName, devMode); err != nil {
+		return nil, fmt.Errorf("driver rejected the DEVMODE for %s: %w", printerName, err)
+	}
+	return devMode, nil
+}
+
+// CaptureDevMode returns the DEVMODE of the printing preferences of the
+// current user, with the settings only the driver knows, such as stapling,
+// to keep as a preset jobs start from.
+func (ws *WinSpool) CaptureDevMode(printerName string) (*lib.DevModeExport, error) {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ExportDevMode(printerName)
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return nil, err
+	}
+	devMode, err := hPrinter.DocumentPropertiesGet(printerName)
+	if err != nil {
+		return nil, err
+	}
+	return &lib.DevModeExport{
+		Printer:       printerName,
+		Driver:        pi2.GetDriverName(),
+		DriverVersion: devMode.GetDriverVersion(),
+		DevMode:       devMode.Bytes(),
+	}, nil
+}
+
+// applyTicketDevMode replaces the DEVMODE of a job with the one of its
+// ticket, if any, before the ticket options are applied. It must be from
+// the driver of the printer, which validates it.
+func applyTicketDevMode(hPrinter HANDLE, printerName string, devMode *DevMode, ticket *model.JobTicket, presets *lib.DevModePresets) error {
+	export, err := lib.TicketDevMode(printerName, ticket, presets)
+	if err != nil || export == nil {
+		return err
+	}
+	if export.Driver != "" {
+		pi2, err := hPrinter.GetPrinter2()
+		if err != nil {
+			return err
+		}
+		if err = export.CheckDriver(pi2.GetDriverName(), devMode.GetDriverVersion()); err != nil {
+			return err
+		}
+	} else if export.DriverVersion != devMode.GetDriverVersion() {
+		return fmt.Errorf("DEVMODE of the ticket has driver version %#x, %s has %#x: %w",
+			export.DriverVersion, printerName, devMode.GetDriverVersion(), lib.ErrDriverMismatch)
+	}
+	if extra := NewDevModeFromBytes(export.DevMode).GetDriverExtra(); extra != devMode.GetDriverExtra() {
+		return fmt.Errorf("DEVMODE of the ticket has %d bytes of driver data, %s expects %d: %w",
+			extra, printerName, devMode.GetDriverExtra(), lib.ErrDriverMismatch)
+	}
+	if err = devMode.SetBytes(export.DevMode); err != nil {
+		return err
+	}
+	if err = hPrinter.DocumentPropertiesSet(printerName, devMode); err != nil {
+		return fmt.Errorf("driver rejected the DEVMODE of the ticket for %s: %w", printerName, err)
+	}
+	return nil
+}
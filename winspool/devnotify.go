@@ -0,0 +1,235 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"golang.org/x/sys/windows"
+)
+
+// Window messages.
+const (
+	WM_DESTROY      = 0x0002
+	WM_CLOSE        = 0x0010
+	WM_DEVICECHANGE = 0x0219
+)
+
+// WM_DEVICECHANGE wParam values.
+const (
+	DBT_DEVICEARRIVAL        = 0x8000
+	DBT_DEVICEREMOVECOMPLETE = 0x8004
+)
+
+const DEVICE_NOTIFY_WINDOW_HANDLE = 0
+
+// Parent of message-only windows.
+const HWND_MESSAGE = ^uintptr(2)
+
+// GUID_DEVINTERFACE_USBPRINT, the device interface of USB printers.
+var GUID_DEVINTERFACE_USBPRINT = GUID{
+	0x28d78fad,
+	0x5a12,
+	0x11d1,
+	[8]byte{0xae, 0x5b, 0x00, 0x00, 0xf8, 0x03, 0xa8, 0xc2},
+}
+
+// WNDCLASSEXW struct.
+type wndClassEx struct {
+	cbSize        uint32
+	style         uint32
+	lpfnWndProc   uintptr
+	cbClsExtra    int32
+	cbWndExtra    int32
+	hInstance     uintptr
+	hIcon         uintptr
+	hCursor       uintptr
+	hbrBackground uintptr
+	lpszMenuName  *uint16
+	lpszClassName *uint16
+	hIconSm       uintptr
+}
+
+// MSG struct.
+type msg struct {
+	hwnd     uintptr
+	message  uint32
+	wParam   uintptr
+	lParam   uintptr
+	time     uint32
+	ptX      int32
+	ptY      int32
+	lPrivate uint32
+}
+
+// DEV_BROADCAST_HDR struct.
+type devBroadcastHdr struct {
+	dwSize       uint32
+	dwDeviceType uint32
+	dwReserved   uint32
+}
+
+const deviceWindowClassName = "WinSpoolDeviceNotify"
+
+var (
+	deviceWindowClass     *uint16
+	deviceWindowClassOnce sync.Once
+	deviceWindowClassErr  error
+
+	// Device change receivers, by window handle.
+	deviceWindows      = make(map[uintptr]*deviceWindow)
+	deviceWindowsMutex sync.Mutex
+)
+
+type deviceWindow struct {
+	changes chan<- lib.DeviceChange
+	done    <-chan struct{}
+}
+
+func registerDeviceWindowClass() (*uint16, error) {
+	deviceWindowClassOnce.Do(func() {
+		className, err := syscall.UTF16PtrFromString(deviceWindowClassName)
+		if err != nil {
+			deviceWindowClassErr = err
+			return
+		}
+		wc := wndClassEx{
+			lpfnWndProc:   windows.NewCallback(deviceWndProc),
+			lpszClassName: className,
+		}
+		wc.cbSize = uint32(unsafe.Sizeof(wc))
+		if r1, _, err := registerClassExProc.Call(uintptr(unsafe.Pointer(&wc))); r1 == 0 {
+			deviceWindowClassErr = err
+			return
+		}
+		deviceWindowClass = className
+	})
+	return deviceWindowClass, deviceWindowClassErr
+}
+
+func deviceWndProc(hwnd, message, wParam, lParam uintptr) uintptr {
+	switch message {
+	case WM_DEVICECHANGE:
+		deviceWindowsMutex.Lock()
+		w := deviceWindows[hwnd]
+		deviceWindowsMutex.Unlock()
+		if w == nil || lParam == 0 {
+			break
+		}
+		var change lib.DeviceChange
+		switch wParam {
+		case DBT_DEVICEARRIVAL:
+			change.Event = lib.DeviceArrival
+		case DBT_DEVICEREMOVECOMPLETE:
+			change.Event = lib.DeviceRemoval
+		default:
+			return 1
+		}
+		hdr := (*devBroadcastHdr)(unsafe.Pointer(lParam))
+		if hdr.dwDeviceType == DBT_DEVTYP_DEVICEINTERFACE {
+			// dbcc_name follows the header and the class GUID.
+			offset := unsafe.Sizeof(*hdr) + unsafe.Sizeof(GUID{})
+			if uintptr(hdr.dwSize) > offset {
+				change.Name = utf16PtrToStringSize((*uint16)(unsafe.Pointer(lParam+offset)), hdr.dwSize-uint32(offset))
+			}
+		}
+		select {
+		case w.changes <- change:
+		case <-w.done:
+		}
+		return 1
+
+	case WM_CLOSE:
+		destroyWindowProc.Call(hwnd)
+		return 0
+
+	case WM_DESTROY:
+		postQuitMessageProc.Call(0)
+		return 0
+	}
+
+	r1, _, _ := defWindowProcProc.Call(hwnd, message, wParam, lParam)
+	return r1
+}
+
+// WatchDevices reports USB printers that are plugged or unplugged, until
+// done is closed. The returned channel is closed when watching stops.
+//
+// Notifications are received by a message-only window owned by a dedicated
+// thread, so the caller needs no window or message loop of its own.
+func (ws *WinSpool) WatchDevices(done <-chan struct{}) (<-chan lib.DeviceChange, error) {
+	className, err := registerDeviceWindowClass()
+	if err != nil {
+		return nil, fmt.Errorf("failed to register device notification window class: %s", err)
+	}
+
+	changes := make(chan lib.DeviceChange, 16)
+	started := make(chan error)
+	go func() {
+		// Window messages are delivered to the thread that created the window.
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hwnd, _, err := createWindowExProc.Call(0, uintptr(unsafe.Pointer(className)), 0, 0, 0, 0, 0, 0, HWND_MESSAGE, 0, 0, 0)
+		if hwnd == 0 {
+			started <- fmt.Errorf("failed to create device notification window: %s", err)
+			return
+		}
+
+		filter := DevBroadcastDevinterface{
+			dwDeviceType: DBT_DEVTYP_DEVICEINTERFACE,
+			classGuid:    GUID_DEVINTERFACE_USBPRINT,
+		}
+		filter.dwSize = uint32(unsafe.Sizeof(filter))
+		hNotify, _, err := registerDeviceNotificationProc.Call(hwnd, uintptr(unsafe.Pointer(&filter)), DEVICE_NOTIFY_WINDOW_HANDLE)
+		if hNotify == 0 {
+			destroyWindowProc.Call(hwnd)
+			started <- fmt.Errorf("failed to register device notification: %s", err)
+			return
+		}
+
+		deviceWindowsMutex.Lock()
+		deviceWindows[hwnd] = &deviceWindow{changes: changes, done: done}
+		deviceWindowsMutex.Unlock()
+		defer func() {
+			deviceWindowsMutex.Lock()
+			delete(deviceWindows, hwnd)
+			deviceWindowsMutex.Unlock()
+			unregisterDeviceNotificationProc.Call(hNotify)
+			close(changes)
+		}()
+
+		go func() {
+			<-done
+			postMessageProc.Call(hwnd, WM_CLOSE, 0, 0)
+		}()
+		started <- nil
+
+		var m msg
+		for {
+			r1, _, _ := getMessageProc.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+			if int32(r1) <= 0 {
+				// WM_QUIT, or an error.
+				return
+			}
+			dispatchMessageProc.Call(uintptr(unsafe.Pointer(&m)))
+		}
+	}()
+
+	if err = <-started; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
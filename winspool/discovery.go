@@ -0,0 +1,86 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"log"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// discoveryMaxDepth is how deep containers are browsed: the network, its
+// domains, and their print servers.
+const discoveryMaxDepth = 4
+
+// DiscoverPrinters lists the shared printers the spooler browses in the
+// domain of this computer, with PRINTER_ENUM_NETWORK. Domains and print
+// servers are enumerated in turn; those that fail to answer are skipped.
+func (ws *WinSpool) DiscoverPrinters() ([]lib.DiscoveredPrinter, error) {
+	if err := ws.Faults.Inject("DiscoverPrinters", ""); err != nil {
+		return nil, err
+	}
+	var entries []PrinterInfo1
+	err := ws.Retry.Do("EnumPrinters", func() error {
+		var err error
+		entries, err = EnumPrinters1(PRINTER_ENUM_NETWORK|PRINTER_ENUM_REMOTE, "")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var printers []lib.DiscoveredPrinter
+	seen := make(map[string]bool)
+	ws.discoverEntries(entries, 1, seen, &printers)
+	lib.SortDiscoveredPrinters(printers)
+	return printers, nil
+}
+
+func (ws *WinSpool) discoverEntries(entries []PrinterInfo1, depth int, seen map[string]bool, printers *[]lib.DiscoveredPrinter) {
+	for i := range entries {
+		name := entries[i].GetName()
+		if name == "" || seen[strings.ToLower(name)] {
+			continue
+		}
+		seen[strings.ToLower(name)] = true
+		if entries[i].GetFlags()&PRINTER_ENUM_CONTAINER == 0 {
+			*printers = append(*printers, newDiscoveredPrinter(&entries[i]))
+			continue
+		}
+		if depth >= discoveryMaxDepth {
+			continue
+		}
+		children, err := EnumPrinters1(PRINTER_ENUM_NAME, name)
+		if err != nil {
+			log.Printf("Failed to browse printers of %s: %s", name, err)
+			continue
+		}
+		ws.discoverEntries(children, depth+1, seen, printers)
+	}
+}
+
+// newDiscoveredPrinter describes a shared printer from its PRINTER_INFO_1,
+// whose description is its name, driver and location.
+func newDiscoveredPrinter(pi1 *PrinterInfo1) lib.DiscoveredPrinter {
+	p := lib.DiscoveredPrinter{
+		Name:    pi1.GetName(),
+		Source:  lib.DiscoverySourceNetwork,
+		Comment: pi1.GetComment(),
+	}
+	fields := strings.SplitN(pi1.GetDescription(), ",", 3)
+	if len(fields) > 1 {
+		p.Model = fields[1]
+	}
+	if len(fields) > 2 {
+		p.Location = fields[2]
+	}
+	return p
+}
@@ -0,0 +1,74 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"golang.org/x/sys/windows"
+)
+
+// printESCPText sends a plain text document to an ESC/P printer in a RAW
+// job, laid out by the page setup of the printer. Impact printers then
+// strike every character through all parts of multi-part forms, which
+// rendered pages don't.
+func printESCPText(printerName, fileName, title, output string, layout *lib.ESCPLayout, hold *jobHold, ticket *model.JobTicket) (*lib.PrintResult, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	text, ok := lib.DecodeText(data)
+	if !ok {
+		if text, err = decodeANSI(data); err != nil {
+			return nil, err
+		}
+	}
+	job, err := layout.Encode(text, encodeANSI)
+	if err != nil {
+		return nil, err
+	}
+	jobID, err := writeRawJob(printerName, title, output, job, hold)
+	if err != nil {
+		return nil, err
+	}
+	result := lib.PrintResult{JobID: jobID}
+	for _, option := range lib.TicketOptions(ticket) {
+		result.Warn(option, lib.PrintWarningRawDocument, "ignored, text is sent to the ESC/P printer as-is")
+	}
+	return &result, nil
+}
+
+// PrintForm fills the fields of the escp layout of a printer with values,
+// and prints a single form. See lib.ESCPLayout.Fill.
+func (ws *WinSpool) PrintForm(printerName, title string, values map[string]string) (*lib.PrintResult, error) {
+	layout, ok := ws.escpLayouts[printerName]
+	if !ok || len(layout.Fields) == 0 {
+		return nil, fmt.Errorf("printer %s has no escp fields", printerName)
+	}
+	text, err := layout.Fill(values)
+	if err != nil {
+		return nil, err
+	}
+	job, err := layout.Encode(text, encodeANSI)
+	if err != nil {
+		return nil, err
+	}
+	return ws.PrintRaw(printerName, bytes.NewReader(job), title, rawDatatype)
+}
+
+// encodeANSI encodes text in the ANSI code page of the system, which the
+// character set of dot-matrix printers is usually set up to match.
+func encodeANSI(text string) ([]byte, error) {
+	return WideCharToMultiByte(windows.GetACP(), text)
+}
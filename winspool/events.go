@@ -0,0 +1,173 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Size of the channel returned by Subscribe.
+const eventQueueSize = 64
+
+// printerSnapshot holds the fields of a printer that events are derived from.
+type printerSnapshot struct {
+	status     uint32
+	attributes uint32
+}
+
+func (ws *WinSpool) snapshotPrinters() (map[string]printerSnapshot, error) {
+	pi2s, err := EnumPrinters2(ws.printerEnumFlags())
+	if err != nil {
+		return nil, err
+	}
+	printers := make(map[string]printerSnapshot, len(pi2s))
+	for i := range pi2s {
+		printers[pi2s[i].GetPrinterName()] = printerSnapshot{pi2s[i].GetStatus(), pi2s[i].GetAttributes()}
+	}
+	return printers, nil
+}
+
+// Subscribe delivers printer and job events of the print server until
+// ctx is done, then closes the returned channel. The channel is also closed
+// if the spooler stops sending notifications.
+//
+// Printers are compared with the previous enumeration when the spooler
+// signals a printer change, so only actual additions, removals and state
+// changes are events. Jobs are followed from notification values; a job
+// event is sent when a job first appears, when its state type changes, and
+// when more pages are printed.
+func (ws *WinSpool) Subscribe(ctx context.Context) (<-chan lib.Event, error) {
+	events, err := ws.subscribeSpooler(ctx)
+	if err != nil || ws.virtual == nil {
+		return events, err
+	}
+	virtual, err := ws.virtual.Subscribe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return mergeEvents(ctx, events, virtual), nil
+}
+
+func (ws *WinSpool) subscribeSpooler(ctx context.Context) (<-chan lib.Event, error) {
+	printers, err := ws.snapshotPrinters()
+	if err != nil {
+		return nil, err
+	}
+
+	hServer, err := OpenPrintServer(ws.Server)
+	if err != nil {
+		return nil, err
+	}
+	types := []PrinterNotifyOptionsType{NewPrinterNotifyOptionsType(JOB_NOTIFY_TYPE, jobChangeFields)}
+	filter := PRINTER_CHANGE_ADD_PRINTER | PRINTER_CHANGE_SET_PRINTER | PRINTER_CHANGE_DELETE_PRINTER | PRINTER_CHANGE_JOB
+	hChange, err := hServer.FindFirstPrinterChangeNotificationOptions(filter, NewPrinterNotifyOptions(types))
+	if err != nil {
+		hServer.ClosePrinter()
+		return nil, err
+	}
+
+	events := make(chan lib.Event, eventQueueSize)
+	go func() {
+		defer close(events)
+		defer hServer.ClosePrinter()
+		defer hChange.FindClosePrinterChangeNotification()
+
+		send := func(event lib.Event) bool {
+			select {
+			case events <- event:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		jobs := lib.NewJobTransitions()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			signaled, err := hChange.Wait(time.Second)
+			if err != nil {
+				log.Printf("Failed to wait for spooler change notification: %s", err)
+				return
+			}
+			if !signaled {
+				continue
+			}
+
+			flags, values, discarded, err := hChange.FindNextPrinterChangeNotificationInfo(false)
+			for err == nil && discarded {
+				_, values, discarded, err = hChange.FindNextPrinterChangeNotificationInfo(true)
+			}
+			if err != nil {
+				log.Printf("Failed to read spooler change notification: %s", err)
+				return
+			}
+
+			if flags&PRINTER_CHANGE_PRINTER != 0 {
+				current, err := ws.snapshotPrinters()
+				if err != nil {
+					log.Printf("Failed to enumerate printers after change notification: %s", err)
+				} else {
+					for _, event := range diffPrinters(printers, current) {
+						if !send(event) {
+							return
+						}
+					}
+					printers = current
+				}
+			}
+
+			for _, change := range convertJobNotifyValues(values, ws.Server) {
+				if event, ok := jobs.Apply(change); ok && !send(event) {
+					return
+				}
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// diffPrinters returns the events that turn before into after.
+func diffPrinters(before, after map[string]printerSnapshot) []lib.Event {
+	var events []lib.Event
+	now := time.Now()
+	for name, p := range after {
+		old, exists := before[name]
+		if exists && reflect.DeepEqual(old, p) {
+			continue
+		}
+		state := convertPrinterState(p.status, p.attributes)
+		if !exists {
+			events = append(events, lib.Event{Type: lib.EventPrinterAdded, Time: now, Printer: name, PrinterState: state})
+			continue
+		}
+		// Attribute changes that don't show in the state are not events.
+		if reflect.DeepEqual(convertPrinterState(old.status, old.attributes), state) {
+			continue
+		}
+		events = append(events, lib.Event{Type: lib.EventPrinterStateChanged, Time: now, Printer: name, PrinterState: state})
+	}
+	for name := range before {
+		if _, exists := after[name]; !exists {
+			events = append(events, lib.Event{Type: lib.EventPrinterRemoved, Time: now, Printer: name})
+		}
+	}
+	return events
+}
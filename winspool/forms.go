@@ -0,0 +1,112 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Forms lists the forms of Server, this computer by default.
+func (ws *WinSpool) Forms() ([]lib.Form, error) {
+	if err := ws.Faults.Inject("Forms", ""); err != nil {
+		return nil, err
+	}
+	var fi1s []FormInfo1
+	err := ws.Retry.Do("EnumForms", func() error {
+		hServer, err := OpenPrintServer(ws.Server)
+		if err != nil {
+			return err
+		}
+		defer hServer.ClosePrinter()
+		fi1s, err = hServer.EnumForms1()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return convertForms(fi1s), nil
+}
+
+// printerForms lists the forms of the print server of a printer, for its
+// media sizes.
+func (ws *WinSpool) printerForms(printerName string) ([]lib.Form, error) {
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+	fi1s, err := hPrinter.EnumForms1()
+	if err != nil {
+		return nil, err
+	}
+	return convertForms(fi1s), nil
+}
+
+func convertForms(fi1s []FormInfo1) []lib.Form {
+	forms := make([]lib.Form, len(fi1s))
+	for i := range fi1s {
+		width, height := fi1s[i].GetSize()
+		forms[i] = lib.Form{
+			Name:          fi1s[i].GetName(),
+			Kind:          lib.FormKindUser,
+			WidthMicrons:  width,
+			HeightMicrons: height,
+		}
+		switch fi1s[i].GetFlags() {
+		case FORM_BUILTIN:
+			forms[i].Kind = lib.FormKindBuiltin
+		case FORM_PRINTER:
+			forms[i].Kind = lib.FormKindPrinter
+		}
+	}
+	return forms
+}
+
+// AddForm adds a user form to Server, this computer by default, which the
+// media sizes of its printers then include.
+func (ws *WinSpool) AddForm(name string, widthMicrons, heightMicrons int32) error {
+	if err := ws.Faults.Inject("AddForm", name); err != nil {
+		return err
+	}
+	if name == "" || widthMicrons <= 0 || heightMicrons <= 0 {
+		return errors.New("a form needs a name and a size")
+	}
+	return ws.onPrintServerAdmin("adding form "+name, func(hServer HANDLE) error {
+		return hServer.AddForm(name, widthMicrons, heightMicrons)
+	})
+}
+
+// DeleteForm deletes a user form from Server, this computer by default.
+func (ws *WinSpool) DeleteForm(name string) error {
+	if err := ws.Faults.Inject("DeleteForm", name); err != nil {
+		return err
+	}
+	return ws.onPrintServerAdmin("deleting form "+name, func(hServer HANDLE) error {
+		return hServer.DeleteForm(name)
+	})
+}
+
+// onPrintServerAdmin calls call with Server opened to be administered, and
+// forgets the capabilities of printers, whose media sizes include forms.
+func (ws *WinSpool) onPrintServerAdmin(operation string, call func(hServer HANDLE) error) error {
+	hServer, err := OpenPrintServerAccess(ws.Server, SERVER_ACCESS_ADMINISTER)
+	if err != nil {
+		return accessError(err, operation)
+	}
+	defer hServer.ClosePrinter()
+
+	if err = call(hServer); err != nil {
+		return accessError(err, operation)
+	}
+	ws.capabilities.Invalidate()
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// jobHold is how a job is held once started: outside of a print window,
+// and paused until released for tickets with a hold. A nil hold holds
+// nothing.
+type jobHold struct {
+	window *lib.PrintWindow
+	paused bool
+}
+
+// newJobHold returns how the jobs of a ticket are held: outside of the
+// print window of the printer, or of the hold_until of the ticket, and
+// paused when the ticket has a hold. Holds with a PIN need HeldJobs.
+func (ws *WinSpool) newJobHold(printerName string, ticket *model.JobTicket, now time.Time) (*jobHold, error) {
+	window, err := lib.JobWindow(ws.printWindows[printerName], ticket, now)
+	if err != nil {
+		return nil, err
+	}
+	hold := jobHold{window: window, paused: ticket.Hold != nil}
+	if hold.paused && ticket.Hold.PIN != "" {
+		if err = (&model.JobTicket{Hold: ticket.Hold}).Validate(); err != nil {
+			return nil, err
+		}
+		if ws.HeldJobs == nil {
+			return nil, errors.New("holding jobs with a PIN needs a held_jobs_file")
+		}
+	}
+	return &hold, nil
+}
+
+// queuing returns the hold of a job that is also paused while the rest of
+// its submission is queued, when held is set.
+func (h *jobHold) queuing(held bool) *jobHold {
+	if !held || h.paused {
+		return h
+	}
+	return &jobHold{window: h.window, paused: true}
+}
+
+func (h *jobHold) apply(hPrinter HANDLE, jobID int32) error {
+	if h == nil {
+		return nil
+	}
+	if err := setJobWindow(hPrinter, jobID, h.window); err != nil {
+		return err
+	}
+	if h.paused {
+		if err := hPrinter.SetJobCommand(jobID, JOB_CONTROL_PAUSE); err != nil {
+			return fmt.Errorf("failed to hold job %d: %w", jobID, err)
+		}
+	}
+	return nil
+}
+
+// noteHeld notes the jobs of a submission held by the hold of its ticket
+// in HeldJobs, when set, so that they are released together.
+func (ws *WinSpool) noteHeld(printerName, title string, ticket *model.JobTicket, result *lib.PrintResult) error {
+	if ticket.Hold == nil || ws.HeldJobs == nil {
+		return nil
+	}
+	job := lib.HeldJob{
+		Printer: printerName,
+		JobID:   result.JobID,
+		JobIDs:  result.JobIDs,
+		Title:   title,
+		User:    ticketUser(ticket),
+		Held:    time.Now(),
+	}
+	if err := ws.HeldJobs.Hold(job, ticket.Hold.PIN); err != nil {
+		return fmt.Errorf("failed to note held job %d on %s: %w", result.JobID, printerName, err)
+	}
+	return nil
+}
+
+// heldJobIDs returns the IDs of the jobs of a printer noted in HeldJobs,
+// with those sent with them.
+func (ws *WinSpool) heldJobIDs(printerName string) (map[uint32]bool, error) {
+	ids := map[uint32]bool{}
+	if ws.HeldJobs == nil {
+		return ids, nil
+	}
+	jobs, err := ws.HeldJobs.Jobs()
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		if job.Printer != printerName {
+			continue
+		}
+		ids[job.JobID] = true
+		for _, id := range job.JobIDs {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// ReleaseHeldJob prints a job held by the hold of its ticket, with the
+// label settings and trailer sent with it. With an empty pin an operator
+// releases it, who needs the rights to resume the job. Otherwise pin must
+// be the PIN the job was held with, and the job is resumed with the rights
+// of this process, as winspool serve does for users at the printer.
+func (ws *WinSpool) ReleaseHeldJob(printerName string, jobID uint32, pin string) error {
+	if err := ws.Faults.Inject("ReleaseHeldJob", printerName); err != nil {
+		return err
+	}
+	if ws.HeldJobs == nil && pin != "" {
+		return errors.New("releasing jobs with a PIN needs a held_jobs_file")
+	}
+	jobIDs := []uint32{jobID}
+	if ws.HeldJobs != nil {
+		held, err := ws.HeldJobs.Check(printerName, jobID, pin)
+		if err != nil {
+			return err
+		}
+		if held != nil && len(held.JobIDs) > 0 {
+			jobIDs = held.JobIDs
+		}
+	}
+	for _, id := range jobIDs {
+		err := ws.resumeJob(printerName, id)
+		if errors.Is(err, lib.ErrJobNotFound) && id != jobID {
+			// Label settings may be printed and gone.
+			continue
+		}
+		if errors.Is(err, lib.ErrJobNotFound) {
+			if ws.HeldJobs != nil {
+				ws.HeldJobs.Forget(printerName, jobID)
+			}
+			return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if ws.HeldJobs != nil {
+		return ws.HeldJobs.Forget(printerName, jobID)
+	}
+	return nil
+}
+
+// resumeJob resumes a paused job; lib.ErrJobNotFound when it's gone.
+func (ws *WinSpool) resumeJob(printerName string, jobID uint32) error {
+	if ws.isVirtual(printerName) {
+		if _, ok := ws.virtual.Job(jobID); !ok {
+			return lib.ErrJobNotFound
+		}
+		return ws.virtual.ResumeJob(printerName, jobID)
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return err
+	}
+	defer hPrinter.ClosePrinter()
+
+	err = hPrinter.SetJobCommand(int32(jobID), JOB_CONTROL_RESUME)
+	if errors.Is(err, ERROR_INVALID_PARAMETER) {
+		return lib.ErrJobNotFound
+	} else if errors.Is(err, ERROR_ACCESS_DENIED) {
+		return accessError(err, fmt.Sprintf("releasing job %d of another user on %s", jobID, printerName))
+	} else if err != nil {
+		return fmt.Errorf("failed to release job %d on %s: %w", jobID, printerName, err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"golang.org/x/sys/windows/registry"
+)
+
+const (
+	tcpipPortsKey   = `SYSTEM\CurrentControlSet\Control\Print\Monitors\Standard TCP/IP Port\Ports\`
+	deviceEnumKey   = `SYSTEM\CurrentControlSet\Enum\`
+	snmpTimeout     = 2 * time.Second
+	pnpDataKeyName  = "PnPData"
+	pnpDataInstance = "DeviceInstanceId"
+)
+
+var rGUID = regexp.MustCompile(`(?i)[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+
+// getDeviceIdentity finds identifiers of the physical device behind a queue,
+// which survive the queue being deleted and recreated.
+//
+// The device UUID comes from the WSD port name, or from the PnP container ID
+// of the device the queue was installed for. The serial number is queried over
+// SNMP for Standard TCP/IP ports, and only when an SNMP community is configured.
+func (ws *WinSpool) getDeviceIdentity(printerName, portName string) (serialNumber, deviceUUID string) {
+	if strings.HasPrefix(portName, "WSD-") {
+		deviceUUID = strings.ToLower(rGUID.FindString(portName))
+	}
+
+	if deviceUUID == "" {
+		if hPrinter, err := OpenPrinter(printerName); err == nil {
+			if instanceID, err := hPrinter.GetPrinterDataExString(pnpDataKeyName, pnpDataInstance); err == nil && instanceID != "" {
+				deviceUUID = getContainerID(instanceID)
+			}
+			hPrinter.ClosePrinter()
+		}
+	}
+
+	if ws.SNMPCommunity != "" {
+		if host := getTCPIPPortHost(portName); host != "" {
+			if serial, err := lib.SNMPGetString(host, ws.SNMPCommunity, lib.SNMPOIDPrtGeneralSerialNumber, snmpTimeout); err == nil {
+				serialNumber = serial
+			}
+		}
+	}
+
+	return
+}
+
+// getContainerID returns the PnP container ID of a device instance, without braces.
+func getContainerID(instanceID string) string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, deviceEnumKey+instanceID, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+
+	containerID, _, err := k.GetStringValue("ContainerID")
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(rGUID.FindString(containerID))
+}
+
+// getTCPIPPortHost returns the host name or IP address of a Standard TCP/IP port.
+func getTCPIPPortHost(portName string) string {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, tcpipPortsKey+portName, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+
+	for _, valueName := range []string{"HostName", "IPAddress"} {
+		if host, _, err := k.GetStringValue(valueName); err == nil && host != "" {
+			return host
+		}
+	}
+	return ""
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"golang.org/x/sys/windows"
+)
+
+// JobDetails is a job as JOB_INFO_2 describes it, for queue dashboards.
+type JobDetails struct {
+	Job
+	// When the job was submitted, in UTC.
+	Submitted    time.Time
+	TotalPages   uint32
+	PagesPrinted uint32
+	// Status flags decoded, see lib.JobStatusNames, and the status the port
+	// monitor or driver set, if any.
+	StatusNames []string
+	StatusText  string
+	// What the job prints with; nil when it has no DEVMODE.
+	DevMode *lib.DevModeSummary
+	// Security identifier of the owner, such as S-1-5-21-...; empty when
+	// the user isn't known to the machine.
+	OwnerSID string
+}
+
+// JobListDetailed lists the jobs of a printer with their JOB_INFO_2 data,
+// which takes more of the spooler than JobList.
+func (ws *WinSpool) JobListDetailed(printerName string) ([]JobDetails, error) {
+	if err := ws.Faults.Inject("JobList", printerName); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtualJobListDetailed(printerName), nil
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	jobs2, err := ws.enumJobs2(&hPrinter, printerName, 0)
+	if err != nil {
+		return nil, err
+	}
+	jobs := make([]JobDetails, len(jobs2))
+	for i := range jobs2 {
+		ji2 := &jobs2[i]
+		jobs[i] = JobDetails{
+			Job: Job{
+				Status:         ji2.GetStatus(),
+				Priority:       ji2.GetPriority(),
+				Position:       ji2.GetPosition(),
+				Size:           ji2.GetSize(),
+				PrinterName:    ji2.GetPrinterName(),
+				DriverName:     ji2.GetDriverName(),
+				Document:       ji2.GetDocument(),
+				PrintProcessor: ji2.GetPrintProcessor(),
+				Datatype:       ji2.GetDatatype(),
+				JobID:          ji2.GetJobID(),
+				MachineName:    ji2.GetMachineName(),
+				UserName:       ji2.GetUserName(),
+			},
+			Submitted:    ji2.GetSubmitted(),
+			TotalPages:   ji2.GetTotalPages(),
+			PagesPrinted: ji2.GetPagesPrinted(),
+			StatusNames:  lib.JobStatusNames(ji2.GetStatus()),
+			StatusText:   ji2.GetStatusText(),
+			OwnerSID:     ji2.GetOwnerSID(),
+		}
+		if devMode := ji2.GetDevMode(); devMode != nil {
+			summary := lib.SummarizeDevMode(devMode)
+			jobs[i].DevMode = &summary
+		}
+		if jobs[i].OwnerSID == "" {
+			jobs[i].OwnerSID = ws.userSID(jobs[i].UserName)
+		}
+	}
+	return jobs, nil
+}
+
+// userSID looks up the security identifier of a user, for jobs the spooler
+// returns without a security descriptor. Lookups of domain users ask a
+// domain controller, so they are kept, failures included.
+func (ws *WinSpool) userSID(userName string) string {
+	if userName == "" {
+		return ""
+	}
+	if sid, ok := ws.userSIDs.Load(userName); ok {
+		return sid.(string)
+	}
+	var s string
+	if sid, _, _, err := windows.LookupSID("", userName); err == nil {
+		s = sid.String()
+	}
+	ws.userSIDs.Store(userName, s)
+	return s
+}
+
+func (ws *WinSpool) virtualJobListDetailed(printerName string) []JobDetails {
+	simJobs := ws.virtual.Jobs(printerName)
+	jobs := make([]JobDetails, len(simJobs))
+	for i := range simJobs {
+		summary := lib.SummarizeDevMode(&simJobs[i].DevMode)
+		jobs[i] = JobDetails{
+			Job:          newVirtualJob(&simJobs[i], i),
+			Submitted:    simJobs[i].Submitted.UTC(),
+			TotalPages:   uint32(simJobs[i].Pages),
+			PagesPrinted: uint32(simJobs[i].PagesPrinted),
+			StatusNames:  lib.JobStatusNames(simJobs[i].Status),
+			DevMode:      &summary,
+		}
+	}
+	return jobs
+}
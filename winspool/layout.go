@@ -0,0 +1,118 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"io/ioutil"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Font of layout documents when WinSpool.LayoutFont is empty.
+const defaultLayoutFont = "Arial"
+
+// Width of rules in layout documents, in points.
+const layoutRuleWidth = 0.5
+
+// layoutToPDF renders a layout document to PDF, on pages of the ticket
+// media size, A4 when it has none, unless the layout has its own.
+func (ws *WinSpool) layoutToPDF(source, pdf string, ticket *model.JobTicket) error {
+	data, err := ioutil.ReadFile(source)
+	if err != nil {
+		return err
+	}
+	layout, err := lib.ParseLayout(data)
+	if err != nil {
+		return err
+	}
+
+	widthMicrons, heightMicrons := lib.DefaultHTMLPageOptions.WidthMicrons, lib.DefaultHTMLPageOptions.HeightMicrons
+	if ticket != nil && ticket.MediaSize != nil && ticket.MediaSize.WidthMicrons > 0 && ticket.MediaSize.HeightMicrons > 0 {
+		widthMicrons, heightMicrons = ticket.MediaSize.WidthMicrons, ticket.MediaSize.HeightMicrons
+	}
+	width, height := layout.PageSize(widthMicrons, heightMicrons)
+
+	font := ws.LayoutFont
+	if font == "" {
+		font = defaultLayoutFont
+	}
+	return writeLayoutPDF(pdf, width, height, font, func(measure lib.TextMeasurer) ([]lib.LayoutPage, error) {
+		return layout.Pages(width, height, measure), nil
+	})
+}
+
+// writeLayoutPDF writes the pages layOut places, measuring text in font, to
+// a PDF of pages width by height points.
+func writeLayoutPDF(pdf string, width, height float64, font string, layOut func(measure lib.TextMeasurer) ([]lib.LayoutPage, error)) error {
+	surface, err := CairoPDFSurfaceCreate(pdf, width, height)
+	if err != nil {
+		return err
+	}
+	defer surface.Destroy()
+	context, err := CairoCreateContext(surface)
+	if err != nil {
+		return err
+	}
+	defer context.Destroy()
+
+	setFont := func(size float64, bold bool) error {
+		if err := context.SelectFontFace(font, bold); err != nil {
+			return err
+		}
+		return context.SetFontSize(size)
+	}
+	// Measuring errors surface when drawing.
+	measure := func(text string, size float64, bold bool) float64 {
+		if setFont(size, bold) != nil {
+			return 0
+		}
+		width, _ := context.TextWidth(text)
+		return width
+	}
+
+	pages, err := layOut(measure)
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		for _, text := range page.Texts {
+			if err = setFont(text.Size, text.Bold); err != nil {
+				return err
+			}
+			if err = context.MoveTo(text.X, text.Y); err != nil {
+				return err
+			}
+			if err = context.ShowText(text.Text); err != nil {
+				return err
+			}
+		}
+		if len(page.Rules) > 0 {
+			if err = context.SetLineWidth(layoutRuleWidth); err != nil {
+				return err
+			}
+			for _, rule := range page.Rules {
+				if err = context.MoveTo(rule.X1, rule.Y); err != nil {
+					return err
+				}
+				if err = context.LineTo(rule.X2, rule.Y); err != nil {
+					return err
+				}
+			}
+			if err = context.Stroke(); err != nil {
+				return err
+			}
+		}
+		if err = surface.ShowPage(); err != nil {
+			return err
+		}
+	}
+	return surface.Finish()
+}
@@ -0,0 +1,87 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// MergeDocuments merges documents into one file, to be printed as a single
+// job: PDF, PostScript, HTML and web pages are converted as for printing,
+// and merged into one PDF with Ghostscript; ZPL or ESC/POS documents are
+// concatenated. Returns the merged file, and a function that removes it.
+func (ws *WinSpool) MergeDocuments(fileNames []string, ticket *model.JobTicket) (string, func(), error) {
+	if len(fileNames) == 0 {
+		return "", nil, fmt.Errorf("MergeDocuments() called without documents")
+	}
+	var prepared []string
+	var mergedType string
+	for _, fileName := range fileNames {
+		preparedName, contentType, cleanup, err := ws.prepareDocument(fileName, ticket)
+		if err != nil {
+			return "", nil, err
+		}
+		defer cleanup()
+		if contentType != lib.ContentTypePDF && !lib.IsRawContentType(contentType) {
+			return "", nil, fmt.Errorf("%s: %s documents can't be merged", fileName, contentType)
+		}
+		if mergedType == "" {
+			mergedType = contentType
+		} else if contentType != mergedType {
+			return "", nil, fmt.Errorf("%s: %s documents can't be merged with %s documents", fileName, contentType, mergedType)
+		}
+		prepared = append(prepared, preparedName)
+	}
+
+	if mergedType == lib.ContentTypePDF {
+		gsPath, err := lib.FindGhostscript(ws.GhostscriptPath)
+		if err != nil {
+			return "", nil, fmt.Errorf("merging PDF documents: %s", err)
+		}
+		merged, _, cleanup, err := ws.convertToPDF(func(pdf string) error {
+			return lib.GhostscriptMergePDF(gsPath, prepared, pdf)
+		})
+		return merged, cleanup, err
+	}
+
+	merged, err := ioutil.TempFile("", "winspool-merged-*")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(merged.Name()) }
+	for _, fileName := range prepared {
+		if err = appendFile(merged, fileName); err != nil {
+			merged.Close()
+			cleanup()
+			return "", nil, err
+		}
+	}
+	if err = merged.Close(); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return merged.Name(), cleanup, nil
+}
+
+func appendFile(w io.Writer, fileName string) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,75 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows && !cgo
+// +build windows,!cgo
+
+package winspool
+
+// Without cgo, Poppler and Cairo are left out: printers are enumerated and
+// RAW, plain text and pdf_direct jobs print through winspool.drv alone, and
+// documents that need rendering fail with ErrNoRenderer.
+
+const renderingAvailable = false
+
+type CairoSurface uintptr
+type CairoContext uintptr
+type CairoMatrix struct{ xx, yx, xy, yy, x0, y0 float64 }
+
+type PopplerDocument uintptr
+type PopplerPage uintptr
+
+func CairoWin32PrintingSurfaceCreate(hDC HDC) (CairoSurface, error) { return 0, ErrNoRenderer }
+func (s CairoSurface) ShowPage() error                              { return ErrNoRenderer }
+func (s CairoSurface) Finish() error                                { return ErrNoRenderer }
+func (s *CairoSurface) Destroy() error                              { return nil }
+func (s *CairoSurface) GetDeviceOffset() (float64, float64, error)  { return 0, 0, ErrNoRenderer }
+func (s *CairoSurface) GetDeviceScale() (float64, float64, error)   { return 0, 0, ErrNoRenderer }
+func (s *CairoSurface) SetFallbackResolution(xPPI, yPPI float64) error {
+	return ErrNoRenderer
+}
+func (s CairoSurface) SetDeviceScale(xScale, yScale float64) error { return ErrNoRenderer }
+func (s CairoSurface) SetPDFSize(width, height float64) error      { return ErrNoRenderer }
+func CairoPDFSurfaceCreate(filename string, width, height float64) (CairoSurface, error) {
+	return 0, ErrNoRenderer
+}
+func CairoImageSurfaceCreateRGB24(width, height int) (CairoSurface, error) { return 0, ErrNoRenderer }
+func (s CairoSurface) ImageData() ([]byte, int)                            { return nil, 0 }
+func (s CairoSurface) Flush() error                                        { return ErrNoRenderer }
+func (s CairoSurface) MarkDirty() error                                    { return ErrNoRenderer }
+
+func CairoCreateContext(surface CairoSurface) (CairoContext, error) { return 0, ErrNoRenderer }
+func (c *CairoContext) Destroy() error                              { return nil }
+func (c CairoContext) Save() error                                  { return ErrNoRenderer }
+func (c CairoContext) Restore() error                               { return ErrNoRenderer }
+func (c CairoContext) IdentityMatrix() error                        { return ErrNoRenderer }
+func (c CairoContext) GetMatrix() (*CairoMatrix, error)             { return nil, ErrNoRenderer }
+func (c CairoContext) Translate(x, y float64) error                 { return ErrNoRenderer }
+func (c CairoContext) Scale(x, y float64) error                     { return ErrNoRenderer }
+func (c CairoContext) Clip() error                                  { return ErrNoRenderer }
+func (c CairoContext) Rectangle(x, y, width, height float64) error  { return ErrNoRenderer }
+func (c CairoContext) SetSourceSurface(surface CairoSurface, x, y float64) error {
+	return ErrNoRenderer
+}
+func (c CairoContext) SetSourceRGB(red, green, blue float64) error   { return ErrNoRenderer }
+func (c CairoContext) Paint() error                                  { return ErrNoRenderer }
+func (c CairoContext) SelectFontFace(family string, bold bool) error { return ErrNoRenderer }
+func (c CairoContext) SetFontSize(size float64) error                { return ErrNoRenderer }
+func (c CairoContext) TextWidth(text string) (float64, error)        { return 0, ErrNoRenderer }
+func (c CairoContext) ShowText(text string) error                    { return ErrNoRenderer }
+func (c CairoContext) MoveTo(x, y float64) error                     { return ErrNoRenderer }
+func (c CairoContext) LineTo(x, y float64) error                     { return ErrNoRenderer }
+func (c CairoContext) SetLineWidth(width float64) error              { return ErrNoRenderer }
+func (c CairoContext) Stroke() error                                 { return ErrNoRenderer }
+func (c CairoContext) Fill() error                                   { return ErrNoRenderer }
+
+func PopplerDocumentNewFromFile(filename string) (PopplerDocument, error) { return 0, ErrNoRenderer }
+func (d PopplerDocument) GetNPages() int                                  { return 0 }
+func (d PopplerDocument) GetPage(index int) PopplerPage                   { return 0 }
+func (d *PopplerDocument) Unref()                                         {}
+func (p PopplerPage) GetSize() (float64, float64, error)                  { return 0, 0, ErrNoRenderer }
+func (p PopplerPage) RenderForPrinting(context CairoContext)              {}
+func (p *PopplerPage) Unref()                                             {}
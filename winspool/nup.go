@@ -0,0 +1,132 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// printSheet prints the document pages i on one sheet side, N-up or as a
+// booklet: each is scaled into its cell of the printable area, in layout
+// order, and lib.BookletBlank cells are left empty. The N-up grid is chosen
+// for the size of the first page.
+func printSheet(printerName string, pages []int, c *jobContext, settings lib.TicketSettings) error {
+	wPaperPoints, hPaperPoints, printable, err := c.sheetArea(printerName)
+	if err != nil {
+		return err
+	}
+
+	if settings.Placement.Margins != nil {
+		if printable, err = settings.Placement.Area(wPaperPoints, hPaperPoints, printable); err != nil {
+			return err
+		}
+	}
+
+	var cells []lib.NUpCell
+	if settings.Booklet {
+		cells = lib.BookletCells(printable)
+	} else {
+		first := c.pDoc.GetPage(pages[0])
+		wFirst, hFirst, err := first.GetSize()
+		first.Unref()
+		if err != nil {
+			return err
+		}
+		cells = lib.NUpCells(settings.NUp, settings.NUpLayout, printable.X, printable.Y, printable.Width, printable.Height, wFirst, hFirst)
+	}
+
+	// A document page of the paper size is drawn at scale 1, so that the
+	// context is in points from the paper corner.
+	if err := c.startPage(printerName, wPaperPoints, hPaperPoints, lib.PagePlacement{}); err != nil {
+		return err
+	}
+	defer c.afterRender(func() { c.endPage() })
+
+	for k, i := range pages {
+		if i == lib.BookletBlank {
+			continue
+		}
+		if err := printCell(i, cells[k], c); err != nil {
+			return err
+		}
+	}
+	return c.finishPage()
+}
+
+// printBlankSide prints an empty sheet side, so that the next software
+// copy of a duplex job starts on a new sheet.
+func printBlankSide(printerName string, c *jobContext) error {
+	wPaperPoints, hPaperPoints, _, err := c.sheetArea(printerName)
+	if err != nil {
+		return err
+	}
+	if err := c.startPage(printerName, wPaperPoints, hPaperPoints, lib.PagePlacement{}); err != nil {
+		return err
+	}
+	defer c.afterRender(func() { c.endPage() })
+	return c.finishPage()
+}
+
+func printCell(i int, cell lib.NUpCell, c *jobContext) error {
+	pPage := c.pDoc.GetPage(i)
+	defer c.afterRender(func() { pPage.Unref() })
+
+	wDocPoints, hDocPoints, err := pPage.GetSize()
+	if err != nil {
+		return err
+	}
+	scale, xOffsetPoints, yOffsetPoints := cell.Fit(wDocPoints, hDocPoints)
+
+	if err := c.cContext.Save(); err != nil {
+		return err
+	}
+	// Restored once the page no longer renders, whether it failed or not.
+	defer c.afterRender(func() { c.cContext.Restore() })
+	if err := c.cContext.Translate(xOffsetPoints, yOffsetPoints); err != nil {
+		return err
+	}
+	if err := c.cContext.Scale(scale, scale); err != nil {
+		return err
+	}
+	var renderErr error
+	if err := c.render(func() { renderErr = pPage.RenderForPrinting(c.cContext, c.deviceScale()) }); err != nil {
+		// The page and context are still in use; release them when done.
+		return err
+	}
+	return renderErr
+}
+
+// deviceScale returns the pixels of the printer per point, the unit of the
+// surfaces pages are drawn on, for renderers that draw images.
+func (c *jobContext) deviceScale() float64 {
+	return float64(c.hDC.GetDeviceCaps(LOGPIXELSX)) / 72
+}
+
+// sheetArea returns the paper size, and the area of it the printer can
+// print on, in points, with the DEVMODE of the job.
+func (c *jobContext) sheetArea(printerName string) (wPaperPoints, hPaperPoints float64, printable lib.NUpCell, err error) {
+	if err = c.hPrinter.DocumentPropertiesSet(printerName, c.devMode); err != nil {
+		return
+	}
+	if err = c.hDC.ResetDC(c.devMode); err != nil {
+		return
+	}
+	xDPI, yDPI := float64(c.hDC.GetDeviceCaps(LOGPIXELSX)), float64(c.hDC.GetDeviceCaps(LOGPIXELSY))
+	points := func(pixels int32, dpi float64) float64 { return float64(pixels) * 72 / dpi }
+	wPaperPoints = points(c.hDC.GetDeviceCaps(PHYSICALWIDTH), xDPI)
+	hPaperPoints = points(c.hDC.GetDeviceCaps(PHYSICALHEIGHT), yDPI)
+	printable = lib.NUpCell{
+		X:      points(c.hDC.GetDeviceCaps(PHYSICALOFFSETX), xDPI),
+		Y:      points(c.hDC.GetDeviceCaps(PHYSICALOFFSETY), yDPI),
+		Width:  points(c.hDC.GetDeviceCaps(HORZRES), xDPI),
+		Height: points(c.hDC.GetDeviceCaps(VERTRES), yDPI),
+	}
+	return
+}
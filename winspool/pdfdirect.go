@@ -0,0 +1,54 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"log"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// sendsPDFDirect tells whether PDFs are sent as-is to a printer in a RAW
+// job: its pdf_direct when configured, else whether its driver speaks PDF
+// with DetectPDFDirect.
+func (ws *WinSpool) sendsPDFDirect(printerName string) bool {
+	if direct, ok := ws.pdfDirect[printerName]; ok {
+		return direct
+	}
+	if !ws.DetectPDFDirect || ws.isVirtual(printerName) {
+		return false
+	}
+	speaks, err := ws.speaksPDF(printerName)
+	if err != nil {
+		log.Printf("Failed to find whether the driver of printer %s speaks PDF, rendering PDFs: %s", printerName, err)
+		return false
+	}
+	return speaks
+}
+
+// speaksPDF tells whether the driver of a printer interprets PDF itself,
+// from the capabilities GetPrinters cached when still current, else from
+// the driver.
+func (ws *WinSpool) speaksPDF(printerName string) (bool, error) {
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return false, err
+	}
+	defer hPrinter.ClosePrinter()
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return false, err
+	}
+	if capabilities, ok := ws.capabilities.Get(printerName, capabilityCacheKey(pi2)); ok {
+		return capabilities.SpeaksPDF, nil
+	}
+	portName := pi2.GetPortName()
+	return lib.SpeaksPDF(portName, getPersonalities(printerName, portName)), nil
+}
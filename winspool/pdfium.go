@@ -0,0 +1,203 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows && cgo && pdfium
+// +build windows,cgo,pdfium
+
+package winspool
+
+/*
+#cgo LDFLAGS: -lpdfium
+
+#include <fpdfview.h>
+#include <stdlib.h> // free
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Highest resolution PDFium draws pages at, which bounds the images of
+// pages on high resolution printers.
+const pdfiumMaxDPI = 600
+
+// PDFium isn't thread-safe: every call holds pdfiumLock.
+var (
+	pdfiumLock sync.Mutex
+	pdfiumInit sync.Once
+)
+
+func init() {
+	pdfRenderers[PDFRendererPDFium] = pdfiumRenderer{}
+}
+
+func pdfiumLastError() error {
+	switch C.FPDF_GetLastError() {
+	case C.FPDF_ERR_FILE:
+		return errors.New("PDFium: file not found or could not be opened")
+	case C.FPDF_ERR_FORMAT:
+		return errors.New("PDFium: file not in PDF format or corrupted")
+	case C.FPDF_ERR_PASSWORD:
+		return errors.New("PDFium: password required or incorrect password")
+	case C.FPDF_ERR_SECURITY:
+		return errors.New("PDFium: unsupported security scheme")
+	case C.FPDF_ERR_PAGE:
+		return errors.New("PDFium: page not found or content error")
+	}
+	return errors.New("PDFium: unknown error")
+}
+
+// pdfiumRenderer opens PDFs with PDFium, which draws pages on images at
+// the device resolution, that Cairo then draws.
+type pdfiumRenderer struct{}
+
+func (pdfiumRenderer) Open(fileName string, limits lib.RenderLimits) (PDFDocument, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("PDFium: empty file")
+	}
+
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	pdfiumInit.Do(func() { C.FPDF_InitLibrary() })
+
+	// PDFium reads the document from memory as long as it is open.
+	buffer := C.CBytes(data)
+	doc := C.FPDF_LoadMemDocument(buffer, C.int(len(data)), nil)
+	if doc == nil {
+		err := pdfiumLastError()
+		C.free(buffer)
+		return nil, err
+	}
+	return &pdfiumDocument{doc: doc, buffer: buffer, limits: limits}, nil
+}
+
+type pdfiumDocument struct {
+	doc    C.FPDF_DOCUMENT
+	buffer unsafe.Pointer
+	limits lib.RenderLimits
+}
+
+func (d *pdfiumDocument) GetNPages() int {
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	return int(C.FPDF_GetPageCount(d.doc))
+}
+
+func (d *pdfiumDocument) GetPage(index int) PDFPage {
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	return &pdfiumPage{page: C.FPDF_LoadPage(d.doc, C.int(index)), limits: d.limits}
+}
+
+func (d *pdfiumDocument) Unref() {
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	if d.doc != nil {
+		C.FPDF_CloseDocument(d.doc)
+		C.free(d.buffer)
+		d.doc, d.buffer = nil, nil
+	}
+}
+
+type pdfiumPage struct {
+	// Nil when the page failed to load.
+	page   C.FPDF_PAGE
+	limits lib.RenderLimits
+}
+
+func (p *pdfiumPage) GetSize() (float64, float64, error) {
+	if p.page == nil {
+		return 0, 0, errors.New("PDFium: page not found or content error")
+	}
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	return float64(C.FPDF_GetPageWidth(p.page)), float64(C.FPDF_GetPageHeight(p.page)), nil
+}
+
+// RenderForPrinting draws the page on an image, of the pixels the page
+// covers on the device up to pdfiumMaxDPI, which is then drawn on context.
+func (p *pdfiumPage) RenderForPrinting(context CairoContext, deviceScale float64) error {
+	wPoints, hPoints, err := p.GetSize()
+	if err != nil {
+		return err
+	}
+	m, err := context.GetMatrix()
+	if err != nil {
+		return err
+	}
+	pixelsPerPoint := math.Hypot(m.xx, m.yx) * deviceScale
+	if pixelsPerPoint > pdfiumMaxDPI/72 {
+		pixelsPerPoint = pdfiumMaxDPI / 72
+	}
+	width, height := int(math.Ceil(wPoints*pixelsPerPoint)), int(math.Ceil(hPoints*pixelsPerPoint))
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("PDFium: page of %gx%g points has no pixels", wPoints, hPoints)
+	}
+	if err = p.limits.CheckImage(width, height); err != nil {
+		return err
+	}
+
+	surface, err := CairoImageSurfaceCreateRGB24(width, height)
+	if err != nil {
+		return err
+	}
+	defer surface.Destroy()
+	if err = surface.Flush(); err != nil {
+		return err
+	}
+	data, stride := surface.ImageData()
+	err = func() error {
+		pdfiumLock.Lock()
+		defer pdfiumLock.Unlock()
+		// Cairo RGB24 is BGRx in memory, which PDFium draws into as is.
+		bitmap := C.FPDFBitmap_CreateEx(C.int(width), C.int(height), C.FPDFBitmap_BGRx, unsafe.Pointer(&data[0]), C.int(stride))
+		if bitmap == nil {
+			return fmt.Errorf("PDFium: failed to create a %dx%d bitmap", width, height)
+		}
+		defer C.FPDFBitmap_Destroy(bitmap)
+		C.FPDFBitmap_FillRect(bitmap, 0, 0, C.int(width), C.int(height), 0xFFFFFFFF)
+		C.FPDF_RenderPageBitmap(bitmap, p.page, 0, 0, C.int(width), C.int(height), 0, C.FPDF_ANNOT|C.FPDF_PRINTING)
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+	if err = surface.MarkDirty(); err != nil {
+		return err
+	}
+
+	if err = context.Save(); err != nil {
+		return err
+	}
+	defer context.Restore()
+	if err = context.Scale(wPoints/float64(width), hPoints/float64(height)); err != nil {
+		return err
+	}
+	if err = context.SetSourceSurface(surface, 0, 0); err != nil {
+		return err
+	}
+	return context.Paint()
+}
+
+func (p *pdfiumPage) Unref() {
+	pdfiumLock.Lock()
+	defer pdfiumLock.Unlock()
+	if p.page != nil {
+		C.FPDF_ClosePage(p.page)
+		p.page = nil
+	}
+}
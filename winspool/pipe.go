@@ -0,0 +1,127 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// ErrPipeClosed is returned by Accept once the listener is closed.
+var ErrPipeClosed = errors.New("pipe listener closed")
+
+// Local users may write to job pipes, like to a shared printer; SYSTEM and
+// administrators have full access.
+const pipeSDDL = "D:P(A;;GA;;;SY)(A;;GA;;;BA)(A;;GRGW;;;AU)"
+
+// PipeListener accepts clients of a named pipe, \\.\pipe\<name>, such as
+// legacy applications that can only print to a port or a pipe. Remote
+// clients are rejected.
+type PipeListener struct {
+	path string
+	sa   *windows.SecurityAttributes
+
+	mu     sync.Mutex
+	closed bool
+	// Instance of the pipe waiting for the next client.
+	handle windows.Handle
+}
+
+// ListenPipe creates the pipe; it fails when another process has a pipe of
+// that name.
+func ListenPipe(name string) (*PipeListener, error) {
+	sd, err := windows.SecurityDescriptorFromString(pipeSDDL)
+	if err != nil {
+		return nil, err
+	}
+	l := &PipeListener{
+		path: `\\.\pipe\` + name,
+		sa:   &windows.SecurityAttributes{SecurityDescriptor: sd},
+	}
+	l.sa.Length = uint32(unsafe.Sizeof(*l.sa))
+	if l.handle, err = l.newInstance(true); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *PipeListener) newInstance(first bool) (windows.Handle, error) {
+	path, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	var flags uint32 = windows.PIPE_ACCESS_INBOUND
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	return windows.CreateNamedPipe(path, flags,
+		windows.PIPE_TYPE_BYTE|windows.PIPE_READMODE_BYTE|windows.PIPE_WAIT|windows.PIPE_REJECT_REMOTE_CLIENTS,
+		windows.PIPE_UNLIMITED_INSTANCES, 0, 64*1024, 0, l.sa)
+}
+
+// Accept waits for a client, and returns what it writes, which ends when it
+// closes its end. Calls must not be concurrent.
+func (l *PipeListener) Accept() (io.ReadCloser, error) {
+	l.mu.Lock()
+	h, closed := l.handle, l.closed
+	l.mu.Unlock()
+	if closed {
+		windows.CloseHandle(h)
+		return nil, ErrPipeClosed
+	}
+
+	// A client that connected before the call is already connected.
+	if err := windows.ConnectNamedPipe(h, nil); err != nil && err != windows.ERROR_PIPE_CONNECTED {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		windows.CloseHandle(h)
+		return nil, ErrPipeClosed
+	}
+	next, err := l.newInstance(false)
+	if err != nil {
+		windows.CloseHandle(h)
+		l.closed = true
+		return nil, err
+	}
+	l.handle = next
+	return os.NewFile(uintptr(h), l.path), nil
+}
+
+// Close stops accepting clients, and makes a pending Accept return
+// ErrPipeClosed. Clients already accepted can still be read.
+func (l *PipeListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	// ConnectNamedPipe can't be interrupted; connect to end it. This fails
+	// when Accept already returned, and closed the pipe.
+	path, err := windows.UTF16PtrFromString(l.path)
+	if err != nil {
+		return err
+	}
+	if h, err := windows.CreateFile(path, windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, 0, 0); err == nil {
+		windows.CloseHandle(h)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"math"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Resolution of pages rendered in parallel, when WinSpool.RenderDPI is zero.
+const defaultRenderDPI = 300
+
+// Pages rendered ahead of the one spooling, per worker.
+const pagesAheadPerWorker = 2
+
+// renderedPDFPage is a PDF page rendered to an image by a worker.
+type renderedPDFPage struct {
+	surface                CairoSurface
+	wDocPoints, hDocPoints float64
+}
+
+// printPagesParallel prints PDF pages, by index, rendered to images at up
+// to RenderDPI on RenderWorkers workers, each with its own document, while
+// the previous pages spool. A BookletBlank index prints a blank side; total
+// is the number of pages reported as progress.
+func (ws *WinSpool) printPagesParallel(printerName, fileName string, pages []int, total int, c *jobContext, placement lib.PagePlacement, result *lib.PrintResult, progress lib.ProgressFunc) error {
+	dpi := float64(ws.RenderDPI)
+	if dpi <= 0 {
+		dpi = defaultRenderDPI
+	}
+	if deviceDPI := float64(c.hDC.GetDeviceCaps(LOGPIXELSX)); deviceDPI > 0 && deviceDPI < dpi {
+		dpi = deviceDPI
+	}
+
+	renderer, err := ws.pdfRenderer(printerName)
+	if err != nil {
+		return err
+	}
+	docs := make([]PDFDocument, ws.RenderWorkers)
+	unref := func() {
+		for i := range docs {
+			if docs[i] != nil {
+				docs[i].Unref()
+			}
+		}
+	}
+	for i := range docs {
+		if docs[i], err = renderer.Open(fileName, ws.RenderLimits); err != nil {
+			unref()
+			return err
+		}
+	}
+
+	rendering := make(chan struct{})
+	pipeline := lib.PagePipeline{
+		Workers:     len(docs),
+		Ahead:       len(docs) * pagesAheadPerWorker,
+		PageTimeout: c.pageTimeout,
+		Render: func(worker, i int) (interface{}, error) {
+			if pages[i] == lib.BookletBlank {
+				return (*renderedPDFPage)(nil), nil
+			}
+			return renderPDFPage(docs[worker], pages[i], dpi, ws.RenderLimits)
+		},
+		Write: func(i int, page interface{}) error {
+			rendered := page.(*renderedPDFPage)
+			if rendered == nil {
+				return printBlankSide(printerName, c)
+			}
+			defer rendered.surface.Destroy()
+			pageStart := time.Now()
+			if err := c.printImagePage(printerName, rendered.surface, rendered.wDocPoints, rendered.hDocPoints, dpi, dpi, placement); err != nil {
+				return err
+			}
+			result.Pages++
+			result.PageDurations = append(result.PageDurations, time.Since(pageStart))
+			c.reportProgress(progress, result.Pages, total)
+			return nil
+		},
+		Discard: func(page interface{}) {
+			if rendered := page.(*renderedPDFPage); rendered != nil {
+				rendered.surface.Destroy()
+			}
+		},
+		Finished: func() {
+			unref()
+			close(rendering)
+		},
+	}
+	err = pipeline.Run(len(pages))
+	select {
+	case <-rendering:
+	default:
+		// A page timed out; free the job once its render returns.
+		c.rendering = rendering
+	}
+	return err
+}
+
+// renderPDFPage renders a page to an image surface, on white, at dpi.
+func renderPDFPage(doc PDFDocument, index int, dpi float64, limits lib.RenderLimits) (*renderedPDFPage, error) {
+	pPage := doc.GetPage(index)
+	defer pPage.Unref()
+	wDocPoints, hDocPoints, err := pPage.GetSize()
+	if err != nil {
+		return nil, err
+	}
+	width, height := int(math.Ceil(wDocPoints*dpi/72)), int(math.Ceil(hDocPoints*dpi/72))
+	if err = limits.CheckImage(width, height); err != nil {
+		return nil, err
+	}
+
+	surface, err := CairoImageSurfaceCreateRGB24(width, height)
+	if err != nil {
+		return nil, err
+	}
+	err = func() error {
+		context, err := CairoCreateContext(surface)
+		if err != nil {
+			return err
+		}
+		defer context.Destroy()
+		if err = context.SetSourceRGB(1, 1, 1); err != nil {
+			return err
+		}
+		if err = context.Paint(); err != nil {
+			return err
+		}
+		if err = context.Scale(dpi/72, dpi/72); err != nil {
+			return err
+		}
+		// The image is in pixels.
+		if err = pPage.RenderForPrinting(context, 1); err != nil {
+			return err
+		}
+		return surface.Flush()
+	}()
+	if err != nil {
+		surface.Destroy()
+		return nil, err
+	}
+	return &renderedPDFPage{surface: surface, wDocPoints: wDocPoints, hDocPoints: hDocPoints}, nil
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// Default port numbers of Standard TCP/IP ports.
+const (
+	DefaultRawPortNumber = 9100
+	DefaultLPRPortNumber = 515
+)
+
+// tcpIPPortMonitor is the port monitor of Standard TCP/IP ports.
+const tcpIPPortMonitor = "Standard TCP/IP Port"
+
+// Port is a port printers print to.
+type Port struct {
+	Name string
+	// The port monitor, such as Standard TCP/IP Port or Local Port.
+	Monitor     string
+	Description string
+	// PORT_TYPE_* flags.
+	Type uint32
+}
+
+// Ports lists the ports of Server, this computer by default.
+func (ws *WinSpool) Ports() ([]Port, error) {
+	if err := ws.Faults.Inject("Ports", ""); err != nil {
+		return nil, err
+	}
+	var pi2s []PortInfo2
+	err := ws.Retry.Do("EnumPorts", func() error {
+		var err error
+		pi2s, err = EnumPorts2(ws.Server)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]Port, len(pi2s))
+	for i := range pi2s {
+		ports[i] = Port{
+			Name:        pi2s[i].GetPortName(),
+			Monitor:     pi2s[i].GetMonitorName(),
+			Description: pi2s[i].GetDescription(),
+			Type:        pi2s[i].GetPortType(),
+		}
+	}
+	return ports, nil
+}
+
+// TCPIPPort is a Standard TCP/IP port to add with AddTCPIPPort.
+type TCPIPPort struct {
+	// Defaults to IP_<HostAddress>, as Add Printer names ports.
+	Name string
+	// IP address or host name of the printer.
+	HostAddress string
+	// LPR prints to Queue over LPR, rather than RAW over a socket.
+	LPR   bool
+	Queue string
+	// Defaults to DefaultRawPortNumber or DefaultLPRPortNumber.
+	PortNumber uint32
+	// SNMPCommunity, when set, makes the monitor read the status of the
+	// printer over SNMP.
+	SNMPCommunity string
+}
+
+// AddTCPIPPort adds a Standard TCP/IP port on Server, this computer by
+// default, for printers added with AddPrinter to print to, and returns its
+// name.
+func (ws *WinSpool) AddTCPIPPort(port TCPIPPort) (string, error) {
+	if err := ws.Faults.Inject("AddTCPIPPort", port.HostAddress); err != nil {
+		return "", err
+	}
+	if port.HostAddress == "" {
+		return "", errors.New("a TCP/IP port needs the address of the printer")
+	}
+	if port.LPR && port.Queue == "" {
+		return "", errors.New("an LPR port needs a queue name")
+	}
+	if port.Name == "" {
+		port.Name = "IP_" + port.HostAddress
+	}
+
+	data := PortData1{dwVersion: 1}
+	data.cbSize = uint32(unsafe.Sizeof(data))
+	data.dwProtocol, data.dwPortNumber = PROTOCOL_RAWTCP_TYPE, DefaultRawPortNumber
+	if port.LPR {
+		data.dwProtocol, data.dwPortNumber = PROTOCOL_LPR_TYPE, DefaultLPRPortNumber
+	}
+	if port.PortNumber != 0 {
+		data.dwPortNumber = port.PortNumber
+	}
+	if port.SNMPCommunity != "" {
+		data.dwSNMPEnabled, data.dwSNMPDevIndex = 1, 1
+	}
+	fields := []struct {
+		field []uint16
+		value string
+		what  string
+	}{
+		{data.sztPortName[:], port.Name, "port name"},
+		{data.sztHostAddress[:], port.HostAddress, "printer address"},
+		{data.sztQueue[:], port.Queue, "queue name"},
+		{data.sztSNMPCommunity[:], port.SNMPCommunity, "SNMP community"},
+	}
+	for _, f := range fields {
+		if err := copyUTF16(f.field, f.value); err != nil {
+			return "", fmt.Errorf("%s %q: %s", f.what, f.value, err)
+		}
+	}
+
+	xcvName := ",XcvMonitor " + tcpIPPortMonitor
+	if ws.Server != "" {
+		xcvName = ws.Server + `\` + xcvName
+	}
+	hXcv, err := ws.openPrinterAccess(xcvName, SERVER_ACCESS_ADMINISTER)
+	if err != nil {
+		return "", accessError(err, "adding port "+port.Name)
+	}
+	defer hXcv.ClosePrinter()
+
+	if err = hXcv.XcvData("AddPort", unsafe.Pointer(&data), data.cbSize); err != nil {
+		if errors.Is(err, ERROR_ALREADY_EXISTS) {
+			return "", fmt.Errorf("port %s already exists", port.Name)
+		}
+		return "", accessError(err, "adding port "+port.Name)
+	}
+	return port.Name, nil
+}
+
+// copyUTF16 copies s, NUL terminated, into a fixed-size string field.
+func copyUTF16(dst []uint16, s string) error {
+	u, err := syscall.UTF16FromString(s)
+	if err != nil {
+		return err
+	}
+	if len(u) > len(dst) {
+		return fmt.Errorf("longer than %d characters", len(dst)-1)
+	}
+	copy(dst, u)
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Preflight checks a document before it is printed, as Simulate does, and
+// reports its page count, the sizes of its pages and the scale they print
+// at on the paper of the ticket, and the sheets of the job. PDFs that are
+// encrypted, corrupt, have no pages or pages of impossible sizes fail with
+// a lib.PreflightError, as they do when printed.
+func (ws *WinSpool) Preflight(printer *lib.Printer, fileName string, ticket *model.JobTicket) (*lib.PreflightReport, error) {
+	if printer == nil {
+		return nil, errors.New("Preflight() called with nil printer")
+	}
+	if ticket == nil {
+		return nil, errors.New("Preflight() called with nil ticket")
+	}
+	report := lib.PreflightReport{PageSizes: []lib.PreflightPageSize{}}
+	if !lib.IsURL(fileName) {
+		if contentType, err := lib.DetectFileContentType(fileName); err == nil && contentType == lib.ContentTypePDF {
+			scan, err := lib.ScanPDF(fileName)
+			if err != nil {
+				return nil, err
+			}
+			report.Encrypted = scan.Encrypted
+		}
+	}
+	plan, err := ws.simulate(printer, fileName, ticket, &report)
+	if err != nil {
+		return nil, err
+	}
+	report.Printer, report.ContentType = plan.Printer, plan.ContentType
+	report.Pages, report.Plan = plan.DocumentPages, *plan
+	return &report, nil
+}
+
+// addPageSizes adds the pages of a document to report, at the scale they
+// print at on the paper of the DEVMODE.
+func addPageSizes(report *lib.PreflightReport, printerName string, hPrinter HANDLE, devMode *DevMode, document *jobContext, settings lib.TicketSettings) error {
+	if err := hPrinter.DocumentPropertiesSet(printerName, devMode); err != nil {
+		return err
+	}
+	hDC, err := CreateDC(printerName, devMode)
+	if err != nil {
+		return err
+	}
+	defer hDC.DeleteDC()
+	xDPI, yDPI := float64(hDC.GetDeviceCaps(LOGPIXELSX)), float64(hDC.GetDeviceCaps(LOGPIXELSY))
+	points := func(pixels int32, dpi float64) float64 { return float64(pixels) * 72 / dpi }
+	wPaperPoints := points(hDC.GetDeviceCaps(PHYSICALWIDTH), xDPI)
+	hPaperPoints := points(hDC.GetDeviceCaps(PHYSICALHEIGHT), yDPI)
+	printable := lib.NUpCell{
+		X:      points(hDC.GetDeviceCaps(PHYSICALOFFSETX), xDPI),
+		Y:      points(hDC.GetDeviceCaps(PHYSICALOFFSETY), yDPI),
+		Width:  points(hDC.GetDeviceCaps(HORZRES), xDPI),
+		Height: points(hDC.GetDeviceCaps(VERTRES), yDPI),
+	}
+
+	// Sheets of several pages fit the pages in cells, as printSheet does.
+	var cells []lib.NUpCell
+	for i := 0; i < document.pDoc.GetNPages(); i++ {
+		page := document.pDoc.GetPage(i)
+		wDocPoints, hDocPoints, err := page.GetSize()
+		page.Unref()
+		if err != nil {
+			return err
+		}
+		var scale float64
+		if settings.NUp > 1 || settings.Booklet {
+			if cells == nil {
+				area := printable
+				if settings.Placement.Margins != nil {
+					if area, err = settings.Placement.Area(wPaperPoints, hPaperPoints, printable); err != nil {
+						return err
+					}
+				}
+				if settings.Booklet {
+					cells = lib.BookletCells(area)
+				} else {
+					cells = lib.NUpCells(settings.NUp, settings.NUpLayout, area.X, area.Y, area.Width, area.Height, wDocPoints, hDocPoints)
+				}
+			}
+			scale, _, _ = cells[0].Fit(wDocPoints, hDocPoints)
+		} else if scale, _, _, err = settings.Placement.Place(wDocPoints, hDocPoints, wPaperPoints, hPaperPoints, printable); err != nil {
+			return err
+		}
+		report.AddPageSize(i+1, wDocPoints, hDocPoints, scale)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// PrinterConfig is what asset management sets on a printer queue.
+type PrinterConfig struct {
+	Location string
+	Comment  string
+	// Empty when the printer isn't shared.
+	ShareName string
+	// Separator page printed before each job, such as
+	// C:\Windows\System32\sysprint.sep; empty for none.
+	SeparatorFile string
+}
+
+// PrinterConfigUpdate changes the properties of a printer queue with
+// SetPrinterInfo; those left nil are kept.
+type PrinterConfigUpdate struct {
+	Location *string
+	Comment  *string
+	// An empty share name stops sharing the printer.
+	ShareName     *string
+	SeparatorFile *string
+	// Default DEVMODE, exported from a queue of the same driver.
+	DevMode *lib.DevModeExport
+}
+
+// GetPrinterConfig returns the properties SetPrinterInfo sets.
+func (ws *WinSpool) GetPrinterConfig(printerName string) (PrinterConfig, error) {
+	if ws.isVirtual(printerName) {
+		return PrinterConfig{}, nil
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return PrinterConfig{}, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+		}
+		return PrinterConfig{}, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return PrinterConfig{}, err
+	}
+	config := PrinterConfig{
+		Location:      pi2.GetLocation(),
+		Comment:       pi2.GetComment(),
+		SeparatorFile: pi2.GetSepFile(),
+	}
+	if pi2.GetAttributes()&PRINTER_ATTRIBUTE_SHARED != 0 {
+		config.ShareName = pi2.GetShareName()
+	}
+	return config, nil
+}
+
+// SetPrinterInfo changes the properties of a printer queue, in a single
+// SetPrinter call, so that other properties changed meanwhile are kept.
+func (ws *WinSpool) SetPrinterInfo(printerName string, update PrinterConfigUpdate) error {
+	if err := ws.Faults.Inject("SetPrinterInfo", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return fmt.Errorf("%s is a virtual printer, configured in the config file", printerName)
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+		}
+		return accessError(err, "setting printer "+printerName)
+	}
+	defer hPrinter.ClosePrinter()
+
+	current, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return err
+	}
+	// The strings of current stay in its buffer, which pi2 keeps.
+	pi2 := *current
+	pi2.pSecurityDescriptor = 0
+	fields := []struct {
+		field **uint16
+		value *string
+	}{
+		{&pi2.pLocation, update.Location},
+		{&pi2.pComment, update.Comment},
+		{&pi2.pShareName, update.ShareName},
+		{&pi2.pSepFile, update.SeparatorFile},
+	}
+	for _, f := range fields {
+		if f.value == nil {
+			continue
+		}
+		p, err := syscall.UTF16PtrFromString(*f.value)
+		if err != nil {
+			return err
+		}
+		*f.field = p
+	}
+	if update.ShareName != nil {
+		if *update.ShareName == "" {
+			pi2.attributes &^= PRINTER_ATTRIBUTE_SHARED
+		} else {
+			pi2.attributes |= PRINTER_ATTRIBUTE_SHARED
+		}
+	}
+	if update.DevMode != nil {
+		if pi2.pDevMode, err = validateDevModeExport(hPrinter, printerName, current, update.DevMode); err != nil {
+			return err
+		}
+	}
+
+	if err = hPrinter.SetPrinter2(&pi2); err != nil {
+		return accessError(err, "setting printer "+printerName)
+	}
+	if update.DevMode != nil {
+		// The defaults of the capabilities come from the DEVMODE.
+		ws.capabilities.Invalidate()
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// setJobWindow holds a job outside of window, with the StartTime and
+// UntilTime of the job, so that the spooler releases it when the window
+// opens without this process running. The window follows the UTC offset of
+// now, and shifts by an hour for jobs held across a DST change.
+func setJobWindow(hPrinter HANDLE, jobID int32, window *lib.PrintWindow) error {
+	if window == nil {
+		return nil
+	}
+	start, until := window.UTCMinutes(time.Now())
+	if err := hPrinter.SetJobWindow(jobID, start, until); err != nil {
+		return fmt.Errorf("failed to set the print window of job %d: %w", jobID, err)
+	}
+	return nil
+}
+
+// PrintJobNow lets a job held outside of the print window of its printer
+// print right away. It needs administrator rights, even for own jobs.
+func (ws *WinSpool) PrintJobNow(printerName string, jobID uint32) error {
+	if err := ws.Faults.Inject("PrintJobNow", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.PrintJobNow(printerName, jobID)
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		return accessError(err, fmt.Sprintf("printing job %d outside of the print window of %s", jobID, printerName))
+	}
+	defer hPrinter.ClosePrinter()
+
+	if err = hPrinter.SetJobWindow(int32(jobID), 0, 0); err != nil {
+		return accessError(err, fmt.Sprintf("printing job %d outside of the print window of %s", jobID, printerName))
+	}
+	return nil
+}
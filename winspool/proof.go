@@ -0,0 +1,178 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Proof renders a document as Print does on the printer, with its DEVMODE
+// and the ticket applied, on its paper, at its resolution, into files
+// instead of a job: a PDF with a page per sheet side, or a PNG per side,
+// named as lib.ProofPageFileName. Sides are clipped to the printable area,
+// and gray when the job prints in monochrome. Nothing is sent to the
+// printer; the result lists the files written in ProofFiles.
+func (ws *WinSpool) Proof(printer *lib.Printer, fileName string, ticket *model.JobTicket, format lib.ProofFormat, outPath string) (*lib.PrintResult, error) {
+	if printer == nil {
+		return nil, errors.New("Proof() called with nil printer")
+	}
+	if ticket == nil {
+		return nil, errors.New("Proof() called with nil ticket")
+	}
+	if ws.isVirtual(printer.Name) {
+		return nil, fmt.Errorf("%s is a virtual printer, which has no device to proof for", printer.Name)
+	}
+	printer, err := ws.describedPrinter(printer)
+	if err != nil {
+		return nil, err
+	}
+	printer, ticket, err = ws.overrideCapabilities(printer, ticket)
+	if err != nil {
+		return nil, err
+	}
+	return ws.printDocument(printer, fileName, fileName, "", nil, ticket, nil, &proofTarget{format: format, outPath: outPath, limits: ws.RenderLimits})
+}
+
+// proofTarget receives the sheet sides of a soft proof, drawn on an image
+// of the paper at the printer resolution, in place of the DC.
+type proofTarget struct {
+	format  lib.ProofFormat
+	outPath string
+	limits  lib.RenderLimits
+	// Set once the ticket is applied, from the DEVMODE color.
+	gray bool
+
+	// Size of the side being drawn.
+	width, height int
+	xDPI, yDPI    float64
+
+	pdf   CairoSurface
+	files []string
+}
+
+// startProofPage replaces the context of the job with one on a new white
+// image of the paper, in points, clipped to the printable area.
+func (c *jobContext) startProofPage(xDPI, yDPI int32) error {
+	p := c.proof
+	p.width, p.height = int(c.hDC.GetDeviceCaps(PHYSICALWIDTH)), int(c.hDC.GetDeviceCaps(PHYSICALHEIGHT))
+	p.xDPI, p.yDPI = float64(xDPI), float64(yDPI)
+	if err := p.limits.CheckImage(p.width, p.height); err != nil {
+		return err
+	}
+
+	surface, err := CairoImageSurfaceCreateRGB24(p.width, p.height)
+	if err != nil {
+		return err
+	}
+	context, err := CairoCreateContext(surface)
+	if err != nil {
+		surface.Destroy()
+		return err
+	}
+	c.cSurface, c.cContext = surface, context
+
+	if err = context.SetSourceRGB(1, 1, 1); err != nil {
+		return err
+	}
+	if err = context.Paint(); err != nil {
+		return err
+	}
+	if err = surface.SetDeviceScale(p.xDPI/72, p.yDPI/72); err != nil {
+		return err
+	}
+	points := func(pixels int32, dpi float64) float64 { return float64(pixels) * 72 / dpi }
+	err = context.Rectangle(
+		points(c.hDC.GetDeviceCaps(PHYSICALOFFSETX), p.xDPI), points(c.hDC.GetDeviceCaps(PHYSICALOFFSETY), p.yDPI),
+		points(c.hDC.GetDeviceCaps(HORZRES), p.xDPI), points(c.hDC.GetDeviceCaps(VERTRES), p.yDPI))
+	if err != nil {
+		return err
+	}
+	return context.Clip()
+}
+
+// writePage writes the side drawn on surface, to a PNG or as the next page
+// of the PDF.
+func (p *proofTarget) writePage(surface CairoSurface) error {
+	if err := surface.Flush(); err != nil {
+		return err
+	}
+	data, stride := surface.ImageData()
+
+	if p.format == lib.ProofFormatPNG {
+		fileName := lib.ProofPageFileName(p.outPath, len(p.files)+1)
+		f, err := os.Create(fileName)
+		if err != nil {
+			return err
+		}
+		p.files = append(p.files, fileName)
+		if err = png.Encode(f, lib.BGRXImage(data, stride, p.width, p.height, p.gray)); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+
+	if p.gray {
+		lib.GrayBGRX(data, stride, p.width, p.height)
+		if err := surface.MarkDirty(); err != nil {
+			return err
+		}
+	}
+	wPoints, hPoints := float64(p.width)*72/p.xDPI, float64(p.height)*72/p.yDPI
+	if p.pdf == 0 {
+		pdf, err := CairoPDFSurfaceCreate(p.outPath, wPoints, hPoints)
+		if err != nil {
+			return err
+		}
+		p.pdf = pdf
+	} else if err := p.pdf.SetPDFSize(wPoints, hPoints); err != nil {
+		return err
+	}
+	context, err := CairoCreateContext(p.pdf)
+	if err != nil {
+		return err
+	}
+	defer context.Destroy()
+	if err = context.Scale(72/p.xDPI, 72/p.yDPI); err != nil {
+		return err
+	}
+	if err = context.SetSourceSurface(surface, 0, 0); err != nil {
+		return err
+	}
+	if err = context.Paint(); err != nil {
+		return err
+	}
+	return p.pdf.ShowPage()
+}
+
+// finish completes the PDF, once every side is written.
+func (p *proofTarget) finish() error {
+	if p.pdf == 0 {
+		return nil
+	}
+	if err := p.pdf.Finish(); err != nil {
+		return err
+	}
+	p.files = append(p.files, p.outPath)
+	return nil
+}
+
+// close frees the PDF surface, finished or not.
+func (p *proofTarget) close() {
+	if p.pdf != 0 {
+		p.pdf.Destroy()
+	}
+}
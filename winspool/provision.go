@@ -0,0 +1,150 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// NewPrinter is a printer queue to add with AddPrinter.
+type NewPrinter struct {
+	Name string
+	// The port the queue prints to, such as LPT1: or a Standard TCP/IP port
+	// like IP_192.168.1.20, and the driver, which must be installed.
+	Port   string
+	Driver string
+	// Defaults to winprint and RAW.
+	PrintProcessor string
+	Datatype       string
+	Comment        string
+	Location       string
+	// The printer is shared under ShareName when it is set.
+	ShareName string
+}
+
+// AddPrinter adds a printer queue on Server, this computer by default.
+func (ws *WinSpool) AddPrinter(printer NewPrinter) error {
+	if err := ws.Faults.Inject("AddPrinter", printer.Name); err != nil {
+		return err
+	}
+	if printer.Name == "" || printer.Port == "" || printer.Driver == "" {
+		return errors.New("a printer needs a name, a port and a driver")
+	}
+	if ws.isVirtual(printer.Name) {
+		return fmt.Errorf("%s is a virtual printer, configured in the config file", printer.Name)
+	}
+	if printer.PrintProcessor == "" {
+		printer.PrintProcessor = "winprint"
+	}
+	if printer.Datatype == "" {
+		printer.Datatype = "RAW"
+	}
+
+	pi2 := PrinterInfo2{priority: 1, defaultPriority: 1}
+	fields := []struct {
+		field **uint16
+		value string
+	}{
+		{&pi2.pPrinterName, printer.Name},
+		{&pi2.pPortName, printer.Port},
+		{&pi2.pDriverName, printer.Driver},
+		{&pi2.pPrintProcessor, printer.PrintProcessor},
+		{&pi2.pDatatype, printer.Datatype},
+		{&pi2.pComment, printer.Comment},
+		{&pi2.pLocation, printer.Location},
+		{&pi2.pShareName, printer.ShareName},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		p, err := syscall.UTF16PtrFromString(f.value)
+		if err != nil {
+			return err
+		}
+		*f.field = p
+	}
+	if printer.ShareName != "" {
+		pi2.attributes |= PRINTER_ATTRIBUTE_SHARED
+	}
+
+	var hPrinter HANDLE
+	err := ws.Retry.Do("AddPrinter "+printer.Name, func() error {
+		var err error
+		hPrinter, err = AddPrinter(ws.Server, &pi2)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ERROR_PRINTER_ALREADY_EXISTS):
+			return fmt.Errorf("printer %s already exists", printer.Name)
+		case errors.Is(err, ERROR_UNKNOWN_PORT):
+			return fmt.Errorf("port %s of printer %s doesn't exist", printer.Port, printer.Name)
+		case errors.Is(err, ERROR_UNKNOWN_PRINTER_DRIVER):
+			return fmt.Errorf("driver %s of printer %s isn't installed", printer.Driver, printer.Name)
+		}
+		return accessError(err, "adding printer "+printer.Name)
+	}
+	hPrinter.ClosePrinter()
+	return nil
+}
+
+// DeletePrinter deletes a printer queue, once its jobs are done.
+func (ws *WinSpool) DeletePrinter(printerName string) error {
+	if err := ws.Faults.Inject("DeletePrinter", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return fmt.Errorf("%s is a virtual printer, configured in the config file", printerName)
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ALL_ACCESS)
+	if err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+		}
+		return accessError(err, "deleting printer "+printerName)
+	}
+	defer hPrinter.ClosePrinter()
+
+	// Handles kept open would hold the deletion back.
+	ws.handles.Invalidate()
+	if err = hPrinter.DeletePrinter(); err != nil {
+		return accessError(err, "deleting printer "+printerName)
+	}
+	ws.capabilities.Invalidate()
+	return nil
+}
+
+// AddPrinterConnection connects the current user to a shared printer, such
+// as \\PRINTSRV01\Office, which then lists with the printer connections.
+func (ws *WinSpool) AddPrinterConnection(printerName string) error {
+	if err := ws.Faults.Inject("AddPrinterConnection", printerName); err != nil {
+		return err
+	}
+	return ws.Retry.Do("AddPrinterConnection "+printerName, func() error {
+		return AddPrinterConnection(printerName)
+	})
+}
+
+// DeletePrinterConnection removes a connection of the current user to a
+// shared printer.
+func (ws *WinSpool) DeletePrinterConnection(printerName string) error {
+	if err := ws.Faults.Inject("DeletePrinterConnection", printerName); err != nil {
+		return err
+	}
+	ws.handles.Invalidate()
+	return ws.Retry.Do("DeletePrinterConnection "+printerName, func() error {
+		return DeletePrinterConnection(printerName)
+	})
+}
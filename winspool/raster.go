@@ -0,0 +1,96 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"image"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// printRasterPage prints a decoded PWG Raster, URF or image page through
+// GDI, at the page's own resolution.
+func printRasterPage(printerName string, page *lib.RasterPage, c *jobContext, placement lib.PagePlacement) error {
+	bounds := page.Image.Bounds()
+	wDocPoints := float64(bounds.Dx()) * 72 / float64(page.XDPI)
+	hDocPoints := float64(bounds.Dy()) * 72 / float64(page.YDPI)
+
+	surface, err := cairoSurfaceFromImage(page.Image)
+	if err != nil {
+		return err
+	}
+	defer surface.Destroy()
+
+	return c.printImagePage(printerName, surface, wDocPoints, hDocPoints, float64(page.XDPI), float64(page.YDPI), placement)
+}
+
+// printImagePage prints an image surface as a page of the given size in
+// points, the image being at xDPI by yDPI.
+func (c *jobContext) printImagePage(printerName string, surface CairoSurface, wDocPoints, hDocPoints, xDPI, yDPI float64, placement lib.PagePlacement) error {
+	if err := c.startPage(printerName, wDocPoints, hDocPoints, placement); err != nil {
+		return err
+	}
+	defer c.endPage()
+
+	if err := c.cContext.Scale(72/xDPI, 72/yDPI); err != nil {
+		return err
+	}
+	if err := c.cContext.SetSourceSurface(surface, 0, 0); err != nil {
+		return err
+	}
+	if err := c.cContext.Paint(); err != nil {
+		return err
+	}
+
+	return c.finishPage()
+}
+
+// cairoSurfaceFromImage copies an image into a new RGB24 image surface.
+func cairoSurfaceFromImage(img image.Image) (CairoSurface, error) {
+	bounds := img.Bounds()
+	surface, err := CairoImageSurfaceCreateRGB24(bounds.Dx(), bounds.Dy())
+	if err != nil {
+		return 0, err
+	}
+	if err = surface.Flush(); err != nil {
+		surface.Destroy()
+		return 0, err
+	}
+
+	// Pixels are 0x00RRGGBB in native (little) endian, so B, G, R, unused.
+	data, stride := surface.ImageData()
+	for y := 0; y < bounds.Dy(); y++ {
+		row := data[y*stride : y*stride+bounds.Dx()*4]
+		switch img := img.(type) {
+		case *image.Gray:
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < bounds.Dx(); x++ {
+				v := pix[x]
+				row[x*4], row[x*4+1], row[x*4+2] = v, v, v
+			}
+		case *image.RGBA:
+			pix := img.Pix[y*img.Stride:]
+			for x := 0; x < bounds.Dx(); x++ {
+				row[x*4], row[x*4+1], row[x*4+2] = pix[x*4+2], pix[x*4+1], pix[x*4]
+			}
+		default:
+			for x := 0; x < bounds.Dx(); x++ {
+				r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+				row[x*4], row[x*4+1], row[x*4+2] = byte(b>>8), byte(g>>8), byte(r>>8)
+			}
+		}
+	}
+
+	if err = surface.MarkDirty(); err != nil {
+		surface.Destroy()
+		return 0, err
+	}
+	return surface, nil
+}
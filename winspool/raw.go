@@ -0,0 +1,192 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+const rawDatatype = "RAW"
+
+// Status replies normally arrive within milliseconds; printers that are off,
+// or don't speak the protocol, don't reply at all.
+const rawReplyTimeout = 2 * time.Second
+
+// Size of the chunks passed to WritePrinter when streaming.
+const rawChunkSize = 64 << 10
+
+// PrintRaw sends data to the printer in a single job of the given spooler
+// datatype, "RAW" when empty, bypassing rendering: the print processor
+// passes it to the port as-is. Use it to feed label and receipt printers
+// their command language (ZPL, EPL, ESC/POS) directly. When data fails to
+// be read or written, the partial job is deleted. Identical labels are
+// merged on printers with a coalesce_window. RAW data is followed by the
+// printer's job trailer, within the same job.
+func (ws *WinSpool) PrintRaw(printerName string, data io.Reader, docName, datatype string) (*lib.PrintResult, error) {
+	if err := ws.Faults.Inject("PrintRaw", printerName); err != nil {
+		return nil, err
+	}
+	if coalescer, ok := ws.labelCoalescers[printerName]; ok && (datatype == "" || datatype == rawDatatype) {
+		b, err := ioutil.ReadAll(data)
+		if err != nil {
+			return nil, err
+		}
+		return coalescer.Print(b, func(b []byte) (*lib.PrintResult, error) {
+			return ws.printRaw(printerName, bytes.NewReader(b), docName, datatype)
+		})
+	}
+	return ws.printRaw(printerName, data, docName, datatype)
+}
+
+func (ws *WinSpool) printRaw(printerName string, data io.Reader, docName, datatype string) (*lib.PrintResult, error) {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.PrintRaw(printerName, data, docName, datatype)
+	}
+	if datatype == "" {
+		datatype = rawDatatype
+	}
+	if trailer, ok := ws.jobTrailers[printerName]; ok && datatype == rawDatatype {
+		data = io.MultiReader(data, bytes.NewReader(trailer))
+	}
+	start := time.Now()
+	jobID, err := writeRawStream(printerName, docName, "", datatype, data, &jobHold{window: ws.printWindows[printerName]})
+	if err != nil {
+		return nil, err
+	}
+	return &lib.PrintResult{JobID: jobID, JobIDs: []uint32{jobID}, Duration: time.Since(start)}, nil
+}
+
+// writeRawJob sends data to the printer in a single RAW job, which the print
+// processor passes to the port as-is, or to output when not empty. The job
+// is held as hold says, when not nil. The job ID is returned.
+func writeRawJob(printerName, docName, output string, data []byte, hold *jobHold) (uint32, error) {
+	return writeRawStream(printerName, docName, output, rawDatatype, bytes.NewReader(data), hold)
+}
+
+func writeRawStream(printerName, docName, output, datatype string, r io.Reader, hold *jobHold) (uint32, error) {
+	hPrinter, err := OpenPrinter(printerName)
+	if err != nil {
+		return 0, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	jobID, err := hPrinter.StartDocPrinter(docName, datatype, output)
+	if err != nil {
+		return 0, err
+	}
+	if err = hPrinter.StartPagePrinter(); err != nil {
+		hPrinter.EndDocPrinter()
+		return 0, err
+	}
+
+	abort := func(err error) (uint32, error) {
+		if err := hPrinter.SetJobCommand(jobID, JOB_CONTROL_DELETE); err != nil {
+			log.Printf("Failed to delete partial RAW job %d: %s", jobID, err)
+		}
+		hPrinter.EndPagePrinter()
+		hPrinter.EndDocPrinter()
+		return 0, err
+	}
+	if err = hold.apply(hPrinter, jobID); err != nil {
+		return abort(err)
+	}
+	buf := make([]byte, rawChunkSize)
+	for {
+		n, readErr := r.Read(buf)
+		for data := buf[:n]; len(data) > 0; {
+			written, err := hPrinter.WritePrinter(data)
+			if err == nil && written == 0 {
+				err = errors.New("WritePrinter wrote no data")
+			}
+			if err != nil {
+				return abort(err)
+			}
+			data = data[written:]
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return abort(readErr)
+		}
+	}
+
+	if err = hPrinter.EndPagePrinter(); err != nil {
+		hPrinter.EndDocPrinter()
+		return 0, err
+	}
+	if err = hPrinter.EndDocPrinter(); err != nil {
+		return 0, err
+	}
+	return uint32(jobID), nil
+}
+
+// getESCPOSStatus queries the real-time status of an ESC/POS printer. The
+// replies come back over the port's back channel, so only bidirectional
+// ports (USB, most network ports) work.
+func getESCPOSStatus(printerName string) (*lib.ESCPOSStatus, error) {
+	hPrinter, err := OpenPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	if _, err = hPrinter.StartDocPrinter("ESC/POS status", rawDatatype, ""); err != nil {
+		return nil, err
+	}
+	defer hPrinter.EndDocPrinter()
+	if err = hPrinter.StartPagePrinter(); err != nil {
+		return nil, err
+	}
+	defer hPrinter.EndPagePrinter()
+
+	var replies [4]byte
+	for i, request := range lib.ESCPOSStatusRequests {
+		if _, err = hPrinter.WritePrinter(request); err != nil {
+			return nil, err
+		}
+		reply, err := readRawReply(hPrinter, 1, rawReplyTimeout)
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply[0]
+	}
+
+	return lib.ParseESCPOSStatus(replies)
+}
+
+// readRawReply reads n bytes sent back by the printer.
+func readRawReply(hPrinter HANDLE, n int, timeout time.Duration) ([]byte, error) {
+	reply := make([]byte, 0, n)
+	buf := make([]byte, n)
+	deadline := time.Now().Add(timeout)
+	for len(reply) < n {
+		read, err := hPrinter.ReadPrinter(buf[:n-len(reply)])
+		if err != nil {
+			return nil, err
+		}
+		reply = append(reply, buf[:read]...)
+		if len(reply) < n {
+			if time.Now().After(deadline) {
+				return nil, fmt.Errorf("no reply from printer within %s", timeout)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Names of the PDF renderers, which WinSpool.PDFRenderer and the
+// pdf_renderer of printers pick.
+const (
+	// Poppler, drawing pages as vectors with Cairo; the default.
+	PDFRendererPoppler = "poppler"
+	// PDFium, drawing pages as images at the device resolution, in builds
+	// with the pdfium tag.
+	PDFRendererPDFium = "pdfium"
+)
+
+// PDFRenderer opens the PDFs that print, which are drawn with Cairo.
+type PDFRenderer interface {
+	Open(fileName string, limits lib.RenderLimits) (PDFDocument, error)
+}
+
+// PDFDocument is a PDF opened by a PDFRenderer.
+type PDFDocument interface {
+	GetNPages() int
+	GetPage(index int) PDFPage
+	Unref()
+}
+
+// PDFPage is a page of a PDFDocument.
+type PDFPage interface {
+	// GetSize returns the width and height of the page, in points.
+	GetSize() (float64, float64, error)
+	// RenderForPrinting draws the page on context, in points from the top
+	// left corner of the page; deviceScale is the pixels of the device per
+	// unit of the surface of context, for renderers that draw images.
+	RenderForPrinting(context CairoContext, deviceScale float64) error
+	Unref()
+}
+
+// pdfRenderers are the renderers of this build, by name. Poppler is in
+// every build with rendering; pdfium.go adds PDFium.
+var pdfRenderers = map[string]PDFRenderer{
+	PDFRendererPoppler: popplerRenderer{},
+}
+
+// PDFRenderers lists the names of the PDF renderers of this build, which
+// only render with RenderingAvailable.
+func PDFRenderers() []string {
+	names := make([]string, 0, len(pdfRenderers))
+	for name := range pdfRenderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckPDFRenderer fails when this build has no PDF renderer of a name, such
+// as "pdfium" in builds without the pdfium tag. Empty is Poppler.
+func CheckPDFRenderer(name string) error {
+	_, err := findPDFRenderer(name)
+	return err
+}
+
+// findPDFRenderer returns the renderer of a name, Poppler when empty.
+func findPDFRenderer(name string) (PDFRenderer, error) {
+	if name == "" {
+		name = PDFRendererPoppler
+	}
+	renderer, ok := pdfRenderers[name]
+	if !ok {
+		return nil, fmt.Errorf("PDF renderer %q is not in this build, which has %s", name, strings.Join(PDFRenderers(), ", "))
+	}
+	return renderer, nil
+}
+
+// pdfRenderer returns the renderer of the PDFs of a printer: its own, else
+// WinSpool.PDFRenderer.
+func (ws *WinSpool) pdfRenderer(printerName string) (PDFRenderer, error) {
+	if name, ok := ws.pdfRendererNames[printerName]; ok {
+		return findPDFRenderer(name)
+	}
+	return findPDFRenderer(ws.PDFRenderer)
+}
+
+// popplerRenderer opens PDFs with Poppler, whose pages Cairo draws as
+// vectors.
+type popplerRenderer struct{}
+
+func (popplerRenderer) Open(fileName string, limits lib.RenderLimits) (PDFDocument, error) {
+	doc, err := PopplerDocumentNewFromFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return &popplerDocument{doc}, nil
+}
+
+type popplerDocument struct {
+	doc PopplerDocument
+}
+
+func (d *popplerDocument) GetNPages() int {
+	return d.doc.GetNPages()
+}
+
+func (d *popplerDocument) GetPage(index int) PDFPage {
+	return &popplerPage{d.doc.GetPage(index)}
+}
+
+func (d *popplerDocument) Unref() {
+	d.doc.Unref()
+}
+
+type popplerPage struct {
+	page PopplerPage
+}
+
+func (p *popplerPage) GetSize() (float64, float64, error) {
+	return p.page.GetSize()
+}
+
+func (p *popplerPage) RenderForPrinting(context CairoContext, deviceScale float64) error {
+	p.page.RenderForPrinting(context)
+	return nil
+}
+
+func (p *popplerPage) Unref() {
+	p.page.Unref()
+}
@@ -0,0 +1,134 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+// openPrinter opens a printer, retrying while the spooler is unavailable.
+func (ws *WinSpool) openPrinter(printerName string) (HANDLE, error) {
+	return ws.openPrinterAccess(printerName, 0)
+}
+
+// openPrinterAccess is openPrinter with PRINTER_ACCESS_* rights.
+func (ws *WinSpool) openPrinterAccess(printerName string, desiredAccess uint32) (HANDLE, error) {
+	var hPrinter HANDLE
+	err := ws.Retry.Do("OpenPrinter "+printerName, func() error {
+		var err error
+		hPrinter, err = openPrinterWithAccess(printerName, desiredAccess)
+		return err
+	})
+	return hPrinter, err
+}
+
+// acquirePrinter borrows a handle to a printer opened with desiredAccess
+// from the pool of job calls, retrying while the spooler is unavailable. It
+// is returned with releasePrinter.
+func (ws *WinSpool) acquirePrinter(printerName string, desiredAccess uint32) (HANDLE, error) {
+	var hPrinter HANDLE
+	err := ws.Retry.Do("OpenPrinter "+printerName, func() error {
+		h, err := ws.handles.Get(printerName, desiredAccess)
+		hPrinter = HANDLE(h)
+		return err
+	})
+	return hPrinter, err
+}
+
+// releasePrinter returns a handle of acquirePrinter to the pool, or closes
+// it when err, that of the last call made with it, shows the spooler no
+// longer knows it.
+func (ws *WinSpool) releasePrinter(hPrinter HANDLE, printerName string, desiredAccess uint32, err error) {
+	ws.handles.Put(printerName, desiredAccess, uintptr(hPrinter), err)
+}
+
+// openPrinterWithAccess opens a printer with PRINTER_ACCESS_* rights; none
+// opens it as OpenPrinter does.
+func openPrinterWithAccess(printerName string, desiredAccess uint32) (HANDLE, error) {
+	if desiredAccess == 0 {
+		return OpenPrinter(printerName)
+	}
+	return OpenPrinterAccess(printerName, desiredAccess)
+}
+
+// retryOnPrinter calls call with a printer handle, retrying while the
+// spooler is unavailable. Handles opened before the spooler service
+// restarted don't work anymore, so the printer is opened again, with the
+// same rights, before each retry, and *hPrinter replaced.
+func (ws *WinSpool) retryOnPrinter(hPrinter *HANDLE, printerName string, desiredAccess uint32, op string, call func(hPrinter HANDLE) error) error {
+	stale := false
+	return ws.Retry.Do(op+" "+printerName, func() error {
+		if stale {
+			// The other handles kept are as stale.
+			ws.handles.Invalidate()
+			hPrinter.ClosePrinter()
+			*hPrinter = 0
+			h, err := openPrinterWithAccess(printerName, desiredAccess)
+			if err != nil {
+				return err
+			}
+			*hPrinter = h
+		}
+		err := call(*hPrinter)
+		stale = err != nil
+		return err
+	})
+}
+
+// getJob is GetJob on a printer opened with openPrinter, retried.
+func (ws *WinSpool) getJob(hPrinter *HANDLE, printerName string, jobID int32) (*JobInfo1, error) {
+	var ji1 *JobInfo1
+	err := ws.retryOnPrinter(hPrinter, printerName, 0, "GetJob", func(hPrinter HANDLE) error {
+		var err error
+		ji1, err = hPrinter.GetJob(jobID)
+		return err
+	})
+	return ji1, err
+}
+
+// getJob2 is GetJob2 on a printer opened with openPrinter, retried.
+func (ws *WinSpool) getJob2(hPrinter *HANDLE, printerName string, jobID int32) (*JobInfo2, error) {
+	var ji2 *JobInfo2
+	err := ws.retryOnPrinter(hPrinter, printerName, 0, "GetJob", func(hPrinter HANDLE) error {
+		var err error
+		ji2, err = hPrinter.GetJob2(jobID)
+		return err
+	})
+	return ji2, err
+}
+
+// enumJobs is EnumJobs1 on a printer opened with desiredAccess, retried.
+func (ws *WinSpool) enumJobs(hPrinter *HANDLE, printerName string, desiredAccess uint32) ([]JobInfo1, error) {
+	var jobs []JobInfo1
+	err := ws.retryOnPrinter(hPrinter, printerName, desiredAccess, "EnumJobs", func(hPrinter HANDLE) error {
+		var err error
+		jobs, err = hPrinter.EnumJobs1()
+		return err
+	})
+	return jobs, err
+}
+
+// enumJobs2 is EnumJobs2 on a printer opened with desiredAccess, retried.
+func (ws *WinSpool) enumJobs2(hPrinter *HANDLE, printerName string, desiredAccess uint32) ([]JobInfo2, error) {
+	var jobs []JobInfo2
+	err := ws.retryOnPrinter(hPrinter, printerName, desiredAccess, "EnumJobs", func(hPrinter HANDLE) error {
+		var err error
+		jobs, err = hPrinter.EnumJobs2()
+		return err
+	})
+	return jobs, err
+}
+
+// enumPrinters is EnumPrinters2, retried.
+func (ws *WinSpool) enumPrinters() ([]PrinterInfo2, error) {
+	var pi2s []PrinterInfo2
+	err := ws.Retry.Do("EnumPrinters", func() error {
+		var err error
+		pi2s, err = EnumPrinters2(ws.printerEnumFlags())
+		return err
+	})
+	return pi2s, err
+}
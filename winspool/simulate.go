@@ -0,0 +1,178 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Simulate works out what Print would do with a document, short of starting
+// a job: the capability overrides are enforced, the ticket is applied to
+// the printer's DEVMODE, and the document is converted and paginated, but
+// pages aren't rendered. Callers show the sheets and cost of a job before
+// it is printed.
+func (ws *WinSpool) Simulate(printer *lib.Printer, fileName string, ticket *model.JobTicket) (*lib.JobPlan, error) {
+	if printer == nil {
+		return nil, errors.New("Simulate() called with nil printer")
+	}
+	if ticket == nil {
+		return nil, errors.New("Simulate() called with nil ticket")
+	}
+	return ws.simulate(printer, fileName, ticket, nil)
+}
+
+// simulate is Simulate, which also adds the sizes of the pages of the
+// document, as placed on the paper, to report when not nil.
+func (ws *WinSpool) simulate(printer *lib.Printer, fileName string, ticket *model.JobTicket, report *lib.PreflightReport) (*lib.JobPlan, error) {
+	if ws.isVirtual(printer.Name) {
+		return nil, fmt.Errorf("%s is a virtual printer, which has no device to simulate", printer.Name)
+	}
+	printer, err := ws.describedPrinter(printer)
+	if err != nil {
+		return nil, err
+	}
+	printer, ticket, err = ws.overrideCapabilities(printer, ticket)
+	if err != nil {
+		return nil, err
+	}
+
+	marginsLaidOut := laysOutMargins(fileName)
+	fileName, contentType, cleanup, err := ws.prepareDocument(fileName, ticket)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	var result lib.PrintResult
+	if lib.IsRawContentType(contentType) || contentType == lib.ContentTypePDF && ws.sendsPDFDirect(printer.Name) {
+		for _, option := range lib.TicketOptions(ticket) {
+			result.Warn(option, lib.PrintWarningRawDocument, "ignored, %s documents are sent to the printer as-is", contentType)
+		}
+		return &lib.JobPlan{Printer: printer.Name, ContentType: contentType, Copies: 1, Warnings: result.Warnings}, nil
+	}
+	if contentType == lib.ContentTypeText && !ws.rendersText(printer.Name) {
+		// Pages are laid out by the device font as they print.
+		return &lib.JobPlan{Printer: printer.Name, ContentType: contentType, Copies: 1}, nil
+	}
+
+	if !renderingAvailable {
+		return nil, fmt.Errorf("%s: printing %s documents: %w", fileName, contentType, ErrNoRenderer)
+	}
+	if contentType == lib.ContentTypeText {
+		// Titles in headers and footers don't change the pages.
+		source := fileName
+		var textCleanup func()
+		fileName, contentType, textCleanup, err = ws.convertToPDF(func(pdf string) error {
+			return ws.textToPDF(printer.Name, source, "", pdf, ticket)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer textCleanup()
+		marginsLaidOut = true
+	}
+	if contentType == lib.ContentTypePDF {
+		if err = ws.RenderLimits.CheckPDF(fileName); err != nil {
+			return nil, err
+		}
+	}
+	renderer, err := ws.pdfRenderer(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	var document jobContext
+	if err = document.openDocument(fileName, renderer, ws.RenderLimits); err != nil {
+		return nil, err
+	}
+	defer document.closeDocument()
+
+	hPrinter, err := OpenPrinter(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+	devMode, err := hPrinter.DocumentPropertiesGet(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyTicketDevMode(hPrinter, printer.Name, devMode, ticket, ws.DevModePresets); err != nil {
+		return nil, err
+	}
+	settings, err := lib.ApplyTicket(devMode, printer.Description, ticket, &result)
+	if err != nil {
+		return nil, err
+	}
+	if marginsLaidOut {
+		settings.Placement.Margins = nil
+	}
+
+	var pages int
+	if document.raster != nil {
+		if settings.NUp > 1 {
+			result.Warn("n_up", lib.PrintWarningNotImplemented, "images are printed one page per sheet, ignored")
+			settings.NUp = 1
+		}
+		if settings.Booklet {
+			result.Warn("booklet", lib.PrintWarningNotImplemented, "images are printed one page per sheet, ignored")
+			settings.Booklet = false
+		}
+		// Raster streams only tell their page count once decoded.
+		for {
+			if _, err := document.raster.NextPage(); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			pages++
+		}
+	} else {
+		pages = document.pDoc.GetNPages()
+	}
+	if err = settings.CheckPageRange(pages); err != nil {
+		return nil, err
+	}
+	if report != nil && document.pDoc != nil {
+		if err = addPageSizes(report, printer.Name, hPrinter, devMode, &document, settings); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := settings.Plan(pages)
+	plan.Printer, plan.ContentType = printer.Name, contentType
+	if color, ok := devMode.GetColor(); ok {
+		plan.Color = color == lib.DevModeColorColor
+	}
+	plan.Paper = paperName(printer.Description.MediaSize, devMode)
+	if cost, ok := ws.costs[printer.Name]; ok {
+		plan.Cost = cost.Cost(&plan)
+	}
+	plan.Warnings = result.Warnings
+	return &plan, nil
+}
+
+// paperName returns the name of the paper size of the DEVMODE; empty for
+// custom sizes.
+func paperName(mediaSize *model.MediaSize, devMode *DevMode) string {
+	paperSize, ok := devMode.GetPaperSize()
+	if !ok {
+		return ""
+	}
+	option, ok := lib.MediaSizeByVendorID(mediaSize, strconv.FormatInt(int64(paperSize), 10))
+	if !ok {
+		return ""
+	}
+	return lib.MediaSizeDisplayName(option)
+}
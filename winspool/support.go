@@ -0,0 +1,104 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// Print service event logs read into support bundles, and the entries read
+// from each.
+var supportEventLogs = []string{
+	"Microsoft-Windows-PrintService/Admin",
+	"Microsoft-Windows-PrintService/Operational",
+}
+
+const (
+	supportEventCount   = 50
+	supportEventTimeout = 10 * time.Second
+)
+
+// CollectSupportInfo fills in what a support bundle knows of the machine
+// and of the printer of the bundle: its state, default DEVMODE, driver and
+// the latest print service events. Parts that fail are recorded in
+// CollectionErrors; virtual printers have no driver nor events.
+func (ws *WinSpool) CollectSupportInfo(b *lib.SupportBundle) {
+	failed := func(part string, err error) {
+		b.CollectionErrors = append(b.CollectionErrors, fmt.Sprintf("%s: %s", part, err))
+	}
+
+	b.WindowsVersion = GetWindowsVersion()
+	var err error
+	if b.PrinterInfo, err = ws.GetPrinter(b.Printer); err != nil {
+		failed("printer", err)
+	}
+	if b.DevMode, err = ws.ExportDevMode(b.Printer); err != nil {
+		failed("DEVMODE", err)
+	}
+	if ws.isVirtual(b.Printer) {
+		return
+	}
+	if b.Driver, err = getDriverInfo(b.Printer); err != nil {
+		failed("driver", err)
+	}
+	var events []string
+	for _, name := range supportEventLogs {
+		text, err := queryEventLog(name, supportEventCount)
+		if err != nil {
+			failed(name, err)
+			continue
+		}
+		events = append(events, fmt.Sprintf("==== %s ====\n%s", name, text))
+	}
+	b.Events = strings.Join(events, "\n")
+}
+
+func getDriverInfo(printerName string) (*lib.DriverInfo, error) {
+	hPrinter, err := OpenPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	di6, err := hPrinter.GetPrinterDriver6()
+	if err != nil {
+		return nil, err
+	}
+	return &lib.DriverInfo{
+		Name:         di6.GetName(),
+		Version:      di6.GetDriverVersion(),
+		Date:         di6.GetDriverDate(),
+		Manufacturer: di6.GetManufacturer(),
+		Provider:     di6.GetProvider(),
+		HardwareID:   di6.GetHardwareID(),
+	}, nil
+}
+
+// queryEventLog returns the latest entries of an event log, newest first,
+// as text. The Operational print service log is disabled by default, and
+// then has no entries.
+func queryEventLog(name string, count int) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), supportEventTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "wevtutil", "qe", name, fmt.Sprintf("/c:%d", count), "/rd:true", "/f:text").Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("wevtutil: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Title of test page jobs.
+const testPageTitle = "Test page"
+
+// PrintTestPage prints a test page on a printer, with its defaults, through
+// the same rendering as documents: a millimeter grid, the printable area
+// and its margins, the resolution, driver and port, and gray ramps, and
+// color ones on color printers, to check alignment once it is deployed.
+func (ws *WinSpool) PrintTestPage(printer *lib.Printer) (*lib.PrintResult, error) {
+	if printer == nil {
+		return nil, errors.New("PrintTestPage() called with nil printer")
+	}
+	if err := ws.Faults.Inject("PrintTestPage", printer.Name); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printer.Name) {
+		return nil, fmt.Errorf("%s is a virtual printer, which has no device to print a test page on", printer.Name)
+	}
+	if !renderingAvailable {
+		return nil, fmt.Errorf("printing a test page: %w", ErrNoRenderer)
+	}
+	printer, err := ws.describedPrinter(printer)
+	if err != nil {
+		return nil, err
+	}
+
+	pdf, _, cleanup, err := ws.convertToPDF(func(pdf string) error {
+		return ws.testPageToPDF(printer, pdf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+	// Not fit, so that the grid prints at its size from the paper corner.
+	return ws.Print(printer, pdf, testPageTitle, &model.JobTicket{})
+}
+
+// testPageToPDF lays out the test page of a printer, measured on a DC of
+// its default DEVMODE, as a PDF of the size of its paper.
+func (ws *WinSpool) testPageToPDF(printer *lib.Printer, pdf string) error {
+	hPrinter, err := ws.openPrinter(printer.Name)
+	if err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printer.Name)
+		}
+		return err
+	}
+	defer hPrinter.ClosePrinter()
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return err
+	}
+	hDC, err := CreateDC(printer.Name, pi2.GetDevMode())
+	if err != nil {
+		return err
+	}
+	defer hDC.DeleteDC()
+
+	info := lib.TestPageInfo{
+		Printer: printer.Name,
+		Driver:  pi2.GetDriverName(),
+		Port:    pi2.GetPortName(),
+		XDPI:    hDC.GetDeviceCaps(LOGPIXELSX),
+		YDPI:    hDC.GetDeviceCaps(LOGPIXELSY),
+		Time:    time.Now(),
+	}
+	if info.XDPI <= 0 || info.YDPI <= 0 {
+		return fmt.Errorf("printer %s reports no resolution", printer.Name)
+	}
+	if color, err := DeviceCapabilitiesInt32(printer.Name, info.Port, DC_COLORDEVICE); err == nil {
+		info.Color = color == 1
+	}
+	if ms := printer.Description.MediaSize; ms != nil {
+		for i := range ms.Option {
+			if ms.Option[i].IsDefault {
+				info.Paper = lib.MediaSizeDisplayName(&ms.Option[i])
+			}
+		}
+	}
+
+	xPoints := func(pixels int32) float64 { return float64(pixels) * 72 / float64(info.XDPI) }
+	yPoints := func(pixels int32) float64 { return float64(pixels) * 72 / float64(info.YDPI) }
+	width, height := xPoints(hDC.GetDeviceCaps(PHYSICALWIDTH)), yPoints(hDC.GetDeviceCaps(PHYSICALHEIGHT))
+	printable := lib.NUpCell{
+		X:      xPoints(hDC.GetDeviceCaps(PHYSICALOFFSETX)),
+		Y:      yPoints(hDC.GetDeviceCaps(PHYSICALOFFSETY)),
+		Width:  xPoints(hDC.GetDeviceCaps(HORZRES)),
+		Height: yPoints(hDC.GetDeviceCaps(VERTRES)),
+	}
+	if width <= 0 || height <= 0 || printable.Width <= 0 || printable.Height <= 0 {
+		return fmt.Errorf("printer %s reports no paper size", printer.Name)
+	}
+	page := lib.NewTestPage(info, width, height, printable)
+
+	font := ws.LayoutFont
+	if font == "" {
+		font = defaultLayoutFont
+	}
+	surface, err := CairoPDFSurfaceCreate(pdf, width, height)
+	if err != nil {
+		return err
+	}
+	defer surface.Destroy()
+	context, err := CairoCreateContext(surface)
+	if err != nil {
+		return err
+	}
+	defer context.Destroy()
+
+	if err = context.SetSourceRGB(0, 0, 0); err != nil {
+		return err
+	}
+	for _, line := range page.Lines {
+		if err = context.SetLineWidth(line.Width); err != nil {
+			return err
+		}
+		if err = context.MoveTo(line.X1, line.Y1); err != nil {
+			return err
+		}
+		if err = context.LineTo(line.X2, line.Y2); err != nil {
+			return err
+		}
+		if err = context.Stroke(); err != nil {
+			return err
+		}
+	}
+	for _, patch := range page.Patches {
+		if err = context.SetSourceRGB(patch.R, patch.G, patch.B); err != nil {
+			return err
+		}
+		if err = context.Rectangle(patch.X, patch.Y, patch.Width, patch.Height); err != nil {
+			return err
+		}
+		if err = context.Fill(); err != nil {
+			return err
+		}
+	}
+	if err = context.SetSourceRGB(0, 0, 0); err != nil {
+		return err
+	}
+	for _, text := range page.Texts {
+		if err = context.SelectFontFace(font, text.Bold); err != nil {
+			return err
+		}
+		if err = context.SetFontSize(text.Size); err != nil {
+			return err
+		}
+		if err = context.MoveTo(text.X, text.Y); err != nil {
+			return err
+		}
+		if err = context.ShowText(text.Text); err != nil {
+			return err
+		}
+	}
+	if err = surface.ShowPage(); err != nil {
+		return err
+	}
+	return surface.Finish()
+}
@@ -0,0 +1,259 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"io/ioutil"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+	"golang.org/x/sys/windows"
+)
+
+// printDeviceText prints a plain text document with TextOut in a device
+// font of the printer, so that the driver sends the text itself instead of
+// a rendered page, which impact printers print much faster. Lines and pages
+// are laid out from the font metrics and the printable area.
+func printDeviceText(printer *lib.Printer, fileName, title, output, font string, hold *jobHold, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
+	text, err := readText(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	hPrinter, err := OpenPrinter(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+	devMode, err := hPrinter.DocumentPropertiesGet(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err = applyTicketDevMode(hPrinter, printer.Name, devMode, ticket, nil); err != nil {
+		return nil, err
+	}
+
+	var result lib.PrintResult
+	settings, err := lib.ApplyTicket(devMode, printer.Description, ticket, &result)
+	if err != nil {
+		return nil, err
+	}
+	if settings.Placement.FitToPage {
+		result.Warn("fit_to_page", lib.PrintWarningNotImplemented, "text is printed in the device font size, ignored")
+	}
+	if settings.Placement.Margins != nil {
+		result.Warn("margins", lib.PrintWarningNotImplemented, "text is printed within the printable area, ignored")
+	}
+	if settings.Placement.ScalePercent > 0 {
+		result.Warn("scale", lib.PrintWarningNotImplemented, "text is printed in the device font size, ignored")
+	}
+	if settings.NUp > 1 {
+		result.Warn("n_up", lib.PrintWarningNotImplemented, "text is printed one page per sheet, ignored")
+		settings.NUp = 1
+	}
+	if settings.Booklet {
+		result.Warn("booklet", lib.PrintWarningNotImplemented, "text is printed one page per sheet, ignored")
+		settings.Booklet = false
+	}
+	if err = hPrinter.DocumentPropertiesSet(printer.Name, devMode); err != nil {
+		return nil, err
+	}
+
+	hDC, err := CreateDC(printer.Name, devMode)
+	if err != nil {
+		return nil, err
+	}
+	defer hDC.DeleteDC()
+	hFont, err := CreateFont(0, font)
+	if err != nil {
+		return nil, err
+	}
+	defer hFont.DeleteObject()
+	defaultFont, err := hDC.SelectFont(hFont)
+	if err != nil {
+		return nil, err
+	}
+	// Fonts can't be deleted while selected.
+	defer hDC.SelectFont(defaultFont)
+	tm, err := hDC.GetTextMetrics()
+	if err != nil {
+		return nil, err
+	}
+	lineHeight, charWidth := tm.GetLineHeight(), tm.GetAveCharWidth()
+	if lineHeight < 1 {
+		lineHeight = 1
+	}
+	if charWidth < 1 {
+		charWidth = 1
+	}
+	columns := hDC.GetDeviceCaps(HORZRES) / charWidth
+	lines := hDC.GetDeviceCaps(VERTRES) / lineHeight
+
+	pages := lib.LayoutText(text, int(columns), int(lines))
+	if err = settings.CheckPageRange(len(pages)); err != nil {
+		return nil, err
+	}
+
+	jobID, err := hDC.StartDoc(title, output)
+	if err != nil {
+		return nil, err
+	}
+	hPrinter.SetJobUserName(jobID)
+	if err = hold.apply(hPrinter, jobID); err != nil {
+		hPrinter.SetJobCommand(jobID, JOB_CONTROL_DELETE)
+		hDC.EndDoc()
+		return nil, err
+	}
+	c := jobContext{jobID: jobID, hPrinter: hPrinter}
+
+	totalPages := settings.PagesPrinted(len(pages)) * settings.SoftwareCopies
+	for copy := 0; copy < settings.SoftwareCopies; copy++ {
+		// The next copy starts on a new sheet.
+		if copy > 0 && settings.PadsCopies(settings.PagesPrinted(len(pages))) {
+			if err = printTextPage(hDC, hFont, nil, lineHeight); err != nil {
+				hDC.EndDoc()
+				return nil, err
+			}
+		}
+		for i, page := range pages {
+			if !settings.PrintsPage(i + 1) {
+				continue
+			}
+			pageStart := time.Now()
+			if err = printTextPage(hDC, hFont, page, lineHeight); err != nil {
+				hDC.EndDoc()
+				return nil, err
+			}
+			result.Pages++
+			result.PageDurations = append(result.PageDurations, time.Since(pageStart))
+			c.reportProgress(progress, result.Pages, totalPages)
+		}
+	}
+	if err = hDC.EndDoc(); err != nil {
+		return nil, err
+	}
+
+	// Software copies are already counted in Pages.
+	result.Sheets = settings.Sheets(result.Pages / settings.SoftwareCopies)
+
+	// Retained like rendered jobs, see printDocument.
+	ji1, err := hPrinter.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+	if ji1.status&JOB_STATUS_PAUSED == 0 {
+		if err = hPrinter.SetJobCommand(jobID, JOB_CONTROL_RETAIN); err != nil {
+			return nil, err
+		}
+	}
+
+	result.JobID = uint32(jobID)
+	return &result, nil
+}
+
+// rendersText tells whether the plain text documents of a printer are
+// rendered with a TextFormat, rather than sent as ESC/P or device font text.
+func (ws *WinSpool) rendersText(printerName string) bool {
+	if _, ok := ws.escpLayouts[printerName]; ok {
+		return false
+	}
+	_, ok := ws.textDeviceFonts[printerName]
+	return !ok
+}
+
+// textFormat returns the format of the plain text documents of a printer:
+// its own, else WinSpool.TextFormat.
+func (ws *WinSpool) textFormat(printerName string) lib.TextFormat {
+	if format, ok := ws.textFormats[printerName]; ok {
+		return format
+	}
+	return ws.TextFormat
+}
+
+// textToPDF renders a plain text document to PDF with the text format of a
+// printer, on pages of the ticket media size, A4 when it has none, within
+// the ticket margins when it has them. Headers and footers show title.
+func (ws *WinSpool) textToPDF(printerName, source, title, pdf string, ticket *model.JobTicket) error {
+	text, err := readText(source)
+	if err != nil {
+		return err
+	}
+	format := ws.textFormat(printerName)
+
+	widthMicrons, heightMicrons := lib.DefaultHTMLPageOptions.WidthMicrons, lib.DefaultHTMLPageOptions.HeightMicrons
+	var margins *model.MarginsTicketItem
+	if ticket != nil {
+		if ticket.MediaSize != nil && ticket.MediaSize.WidthMicrons > 0 && ticket.MediaSize.HeightMicrons > 0 {
+			widthMicrons, heightMicrons = ticket.MediaSize.WidthMicrons, ticket.MediaSize.HeightMicrons
+		}
+		margins = ticket.Margins
+	}
+	width, height := float64(widthMicrons)*72/25400, float64(heightMicrons)*72/25400
+	area, err := format.Area(width, height, margins)
+	if err != nil {
+		return err
+	}
+
+	fields := lib.TextFields{File: title, Date: time.Now()}
+	return writeLayoutPDF(pdf, width, height, format.FontFamily(), func(measure lib.TextMeasurer) ([]lib.LayoutPage, error) {
+		return format.Pages(text, fields, area, func(text string) float64 {
+			return measure(text, format.FontSize(), false)
+		})
+	})
+}
+
+// readText reads a plain text document, in UTF-8 or else the ANSI code
+// page.
+func readText(fileName string) (string, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	if text, ok := lib.DecodeText(data); ok {
+		return text, nil
+	}
+	return decodeANSI(data)
+}
+
+func printTextPage(hDC HDC, hFont HFONT, lines []string, lineHeight int32) error {
+	if err := hDC.StartPage(); err != nil {
+		return err
+	}
+	// Some drivers reset the device context on each page.
+	if _, err := hDC.SelectFont(hFont); err != nil {
+		hDC.EndPage()
+		return err
+	}
+	for i, line := range lines {
+		if err := hDC.TextOut(0, int32(i)*lineHeight, line); err != nil {
+			hDC.EndPage()
+			return err
+		}
+	}
+	return hDC.EndPage()
+}
+
+// decodeANSI decodes text in the ANSI code page of the system, such as GBK
+// on Chinese Windows, which text that isn't UTF-8 is most likely in.
+func decodeANSI(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	n, err := windows.MultiByteToWideChar(windows.GetACP(), 0, &data[0], int32(len(data)), nil, 0)
+	if err != nil {
+		return "", err
+	}
+	s := make([]uint16, n)
+	if _, err = windows.MultiByteToWideChar(windows.GetACP(), 0, &data[0], int32(len(data)), &s[0], n); err != nil {
+		return "", err
+	}
+	return windows.UTF16ToString(s), nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows && go1.18
+// +build windows,go1.18
+
+package winspool
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func FuzzUTF16PtrToStringSize(f *testing.F) {
+	f.Add([]byte("H\x00P\x00 \x00L\x00a\x00s\x00e\x00r\x00J\x00e\x00t\x00\x00\x00"))
+	f.Add([]byte("\x3d\xd8\x00\xde\x00\x00"))
+	f.Add([]byte("\x00\xd8"))
+	f.Add([]byte("a"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		s := make([]uint16, len(data)/2)
+		for i := range s {
+			s[i] = uint16(data[2*i]) | uint16(data[2*i+1])<<8
+		}
+		if len(s) == 0 {
+			if got := utf16PtrToStringSize(nil, 0); got != "" {
+				t.Fatalf("nil pointer gave %q", got)
+			}
+			return
+		}
+
+		// Never reads past the given size, and stops at the first NUL.
+		got := utf16PtrToStringSize(&s[0], uint32(len(s)*2))
+		if strings.IndexByte(got, 0) >= 0 {
+			t.Fatalf("%q contains NUL", got)
+		}
+		want := s
+		for i, c := range s {
+			if c == 0 {
+				want = s[:i]
+				break
+			}
+		}
+		if expected := string(utf16.Decode(want)); got != expected {
+			t.Fatalf("expected %q got %q", expected, got)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+// Copyright 2015 Google Inc. All rights reserved.
+
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file or at
+// https://developers.google.com/open-source/licenses/bsd
+
+//go:build windows
+// +build windows
+
+package winspool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/winspoolsim"
+)
+
+// Job IDs of virtual printers start here, far above those of the spooler,
+// so that both can be tracked by job ID alone.
+const virtualFirstJobID = 1 << 30
+
+// SetVirtualPrinters replaces the virtual printers, which are listed and
+// print alongside the printers of the spooler. See lib.VirtualPrinterConfig.
+func (ws *WinSpool) SetVirtualPrinters(configs []lib.VirtualPrinterConfig) error {
+	if len(configs) == 0 {
+		ws.virtual = nil
+		return nil
+	}
+	virtual, err := winspoolsim.NewVirtualPrinters(configs, virtualFirstJobID)
+	if err != nil {
+		return err
+	}
+	ws.virtual = virtual
+	ws.setVirtualPrintWindows()
+	return nil
+}
+
+// setVirtualPrintWindows applies the print windows of the config to the
+// virtual printers, as the config may set them before or after.
+func (ws *WinSpool) setVirtualPrintWindows() {
+	if ws.virtual == nil {
+		return
+	}
+	for printerName, window := range ws.printWindows {
+		if ws.virtual.Has(printerName) {
+			ws.virtual.SetPrintWindow(printerName, window)
+		}
+	}
+}
+
+func (ws *WinSpool) isVirtual(printerName string) bool {
+	return ws.virtual != nil && ws.virtual.Has(printerName)
+}
+
+func (ws *WinSpool) getVirtualPrinter(printerName string) (*lib.Printer, error) {
+	printers, err := ws.virtual.GetPrinters()
+	if err != nil {
+		return nil, err
+	}
+	for i := range printers {
+		if printers[i].Name == printerName {
+			printers[i].Description = ws.capabilityOverrides[printerName].Apply(printers[i].Description)
+			return &printers[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+}
+
+func (ws *WinSpool) virtualJobList(printerName string) []Job {
+	simJobs := ws.virtual.Jobs(printerName)
+	jobs := make([]Job, len(simJobs))
+	for i := range simJobs {
+		jobs[i] = newVirtualJob(&simJobs[i], i)
+	}
+	return jobs
+}
+
+// newVirtualJob converts the simulated job at index i of its queue.
+func newVirtualJob(job *winspoolsim.Job, i int) Job {
+	datatype := job.Datatype
+	if datatype == "" {
+		datatype = "NT EMF 1.008"
+	}
+	return Job{
+		Status:      job.Status,
+		Priority:    job.Priority,
+		Position:    uint32(i + 1),
+		Size:        uint32(len(job.Data)),
+		PrinterName: job.Printer,
+		Document:    job.Title,
+		Datatype:    datatype,
+		JobID:       job.ID,
+		UserName:    job.UserName,
+	}
+}
+
+// mergeSpoolerChanges forwards the changes of both channels, until both are
+// closed. Changes are dropped once done is closed.
+func mergeSpoolerChanges(done <-chan struct{}, a, b <-chan lib.SpoolerChange) <-chan lib.SpoolerChange {
+	merged := make(chan lib.SpoolerChange, cap(a))
+	var wg sync.WaitGroup
+	for _, changes := range []<-chan lib.SpoolerChange{a, b} {
+		wg.Add(1)
+		go func(changes <-chan lib.SpoolerChange) {
+			defer wg.Done()
+			for change := range changes {
+				select {
+				case merged <- change:
+				case <-done:
+				}
+			}
+		}(changes)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+func mergeJobChanges(done <-chan struct{}, a, b <-chan lib.JobChange) <-chan lib.JobChange {
+	merged := make(chan lib.JobChange, cap(a))
+	var wg sync.WaitGroup
+	for _, changes := range []<-chan lib.JobChange{a, b} {
+		wg.Add(1)
+		go func(changes <-chan lib.JobChange) {
+			defer wg.Done()
+			for change := range changes {
+				select {
+				case merged <- change:
+				case <-done:
+				}
+			}
+		}(changes)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+func mergeEvents(ctx context.Context, a, b <-chan lib.Event) <-chan lib.Event {
+	merged := make(chan lib.Event, eventQueueSize)
+	var wg sync.WaitGroup
+	for _, events := range []<-chan lib.Event{a, b} {
+		wg.Add(1)
+		go func(events <-chan lib.Event) {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case merged <- event:
+				case <-ctx.Done():
+				}
+			}
+		}(events)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
@@ -15,8 +15,11 @@ import (
 	"reflect"
 	"strings"
 	"syscall"
+	"time"
+	"unicode/utf16"
 	"unsafe"
 
+	"github.com/gorpher/winspool-cgo/lib"
 	"golang.org/x/sys/windows"
 )
 
@@ -27,42 +30,99 @@ var (
 	winspool = syscall.MustLoadDLL("winspool.drv")
 	user32   = syscall.MustLoadDLL("user32.dll")
 
-	abortDocProc                   = gdi32.MustFindProc("AbortDoc")
-	closePrinterProc               = winspool.MustFindProc("ClosePrinter")
-	createDCProc                   = gdi32.MustFindProc("CreateDCW")
-	deleteDCProc                   = gdi32.MustFindProc("DeleteDC")
-	deviceCapabilitiesProc         = winspool.MustFindProc("DeviceCapabilitiesW")
-	documentPropertiesProc         = winspool.MustFindProc("DocumentPropertiesW")
-	endDocProc                     = gdi32.MustFindProc("EndDoc")
-	endPageProc                    = gdi32.MustFindProc("EndPage")
-	enumPrintersProc               = winspool.MustFindProc("EnumPrintersW")
-	getDeviceCapsProc              = gdi32.MustFindProc("GetDeviceCaps")
-	enumJobsProc                   = winspool.MustFindProc("EnumJobsW")
-	getJobProc                     = winspool.MustFindProc("GetJobW")
-	openPrinterProc                = winspool.MustFindProc("OpenPrinterW")
-	resetDCProc                    = gdi32.MustFindProc("ResetDCW")
-	rtlGetVersionProc              = ntoskrnl.MustFindProc("RtlGetVersion")
-	setGraphicsModeProc            = gdi32.MustFindProc("SetGraphicsMode")
-	setJobProc                     = winspool.MustFindProc("SetJobW")
-	setWorldTransformProc          = gdi32.MustFindProc("SetWorldTransform")
-	startDocProc                   = gdi32.MustFindProc("StartDocW")
-	startPageProc                  = gdi32.MustFindProc("StartPage")
-	registerDeviceNotificationProc = user32.MustFindProc("RegisterDeviceNotificationW")
+	abortDocProc                     = gdi32.MustFindProc("AbortDoc")
+	addFormProc                      = winspool.MustFindProc("AddFormW")
+	addPrinterProc                   = winspool.MustFindProc("AddPrinterW")
+	addPrinterConnectionProc         = winspool.MustFindProc("AddPrinterConnectionW")
+	closePrinterProc                 = winspool.MustFindProc("ClosePrinter")
+	createDCProc                     = gdi32.MustFindProc("CreateDCW")
+	createFontProc                   = gdi32.MustFindProc("CreateFontW")
+	deleteDCProc                     = gdi32.MustFindProc("DeleteDC")
+	deleteObjectProc                 = gdi32.MustFindProc("DeleteObject")
+	deleteFormProc                   = winspool.MustFindProc("DeleteFormW")
+	deletePrinterProc                = winspool.MustFindProc("DeletePrinter")
+	deletePrinterConnectionProc      = winspool.MustFindProc("DeletePrinterConnectionW")
+	deviceCapabilitiesProc           = winspool.MustFindProc("DeviceCapabilitiesW")
+	documentPropertiesProc           = winspool.MustFindProc("DocumentPropertiesW")
+	endDocProc                       = gdi32.MustFindProc("EndDoc")
+	endDocPrinterProc                = winspool.MustFindProc("EndDocPrinter")
+	endPagePrinterProc               = winspool.MustFindProc("EndPagePrinter")
+	endPageProc                      = gdi32.MustFindProc("EndPage")
+	enumFormsProc                    = winspool.MustFindProc("EnumFormsW")
+	enumPortsProc                    = winspool.MustFindProc("EnumPortsW")
+	enumPrintersProc                 = winspool.MustFindProc("EnumPrintersW")
+	getDeviceCapsProc                = gdi32.MustFindProc("GetDeviceCaps")
+	getTextMetricsProc               = gdi32.MustFindProc("GetTextMetricsW")
+	enumJobsProc                     = winspool.MustFindProc("EnumJobsW")
+	findClosePrinterChangeProc       = winspool.MustFindProc("FindClosePrinterChangeNotification")
+	findFirstPrinterChangeProc       = winspool.MustFindProc("FindFirstPrinterChangeNotification")
+	findNextPrinterChangeProc        = winspool.MustFindProc("FindNextPrinterChangeNotification")
+	freePrinterNotifyInfoProc        = winspool.MustFindProc("FreePrinterNotifyInfo")
+	getDefaultPrinterProc            = winspool.MustFindProc("GetDefaultPrinterW")
+	getJobProc                       = winspool.MustFindProc("GetJobW")
+	getPrinterProc                   = winspool.MustFindProc("GetPrinterW")
+	getPrinterDriverProc             = winspool.MustFindProc("GetPrinterDriverW")
+	getPrinterDataExProc             = winspool.MustFindProc("GetPrinterDataExW")
+	openPrinterProc                  = winspool.MustFindProc("OpenPrinterW")
+	readPrinterProc                  = winspool.MustFindProc("ReadPrinter")
+	resetDCProc                      = gdi32.MustFindProc("ResetDCW")
+	rtlGetVersionProc                = ntoskrnl.MustFindProc("RtlGetVersion")
+	setDefaultPrinterProc            = winspool.MustFindProc("SetDefaultPrinterW")
+	selectObjectProc                 = gdi32.MustFindProc("SelectObject")
+	setGraphicsModeProc              = gdi32.MustFindProc("SetGraphicsMode")
+	setJobProc                       = winspool.MustFindProc("SetJobW")
+	setPrinterProc                   = winspool.MustFindProc("SetPrinterW")
+	setWorldTransformProc            = gdi32.MustFindProc("SetWorldTransform")
+	startDocProc                     = gdi32.MustFindProc("StartDocW")
+	startDocPrinterProc              = winspool.MustFindProc("StartDocPrinterW")
+	startPagePrinterProc             = winspool.MustFindProc("StartPagePrinter")
+	writePrinterProc                 = winspool.MustFindProc("WritePrinter")
+	xcvDataProc                      = winspool.MustFindProc("XcvDataW")
+	startPageProc                    = gdi32.MustFindProc("StartPage")
+	textOutProc                      = gdi32.MustFindProc("TextOutW")
+	wideCharToMultiByteProc          = kernel32.MustFindProc("WideCharToMultiByte")
+	registerDeviceNotificationProc   = user32.MustFindProc("RegisterDeviceNotificationW")
+	unregisterDeviceNotificationProc = user32.MustFindProc("UnregisterDeviceNotification")
+	registerClassExProc              = user32.MustFindProc("RegisterClassExW")
+	createWindowExProc               = user32.MustFindProc("CreateWindowExW")
+	defWindowProcProc                = user32.MustFindProc("DefWindowProcW")
+	destroyWindowProc                = user32.MustFindProc("DestroyWindow")
+	getMessageProc                   = user32.MustFindProc("GetMessageW")
+	dispatchMessageProc              = user32.MustFindProc("DispatchMessageW")
+	postMessageProc                  = user32.MustFindProc("PostMessageW")
+	postQuitMessageProc              = user32.MustFindProc("PostQuitMessage")
 )
 
 // System error codes.
 const (
-	ERROR_SUCCESS   = 0
-	ERROR_MORE_DATA = 234
+	ERROR_SUCCESS        = 0
+	ERROR_FILE_NOT_FOUND = 2
+	ERROR_MORE_DATA      = 234
 )
 
 // Errors returned by GetLastError().
 const (
-	NO_ERROR                  = syscall.Errno(0)
-	ERROR_INVALID_PARAMETER   = syscall.Errno(87)
-	ERROR_INSUFFICIENT_BUFFER = syscall.Errno(122)
+	NO_ERROR                     = syscall.Errno(0)
+	ERROR_ACCESS_DENIED          = syscall.Errno(5)
+	ERROR_INVALID_PARAMETER      = syscall.Errno(87)
+	ERROR_INSUFFICIENT_BUFFER    = syscall.Errno(122)
+	ERROR_ALREADY_EXISTS         = syscall.Errno(183)
+	ERROR_UNKNOWN_PORT           = syscall.Errno(1796)
+	ERROR_UNKNOWN_PRINTER_DRIVER = syscall.Errno(1797)
+	ERROR_INVALID_PRINTER_NAME   = syscall.Errno(1801)
+	ERROR_PRINTER_ALREADY_EXISTS = syscall.Errno(1802)
 )
 
+// win32Error wraps the error of a failed spooler call in a lib.Win32Error,
+// which errors.Is matches to lib.ErrPrinterNotFound and the other kinds of
+// failures. Errors that aren't Win32 error codes are returned unchanged.
+func win32Error(op, name string, err error) error {
+	if errno, ok := err.(syscall.Errno); ok {
+		return &lib.Win32Error{Op: op, Name: name, Code: uint32(errno), Err: errno}
+	}
+	return err
+}
+
 // First parameter to EnumPrinters().
 const (
 	PRINTER_ENUM_DEFAULT     = 0x00000001
@@ -154,6 +214,148 @@ const (
 	PRINTER_STATUS_DRIVER_UPDATE_NEEDED uint32 = 0x04000000
 )
 
+// PRINTER_DEFAULTS access rights.
+const (
+	PRINTER_ACCESS_ADMINISTER uint32 = 0x00000004
+	PRINTER_ACCESS_USE        uint32 = 0x00000008
+	PRINTER_ALL_ACCESS        uint32 = 0x000F000C
+	SERVER_ACCESS_ADMINISTER  uint32 = 0x00000001
+)
+
+// PORT_INFO_2 port types.
+const (
+	PORT_TYPE_WRITE        uint32 = 0x0001
+	PORT_TYPE_READ         uint32 = 0x0002
+	PORT_TYPE_REDIRECTED   uint32 = 0x0004
+	PORT_TYPE_NET_ATTACHED uint32 = 0x0008
+)
+
+// FORM_INFO_1 flags.
+const (
+	FORM_USER    uint32 = 0x00000000
+	FORM_BUILTIN uint32 = 0x00000001
+	FORM_PRINTER uint32 = 0x00000002
+)
+
+// FORM_INFO_1 struct. Sizes are in thousandths of a millimeter.
+type FormInfo1 struct {
+	flags               uint32
+	pName               *uint16
+	sizeCx, sizeCy      int32
+	imageableAreaLeft   int32
+	imageableAreaTop    int32
+	imageableAreaRight  int32
+	imageableAreaBottom int32
+}
+
+// GetFlags returns FORM_USER, FORM_BUILTIN or FORM_PRINTER.
+func (fi *FormInfo1) GetFlags() uint32 {
+	return fi.flags
+}
+
+func (fi *FormInfo1) GetName() string {
+	return utf16PtrToString(fi.pName)
+}
+
+// GetSize returns the width and height of the form, in microns.
+func (fi *FormInfo1) GetSize() (int32, int32) {
+	return fi.sizeCx, fi.sizeCy
+}
+
+// PORT_DATA_1 protocols.
+const (
+	PROTOCOL_RAWTCP_TYPE uint32 = 1
+	PROTOCOL_LPR_TYPE    uint32 = 2
+)
+
+// PORT_DATA_1 struct, the input of the AddPort command of the Standard
+// TCP/IP Port monitor.
+type PortData1 struct {
+	sztPortName      [64]uint16
+	dwVersion        uint32
+	dwProtocol       uint32
+	cbSize           uint32
+	dwReserved       uint32
+	sztHostAddress   [49]uint16
+	sztSNMPCommunity [33]uint16
+	dwDoubleSpool    uint32
+	sztQueue         [33]uint16
+	sztIPAddress     [16]uint16
+	reserved         [540]byte
+	dwPortNumber     uint32
+	dwSNMPEnabled    uint32
+	dwSNMPDevIndex   uint32
+}
+
+// PORT_INFO_2 struct.
+type PortInfo2 struct {
+	pPortName    *uint16
+	pMonitorName *uint16
+	pDescription *uint16
+	fPortType    uint32
+	reserved     uint32
+}
+
+func (pi *PortInfo2) GetPortName() string {
+	return utf16PtrToString(pi.pPortName)
+}
+
+func (pi *PortInfo2) GetMonitorName() string {
+	return utf16PtrToString(pi.pMonitorName)
+}
+
+func (pi *PortInfo2) GetDescription() string {
+	return utf16PtrToString(pi.pDescription)
+}
+
+// GetPortType returns the PORT_TYPE_* flags of the port.
+func (pi *PortInfo2) GetPortType() uint32 {
+	return pi.fPortType
+}
+
+// PRINTER_DEFAULTS struct.
+type PrinterDefaults struct {
+	pDatatype     *uint16
+	pDevMode      *DevMode
+	desiredAccess uint32
+}
+
+// SetPrinter command values.
+const (
+	PRINTER_CONTROL_PAUSE      uint32 = 1
+	PRINTER_CONTROL_RESUME     uint32 = 2
+	PRINTER_CONTROL_PURGE      uint32 = 3
+	PRINTER_CONTROL_SET_STATUS uint32 = 4
+)
+
+// PRINTER_INFO_1 struct.
+type PrinterInfo1 struct {
+	flags        uint32
+	pDescription *uint16
+	pName        *uint16
+	pComment     *uint16
+}
+
+// GetFlags returns the PRINTER_ENUM_* flags of the entry, such as
+// PRINTER_ENUM_CONTAINER for domains and print servers.
+func (pi *PrinterInfo1) GetFlags() uint32 {
+	return pi.flags
+}
+
+// GetDescription returns the description, for printers their name, driver
+// and location separated by commas.
+func (pi *PrinterInfo1) GetDescription() string {
+	return utf16PtrToString(pi.pDescription)
+}
+
+func (pi *PrinterInfo1) GetName() string {
+	return utf16PtrToString(pi.pName)
+}
+
+func (pi *PrinterInfo1) GetComment() string {
+	return utf16PtrToString(pi.pComment)
+}
+
 // PRINTER_INFO_2 struct.
 type PrinterInfo2 struct {
 	pServerName         *uint16
@@ -195,6 +397,19 @@ func (pi *PrinterInfo2) GetLocation() string {
 	return utf16PtrToString(pi.pLocation)
 }
 
+func (pi *PrinterInfo2) GetComment() string {
+	return utf16PtrToString(pi.pComment)
+}
+
+func (pi *PrinterInfo2) GetShareName() string {
+	return utf16PtrToString(pi.pShareName)
+}
+
+// GetSepFile returns the separator page printed before each job, if any.
+func (pi *PrinterInfo2) GetSepFile() string {
+	return utf16PtrToString(pi.pSepFile)
+}
+
 func (pi *PrinterInfo2) GetDevMode() *DevMode {
 	return pi.pDevMode
 }
@@ -207,6 +422,10 @@ func (pi *PrinterInfo2) GetStatus() uint32 {
 	return pi.status
 }
 
+func (pi *PrinterInfo2) GetJobCount() uint32 {
+	return pi.cJobs
+}
+
 // PRINTER_ENUM_VALUES struct.
 type PrinterEnumValues struct {
 	pValueName  *uint16
@@ -399,6 +618,45 @@ func (dm *DevMode) String() string {
 	return strings.Join(s, ", ")
 }
 
+// Bytes returns a copy of the whole DEVMODE, including the private part of
+// the driver.
+func (dm *DevMode) Bytes() []byte {
+	b := make([]byte, int(dm.dmSize)+int(dm.dmDriverExtra))
+	copy(b, unsafe.Slice((*byte)(unsafe.Pointer(dm)), len(b)))
+	return b
+}
+
+// SetBytes overwrites the whole DEVMODE with data of the same size, as
+// returned by Bytes.
+func (dm *DevMode) SetBytes(data []byte) error {
+	if size := int(dm.dmSize) + int(dm.dmDriverExtra); len(data) != size {
+		return fmt.Errorf("DEVMODE of %d bytes doesn't replace one of %d bytes", len(data), size)
+	}
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(dm)), len(data)), data)
+	return nil
+}
+
+// NewDevModeFromBytes copies a whole DEVMODE, as returned by Bytes. The data
+// must have been checked with lib.ParseDevModeHeader.
+func NewDevModeFromBytes(data []byte) *DevMode {
+	size := len(data)
+	if size < int(unsafe.Sizeof(DevMode{})) {
+		// Older drivers have shorter DEVMODEs; keep all fields readable.
+		size = int(unsafe.Sizeof(DevMode{}))
+	}
+	b := make([]byte, size)
+	copy(b, data)
+	return (*DevMode)(unsafe.Pointer(&b[0]))
+}
+
+func (dm *DevMode) GetDriverVersion() uint16 {
+	return dm.dmDriverVersion
+}
+
+func (dm *DevMode) GetDriverExtra() uint16 {
+	return dm.dmDriverExtra
+}
+
 func (dm *DevMode) GetDeviceName() string {
 	return utf16PtrToStringSize(&dm.dmDeviceName, CCHDEVICENAME*2)
 }
@@ -487,6 +745,31 @@ func (dm *DevMode) SetCollate(collate int16) {
 	dm.dmFields |= DM_COLLATE
 }
 
+func (dm *DevMode) GetDefaultSource() (int16, bool) {
+	return dm.dmDefaultSource, dm.dmFields&DM_DEFAULTSOURCE != 0
+}
+
+func (dm *DevMode) SetDefaultSource(source int16) {
+	dm.dmDefaultSource = source
+	dm.dmFields |= DM_DEFAULTSOURCE
+}
+
+// GetResolution returns the horizontal and vertical DPI; dmPrintQuality can
+// also be a negative DMRES value, which isn't a resolution.
+func (dm *DevMode) GetResolution() (int16, int16, bool) {
+	if dm.dmFields&DM_PRINTQUALITY == 0 || dm.dmPrintQuality <= 0 {
+		return 0, 0, false
+	}
+	if dm.dmFields&DM_YRESOLUTION == 0 {
+		return dm.dmPrintQuality, dm.dmPrintQuality, true
+	}
+	return dm.dmPrintQuality, dm.dmYResolution, true
+}
+
+func (dm *DevMode) GetMediaType() (uint32, bool) {
+	return dm.dmMediaType, dm.dmFields&DM_MEDIATYPE != 0
+}
+
 // DOCINFO struct.
 type DocInfo struct {
 	cbSize       int32
@@ -496,6 +779,90 @@ type DocInfo struct {
 	fwType       uint32
 }
 
+// DOC_INFO_1 struct.
+type DocInfo1 struct {
+	pDocName    *uint16
+	pOutputFile *uint16
+	pDatatype   *uint16
+}
+
+// StartDocPrinter starts a job that receives data with WritePrinter, bypassing GDI.
+// The job is written to the output file instead of the port, when not empty.
+func (hPrinter HANDLE) StartDocPrinter(docName, datatype, output string) (int32, error) {
+	var docInfo DocInfo1
+	var err error
+	docInfo.pDocName, err = syscall.UTF16PtrFromString(docName)
+	if err != nil {
+		return 0, err
+	}
+	if output != "" {
+		if docInfo.pOutputFile, err = syscall.UTF16PtrFromString(output); err != nil {
+			return 0, err
+		}
+	}
+	docInfo.pDatatype, err = syscall.UTF16PtrFromString(datatype)
+	if err != nil {
+		return 0, err
+	}
+
+	r1, _, err := startDocPrinterProc.Call(uintptr(hPrinter), 1, uintptr(unsafe.Pointer(&docInfo)))
+	if r1 == 0 {
+		return 0, win32Error("StartDocPrinter", "", err)
+	}
+	return int32(r1), nil
+}
+
+func (hPrinter HANDLE) EndDocPrinter() error {
+	r1, _, err := endDocPrinterProc.Call(uintptr(hPrinter))
+	if r1 == 0 {
+		return win32Error("EndDocPrinter", "", err)
+	}
+	return nil
+}
+
+func (hPrinter HANDLE) StartPagePrinter() error {
+	r1, _, err := startPagePrinterProc.Call(uintptr(hPrinter))
+	if r1 == 0 {
+		return win32Error("StartPagePrinter", "", err)
+	}
+	return nil
+}
+
+func (hPrinter HANDLE) EndPagePrinter() error {
+	r1, _, err := endPagePrinterProc.Call(uintptr(hPrinter))
+	if r1 == 0 {
+		return win32Error("EndPagePrinter", "", err)
+	}
+	return nil
+}
+
+// WritePrinter sends data to the printer, returning the number of bytes written.
+func (hPrinter HANDLE) WritePrinter(data []byte) (uint32, error) {
+	if len(data) == 0 {
+		return 0, nil
+	}
+	var written uint32
+	r1, _, err := writePrinterProc.Call(uintptr(hPrinter), uintptr(unsafe.Pointer(&data[0])), uintptr(len(data)), uintptr(unsafe.Pointer(&written)))
+	if r1 == 0 {
+		return written, win32Error("WritePrinter", "", err)
+	}
+	return written, nil
+}
+
+// ReadPrinter reads data sent back by a bidirectional printer into buf,
+// returning the number of bytes read.
+func (hPrinter HANDLE) ReadPrinter(buf []byte) (uint32, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	var read uint32
+	r1, _, err := readPrinterProc.Call(uintptr(hPrinter), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), uintptr(unsafe.Pointer(&read)))
+	if r1 == 0 {
+		return read, win32Error("ReadPrinter", "", err)
+	}
+	return read, nil
+}
+
 // Device parameters for GetDeviceCaps().
 const (
 	DRIVERVERSION   = 0
@@ -593,24 +960,41 @@ func binaryRegValueToBytes(data uintptr, size uint32) []byte {
 	return *(*[]byte)(unsafe.Pointer(&hdr))
 }
 
-func enumPrinters(level uint32) ([]byte, uint32, error) {
+// enumPrinters calls EnumPrinters with PRINTER_ENUM_* flags, and the name
+// of a print server, such as \\PRINTSRV01, for PRINTER_ENUM_NAME.
+func enumPrinters(flags uint32, name string, level uint32) ([]byte, uint32, error) {
+	var pName *uint16
+	if name != "" {
+		var err error
+		if pName, err = syscall.UTF16PtrFromString(name); err != nil {
+			return nil, 0, err
+		}
+	}
 	var cbBuf, pcReturned uint32
-	_, _, err := enumPrintersProc.Call(PRINTER_ENUM_LOCAL, 0, uintptr(level), 0, 0, uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	r1, _, err := enumPrintersProc.Call(uintptr(flags), uintptr(unsafe.Pointer(pName)), uintptr(level), 0, 0, uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	if r1 != 0 {
+		// Nothing to list, as often browsing the network.
+		return nil, 0, nil
+	}
 	if err != ERROR_INSUFFICIENT_BUFFER {
-		return nil, 0, err
+		return nil, 0, win32Error("EnumPrinters", name, err)
 	}
 	var pPrinterEnum []byte = make([]byte, cbBuf)
-	r1, _, err := enumPrintersProc.Call(PRINTER_ENUM_LOCAL, 0, uintptr(level), uintptr(unsafe.Pointer(&pPrinterEnum[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	r1, _, err = enumPrintersProc.Call(uintptr(flags), uintptr(unsafe.Pointer(pName)), uintptr(level), uintptr(unsafe.Pointer(&pPrinterEnum[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
 	if r1 == 0 {
-		return nil, 0, err
+		return nil, 0, win32Error("EnumPrinters", name, err)
 	}
 
 	return pPrinterEnum, pcReturned, nil
 }
 
-func EnumPrinters2() ([]PrinterInfo2, error) {
-	pPrinterEnum, pcReturned, err := enumPrinters(2)
-	if err != nil {
+// EnumPrinters2 lists printers with PRINTER_ENUM_* flags: PRINTER_ENUM_LOCAL
+// for those of this computer, with PRINTER_ENUM_CONNECTIONS for the printer
+// connections of the user too, or PRINTER_ENUM_NAME for those of the print
+// server name, such as \\PRINTSRV01.
+func EnumPrinters2(flags uint32, name string) ([]PrinterInfo2, error) {
+	pPrinterEnum, pcReturned, err := enumPrinters(flags, name, 2)
+	if err != nil || pcReturned == 0 {
 		return nil, err
 	}
 
@@ -623,6 +1007,107 @@ func EnumPrinters2() ([]PrinterInfo2, error) {
 	return printers, nil
 }
 
+// EnumPrinters1 lists printers with PRINTER_ENUM_* flags at level 1, which
+// the network and remote enumerations answer with: printers, and with
+// PRINTER_ENUM_CONTAINER, domains and print servers to enumerate by name.
+func EnumPrinters1(flags uint32, name string) ([]PrinterInfo1, error) {
+	pPrinterEnum, pcReturned, err := enumPrinters(flags, name, 1)
+	if err != nil || pcReturned == 0 {
+		return nil, err
+	}
+
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(&pPrinterEnum[0])),
+		Len:  int(pcReturned),
+		Cap:  int(pcReturned),
+	}
+	printers := *(*[]PrinterInfo1)(unsafe.Pointer(&hdr))
+	return printers, nil
+}
+
+// AddPrinterConnection connects the current user to a shared printer, such
+// as \\PRINTSRV01\Office, installing its driver from the server if needed.
+func AddPrinterConnection(printerName string) error {
+	pName, err := syscall.UTF16PtrFromString(printerName)
+	if err != nil {
+		return err
+	}
+	r1, _, err := addPrinterConnectionProc.Call(uintptr(unsafe.Pointer(pName)))
+	if r1 == 0 {
+		return win32Error("AddPrinterConnection", printerName, err)
+	}
+	return nil
+}
+
+// DeletePrinterConnection removes a connection of the current user to a
+// shared printer, such as \\PRINTSRV01\Office.
+func DeletePrinterConnection(printerName string) error {
+	pName, err := syscall.UTF16PtrFromString(printerName)
+	if err != nil {
+		return err
+	}
+	r1, _, err := deletePrinterConnectionProc.Call(uintptr(unsafe.Pointer(pName)))
+	if r1 == 0 {
+		return win32Error("DeletePrinterConnection", printerName, err)
+	}
+	return nil
+}
+
+// EnumPorts2 lists the ports of a print server, such as \\PRINTSRV01, or of
+// this computer when serverName is empty.
+func EnumPorts2(serverName string) ([]PortInfo2, error) {
+	var pName *uint16
+	if serverName != "" {
+		var err error
+		if pName, err = syscall.UTF16PtrFromString(serverName); err != nil {
+			return nil, err
+		}
+	}
+	var cbBuf, pcReturned uint32
+	r1, _, err := enumPortsProc.Call(uintptr(unsafe.Pointer(pName)), 2, 0, 0, uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	if r1 != 0 {
+		return nil, nil
+	}
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return nil, win32Error("EnumPorts", serverName, err)
+	}
+	pPorts := make([]byte, cbBuf)
+	r1, _, err = enumPortsProc.Call(uintptr(unsafe.Pointer(pName)), 2, uintptr(unsafe.Pointer(&pPorts[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	if r1 == 0 {
+		return nil, win32Error("EnumPorts", serverName, err)
+	}
+	if pcReturned == 0 {
+		return nil, nil
+	}
+
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(&pPorts[0])),
+		Len:  int(pcReturned),
+		Cap:  int(pcReturned),
+	}
+	ports := *(*[]PortInfo2)(unsafe.Pointer(&hdr))
+	return ports, nil
+}
+
+// AddPrinter installs a printer on a print server, such as \\PRINTSRV01, or
+// on this computer when serverName is empty, and returns a handle to it
+// opened with PRINTER_ALL_ACCESS. The port, driver and print processor of
+// pi2 must already be installed.
+func AddPrinter(serverName string, pi2 *PrinterInfo2) (HANDLE, error) {
+	var pName *uint16
+	if serverName != "" {
+		var err error
+		if pName, err = syscall.UTF16PtrFromString(serverName); err != nil {
+			return 0, err
+		}
+	}
+	r1, _, err := addPrinterProc.Call(uintptr(unsafe.Pointer(pName)), 2, uintptr(unsafe.Pointer(pi2)))
+	if r1 == 0 {
+		return 0, win32Error("AddPrinter", utf16PtrToString(pi2.pPrinterName), err)
+	}
+	return HANDLE(r1), nil
+}
+
 type HANDLE uintptr
 
 func OpenPrinter(printerName string) (HANDLE, error) {
@@ -635,57 +1120,402 @@ func OpenPrinter(printerName string) (HANDLE, error) {
 	var hPrinter HANDLE
 	r1, _, err := openPrinterProc.Call(uintptr(unsafe.Pointer(pPrinterName)), uintptr(unsafe.Pointer(&hPrinter)), 0)
 	if r1 == 0 {
+		return 0, win32Error("OpenPrinter", printerName, err)
+	}
+	return hPrinter, nil
+}
+
+// GetDefaultPrinter returns the name of the default printer of the current
+// user; it fails with ERROR_FILE_NOT_FOUND when there is none.
+func GetDefaultPrinter() (string, error) {
+	var cchBuffer uint32
+	_, _, err := getDefaultPrinterProc.Call(0, uintptr(unsafe.Pointer(&cchBuffer)))
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return "", win32Error("GetDefaultPrinter", "", err)
+	}
+
+	buffer := make([]uint16, cchBuffer)
+	r1, _, err := getDefaultPrinterProc.Call(uintptr(unsafe.Pointer(&buffer[0])), uintptr(unsafe.Pointer(&cchBuffer)))
+	if r1 == 0 {
+		return "", win32Error("GetDefaultPrinter", "", err)
+	}
+	return syscall.UTF16ToString(buffer), nil
+}
+
+// SetDefaultPrinter sets the default printer of the current user.
+func SetDefaultPrinter(printerName string) error {
+	pPrinterName, err := syscall.UTF16PtrFromString(printerName)
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := setDefaultPrinterProc.Call(uintptr(unsafe.Pointer(pPrinterName)))
+	if r1 == 0 {
+		return win32Error("SetDefaultPrinter", printerName, err)
+	}
+	return nil
+}
+
+// OpenPrintServer opens a handle to a print server, such as \\PRINTSRV01,
+// or the local one when empty, which receives change notifications for all
+// its printers.
+func OpenPrintServer(serverName string) (HANDLE, error) {
+	var pServerName *uint16
+	if serverName != "" {
+		var err error
+		if pServerName, err = syscall.UTF16PtrFromString(serverName); err != nil {
+			return 0, err
+		}
+	}
+	var hPrinter HANDLE
+	r1, _, err := openPrinterProc.Call(uintptr(unsafe.Pointer(pServerName)), uintptr(unsafe.Pointer(&hPrinter)), 0)
+	if r1 == 0 {
+		return 0, win32Error("OpenPrinter", serverName, err)
+	}
+	return hPrinter, nil
+}
+
+// OpenPrintServerAccess is OpenPrintServer with SERVER_ACCESS_* rights,
+// such as SERVER_ACCESS_ADMINISTER to manage its forms.
+func OpenPrintServerAccess(serverName string, desiredAccess uint32) (HANDLE, error) {
+	var pServerName *uint16
+	if serverName != "" {
+		var err error
+		if pServerName, err = syscall.UTF16PtrFromString(serverName); err != nil {
+			return 0, err
+		}
+	}
+	defaults := PrinterDefaults{desiredAccess: desiredAccess}
+	var hPrinter HANDLE
+	r1, _, err := openPrinterProc.Call(uintptr(unsafe.Pointer(pServerName)), uintptr(unsafe.Pointer(&hPrinter)), uintptr(unsafe.Pointer(&defaults)))
+	if r1 == 0 {
+		return 0, win32Error("OpenPrinter", serverName, err)
+	}
+	return hPrinter, nil
+}
+
+// OpenPrinterAccess opens a printer with the given PRINTER_ACCESS_* rights,
+// which are required for queue management.
+func OpenPrinterAccess(printerName string, desiredAccess uint32) (HANDLE, error) {
+	pPrinterName, err := syscall.UTF16PtrFromString(printerName)
+	if err != nil {
 		return 0, err
 	}
+
+	defaults := PrinterDefaults{desiredAccess: desiredAccess}
+	var hPrinter HANDLE
+	r1, _, err := openPrinterProc.Call(uintptr(unsafe.Pointer(pPrinterName)), uintptr(unsafe.Pointer(&hPrinter)), uintptr(unsafe.Pointer(&defaults)))
+	if r1 == 0 {
+		return 0, win32Error("OpenPrinter", printerName, err)
+	}
 	return hPrinter, nil
 }
 
 func (hPrinter *HANDLE) ClosePrinter() error {
 	r1, _, err := closePrinterProc.Call(uintptr(*hPrinter))
 	if r1 == 0 {
-		return err
+		return win32Error("ClosePrinter", "", err)
 	}
 	*hPrinter = 0
 	return nil
 }
 
-func (hPrinter HANDLE) DocumentPropertiesGet(deviceName string) (*DevMode, error) {
-	pDeviceName, err := syscall.UTF16PtrFromString(deviceName)
-	if err != nil {
-		return nil, err
+func (hPrinter HANDLE) GetPrinter2() (*PrinterInfo2, error) {
+	var cbBuf uint32
+	_, _, err := getPrinterProc.Call(uintptr(hPrinter), 2, 0, 0, uintptr(unsafe.Pointer(&cbBuf)))
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return nil, win32Error("GetPrinter", "", err)
 	}
 
-	r1, _, err := documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), 0, 0, 0)
-	cbBuf := int32(r1)
-	if cbBuf < 0 {
-		return nil, err
+	var pPrinter []byte = make([]byte, cbBuf)
+	r1, _, err := getPrinterProc.Call(uintptr(hPrinter), 2, uintptr(unsafe.Pointer(&pPrinter[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)))
+	if r1 == 0 {
+		return nil, win32Error("GetPrinter", "", err)
 	}
 
-	var pDevMode []byte = make([]byte, cbBuf)
-	devMode := (*DevMode)(unsafe.Pointer(&pDevMode[0]))
-	devMode.dmSize = uint16(cbBuf)
-	devMode.dmSpecVersion = DM_SPECVERSION
+	return (*PrinterInfo2)(unsafe.Pointer(&pPrinter[0])), nil
+}
 
-	r1, _, err = documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), uintptr(unsafe.Pointer(devMode)), uintptr(unsafe.Pointer(devMode)), uintptr(DM_COPY))
-	if int32(r1) < 0 {
-		return nil, err
-	}
+// DRIVER_INFO_6 struct, up to ftDriverDate. dwlDriverVersion is 8-byte
+// aligned in C, and not on 386 in Go, so the fields after it are read with
+// driverInfo6Tail.
+type DriverInfo6 struct {
+	cVersion          uint32
+	pName             *uint16
+	pEnvironment      *uint16
+	pDriverPath       *uint16
+	pDataFile         *uint16
+	pConfigFile       *uint16
+	pHelpFile         *uint16
+	pDependentFiles   *uint16
+	pMonitorName      *uint16
+	pDefaultDataType  *uint16
+	pszzPreviousNames *uint16
+	ftDriverDate      syscall.Filetime
+}
 
-	return devMode, nil
+type driverInfo6Tail struct {
+	dwlDriverVersion uint64
+	pszMfgName       *uint16
+	pszOEMUrl        *uint16
+	pszHardwareID    *uint16
+	pszProvider      *uint16
 }
 
-func (hPrinter HANDLE) DocumentPropertiesSet(deviceName string, devMode *DevMode) error {
-	pDeviceName, err := syscall.UTF16PtrFromString(deviceName)
-	if err != nil {
-		return err
+func (di *DriverInfo6) tail() *driverInfo6Tail {
+	offset := (unsafe.Sizeof(*di) + 7) &^ 7
+	return (*driverInfo6Tail)(unsafe.Pointer(uintptr(unsafe.Pointer(di)) + offset))
+}
+
+func (di *DriverInfo6) GetName() string {
+	return utf16PtrToString(di.pName)
+}
+
+// GetDriverDate returns the date of the driver; zero when it has none.
+func (di *DriverInfo6) GetDriverDate() time.Time {
+	if di.ftDriverDate.HighDateTime == 0 && di.ftDriverDate.LowDateTime == 0 {
+		return time.Time{}
 	}
+	return time.Unix(0, di.ftDriverDate.Nanoseconds()).UTC()
+}
 
-	r1, _, err := documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), uintptr(unsafe.Pointer(devMode)), uintptr(unsafe.Pointer(devMode)), uintptr(DM_COPY|DM_MODIFY))
-	if int32(r1) < 0 {
-		return err
+// GetDriverVersion returns the file version of the driver, such as
+// "61.180.1.20062"; empty when it has none.
+func (di *DriverInfo6) GetDriverVersion() string {
+	v := di.tail().dwlDriverVersion
+	if v == 0 {
+		return ""
 	}
+	return fmt.Sprintf("%d.%d.%d.%d", v>>48, v>>32&0xffff, v>>16&0xffff, v&0xffff)
+}
 
-	return nil
+func (di *DriverInfo6) GetManufacturer() string {
+	return utf16PtrToString(di.tail().pszMfgName)
+}
+
+func (di *DriverInfo6) GetHardwareID() string {
+	return utf16PtrToString(di.tail().pszHardwareID)
+}
+
+func (di *DriverInfo6) GetProvider() string {
+	return utf16PtrToString(di.tail().pszProvider)
+}
+
+// GetPrinterDriver6 returns the driver of the printer, for the environment
+// of this process.
+func (hPrinter HANDLE) GetPrinterDriver6() (*DriverInfo6, error) {
+	var cbBuf uint32
+	_, _, err := getPrinterDriverProc.Call(uintptr(hPrinter), 0, 6, 0, 0, uintptr(unsafe.Pointer(&cbBuf)))
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return nil, win32Error("GetPrinterDriver", "", err)
+	}
+
+	var pDriverInfo []byte = make([]byte, cbBuf)
+	r1, _, err := getPrinterDriverProc.Call(uintptr(hPrinter), 0, 6, uintptr(unsafe.Pointer(&pDriverInfo[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)))
+	if r1 == 0 {
+		return nil, win32Error("GetPrinterDriver", "", err)
+	}
+
+	return (*DriverInfo6)(unsafe.Pointer(&pDriverInfo[0])), nil
+}
+
+// PRINTER_INFO_8 struct.
+type PrinterInfo8 struct {
+	pDevMode *DevMode
+}
+
+// SetPrinter2 sets the properties of a printer opened with
+// PRINTER_ACCESS_ADMINISTER; a nil security descriptor keeps the current one.
+func (hPrinter HANDLE) SetPrinter2(pi2 *PrinterInfo2) error {
+	r1, _, err := setPrinterProc.Call(uintptr(hPrinter), 2, uintptr(unsafe.Pointer(pi2)), 0)
+	if r1 == 0 {
+		return win32Error("SetPrinter", utf16PtrToString(pi2.pPrinterName), err)
+	}
+	return nil
+}
+
+// SetPrinterDevMode sets the global default DEVMODE of a printer, which
+// users without their own printing preferences get.
+func (hPrinter HANDLE) SetPrinterDevMode(devMode *DevMode) error {
+	pi8 := PrinterInfo8{pDevMode: devMode}
+	r1, _, err := setPrinterProc.Call(uintptr(hPrinter), 8, uintptr(unsafe.Pointer(&pi8)), 0)
+	if r1 == 0 {
+		return win32Error("SetPrinter", "", err)
+	}
+	return nil
+}
+
+// DeletePrinter marks a printer opened with PRINTER_ALL_ACCESS for deletion;
+// it is deleted once its jobs are done and its handles closed.
+func (hPrinter HANDLE) DeletePrinter() error {
+	r1, _, err := deletePrinterProc.Call(uintptr(hPrinter))
+	if r1 == 0 {
+		return win32Error("DeletePrinter", "", err)
+	}
+	return nil
+}
+
+// EnumForms1 lists the forms of the print server of a printer, or of a
+// print server opened with OpenPrintServer.
+func (hPrinter HANDLE) EnumForms1() ([]FormInfo1, error) {
+	var cbBuf, pcReturned uint32
+	r1, _, err := enumFormsProc.Call(uintptr(hPrinter), 1, 0, 0, uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	if r1 != 0 {
+		return nil, nil
+	}
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return nil, win32Error("EnumForms", "", err)
+	}
+	pForms := make([]byte, cbBuf)
+	r1, _, err = enumFormsProc.Call(uintptr(hPrinter), 1, uintptr(unsafe.Pointer(&pForms[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)), uintptr(unsafe.Pointer(&pcReturned)))
+	if r1 == 0 {
+		return nil, win32Error("EnumForms", "", err)
+	}
+	if pcReturned == 0 {
+		return nil, nil
+	}
+
+	hdr := reflect.SliceHeader{
+		Data: uintptr(unsafe.Pointer(&pForms[0])),
+		Len:  int(pcReturned),
+		Cap:  int(pcReturned),
+	}
+	forms := *(*[]FormInfo1)(unsafe.Pointer(&hdr))
+	return forms, nil
+}
+
+// AddForm adds a user form of a width and height in microns, printable to
+// its edges, to a print server opened with SERVER_ACCESS_ADMINISTER.
+func (hPrinter HANDLE) AddForm(formName string, width, height int32) error {
+	pName, err := syscall.UTF16PtrFromString(formName)
+	if err != nil {
+		return err
+	}
+	fi1 := FormInfo1{
+		flags:               FORM_USER,
+		pName:               pName,
+		sizeCx:              width,
+		sizeCy:              height,
+		imageableAreaRight:  width,
+		imageableAreaBottom: height,
+	}
+	r1, _, err := addFormProc.Call(uintptr(hPrinter), 1, uintptr(unsafe.Pointer(&fi1)))
+	if r1 == 0 {
+		return win32Error("AddForm", formName, err)
+	}
+	return nil
+}
+
+// DeleteForm deletes a user form from a print server opened with
+// SERVER_ACCESS_ADMINISTER.
+func (hPrinter HANDLE) DeleteForm(formName string) error {
+	pName, err := syscall.UTF16PtrFromString(formName)
+	if err != nil {
+		return err
+	}
+	r1, _, err := deleteFormProc.Call(uintptr(hPrinter), uintptr(unsafe.Pointer(pName)))
+	if r1 == 0 {
+		return win32Error("DeleteForm", formName, err)
+	}
+	return nil
+}
+
+// XcvData sends a command, such as AddPort, with its input to the port
+// monitor opened with OpenPrinterAccess as ",XcvMonitor <monitor>". The
+// monitor answers with a Win32 error code of its own, returned as an error.
+func (hXcv HANDLE) XcvData(dataName string, input unsafe.Pointer, cbInput uint32) error {
+	pDataName, err := syscall.UTF16PtrFromString(dataName)
+	if err != nil {
+		return err
+	}
+	var cbOutputNeeded, status uint32
+	r1, _, err := xcvDataProc.Call(uintptr(hXcv), uintptr(unsafe.Pointer(pDataName)), uintptr(input), uintptr(cbInput), 0, 0, uintptr(unsafe.Pointer(&cbOutputNeeded)), uintptr(unsafe.Pointer(&status)))
+	if r1 == 0 {
+		return win32Error("XcvData", dataName, err)
+	}
+	if status != ERROR_SUCCESS {
+		return win32Error("XcvData", dataName, syscall.Errno(status))
+	}
+	return nil
+}
+
+func (hPrinter HANDLE) SetPrinterCommand(command uint32) error {
+	r1, _, err := setPrinterProc.Call(uintptr(hPrinter), 0, 0, uintptr(command))
+	if r1 == 0 {
+		return win32Error("SetPrinter", "", err)
+	}
+	return nil
+}
+
+func (hPrinter HANDLE) DocumentPropertiesGet(deviceName string) (*DevMode, error) {
+	pDeviceName, err := syscall.UTF16PtrFromString(deviceName)
+	if err != nil {
+		return nil, err
+	}
+
+	r1, _, err := documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), 0, 0, 0)
+	cbBuf := int32(r1)
+	if cbBuf < 0 {
+		return nil, win32Error("DocumentProperties", deviceName, err)
+	}
+
+	var pDevMode []byte = make([]byte, cbBuf)
+	devMode := (*DevMode)(unsafe.Pointer(&pDevMode[0]))
+	devMode.dmSize = uint16(cbBuf)
+	devMode.dmSpecVersion = DM_SPECVERSION
+
+	r1, _, err = documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), uintptr(unsafe.Pointer(devMode)), uintptr(unsafe.Pointer(devMode)), uintptr(DM_COPY))
+	if int32(r1) < 0 {
+		return nil, win32Error("DocumentProperties", deviceName, err)
+	}
+
+	return devMode, nil
+}
+
+func (hPrinter HANDLE) DocumentPropertiesSet(deviceName string, devMode *DevMode) error {
+	pDeviceName, err := syscall.UTF16PtrFromString(deviceName)
+	if err != nil {
+		return err
+	}
+
+	r1, _, err := documentPropertiesProc.Call(0, uintptr(hPrinter), uintptr(unsafe.Pointer(pDeviceName)), uintptr(unsafe.Pointer(devMode)), uintptr(unsafe.Pointer(devMode)), uintptr(DM_COPY|DM_MODIFY))
+	if int32(r1) < 0 {
+		return win32Error("DocumentProperties", deviceName, err)
+	}
+
+	return nil
+}
+
+// GetPrinterDataExString reads a REG_SZ value from the printer's registry data.
+func (hPrinter HANDLE) GetPrinterDataExString(keyName, valueName string) (string, error) {
+	pKeyName, err := syscall.UTF16PtrFromString(keyName)
+	if err != nil {
+		return "", err
+	}
+	pValueName, err := syscall.UTF16PtrFromString(valueName)
+	if err != nil {
+		return "", err
+	}
+
+	var valueType, cbNeeded uint32
+	r1, _, _ := getPrinterDataExProc.Call(uintptr(hPrinter), uintptr(unsafe.Pointer(pKeyName)), uintptr(unsafe.Pointer(pValueName)), uintptr(unsafe.Pointer(&valueType)), 0, 0, uintptr(unsafe.Pointer(&cbNeeded)))
+	if r1 != ERROR_MORE_DATA {
+		return "", win32Error("GetPrinterDataEx", valueName, syscall.Errno(r1))
+	}
+	if cbNeeded == 0 {
+		return "", nil
+	}
+
+	pData := make([]byte, cbNeeded)
+	r1, _, _ = getPrinterDataExProc.Call(uintptr(hPrinter), uintptr(unsafe.Pointer(pKeyName)), uintptr(unsafe.Pointer(pValueName)), uintptr(unsafe.Pointer(&valueType)), uintptr(unsafe.Pointer(&pData[0])), uintptr(cbNeeded), uintptr(unsafe.Pointer(&cbNeeded)))
+	if r1 != ERROR_SUCCESS {
+		return "", win32Error("GetPrinterDataEx", valueName, syscall.Errno(r1))
+	}
+	if valueType != REG_SZ && valueType != REG_EXPAND_SZ {
+		return "", fmt.Errorf("printer data %s\\%s has type %d, expected string", keyName, valueName, valueType)
+	}
+
+	return utf16PtrToStringSize((*uint16)(unsafe.Pointer(&pData[0])), cbNeeded), nil
 }
 
 // JOB_INFO_1 status values.
@@ -737,6 +1567,14 @@ func (ji1 *JobInfo1) GetStatus() uint32 {
 	return ji1.status
 }
 
+func (ji1 *JobInfo1) GetPosition() uint32 {
+	return ji1.position
+}
+
+func (ji1 *JobInfo1) GetPriority() uint32 {
+	return ji1.priority
+}
+
 func (ji1 *JobInfo1) GetTotalPages() uint32 {
 	return ji1.totalPages
 }
@@ -749,13 +1587,13 @@ func (hPrinter HANDLE) GetJob(jobID int32) (*JobInfo1, error) {
 	var cbBuf uint32
 	_, _, err := getJobProc.Call(uintptr(hPrinter), uintptr(jobID), 1, 0, 0, uintptr(unsafe.Pointer(&cbBuf)))
 	if err != ERROR_INSUFFICIENT_BUFFER {
-		return nil, err
+		return nil, win32Error("GetJob", "", err)
 	}
 
 	var pJob []byte = make([]byte, cbBuf)
 	r1, _, err := getJobProc.Call(uintptr(hPrinter), uintptr(jobID), 1, uintptr(unsafe.Pointer(&pJob[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)))
 	if r1 == 0 {
-		return nil, err
+		return nil, win32Error("GetJob", "", err)
 	}
 
 	var ji1 JobInfo1 = *(*JobInfo1)(unsafe.Pointer(&pJob[0]))
@@ -763,6 +1601,153 @@ func (hPrinter HANDLE) GetJob(jobID int32) (*JobInfo1, error) {
 	return &ji1, nil
 }
 
+// JOB_INFO_2 struct.
+type JobInfo2 struct {
+	jobID               uint32
+	pPrinterName        *uint16
+	pMachineName        *uint16
+	pUserName           *uint16
+	pDocument           *uint16
+	pNotifyName         *uint16
+	pDatatype           *uint16
+	pPrintProcessor     *uint16
+	pParameters         *uint16
+	pDriverName         *uint16
+	pDevMode            *DevMode
+	pStatus             *uint16
+	pSecurityDescriptor uintptr
+	status              uint32
+	priority            uint32
+	position            uint32
+	startTime           uint32
+	untilTime           uint32
+	totalPages          uint32
+	size                uint32
+
+	// SYSTEMTIME structure, in line.
+	wSubmittedYear         uint16
+	wSubmittedMonth        uint16
+	wSubmittedDayOfWeek    uint16
+	wSubmittedDay          uint16
+	wSubmittedHour         uint16
+	wSubmittedMinute       uint16
+	wSubmittedSecond       uint16
+	wSubmittedMilliseconds uint16
+
+	time         uint32
+	pagesPrinted uint32
+}
+
+func (ji2 *JobInfo2) GetJobID() uint32 {
+	return ji2.jobID
+}
+
+func (ji2 *JobInfo2) GetStatus() uint32 {
+	return ji2.status
+}
+
+// GetStatusText returns the status the port monitor or driver set, such as
+// "Toner low"; empty when it didn't.
+func (ji2 *JobInfo2) GetStatusText() string {
+	return utf16PtrToString(ji2.pStatus)
+}
+
+func (ji2 *JobInfo2) GetPriority() uint32 {
+	return ji2.priority
+}
+
+func (ji2 *JobInfo2) GetPosition() uint32 {
+	return ji2.position
+}
+
+func (ji2 *JobInfo2) GetTotalPages() uint32 {
+	return ji2.totalPages
+}
+
+func (ji2 *JobInfo2) GetPagesPrinted() uint32 {
+	return ji2.pagesPrinted
+}
+
+// GetSize returns the size of the spooled job, in bytes.
+func (ji2 *JobInfo2) GetSize() uint32 {
+	return ji2.size
+}
+
+func (ji2 *JobInfo2) GetUserName() string {
+	return utf16PtrToString(ji2.pUserName)
+}
+
+func (ji2 *JobInfo2) GetMachineName() string {
+	return utf16PtrToString(ji2.pMachineName)
+}
+
+func (ji2 *JobInfo2) GetDocument() string {
+	return utf16PtrToString(ji2.pDocument)
+}
+
+func (ji2 *JobInfo2) GetPrinterName() string {
+	return utf16PtrToString(ji2.pPrinterName)
+}
+
+func (ji2 *JobInfo2) GetDriverName() string {
+	return utf16PtrToString(ji2.pDriverName)
+}
+
+func (ji2 *JobInfo2) GetPrintProcessor() string {
+	return utf16PtrToString(ji2.pPrintProcessor)
+}
+
+func (ji2 *JobInfo2) GetDatatype() string {
+	return utf16PtrToString(ji2.pDatatype)
+}
+
+func (ji2 *JobInfo2) GetDevMode() *DevMode {
+	return ji2.pDevMode
+}
+
+// GetOwnerSID returns the owner of the security descriptor of the job, such
+// as S-1-5-21-...; the spooler doesn't always return one, and then it is
+// empty.
+func (ji2 *JobInfo2) GetOwnerSID() string {
+	if ji2.pSecurityDescriptor == 0 {
+		return ""
+	}
+	sd := (*windows.SECURITY_DESCRIPTOR)(unsafe.Pointer(ji2.pSecurityDescriptor))
+	owner, _, err := sd.Owner()
+	if err != nil || owner == nil {
+		return ""
+	}
+	return owner.String()
+}
+
+// GetSubmitted returns when the job was submitted; the spooler keeps it in
+// UTC.
+func (ji2 *JobInfo2) GetSubmitted() time.Time {
+	return time.Date(int(ji2.wSubmittedYear), time.Month(ji2.wSubmittedMonth), int(ji2.wSubmittedDay),
+		int(ji2.wSubmittedHour), int(ji2.wSubmittedMinute), int(ji2.wSubmittedSecond),
+		int(ji2.wSubmittedMilliseconds)*int(time.Millisecond), time.UTC)
+}
+
+// GetJob2 gets JOB_INFO_2, which has the job size on top of JOB_INFO_1.
+func (hPrinter HANDLE) GetJob2(jobID int32) (*JobInfo2, error) {
+	var cbBuf uint32
+	_, _, err := getJobProc.Call(uintptr(hPrinter), uintptr(jobID), 2, 0, 0, uintptr(unsafe.Pointer(&cbBuf)))
+	if err != ERROR_INSUFFICIENT_BUFFER {
+		return nil, win32Error("GetJob", "", err)
+	}
+
+	var pJob []byte = make([]byte, cbBuf)
+	r1, _, err := getJobProc.Call(uintptr(hPrinter), uintptr(jobID), 2, uintptr(unsafe.Pointer(&pJob[0])), uintptr(cbBuf), uintptr(unsafe.Pointer(&cbBuf)))
+	if r1 == 0 {
+		return nil, win32Error("GetJob", "", err)
+	}
+
+	// The strings and DEVMODE point into pJob, which they keep alive.
+	var ji2 JobInfo2 = *(*JobInfo2)(unsafe.Pointer(&pJob[0]))
+
+	return &ji2, nil
+}
+
 // SetJob command values.
 const (
 	JOB_CONTROL_PAUSE             uint32 = 1
@@ -779,7 +1764,7 @@ const (
 func (hPrinter HANDLE) SetJobCommand(jobID int32, command uint32) error {
 	r1, _, err := setJobProc.Call(uintptr(hPrinter), uintptr(jobID), 0, 0, uintptr(command))
 	if r1 == 0 {
-		return err
+		return win32Error("SetJob", "", err)
 	}
 	return nil
 }
@@ -787,7 +1772,7 @@ func (hPrinter HANDLE) SetJobCommand(jobID int32, command uint32) error {
 func (hPrinter HANDLE) SetJobInfo1(jobID int32, ji1 *JobInfo1) error {
 	r1, _, err := setJobProc.Call(uintptr(hPrinter), uintptr(jobID), 1, uintptr(unsafe.Pointer(ji1)), 0)
 	if r1 == 0 {
-		return err
+		return win32Error("SetJob", "", err)
 	}
 	return nil
 }
@@ -806,25 +1791,323 @@ func (hPrinter HANDLE) SetJobUserName(jobID int32) error {
 	return nil
 }
 
+// SetJobPriority sets the priority of a job, from 1 to 99.
+func (hPrinter HANDLE) SetJobPriority(jobID int32, priority uint32) error {
+	ji1, err := hPrinter.GetJob(jobID)
+	if err != nil {
+		return err
+	}
+
+	ji1.priority = priority
+	ji1.position = 0 // JOB_POSITION_UNSPECIFIED, as in SetJobUserName.
+	return hPrinter.SetJobInfo1(jobID, ji1)
+}
+
+// SetJobWindow sets the time of day a job can print, in minutes since
+// midnight UTC; the spooler holds it until then. Zero start and until let
+// the job print at any time.
+func (hPrinter HANDLE) SetJobWindow(jobID int32, start, until uint32) error {
+	ji2, err := hPrinter.GetJob2(jobID)
+	if err != nil {
+		return err
+	}
+
+	ji2.startTime, ji2.untilTime = start, until
+	ji2.pSecurityDescriptor = 0
+	ji2.position = 0 // JOB_POSITION_UNSPECIFIED, as in SetJobUserName.
+	r1, _, err := setJobProc.Call(uintptr(hPrinter), uintptr(jobID), 2, uintptr(unsafe.Pointer(ji2)), 0)
+	if r1 == 0 {
+		return win32Error("SetJob", "", err)
+	}
+	return nil
+}
+
 func (hPrinter HANDLE) EnumJobs1() ([]JobInfo1, error) {
+	buf, jobsReturned, err := hPrinter.enumJobs(1)
+	if err != nil || jobsReturned == 0 {
+		return nil, err
+	}
+	ji1 := (*[4096]JobInfo1)(unsafe.Pointer(&buf[0]))[:jobsReturned:jobsReturned]
+	return ji1, nil
+}
+
+// EnumJobs2 lists the jobs with JOB_INFO_2, which has their DEVMODE, size
+// and submission time on top of JOB_INFO_1.
+func (hPrinter HANDLE) EnumJobs2() ([]JobInfo2, error) {
+	buf, jobsReturned, err := hPrinter.enumJobs(2)
+	if err != nil || jobsReturned == 0 {
+		return nil, err
+	}
+	// The strings and DEVMODEs point into buf, which they keep alive.
+	ji2 := (*[2048]JobInfo2)(unsafe.Pointer(&buf[0]))[:jobsReturned:jobsReturned]
+	return ji2, nil
+}
+
+// enumJobs calls EnumJobs for the first 255 jobs at level, and returns the
+// buffer holding them.
+func (hPrinter HANDLE) enumJobs(level uint32) ([]byte, uint32, error) {
 	var bytesNeeded, jobsReturned uint32
 	buf := make([]byte, 1)
-	_, _, err := enumJobsProc.Call(uintptr(hPrinter), 0, 255, 1, uintptr(unsafe.Pointer(&buf[0])), uintptr(uint32(len(buf))), uintptr(unsafe.Pointer(&bytesNeeded)), uintptr(unsafe.Pointer(&jobsReturned)))
+	r1, _, err := enumJobsProc.Call(uintptr(hPrinter), 0, 255, uintptr(level), uintptr(unsafe.Pointer(&buf[0])), uintptr(uint32(len(buf))), uintptr(unsafe.Pointer(&bytesNeeded)), uintptr(unsafe.Pointer(&jobsReturned)))
+	if r1 != 0 {
+		// No jobs.
+		return nil, 0, nil
+	}
 	if err != syscall.ERROR_INSUFFICIENT_BUFFER {
-		return nil, err
+		return nil, 0, win32Error("EnumJobs", "", err)
 	}
 	if bytesNeeded <= uint32(len(buf)) {
-		return nil, err
+		return nil, 0, win32Error("EnumJobs", "", err)
 	}
 	buf = make([]byte, bytesNeeded)
-	r1, _, err := enumJobsProc.Call(uintptr(hPrinter), 0, 255, 1, uintptr(unsafe.Pointer(&buf[0])), uintptr(uint32(len(buf))), uintptr(unsafe.Pointer(&bytesNeeded)), uintptr(unsafe.Pointer(&jobsReturned)))
+	r1, _, err = enumJobsProc.Call(uintptr(hPrinter), 0, 255, uintptr(level), uintptr(unsafe.Pointer(&buf[0])), uintptr(uint32(len(buf))), uintptr(unsafe.Pointer(&bytesNeeded)), uintptr(unsafe.Pointer(&jobsReturned)))
 	if r1 == 0 {
-		return nil, err
+		return nil, 0, win32Error("EnumJobs", "", err)
 	}
-	fmt.Println("bytesNeeded", bytesNeeded, "jobsReturned", jobsReturned)
-	ji1 := (*[4096]JobInfo1)(unsafe.Pointer(&buf[0]))[:jobsReturned:jobsReturned]
-	fmt.Println("ji1", ji1)
-	return ji1, nil
+	return buf, jobsReturned, nil
+}
+
+// FindFirstPrinterChangeNotification() filter values.
+const (
+	PRINTER_CHANGE_ADD_PRINTER               uint32 = 0x00000001
+	PRINTER_CHANGE_SET_PRINTER               uint32 = 0x00000002
+	PRINTER_CHANGE_DELETE_PRINTER            uint32 = 0x00000004
+	PRINTER_CHANGE_FAILED_CONNECTION_PRINTER uint32 = 0x00000008
+	PRINTER_CHANGE_PRINTER                   uint32 = 0x000000FF
+	PRINTER_CHANGE_ADD_JOB                   uint32 = 0x00000100
+	PRINTER_CHANGE_SET_JOB                   uint32 = 0x00000200
+	PRINTER_CHANGE_DELETE_JOB                uint32 = 0x00000400
+	PRINTER_CHANGE_WRITE_JOB                 uint32 = 0x00000800
+	PRINTER_CHANGE_JOB                       uint32 = 0x0000FF00
+	PRINTER_CHANGE_ADD_FORM                  uint32 = 0x00010000
+	PRINTER_CHANGE_SET_FORM                  uint32 = 0x00020000
+	PRINTER_CHANGE_DELETE_FORM               uint32 = 0x00040000
+	PRINTER_CHANGE_FORM                      uint32 = 0x00070000
+	PRINTER_CHANGE_ADD_PORT                  uint32 = 0x00100000
+	PRINTER_CHANGE_CONFIGURE_PORT            uint32 = 0x00200000
+	PRINTER_CHANGE_DELETE_PORT               uint32 = 0x00400000
+	PRINTER_CHANGE_PORT                      uint32 = 0x00700000
+	PRINTER_CHANGE_ADD_PRINTER_DRIVER        uint32 = 0x10000000
+	PRINTER_CHANGE_SET_PRINTER_DRIVER        uint32 = 0x20000000
+	PRINTER_CHANGE_DELETE_PRINTER_DRIVER     uint32 = 0x40000000
+	PRINTER_CHANGE_PRINTER_DRIVER            uint32 = 0x70000000
+	PRINTER_CHANGE_ALL                       uint32 = 0x7777FFFF
+	PRINTER_CHANGE_TIMEOUT                   uint32 = 0x80000000
+)
+
+type ChangeHandle uintptr
+
+const invalidChangeHandle = ^ChangeHandle(0)
+
+func (hPrinter HANDLE) FindFirstPrinterChangeNotification(filter uint32) (ChangeHandle, error) {
+	r1, _, err := findFirstPrinterChangeProc.Call(uintptr(hPrinter), uintptr(filter), 0, 0)
+	if ChangeHandle(r1) == invalidChangeHandle {
+		return 0, win32Error("FindFirstPrinterChangeNotification", "", err)
+	}
+	return ChangeHandle(r1), nil
+}
+
+// FindNextPrinterChangeNotification resets the change handle after it was
+// signaled, and returns the PRINTER_CHANGE_* flags describing what changed.
+func (hChange ChangeHandle) FindNextPrinterChangeNotification() (uint32, error) {
+	var change uint32
+	r1, _, err := findNextPrinterChangeProc.Call(uintptr(hChange), uintptr(unsafe.Pointer(&change)), 0, 0)
+	if r1 == 0 {
+		return 0, win32Error("FindNextPrinterChangeNotification", "", err)
+	}
+	return change, nil
+}
+
+// Wait blocks until the change handle is signaled or timeout elapses.
+// Returns true if the handle was signaled.
+func (hChange ChangeHandle) Wait(timeout time.Duration) (bool, error) {
+	event, err := windows.WaitForSingleObject(windows.Handle(hChange), uint32(timeout/time.Millisecond))
+	if err != nil {
+		return false, err
+	}
+	switch event {
+	case windows.WAIT_OBJECT_0:
+		return true, nil
+	case uint32(windows.WAIT_TIMEOUT):
+		return false, nil
+	default:
+		return false, fmt.Errorf("WaitForSingleObject returned %d", event)
+	}
+}
+
+func (hChange *ChangeHandle) FindClosePrinterChangeNotification() error {
+	r1, _, err := findClosePrinterChangeProc.Call(uintptr(*hChange))
+	if r1 == 0 {
+		return win32Error("FindClosePrinterChangeNotification", "", err)
+	}
+	*hChange = 0
+	return nil
+}
+
+// PRINTER_NOTIFY_OPTIONS_TYPE Type values.
+const (
+	PRINTER_NOTIFY_TYPE uint16 = 0x00
+	JOB_NOTIFY_TYPE     uint16 = 0x01
+)
+
+// Job notification fields.
+const (
+	JOB_NOTIFY_FIELD_PRINTER_NAME        uint16 = 0x00
+	JOB_NOTIFY_FIELD_MACHINE_NAME        uint16 = 0x01
+	JOB_NOTIFY_FIELD_PORT_NAME           uint16 = 0x02
+	JOB_NOTIFY_FIELD_USER_NAME           uint16 = 0x03
+	JOB_NOTIFY_FIELD_NOTIFY_NAME         uint16 = 0x04
+	JOB_NOTIFY_FIELD_DATATYPE            uint16 = 0x05
+	JOB_NOTIFY_FIELD_PRINT_PROCESSOR     uint16 = 0x06
+	JOB_NOTIFY_FIELD_PARAMETERS          uint16 = 0x07
+	JOB_NOTIFY_FIELD_DRIVER_NAME         uint16 = 0x08
+	JOB_NOTIFY_FIELD_DEVMODE             uint16 = 0x09
+	JOB_NOTIFY_FIELD_STATUS              uint16 = 0x0A
+	JOB_NOTIFY_FIELD_STATUS_STRING       uint16 = 0x0B
+	JOB_NOTIFY_FIELD_SECURITY_DESCRIPTOR uint16 = 0x0C
+	JOB_NOTIFY_FIELD_DOCUMENT            uint16 = 0x0D
+	JOB_NOTIFY_FIELD_PRIORITY            uint16 = 0x0E
+	JOB_NOTIFY_FIELD_POSITION            uint16 = 0x0F
+	JOB_NOTIFY_FIELD_SUBMITTED           uint16 = 0x10
+	JOB_NOTIFY_FIELD_START_TIME          uint16 = 0x11
+	JOB_NOTIFY_FIELD_UNTIL_TIME          uint16 = 0x12
+	JOB_NOTIFY_FIELD_TIME                uint16 = 0x13
+	JOB_NOTIFY_FIELD_TOTAL_PAGES         uint16 = 0x14
+	JOB_NOTIFY_FIELD_PAGES_PRINTED       uint16 = 0x15
+	JOB_NOTIFY_FIELD_TOTAL_BYTES         uint16 = 0x16
+	JOB_NOTIFY_FIELD_BYTES_PRINTED       uint16 = 0x17
+)
+
+const (
+	// PRINTER_NOTIFY_OPTIONS Flags value.
+	PRINTER_NOTIFY_OPTIONS_REFRESH uint32 = 0x01
+	// PRINTER_NOTIFY_INFO Flags value.
+	PRINTER_NOTIFY_INFO_DISCARDED uint32 = 0x01
+)
+
+// PRINTER_NOTIFY_OPTIONS_TYPE struct.
+type PrinterNotifyOptionsType struct {
+	Type      uint16
+	reserved0 uint16
+	reserved1 uint32
+	reserved2 uint32
+	count     uint32
+	pFields   *uint16
+}
+
+func NewPrinterNotifyOptionsType(notifyType uint16, fields []uint16) PrinterNotifyOptionsType {
+	t := PrinterNotifyOptionsType{Type: notifyType, count: uint32(len(fields))}
+	if len(fields) > 0 {
+		t.pFields = &fields[0]
+	}
+	return t
+}
+
+// PRINTER_NOTIFY_OPTIONS struct.
+type PrinterNotifyOptions struct {
+	version uint32
+	Flags   uint32
+	count   uint32
+	pTypes  *PrinterNotifyOptionsType
+}
+
+func NewPrinterNotifyOptions(types []PrinterNotifyOptionsType) *PrinterNotifyOptions {
+	o := PrinterNotifyOptions{version: 2, count: uint32(len(types))}
+	if len(types) > 0 {
+		o.pTypes = &types[0]
+	}
+	return &o
+}
+
+// PRINTER_NOTIFY_INFO_DATA struct.
+type printerNotifyInfoData struct {
+	notifyType uint16
+	field      uint16
+	reserved   uint32
+	id         uint32
+	// NotifyData union; cbBuf overlaps adwData[0].
+	cbBuf uint32
+	pBuf  uintptr
+}
+
+// PRINTER_NOTIFY_INFO struct, followed by count PRINTER_NOTIFY_INFO_DATA.
+type printerNotifyInfo struct {
+	version uint32
+	flags   uint32
+	count   uint32
+	aData   [1]printerNotifyInfoData
+}
+
+// Job notification fields that hold strings; the others hold a DWORD, or
+// data that isn't decoded.
+var jobNotifyStringFields = map[uint16]bool{
+	JOB_NOTIFY_FIELD_PRINTER_NAME:    true,
+	JOB_NOTIFY_FIELD_MACHINE_NAME:    true,
+	JOB_NOTIFY_FIELD_PORT_NAME:       true,
+	JOB_NOTIFY_FIELD_USER_NAME:       true,
+	JOB_NOTIFY_FIELD_NOTIFY_NAME:     true,
+	JOB_NOTIFY_FIELD_DATATYPE:        true,
+	JOB_NOTIFY_FIELD_PRINT_PROCESSOR: true,
+	JOB_NOTIFY_FIELD_PARAMETERS:      true,
+	JOB_NOTIFY_FIELD_DRIVER_NAME:     true,
+	JOB_NOTIFY_FIELD_STATUS_STRING:   true,
+	JOB_NOTIFY_FIELD_DOCUMENT:        true,
+}
+
+// PrinterNotifyValue is a field value read from PRINTER_NOTIFY_INFO.
+type PrinterNotifyValue struct {
+	Type  uint16
+	Field uint16
+	// Job ID for JOB_NOTIFY_TYPE values.
+	ID     uint32
+	Number uint32
+	String string
+}
+
+// FindFirstPrinterChangeNotificationOptions is like
+// FindFirstPrinterChangeNotification, and also requests the values of the
+// fields in options, to be read with FindNextPrinterChangeNotificationInfo.
+func (hPrinter HANDLE) FindFirstPrinterChangeNotificationOptions(filter uint32, options *PrinterNotifyOptions) (ChangeHandle, error) {
+	r1, _, err := findFirstPrinterChangeProc.Call(uintptr(hPrinter), uintptr(filter), 0, uintptr(unsafe.Pointer(options)))
+	if ChangeHandle(r1) == invalidChangeHandle {
+		return 0, win32Error("FindFirstPrinterChangeNotification", "", err)
+	}
+	return ChangeHandle(r1), nil
+}
+
+// FindNextPrinterChangeNotificationInfo resets the change handle after it
+// was signaled, and returns the PRINTER_CHANGE_* flags and the changed field
+// values. With refresh, the values of all fields are returned. discarded
+// reports that the spooler dropped values, and a refresh is needed.
+func (hChange ChangeHandle) FindNextPrinterChangeNotificationInfo(refresh bool) (change uint32, values []PrinterNotifyValue, discarded bool, err error) {
+	var options *PrinterNotifyOptions
+	if refresh {
+		options = &PrinterNotifyOptions{version: 2, Flags: PRINTER_NOTIFY_OPTIONS_REFRESH}
+	}
+	var pInfo *printerNotifyInfo
+	r1, _, err := findNextPrinterChangeProc.Call(uintptr(hChange), uintptr(unsafe.Pointer(&change)), uintptr(unsafe.Pointer(options)), uintptr(unsafe.Pointer(&pInfo)))
+	if r1 == 0 {
+		return 0, nil, false, win32Error("FindNextPrinterChangeNotification", "", err)
+	}
+	if pInfo == nil {
+		return change, nil, false, nil
+	}
+	defer freePrinterNotifyInfoProc.Call(uintptr(unsafe.Pointer(pInfo)))
+
+	discarded = pInfo.flags&PRINTER_NOTIFY_INFO_DISCARDED != 0
+	values = make([]PrinterNotifyValue, 0, pInfo.count)
+	size := unsafe.Sizeof(pInfo.aData[0])
+	for i := uintptr(0); i < uintptr(pInfo.count); i++ {
+		d := (*printerNotifyInfoData)(unsafe.Pointer(uintptr(unsafe.Pointer(&pInfo.aData[0])) + i*size))
+		value := PrinterNotifyValue{Type: d.notifyType, Field: d.field, ID: d.id}
+		if d.notifyType == JOB_NOTIFY_TYPE && jobNotifyStringFields[d.field] {
+			value.String = utf16PtrToStringSize((*uint16)(unsafe.Pointer(d.pBuf)), d.cbBuf)
+		} else {
+			value.Number = d.cbBuf
+		}
+		values = append(values, value)
+	}
+	return change, values, discarded, nil
 }
 
 type HDC uintptr
@@ -864,7 +2147,10 @@ func (hDC HDC) GetDeviceCaps(nIndex int32) int32 {
 	return int32(r1)
 }
 
-func (hDC HDC) StartDoc(docName string) (int32, error) {
+// StartDoc starts a job on the DC. The job is written to the output file
+// instead of the port, when not empty, which also keeps FILE: ports and
+// writers such as Microsoft Print to PDF from asking for a file name.
+func (hDC HDC) StartDoc(docName, output string) (int32, error) {
 	var docInfo DocInfo
 	var err error
 	docInfo.cbSize = int32(unsafe.Sizeof(docInfo))
@@ -872,6 +2158,11 @@ func (hDC HDC) StartDoc(docName string) (int32, error) {
 	if err != nil {
 		return 0, err
 	}
+	if output != "" {
+		if docInfo.lpszOutput, err = syscall.UTF16PtrFromString(output); err != nil {
+			return 0, err
+		}
+	}
 
 	r1, _, err := startDocProc.Call(uintptr(hDC), uintptr(unsafe.Pointer(&docInfo)))
 	if r1 <= 0 {
@@ -947,6 +2238,127 @@ func (hDC HDC) SetWorldTransform(xform *XFORM) error {
 	return nil
 }
 
+// CreateFont arguments.
+const (
+	FW_NORMAL           int32  = 400
+	DEFAULT_CHARSET     uint32 = 1
+	OUT_DEVICE_PRECIS   uint32 = 5
+	CLIP_DEFAULT_PRECIS uint32 = 0
+	DRAFT_QUALITY       uint32 = 1
+	FIXED_PITCH         uint32 = 1
+	FF_MODERN           uint32 = 0x30
+)
+
+type HFONT uintptr
+
+// CreateFont creates a font of the given height in logical units, or the
+// default height when zero. OUT_DEVICE_PRECIS makes GDI choose a device font
+// of the printer over a TrueType font of the same name.
+func CreateFont(height int32, faceName string) (HFONT, error) {
+	pFaceName, err := syscall.UTF16PtrFromString(faceName)
+	if err != nil {
+		return 0, err
+	}
+	r1, _, err := createFontProc.Call(uintptr(height), 0, 0, 0, uintptr(FW_NORMAL), 0, 0, 0,
+		uintptr(DEFAULT_CHARSET), uintptr(OUT_DEVICE_PRECIS), uintptr(CLIP_DEFAULT_PRECIS),
+		uintptr(DRAFT_QUALITY), uintptr(FIXED_PITCH|FF_MODERN), uintptr(unsafe.Pointer(pFaceName)))
+	if r1 == 0 {
+		return 0, err
+	}
+	return HFONT(r1), nil
+}
+
+func (hFont HFONT) DeleteObject() error {
+	r1, _, err := deleteObjectProc.Call(uintptr(hFont))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// SelectFont selects a font into the device context, and returns the font
+// it replaces.
+func (hDC HDC) SelectFont(hFont HFONT) (HFONT, error) {
+	r1, _, err := selectObjectProc.Call(uintptr(hDC), uintptr(hFont))
+	if r1 == 0 {
+		return 0, err
+	}
+	return HFONT(r1), nil
+}
+
+// TEXTMETRICW struct.
+type TextMetric struct {
+	tmHeight           int32
+	tmAscent           int32
+	tmDescent          int32
+	tmInternalLeading  int32
+	tmExternalLeading  int32
+	tmAveCharWidth     int32
+	tmMaxCharWidth     int32
+	tmWeight           int32
+	tmOverhang         int32
+	tmDigitizedAspectX int32
+	tmDigitizedAspectY int32
+	tmFirstChar        uint16
+	tmLastChar         uint16
+	tmDefaultChar      uint16
+	tmBreakChar        uint16
+	tmItalic           byte
+	tmUnderlined       byte
+	tmStruckOut        byte
+	tmPitchAndFamily   byte
+	tmCharSet          byte
+}
+
+// GetLineHeight returns the distance between lines of the font.
+func (tm *TextMetric) GetLineHeight() int32 {
+	return tm.tmHeight + tm.tmExternalLeading
+}
+
+func (tm *TextMetric) GetAveCharWidth() int32 {
+	return tm.tmAveCharWidth
+}
+
+func (hDC HDC) GetTextMetrics() (*TextMetric, error) {
+	var tm TextMetric
+	r1, _, err := getTextMetricsProc.Call(uintptr(hDC), uintptr(unsafe.Pointer(&tm)))
+	if r1 == 0 {
+		return nil, err
+	}
+	return &tm, nil
+}
+
+func (hDC HDC) TextOut(x, y int32, text string) error {
+	s := utf16.Encode([]rune(text))
+	if len(s) == 0 {
+		return nil
+	}
+	r1, _, err := textOutProc.Call(uintptr(hDC), uintptr(x), uintptr(y), uintptr(unsafe.Pointer(&s[0])), uintptr(len(s)))
+	if r1 == 0 {
+		return err
+	}
+	return nil
+}
+
+// WideCharToMultiByte encodes text in a code page, with its default
+// character in place of characters the code page doesn't have.
+func WideCharToMultiByte(codePage uint32, text string) ([]byte, error) {
+	s := utf16.Encode([]rune(text))
+	if len(s) == 0 {
+		return nil, nil
+	}
+	r1, _, err := wideCharToMultiByteProc.Call(uintptr(codePage), 0, uintptr(unsafe.Pointer(&s[0])), uintptr(len(s)), 0, 0, 0, 0)
+	if r1 == 0 {
+		return nil, err
+	}
+	b := make([]byte, r1)
+	r1, _, err = wideCharToMultiByteProc.Call(uintptr(codePage), 0, uintptr(unsafe.Pointer(&s[0])), uintptr(len(s)), uintptr(unsafe.Pointer(&b[0])), r1, 0, 0)
+	if r1 == 0 {
+		return nil, err
+	}
+	return b[:r1], nil
+}
+
 func DeviceCapabilitiesInt32(device, port string, fwCapability uint16) (int32, error) {
 	pDevice, err := syscall.UTF16PtrFromString(device)
 	if err != nil {
@@ -1039,6 +2451,31 @@ func DeviceCapabilitiesUint16Array(device, port string, fwCapability uint16) ([]
 	return values, nil
 }
 
+func DeviceCapabilitiesUint32Array(device, port string, fwCapability uint16) ([]uint32, error) {
+	nValue, err := deviceCapabilities(device, port, fwCapability, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if nValue <= 0 {
+		return []uint32{}, nil
+	}
+
+	pOutput := make([]byte, int32Size*nValue)
+	_, err = deviceCapabilities(device, port, fwCapability, pOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]uint32, 0, nValue)
+	for i := int32(0); i < nValue; i++ {
+		value := *(*uint32)(unsafe.Pointer(&pOutput[i*int32Size]))
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
 // DeviceCapabilitiesInt32Pairs returns a slice of an even quantity of int32.
 func DeviceCapabilitiesInt32Pairs(device, port string, fwCapability uint16) ([]int32, error) {
 	nValue, err := deviceCapabilities(device, port, fwCapability, nil)
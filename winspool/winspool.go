@@ -10,18 +10,51 @@
 package winspool
 
 import (
+	"crypto/sha256"
 	"errors"
+	"fmt"
 	"github.com/gorpher/winspool-cgo/lib"
 	"github.com/gorpher/winspool-cgo/model"
+	"github.com/gorpher/winspool-cgo/winspoolsim"
 	"golang.org/x/sys/windows"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var _ lib.NativePrintSystem = (*WinSpool)(nil)
+
+// ErrNoRenderer is returned for documents that need rendering, by builds
+// without cgo, which lack Poppler and Cairo.
+var ErrNoRenderer = errors.New("rendering needs Poppler and Cairo, which this build lacks (built without cgo)")
+
+// RenderingAvailable tells whether this build renders documents, with
+// Poppler and Cairo. Without rendering, only RAW, plain text and pdf_direct
+// documents print.
+func RenderingAvailable() bool {
+	return renderingAvailable
+}
+
 // winspoolPDS represents capabilities that WinSpool always provides.
 var winspoolPDS = model.PrinterDescriptionSection{
 	SupportedContentType: &[]model.SupportedContentType{
-		model.SupportedContentType{ContentType: "application/pdf"},
+		model.SupportedContentType{ContentType: lib.ContentTypePDF},
+		model.SupportedContentType{ContentType: lib.ContentTypePWGRaster},
+		model.SupportedContentType{ContentType: lib.ContentTypeURF},
+		model.SupportedContentType{ContentType: lib.ContentTypeJPEG},
+		model.SupportedContentType{ContentType: lib.ContentTypePNG},
+		model.SupportedContentType{ContentType: lib.ContentTypePostScript},
+		model.SupportedContentType{ContentType: lib.ContentTypeHTML},
+		model.SupportedContentType{ContentType: lib.ContentTypeLayout},
+		model.SupportedContentType{ContentType: lib.ContentTypeZPL},
+		model.SupportedContentType{ContentType: lib.ContentTypeESCPOS},
 	},
 	FitToPage: &model.FitToPage{
 		Option: []model.FitToPageOption{
@@ -39,13 +72,254 @@ var winspoolPDS = model.PrinterDescriptionSection{
 
 // WinSpool Interface between Go and the Windows API.
 type WinSpool struct {
+	// SNMPCommunity enables SNMP serial number queries against network printers
+	// when not empty.
+	SNMPCommunity string
+
+	// GhostscriptPath is the Ghostscript executable used for PostScript
+	// jobs. Found in PATH when empty.
+	GhostscriptPath string
+
+	// HTMLConverter converts HTML files and URLs to PDF. Found in PATH or
+	// the standard browser install locations when empty.
+	HTMLConverter lib.HTMLConverter
+
+	// RenderLimits guard against untrusted documents that would hang or
+	// exhaust Poppler.
+	RenderLimits lib.RenderLimits
+
+	// LayoutFont is the font family layout documents are rendered in.
+	// Arial when empty.
+	LayoutFont string
+
+	// TextFormat lays out plain text documents that are rendered, on
+	// printers without a device font, ESC/P layout or text_format of their
+	// own.
+	TextFormat lib.TextFormat
+
+	// RenderWorkers renders PDF pages on this many workers at once, to
+	// images at up to RenderDPI (300 when zero), while the previous pages
+	// spool. Pages are drawn on the printer one at a time, as vectors, when
+	// below 2.
+	RenderWorkers int
+	RenderDPI     int
+
+	// PDFRenderer is the renderer of PDFs, such as PDFRendererPDFium, of
+	// printers without a pdf_renderer of their own; Poppler when empty.
+	PDFRenderer string
+
+	// DetectPDFDirect sends PDFs as-is to the printers whose driver reports
+	// a PDF printer language, as it does to pdf_direct printers, unless
+	// their pdf_direct is false.
+	DetectPDFDirect bool
+
+	// ProbeCapabilities makes Print look up the capabilities of printers
+	// passed without a Description, such as a lib.Printer holding just a
+	// name. Otherwise their ticket options are dropped, with warnings.
+	ProbeCapabilities bool
+
+	// Quotas refuse jobs that would print more pages today than the user
+	// or printer may. Nil when there are none.
+	Quotas *lib.Quotas
+
+	// HeldJobs notes the jobs held by the hold of their ticket, which is
+	// needed to release them with a PIN. Nil when not configured.
+	HeldJobs *lib.HeldJobs
+
+	// DevModePresets keeps the DEVMODEs jobs can start from by name, with
+	// the devmode_preset vendor ticket item. Nil when not configured.
+	DevModePresets *lib.DevModePresets
+
+	// Retry retries the calls that fail while the spooler service
+	// restarts, opening printers again; the zero policy has the defaults.
+	Retry lib.RetryPolicy
+
+	// Server is the print server whose printers are listed and watched,
+	// such as \\PRINTSRV01, which names them like \\PRINTSRV01\Office; the
+	// local spooler when empty. Printers of any server open by such names.
+	Server string
+	// PrinterConnections lists the printer connections of the user with the
+	// local printers, such as \\PRINTSRV01\Office added with Add Printer.
+	PrinterConnections bool
+
+	// Faults makes spooler calls fail or stall, for resilience tests. Nil
+	// in production.
+	Faults *lib.Faults
+
+	// Capabilities and identity of printers, reused by GetPrinters and
+	// GetPrinter until their driver or defaults change.
+	capabilities lib.CapabilityCache
+	// Printer handles of job calls, kept open between them.
+	handles lib.HandlePool
+	// Security identifiers of job owners, by user name.
+	userSIDs sync.Map
+
+	jobTrailers    map[string][]byte
+	escposStatus   map[string]bool
+	labelLanguages map[string]lib.LabelLanguage
+	// Device fonts of plain text documents, by printer.
+	textDeviceFonts map[string]string
+	escpLayouts     map[string]*lib.ESCPLayout
+	textFormats     map[string]lib.TextFormat
+	// Jobs are held outside of these, by printer.
+	printWindows    map[string]*lib.PrintWindow
+	labelCoalescers map[string]*lib.LabelCoalescer
+	// Printers PDF documents are sent to as-is, or rendered for when false,
+	// as configured.
+	pdfDirect map[string]bool
+	// PDF renderers, by printer.
+	pdfRendererNames map[string]string
+	virtual          *winspoolsim.VirtualPrinters
+
+	// Capabilities masked by the config, by printer.
+	capabilityOverrides map[string]*lib.CapabilityOverrides
+	// Prices of the jobs simulated, by printer.
+	costs map[string]*lib.CostConfig
+	// Jobs just submitted, by printer with a duplicate_window.
+	duplicateDetectors map[string]*lib.DuplicateDetector
+	// Users of the jobs submitted for another user, by lib.TicketUser.
+	jobUsers lib.JobUsers
 }
 
 func NewWinSpool() (*WinSpool, error) {
 	ws := WinSpool{}
+	ws.handles.Open = func(printerName string, access uint32) (uintptr, error) {
+		hPrinter, err := openPrinterWithAccess(printerName, access)
+		return uintptr(hPrinter), err
+	}
+	ws.handles.Close = func(handle uintptr) error {
+		hPrinter := HANDLE(handle)
+		return hPrinter.ClosePrinter()
+	}
 	return &ws, nil
 }
 
+// SetPrinterConfigs applies per-printer settings from the config file.
+func (ws *WinSpool) SetPrinterConfigs(configs map[string]lib.PrinterConfig) error {
+	jobTrailers := make(map[string][]byte, len(configs))
+	escposStatus := make(map[string]bool, len(configs))
+	labelLanguages := make(map[string]lib.LabelLanguage, len(configs))
+	textDeviceFonts := make(map[string]string, len(configs))
+	escpLayouts := make(map[string]*lib.ESCPLayout, len(configs))
+	textFormats := make(map[string]lib.TextFormat, len(configs))
+	printWindows := make(map[string]*lib.PrintWindow, len(configs))
+	labelCoalescers := make(map[string]*lib.LabelCoalescer, len(configs))
+	pdfDirect := make(map[string]bool, len(configs))
+	pdfRendererNames := make(map[string]string, len(configs))
+	capabilityOverrides := make(map[string]*lib.CapabilityOverrides, len(configs))
+	costs := make(map[string]*lib.CostConfig, len(configs))
+	duplicateDetectors := make(map[string]*lib.DuplicateDetector, len(configs))
+	for printerName, config := range configs {
+		if config.DuplicateWindow != "" {
+			window, err := time.ParseDuration(config.DuplicateWindow)
+			if err != nil || window <= 0 {
+				return fmt.Errorf("invalid duplicate_window %q for printer %s", config.DuplicateWindow, printerName)
+			}
+			action := config.DuplicateAction
+			if action == "" {
+				action = lib.DuplicateActionReject
+			} else if !action.Valid() {
+				return fmt.Errorf("invalid duplicate_action %q for printer %s", action, printerName)
+			}
+			if config.CoalesceWindow != "" {
+				return fmt.Errorf("duplicate_window of printer %s can't be combined with coalesce_window, which merges identical labels", printerName)
+			}
+			// Detectors are kept, with the jobs they noted, while the window
+			// and action don't change.
+			if d, ok := ws.duplicateDetectors[printerName]; ok && d.Window == window && d.Action == action {
+				duplicateDetectors[printerName] = d
+			} else {
+				duplicateDetectors[printerName] = &lib.DuplicateDetector{Window: window, Action: action}
+			}
+		}
+		if config.Cost != nil {
+			if err := config.Cost.Validate(); err != nil {
+				return fmt.Errorf("invalid cost for printer %s: %s", printerName, err)
+			}
+			costs[printerName] = config.Cost
+		}
+		if config.Capabilities != nil {
+			if err := config.Capabilities.Validate(); err != nil {
+				return fmt.Errorf("invalid capabilities for printer %s: %s", printerName, err)
+			}
+			capabilityOverrides[printerName] = config.Capabilities
+		}
+		if config.ESCPOSStatus {
+			escposStatus[printerName] = true
+		}
+		if config.PDFDirect != nil {
+			pdfDirect[printerName] = *config.PDFDirect
+		}
+		if config.PDFRenderer != "" {
+			if _, err := findPDFRenderer(config.PDFRenderer); err != nil {
+				return fmt.Errorf("invalid pdf_renderer for printer %s: %s", printerName, err)
+			}
+			pdfRendererNames[printerName] = config.PDFRenderer
+		}
+		if config.TextDeviceFont != "" {
+			textDeviceFonts[printerName] = config.TextDeviceFont
+		}
+		if config.ESCP != nil {
+			if err := config.ESCP.Validate(); err != nil {
+				return fmt.Errorf("invalid escp for printer %s: %s", printerName, err)
+			}
+			escpLayouts[printerName] = config.ESCP
+		}
+		if config.TextFormat != nil {
+			if err := config.TextFormat.Validate(); err != nil {
+				return fmt.Errorf("invalid text_format for printer %s: %s", printerName, err)
+			}
+			textFormats[printerName] = *config.TextFormat
+		}
+		if config.PrintWindow != "" {
+			window, err := lib.ParsePrintWindow(config.PrintWindow)
+			if err != nil {
+				return fmt.Errorf("invalid print_window for printer %s: %s", printerName, err)
+			}
+			printWindows[printerName] = window
+		}
+		if config.LabelLanguage != "" {
+			if !config.LabelLanguage.Valid() {
+				return fmt.Errorf("invalid label_language %q for printer %s", config.LabelLanguage, printerName)
+			}
+			labelLanguages[printerName] = config.LabelLanguage
+		}
+		if config.CoalesceWindow != "" {
+			window, err := time.ParseDuration(config.CoalesceWindow)
+			if err != nil || window <= 0 {
+				return fmt.Errorf("invalid coalesce_window %q for printer %s", config.CoalesceWindow, printerName)
+			}
+			if config.LabelLanguage != lib.LabelLanguageZPL {
+				return fmt.Errorf("coalesce_window of printer %s needs label_language zpl", printerName)
+			}
+			labelCoalescers[printerName] = &lib.LabelCoalescer{Window: window}
+		}
+		if len(config.JobTrailer) == 0 {
+			continue
+		}
+		trailer, err := lib.ParseControlSequences(config.JobTrailer)
+		if err != nil {
+			return fmt.Errorf("invalid job_trailer for printer %s: %s", printerName, err)
+		}
+		jobTrailers[printerName] = trailer
+	}
+	ws.jobTrailers = jobTrailers
+	ws.escposStatus = escposStatus
+	ws.labelLanguages = labelLanguages
+	ws.textDeviceFonts = textDeviceFonts
+	ws.escpLayouts = escpLayouts
+	ws.textFormats = textFormats
+	ws.printWindows = printWindows
+	ws.labelCoalescers = labelCoalescers
+	ws.pdfDirect = pdfDirect
+	ws.pdfRendererNames = pdfRendererNames
+	ws.capabilityOverrides = capabilityOverrides
+	ws.costs = costs
+	ws.duplicateDetectors = duplicateDetectors
+	ws.setVirtualPrintWindows()
+	return nil
+}
+
 func convertPrinterState(wsStatus uint32, wsAttributes uint32) *model.PrinterStateSection {
 	state := model.PrinterStateSection{
 		State:       model.CloudDeviceStateIdle,
@@ -95,6 +369,7 @@ func convertPrinterState(wsStatus uint32, wsAttributes uint32) *model.PrinterSta
 			DescriptionLocalized: model.NewLocalizedString("paper out"),
 		}
 		state.VendorState.Item = append(state.VendorState.Item, vs)
+		state.InputTrayState = &model.InputTrayState{Item: []model.InputTrayStateItem{{VendorID: "paper", State: model.InputTrayStateEmpty}}}
 	}
 	if wsStatus&PRINTER_STATUS_MANUAL_FEED != 0 {
 		vs := model.VendorStateItem{
@@ -259,146 +534,326 @@ func getManModel(driverName string) (man string, model string) {
 	return
 }
 
-// GetPrinters gets all Windows printers found on this computer.
+// GetPrinters gets all Windows printers found on this computer, or on the
+// print server of Server.
 func (ws *WinSpool) GetPrinters() ([]lib.Printer, error) {
-	pi2s, err := EnumPrinters2()
+	if err := ws.Faults.Inject("GetPrinters", ""); err != nil {
+		return nil, err
+	}
+	pi2s, err := ws.enumPrinters()
 	if err != nil {
 		return nil, err
 	}
 
-	printers := make([]lib.Printer, 0, len(pi2s))
-	for _, pi2 := range pi2s {
-		printerName := pi2.GetPrinterName()
-		portName := pi2.GetPortName()
-		devMode := pi2.GetDevMode()
+	// Devices queried over SNMP or their back channel may not answer until
+	// a timeout, so printers are converted several at once, rather than
+	// each waiting for the unreachable ones before it.
+	printers := make([]lib.Printer, len(pi2s))
+	errs := make([]error, len(pi2s))
+	names := make([]string, len(pi2s))
+	indexes := make(map[string]int, len(pi2s))
+	for i := range pi2s {
+		names[i] = pi2s[i].GetPrinterName()
+		indexes[names[i]] = i
+	}
+	lib.RunBulk(names, lib.DefaultBulkWorkers, func(printerName string) error {
+		i := indexes[printerName]
+		printers[i], errs[i] = ws.convertPrinter(&pi2s[i])
+		return errs[i]
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if ws.virtual != nil {
+		virtual, err := ws.virtual.GetPrinters()
+		if err != nil {
+			return nil, err
+		}
+		for i := range virtual {
+			virtual[i].Description = ws.capabilityOverrides[virtual[i].Name].Apply(virtual[i].Description)
+		}
+		printers = append(printers, virtual...)
+	}
+
+	return printers, nil
+}
 
-		manufacturer, model1 := getManModel(pi2.GetDriverName())
-		printer := lib.Printer{
-			Name:               printerName,
-			DefaultDisplayName: printerName,
-			Manufacturer:       manufacturer,
-			Model:              model1,
-			State:              convertPrinterState(pi2.GetStatus(), pi2.GetAttributes()),
-			Description:        &model.PrinterDescriptionSection{},
-			Tags: map[string]string{
-				"printer-location": pi2.GetLocation(),
-			},
+// GetDefaultPrinter returns the name of the default printer of the current
+// user.
+func (ws *WinSpool) GetDefaultPrinter() (string, error) {
+	name, err := GetDefaultPrinter()
+	if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+		return "", lib.ErrNoDefaultPrinter
+	}
+	return name, err
+}
+
+// SetDefaultPrinter makes a printer the default of the current user.
+func (ws *WinSpool) SetDefaultPrinter(printerName string) error {
+	if err := SetDefaultPrinter(printerName); err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+		}
+		return fmt.Errorf("failed to set default printer %s: %w", printerName, err)
+	}
+	return nil
+}
+
+// GetPrinter gets a single printer by name, with the same state and
+// capabilities as GetPrinters.
+func (ws *WinSpool) GetPrinter(printerName string) (*lib.Printer, error) {
+	if err := ws.Faults.Inject("GetPrinter", printerName); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.getVirtualPrinter(printerName)
+	}
+	hPrinter, err := ws.openPrinter(printerName)
+	if err != nil {
+		return nil, err
+	}
+	defer hPrinter.ClosePrinter()
+
+	pi2, err := hPrinter.GetPrinter2()
+	if err != nil {
+		return nil, err
+	}
+	printer, err := ws.convertPrinter(pi2)
+	if err != nil {
+		return nil, err
+	}
+	return &printer, nil
+}
+
+// printerEnumFlags returns what EnumPrinters2 lists printers with: those of
+// Server by name, or the local ones, with the printer connections of the
+// user when PrinterConnections is set.
+func (ws *WinSpool) printerEnumFlags() (uint32, string) {
+	if ws.Server != "" {
+		return PRINTER_ENUM_NAME, ws.Server
+	}
+	if ws.PrinterConnections {
+		return PRINTER_ENUM_LOCAL | PRINTER_ENUM_CONNECTIONS, ""
+	}
+	return PRINTER_ENUM_LOCAL, ""
+}
+
+// PrinterPath names a printer as on Server, such as \\PRINTSRV01\Office for
+// Office; names of virtual printers and of other servers are kept.
+func (ws *WinSpool) PrinterPath(printerName string) string {
+	if ws.isVirtual(printerName) {
+		return printerName
+	}
+	return lib.PrinterPath(ws.Server, printerName)
+}
+
+// SetCapabilityCacheTTL sets how long the capabilities of printers are
+// reused; zero queries drivers on every listing.
+func (ws *WinSpool) SetCapabilityCacheTTL(ttl time.Duration) {
+	ws.capabilities.SetTTL(ttl)
+}
+
+// SetPrinterHandleIdleTimeout sets how long printer handles are kept open
+// unused between job calls; zero closes them after each call.
+func (ws *WinSpool) SetPrinterHandleIdleTimeout(timeout time.Duration) {
+	ws.handles.SetIdleTimeout(timeout)
+}
+
+// capabilityCacheKey returns what the capabilities of a printer are computed
+// from: its port, driver and default DEVMODE.
+func capabilityCacheKey(pi2 *PrinterInfo2) string {
+	devMode := pi2.GetDevMode()
+	sum := sha256.Sum256(devMode.Bytes())
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%x", pi2.GetPortName(), pi2.GetDriverName(), devMode.GetDriverVersion(), sum)
+}
+
+func (ws *WinSpool) convertPrinter(pi2 *PrinterInfo2) (lib.Printer, error) {
+	printerName := pi2.GetPrinterName()
+
+	key := capabilityCacheKey(pi2)
+	capabilities, ok := ws.capabilities.Get(printerName, key)
+	if !ok {
+		var err error
+		if capabilities, err = ws.getCapabilities(pi2); err != nil {
+			return lib.Printer{}, err
+		}
+		ws.capabilities.Put(printerName, key, capabilities)
+	}
+
+	manufacturer, model1 := getManModel(pi2.GetDriverName())
+	printer := lib.Printer{
+		Name:               printerName,
+		DefaultDisplayName: printerName,
+		Manufacturer:       manufacturer,
+		Model:              model1,
+		SerialNumber:       capabilities.SerialNumber,
+		DeviceUUID:         capabilities.DeviceUUID,
+		State:              convertPrinterState(pi2.GetStatus(), pi2.GetAttributes()),
+		Offline:            pi2.GetStatus()&PRINTER_STATUS_OFFLINE != 0 || pi2.GetAttributes()&PRINTER_ATTRIBUTE_WORK_OFFLINE != 0,
+		Description:        ws.capabilityOverrides[printerName].Apply(capabilities.Description),
+		Tags: map[string]string{
+			"printer-location": pi2.GetLocation(),
+		},
+	}
+
+	// The status query is a RAW job, which would wait behind queued jobs.
+	if ws.escposStatus[printerName] && pi2.GetJobCount() == 0 {
+		if status, err := getESCPOSStatus(printerName); err != nil {
+			log.Printf("Failed to get ESC/POS status of printer %s: %s", printerName, err)
+		} else {
+			status.ApplyTo(printer.State)
 		}
+	}
+
+	if language, ok := ws.labelLanguages[printerName]; ok {
+		vendorCapabilities := language.VendorCapabilities()
+		printer.Description.VendorCapability = &vendorCapabilities
+	}
+
+	return printer, nil
+}
 
-		// Advertise color based on default value, which should be a solid indicator
-		// of color-ness, because the source of this devMode object is EnumPrinters.
-		if def, ok := devMode.GetColor(); ok {
-			if def == DMCOLOR_COLOR {
-				printer.Description.Color = &model.Color{
-					Option: []model.ColorOption{
-						model.ColorOption{
-							VendorID:                   strconv.FormatInt(int64(DMCOLOR_COLOR), 10),
-							Type:                       model.ColorTypeStandardColor,
-							IsDefault:                  true,
-							CustomDisplayNameLocalized: model.NewLocalizedString("Color"),
-						},
-						model.ColorOption{
-							VendorID:                   strconv.FormatInt(int64(DMCOLOR_MONOCHROME), 10),
-							Type:                       model.ColorTypeStandardMonochrome,
-							IsDefault:                  false,
-							CustomDisplayNameLocalized: model.NewLocalizedString("Monochrome"),
-						},
+// getCapabilities queries the driver and the device of a printer for what
+// GetPrinters caches.
+func (ws *WinSpool) getCapabilities(pi2 *PrinterInfo2) (lib.CachedCapabilities, error) {
+	printerName := pi2.GetPrinterName()
+	portName := pi2.GetPortName()
+	devMode := pi2.GetDevMode()
+
+	serialNumber, deviceUUID := ws.getDeviceIdentity(printerName, portName)
+	capabilities := lib.CachedCapabilities{
+		Description:  &model.PrinterDescriptionSection{},
+		SerialNumber: serialNumber,
+		DeviceUUID:   deviceUUID,
+		SpeaksPDF:    lib.SpeaksPDF(portName, getPersonalities(printerName, portName)),
+	}
+
+	// Advertise color based on default value, which should be a solid indicator
+	// of color-ness, because the source of this devMode object is EnumPrinters.
+	if def, ok := devMode.GetColor(); ok {
+		if def == DMCOLOR_COLOR {
+			capabilities.Description.Color = &model.Color{
+				Option: []model.ColorOption{
+					model.ColorOption{
+						VendorID:                   strconv.FormatInt(int64(DMCOLOR_COLOR), 10),
+						Type:                       model.ColorTypeStandardColor,
+						IsDefault:                  true,
+						CustomDisplayNameLocalized: model.NewLocalizedString("Color"),
 					},
-				}
-			} else if def == DMCOLOR_MONOCHROME {
-				printer.Description.Color = &model.Color{
-					Option: []model.ColorOption{
-						model.ColorOption{
-							VendorID:                   strconv.FormatInt(int64(DMCOLOR_MONOCHROME), 10),
-							Type:                       model.ColorTypeStandardMonochrome,
-							IsDefault:                  true,
-							CustomDisplayNameLocalized: model.NewLocalizedString("Monochrome"),
-						},
+					model.ColorOption{
+						VendorID:                   strconv.FormatInt(int64(DMCOLOR_MONOCHROME), 10),
+						Type:                       model.ColorTypeStandardMonochrome,
+						IsDefault:                  false,
+						CustomDisplayNameLocalized: model.NewLocalizedString("Monochrome"),
 					},
-				}
+				},
+			}
+		} else if def == DMCOLOR_MONOCHROME {
+			capabilities.Description.Color = &model.Color{
+				Option: []model.ColorOption{
+					model.ColorOption{
+						VendorID:                   strconv.FormatInt(int64(DMCOLOR_MONOCHROME), 10),
+						Type:                       model.ColorTypeStandardMonochrome,
+						IsDefault:                  true,
+						CustomDisplayNameLocalized: model.NewLocalizedString("Monochrome"),
+					},
+				},
 			}
 		}
+	}
 
-		if def, ok := devMode.GetDuplex(); ok {
-			duplex, err := DeviceCapabilitiesInt32(printerName, portName, DC_DUPLEX)
-			if err != nil {
-				return nil, err
-			}
-			if duplex == 1 {
-				printer.Description.Duplex = &model.Duplex{
-					Option: []model.DuplexOption{
-						model.DuplexOption{
-							Type:      model.DuplexNoDuplex,
-							IsDefault: def == DMDUP_SIMPLEX,
-						},
-						model.DuplexOption{
-							Type:      model.DuplexLongEdge,
-							IsDefault: def == DMDUP_VERTICAL,
-						},
-						model.DuplexOption{
-							Type:      model.DuplexShortEdge,
-							IsDefault: def == DMDUP_HORIZONTAL,
-						},
+	if def, ok := devMode.GetDuplex(); ok {
+		duplex, err := DeviceCapabilitiesInt32(printerName, portName, DC_DUPLEX)
+		if err != nil {
+			return lib.CachedCapabilities{}, err
+		}
+		if duplex == 1 {
+			capabilities.Description.Duplex = &model.Duplex{
+				Option: []model.DuplexOption{
+					model.DuplexOption{
+						Type:      model.DuplexNoDuplex,
+						IsDefault: def == DMDUP_SIMPLEX,
 					},
-				}
+					model.DuplexOption{
+						Type:      model.DuplexLongEdge,
+						IsDefault: def == DMDUP_VERTICAL,
+					},
+					model.DuplexOption{
+						Type:      model.DuplexShortEdge,
+						IsDefault: def == DMDUP_HORIZONTAL,
+					},
+				},
 			}
 		}
+	}
 
-		if def, ok := devMode.GetOrientation(); ok {
-			orientation, err := DeviceCapabilitiesInt32(printerName, portName, DC_ORIENTATION)
-			if err != nil {
-				return nil, err
-			}
-			if orientation == 90 || orientation == 270 {
-				printer.Description.PageOrientation = &model.PageOrientation{
-					Option: []model.PageOrientationOption{
-						model.PageOrientationOption{
-							Type:      model.PageOrientationPortrait,
-							IsDefault: def == DMORIENT_PORTRAIT,
-						},
-						model.PageOrientationOption{
-							Type:      model.PageOrientationLandscape,
-							IsDefault: def == DMORIENT_LANDSCAPE,
-						},
+	if def, ok := devMode.GetOrientation(); ok {
+		orientation, err := DeviceCapabilitiesInt32(printerName, portName, DC_ORIENTATION)
+		if err != nil {
+			return lib.CachedCapabilities{}, err
+		}
+		if orientation == 90 || orientation == 270 {
+			capabilities.Description.PageOrientation = &model.PageOrientation{
+				Option: []model.PageOrientationOption{
+					model.PageOrientationOption{
+						Type:      model.PageOrientationPortrait,
+						IsDefault: def == DMORIENT_PORTRAIT,
 					},
-				}
+					model.PageOrientationOption{
+						Type:      model.PageOrientationLandscape,
+						IsDefault: def == DMORIENT_LANDSCAPE,
+					},
+				},
 			}
 		}
+	}
 
-		if def, ok := devMode.GetCopies(); ok {
-			copies, err := DeviceCapabilitiesInt32(printerName, portName, DC_COPIES)
-			if err != nil {
-				return nil, err
-			}
-			if copies > 1 {
-				printer.Description.Copies = &model.Copies{
-					Default: int32(def),
-					Max:     copies,
-				}
+	if def, ok := devMode.GetCopies(); ok {
+		copies, err := DeviceCapabilitiesInt32(printerName, portName, DC_COPIES)
+		if err != nil {
+			return lib.CachedCapabilities{}, err
+		}
+		if copies > 1 {
+			capabilities.Description.Copies = &model.Copies{
+				Default: int32(def),
+				Max:     copies,
 			}
 		}
+	}
+
+	mediaSize, err := convertMediaSize(printerName, portName, devMode)
+	if err != nil {
+		return lib.CachedCapabilities{}, err
+	}
+	// Drivers leave out the forms users added, such as odd label stock.
+	if forms, err := ws.printerForms(printerName); err != nil {
+		log.Printf("Failed to list forms of printer %s: %s", printerName, err)
+	} else {
+		mediaSize = lib.AddFormMediaSizes(mediaSize, forms)
+	}
+	capabilities.Description.MediaSize = mediaSize
+
+	mediaSource, err := convertMediaSource(printerName, portName, devMode)
+	if err != nil {
+		return lib.CachedCapabilities{}, err
+	}
+	capabilities.Description.MediaSource = mediaSource
 
-		printer.Description.MediaSize, err = convertMediaSize(printerName, portName, devMode)
+	if def, ok := devMode.GetCollate(); ok {
+		collate, err := DeviceCapabilitiesInt32(printerName, portName, DC_COLLATE)
 		if err != nil {
-			return nil, err
+			return lib.CachedCapabilities{}, err
 		}
-
-		if def, ok := devMode.GetCollate(); ok {
-			collate, err := DeviceCapabilitiesInt32(printerName, portName, DC_COLLATE)
-			if err != nil {
-				return nil, err
-			}
-			if collate == 1 {
-				printer.Description.Collate = &model.Collate{
-					Default: def == DMCOLLATE_TRUE,
-				}
+		if collate == 1 {
+			capabilities.Description.Collate = &model.Collate{
+				Default: def == DMCOLLATE_TRUE,
 			}
 		}
-
-		printers = append(printers, printer)
 	}
 
-	return printers, nil
+	return capabilities, nil
 }
 
 func convertMediaSize(printerName, portName string, devMode *DevMode) (*model.MediaSize, error) {
@@ -465,49 +920,64 @@ func convertMediaSize(printerName, portName string, devMode *DevMode) (*model.Me
 	return &ms, nil
 }
 
-func convertJobState(wsStatus uint32) *model.JobState {
-	var state model.JobState
-
-	if wsStatus&(JOB_STATUS_SPOOLING|JOB_STATUS_PRINTING) != 0 {
-		state.Type = model.JobStateInProgress
-
-	} else if wsStatus&(JOB_STATUS_PRINTED|JOB_STATUS_COMPLETE) != 0 {
-		state.Type = model.JobStateDone
+func convertMediaSource(printerName, portName string, devMode *DevMode) (*model.MediaSource, error) {
+	defSource, defSourceOK := devMode.GetDefaultSource()
 
-	} else if wsStatus&JOB_STATUS_PAUSED != 0 || wsStatus == 0 {
-		state.Type = model.JobStateDone
+	// Bin names are at most 24 characters.
+	names, err := DeviceCapabilitiesStrings(printerName, portName, DC_BINNAMES, 24*2)
+	if err != nil {
+		return nil, err
+	}
+	bins, err := DeviceCapabilitiesUint16Array(printerName, portName, DC_BINS)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) != len(bins) || len(bins) == 0 {
+		return nil, nil
+	}
 
-	} else if wsStatus&JOB_STATUS_ERROR != 0 {
-		state.Type = model.JobStateAborted
-		state.DeviceActionCause = &model.DeviceActionCause{model.DeviceActionCausePrintFailure}
+	ms := model.MediaSource{
+		Option: make([]model.MediaSourceOption, 0, len(bins)),
+	}
 
-	} else if wsStatus&(JOB_STATUS_DELETING|JOB_STATUS_DELETED) != 0 {
-		state.Type = model.JobStateAborted
-		state.UserActionCause = &model.UserActionCause{model.UserActionCauseCanceled}
+	var foundDef bool
+	for i := range bins {
+		bin := int16(bins[i])
+		def := !foundDef && defSourceOK && bin == defSource
+		foundDef = foundDef || def
 
-	} else if wsStatus&(JOB_STATUS_OFFLINE|JOB_STATUS_PAPEROUT|JOB_STATUS_BLOCKED_DEVQ|JOB_STATUS_USER_INTERVENTION) != 0 {
-		state.Type = model.JobStateStopped
-		state.DeviceStateCause = &model.DeviceStateCause{model.DeviceStateCauseOther}
+		ms.Option = append(ms.Option, model.MediaSourceOption{
+			Type:                       lib.MediaSourceTypeOfBin(bin),
+			IsDefault:                  def,
+			VendorID:                   strconv.Itoa(int(bin)),
+			CustomDisplayNameLocalized: model.NewLocalizedString(names[i]),
+		})
+	}
 
-	} else {
-		// Don't know what is going on. Get the job out of our queue.
-		state.Type = model.JobStateAborted
-		state.DeviceActionCause = &model.DeviceActionCause{model.DeviceActionCauseOther}
+	if !foundDef {
+		ms.Option[0].IsDefault = true
 	}
 
-	return &state
+	return &ms, nil
 }
 
 // GetJobState gets the current state of the job indicated by jobID.
 func (ws *WinSpool) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
-	hPrinter, err := OpenPrinter(printerName)
+	if err := ws.Faults.Inject("GetJobState", printerName); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.GetJobState(printerName, jobID)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
 	if err != nil {
 		return nil, err
 	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
 
-	ji1, err := hPrinter.GetJob(int32(jobID))
+	ji2, err := ws.getJob2(&hPrinter, printerName, int32(jobID))
 	if err != nil {
-		if err == ERROR_INVALID_PARAMETER {
+		if errors.Is(err, ERROR_INVALID_PARAMETER) {
 			jobState := model.PrintJobStateDiff{
 				State: &model.JobState{
 					Type:              model.JobStateAborted,
@@ -519,64 +989,156 @@ func (ws *WinSpool) GetJobState(printerName string, jobID uint32) (*model.PrintJ
 		return nil, err
 	}
 
+	pagesPrinted := int32(ji2.GetPagesPrinted())
+	totalPages := int32(ji2.GetTotalPages())
+	spooledBytes := int64(ji2.GetSize())
 	jobState := model.PrintJobStateDiff{
-		State: convertJobState(ji1.GetStatus()),
+		State:        lib.ConvertJobStatus(ji2.GetStatus()),
+		PagesPrinted: &pagesPrinted,
+		TotalPages:   &totalPages,
+		SpooledBytes: &spooledBytes,
 	}
 	return &jobState, nil
 }
 
+// GetJobInfo gets who submitted a job, and what, from JOB_INFO_2.
+func (ws *WinSpool) GetJobInfo(printerName string, jobID uint32) (*lib.JobInfo, error) {
+	if err := ws.Faults.Inject("GetJobInfo", printerName); err != nil {
+		return nil, err
+	}
+	info, err := ws.spooledJobInfo(printerName, jobID)
+	if err != nil {
+		return nil, err
+	}
+	// The spooler knows jobs by the user of the process that submitted them.
+	if user, ok := ws.jobUsers.Get(printerName, jobID); ok {
+		info.User = user
+	}
+	return info, nil
+}
+
+// spooledJobInfo is GetJobInfo as the spooler knows the job.
+func (ws *WinSpool) spooledJobInfo(printerName string, jobID uint32) (*lib.JobInfo, error) {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.GetJobInfo(printerName, jobID)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	ji2, err := ws.getJob2(&hPrinter, printerName, int32(jobID))
+	if err != nil {
+		return nil, err
+	}
+	info := lib.JobInfo{
+		Printer:      printerName,
+		JobID:        jobID,
+		User:         ji2.GetUserName(),
+		Machine:      ji2.GetMachineName(),
+		Document:     ji2.GetDocument(),
+		Submitted:    ji2.GetSubmitted(),
+		TotalPages:   int(ji2.GetTotalPages()),
+		PagesPrinted: int(ji2.GetPagesPrinted()),
+	}
+	if devMode := ji2.GetDevMode(); devMode != nil {
+		color, ok := devMode.GetColor()
+		info.Color = ok && color == lib.DevModeColorColor
+	}
+	return &info, nil
+}
+
 type jobContext struct {
 	jobID    int32
-	pDoc     PopplerDocument
+	pDoc     PDFDocument
 	hPrinter HANDLE
 	devMode  *DevMode
 	hDC      HDC
 	cSurface CairoSurface
 	cContext CairoContext
+
+	// Set instead of pDoc for PWG Raster, URF and image documents.
+	raster       lib.PageDecoder
+	rasterFile   *os.File
+	rasterLimits lib.RenderLimits
+
+	pageTimeout time.Duration
+	// Closed when a page render that timed out returns.
+	rendering chan struct{}
+	// Run once rendering is closed.
+	released []func()
+
+	// Set for soft proofs, which have no job: sides are drawn on images of
+	// the paper instead of the DC, see startProofPage.
+	proof *proofTarget
+
+	// Set while the Cairo state saved by startPage is to be restored by
+	// endPage.
+	pageSaved bool
 }
 
-func newJobContext(printerName, fileName, title string) (*jobContext, error) {
-	pDoc, err := PopplerDocumentNewFromFile(fileName)
+// newJobContext opens the document, and starts a job on the printer, or
+// only creates the DC of the printer for a soft proof.
+func newJobContext(printerName, fileName, title, output string, renderer PDFRenderer, limits lib.RenderLimits, hold *jobHold, proof *proofTarget) (*jobContext, error) {
+	var c jobContext
+	pageTimeout, err := limits.GetPageTimeout()
 	if err != nil {
 		return nil, err
 	}
+	c.pageTimeout = pageTimeout
+	if err := c.openDocument(fileName, renderer, limits); err != nil {
+		return nil, err
+	}
 	hPrinter, err := OpenPrinter(printerName)
 	if err != nil {
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
 	devMode, err := hPrinter.DocumentPropertiesGet(printerName)
 	if err != nil {
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
 	err = hPrinter.DocumentPropertiesSet(printerName, devMode)
 	if err != nil {
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
 	hDC, err := CreateDC(printerName, devMode)
 	if err != nil {
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
-	jobID, err := hDC.StartDoc(title)
+	if proof != nil {
+		c.hPrinter, c.devMode, c.hDC, c.proof = hPrinter, devMode, hDC, proof
+		return &c, nil
+	}
+	jobID, err := hDC.StartDoc(title, output)
 	if err != nil {
 		hDC.DeleteDC()
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
 	hPrinter.SetJobUserName(jobID)
+	if err = hold.apply(hPrinter, jobID); err != nil {
+		hPrinter.SetJobCommand(jobID, JOB_CONTROL_DELETE)
+		hDC.EndDoc()
+		hDC.DeleteDC()
+		hPrinter.ClosePrinter()
+		c.closeDocument()
+		return nil, err
+	}
 	cSurface, err := CairoWin32PrintingSurfaceCreate(hDC)
 	if err != nil {
 		hDC.EndDoc()
 		hDC.DeleteDC()
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
 	cContext, err := CairoCreateContext(cSurface)
@@ -585,261 +1147,880 @@ func newJobContext(printerName, fileName, title string) (*jobContext, error) {
 		hDC.EndDoc()
 		hDC.DeleteDC()
 		hPrinter.ClosePrinter()
-		pDoc.Unref()
+		c.closeDocument()
 		return nil, err
 	}
-	c := jobContext{jobID, pDoc, hPrinter, devMode, hDC, cSurface, cContext}
+	c.jobID, c.hPrinter, c.devMode, c.hDC, c.cSurface, c.cContext = jobID, hPrinter, devMode, hDC, cSurface, cContext
 	return &c, nil
 }
 
-func (c *jobContext) free() error {
-	var err error
-	err = c.cContext.Destroy()
+// openDocument opens raster documents and images with their decoders, and
+// everything else with Poppler.
+func (c *jobContext) openDocument(fileName string, renderer PDFRenderer, limits lib.RenderLimits) error {
+	f, err := os.Open(fileName)
 	if err != nil {
 		return err
 	}
-	err = c.cSurface.Destroy()
-	if err != nil {
-		return err
+	magic := make([]byte, 8)
+	n, _ := io.ReadFull(f, magic)
+	if !lib.IsRaster(magic[:n]) && !lib.IsImage(magic[:n]) {
+		f.Close()
+		if c.pDoc, err = renderer.Open(fileName, limits); err != nil {
+			if scan, scanErr := lib.ScanPDF(fileName); scanErr == nil {
+				return scan.OpenError(err)
+			}
+			return err
+		}
+		if err = c.checkPages(limits); err != nil {
+			c.closeDocument()
+			return err
+		}
+		return nil
 	}
-	err = c.hDC.EndDoc()
-	if err != nil {
+
+	c.rasterFile, c.rasterLimits = f, limits
+	if err = c.rewindRaster(); err != nil {
+		c.closeDocument()
 		return err
 	}
-	err = c.hDC.DeleteDC()
-	if err != nil {
+	return nil
+}
+
+// checkPages fails for PDFs without pages, with more pages than the limits,
+// or with pages of impossible sizes, before any is rendered.
+func (c *jobContext) checkPages(limits lib.RenderLimits) error {
+	pages := c.pDoc.GetNPages()
+	if err := lib.CheckPreflightPages(pages); err != nil {
 		return err
 	}
-	err = c.hPrinter.ClosePrinter()
-	if err != nil {
+	if err := limits.CheckPages(pages); err != nil {
 		return err
 	}
-	c.pDoc.Unref()
+	for i := 0; i < pages; i++ {
+		page := c.pDoc.GetPage(i)
+		wPoints, hPoints, err := page.GetSize()
+		page.Unref()
+		if err != nil {
+			return err
+		}
+		if err = lib.CheckPreflightPageSize(i+1, wPoints, hPoints); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func getScaleAndOffset(wDocPoints, hDocPoints float64, wPaperPixels, hPaperPixels, xMarginPixels, yMarginPixels, wPrintablePixels, hPrintablePixels, xDPI, yDPI int32, fitToPage bool) (scale, xOffsetPoints, yOffsetPoints float64) {
-
-	wPaperPoints, hPaperPoints := float64(wPaperPixels*72)/float64(xDPI), float64(hPaperPixels*72)/float64(yDPI)
-
-	var wPrintablePoints, hPrintablePoints float64
-	if fitToPage {
-		wPrintablePoints, hPrintablePoints = float64(wPrintablePixels*72)/float64(xDPI), float64(hPrintablePixels*72)/float64(yDPI)
-	} else {
-		wPrintablePoints, hPrintablePoints = wPaperPoints, hPaperPoints
+// rewindRaster starts decoding from the first page, again for software
+// copies.
+func (c *jobContext) rewindRaster() error {
+	if _, err := c.rasterFile.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
-
-	xScale, yScale := wPrintablePoints/wDocPoints, hPrintablePoints/hDocPoints
-	if xScale < yScale {
-		scale = xScale
-	} else {
-		scale = yScale
+	magic := make([]byte, 8)
+	n, _ := io.ReadFull(c.rasterFile, magic)
+	if _, err := c.rasterFile.Seek(0, io.SeekStart); err != nil {
+		return err
 	}
 
-	xOffsetPoints = (wPaperPoints - wDocPoints*scale) / 2
-	yOffsetPoints = (hPaperPoints - hDocPoints*scale) / 2
-
-	return
+	if lib.IsImage(magic[:n]) {
+		decoder, err := lib.NewImageDecoder(c.rasterFile)
+		if err != nil {
+			return err
+		}
+		decoder.Limits = c.rasterLimits
+		c.raster = decoder
+		return nil
+	}
+	raster, err := lib.NewRasterDecoder(c.rasterFile)
+	if err != nil {
+		return err
+	}
+	raster.Limits = c.rasterLimits
+	c.raster = raster
+	return nil
 }
 
-func printPage(printerName string, i int, c *jobContext, fitToPage bool) error {
-	pPage := c.pDoc.GetPage(i)
-	defer pPage.Unref()
+func (c *jobContext) closeDocument() {
+	if c.rasterFile != nil {
+		c.rasterFile.Close()
+		c.rasterFile, c.raster = nil, nil
+	}
+	if c.pDoc != nil {
+		c.pDoc.Unref()
+		c.pDoc = nil
+	}
+}
 
-	if err := c.hPrinter.DocumentPropertiesSet(printerName, c.devMode); err != nil {
-		return err
+// render draws a page, giving up after the page timeout. Poppler can't be
+// interrupted, so a render that times out keeps running in the background;
+// the job is deleted, and the context is freed once the render returns.
+func (c *jobContext) render(draw func()) error {
+	if c.pageTimeout <= 0 {
+		draw()
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		draw()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(c.pageTimeout):
+		c.rendering = done
+		return fmt.Errorf("page took longer than %s to render", c.pageTimeout)
 	}
+}
 
-	if err := c.hDC.ResetDC(c.devMode); err != nil {
-		return err
+// afterRender runs release now, or after a render that timed out returns.
+func (c *jobContext) afterRender(release func()) {
+	if c.rendering == nil {
+		release()
+		return
 	}
+	c.released = append(c.released, release)
+}
 
-	// Set device to zero offset, and to points scale.
-	xDPI := c.hDC.GetDeviceCaps(LOGPIXELSX)
-	yDPI := c.hDC.GetDeviceCaps(LOGPIXELSY)
-	xMarginPixels := c.hDC.GetDeviceCaps(PHYSICALOFFSETX)
-	yMarginPixels := c.hDC.GetDeviceCaps(PHYSICALOFFSETY)
-	xform := NewXFORM(float32(xDPI)/72, float32(yDPI)/72, float32(-xMarginPixels), float32(-yMarginPixels))
-	if err := c.hDC.SetGraphicsMode(GM_ADVANCED); err != nil {
-		return err
-	}
-	if err := c.hDC.SetWorldTransform(xform); err != nil {
-		return err
+func (c *jobContext) free() error {
+	if c.rendering != nil {
+		if c.proof != nil {
+			// No job to delete.
+		} else if err := c.hPrinter.SetJobCommand(c.jobID, JOB_CONTROL_DELETE); err != nil {
+			log.Printf("Failed to delete job %d after render timeout: %s", c.jobID, err)
+		}
+		rendering, released := c.rendering, c.released
+		c.rendering, c.released = nil, nil
+		go func() {
+			<-rendering
+			for _, release := range released {
+				release()
+			}
+			c.free()
+		}()
+		return nil
 	}
 
-	if err := c.hDC.StartPage(); err != nil {
+	var err error
+	if c.proof != nil {
+		// Page images are freed by endPage.
+		c.proof.close()
+	} else {
+		err = c.cContext.Destroy()
+		if err != nil {
+			return err
+		}
+		err = c.cSurface.Destroy()
+		if err != nil {
+			return err
+		}
+		err = c.hDC.EndDoc()
+		if err != nil {
+			return err
+		}
+	}
+	err = c.hDC.DeleteDC()
+	if err != nil {
 		return err
 	}
-	defer c.hDC.EndPage()
-
-	if err := c.cContext.Save(); err != nil {
+	err = c.hPrinter.ClosePrinter()
+	if err != nil {
 		return err
 	}
+	c.closeDocument()
+	return nil
+}
 
-	wPaperPixels := c.hDC.GetDeviceCaps(PHYSICALWIDTH)
-	hPaperPixels := c.hDC.GetDeviceCaps(PHYSICALHEIGHT)
-	wPrintablePixels := c.hDC.GetDeviceCaps(HORZRES)
-	hPrintablePixels := c.hDC.GetDeviceCaps(VERTRES)
+func getScaleAndOffset(wDocPoints, hDocPoints float64, wPaperPixels, hPaperPixels, xMarginPixels, yMarginPixels, wPrintablePixels, hPrintablePixels, xDPI, yDPI int32, placement lib.PagePlacement) (scale, xOffsetPoints, yOffsetPoints float64, err error) {
+	xPoints := func(pixels int32) float64 { return float64(pixels*72) / float64(xDPI) }
+	yPoints := func(pixels int32) float64 { return float64(pixels*72) / float64(yDPI) }
+
+	printable := lib.NUpCell{X: xPoints(xMarginPixels), Y: yPoints(yMarginPixels), Width: xPoints(wPrintablePixels), Height: yPoints(hPrintablePixels)}
+	return placement.Place(wDocPoints, hDocPoints, xPoints(wPaperPixels), yPoints(hPaperPixels), printable)
+}
+
+func printPage(printerName string, i int, c *jobContext, placement lib.PagePlacement) error {
+	pPage := c.pDoc.GetPage(i)
+	defer c.afterRender(func() { pPage.Unref() })
 
 	wDocPoints, hDocPoints, err := pPage.GetSize()
 	if err != nil {
 		return err
 	}
 
-	scale, xOffsetPoints, yOffsetPoints := getScaleAndOffset(wDocPoints, hDocPoints, wPaperPixels, hPaperPixels, xMarginPixels, yMarginPixels, wPrintablePixels, hPrintablePixels, xDPI, yDPI, fitToPage)
-
-	if err := c.cContext.IdentityMatrix(); err != nil {
+	if err := c.startPage(printerName, wDocPoints, hDocPoints, placement); err != nil {
 		return err
 	}
-	if err := c.cContext.Translate(xOffsetPoints, yOffsetPoints); err != nil {
+	defer c.afterRender(func() { c.endPage() })
+
+	var renderErr error
+	if err := c.render(func() { renderErr = pPage.RenderForPrinting(c.cContext, c.deviceScale()) }); err != nil {
+		// The page and context are still in use; release them when done.
 		return err
 	}
-	if err := c.cContext.Scale(scale, scale); err != nil {
+	if renderErr != nil {
+		return renderErr
+	}
+
+	return c.finishPage()
+}
+
+// startPage starts a page on the DC, and sets up the Cairo context so that a
+// document page of the given size in points can be drawn at the origin.
+func (c *jobContext) startPage(printerName string, wDocPoints, hDocPoints float64, placement lib.PagePlacement) error {
+	if err := c.hPrinter.DocumentPropertiesSet(printerName, c.devMode); err != nil {
 		return err
 	}
 
-	pPage.RenderForPrinting(c.cContext)
+	if err := c.hDC.ResetDC(c.devMode); err != nil {
+		return err
+	}
 
-	if err := c.cContext.Restore(); err != nil {
+	// Set device to zero offset, and to points scale.
+	xDPI := c.hDC.GetDeviceCaps(LOGPIXELSX)
+	yDPI := c.hDC.GetDeviceCaps(LOGPIXELSY)
+	xMarginPixels := c.hDC.GetDeviceCaps(PHYSICALOFFSETX)
+	yMarginPixels := c.hDC.GetDeviceCaps(PHYSICALOFFSETY)
+	xform := NewXFORM(float32(xDPI)/72, float32(yDPI)/72, float32(-xMarginPixels), float32(-yMarginPixels))
+	if err := c.hDC.SetGraphicsMode(GM_ADVANCED); err != nil {
 		return err
 	}
-	if err := c.cSurface.ShowPage(); err != nil {
+	if err := c.hDC.SetWorldTransform(xform); err != nil {
 		return err
 	}
 
+	if c.proof != nil {
+		if err := c.startProofPage(xDPI, yDPI); err != nil {
+			c.endPage()
+			return err
+		}
+	} else if err := c.hDC.StartPage(); err != nil {
+		return err
+	}
+
+	err := func() error {
+		if err := c.cContext.Save(); err != nil {
+			return err
+		}
+		c.pageSaved = true
+
+		wPaperPixels := c.hDC.GetDeviceCaps(PHYSICALWIDTH)
+		hPaperPixels := c.hDC.GetDeviceCaps(PHYSICALHEIGHT)
+		wPrintablePixels := c.hDC.GetDeviceCaps(HORZRES)
+		hPrintablePixels := c.hDC.GetDeviceCaps(VERTRES)
+
+		scale, xOffsetPoints, yOffsetPoints, err := getScaleAndOffset(wDocPoints, hDocPoints, wPaperPixels, hPaperPixels, xMarginPixels, yMarginPixels, wPrintablePixels, hPrintablePixels, xDPI, yDPI, placement)
+		if err != nil {
+			return err
+		}
+
+		if err := c.cContext.IdentityMatrix(); err != nil {
+			return err
+		}
+		if err := c.cContext.Translate(xOffsetPoints, yOffsetPoints); err != nil {
+			return err
+		}
+		return c.cContext.Scale(scale, scale)
+	}()
+	if err != nil {
+		c.endPage()
+		return err
+	}
 	return nil
 }
 
-var (
-	colorValueByType = map[model.ColorType]int16{
-		model.ColorTypeStandardColor:      DMCOLOR_COLOR,
-		model.ColorTypeStandardMonochrome: DMCOLOR_MONOCHROME,
-		// Ignore the rest, since we don't advertise them.
+// finishPage emits what was drawn since startPage. The caller ends the DC
+// page with endPage.
+func (c *jobContext) finishPage() error {
+	if c.proof != nil {
+		return c.proof.writePage(c.cSurface)
 	}
+	return c.cSurface.ShowPage()
+}
 
-	duplexValueByType = map[model.DuplexType]int16{
-		model.DuplexNoDuplex:  DMDUP_SIMPLEX,
-		model.DuplexLongEdge:  DMDUP_VERTICAL,
-		model.DuplexShortEdge: DMDUP_HORIZONTAL,
+// endPage restores the Cairo state saved by startPage, whether the page
+// was finished or failed, so that it doesn't leak into the next page. It
+// then ends the DC page, or frees the image of a soft proof side.
+func (c *jobContext) endPage() {
+	if c.pageSaved {
+		c.cContext.Restore()
+		c.pageSaved = false
+	}
+	if c.proof == nil {
+		c.hDC.EndPage()
+		return
+	}
+	if c.cSurface != 0 {
+		c.cContext.Destroy()
+		c.cSurface.Destroy()
 	}
+}
+
+// Print sends a new print job to the specified printer. The job ID, page
+// counts, timings and warnings are returned.
+func (ws *WinSpool) Print(printer *lib.Printer, fileName, title string, ticket *model.JobTicket) (*lib.PrintResult, error) {
+	return ws.printDeduplicated(printer, fileName, title, "", ticket, nil)
+}
 
-	pageOrientationByType = map[model.PageOrientationType]int16{
-		model.PageOrientationPortrait:  DMORIENT_PORTRAIT,
-		model.PageOrientationLandscape: DMORIENT_LANDSCAPE,
-		// Ignore model.PageOrientationAuto for ticket parsing, in order to interpret "auto".
+// PrintWithProgress prints like Print, and calls progress after each page
+// is rendered, with the pages rendered and bytes spooled so far.
+func (ws *WinSpool) PrintWithProgress(printer *lib.Printer, fileName, title string, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
+	return ws.printDeduplicated(printer, fileName, title, "", ticket, progress)
+}
+
+// PrintToFile prints like Print, to outputFile instead of the port of the
+// printer: what the driver makes of the document, such as PDF with
+// Microsoft Print to PDF, XPS with the XPS document writers, or the printer
+// language of a printer on a FILE: port, without a dialog asking for a file
+// name. Label settings and job trailers are not sent, since they are jobs
+// of their own.
+func (ws *WinSpool) PrintToFile(printer *lib.Printer, fileName, title string, ticket *model.JobTicket, outputFile string) (*lib.PrintResult, error) {
+	if outputFile == "" {
+		return nil, errors.New("PrintToFile() called with empty output file")
+	}
+	// The spooler opens the file, in a working directory of its own.
+	outputFile, err := filepath.Abs(outputFile)
+	if err != nil {
+		return nil, err
 	}
-)
+	return ws.printDeduplicated(printer, fileName, title, outputFile, ticket, nil)
+}
 
-// Print sends a new print job to the specified printer. The job ID
-// is returned.
-func (ws *WinSpool) Print(printer *lib.Printer, fileName, title string, ticket *model.JobTicket) (uint32, error) {
-	printer.NativeJobSemaphore.Acquire()
-	defer printer.NativeJobSemaphore.Release()
+// printDeduplicated prints with printWithControlJobs, unless the printer
+// has a duplicate_window and the same document and ticket were submitted
+// to it within the window: then the job is refused, or printed with a
+// warning. Failed jobs can be submitted again right away.
+func (ws *WinSpool) printDeduplicated(printer *lib.Printer, fileName, title, output string, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
+	if printer == nil || ticket == nil {
+		return ws.printWithControlJobs(printer, fileName, title, output, ticket, progress)
+	}
+	detector, ok := ws.duplicateDetectors[printer.Name]
+	if !ok {
+		return ws.printWithControlJobs(printer, fileName, title, output, ticket, progress)
+	}
+	key, err := lib.DuplicateJobKey(fileName, ticket)
+	if err != nil {
+		return nil, err
+	}
+	warning, err := detector.Submit(key)
+	if err != nil {
+		return nil, err
+	}
+	result, err := ws.printWithControlJobs(printer, fileName, title, output, ticket, progress)
+	if err != nil {
+		if warning == "" {
+			detector.Forget(key)
+		}
+		return result, err
+	}
+	if warning != "" {
+		log.Printf("Job %d on %s: %s", result.JobID, printer.Name, warning)
+		result.Warn("document", lib.PrintWarningDuplicate, "%s", warning)
+	}
+	return result, nil
+}
 
+// printWithControlJobs prints the document, preceded by the label settings
+// requested by the ticket and followed by the printer's configured job
+// trailer, unless it is printed to an output file. Those are sent as
+// separate RAW jobs, since the rendered job goes through GDI; see
+// lib.ControlJobs. The result lists the IDs of all jobs sent in queue order.
+func (ws *WinSpool) printWithControlJobs(printer *lib.Printer, fileName, title, output string, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
 	if printer == nil {
-		return 0, errors.New("Print() called with nil printer")
+		return nil, errors.New("Print() called with nil printer")
 	}
 	if ticket == nil {
-		return 0, errors.New("Print() called with nil ticket")
+		return nil, errors.New("Print() called with nil ticket")
+	}
+	if err := ws.Faults.Inject("Print", printer.Name); err != nil {
+		return nil, err
 	}
 
-	jobContext, err := newJobContext(printer.Name, fileName, title)
+	// Without a semaphore, as when the printer wasn't built by a printer
+	// manager, jobs aren't limited.
+	if printer.NativeJobSemaphore != nil {
+		printer.NativeJobSemaphore.Acquire()
+		defer printer.NativeJobSemaphore.Release()
+	}
+	// Presets are read once, before any job of the submission starts.
+	devMode, err := lib.TicketDevMode(printer.Name, ticket, ws.DevModePresets)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	if devMode != nil {
+		ticket = lib.WithDevMode(ticket, devMode)
+	}
+	if ws.isVirtual(printer.Name) {
+		if output != "" {
+			return nil, fmt.Errorf("%s is a virtual printer, which has no output to write to a file", printer.Name)
+		}
+		printer, ticket, err := ws.overrideCapabilities(printer, ticket)
+		if err != nil {
+			return nil, err
+		}
+		if err = ws.checkQuota(printer, fileName, ticket); err != nil {
+			return nil, err
+		}
+		if _, err = ws.newJobHold(printer.Name, ticket, time.Now()); err != nil {
+			return nil, err
+		}
+		result, err := ws.virtual.PrintFile(printer, fileName, title, ticket, progress)
+		if err != nil {
+			return nil, err
+		}
+		ws.noteUser(printer.Name, ticket, result)
+		return result, ws.noteHeld(printer.Name, title, ticket, result)
 	}
-	defer jobContext.free()
 
-	if ticket.Color != nil && printer.Description.Color != nil {
-		if color, ok := colorValueByType[ticket.Color.Type]; ok {
-			jobContext.devMode.SetColor(color)
-		} else if ticket.Color.VendorID != "" {
-			v, err := strconv.ParseInt(ticket.Color.VendorID, 10, 16)
-			if err != nil {
-				return 0, err
+	printer, err = ws.describedPrinter(printer)
+	if err != nil {
+		return nil, err
+	}
+	printer, ticket, err = ws.overrideCapabilities(printer, ticket)
+	if err != nil {
+		return nil, err
+	}
+	if err = ws.checkQuota(printer, fileName, ticket); err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	hold, err := ws.newJobHold(printer.Name, ticket, start)
+	if err != nil {
+		return nil, err
+	}
+
+	controlJobs := lib.ControlJobs{
+		Send: func(data []byte, held bool) (uint32, error) {
+			return writeRawJob(printer.Name, title, "", data, hold.queuing(held))
+		},
+		Resume: func(jobID uint32) error {
+			// Jobs held by the ticket stay held.
+			if hold.paused {
+				return nil
 			}
-			jobContext.devMode.SetColor(int16(v))
+			return setJobCommand(printer.Name, jobID, JOB_CONTROL_RESUME)
+		},
+		Delete: func(jobID uint32) error {
+			return setJobCommand(printer.Name, jobID, JOB_CONTROL_DELETE)
+		},
+	}
+	if language, ok := ws.labelLanguages[printer.Name]; ok && output == "" {
+		if controlJobs.Settings, err = language.SettingsCommands(ticket); err != nil {
+			return nil, err
 		}
 	}
+	if trailer, ok := ws.jobTrailers[printer.Name]; ok && output == "" {
+		controlJobs.Trailer = trailer
+	}
+	result, err := controlJobs.Print(func(held bool) (*lib.PrintResult, error) {
+		return ws.printDocument(printer, fileName, title, output, hold.queuing(held), ticket, progress, nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	ws.noteUser(printer.Name, ticket, result)
+	if err = ws.noteHeld(printer.Name, title, ticket, result); err != nil {
+		return result, err
+	}
 
-	if ticket.Duplex != nil && printer.Description.Duplex != nil {
-		if duplex, ok := duplexValueByType[ticket.Duplex.Type]; ok {
-			jobContext.devMode.SetDuplex(duplex)
-		}
+	for _, warning := range result.Warnings {
+		log.Printf("Job %d on %s: %s", result.JobID, printer.Name, warning)
 	}
+	result.Duration = time.Since(start)
+	return result, nil
+}
 
-	if ticket.PageOrientation != nil && printer.Description.PageOrientation != nil {
-		if pageOrientation, ok := pageOrientationByType[ticket.PageOrientation.Type]; ok {
-			jobContext.devMode.SetOrientation(pageOrientation)
-		}
+// setJobCommand sends a JOB_CONTROL_* command to a job of the user.
+func setJobCommand(printerName string, jobID, command uint32) error {
+	hPrinter, err := OpenPrinter(printerName)
+	if err != nil {
+		return err
 	}
+	defer hPrinter.ClosePrinter()
+
+	return hPrinter.SetJobCommand(int32(jobID), command)
+}
 
-	if ticket.Copies != nil && printer.Description.Copies != nil {
-		if ticket.Copies.Copies > 0 {
-			jobContext.devMode.SetCopies(int16(ticket.Copies.Copies))
+// describedPrinter returns the printer with a description, probed with
+// ProbeCapabilities and else empty, when it has none.
+func (ws *WinSpool) describedPrinter(printer *lib.Printer) (*lib.Printer, error) {
+	if printer.Description != nil {
+		return printer, nil
+	}
+	described := *printer
+	if ws.ProbeCapabilities {
+		probed, err := ws.GetPrinter(printer.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to probe capabilities of printer %s: %w", printer.Name, err)
 		}
+		described.Description = probed.Description
+	} else {
+		described.Description = &model.PrinterDescriptionSection{}
 	}
+	return &described, nil
+}
 
-	var fitToPage bool
-	if ticket.FitToPage != nil && printer.Description.FitToPage != nil {
-		if ticket.FitToPage.Type == model.FitToPageFitToPage {
-			fitToPage = true
+// overrideCapabilities applies the capability overrides of the config to
+// the description of the printer, in case it was built elsewhere, and
+// enforces them on the ticket.
+func (ws *WinSpool) overrideCapabilities(printer *lib.Printer, ticket *model.JobTicket) (*lib.Printer, *model.JobTicket, error) {
+	overrides, ok := ws.capabilityOverrides[printer.Name]
+	if !ok {
+		return printer, ticket, nil
+	}
+	overridden := *printer
+	overridden.Description = overrides.Apply(printer.Description)
+	ticket, err := overrides.EnforceTicket(overridden.Description, ticket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &overridden, ticket, nil
+}
+
+// checkQuota returns a *lib.QuotaError when the job would exceed the quota
+// of the user or printer. Pages are counted as Simulate does, before a job
+// is started; virtual printers and RAW documents count none.
+func (ws *WinSpool) checkQuota(printer *lib.Printer, fileName string, ticket *model.JobTicket) error {
+	if ws.Quotas == nil {
+		return nil
+	}
+	userName := ticketUser(ticket)
+	if !ws.Quotas.Limits(userName, printer.Name) {
+		return nil
+	}
+	var pages int
+	if !ws.isVirtual(printer.Name) {
+		plan, err := ws.Simulate(printer, fileName, ticket)
+		if err != nil {
+			return err
 		}
+		pages = plan.Pages
+	}
+	return ws.Quotas.Check(userName, printer.Name, pages)
+}
+
+// noteUser notes the jobs of a submission for another user, by
+// lib.TicketUser, so that GetJobInfo reports that user.
+func (ws *WinSpool) noteUser(printerName string, ticket *model.JobTicket, result *lib.PrintResult) {
+	user := lib.TicketUser(ticket)
+	if user == "" {
+		return
+	}
+	for _, jobID := range result.JobIDs {
+		ws.jobUsers.Set(printerName, jobID, user)
+	}
+}
+
+// ticketUser returns the user a job is submitted for: lib.TicketUser, else
+// the user of this process, as for local prints.
+func ticketUser(ticket *model.JobTicket) string {
+	if user := lib.TicketUser(ticket); user != "" {
+		return user
+	}
+	return jobUserName()
+}
+
+// jobUserName returns the name jobs of this process are submitted under,
+// without the domain, as in JOB_INFO_2.
+func jobUserName() string {
+	current, err := user.Current()
+	if err != nil {
+		return ""
 	}
+	name := current.Username
+	if i := strings.LastIndex(name, `\`); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
 
-	if ticket.MediaSize != nil && printer.Description.MediaSize != nil {
-		if ticket.MediaSize.VendorID != "" {
-			v, err := strconv.ParseInt(ticket.MediaSize.VendorID, 10, 16)
+// printDocument prints the document as one job, held as hold says, to
+// output when not empty, or writes a soft proof of it when proof is set.
+func (ws *WinSpool) printDocument(printer *lib.Printer, fileName, title, output string, hold *jobHold, ticket *model.JobTicket, progress lib.ProgressFunc, proof *proofTarget) (*lib.PrintResult, error) {
+	marginsLaidOut := laysOutMargins(fileName)
+	fileName, contentType, cleanup, err := ws.prepareDocument(fileName, ticket)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	pdfDirect := contentType == lib.ContentTypePDF && ws.sendsPDFDirect(printer.Name)
+	if proof != nil && (lib.IsRawContentType(contentType) || contentType == lib.ContentTypeText && !ws.rendersText(printer.Name) || pdfDirect) {
+		return nil, fmt.Errorf("%s: %s documents are not rendered for printer %s, so can't be proofed", fileName, contentType, printer.Name)
+	}
+	if lib.IsRawContentType(contentType) || pdfDirect {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		print := func(data []byte) (*lib.PrintResult, error) {
+			jobID, err := writeRawJob(printer.Name, title, output, data, hold)
 			if err != nil {
-				return 0, err
+				return nil, err
 			}
-			jobContext.devMode.SetPaperSize(int16(v))
-			jobContext.devMode.ClearPaperLength()
-			jobContext.devMode.ClearPaperWidth()
+			return &lib.PrintResult{JobID: jobID}, nil
+		}
+		var result *lib.PrintResult
+		// Held labels aren't merged with labels that print now.
+		if coalescer, ok := ws.labelCoalescers[printer.Name]; ok && contentType == lib.ContentTypeZPL && output == "" && (hold == nil || !hold.paused) {
+			result, err = coalescer.Print(data, print)
 		} else {
-			jobContext.devMode.ClearPaperSize()
-			jobContext.devMode.SetPaperLength(int16(ticket.MediaSize.HeightMicrons / 10))
-			jobContext.devMode.SetPaperWidth(int16(ticket.MediaSize.WidthMicrons / 10))
+			result, err = print(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, option := range lib.TicketOptions(ticket) {
+			result.Warn(option, lib.PrintWarningRawDocument, "ignored, %s documents are sent to the printer as-is", contentType)
+		}
+		return result, nil
+	}
+
+	if contentType == lib.ContentTypeText {
+		if layout, ok := ws.escpLayouts[printer.Name]; ok {
+			return printESCPText(printer.Name, fileName, title, output, layout, hold, ticket)
+		}
+		if font, ok := ws.textDeviceFonts[printer.Name]; ok {
+			return printDeviceText(printer, fileName, title, output, font, hold, ticket, progress)
+		}
+		if !renderingAvailable {
+			return nil, fmt.Errorf("%s: plain text documents need a text_device_font or escp for printer %s: %w", fileName, printer.Name, ErrNoRenderer)
+		}
+		source := fileName
+		var textCleanup func()
+		fileName, contentType, textCleanup, err = ws.convertToPDF(func(pdf string) error {
+			return ws.textToPDF(printer.Name, source, title, pdf, ticket)
+		})
+		if err != nil {
+			return nil, err
+		}
+		defer textCleanup()
+		// The text is laid out within the ticket margins.
+		marginsLaidOut = true
+	}
+
+	if !renderingAvailable {
+		return nil, fmt.Errorf("%s: printing %s documents: %w", fileName, contentType, ErrNoRenderer)
+	}
+	if contentType == lib.ContentTypePDF {
+		if err = ws.RenderLimits.CheckPDF(fileName); err != nil {
+			return nil, err
 		}
 	}
 
-	if ticket.Collate != nil && printer.Description.Collate != nil {
-		if ticket.Collate.Collate {
-			jobContext.devMode.SetCollate(DMCOLLATE_TRUE)
+	renderer, err := ws.pdfRenderer(printer.Name)
+	if err != nil {
+		return nil, err
+	}
+	jobContext, err := newJobContext(printer.Name, fileName, title, output, renderer, ws.RenderLimits, hold, proof)
+	if err != nil {
+		return nil, err
+	}
+	defer jobContext.free()
+
+	if err = applyTicketDevMode(jobContext.hPrinter, printer.Name, jobContext.devMode, ticket, ws.DevModePresets); err != nil {
+		return nil, err
+	}
+	var result lib.PrintResult
+	settings, err := lib.ApplyTicket(jobContext.devMode, printer.Description, ticket, &result)
+	if err != nil {
+		return nil, err
+	}
+	if marginsLaidOut {
+		settings.Placement.Margins = nil
+	}
+	placement, softwareCopies := settings.Placement, settings.SoftwareCopies
+	if proof != nil {
+		color, ok := jobContext.devMode.GetColor()
+		proof.gray = ok && color == lib.DevModeColorMonochrome
+	}
+
+	if jobContext.raster != nil {
+		if settings.NUp > 1 {
+			result.Warn("n_up", lib.PrintWarningNotImplemented, "images are printed one page per sheet, ignored")
+			settings.NUp = 1
+		}
+		if settings.Booklet {
+			result.Warn("booklet", lib.PrintWarningNotImplemented, "images are printed one page per sheet, ignored")
+			settings.Booklet = false
+		}
+		for copy := 0; copy < softwareCopies; copy++ {
+			if copy > 0 {
+				if settings.PadsCopies(result.Pages / copy) {
+					if err := printBlankSide(printer.Name, jobContext); err != nil {
+						return nil, err
+					}
+				}
+				if err := jobContext.rewindRaster(); err != nil {
+					return nil, err
+				}
+			}
+			// Raster streams don't tell their page count upfront; pages out
+			// of range are still decoded, to reach the next one.
+			for i := 1; ; i++ {
+				page, err := jobContext.raster.NextPage()
+				if err == io.EOF {
+					if result.Pages == 0 {
+						if err = settings.CheckPageRange(i - 1); err != nil {
+							return nil, err
+						}
+					}
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				if !settings.PrintsPage(i) {
+					continue
+				}
+				pageStart := time.Now()
+				if err = printRasterPage(printer.Name, page, jobContext, placement); err != nil {
+					return nil, err
+				}
+				result.Pages++
+				result.PageDurations = append(result.PageDurations, time.Since(pageStart))
+				jobContext.reportProgress(progress, result.Pages, 0)
+			}
+		}
+	} else {
+		if err = settings.CheckPageRange(jobContext.pDoc.GetNPages()); err != nil {
+			return nil, err
+		}
+		// A blank side between copies, when padded, is BookletBlank in
+		// pages and a nil side in sheets.
+		pads := settings.PadsCopies(settings.PagesPrinted(jobContext.pDoc.GetNPages()))
+		var pages []int
+		// Pages of each sheet side when N-up or a booklet; sides don't mix
+		// copies.
+		var sheets [][]int
+		for copy := 0; copy < softwareCopies; copy++ {
+			if copy > 0 && pads {
+				if settings.Booklet || settings.NUp > 1 {
+					sheets = append(sheets, nil)
+				} else {
+					pages = append(pages, lib.BookletBlank)
+				}
+			}
+			first := len(pages)
+			for i := 0; i < jobContext.pDoc.GetNPages(); i++ {
+				if settings.PrintsPage(i + 1) {
+					pages = append(pages, i)
+				}
+			}
+			if settings.Booklet {
+				sheets = append(sheets, lib.BookletSides(pages[first:])...)
+				continue
+			}
+			for start := first; settings.NUp > 1 && start < len(pages); start += settings.NUp {
+				end := start + settings.NUp
+				if end > len(pages) {
+					end = len(pages)
+				}
+				sheets = append(sheets, pages[start:end])
+			}
+		}
+		total := settings.PagesPrinted(jobContext.pDoc.GetNPages()) * softwareCopies
+		if sheets != nil {
+			// Pages are drawn onto their sheet, rather than rendered ahead.
+			for _, sheet := range sheets {
+				if sheet == nil {
+					if err := printBlankSide(printer.Name, jobContext); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				pageStart := time.Now()
+				if err := printSheet(printer.Name, sheet, jobContext, settings); err != nil {
+					return nil, err
+				}
+				for _, i := range sheet {
+					if i != lib.BookletBlank {
+						result.Pages++
+					}
+				}
+				result.PageDurations = append(result.PageDurations, time.Since(pageStart))
+				jobContext.reportProgress(progress, result.Pages, total)
+			}
+		} else if ws.RenderWorkers > 1 {
+			if err = ws.printPagesParallel(printer.Name, fileName, pages, total, jobContext, placement, &result, progress); err != nil {
+				return nil, err
+			}
 		} else {
-			jobContext.devMode.SetCollate(DMCOLLATE_FALSE)
+			for _, i := range pages {
+				if i == lib.BookletBlank {
+					if err := printBlankSide(printer.Name, jobContext); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				pageStart := time.Now()
+				if err := printPage(printer.Name, i, jobContext, placement); err != nil {
+					return nil, err
+				}
+				result.Pages++
+				result.PageDurations = append(result.PageDurations, time.Since(pageStart))
+				jobContext.reportProgress(progress, result.Pages, total)
+			}
 		}
 	}
 
-	for i := 0; i < jobContext.pDoc.GetNPages(); i++ {
-		if err := printPage(printer.Name, i, jobContext, fitToPage); err != nil {
-			return 0, err
+	// Software copies are already counted in Pages.
+	result.Sheets = settings.Sheets(result.Pages / softwareCopies)
+
+	if proof != nil {
+		if err = proof.finish(); err != nil {
+			return nil, err
 		}
+		result.ProofFiles = proof.files
+		return &result, nil
 	}
 
 	// Retain unpaused jobs to check the status later. Don't retain paused jobs because
 	// release would delete the job even if it was still paused and hadn't been printed
 	ji1, err := jobContext.hPrinter.GetJob(jobContext.jobID)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	if ji1.status&JOB_STATUS_PAUSED == 0 {
 		err = jobContext.hPrinter.SetJobCommand(jobContext.jobID, JOB_CONTROL_RETAIN)
 		if err != nil {
-			return 0, err
+			return nil, err
 		}
 	}
 
-	return uint32(jobContext.jobID), nil
+	result.JobID = uint32(jobContext.jobID)
+	return &result, nil
+}
+
+// reportProgress reports the pages rendered so far, with the size of the
+// job as the spooler has it.
+func (c *jobContext) reportProgress(progress lib.ProgressFunc, pagesRendered, totalPages int) {
+	if progress == nil {
+		return
+	}
+	p := lib.PrintProgress{JobID: uint32(c.jobID), PagesRendered: pagesRendered, TotalPages: totalPages}
+	if ji2, err := c.hPrinter.GetJob2(c.jobID); err == nil {
+		p.BytesSpooled = int64(ji2.GetSize())
+	}
+	progress(p)
 }
 
 func (ws *WinSpool) ReleaseJob(printerName string, jobID uint32) error {
-	hPrinter, err := OpenPrinter(printerName)
+	if err := ws.Faults.Inject("ReleaseJob", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ReleaseJob(printerName, jobID)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
 	if err != nil {
 		return err
 	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
 
 	// Only release if the job was retained (otherwise we get an error)
-	ji1, err := hPrinter.GetJob(int32(jobID))
+	ji1, err := ws.getJob(&hPrinter, printerName, int32(jobID))
 	if err != nil {
 		return err
 	}
@@ -854,8 +2035,10 @@ func (ws *WinSpool) ReleaseJob(printerName string, jobID uint32) error {
 }
 
 type Job struct {
-	Status         uint32
-	Priority       uint32
+	Status   uint32
+	Priority uint32
+	// Place of the job in the queue, from 1 for the next to print.
+	Position       uint32
 	Size           uint32
 	PrinterName    string
 	DriverName     string
@@ -867,12 +2050,194 @@ type Job struct {
 	UserName       string
 }
 
+// PausePrinter pauses the queue of a printer. Jobs are still accepted, and
+// print once the queue is resumed.
+func (ws *WinSpool) PausePrinter(printerName string) error {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.PausePrinter(printerName)
+	}
+	return ws.controlPrinter(printerName, PRINTER_CONTROL_PAUSE, "pausing printer")
+}
+
+// ResumePrinter resumes the paused queue of a printer.
+func (ws *WinSpool) ResumePrinter(printerName string) error {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ResumePrinter(printerName)
+	}
+	return ws.controlPrinter(printerName, PRINTER_CONTROL_RESUME, "resuming printer")
+}
+
+// PurgePrinter deletes all the jobs of a printer, including the one that is
+// printing.
+func (ws *WinSpool) PurgePrinter(printerName string) error {
+	if ws.isVirtual(printerName) {
+		return ws.virtual.PurgePrinter(printerName)
+	}
+	return ws.controlPrinter(printerName, PRINTER_CONTROL_PURGE, "purging printer")
+}
+
+func (ws *WinSpool) controlPrinter(printerName string, command uint32, operation string) error {
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER)
+	if err != nil {
+		if errors.Is(err, ERROR_INVALID_PRINTER_NAME) {
+			return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+		}
+		return accessError(err, operation+" "+printerName)
+	}
+	defer hPrinter.ClosePrinter()
+
+	if err = hPrinter.SetPrinterCommand(command); err != nil {
+		if errors.Is(err, ERROR_ACCESS_DENIED) {
+			return accessError(err, operation+" "+printerName)
+		}
+		return fmt.Errorf("failed %s %s: %w", operation, printerName, err)
+	}
+	return nil
+}
+
+// ResumeHeldJobs resumes the paused jobs of a printer, and returns how many
+// were resumed. Jobs held by the hold of their ticket, as noted in
+// HeldJobs, and jobs with a print window wait for their release.
+func (ws *WinSpool) ResumeHeldJobs(printerName string) (int, error) {
+	if err := ws.Faults.Inject("ResumeHeldJobs", printerName); err != nil {
+		return 0, err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.ResumeHeldJobs(printerName)
+	}
+	hPrinter, err := ws.openPrinterAccess(printerName, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		return 0, accessError(err, "resuming jobs on "+printerName)
+	}
+	defer hPrinter.ClosePrinter()
+
+	held, err := ws.heldJobIDs(printerName)
+	if err != nil {
+		return 0, err
+	}
+	jobs, err := ws.enumJobs2(&hPrinter, printerName, PRINTER_ACCESS_ADMINISTER|PRINTER_ACCESS_USE)
+	if err != nil {
+		return 0, err
+	}
+	resumed := 0
+	for i := range jobs {
+		if jobs[i].status&JOB_STATUS_PAUSED == 0 || held[jobs[i].jobID] || jobs[i].startTime != jobs[i].untilTime {
+			continue
+		}
+		if err = hPrinter.SetJobCommand(int32(jobs[i].jobID), JOB_CONTROL_RESUME); err != nil {
+			return resumed, fmt.Errorf("failed to resume job %d on %s: %w", jobs[i].jobID, printerName, err)
+		}
+		resumed++
+	}
+	return resumed, nil
+}
+
+// CancelJob deletes a job, whether it is spooling, printing or retained.
+func (ws *WinSpool) CancelJob(printerName string, jobID uint32) error {
+	if err := ws.Faults.Inject("CancelJob", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.CancelJob(printerName, jobID)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	if _, err = ws.getJob(&hPrinter, printerName, int32(jobID)); err != nil {
+		if errors.Is(err, ERROR_INVALID_PARAMETER) {
+			return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+		}
+		return err
+	}
+
+	err = hPrinter.SetJobCommand(int32(jobID), JOB_CONTROL_DELETE)
+	if err != nil && !errors.Is(err, ERROR_ACCESS_DENIED) {
+		// JOB_CONTROL_DELETE is unknown to some older print processors.
+		err = hPrinter.SetJobCommand(int32(jobID), JOB_CONTROL_CANCEL)
+	}
+	if errors.Is(err, ERROR_ACCESS_DENIED) {
+		// Users can only cancel their own jobs.
+		return accessError(err, fmt.Sprintf("cancelling job %d of another user on %s", jobID, printerName))
+	} else if err != nil {
+		return fmt.Errorf("failed to cancel job %d on %s: %w", jobID, printerName, err)
+	}
+	return nil
+}
+
+// RestartJob prints a job again from the start, such as one that didn't
+// resume after a paper out.
+func (ws *WinSpool) RestartJob(printerName string, jobID uint32) error {
+	if err := ws.Faults.Inject("RestartJob", printerName); err != nil {
+		return err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.RestartJob(printerName, jobID)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	err = hPrinter.SetJobCommand(int32(jobID), JOB_CONTROL_RESTART)
+	if errors.Is(err, ERROR_ACCESS_DENIED) {
+		return accessError(err, fmt.Sprintf("restarting job %d of another user on %s", jobID, printerName))
+	} else if err != nil {
+		return fmt.Errorf("failed to restart job %d on %s: %w", jobID, printerName, err)
+	}
+	return nil
+}
+
+// SetJobPriority changes the priority of a job, from lib.JobPriorityMin to
+// lib.JobPriorityMax, which moves it ahead of the queued jobs of a lower
+// priority. Users can only change their own jobs.
+func (ws *WinSpool) SetJobPriority(printerName string, jobID, priority uint32) error {
+	if err := ws.Faults.Inject("SetJobPriority", printerName); err != nil {
+		return err
+	}
+	if priority < lib.JobPriorityMin || priority > lib.JobPriorityMax {
+		return fmt.Errorf("job priority must be from %d to %d, got %d", lib.JobPriorityMin, lib.JobPriorityMax, priority)
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtual.SetJobPriority(printerName, jobID, priority)
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	err = hPrinter.SetJobPriority(int32(jobID), priority)
+	if errors.Is(err, ERROR_INVALID_PARAMETER) {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	} else if errors.Is(err, ERROR_ACCESS_DENIED) {
+		return accessError(err, fmt.Sprintf("changing the priority of job %d of another user on %s", jobID, printerName))
+	} else if err != nil {
+		return fmt.Errorf("failed to change the priority of job %d on %s: %w", jobID, printerName, err)
+	}
+	return nil
+}
+
 func (ws *WinSpool) JobList(printerName string) ([]Job, error) {
-	hPrinter, err := OpenPrinter(printerName)
+	if err := ws.Faults.Inject("JobList", printerName); err != nil {
+		return nil, err
+	}
+	if ws.isVirtual(printerName) {
+		return ws.virtualJobList(printerName), nil
+	}
+	hPrinter, err := ws.acquirePrinter(printerName, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { ws.releasePrinter(hPrinter, printerName, 0, err) }()
+
+	jobs1, err := ws.enumJobs(&hPrinter, printerName, 0)
 	if err != nil {
 		return nil, err
 	}
-	jobs1, err := hPrinter.EnumJobs1()
 	jobs := make([]Job, len(jobs1))
 	for i := range jobs1 {
 		jobs[i] = Job{
@@ -883,6 +2248,7 @@ func (ws *WinSpool) JobList(printerName string) ([]Job, error) {
 			UserName:    utf16PtrToString(jobs1[i].pUserName),
 			Status:      jobs1[i].status,
 			Priority:    jobs1[i].priority,
+			Position:    jobs1[i].position,
 			JobID:       jobs1[i].jobID,
 		}
 
@@ -890,6 +2256,213 @@ func (ws *WinSpool) JobList(printerName string) ([]Job, error) {
 	return jobs, err
 }
 
+// WatchChanges reports changes to local printers and their jobs, as signaled
+// by the spooler, and to virtual printers, until done is closed. The returned
+// channel is closed when watching stops.
+func (ws *WinSpool) WatchChanges(done <-chan struct{}) (<-chan lib.SpoolerChange, error) {
+	if err := ws.Faults.Inject("WatchChanges", ""); err != nil {
+		return nil, err
+	}
+	changes, err := ws.watchSpoolerChanges(done)
+	if err != nil || ws.virtual == nil {
+		return changes, err
+	}
+	virtual, err := ws.virtual.WatchChanges(done)
+	if err != nil {
+		return nil, err
+	}
+	return mergeSpoolerChanges(done, changes, virtual), nil
+}
+
+// Spooler changes that may change the capabilities of printers.
+const capabilityChanges = PRINTER_CHANGE_PRINTER_DRIVER | PRINTER_CHANGE_FORM | PRINTER_CHANGE_PORT
+
+func (ws *WinSpool) watchSpoolerChanges(done <-chan struct{}) (<-chan lib.SpoolerChange, error) {
+	hServer, err := OpenPrintServer(ws.Server)
+	if err != nil {
+		return nil, err
+	}
+	hChange, err := hServer.FindFirstPrinterChangeNotification(PRINTER_CHANGE_PRINTER | PRINTER_CHANGE_JOB | capabilityChanges)
+	if err != nil {
+		hServer.ClosePrinter()
+		return nil, err
+	}
+
+	changes := make(chan lib.SpoolerChange, 16)
+	go func() {
+		defer close(changes)
+		defer hServer.ClosePrinter()
+		defer hChange.FindClosePrinterChangeNotification()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			signaled, err := hChange.Wait(time.Second)
+			if err != nil {
+				log.Printf("Failed to wait for spooler change notification: %s", err)
+				return
+			}
+			if !signaled {
+				continue
+			}
+
+			flags, err := hChange.FindNextPrinterChangeNotification()
+			if err != nil {
+				log.Printf("Failed to read spooler change notification: %s", err)
+				return
+			}
+
+			var change lib.SpoolerChange
+			if flags&PRINTER_CHANGE_PRINTER != 0 {
+				change |= lib.SpoolerChangePrinter
+			}
+			// Drivers updated in place keep their name, and forms or ports
+			// changed keep the DEVMODE; the cache key doesn't see these.
+			if flags&(capabilityChanges|PRINTER_CHANGE_ADD_PRINTER|PRINTER_CHANGE_DELETE_PRINTER) != 0 {
+				ws.capabilities.Invalidate()
+				change |= lib.SpoolerChangePrinter
+			}
+			if flags&PRINTER_CHANGE_JOB != 0 {
+				change |= lib.SpoolerChangeJob
+			}
+			if change == 0 {
+				continue
+			}
+
+			select {
+			case changes <- change:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// Job fields requested by WatchJobChanges.
+var jobChangeFields = []uint16{
+	JOB_NOTIFY_FIELD_PRINTER_NAME,
+	JOB_NOTIFY_FIELD_STATUS,
+	JOB_NOTIFY_FIELD_TOTAL_PAGES,
+	JOB_NOTIFY_FIELD_PAGES_PRINTED,
+}
+
+// WatchJobChanges reports the status and page counts of local jobs as they
+// change, until done is closed. The returned channel is closed when watching
+// stops.
+//
+// When the spooler discards notifications, the values of all jobs are
+// requested again, so a receiver always ends up with the current values.
+func (ws *WinSpool) WatchJobChanges(done <-chan struct{}) (<-chan lib.JobChange, error) {
+	if err := ws.Faults.Inject("WatchJobChanges", ""); err != nil {
+		return nil, err
+	}
+	changes, err := ws.watchSpoolerJobChanges(done)
+	if err != nil || ws.virtual == nil {
+		return changes, err
+	}
+	virtual, err := ws.virtual.WatchJobChanges(done)
+	if err != nil {
+		return nil, err
+	}
+	return mergeJobChanges(done, changes, virtual), nil
+}
+
+func (ws *WinSpool) watchSpoolerJobChanges(done <-chan struct{}) (<-chan lib.JobChange, error) {
+	hServer, err := OpenPrintServer(ws.Server)
+	if err != nil {
+		return nil, err
+	}
+	types := []PrinterNotifyOptionsType{NewPrinterNotifyOptionsType(JOB_NOTIFY_TYPE, jobChangeFields)}
+	hChange, err := hServer.FindFirstPrinterChangeNotificationOptions(PRINTER_CHANGE_JOB, NewPrinterNotifyOptions(types))
+	if err != nil {
+		hServer.ClosePrinter()
+		return nil, err
+	}
+
+	changes := make(chan lib.JobChange, 64)
+	go func() {
+		defer close(changes)
+		defer hServer.ClosePrinter()
+		defer hChange.FindClosePrinterChangeNotification()
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			signaled, err := hChange.Wait(time.Second)
+			if err != nil {
+				log.Printf("Failed to wait for spooler job notification: %s", err)
+				return
+			}
+			if !signaled {
+				continue
+			}
+
+			_, values, discarded, err := hChange.FindNextPrinterChangeNotificationInfo(false)
+			for err == nil && discarded {
+				_, values, discarded, err = hChange.FindNextPrinterChangeNotificationInfo(true)
+			}
+			if err != nil {
+				log.Printf("Failed to read spooler job notification: %s", err)
+				return
+			}
+
+			for _, change := range convertJobNotifyValues(values, ws.Server) {
+				select {
+				case changes <- change:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	return changes, nil
+}
+
+// convertJobNotifyValues groups job field values by job, in the order the
+// jobs first appear. Printers are named as on server, see lib.PrinterPath.
+func convertJobNotifyValues(values []PrinterNotifyValue, server string) []lib.JobChange {
+	var changes []lib.JobChange
+	index := make(map[uint32]int)
+	for _, value := range values {
+		if value.Type != JOB_NOTIFY_TYPE {
+			continue
+		}
+		i, exists := index[value.ID]
+		if !exists {
+			i = len(changes)
+			index[value.ID] = i
+			changes = append(changes, lib.JobChange{JobID: value.ID})
+		}
+		number := value.Number
+		switch value.Field {
+		case JOB_NOTIFY_FIELD_PRINTER_NAME:
+			changes[i].PrinterName = lib.PrinterPath(server, value.String)
+		case JOB_NOTIFY_FIELD_STATUS:
+			changes[i].Status = &number
+		case JOB_NOTIFY_FIELD_TOTAL_PAGES:
+			changes[i].TotalPages = &number
+		case JOB_NOTIFY_FIELD_PAGES_PRINTED:
+			changes[i].PagesPrinted = &number
+		}
+	}
+	return changes
+}
+
+// StartPrinterNotifications registers handle, a service status handle, for
+// device notifications.
+//
+// Deprecated: use WatchDevices, which needs no handle from the caller.
 func (ws *WinSpool) StartPrinterNotifications(handle windows.Handle) error {
 	err := RegisterDeviceNotification(handle)
 	return err
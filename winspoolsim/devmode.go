@@ -0,0 +1,183 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"encoding/binary"
+
+	"github.com/gorpher/winspool-cgo/lib"
+)
+
+// DEVMODE dmFields flags, as defined in wingdi.h.
+const (
+	FieldOrientation   uint32 = 0x00000001
+	FieldPaperSize     uint32 = 0x00000002
+	FieldPaperLength   uint32 = 0x00000004
+	FieldPaperWidth    uint32 = 0x00000008
+	FieldCopies        uint32 = 0x00000100
+	FieldDefaultSource uint32 = 0x00000200
+	FieldColor         uint32 = 0x00000800
+	FieldDuplex        uint32 = 0x00001000
+	FieldCollate       uint32 = 0x00008000
+)
+
+// DevMode simulates the DEVMODE fields that job tickets change. Fields
+// holds the flags of the fields that are set, like dmFields.
+type DevMode struct {
+	Fields      uint32
+	Orientation int16
+	PaperSize   int16
+	// Tenths of a millimeter.
+	PaperLength int16
+	PaperWidth  int16
+	Copies      int16
+	Color       int16
+	Duplex      int16
+	Collate     int16
+	// DMBIN value of the tray.
+	DefaultSource int16
+}
+
+// Has reports whether all the given fields are set.
+func (dm *DevMode) Has(fields uint32) bool {
+	return dm.Fields&fields == fields
+}
+
+func (dm *DevMode) SetOrientation(orientation int16) {
+	dm.Orientation = orientation
+	dm.Fields |= FieldOrientation
+}
+
+func (dm *DevMode) SetPaperSize(paperSize int16) {
+	dm.PaperSize = paperSize
+	dm.Fields |= FieldPaperSize
+}
+
+func (dm *DevMode) ClearPaperSize() {
+	dm.Fields &^= FieldPaperSize
+}
+
+func (dm *DevMode) SetPaperLength(length int16) {
+	dm.PaperLength = length
+	dm.Fields |= FieldPaperLength
+}
+
+func (dm *DevMode) ClearPaperLength() {
+	dm.Fields &^= FieldPaperLength
+}
+
+func (dm *DevMode) SetPaperWidth(width int16) {
+	dm.PaperWidth = width
+	dm.Fields |= FieldPaperWidth
+}
+
+func (dm *DevMode) ClearPaperWidth() {
+	dm.Fields &^= FieldPaperWidth
+}
+
+func (dm *DevMode) SetCopies(copies int16) {
+	dm.Copies = copies
+	dm.Fields |= FieldCopies
+}
+
+func (dm *DevMode) SetColor(color int16) {
+	dm.Color = color
+	dm.Fields |= FieldColor
+}
+
+func (dm *DevMode) SetDuplex(duplex int16) {
+	dm.Duplex = duplex
+	dm.Fields |= FieldDuplex
+}
+
+func (dm *DevMode) SetCollate(collate int16) {
+	dm.Collate = collate
+	dm.Fields |= FieldCollate
+}
+
+func (dm *DevMode) SetDefaultSource(source int16) {
+	dm.DefaultSource = source
+	dm.Fields |= FieldDefaultSource
+}
+
+// Getters of the fields, which tell whether they are set, for
+// lib.SummarizeDevMode.
+
+func (dm *DevMode) GetOrientation() (int16, bool) {
+	return dm.Orientation, dm.Has(FieldOrientation)
+}
+
+func (dm *DevMode) GetPaperSize() (int16, bool) {
+	return dm.PaperSize, dm.Has(FieldPaperSize)
+}
+
+func (dm *DevMode) GetCopies() (int16, bool) {
+	return dm.Copies, dm.Has(FieldCopies)
+}
+
+func (dm *DevMode) GetColor() (int16, bool) {
+	return dm.Color, dm.Has(FieldColor)
+}
+
+func (dm *DevMode) GetDuplex() (int16, bool) {
+	return dm.Duplex, dm.Has(FieldDuplex)
+}
+
+func (dm *DevMode) GetCollate() (int16, bool) {
+	return dm.Collate, dm.Has(FieldCollate)
+}
+
+// Layout of the DEVMODEW that Bytes and ParseDevMode convert from and to.
+const (
+	devModeSize          = 220
+	devModeSpecVersion   = 0x0401
+	devModeDriverVersion = 0x0100
+)
+
+// Bytes encodes the DEVMODE as a DEVMODEW, without driver data.
+func (dm *DevMode) Bytes() []byte {
+	b := make([]byte, devModeSize)
+	le := binary.LittleEndian
+	le.PutUint16(b[64:], devModeSpecVersion)
+	le.PutUint16(b[66:], devModeDriverVersion)
+	le.PutUint16(b[68:], devModeSize)
+	le.PutUint32(b[72:], dm.Fields)
+	for offset, v := range map[int]int16{
+		76: dm.Orientation, 78: dm.PaperSize, 80: dm.PaperLength, 82: dm.PaperWidth,
+		86: dm.Copies, 88: dm.DefaultSource, 92: dm.Color, 94: dm.Duplex, 100: dm.Collate,
+	} {
+		le.PutUint16(b[offset:], uint16(v))
+	}
+	return b
+}
+
+// ParseDevMode decodes the fields of a DEVMODEW that DevMode simulates.
+func ParseDevMode(data []byte) (DevMode, error) {
+	if _, err := lib.ParseDevModeHeader(data); err != nil {
+		return DevMode{}, err
+	}
+	if len(data) < 102 {
+		// Older DEVMODEs end before dmCollate.
+		data = append(append([]byte{}, data...), make([]byte, 102-len(data))...)
+	}
+	le := binary.LittleEndian
+	field := func(offset int) int16 { return int16(le.Uint16(data[offset:])) }
+	return DevMode{
+		Fields:        le.Uint32(data[72:]),
+		Orientation:   field(76),
+		PaperSize:     field(78),
+		PaperLength:   field(80),
+		PaperWidth:    field(82),
+		Copies:        field(86),
+		DefaultSource: field(88),
+		Color:         field(92),
+		Duplex:        field(94),
+		Collate:       field(100),
+	}, nil
+}
@@ -0,0 +1,75 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"testing"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// FuzzDevModeRoundTrip applies tickets to a DEVMODE, and checks that what
+// the DEVMODE holds reads back as what the ticket asked for.
+func FuzzDevModeRoundTrip(f *testing.F) {
+	f.Add(int32(3), "LONG_EDGE", "LANDSCAPE", int32(216000), int32(279000), "")
+	f.Add(int32(40000), "NO_DUPLEX", "PORTRAIT", int32(80000), int32(200000), "")
+	f.Add(int32(1), "SHORT_EDGE", "AUTO", int32(0), int32(0), "9")
+	f.Add(int32(-1), "", "", int32(-5), int32(1<<30), "70000")
+
+	description := office.Description()
+	f.Fuzz(func(t *testing.T, copies int32, duplex, orientation string, width, height int32, paperVendorID string) {
+		ticket := model.JobTicket{
+			Copies:          &model.CopiesTicketItem{Copies: copies},
+			Duplex:          &model.DuplexTicketItem{Type: model.DuplexType(duplex)},
+			PageOrientation: &model.PageOrientationTicketItem{Type: model.PageOrientationType(orientation)},
+			MediaSize:       &model.MediaSizeTicketItem{WidthMicrons: width, HeightMicrons: height, VendorID: paperVendorID},
+		}
+
+		var devMode DevMode
+		var result lib.PrintResult
+		settings, err := lib.ApplyTicket(&devMode, description, &ticket, &result)
+		if err != nil {
+			return
+		}
+
+		if devMode.Has(FieldCopies) {
+			if int32(devMode.Copies) != copies || settings.SoftwareCopies != 1 {
+				t.Fatalf("copies %d became %d, %d in software", copies, devMode.Copies, settings.SoftwareCopies)
+			}
+		} else if copies > 1 && settings.SoftwareCopies != int(copies) {
+			t.Fatalf("%d copies lost", copies)
+		}
+
+		if devMode.Has(FieldDuplex) {
+			if devMode.Duplex < lib.DevModeDuplexSimplex || devMode.Duplex > lib.DevModeDuplexHorizontal {
+				t.Fatalf("invalid dmDuplex %d", devMode.Duplex)
+			}
+			if settings.Duplex != (devMode.Duplex != lib.DevModeDuplexSimplex) {
+				t.Fatalf("dmDuplex %d disagrees with duplex %t", devMode.Duplex, settings.Duplex)
+			}
+		}
+
+		if devMode.Has(FieldPaperSize) {
+			if devMode.Has(FieldPaperLength) || devMode.Has(FieldPaperWidth) {
+				t.Fatal("paper code and dimensions set together")
+			}
+			if devMode.PaperSize < 1 {
+				t.Fatalf("invalid dmPaperSize %d", devMode.PaperSize)
+			}
+		} else if devMode.Has(FieldPaperLength | FieldPaperWidth) {
+			if int32(devMode.PaperLength)*100 != height/100*100 || int32(devMode.PaperWidth)*100 != width/100*100 {
+				t.Fatalf("%dx%d microns became %dx%d tenths of a millimeter", width, height, devMode.PaperWidth, devMode.PaperLength)
+			}
+		}
+	})
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Paper is an entry of the driver paper tables (DC_PAPERS, DC_PAPERNAMES
+// and DC_PAPERSIZE).
+type Paper struct {
+	Code uint16
+	Name string
+	// Tenths of a millimeter.
+	Width, Length int32
+}
+
+// Common driver papers.
+var (
+	PaperLetter = Paper{Code: 1, Name: "Letter", Width: 2159, Length: 2794}
+	PaperLegal  = Paper{Code: 5, Name: "Legal", Width: 2159, Length: 3556}
+	PaperA4     = Paper{Code: 9, Name: "A4", Width: 2100, Length: 2970}
+	PaperA5     = Paper{Code: 11, Name: "A5", Width: 1480, Length: 2100}
+)
+
+// Bin is an entry of the driver tray tables (DC_BINS and DC_BINNAMES).
+type Bin struct {
+	Code int16
+	Name string
+}
+
+// Common driver trays.
+var (
+	BinAuto   = Bin{Code: lib.DevModeBinAuto, Name: "Automatically Select"}
+	BinUpper  = Bin{Code: lib.DevModeBinUpper, Name: "Tray 1"}
+	BinLower  = Bin{Code: lib.DevModeBinLower, Name: "Tray 2"}
+	BinManual = Bin{Code: lib.DevModeBinManual, Name: "Manual Feed"}
+)
+
+// Printer describes a simulated printer by its driver capability tables.
+type Printer struct {
+	Name string
+	// Driver name; "Simulated Driver" when empty.
+	Driver string
+
+	// Color is set when the default DEVMODE color is DMCOLOR_COLOR.
+	Color bool
+	// DC_DUPLEX, DC_ORIENTATION (landscape), DC_COPIES and DC_COLLATE.
+	Duplex    bool
+	Landscape bool
+	MaxCopies int32
+	Collate   bool
+	Papers    []Paper
+	Bins      []Bin
+	// DC_ENUMRESOLUTIONS; the first is the default.
+	Resolutions []lib.Resolution
+
+	// Default is the driver default DEVMODE, which jobs start from.
+	Default DevMode
+
+	// Status holds PRINTER_STATUS flags; zero is idle.
+	Status uint32
+
+	// Jobs submitted to the printer only print within the window, when
+	// set; see Spooler.SetPrintWindow.
+	PrintWindow *lib.PrintWindow
+
+	// JobTrailer follows the data of RAW jobs, in the same job, as the
+	// job_trailer of winspool does.
+	JobTrailer []byte
+}
+
+// PRINTER_STATUS flags.
+const (
+	PrinterStatusPaused   uint32 = 0x00000001
+	PrinterStatusPaperOut uint32 = 0x00000010
+	PrinterStatusOffline  uint32 = 0x00000080
+)
+
+func (p *Printer) driver() string {
+	if p.Driver == "" {
+		return "Simulated Driver"
+	}
+	return p.Driver
+}
+
+func (p *Printer) hasPaper(code int16) bool {
+	for _, paper := range p.Papers {
+		if int16(paper.Code) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ticketDevMode decodes the DEVMODE of a ticket, which jobs start from
+// instead of the default. As winspool does, it must be from the driver of
+// the printer, and like drivers, values the printer lacks are rejected.
+func (p *Printer) ticketDevMode(export *lib.DevModeExport) (DevMode, error) {
+	devMode, err := ParseDevMode(export.DevMode)
+	if err != nil {
+		return DevMode{}, err
+	}
+	if export.Driver != "" {
+		err = export.CheckDriver(p.driver(), devModeDriverVersion)
+	} else if export.DriverVersion != devModeDriverVersion {
+		err = fmt.Errorf("DEVMODE of the ticket has driver version %#x, %s has %#x: %w", export.DriverVersion, p.Name, devModeDriverVersion, lib.ErrDriverMismatch)
+	}
+	if err != nil {
+		return DevMode{}, err
+	}
+	if devMode.Has(FieldPaperSize) && !p.hasPaper(devMode.PaperSize) {
+		return DevMode{}, fmt.Errorf("driver rejected the DEVMODE of the ticket for %s: unknown paper size %d", p.Name, devMode.PaperSize)
+	}
+	return devMode, nil
+}
+
+func (p *Printer) state() *model.PrinterStateSection {
+	if p.Status != 0 {
+		state := model.PrinterStateSection{State: model.CloudDeviceStateStopped}
+		// As winspool reports it.
+		if p.Status&PrinterStatusPaperOut != 0 {
+			state.InputTrayState = &model.InputTrayState{Item: []model.InputTrayStateItem{{VendorID: "paper", State: model.InputTrayStateEmpty}}}
+		}
+		return &state
+	}
+	return &model.PrinterStateSection{State: model.CloudDeviceStateIdle}
+}
+
+// Description converts the capability tables into a printer description,
+// as winspool does for real drivers.
+func (p *Printer) Description() *model.PrinterDescriptionSection {
+	var description model.PrinterDescriptionSection
+
+	if p.Color {
+		description.Color = &model.Color{Option: []model.ColorOption{
+			{VendorID: strconv.Itoa(int(lib.DevModeColorColor)), Type: model.ColorTypeStandardColor, IsDefault: true},
+			{VendorID: strconv.Itoa(int(lib.DevModeColorMonochrome)), Type: model.ColorTypeStandardMonochrome},
+		}}
+	} else {
+		description.Color = &model.Color{Option: []model.ColorOption{
+			{VendorID: strconv.Itoa(int(lib.DevModeColorMonochrome)), Type: model.ColorTypeStandardMonochrome, IsDefault: true},
+		}}
+	}
+
+	if p.Duplex {
+		description.Duplex = &model.Duplex{Option: []model.DuplexOption{
+			{Type: model.DuplexNoDuplex, IsDefault: p.Default.Duplex != lib.DevModeDuplexVertical && p.Default.Duplex != lib.DevModeDuplexHorizontal},
+			{Type: model.DuplexLongEdge, IsDefault: p.Default.Duplex == lib.DevModeDuplexVertical},
+			{Type: model.DuplexShortEdge, IsDefault: p.Default.Duplex == lib.DevModeDuplexHorizontal},
+		}}
+	}
+
+	if p.Landscape {
+		description.PageOrientation = &model.PageOrientation{Option: []model.PageOrientationOption{
+			{Type: model.PageOrientationPortrait, IsDefault: p.Default.Orientation != lib.DevModeOrientationLandscape},
+			{Type: model.PageOrientationLandscape, IsDefault: p.Default.Orientation == lib.DevModeOrientationLandscape},
+		}}
+	}
+
+	if p.MaxCopies > 1 {
+		description.Copies = &model.Copies{Default: 1, Max: p.MaxCopies}
+	}
+
+	if len(p.Papers) > 0 {
+		mediaSize := model.MediaSize{}
+		var foundDefault bool
+		for _, paper := range p.Papers {
+			isDefault := !foundDefault && p.Default.Has(FieldPaperSize) && int16(paper.Code) == p.Default.PaperSize
+			foundDefault = foundDefault || isDefault
+			mediaSize.Option = append(mediaSize.Option, model.MediaSizeOption{
+				Name:                       model.MediaSizeCustom,
+				WidthMicrons:               paper.Width * 100,
+				HeightMicrons:              paper.Length * 100,
+				IsDefault:                  isDefault,
+				VendorID:                   strconv.Itoa(int(paper.Code)),
+				CustomDisplayNameLocalized: model.NewLocalizedString(paper.Name),
+			})
+		}
+		if !foundDefault {
+			mediaSize.Option[0].IsDefault = true
+		}
+		description.MediaSize = &mediaSize
+	}
+
+	if len(p.Bins) > 0 {
+		mediaSource := model.MediaSource{}
+		var foundDefault bool
+		for _, bin := range p.Bins {
+			isDefault := !foundDefault && p.Default.Has(FieldDefaultSource) && bin.Code == p.Default.DefaultSource
+			foundDefault = foundDefault || isDefault
+			mediaSource.Option = append(mediaSource.Option, model.MediaSourceOption{
+				Type:                       lib.MediaSourceTypeOfBin(bin.Code),
+				IsDefault:                  isDefault,
+				VendorID:                   strconv.Itoa(int(bin.Code)),
+				CustomDisplayNameLocalized: model.NewLocalizedString(bin.Name),
+			})
+		}
+		if !foundDefault {
+			mediaSource.Option[0].IsDefault = true
+		}
+		description.MediaSource = &mediaSource
+	}
+
+	if p.Collate {
+		description.Collate = &model.Collate{Default: p.Default.Collate == lib.DevModeCollateTrue}
+	}
+
+	return &description
+}
@@ -0,0 +1,1045 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+// Package winspoolsim simulates the Windows print spooler in pure Go:
+// printers with driver capability tables, DEVMODEs, job status flags and
+// change notifications. It runs on any OS, so ticket application and job
+// scheduling can be unit tested without a Windows machine.
+package winspoolsim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// Job is a simulated spooler job.
+type Job struct {
+	ID      uint32
+	Printer string
+	Title   string
+	// UserName of the submitter, see SetUser.
+	UserName string
+	// Submitted is when the job was queued.
+	Submitted time.Time
+	// DevMode the job was printed with, after the ticket was applied.
+	DevMode DevMode
+	// Pages written to the job, counting software copies.
+	Pages int
+	// PagesPrinted counts the pages the printer is done with.
+	PagesPrinted int
+	// Status holds JOB_STATUS flags, see lib.JobStatusPaused etc.
+	Status uint32
+	// Jobs of a higher priority are ahead in the queue.
+	Priority uint32
+	// Spooler datatype and data of jobs sent with PrintRaw.
+	Datatype string
+	Data     []byte
+	// Window the job is held outside of, from the printer or the
+	// hold_until of the ticket; nil once an administrator prints it now.
+	Window *lib.PrintWindow
+	// TicketHold tells whether the job is held by the hold of its ticket,
+	// until it is released with ResumeJob.
+	TicketHold bool
+}
+
+// Held tells whether the job waits for its window to open at t, or to be
+// released.
+func (j *Job) Held(t time.Time) bool {
+	return j.Status&lib.JobStatusPaused != 0 || j.Window != nil && !j.Window.Contains(t)
+}
+
+// Spooler simulates the print spooler, as a lib.NativePrintSystem that can
+// back a manager.PrinterManager. Jobs don't progress by themselves; tests
+// drive them with Advance and SetJobStatus, or script them with
+// SetJobScript.
+type Spooler struct {
+	mutex     sync.Mutex
+	printers  []*Printer
+	jobs      map[uint32]*Job
+	nextJobID uint32
+	watchers  []chan lib.SpoolerChange
+	// Receive job field values, like PRINTER_NOTIFY_INFO.
+	jobWatchers []chan lib.JobChange
+	// Receive plugged and unplugged devices.
+	deviceWatchers []chan lib.DeviceChange
+	subscribers    []*subscriber
+	// Jobs are submitted as user, see SetUser.
+	user     string
+	nonAdmin bool
+	// Name of the default printer, empty when there is none.
+	defaultPrinter string
+	faults         *lib.Faults
+	// Scripts jobs of a printer run through, by printer name.
+	scripts map[string][]JobStep
+}
+
+var _ lib.NativePrintSystem = (*Spooler)(nil)
+
+// JobStep is a step of a job script: After the previous step, or the
+// submission of the job for the first one, the job gets Status, with
+// PagesPrinted pages done.
+type JobStep struct {
+	After  time.Duration
+	Status uint32
+	// Negative for all pages of the job.
+	PagesPrinted int
+}
+
+type subscriber struct {
+	events chan lib.Event
+	jobs   *lib.JobTransitions
+}
+
+func NewSpooler(printers ...Printer) *Spooler {
+	s := Spooler{
+		jobs:      make(map[uint32]*Job),
+		nextJobID: 1,
+	}
+	for i := range printers {
+		s.printers = append(s.printers, &printers[i])
+	}
+	return &s
+}
+
+// SetUser sets the user that jobs are submitted as from now on. Unless admin,
+// operations that need administrator rights fail with lib.ErrAdminRequired,
+// as ERROR_ACCESS_DENIED does on Windows. The default is an unnamed
+// administrator.
+func (s *Spooler) SetUser(name string, admin bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.user, s.nonAdmin = name, !admin
+}
+
+// SetFaults makes calls fail or stall as configured by faults, as
+// WinSpool.Faults does; nil removes them.
+func (s *Spooler) SetFaults(faults *lib.Faults) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.faults = faults
+}
+
+// inject applies the faults to a call. It must be called without holding the
+// mutex, as faults may stall.
+func (s *Spooler) inject(operation, printerName string) error {
+	s.mutex.Lock()
+	faults := s.faults
+	s.mutex.Unlock()
+	return faults.Inject(operation, printerName)
+}
+
+// AddPrinter adds or replaces a printer.
+func (s *Spooler) AddPrinter(printer Printer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if p := s.printer(printer.Name); p != nil {
+		*p = printer
+		s.publish(lib.Event{Type: lib.EventPrinterStateChanged, Printer: printer.Name, PrinterState: printer.state()})
+	} else {
+		s.printers = append(s.printers, &printer)
+		s.publish(lib.Event{Type: lib.EventPrinterAdded, Printer: printer.Name, PrinterState: printer.state()})
+	}
+	s.notify(lib.SpoolerChangePrinter)
+}
+
+// RemovePrinter removes a printer and its jobs.
+func (s *Spooler) RemovePrinter(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, p := range s.printers {
+		if p.Name == name {
+			s.printers = append(s.printers[:i], s.printers[i+1:]...)
+			for id, job := range s.jobs {
+				if job.Printer == name {
+					delete(s.jobs, id)
+				}
+			}
+			s.publish(lib.Event{Type: lib.EventPrinterRemoved, Printer: name})
+			s.notify(lib.SpoolerChangePrinter | lib.SpoolerChangeJob)
+			return true
+		}
+	}
+	return false
+}
+
+// SetPrinterStatus sets the PRINTER_STATUS flags of a printer.
+func (s *Spooler) SetPrinterStatus(name string, status uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(name)
+	if p == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, name)
+	}
+	p.Status = status
+	s.publish(lib.Event{Type: lib.EventPrinterStateChanged, Printer: name, PrinterState: p.state()})
+	s.notify(lib.SpoolerChangePrinter)
+	return nil
+}
+
+// GetDefaultPrinter returns the name of the default printer.
+func (s *Spooler) GetDefaultPrinter() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.defaultPrinter == "" || s.printer(s.defaultPrinter) == nil {
+		return "", errors.New("no default printer")
+	}
+	return s.defaultPrinter, nil
+}
+
+// SetDefaultPrinter makes a printer the default.
+func (s *Spooler) SetDefaultPrinter(printerName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.printer(printerName) == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	s.defaultPrinter = printerName
+	return nil
+}
+
+func (s *Spooler) GetPrinters() ([]lib.Printer, error) {
+	if err := s.inject("GetPrinters", ""); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	printers := make([]lib.Printer, 0, len(s.printers))
+	for _, p := range s.printers {
+		printers = append(printers, lib.Printer{
+			Name:               p.Name,
+			DefaultDisplayName: p.Name,
+			State:              p.state(),
+			Offline:            p.Status&PrinterStatusOffline != 0,
+			Description:        p.Description(),
+		})
+	}
+	return printers, nil
+}
+
+// PlugDevice simulates plugging in (or unplugging) the USB device of a
+// printer: the printer goes online (or offline), and device watchers are
+// told about it.
+func (s *Spooler) PlugDevice(name string, plugged bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(name)
+	if p == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, name)
+	}
+	change := lib.DeviceChange{Event: lib.DeviceRemoval, Name: `\\?\USB#` + name}
+	if plugged {
+		p.Status &^= PrinterStatusOffline
+		change.Event = lib.DeviceArrival
+	} else {
+		p.Status |= PrinterStatusOffline
+	}
+	for _, watcher := range s.deviceWatchers {
+		select {
+		case watcher <- change:
+		default:
+		}
+	}
+	s.publish(lib.Event{Type: lib.EventPrinterStateChanged, Printer: name, PrinterState: p.state()})
+	s.notify(lib.SpoolerChangePrinter)
+	return nil
+}
+
+// Print applies the ticket like winspool does, and queues a job of pages
+// pages, in the spooling state.
+func (s *Spooler) Print(printer *lib.Printer, title string, pages int, ticket *model.JobTicket) (*lib.PrintResult, error) {
+	if printer == nil {
+		return nil, errors.New("Print() called with nil printer")
+	}
+	if ticket == nil {
+		return nil, errors.New("Print() called with nil ticket")
+	}
+	if err := s.inject("Print", printer.Name); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printer.Name)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printer.Name)
+	}
+	description := printer.Description
+	if description == nil {
+		description = &model.PrinterDescriptionSection{}
+	}
+
+	var result lib.PrintResult
+	devMode := p.Default
+	export, err := lib.TicketDevMode(p.Name, ticket, nil)
+	if err != nil {
+		return nil, err
+	}
+	if export != nil {
+		if devMode, err = p.ticketDevMode(export); err != nil {
+			return nil, err
+		}
+	}
+	settings, err := lib.ApplyTicket(&devMode, description, ticket, &result)
+	if err != nil {
+		return nil, err
+	}
+	if err = settings.CheckPageRange(pages); err != nil {
+		return nil, err
+	}
+	pages = settings.PagesPrinted(pages)
+	window, err := lib.JobWindow(p.PrintWindow, ticket, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	job := Job{
+		ID:       s.nextJobID,
+		Printer:  p.Name,
+		Title:    title,
+		UserName: s.user,
+		DevMode:  devMode,
+		Pages:    pages * settings.SoftwareCopies,
+		Status:   lib.JobStatusSpooling,
+		Priority: lib.JobPriorityDefault,
+		Window:   window,
+	}
+	if ticket.Hold != nil {
+		job.Status |= lib.JobStatusPaused
+		job.TicketHold = true
+	}
+	s.nextJobID++
+	s.addJob(&job)
+
+	result.JobID = job.ID
+	result.JobIDs = []uint32{job.ID}
+	result.Pages = job.Pages
+	result.Sheets = settings.Sheets(pages)
+	return &result, nil
+}
+
+// PrintWithProgress prints like Print, then reports each page of the job as
+// rendered, like winspool does while rendering.
+func (s *Spooler) PrintWithProgress(printer *lib.Printer, title string, pages int, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
+	result, err := s.Print(printer, title, pages, ticket)
+	if err != nil || progress == nil {
+		return result, err
+	}
+	for i := 1; i <= result.Pages; i++ {
+		progress(lib.PrintProgress{JobID: result.JobID, PagesRendered: i, TotalPages: result.Pages})
+	}
+	return result, nil
+}
+
+// PrintRaw queues a job holding data as-is, like winspool does, in the
+// spooling state.
+func (s *Spooler) PrintRaw(printerName string, data io.Reader, docName, datatype string) (*lib.PrintResult, error) {
+	if err := s.inject("PrintRaw", printerName); err != nil {
+		return nil, err
+	}
+	if datatype == "" {
+		datatype = "RAW"
+	}
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	if datatype == "RAW" {
+		b = append(b, p.JobTrailer...)
+	}
+	job := Job{
+		ID:       s.nextJobID,
+		Printer:  p.Name,
+		Title:    docName,
+		UserName: s.user,
+		DevMode:  p.Default,
+		Status:   lib.JobStatusSpooling,
+		Priority: lib.JobPriorityDefault,
+		Datatype: datatype,
+		Data:     b,
+		Window:   p.PrintWindow,
+	}
+	s.nextJobID++
+	s.addJob(&job)
+
+	return &lib.PrintResult{JobID: job.ID, JobIDs: []uint32{job.ID}}, nil
+}
+
+// Job returns a copy of a job.
+func (s *Spooler) Job(jobID uint32) (Job, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// Jobs returns copies of the jobs of a printer, in queue order: by
+// priority, then in submission order.
+func (s *Spooler) Jobs(printerName string) []Job {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var jobs []Job
+	for id := uint32(1); id < s.nextJobID; id++ {
+		if job, ok := s.jobs[id]; ok && job.Printer == printerName {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Priority > jobs[j].Priority })
+	return jobs
+}
+
+// SetJobStatus sets the JOB_STATUS flags of a job.
+func (s *Spooler) SetJobStatus(jobID, status uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: job %d", lib.ErrJobNotFound, jobID)
+	}
+	job.Status = status
+	s.notifyJob(job)
+	return nil
+}
+
+// SetPagesPrinted sets the count of pages the printer is done with.
+func (s *Spooler) SetPagesPrinted(jobID uint32, pages int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: job %d", lib.ErrJobNotFound, jobID)
+	}
+	job.PagesPrinted = pages
+	s.notifyJob(job)
+	return nil
+}
+
+// Advance moves a job through the normal lifecycle: spooling, printing,
+// then printed and retained, as jobs are after Print. Jobs held outside of
+// their print window don't start printing.
+func (s *Spooler) Advance(jobID uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return fmt.Errorf("%w: job %d", lib.ErrJobNotFound, jobID)
+	}
+	switch {
+	case job.Status&lib.JobStatusSpooling != 0:
+		if job.Status&lib.JobStatusPaused != 0 {
+			return fmt.Errorf("job %d is paused", jobID)
+		}
+		if job.Held(time.Now()) {
+			return fmt.Errorf("job %d is held until the print window %s opens", jobID, job.Window)
+		}
+		job.Status = lib.JobStatusPrinting
+	case job.Status&lib.JobStatusPrinting != 0:
+		job.Status = lib.JobStatusPrinted | lib.JobStatusRetained
+		job.PagesPrinted = job.Pages
+	default:
+		return fmt.Errorf("job %d can't advance from status %#x", jobID, job.Status)
+	}
+	s.notifyJob(job)
+	return nil
+}
+
+func (s *Spooler) GetJobState(printerName string, jobID uint32) (*model.PrintJobStateDiff, error) {
+	if err := s.inject("GetJobState", printerName); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.printer(printerName) == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		// Like ERROR_INVALID_PARAMETER from GetJob.
+		return &model.PrintJobStateDiff{
+			State: &model.JobState{
+				Type:              model.JobStateAborted,
+				DeviceActionCause: &model.DeviceActionCause{ErrorCode: model.DeviceActionCauseOther},
+			},
+		}, nil
+	}
+	pagesPrinted, totalPages := int32(job.PagesPrinted), int32(job.Pages)
+	spooledBytes := int64(len(job.Data))
+	return &model.PrintJobStateDiff{
+		State:        lib.ConvertJobStatus(job.Status),
+		PagesPrinted: &pagesPrinted,
+		TotalPages:   &totalPages,
+		SpooledBytes: &spooledBytes,
+	}, nil
+}
+
+// GetJobInfo returns who submitted a job, and what, as from JOB_INFO_2.
+func (s *Spooler) GetJobInfo(printerName string, jobID uint32) (*lib.JobInfo, error) {
+	if err := s.inject("GetJobInfo", printerName); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.printer(printerName) == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return nil, fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	return &lib.JobInfo{
+		Printer:      job.Printer,
+		JobID:        job.ID,
+		User:         job.UserName,
+		Document:     job.Title,
+		Submitted:    job.Submitted,
+		Color:        job.DevMode.Has(FieldColor) && job.DevMode.Color == lib.DevModeColorColor,
+		TotalPages:   job.Pages,
+		PagesPrinted: job.PagesPrinted,
+	}, nil
+}
+
+// ReleaseJob deletes a retained job, as JOB_CONTROL_RELEASE does.
+func (s *Spooler) ReleaseJob(printerName string, jobID uint32) error {
+	if err := s.inject("ReleaseJob", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if job.Status&lib.JobStatusRetained != 0 {
+		delete(s.jobs, jobID)
+		s.notify(lib.SpoolerChangeJob)
+	}
+	return nil
+}
+
+// PausePrinter sets PRINTER_STATUS_PAUSED.
+func (s *Spooler) PausePrinter(printerName string) error {
+	return s.setPaused(printerName, "pausing", true)
+}
+
+// ResumePrinter clears PRINTER_STATUS_PAUSED.
+func (s *Spooler) ResumePrinter(printerName string) error {
+	return s.setPaused(printerName, "resuming", false)
+}
+
+func (s *Spooler) setPaused(printerName, operation string, paused bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	if s.nonAdmin {
+		return fmt.Errorf("%s printer %s %w", operation, printerName, lib.ErrAdminRequired)
+	}
+	if paused {
+		p.Status |= PrinterStatusPaused
+	} else {
+		p.Status &^= PrinterStatusPaused
+	}
+	s.publish(lib.Event{Type: lib.EventPrinterStateChanged, Printer: p.Name, PrinterState: p.state()})
+	s.notify(lib.SpoolerChangePrinter)
+	return nil
+}
+
+// PurgePrinter deletes all the jobs of a printer.
+func (s *Spooler) PurgePrinter(printerName string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.printer(printerName) == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	if s.nonAdmin {
+		return fmt.Errorf("purging printer %s %w", printerName, lib.ErrAdminRequired)
+	}
+	for id, job := range s.jobs {
+		if job.Printer == printerName {
+			delete(s.jobs, id)
+			job.Status = lib.JobStatusDeleted
+			s.notifyJob(job)
+		}
+	}
+	return nil
+}
+
+// ResumeHeldJobs resumes the paused jobs of a printer, but for those held
+// by the hold of their ticket or with a print window.
+func (s *Spooler) ResumeHeldJobs(printerName string) (int, error) {
+	if err := s.inject("ResumeHeldJobs", printerName); err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.nonAdmin {
+		return 0, fmt.Errorf("resuming jobs on %s %w", printerName, lib.ErrAdminRequired)
+	}
+	resumed := 0
+	for _, job := range s.jobs {
+		if job.Printer == printerName && job.Status&lib.JobStatusPaused != 0 && !job.TicketHold && job.Window == nil {
+			job.Status &^= lib.JobStatusPaused
+			s.notifyJob(job)
+			resumed++
+		}
+	}
+	return resumed, nil
+}
+
+// ResumeJob resumes a paused job, as JOB_CONTROL_RESUME does.
+func (s *Spooler) ResumeJob(printerName string, jobID uint32) error {
+	if err := s.inject("ResumeJob", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if s.nonAdmin && job.UserName != s.user {
+		return fmt.Errorf("releasing job %d of another user on %s %w", jobID, printerName, lib.ErrAdminRequired)
+	}
+	job.Status &^= lib.JobStatusPaused
+	job.TicketHold = false
+	s.notifyJob(job)
+	return nil
+}
+
+// CancelJob deletes a job, as JOB_CONTROL_DELETE does.
+func (s *Spooler) CancelJob(printerName string, jobID uint32) error {
+	if err := s.inject("CancelJob", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if s.nonAdmin && job.UserName != s.user {
+		return fmt.Errorf("cancelling job %d of another user on %s %w", jobID, printerName, lib.ErrAdminRequired)
+	}
+	delete(s.jobs, jobID)
+	job.Status = lib.JobStatusDeleted
+	s.notifyJob(job)
+	return nil
+}
+
+// ExportDevMode returns the default DEVMODE of a printer, as winspool does.
+func (s *Spooler) ExportDevMode(printerName string) (*lib.DevModeExport, error) {
+	if err := s.inject("ExportDevMode", printerName); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	return &lib.DevModeExport{
+		Printer:       printerName,
+		Driver:        p.driver(),
+		DriverVersion: devModeDriverVersion,
+		DevMode:       p.Default.Bytes(),
+	}, nil
+}
+
+// DriverCapabilities returns what the driver of a printer reports besides
+// its description, as winspool does.
+func (s *Spooler) DriverCapabilities(printerName string) (*lib.DriverCapabilities, error) {
+	if err := s.inject("DriverCapabilities", printerName); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return nil, fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	driver := lib.DriverCapabilities{
+		Resolutions: append([]lib.Resolution(nil), p.Resolutions...),
+		DevMode:     p.Default.Bytes(),
+	}
+	if len(p.Resolutions) > 0 {
+		driver.DefaultResolution = p.Resolutions[0]
+	}
+	return &driver, nil
+}
+
+// ImportDevMode makes an exported DEVMODE the default of a printer, as
+// winspool does. Like drivers, values the printer lacks are rejected.
+func (s *Spooler) ImportDevMode(printerName string, export *lib.DevModeExport) error {
+	if err := s.inject("ImportDevMode", printerName); err != nil {
+		return err
+	}
+	devMode, err := ParseDevMode(export.DevMode)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	if s.nonAdmin {
+		return fmt.Errorf("setting the default DEVMODE of %s %w", printerName, lib.ErrAdminRequired)
+	}
+	if err = export.CheckDriver(p.driver(), devModeDriverVersion); err != nil {
+		return err
+	}
+	if devMode.Has(FieldPaperSize) && !p.hasPaper(devMode.PaperSize) {
+		return fmt.Errorf("driver rejected the DEVMODE for %s: unknown paper size %d", printerName, devMode.PaperSize)
+	}
+	p.Default = devMode
+	return nil
+}
+
+// RestartJob prints a job again from the start, as JOB_CONTROL_RESTART does.
+func (s *Spooler) RestartJob(printerName string, jobID uint32) error {
+	if err := s.inject("RestartJob", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if s.nonAdmin && job.UserName != s.user {
+		return fmt.Errorf("restarting job %d of another user on %s %w", jobID, printerName, lib.ErrAdminRequired)
+	}
+	job.Status = lib.JobStatusPrinting | lib.JobStatusRestart
+	job.PagesPrinted = 0
+	s.notifyJob(job)
+	return nil
+}
+
+// SetJobPriority changes the priority of a job, as SetJob does.
+func (s *Spooler) SetJobPriority(printerName string, jobID, priority uint32) error {
+	if err := s.inject("SetJobPriority", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if s.nonAdmin && job.UserName != s.user {
+		return fmt.Errorf("changing the priority of job %d of another user on %s %w", jobID, printerName, lib.ErrAdminRequired)
+	}
+	job.Priority = priority
+	s.notifyJob(job)
+	return nil
+}
+
+// SetJobScript makes the jobs submitted to a printer from now on run
+// through steps by themselves, such as a job that prints two pages then
+// runs out of paper, so that tests need not drive them; nil removes the
+// script. A script stops when its job is removed.
+func (s *Spooler) SetJobScript(printerName string, steps []JobStep) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.printer(printerName) == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	if s.scripts == nil {
+		s.scripts = make(map[string][]JobStep)
+	}
+	if steps == nil {
+		delete(s.scripts, printerName)
+	} else {
+		s.scripts[printerName] = append([]JobStep(nil), steps...)
+	}
+	return nil
+}
+
+// addJob queues a new job, and starts the script of its printer. The
+// mutex must be held.
+func (s *Spooler) addJob(job *Job) {
+	if job.Submitted.IsZero() {
+		job.Submitted = time.Now()
+	}
+	s.jobs[job.ID] = job
+	s.notifyJob(job)
+	if steps, ok := s.scripts[job.Printer]; ok {
+		go s.runScript(job.ID, steps)
+	}
+}
+
+func (s *Spooler) runScript(jobID uint32, steps []JobStep) {
+	for _, step := range steps {
+		time.Sleep(step.After)
+		s.mutex.Lock()
+		job, ok := s.jobs[jobID]
+		if !ok {
+			s.mutex.Unlock()
+			return
+		}
+		job.Status = step.Status
+		job.PagesPrinted = step.PagesPrinted
+		if step.PagesPrinted < 0 {
+			job.PagesPrinted = job.Pages
+		}
+		s.notifyJob(job)
+		s.mutex.Unlock()
+	}
+}
+
+// SetPrintWindow holds the jobs submitted to a printer from now on outside
+// of window, as the StartTime and UntilTime of jobs do; nil removes it.
+func (s *Spooler) SetPrintWindow(printerName string, window *lib.PrintWindow) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	p := s.printer(printerName)
+	if p == nil {
+		return fmt.Errorf("%w: %s", lib.ErrPrinterNotFound, printerName)
+	}
+	p.PrintWindow = window
+	return nil
+}
+
+// PrintJobNow lets a job held outside of its print window print, which only
+// administrators may do.
+func (s *Spooler) PrintJobNow(printerName string, jobID uint32) error {
+	if err := s.inject("PrintJobNow", printerName); err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Printer != printerName {
+		return fmt.Errorf("%w: job %d on %s", lib.ErrJobNotFound, jobID, printerName)
+	}
+	if s.nonAdmin {
+		return fmt.Errorf("printing job %d outside of the print window of %s %w", jobID, printerName, lib.ErrAdminRequired)
+	}
+	job.Window = nil
+	s.notifyJob(job)
+	return nil
+}
+
+func (s *Spooler) WatchChanges(done <-chan struct{}) (<-chan lib.SpoolerChange, error) {
+	if err := s.inject("WatchChanges", ""); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	watcher := make(chan lib.SpoolerChange, 16)
+	s.watchers = append(s.watchers, watcher)
+
+	go func() {
+		<-done
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i, w := range s.watchers {
+			if w == watcher {
+				s.watchers = append(s.watchers[:i], s.watchers[i+1:]...)
+				break
+			}
+		}
+		close(watcher)
+	}()
+
+	return watcher, nil
+}
+
+// WatchJobChanges reports job status and page counts, like winspool does
+// with PRINTER_NOTIFY_OPTIONS.
+func (s *Spooler) WatchJobChanges(done <-chan struct{}) (<-chan lib.JobChange, error) {
+	if err := s.inject("WatchJobChanges", ""); err != nil {
+		return nil, err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	watcher := make(chan lib.JobChange, 64)
+	s.jobWatchers = append(s.jobWatchers, watcher)
+
+	go func() {
+		<-done
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i, w := range s.jobWatchers {
+			if w == watcher {
+				s.jobWatchers = append(s.jobWatchers[:i], s.jobWatchers[i+1:]...)
+				break
+			}
+		}
+		close(watcher)
+	}()
+
+	return watcher, nil
+}
+
+// WatchDevices reports PlugDevice calls.
+func (s *Spooler) WatchDevices(done <-chan struct{}) (<-chan lib.DeviceChange, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	watcher := make(chan lib.DeviceChange, 16)
+	s.deviceWatchers = append(s.deviceWatchers, watcher)
+
+	go func() {
+		<-done
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i, w := range s.deviceWatchers {
+			if w == watcher {
+				s.deviceWatchers = append(s.deviceWatchers[:i], s.deviceWatchers[i+1:]...)
+				break
+			}
+		}
+		close(watcher)
+	}()
+
+	return watcher, nil
+}
+
+// Subscribe delivers the printer and job events winspool would, until ctx
+// is done. Events are dropped when the subscriber falls behind.
+func (s *Spooler) Subscribe(ctx context.Context) (<-chan lib.Event, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sub := &subscriber{events: make(chan lib.Event, 64), jobs: lib.NewJobTransitions()}
+	s.subscribers = append(s.subscribers, sub)
+
+	go func() {
+		<-ctx.Done()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for i, w := range s.subscribers {
+			if w == sub {
+				s.subscribers = append(s.subscribers[:i], s.subscribers[i+1:]...)
+				break
+			}
+		}
+		close(sub.events)
+	}()
+
+	return sub.events, nil
+}
+
+func (s *Spooler) printer(name string) *Printer {
+	for _, p := range s.printers {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// notifyJob signals watchers that a job changed, and sends its values to
+// job watchers.
+func (s *Spooler) notifyJob(job *Job) {
+	s.notify(lib.SpoolerChangeJob)
+
+	status := job.Status
+	totalPages := uint32(job.Pages)
+	pagesPrinted := uint32(job.PagesPrinted)
+	change := lib.JobChange{
+		PrinterName:  job.Printer,
+		JobID:        job.ID,
+		Status:       &status,
+		TotalPages:   &totalPages,
+		PagesPrinted: &pagesPrinted,
+	}
+	for _, watcher := range s.jobWatchers {
+		select {
+		case watcher <- change:
+		default:
+		}
+	}
+	for _, sub := range s.subscribers {
+		if event, ok := sub.jobs.Apply(change); ok {
+			s.send(sub, event)
+		}
+	}
+}
+
+// publish sends a printer event to subscribers.
+func (s *Spooler) publish(event lib.Event) {
+	event.Time = time.Now()
+	for _, sub := range s.subscribers {
+		s.send(sub, event)
+	}
+}
+
+func (s *Spooler) send(sub *subscriber, event lib.Event) {
+	select {
+	case sub.events <- event:
+	default:
+	}
+}
+
+// notify signals watchers. Like the real spooler, notifications are
+// coalesced when a watcher falls behind.
+func (s *Spooler) notify(change lib.SpoolerChange) {
+	for _, watcher := range s.watchers {
+		select {
+		case watcher <- change:
+		default:
+		}
+	}
+}
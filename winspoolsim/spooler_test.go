@@ -0,0 +1,783 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/manager"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+var office = Printer{
+	Name:      "office",
+	Color:     true,
+	Duplex:    true,
+	Landscape: true,
+	MaxCopies: 99,
+	Collate:   true,
+	Papers:    []Paper{PaperLetter, PaperA4, PaperA5},
+	Bins:      []Bin{BinAuto, BinUpper, BinLower},
+	Default:   DevMode{Fields: FieldPaperSize, PaperSize: 9},
+}
+
+var receipt = Printer{
+	Name:    "receipt",
+	Papers:  []Paper{{Code: 256, Name: "80 x 200 mm", Width: 800, Length: 2000}},
+	Default: DevMode{Fields: FieldPaperSize, PaperSize: 256},
+}
+
+func getPrinter(t *testing.T, s *Spooler, name string) *lib.Printer {
+	printers, err := s.GetPrinters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range printers {
+		if printers[i].Name == name {
+			return &printers[i]
+		}
+	}
+	t.Fatalf("printer %s not found", name)
+	return nil
+}
+
+func hasWarning(result *lib.PrintResult, option string, reason lib.PrintWarningReason) bool {
+	for _, w := range result.Warnings {
+		if w.Option == option && w.Reason == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTicketApplication(t *testing.T) {
+	s := NewSpooler(office, receipt)
+
+	ticket := &model.JobTicket{
+		Duplex:          &model.DuplexTicketItem{Type: model.DuplexLongEdge},
+		PageOrientation: &model.PageOrientationTicketItem{Type: model.PageOrientationLandscape},
+		Copies:          &model.CopiesTicketItem{Copies: 3},
+		// Letter, as rounded by a metric client.
+		MediaSize:   &model.MediaSizeTicketItem{WidthMicrons: 216000, HeightMicrons: 279000},
+		MediaSource: &model.MediaSourceTicketItem{Type: model.MediaSourceLower},
+	}
+	result, err := s.Print(getPrinter(t, s, "office"), "report", 5, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("unexpected warnings %v", result.Warnings)
+	}
+	if result.Sheets != 9 {
+		t.Errorf("expected 9 sheets got %d", result.Sheets)
+	}
+	job, _ := s.Job(result.JobID)
+	dm := job.DevMode
+	if dm.Duplex != lib.DevModeDuplexVertical || dm.Orientation != lib.DevModeOrientationLandscape || dm.Copies != 3 {
+		t.Errorf("ticket not applied: %+v", dm)
+	}
+	if !dm.Has(FieldPaperSize) || dm.PaperSize != int16(PaperLetter.Code) || dm.Has(FieldPaperLength) {
+		t.Errorf("expected Letter paper code, got %+v", dm)
+	}
+	if !dm.Has(FieldDefaultSource) || dm.DefaultSource != lib.DevModeBinLower {
+		t.Errorf("expected lower tray, got %+v", dm)
+	}
+	result, err = s.Print(getPrinter(t, s, "office"), "report", 1, &model.JobTicket{
+		MediaSource: &model.MediaSourceTicketItem{Type: model.MediaSourceEnvelope},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ = s.Job(result.JobID); !hasWarning(result, "media_source", lib.PrintWarningInvalidValue) || job.DevMode.Has(FieldDefaultSource) {
+		t.Errorf("expected missing tray warning, got %v", result.Warnings)
+	}
+
+	// The receipt printer lacks duplex and copies.
+	ticket = &model.JobTicket{
+		Duplex:      &model.DuplexTicketItem{Type: model.DuplexLongEdge},
+		Copies:      &model.CopiesTicketItem{Copies: 2},
+		MediaSource: &model.MediaSourceTicketItem{VendorID: "1"},
+	}
+	result, err = s.Print(getPrinter(t, s, "receipt"), "receipt", 1, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasWarning(result, "duplex", lib.PrintWarningUnsupported) || !hasWarning(result, "copies", lib.PrintWarningEmulated) ||
+		!hasWarning(result, "media_source", lib.PrintWarningUnsupported) {
+		t.Errorf("expected duplex, copies and tray warnings, got %v", result.Warnings)
+	}
+	job, _ = s.Job(result.JobID)
+	if job.Pages != 2 || job.DevMode.Has(FieldDuplex) || job.DevMode.Has(FieldCopies) {
+		t.Errorf("expected 2 software copies without duplex, got %+v", job)
+	}
+
+	// Only the pages in range are printed.
+	pageRange, _ := model.ParsePageRange("2-3,5-")
+	result, err = s.Print(getPrinter(t, s, "office"), "excerpt", 5, &model.JobTicket{PageRange: pageRange})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ = s.Job(result.JobID); job.Pages != 3 || result.Pages != 3 {
+		t.Errorf("expected 3 pages in range, got %d", job.Pages)
+	}
+	pageRange, _ = model.ParsePageRange("7-")
+	_, err = s.Print(getPrinter(t, s, "office"), "excerpt", 5, &model.JobTicket{PageRange: pageRange})
+	var ticketErr *model.TicketError
+	if !errors.As(err, &ticketErr) {
+		t.Errorf("expected ticket error for a range past the last page, got %v", err)
+	}
+
+	// Out of range values fail instead of wrapping.
+	ticket = &model.JobTicket{MediaSize: &model.MediaSizeTicketItem{WidthMicrons: 80000, HeightMicrons: 400000000}}
+	_, err = s.Print(getPrinter(t, s, "receipt"), "long", 1, ticket)
+	var rangeErr *model.RangeError
+	if !errors.As(err, &rangeErr) || rangeErr.Option != "media_size.height_microns" {
+		t.Errorf("expected range error, got %v", err)
+	}
+}
+
+func TestPrintRaw(t *testing.T) {
+	s := NewSpooler(office, receipt)
+	result, err := s.PrintRaw("receipt", strings.NewReader("^XA^FDHello^FS^XZ"), "label", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := s.Job(result.JobID)
+	if job.Datatype != "RAW" || string(job.Data) != "^XA^FDHello^FS^XZ" || job.Pages != 0 {
+		t.Errorf("unexpected RAW job %+v", job)
+	}
+	if _, err = s.PrintRaw("missing", strings.NewReader(""), "label", "RAW"); err == nil {
+		t.Error("expected error for a missing printer")
+	}
+}
+
+func TestPrintRawTrailer(t *testing.T) {
+	cutting := receipt
+	cutting.JobTrailer = []byte("\x1dV\x01")
+	s := NewSpooler(cutting)
+	result, err := s.PrintRaw("receipt", strings.NewReader("receipt"), "receipt", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.Job(result.JobID); string(job.Data) != "receipt\x1dV\x01" {
+		t.Errorf("expected the trailer after the RAW data got %q", job.Data)
+	}
+	// Other datatypes aren't printer commands a trailer can follow.
+	result, err = s.PrintRaw("receipt", strings.NewReader("xps"), "document", "XPS_PASS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.Job(result.JobID); string(job.Data) != "xps" {
+		t.Errorf("expected no trailer after XPS_PASS data got %q", job.Data)
+	}
+}
+
+func TestPrinterControl(t *testing.T) {
+	s := NewSpooler(office, receipt)
+	ticket := &model.JobTicket{}
+	first, _ := s.Print(getPrinter(t, s, "office"), "first", 1, ticket)
+	second, _ := s.Print(getPrinter(t, s, "office"), "second", 1, ticket)
+	other, _ := s.Print(getPrinter(t, s, "receipt"), "other", 1, ticket)
+
+	if err := s.PausePrinter("office"); err != nil {
+		t.Fatal(err)
+	}
+	if state := getPrinter(t, s, "office").State.State; state != model.CloudDeviceStateStopped {
+		t.Errorf("expected a paused printer to be stopped got %s", state)
+	}
+	if err := s.ResumePrinter("office"); err != nil {
+		t.Fatal(err)
+	}
+	if state := getPrinter(t, s, "office").State.State; state != model.CloudDeviceStateIdle {
+		t.Errorf("expected a resumed printer to be idle got %s", state)
+	}
+
+	if err := s.PurgePrinter("office"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint32{first.JobID, second.JobID} {
+		if _, ok := s.Job(id); ok {
+			t.Errorf("job %d not purged", id)
+		}
+	}
+	if _, ok := s.Job(other.JobID); !ok {
+		t.Error("purge deleted the job of another printer")
+	}
+
+	s.SetUser("alice", false)
+	if err := s.PurgePrinter("receipt"); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("purging as a user: expected ErrAdminRequired got %v", err)
+	}
+}
+
+func TestDefaultPrinter(t *testing.T) {
+	s := NewSpooler(office, receipt)
+	if _, err := s.GetDefaultPrinter(); err == nil {
+		t.Error("expected no default printer")
+	}
+	if err := s.SetDefaultPrinter("missing"); err == nil {
+		t.Error("expected error setting a missing printer as default")
+	}
+	if err := s.SetDefaultPrinter("receipt"); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := s.GetDefaultPrinter(); name != "receipt" || err != nil {
+		t.Errorf("expected default receipt got %q: %v", name, err)
+	}
+	s.RemovePrinter("receipt")
+	if _, err := s.GetDefaultPrinter(); err == nil {
+		t.Error("expected no default printer once removed")
+	}
+}
+
+func TestPrintProgress(t *testing.T) {
+	s := NewSpooler(office)
+	var reported []lib.PrintProgress
+	ticket := &model.JobTicket{Copies: &model.CopiesTicketItem{Copies: 2}}
+	result, err := s.PrintWithProgress(getPrinter(t, s, "office"), "report", 3, ticket, func(p lib.PrintProgress) {
+		reported = append(reported, p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reported) != result.Pages || reported[len(reported)-1].PagesRendered != result.Pages || reported[0].TotalPages != result.Pages {
+		t.Errorf("unexpected progress %+v for %d pages", reported, result.Pages)
+	}
+
+	s.SetPagesPrinted(result.JobID, 2)
+	state, err := s.GetJobState("office", result.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *state.PagesPrinted != 2 || int(*state.TotalPages) != result.Pages {
+		t.Errorf("expected 2 of %d pages printed got %d of %d", result.Pages, *state.PagesPrinted, *state.TotalPages)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	s := NewSpooler(receipt)
+	if err := s.PausePrinter("missing"); !errors.Is(err, lib.ErrPrinterNotFound) {
+		t.Errorf("pausing a missing printer: expected ErrPrinterNotFound got %v", err)
+	}
+	if err := s.CancelJob("receipt", 42); !errors.Is(err, lib.ErrJobNotFound) {
+		t.Errorf("cancelling a missing job: expected ErrJobNotFound got %v", err)
+	}
+}
+
+func TestUserAccess(t *testing.T) {
+	s := NewSpooler(receipt)
+	first, _ := s.PrintRaw("receipt", strings.NewReader("first"), "first", "")
+	s.SetUser("bob", false)
+	other, _ := s.PrintRaw("receipt", strings.NewReader("other"), "other", "")
+	s.SetUser("alice", false)
+	if job, _ := s.Job(other.JobID); job.UserName != "bob" {
+		t.Errorf("expected job of bob got %q", job.UserName)
+	}
+
+	if err := s.CancelJob("receipt", first.JobID); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("cancelling the job of another user: expected ErrAdminRequired got %v", err)
+	}
+	if _, err := s.ResumeHeldJobs("receipt"); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("resuming jobs: expected ErrAdminRequired got %v", err)
+	}
+	mine, _ := s.PrintRaw("receipt", strings.NewReader("mine"), "mine", "")
+	if err := s.CancelJob("receipt", mine.JobID); err != nil {
+		t.Errorf("cancelling an own job: %s", err)
+	}
+
+	if err := s.SetJobPriority("receipt", other.JobID, 50); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("changing the priority of the job of another user: expected ErrAdminRequired got %v", err)
+	}
+
+	s.SetUser("admin", true)
+	if err := s.CancelJob("receipt", first.JobID); err != nil {
+		t.Errorf("cancelling as administrator: %s", err)
+	}
+	if err := s.SetJobPriority("receipt", other.JobID, 50); err != nil {
+		t.Fatalf("changing the priority as administrator: %s", err)
+	}
+	last, _ := s.PrintRaw("receipt", strings.NewReader("last"), "last", "")
+	if jobs := s.Jobs("receipt"); len(jobs) != 2 || jobs[0].ID != other.JobID || jobs[1].ID != last.JobID {
+		t.Errorf("expected the job of priority 50 first got %+v", jobs)
+	}
+}
+
+// waitWatching waits for the printer manager to watch changes, which it
+// starts doing in the background.
+func waitWatching(t *testing.T, s *Spooler) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		s.mutex.Lock()
+		watching := len(s.watchers) > 0 && len(s.jobWatchers) > 0 && len(s.deviceWatchers) > 0
+		s.mutex.Unlock()
+		if watching {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("printer manager isn't watching changes")
+		}
+	}
+}
+
+func TestJobTracking(t *testing.T) {
+	s := NewSpooler(office)
+	pm, err := manager.NewPrinterManager(s, &lib.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+	waitWatching(t, s)
+
+	printer, ok := pm.GetPrinter("office")
+	if !ok {
+		t.Fatal("printer missing after initial sync")
+	}
+	result, err := s.Print(&printer, "report", 2, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updates := make(chan model.JobStateType, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "office",
+		JobID:             "report",
+		UpdateJob: func(jobID string, diff *model.PrintJobStateDiff) error {
+			updates <- diff.State.Type
+			return nil
+		},
+	}, result.JobID)
+
+	expect := func(state model.JobStateType) {
+		t.Helper()
+		select {
+		case got := <-updates:
+			if got != state {
+				t.Fatalf("expected %s got %s", state, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s update not received", state)
+		}
+	}
+
+	s.Advance(result.JobID)
+	expect(model.JobStateInProgress)
+	s.Advance(result.JobID)
+	expect(model.JobStateDone)
+
+	// Once done, the retained job is released.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, exists := s.Job(result.JobID); !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("job not released")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	s.AddPrinter(receipt)
+	for deadline = time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, exists := pm.GetPrinter("receipt"); exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("added printer not synced")
+		}
+	}
+}
+
+func TestUSBHotplug(t *testing.T) {
+	s := NewSpooler(office)
+	config := lib.DefaultConfig
+	config.ResumeHeldJobsOnArrival = true
+	pm, err := manager.NewPrinterManager(s, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+	waitWatching(t, s)
+
+	expect := func(eventType manager.PrinterEventType) {
+		t.Helper()
+		select {
+		case event := <-pm.PrinterEvents():
+			if event.Printer != "office" || event.Type != eventType {
+				t.Fatalf("expected office %s got %+v", eventType, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s event not received", eventType)
+		}
+	}
+
+	printer, _ := pm.GetPrinter("office")
+	result, err := s.Print(&printer, "report", 1, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetJobStatus(result.JobID, lib.JobStatusPaused)
+	// Jobs held by their ticket wait for their release.
+	held, err := s.Print(&printer, "payslips", 1, &model.JobTicket{Hold: &model.HoldTicketItem{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.PlugDevice("office", false)
+	expect(manager.PrinterOffline)
+	if printer, _ = pm.GetPrinter("office"); !printer.Offline {
+		t.Error("unplugged printer not offline")
+	}
+
+	s.PlugDevice("office", true)
+	expect(manager.PrinterOnline)
+	if job, _ := s.Job(result.JobID); job.Status&lib.JobStatusPaused != 0 {
+		t.Errorf("held job not resumed, status %#x", job.Status)
+	}
+	if job, _ := s.Job(held.JobID); job.Status&lib.JobStatusPaused == 0 {
+		t.Error("job held by its ticket resumed")
+	}
+
+	s.RemovePrinter("office")
+	expect(manager.PrinterRemoved)
+}
+
+func TestPaperOut(t *testing.T) {
+	s := NewSpooler(office)
+	pm, err := manager.NewPrinterManager(s, &lib.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pm.Quit()
+	waitWatching(t, s)
+
+	printer, _ := pm.GetPrinter("office")
+	result, err := s.Print(&printer, "report", 2, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	interruptions := make(chan lib.JobInterruption, 10)
+	pm.TrackJob(&lib.Job{
+		NativePrinterName: "office",
+		JobID:             "report",
+		ReportInterruption: func(jobID string, interruption lib.JobInterruption) error {
+			interruptions <- interruption
+			return nil
+		},
+	}, result.JobID)
+	expect := func(recovery lib.JobRecovery) {
+		t.Helper()
+		select {
+		case interruption := <-interruptions:
+			if interruption.Recovery != recovery {
+				t.Fatalf("expected recovery %q got %+v", recovery, interruption)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("interruption not reported")
+		}
+	}
+
+	s.Advance(result.JobID)
+	s.SetJobStatus(result.JobID, lib.JobStatusPaperOut)
+	expect("")
+	if state, _ := s.GetJobState("office", result.JobID); !lib.IsJobPaperOut(state) {
+		t.Errorf("expected a paper out job state got %+v", state.State)
+	}
+	s.SetJobStatus(result.JobID, lib.JobStatusPrinting)
+	expect(lib.JobRecoveryResumed)
+
+	s.SetPrinterStatus("office", PrinterStatusPaperOut)
+	if !lib.IsPaperOut(getPrinter(t, s, "office").State) {
+		t.Error("expected the printer to be out of paper")
+	}
+	if err = s.RestartJob("office", result.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if job, _ := s.Job(result.JobID); job.Status&lib.JobStatusPrinting == 0 || job.PagesPrinted != 0 {
+		t.Errorf("job not restarted, status %#x with %d pages printed", job.Status, job.PagesPrinted)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := NewSpooler(office)
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := s.Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.AddPrinter(receipt)
+	s.SetPrinterStatus("receipt", PrinterStatusPaused)
+	result, err := s.Print(getPrinter(t, s, "office"), "report", 1, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Advance(result.JobID) // Still in progress, not an event.
+	s.Advance(result.JobID)
+	s.RemovePrinter("receipt")
+
+	expected := []struct {
+		eventType lib.EventType
+		printer   string
+	}{
+		{lib.EventPrinterAdded, "receipt"},
+		{lib.EventPrinterStateChanged, "receipt"},
+		{lib.EventJobAdded, "office"},
+		{lib.EventJobStateChanged, "office"},
+		{lib.EventPrinterRemoved, "receipt"},
+	}
+	for _, e := range expected {
+		event := <-events
+		if event.Type != e.eventType || event.Printer != e.printer {
+			t.Fatalf("expected %s %s got %+v", e.printer, e.eventType, event)
+		}
+		if event.Type == lib.EventJobStateChanged && event.JobState.State.Type != model.JobStateDone {
+			t.Errorf("expected done job got %+v", event.JobState)
+		}
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestFaults(t *testing.T) {
+	s := NewSpooler(office)
+	result, err := s.Print(getPrinter(t, s, "office"), "report", 1, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	faults, err := lib.NewFaults([]lib.FaultConfig{
+		{Operation: "CancelJob", Error: "access denied", Count: 1},
+		{Operation: "GetPrinters", Error: "RPC server unavailable"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetFaults(faults)
+
+	if _, err = s.GetPrinters(); !errors.Is(err, lib.ErrFaultInjected) {
+		t.Errorf("expected injected fault got %v", err)
+	}
+	if err = s.CancelJob("office", result.JobID); !errors.Is(err, lib.ErrFaultInjected) {
+		t.Errorf("expected injected fault got %v", err)
+	}
+	if _, ok := s.Job(result.JobID); !ok {
+		t.Error("job cancelled despite fault")
+	}
+	if err = s.CancelJob("office", result.JobID); err != nil {
+		t.Errorf("expected second cancel to succeed got %v", err)
+	}
+
+	s.SetFaults(nil)
+	if _, err = s.GetPrinters(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDevModeExport(t *testing.T) {
+	officeA4 := office
+	officeA4.Name = "office-2"
+	officeA4.Default = DevMode{Fields: FieldPaperSize | FieldDuplex, PaperSize: 9, Duplex: lib.DevModeDuplexVertical}
+	s := NewSpooler(office, officeA4, receipt)
+
+	export, err := s.ExportDevMode("office-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lib.ParseDevModeHeader(export.DevMode); err != nil {
+		t.Fatalf("exported DEVMODE: %s", err)
+	}
+	if err := s.ImportDevMode("office", export); err != nil {
+		t.Fatal(err)
+	}
+	if d := getPrinter(t, s, "office").Description.Duplex; d == nil || !d.Option[1].IsDefault {
+		t.Errorf("expected long edge duplex by default after import got %+v", d)
+	}
+
+	if err := s.ImportDevMode("receipt", export); err == nil {
+		t.Error("expected the driver to reject a paper size the printer lacks")
+	}
+	other := receipt
+	other.Name = "label"
+	other.Driver = "Label Driver"
+	s = NewSpooler(office, other)
+	if err := s.ImportDevMode("label", export); !errors.Is(err, lib.ErrDriverMismatch) {
+		t.Errorf("expected ErrDriverMismatch importing to another driver got %v", err)
+	}
+
+	s.SetUser("alice", false)
+	if err := s.ImportDevMode("office", export); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("importing as a user: expected ErrAdminRequired got %v", err)
+	}
+}
+
+func TestTicketDevMode(t *testing.T) {
+	s := NewSpooler(office, receipt)
+	devMode := DevMode{Fields: FieldPaperSize | FieldDuplex, PaperSize: 11, Duplex: lib.DevModeDuplexVertical}
+	export := &lib.DevModeExport{Printer: "office", Driver: office.driver(), DriverVersion: devModeDriverVersion, DevMode: devMode.Bytes()}
+	ticket := lib.WithDevMode(&model.JobTicket{Copies: &model.CopiesTicketItem{Copies: 2}}, export)
+
+	result, err := s.Print(getPrinter(t, s, "office"), "staple", 1, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, _ := s.Job(result.JobID)
+	if job.DevMode.PaperSize != 11 || job.DevMode.Duplex != lib.DevModeDuplexVertical || job.DevMode.Copies != 2 {
+		t.Errorf("expected the DEVMODE of the ticket with its copies got %+v", job.DevMode)
+	}
+
+	if _, err = s.Print(getPrinter(t, s, "receipt"), "staple", 1, ticket); err == nil {
+		t.Error("expected the driver to reject a paper size the printer lacks")
+	}
+	preset := &model.JobTicket{VendorTicketItem: []model.VendorTicketItem{{ID: lib.DevModePresetID, Value: "staple"}}}
+	if _, err = s.Print(getPrinter(t, s, "office"), "staple", 1, preset); err == nil {
+		t.Error("expected error for a preset the spooler can't read")
+	}
+}
+
+func TestDriverCapabilities(t *testing.T) {
+	office := office
+	office.Resolutions = []lib.Resolution{{X: 600, Y: 600}, {X: 1200, Y: 1200}}
+	s := NewSpooler(office, receipt)
+
+	driver, err := s.DriverCapabilities("office")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(driver.Resolutions) != 2 || driver.DefaultResolution != office.Resolutions[0] {
+		t.Errorf("unexpected resolutions %+v", driver)
+	}
+	if _, err := lib.ParseDevModeHeader(driver.DevMode); err != nil {
+		t.Errorf("DEVMODE: %s", err)
+	}
+	if driver, err = s.DriverCapabilities("receipt"); err != nil || len(driver.Resolutions) != 0 {
+		t.Errorf("expected no resolutions got %+v, %v", driver, err)
+	}
+	if _, err = s.DriverCapabilities("missing"); err == nil {
+		t.Error("expected an error for a missing printer")
+	}
+}
+
+func TestPrintWindow(t *testing.T) {
+	s := NewSpooler(receipt)
+	// Opens in an hour, so that it is closed now.
+	now := time.Now()
+	sinceMidnight := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	window := &lib.PrintWindow{Start: (sinceMidnight + time.Hour) % (24 * time.Hour), End: (sinceMidnight + 3*time.Hour) % (24 * time.Hour)}
+	if err := s.SetPrintWindow("receipt", window); err != nil {
+		t.Fatal(err)
+	}
+
+	held, _ := s.PrintRaw("receipt", strings.NewReader("held"), "held", "")
+	if err := s.Advance(held.JobID); err == nil {
+		t.Error("expected a job outside of the print window to be held")
+	}
+	s.SetUser("bob", false)
+	if err := s.PrintJobNow("receipt", held.JobID); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("printing now as bob: expected ErrAdminRequired got %v", err)
+	}
+	s.SetUser("admin", true)
+	if err := s.PrintJobNow("receipt", held.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Advance(held.JobID); err != nil {
+		t.Errorf("expected a job printed now to advance: %s", err)
+	}
+
+	s.SetPrintWindow("receipt", nil)
+	free, _ := s.PrintRaw("receipt", strings.NewReader("free"), "free", "")
+	if err := s.Advance(free.JobID); err != nil {
+		t.Errorf("expected a job without print window to advance: %s", err)
+	}
+
+	printer := lib.Printer{Name: "receipt"}
+	ticket := &model.JobTicket{HoldUntil: &model.HoldUntilTicketItem{Time: now.Add(time.Hour)}}
+	night, err := s.Print(&printer, "night", 1, ticket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Advance(night.JobID); err == nil {
+		t.Error("expected a job held until later to be held")
+	}
+	ticket.HoldUntil.Time = now.Add(48 * time.Hour)
+	if _, err := s.Print(&printer, "weekend", 1, ticket); err == nil {
+		t.Error("expected an error holding a job for two days")
+	}
+}
+
+func TestHoldJob(t *testing.T) {
+	s := NewSpooler(receipt)
+	printer := lib.Printer{Name: "receipt"}
+	s.SetUser("alice", false)
+	held, err := s.Print(&printer, "payslip", 1, &model.JobTicket{Hold: &model.HoldTicketItem{PIN: "4711"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Advance(held.JobID); err == nil {
+		t.Error("expected a held job to stay paused")
+	}
+	s.SetUser("bob", false)
+	if err = s.ResumeJob("receipt", held.JobID); !errors.Is(err, lib.ErrAdminRequired) {
+		t.Errorf("releasing as bob: expected ErrAdminRequired got %v", err)
+	}
+	s.SetUser("alice", false)
+	if err = s.ResumeJob("receipt", held.JobID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Advance(held.JobID); err != nil {
+		t.Errorf("expected a released job to advance: %s", err)
+	}
+}
+
+func TestJobScript(t *testing.T) {
+	s := NewSpooler(office)
+	if err := s.SetJobScript("unknown", nil); err == nil {
+		t.Error("expected an error for an unknown printer")
+	}
+	err := s.SetJobScript("office", []JobStep{
+		{Status: lib.JobStatusPrinting},
+		{After: 10 * time.Millisecond, Status: lib.JobStatusPrinting | lib.JobStatusPaperOut, PagesPrinted: 1},
+		{After: 10 * time.Millisecond, Status: lib.JobStatusPrinted | lib.JobStatusRetained, PagesPrinted: -1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := s.Print(getPrinter(t, s, "office"), "report", 3, &model.JobTicket{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen []uint32
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		job, _ := s.Job(result.JobID)
+		if len(seen) == 0 || seen[len(seen)-1] != job.Status {
+			seen = append(seen, job.Status)
+		}
+		if job.Status&lib.JobStatusPrinted != 0 {
+			if job.PagesPrinted != 3 {
+				t.Errorf("expected all 3 pages printed got %d", job.PagesPrinted)
+			}
+			break
+		}
+	}
+	if len(seen) < 2 || seen[len(seen)-1] != lib.JobStatusPrinted|lib.JobStatusRetained {
+		t.Fatalf("job didn't run through the script, statuses %#x", seen)
+	}
+	for _, status := range seen {
+		if status&lib.JobStatusPaperOut != 0 {
+			return
+		}
+	}
+	t.Errorf("expected the job to run out of paper, statuses %#x", seen)
+}
@@ -0,0 +1,231 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+// virtualPrinter is the default capability table of virtual printers.
+var virtualPrinter = Printer{
+	Color:     true,
+	Duplex:    true,
+	Landscape: true,
+	MaxCopies: 99,
+	Collate:   true,
+	Papers:    []Paper{PaperLetter, PaperLegal, PaperA4, PaperA5},
+	Default:   DevMode{Fields: FieldPaperSize, PaperSize: 9},
+
+	Resolutions: []lib.Resolution{{X: 600, Y: 600}, {X: 300, Y: 300}},
+}
+
+// Matches page objects, but not the page tree nodes (/Type /Pages).
+var rPDFPage = regexp.MustCompile(`/Type\s*/Page\b`)
+
+type virtualConfig struct {
+	outputDir   string
+	startDelay  time.Duration
+	pageDelay   time.Duration
+	failureRate float64
+}
+
+// VirtualPrinters is a Spooler whose jobs progress by themselves: they start
+// printing after the start delay, print a page per page delay, write their
+// document to the output folder, and fail at the configured rate. It stands
+// in for hardware in load and integration tests of the daemon.
+type VirtualPrinters struct {
+	*Spooler
+
+	configs map[string]virtualConfig
+
+	randMutex sync.Mutex
+	rand      *rand.Rand
+}
+
+// NewVirtualPrinters creates the configured printers. Job IDs start at
+// firstJobID, so that they don't collide with those of the real spooler.
+func NewVirtualPrinters(configs []lib.VirtualPrinterConfig, firstJobID uint32) (*VirtualPrinters, error) {
+	v := VirtualPrinters{
+		Spooler: NewSpooler(),
+		configs: make(map[string]virtualConfig, len(configs)),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	v.Spooler.nextJobID = firstJobID
+	for _, config := range configs {
+		if config.Name == "" {
+			return nil, errors.New("virtual printer without name")
+		}
+		if _, exists := v.configs[config.Name]; exists {
+			return nil, fmt.Errorf("duplicate virtual printer %s", config.Name)
+		}
+		startDelay, pageDelay, err := config.GetDelays()
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay for virtual printer %s: %s", config.Name, err)
+		}
+		if config.FailureRate < 0 || config.FailureRate > 1 {
+			return nil, fmt.Errorf("invalid failure_rate %g for virtual printer %s, expected 0 to 1", config.FailureRate, config.Name)
+		}
+		if config.OutputDir != "" {
+			if err = os.MkdirAll(config.OutputDir, 0755); err != nil {
+				return nil, err
+			}
+		}
+		v.configs[config.Name] = virtualConfig{
+			outputDir:   config.OutputDir,
+			startDelay:  startDelay,
+			pageDelay:   pageDelay,
+			failureRate: config.FailureRate,
+		}
+
+		printer := virtualPrinter
+		printer.Name = config.Name
+		v.AddPrinter(printer)
+	}
+	return &v, nil
+}
+
+// Has tells whether printerName is a virtual printer.
+func (v *VirtualPrinters) Has(printerName string) bool {
+	_, ok := v.configs[printerName]
+	return ok
+}
+
+// PrintFile queues a job for a document, and prints it in the background.
+// The pages of PDF documents are counted; other documents have one page.
+func (v *VirtualPrinters) PrintFile(printer *lib.Printer, fileName, title string, ticket *model.JobTicket, progress lib.ProgressFunc) (*lib.PrintResult, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	pages := 1
+	if lib.DetectContentType(data) == lib.ContentTypePDF {
+		if n := len(rPDFPage.FindAll(data, -1)); n > 0 {
+			pages = n
+		}
+	}
+
+	result, err := v.PrintWithProgress(printer, title, pages, ticket, progress)
+	if err != nil {
+		return nil, err
+	}
+	go v.run(printer.Name, result.JobID, title, data)
+	return result, nil
+}
+
+// PrintRaw queues a job holding data as-is, and prints it in the
+// background.
+func (v *VirtualPrinters) PrintRaw(printerName string, data io.Reader, docName, datatype string) (*lib.PrintResult, error) {
+	b, err := ioutil.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	result, err := v.Spooler.PrintRaw(printerName, bytes.NewReader(b), docName, datatype)
+	if err != nil {
+		return nil, err
+	}
+	go v.run(printerName, result.JobID, docName, b)
+	return result, nil
+}
+
+// failAt picks the page a job fails at, or zero when it doesn't fail.
+func (v *VirtualPrinters) failAt(config virtualConfig, pages int) int {
+	v.randMutex.Lock()
+	defer v.randMutex.Unlock()
+	if v.rand.Float64() >= config.failureRate {
+		return 0
+	}
+	return 1 + v.rand.Intn(pages)
+}
+
+// run moves a job through spooling, printing and printed, page by page. It
+// stops when the job is cancelled, as the job is then gone.
+func (v *VirtualPrinters) run(printerName string, jobID uint32, title string, data []byte) {
+	config := v.configs[printerName]
+	time.Sleep(config.startDelay)
+	// Held jobs are checked every second, as PrintJobNow may release them
+	// before their window opens.
+	for {
+		job, ok := v.Job(jobID)
+		if !ok {
+			return
+		}
+		if !job.Held(time.Now()) {
+			break
+		}
+		time.Sleep(time.Second)
+	}
+	if v.Advance(jobID) != nil {
+		return
+	}
+
+	job, ok := v.Job(jobID)
+	if !ok {
+		return
+	}
+	// RAW jobs have no page count; they take one page delay.
+	pages := job.Pages
+	if pages == 0 {
+		pages = 1
+	}
+	failAt := v.failAt(config, pages)
+	for page := 1; page <= pages; page++ {
+		time.Sleep(config.pageDelay)
+		if page == failAt {
+			v.SetJobStatus(jobID, lib.JobStatusPrinting|lib.JobStatusError)
+			return
+		}
+		if job.Pages > 0 && v.SetPagesPrinted(jobID, page) != nil {
+			return
+		}
+	}
+
+	if config.outputDir != "" {
+		if err := ioutil.WriteFile(filepath.Join(config.outputDir, outputFileName(jobID, title, data)), data, 0644); err != nil {
+			v.SetJobStatus(jobID, lib.JobStatusPrinting|lib.JobStatusError)
+			return
+		}
+	}
+	v.Advance(jobID)
+}
+
+// outputFileName names the document of a job after its ID and title, with
+// an extension for its format.
+func outputFileName(jobID uint32, title string, data []byte) string {
+	title = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`<>:"/\|?*`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, title)
+	ext := ".prn"
+	switch lib.DetectContentType(data) {
+	case lib.ContentTypePDF:
+		ext = ".pdf"
+	case lib.ContentTypePostScript:
+		ext = ".ps"
+	}
+	if strings.HasSuffix(strings.ToLower(title), ext) {
+		ext = ""
+	}
+	return fmt.Sprintf("%d-%s%s", jobID, title, ext)
+}
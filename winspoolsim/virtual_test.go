@@ -0,0 +1,85 @@
+/*
+Copyright 2015 Google Inc. All rights reserved.
+
+Use of this source code is governed by a BSD-style
+license that can be found in the LICENSE file or at
+https://developers.google.com/open-source/licenses/bsd
+*/
+
+package winspoolsim
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorpher/winspool-cgo/lib"
+	"github.com/gorpher/winspool-cgo/model"
+)
+
+const twoPagePDF = "%PDF-1.4\n1 0 obj << /Type /Pages /Kids [2 0 R 3 0 R] /Count 2 >> endobj\n" +
+	"2 0 obj << /Type /Page /Parent 1 0 R >> endobj\n3 0 obj << /Type/Page /Parent 1 0 R >> endobj\n%%EOF\n"
+
+// waitJobStatus waits for a job to reach one of the status flags.
+func waitJobStatus(t *testing.T, v *VirtualPrinters, jobID, status uint32) Job {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		job, ok := v.Job(jobID)
+		if ok && job.Status&status != 0 {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d didn't reach status %#x: %+v", jobID, status, job)
+		}
+	}
+}
+
+func TestVirtualPrinters(t *testing.T) {
+	dir := t.TempDir()
+	v, err := NewVirtualPrinters([]lib.VirtualPrinterConfig{
+		{Name: "virtual", OutputDir: filepath.Join(dir, "out"), PageDelay: "1ms"},
+		{Name: "broken", FailureRate: 1},
+	}, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !v.Has("virtual") || v.Has("office") {
+		t.Error("unexpected virtual printers")
+	}
+
+	document := filepath.Join(dir, "report.pdf")
+	if err = ioutil.WriteFile(document, []byte(twoPagePDF), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := v.PrintFile(getPrinter(t, v.Spooler, "virtual"), document, "report", &model.JobTicket{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.JobID != 1000 || result.Pages != 2 {
+		t.Errorf("expected job 1000 of 2 pages got %d of %d", result.JobID, result.Pages)
+	}
+	job := waitJobStatus(t, v, result.JobID, lib.JobStatusPrinted)
+	if job.PagesPrinted != 2 {
+		t.Errorf("expected 2 pages printed got %d", job.PagesPrinted)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "out", "1000-report.pdf")); err != nil || string(b) != twoPagePDF {
+		t.Errorf("document not written to the output folder: %v", err)
+	}
+
+	result, err = v.PrintFile(getPrinter(t, v.Spooler, "broken"), document, "report", &model.JobTicket{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitJobStatus(t, v, result.JobID, lib.JobStatusError)
+
+	for _, configs := range [][]lib.VirtualPrinterConfig{
+		{{Name: ""}},
+		{{Name: "a"}, {Name: "a"}},
+		{{Name: "a", PageDelay: "soon"}},
+		{{Name: "a", FailureRate: 2}},
+	} {
+		if _, err := NewVirtualPrinters(configs, 1); err == nil {
+			t.Errorf("expected error for %+v", configs)
+		}
+	}
+}